@@ -0,0 +1,203 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// AllLimits bounds the items collected by QueryAllWithLimits and
+// ScanAllWithLimits. Zero means no limit.
+type AllLimits struct {
+	// MaxItems is the maximum number of items collected.
+	MaxItems int
+	// MaxBytes is the maximum size of the items collected, estimated following
+	// the DynamoDB item size rules.
+	MaxBytes int64
+}
+
+// AllOutput holds the items collected over every page of a Query or Scan.
+type AllOutput struct {
+	Items []map[string]*dynamodb.AttributeValue
+	// Count is the number of items collected.
+	Count int64
+	// ScannedCount is the number of items evaluated by the pages fetched.
+	ScannedCount int64
+	// ConsumedCapacity is the capacity consumed by the pages fetched, per table.
+	ConsumedCapacity []*dynamodb.ConsumedCapacity
+	// Truncated is set when a limit stopped the collection before the last item.
+	// As a page may have been truncated, there is no key to resume from.
+	Truncated bool
+}
+
+// QueryAll returns the items of every page of the query. Pages are fetched as
+// QueryPagesWithContext does, and no more pages are fetched once ctx is done.
+func (d *Dax) QueryAll(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) ([]map[string]*dynamodb.AttributeValue, error) {
+	output, err := d.QueryAllWithLimits(ctx, input, AllLimits{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return output.Items, nil
+}
+
+// QueryAllWithLimits is like QueryAll, but stops collecting items once one of
+// limits is reached, and returns the counts and consumed capacity of the pages.
+// When a page fails, the output holds the items of the previous pages.
+//
+// A Limit set on input applies to each page.
+func (d *Dax) QueryAllWithLimits(ctx aws.Context, input *dynamodb.QueryInput, limits AllLimits, opts ...request.Option) (*AllOutput, error) {
+	c := allCollector{ctx: ctx, limits: limits}
+	err := d.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		return c.add(page.Items, page.ScannedCount, page.ConsumedCapacity, lastPage)
+	}, opts...)
+	return c.result(err)
+}
+
+// ScanAll returns the items of every page of the scan. Pages are fetched as
+// ScanPagesWithContext does, and no more pages are fetched once ctx is done.
+func (d *Dax) ScanAll(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) ([]map[string]*dynamodb.AttributeValue, error) {
+	output, err := d.ScanAllWithLimits(ctx, input, AllLimits{}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return output.Items, nil
+}
+
+// ScanAllWithLimits is like ScanAll, but stops collecting items once one of
+// limits is reached, and returns the counts and consumed capacity of the pages.
+// When a page fails, the output holds the items of the previous pages.
+//
+// A Limit set on input applies to each page.
+func (d *Dax) ScanAllWithLimits(ctx aws.Context, input *dynamodb.ScanInput, limits AllLimits, opts ...request.Option) (*AllOutput, error) {
+	c := allCollector{ctx: ctx, limits: limits}
+	err := d.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		return c.add(page.Items, page.ScannedCount, page.ConsumedCapacity, lastPage)
+	}, opts...)
+	return c.result(err)
+}
+
+type allCollector struct {
+	ctx    aws.Context
+	limits AllLimits
+	output AllOutput
+	size   int64
+}
+
+// Adds the items of a page, returns whether the next page should be fetched.
+func (c *allCollector) add(items []map[string]*dynamodb.AttributeValue, scanned *int64, capacity *dynamodb.ConsumedCapacity, lastPage bool) bool {
+	c.output.ScannedCount += aws.Int64Value(scanned)
+	if capacity != nil {
+		c.output.ConsumedCapacity = client.MergeConsumedCapacity(c.output.ConsumedCapacity, []*dynamodb.ConsumedCapacity{capacity})
+	}
+	for i, item := range items {
+		if c.limits.MaxItems > 0 && len(c.output.Items) >= c.limits.MaxItems {
+			c.output.Truncated = true
+			return false
+		}
+		if c.limits.MaxBytes > 0 {
+			size := itemSize(item)
+			if c.size+size > c.limits.MaxBytes {
+				c.output.Truncated = true
+				return false
+			}
+			c.size += size
+		}
+		c.output.Items = append(c.output.Items, item)
+		c.output.Count++
+		if i == len(items)-1 && !lastPage && c.limits.MaxItems > 0 && len(c.output.Items) >= c.limits.MaxItems {
+			c.output.Truncated = true
+			return false
+		}
+	}
+	return c.ctx == nil || c.ctx.Err() == nil
+}
+
+func (c *allCollector) result(err error) (*AllOutput, error) {
+	if err == nil && c.ctx != nil && c.ctx.Err() != nil && !c.output.Truncated {
+		err = client.WrapError(request.CanceledErrorCode, "request context canceled", c.ctx.Err())
+	}
+	return &c.output, err
+}
+
+// Returns the size of item, following the DynamoDB item size rules.
+func itemSize(item map[string]*dynamodb.AttributeValue) int64 {
+	var size int64
+	for name, av := range item {
+		size += int64(len(name)) + attributeValueSize(av)
+	}
+	return size
+}
+
+func attributeValueSize(av *dynamodb.AttributeValue) int64 {
+	if av == nil {
+		return 0
+	}
+	switch {
+	case av.S != nil:
+		return int64(len(*av.S))
+	case av.N != nil:
+		return numberSize(*av.N)
+	case av.B != nil:
+		return int64(len(av.B))
+	case av.BOOL != nil, av.NULL != nil:
+		return 1
+	case av.SS != nil:
+		var size int64
+		for _, s := range av.SS {
+			size += int64(len(aws.StringValue(s)))
+		}
+		return size
+	case av.NS != nil:
+		var size int64
+		for _, n := range av.NS {
+			size += numberSize(aws.StringValue(n))
+		}
+		return size
+	case av.BS != nil:
+		var size int64
+		for _, b := range av.BS {
+			size += int64(len(b))
+		}
+		return size
+	case av.L != nil:
+		size := int64(3)
+		for _, e := range av.L {
+			size += 1 + attributeValueSize(e)
+		}
+		return size
+	case av.M != nil:
+		size := int64(3)
+		for name, e := range av.M {
+			size += 1 + int64(len(name)) + attributeValueSize(e)
+		}
+		return size
+	}
+	return 0
+}
+
+// Numbers take one byte per two significant digits, plus one byte.
+func numberSize(n string) int64 {
+	digits := int64(0)
+	for _, r := range n {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return (digits+1)/2 + 1
+}
@@ -0,0 +1,204 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func allTestItems(from, to int) []map[string]*dynamodb.AttributeValue {
+	var items []map[string]*dynamodb.AttributeValue
+	for i := from; i < to; i++ {
+		items = append(items, map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key" + strconv.Itoa(i))}})
+	}
+	return items
+}
+
+// Returns pages of size items out of n items, the last page having no LastEvaluatedKey.
+func queryPages(n, size int) []*dynamodb.QueryOutput {
+	var pages []*dynamodb.QueryOutput
+	for i := 0; i < n; i += size {
+		end := i + size
+		if end > n {
+			end = n
+		}
+		page := &dynamodb.QueryOutput{
+			Items:            allTestItems(i, end),
+			Count:            aws.Int64(int64(end - i)),
+			ScannedCount:     aws.Int64(int64(2 * (end - i))),
+			ConsumedCapacity: &dynamodb.ConsumedCapacity{TableName: aws.String("tablename"), CapacityUnits: aws.Float64(0.5)},
+		}
+		if end < n {
+			page.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key" + strconv.Itoa(end-1))}}
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+func TestQueryAll(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+	input := &dynamodb.QueryInput{TableName: aws.String("tablename")}
+
+	output, err := db.QueryAllWithLimits(context.Background(), input, AllLimits{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := allTestItems(0, 5), output.Items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if output.Count != 5 || output.ScannedCount != 10 || output.Truncated {
+		t.Errorf("expect 5 items out of 10 scanned, got %d out of %d, truncated %v", output.Count, output.ScannedCount, output.Truncated)
+	}
+	if e, a := 1.5, aws.Float64Value(output.ConsumedCapacity[0].CapacityUnits); len(output.ConsumedCapacity) != 1 || e != a {
+		t.Errorf("expect %v capacity units, got %v", e, output.ConsumedCapacity)
+	}
+	if e, a := 3, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+	if e, a := "key3", aws.StringValue(stub.GetQueryRequests()[2].ExclusiveStartKey["key"].S); e != a {
+		t.Errorf("expect last request to start after %v, got %v", e, a)
+	}
+
+	stub = client.NewClientStub(nil, queryPages(5, 2), nil)
+	db = NewWithInternalClient(stub)
+	items, err := db.QueryAll(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := allTestItems(0, 5), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestQueryAll_MaxItems(t *testing.T) {
+	cases := []struct {
+		maxItems  int
+		items     int
+		requests  int
+		truncated bool
+	}{
+		{maxItems: 3, items: 3, requests: 2, truncated: true},  // cut mid-page
+		{maxItems: 4, items: 4, requests: 2, truncated: true},  // cut at the end of a page
+		{maxItems: 5, items: 5, requests: 3, truncated: false}, // cut at the last item
+		{maxItems: 9, items: 5, requests: 3, truncated: false},
+	}
+	for _, c := range cases {
+		stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+		db := NewWithInternalClient(stub)
+		output, err := db.QueryAllWithLimits(context.Background(), &dynamodb.QueryInput{TableName: aws.String("tablename")}, AllLimits{MaxItems: c.maxItems})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if e, a := allTestItems(0, c.items), output.Items; !reflect.DeepEqual(e, a) {
+			t.Errorf("max %d: expect %v, got %v", c.maxItems, e, a)
+		}
+		if e, a := c.requests, len(stub.GetQueryRequests()); e != a {
+			t.Errorf("max %d: expect %v requests, got %v", c.maxItems, e, a)
+		}
+		if output.Truncated != c.truncated || output.Count != int64(c.items) {
+			t.Errorf("max %d: expect %d items, truncated %v, got %d, %v", c.maxItems, c.items, c.truncated, output.Count, output.Truncated)
+		}
+	}
+}
+
+func TestScanAll_MaxBytes(t *testing.T) {
+	resps := []*dynamodb.ScanOutput{
+		{Items: allTestItems(0, 2), LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key1")}}},
+		{Items: allTestItems(2, 4)},
+	}
+	stub := client.NewClientStub(nil, nil, resps)
+	db := NewWithInternalClient(stub)
+
+	// each item is 3 bytes of name and 4 bytes of value
+	output, err := db.ScanAllWithLimits(context.Background(), &dynamodb.ScanInput{TableName: aws.String("tablename")}, AllLimits{MaxBytes: 3 * 7})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := allTestItems(0, 3), output.Items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if !output.Truncated {
+		t.Errorf("expect truncated output")
+	}
+}
+
+func TestScanAll_Error(t *testing.T) {
+	failure := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	resps := []*dynamodb.ScanOutput{
+		{Items: allTestItems(0, 2), LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key1")}}},
+		{Items: allTestItems(2, 4)},
+	}
+	stub := client.NewClientStub(nil, nil, resps)
+	stub.SetScanErrors(nil, failure)
+	db := NewWithInternalClient(stub)
+	input := &dynamodb.ScanInput{TableName: aws.String("tablename")}
+
+	output, err := db.ScanAllWithLimits(context.Background(), input, AllLimits{})
+	if err != failure {
+		t.Fatalf("expect %v, got %v", failure, err)
+	}
+	if e, a := allTestItems(0, 2), output.Items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect the items of the first page, got %v", a)
+	}
+
+	stub = client.NewClientStub(nil, nil, resps)
+	stub.SetScanErrors(nil, failure)
+	db = NewWithInternalClient(stub)
+	items, err := db.ScanAll(context.Background(), input)
+	if err != failure || items != nil {
+		t.Errorf("expect %v and no items, got %v and %v", failure, err, items)
+	}
+}
+
+func TestQueryAll_Canceled(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := db.QueryAll(ctx, &dynamodb.QueryInput{TableName: aws.String("tablename")})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Errorf("expect canceled error, got %v", err)
+	}
+	if e, a := 1, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect no request after the cancellation, got %v requests", a)
+	}
+}
+
+func TestQueryAll_DeadlineExceeded(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(1, 0))
+	defer cancel()
+
+	_, err := db.QueryAll(ctx, &dynamodb.QueryInput{TableName: aws.String("tablename")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect an error wrapping %v, got %v", context.DeadlineExceeded, err)
+	}
+}
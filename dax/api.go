@@ -16,13 +16,17 @@
 package dax
 
 import (
-	"errors"
 	"io"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/client"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 func (d *Dax) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
@@ -30,7 +34,16 @@ func (d *Dax) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, er
 }
 
 func (d *Dax) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
-	o, cfn, err := d.config.requestOptions(false, ctx, opts...)
+	applied := applyOptions(input, opts)
+	if d.route(true, input, applied) == routeFallback {
+		var output *dynamodb.PutItemOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.PutItemWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	}
+	o, cfn, err := d.requestOptions(false, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +54,9 @@ func (d *Dax) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput,
 }
 
 func (d *Dax) PutItemRequest(input *dynamodb.PutItemInput) (*request.Request, *dynamodb.PutItemOutput) {
+	if d.route(true, input, appliedOptions{}) == routeFallback {
+		return d.config.Fallback.PutItemRequest(input)
+	}
 	op := &request.Operation{Name: client.OpPutItem}
 	if input == nil {
 		input = &dynamodb.PutItemInput{}
@@ -56,7 +72,16 @@ func (d *Dax) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemO
 }
 
 func (d *Dax) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
-	o, cfn, err := d.config.requestOptions(false, ctx, opts...)
+	applied := applyOptions(input, opts)
+	if d.route(true, input, applied) == routeFallback {
+		var output *dynamodb.DeleteItemOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.DeleteItemWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	}
+	o, cfn, err := d.requestOptions(false, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +92,9 @@ func (d *Dax) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemI
 }
 
 func (d *Dax) DeleteItemRequest(input *dynamodb.DeleteItemInput) (*request.Request, *dynamodb.DeleteItemOutput) {
+	if d.route(true, input, appliedOptions{}) == routeFallback {
+		return d.config.Fallback.DeleteItemRequest(input)
+	}
 	op := &request.Operation{Name: client.OpDeleteItem}
 	if input == nil {
 		input = &dynamodb.DeleteItemInput{}
@@ -82,7 +110,16 @@ func (d *Dax) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemO
 }
 
 func (d *Dax) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
-	o, cfn, err := d.config.requestOptions(false, ctx, opts...)
+	applied := applyOptions(input, opts)
+	if d.route(true, input, applied) == routeFallback {
+		var output *dynamodb.UpdateItemOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.UpdateItemWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	}
+	o, cfn, err := d.requestOptions(false, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +130,9 @@ func (d *Dax) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemI
 }
 
 func (d *Dax) UpdateItemRequest(input *dynamodb.UpdateItemInput) (*request.Request, *dynamodb.UpdateItemOutput) {
+	if d.route(true, input, appliedOptions{}) == routeFallback {
+		return d.config.Fallback.UpdateItemRequest(input)
+	}
 	op := &request.Operation{Name: client.OpUpdateItem}
 	if input == nil {
 		input = &dynamodb.UpdateItemInput{}
@@ -108,17 +148,30 @@ func (d *Dax) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, er
 }
 
 func (d *Dax) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
-	o, cfn, err := d.config.requestOptions(true, ctx, opts...)
+	applied := applyOptions(input, opts)
+	if d.route(false, input, applied) == routeFallback {
+		var output *dynamodb.GetItemOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.GetItemWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	}
+	o, cfn, err := d.requestOptions(true, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
 	if cfn != nil {
 		defer cfn()
 	}
+	input, _ = applied.input(input).(*dynamodb.GetItemInput)
 	return d.client.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, o)
 }
 
 func (d *Dax) GetItemRequest(input *dynamodb.GetItemInput) (*request.Request, *dynamodb.GetItemOutput) {
+	if d.route(false, input, appliedOptions{}) == routeFallback {
+		return d.config.Fallback.GetItemRequest(input)
+	}
 	op := &request.Operation{Name: client.OpGetItem}
 	if input == nil {
 		input = &dynamodb.GetItemInput{}
@@ -134,17 +187,30 @@ func (d *Dax) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
 }
 
 func (d *Dax) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
-	o, cfn, err := d.config.requestOptions(true, ctx, opts...)
+	applied := applyOptions(input, opts)
+	if d.route(false, input, applied) == routeFallback {
+		var output *dynamodb.ScanOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.ScanWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	}
+	o, cfn, err := d.requestOptions(true, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
 	if cfn != nil {
 		defer cfn()
 	}
+	input, _ = applied.input(input).(*dynamodb.ScanInput)
 	return d.client.ScanWithOptions(input, &dynamodb.ScanOutput{}, o)
 }
 
 func (d *Dax) ScanRequest(input *dynamodb.ScanInput) (*request.Request, *dynamodb.ScanOutput) {
+	if d.route(false, input, appliedOptions{}) == routeFallback {
+		return d.config.Fallback.ScanRequest(input)
+	}
 	op := &request.Operation{
 		Name: client.OpScan,
 		Paginator: &request.Paginator{
@@ -168,17 +234,30 @@ func (d *Dax) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
 }
 
 func (d *Dax) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
-	o, cfn, err := d.config.requestOptions(true, ctx, opts...)
+	applied := applyOptions(input, opts)
+	if d.route(false, input, applied) == routeFallback {
+		var output *dynamodb.QueryOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.QueryWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	}
+	o, cfn, err := d.requestOptions(true, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
 	if cfn != nil {
 		defer cfn()
 	}
+	input, _ = applied.input(input).(*dynamodb.QueryInput)
 	return d.client.QueryWithOptions(input, &dynamodb.QueryOutput{}, o)
 }
 
 func (d *Dax) QueryRequest(input *dynamodb.QueryInput) (*request.Request, *dynamodb.QueryOutput) {
+	if d.route(false, input, appliedOptions{}) == routeFallback {
+		return d.config.Fallback.QueryRequest(input)
+	}
 	op := &request.Operation{
 		Name: client.OpQuery,
 		Paginator: &request.Paginator{
@@ -202,7 +281,19 @@ func (d *Dax) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.Bat
 }
 
 func (d *Dax) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
-	o, cfn, err := d.config.requestOptions(false, ctx, opts...)
+	applied := applyOptions(input, opts)
+	switch d.route(true, input, applied) {
+	case routeFallback:
+		var output *dynamodb.BatchWriteItemOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.BatchWriteItemWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	case routeSplit:
+		return d.batchWriteItemSplit(ctx, input, opts)
+	}
+	o, cfn, err := d.requestOptions(false, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
@@ -213,6 +304,12 @@ func (d *Dax) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWr
 }
 
 func (d *Dax) BatchWriteItemRequest(input *dynamodb.BatchWriteItemInput) (*request.Request, *dynamodb.BatchWriteItemOutput) {
+	switch d.route(true, input, appliedOptions{}) {
+	case routeFallback:
+		return d.config.Fallback.BatchWriteItemRequest(input)
+	case routeSplit:
+		return newRequestWithError(errSplitBatchRequest), &dynamodb.BatchWriteItemOutput{}
+	}
 	op := &request.Operation{Name: client.OpBatchWriteItem}
 	if input == nil {
 		input = &dynamodb.BatchWriteItemInput{}
@@ -228,17 +325,36 @@ func (d *Dax) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGe
 }
 
 func (d *Dax) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
-	o, cfn, err := d.config.requestOptions(true, ctx, opts...)
+	applied := applyOptions(input, opts)
+	switch d.route(false, input, applied) {
+	case routeFallback:
+		var output *dynamodb.BatchGetItemOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.BatchGetItemWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	case routeSplit:
+		return d.batchGetItemSplit(ctx, input, opts)
+	}
+	o, cfn, err := d.requestOptions(true, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
 	if cfn != nil {
 		defer cfn()
 	}
+	input, _ = applied.input(input).(*dynamodb.BatchGetItemInput)
 	return d.client.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, o)
 }
 
 func (d *Dax) BatchGetItemRequest(input *dynamodb.BatchGetItemInput) (*request.Request, *dynamodb.BatchGetItemOutput) {
+	switch d.route(false, input, appliedOptions{}) {
+	case routeFallback:
+		return d.config.Fallback.BatchGetItemRequest(input)
+	case routeSplit:
+		return newRequestWithError(errSplitBatchRequest), &dynamodb.BatchGetItemOutput{}
+	}
 	op := &request.Operation{
 		Name: client.OpBatchGetItem,
 		Paginator: &request.Paginator{
@@ -262,7 +378,19 @@ func (d *Dax) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dyna
 }
 
 func (d *Dax) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
-	o, cfn, err := d.config.requestOptions(false, ctx, opts...)
+	applied := applyOptions(input, opts)
+	switch d.route(true, input, applied) {
+	case routeFallback:
+		var output *dynamodb.TransactWriteItemsOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.TransactWriteItemsWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	case routeSplit:
+		return nil, errSplitTransaction
+	}
+	o, cfn, err := d.requestOptions(false, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
@@ -273,6 +401,12 @@ func (d *Dax) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.Tra
 }
 
 func (d *Dax) TransactWriteItemsRequest(input *dynamodb.TransactWriteItemsInput) (*request.Request, *dynamodb.TransactWriteItemsOutput) {
+	switch d.route(true, input, appliedOptions{}) {
+	case routeFallback:
+		return d.config.Fallback.TransactWriteItemsRequest(input)
+	case routeSplit:
+		return newRequestWithError(errSplitTransaction), &dynamodb.TransactWriteItemsOutput{}
+	}
 	op := &request.Operation{Name: client.OpTransactWriteItems}
 	if input == nil {
 		input = &dynamodb.TransactWriteItemsInput{}
@@ -288,7 +422,19 @@ func (d *Dax) TransactGetItems(input *dynamodb.TransactGetItemsInput) (*dynamodb
 }
 
 func (d *Dax) TransactGetItemsWithContext(ctx aws.Context, input *dynamodb.TransactGetItemsInput, opts ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
-	o, cfn, err := d.config.requestOptions(true, ctx, opts...)
+	applied := applyOptions(input, opts)
+	switch d.route(false, input, applied) {
+	case routeFallback:
+		var output *dynamodb.TransactGetItemsOutput
+		err := d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			output, err = fallback.TransactGetItemsWithContext(ctx, input, opts...)
+			return err
+		})
+		return output, err
+	case routeSplit:
+		return nil, errSplitTransaction
+	}
+	o, cfn, err := d.requestOptions(true, ctx, applied)
 	if err != nil {
 		return nil, err
 	}
@@ -299,6 +445,12 @@ func (d *Dax) TransactGetItemsWithContext(ctx aws.Context, input *dynamodb.Trans
 }
 
 func (d *Dax) TransactGetItemsRequest(input *dynamodb.TransactGetItemsInput) (*request.Request, *dynamodb.TransactGetItemsOutput) {
+	switch d.route(false, input, appliedOptions{}) {
+	case routeFallback:
+		return d.config.Fallback.TransactGetItemsRequest(input)
+	case routeSplit:
+		return newRequestWithError(errSplitTransaction), &dynamodb.TransactGetItemsOutput{}
+	}
 	op := &request.Operation{Name: client.OpTransactGetItems}
 	if input == nil {
 		input = &dynamodb.TransactGetItemsInput{}
@@ -310,10 +462,18 @@ func (d *Dax) TransactGetItemsRequest(input *dynamodb.TransactGetItemsInput) (*r
 }
 
 func (d *Dax) BatchGetItemPages(input *dynamodb.BatchGetItemInput, fn func(*dynamodb.BatchGetItemOutput, bool) bool) error {
-	return d.BatchGetItemPagesWithContext(aws.BackgroundContext(), input, fn)
+	return d.BatchGetItemPagesWithContext(nil, input, fn)
 }
 
 func (d *Dax) BatchGetItemPagesWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, fn func(*dynamodb.BatchGetItemOutput, bool) bool, opts ...request.Option) error {
+	if d.isClosed() {
+		return ErrClientClosed
+	}
+	if applyOptions(input, opts).direct() {
+		return d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) error {
+			return fallback.BatchGetItemPagesWithContext(ctx, input, fn, opts...)
+		})
+	}
 	p := request.Pagination{
 		NewRequest: func() (*request.Request, error) {
 			var inCpy *dynamodb.BatchGetItemInput
@@ -322,7 +482,7 @@ func (d *Dax) BatchGetItemPagesWithContext(ctx aws.Context, input *dynamodb.Batc
 				inCpy = &tmp
 			}
 			req, _ := d.BatchGetItemRequest(inCpy)
-			req.SetContext(ctx)
+			d.setRequestContext(req, ctx)
 			req.ApplyOptions(opts...)
 			return req, nil
 		},
@@ -338,582 +498,686 @@ func (d *Dax) BatchGetItemPagesWithContext(ctx aws.Context, input *dynamodb.Batc
 }
 
 func (d *Dax) QueryPages(input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
-	return d.QueryPagesWithContext(aws.BackgroundContext(), input, fn)
+	return d.QueryPagesWithContext(nil, input, fn)
 }
 
 func (d *Dax) QueryPagesWithContext(ctx aws.Context, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
-	p := request.Pagination{
-		NewRequest: func() (*request.Request, error) {
-			var inCpy *dynamodb.QueryInput
-			if input != nil {
-				tmp := *input
-				inCpy = &tmp
-			}
-			req, _ := d.QueryRequest(inCpy)
-			req.SetContext(ctx)
-			req.ApplyOptions(opts...)
-			return req, nil
-		},
+	if d.isClosed() {
+		return ErrClientClosed
 	}
-	for p.Next() {
-		if !fn(p.Page().(*dynamodb.QueryOutput), !p.HasNextPage()) {
+	p := NewQueryPaginator(d, input, opts...)
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if !fn(page, !p.HasMorePages()) {
 			break
 		}
 	}
-	return p.Err()
+	return nil
 }
 
 func (d *Dax) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
-	return d.ScanPagesWithContext(aws.BackgroundContext(), input, fn)
+	return d.ScanPagesWithContext(nil, input, fn)
 }
 
 func (d *Dax) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
-	p := request.Pagination{
-		NewRequest: func() (*request.Request, error) {
-			var inCpy *dynamodb.ScanInput
-			if input != nil {
-				tmp := *input
-				inCpy = &tmp
-			}
-			req, _ := d.ScanRequest(inCpy)
-			req.SetContext(ctx)
-			req.ApplyOptions(opts...)
-			return req, nil
-		},
+	if d.isClosed() {
+		return ErrClientClosed
 	}
-	for p.Next() {
-		if !fn(p.Page().(*dynamodb.ScanOutput), !p.HasNextPage()) {
+	p := NewScanPaginator(d, input, opts...)
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if !fn(page, !p.HasMorePages()) {
 			break
 		}
 	}
-	return p.Err()
+	return nil
 }
 
 func (d *Dax) CreateBackup(*dynamodb.CreateBackupInput) (*dynamodb.CreateBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("CreateBackup")
 }
 
 func (d *Dax) CreateBackupWithContext(aws.Context, *dynamodb.CreateBackupInput, ...request.Option) (*dynamodb.CreateBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("CreateBackup")
 }
 
 func (d *Dax) CreateBackupRequest(*dynamodb.CreateBackupInput) (*request.Request, *dynamodb.CreateBackupOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.CreateBackupOutput{}
+	return newRequestForUnimplementedOperation("CreateBackup"), &dynamodb.CreateBackupOutput{}
 }
 
 func (d *Dax) CreateGlobalTable(*dynamodb.CreateGlobalTableInput) (*dynamodb.CreateGlobalTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("CreateGlobalTable")
 }
 
 func (d *Dax) CreateGlobalTableWithContext(aws.Context, *dynamodb.CreateGlobalTableInput, ...request.Option) (*dynamodb.CreateGlobalTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("CreateGlobalTable")
 }
 
 func (d *Dax) CreateGlobalTableRequest(*dynamodb.CreateGlobalTableInput) (*request.Request, *dynamodb.CreateGlobalTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.CreateGlobalTableOutput{}
+	return newRequestForUnimplementedOperation("CreateGlobalTable"), &dynamodb.CreateGlobalTableOutput{}
 }
 
 func (d *Dax) CreateTable(*dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("CreateTable")
 }
 
 func (d *Dax) CreateTableWithContext(aws.Context, *dynamodb.CreateTableInput, ...request.Option) (*dynamodb.CreateTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("CreateTable")
 }
 
 func (d *Dax) CreateTableRequest(*dynamodb.CreateTableInput) (*request.Request, *dynamodb.CreateTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.CreateTableOutput{}
+	return newRequestForUnimplementedOperation("CreateTable"), &dynamodb.CreateTableOutput{}
 }
 
 func (d *Dax) DeleteBackup(*dynamodb.DeleteBackupInput) (*dynamodb.DeleteBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DeleteBackup")
 }
 
 func (d *Dax) DeleteBackupWithContext(aws.Context, *dynamodb.DeleteBackupInput, ...request.Option) (*dynamodb.DeleteBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DeleteBackup")
 }
 
 func (d *Dax) DeleteBackupRequest(*dynamodb.DeleteBackupInput) (*request.Request, *dynamodb.DeleteBackupOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DeleteBackupOutput{}
+	return newRequestForUnimplementedOperation("DeleteBackup"), &dynamodb.DeleteBackupOutput{}
 }
 
 func (d *Dax) DeleteTable(*dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DeleteTable")
 }
 
 func (d *Dax) DeleteTableWithContext(aws.Context, *dynamodb.DeleteTableInput, ...request.Option) (*dynamodb.DeleteTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DeleteTable")
 }
 
 func (d *Dax) DeleteTableRequest(*dynamodb.DeleteTableInput) (*request.Request, *dynamodb.DeleteTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DeleteTableOutput{}
+	return newRequestForUnimplementedOperation("DeleteTable"), &dynamodb.DeleteTableOutput{}
 }
 
 func (d *Dax) DescribeBackup(*dynamodb.DescribeBackupInput) (*dynamodb.DescribeBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeBackup")
 }
 
 func (d *Dax) DescribeBackupWithContext(aws.Context, *dynamodb.DescribeBackupInput, ...request.Option) (*dynamodb.DescribeBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeBackup")
 }
 
 func (d *Dax) DescribeBackupRequest(*dynamodb.DescribeBackupInput) (*request.Request, *dynamodb.DescribeBackupOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeBackupOutput{}
+	return newRequestForUnimplementedOperation("DescribeBackup"), &dynamodb.DescribeBackupOutput{}
 }
 
 func (d *Dax) DescribeContinuousBackups(*dynamodb.DescribeContinuousBackupsInput) (*dynamodb.DescribeContinuousBackupsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeContinuousBackups")
 }
 
 func (d *Dax) DescribeContinuousBackupsWithContext(aws.Context, *dynamodb.DescribeContinuousBackupsInput, ...request.Option) (*dynamodb.DescribeContinuousBackupsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeContinuousBackups")
 }
 
 func (d *Dax) DescribeContinuousBackupsRequest(*dynamodb.DescribeContinuousBackupsInput) (*request.Request, *dynamodb.DescribeContinuousBackupsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeContinuousBackupsOutput{}
+	return newRequestForUnimplementedOperation("DescribeContinuousBackups"), &dynamodb.DescribeContinuousBackupsOutput{}
 }
 
 func (d *Dax) DescribeContributorInsights(*dynamodb.DescribeContributorInsightsInput) (*dynamodb.DescribeContributorInsightsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeContributorInsights")
 }
 
 func (d *Dax) DescribeContributorInsightsWithContext(aws.Context, *dynamodb.DescribeContributorInsightsInput, ...request.Option) (*dynamodb.DescribeContributorInsightsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeContributorInsights")
 }
 
 func (d *Dax) DescribeContributorInsightsRequest(*dynamodb.DescribeContributorInsightsInput) (*request.Request, *dynamodb.DescribeContributorInsightsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeContributorInsightsOutput{}
+	return newRequestForUnimplementedOperation("DescribeContributorInsights"), &dynamodb.DescribeContributorInsightsOutput{}
+}
+
+// DescribeEndpoints returns the "host:port" addresses of the nodes of the
+// cluster known to the client, as of its last refresh, without sending a
+// request. The CachePeriodInMinutes is the ClusterUpdateInterval, rounded up
+// to a whole minute. The input has no fields to honor; the context and the
+// options apply to the request as to any request, e.g. a canceled context
+// fails it.
+func (d *Dax) DescribeEndpoints(input *dynamodb.DescribeEndpointsInput) (*dynamodb.DescribeEndpointsOutput, error) {
+	req, out := d.DescribeEndpointsRequest(input)
+	return out, req.Send()
 }
 
-func (d *Dax) DescribeEndpoints(*dynamodb.DescribeEndpointsInput) (*dynamodb.DescribeEndpointsOutput, error) {
-	return nil, d.unImpl()
+func (d *Dax) DescribeEndpointsWithContext(ctx aws.Context, input *dynamodb.DescribeEndpointsInput, opts ...request.Option) (*dynamodb.DescribeEndpointsOutput, error) {
+	req, out := d.DescribeEndpointsRequest(input)
+	if ctx != nil {
+		req.SetContext(ctx)
+	}
+	req.ApplyOptions(opts...)
+	return out, req.Send()
 }
 
-func (d *Dax) DescribeEndpointsWithContext(aws.Context, *dynamodb.DescribeEndpointsInput, ...request.Option) (*dynamodb.DescribeEndpointsOutput, error) {
-	return nil, d.unImpl()
+func (d *Dax) DescribeEndpointsRequest(input *dynamodb.DescribeEndpointsInput) (*request.Request, *dynamodb.DescribeEndpointsOutput) {
+	if input == nil {
+		input = &dynamodb.DescribeEndpointsInput{}
+	}
+	output := &dynamodb.DescribeEndpointsOutput{}
+	h := request.Handlers{}
+	h.Send.PushBack(func(r *request.Request) {
+		if err := r.Context().Err(); err != nil {
+			r.Error = client.WrapError(request.CanceledErrorCode, "request context canceled", err)
+			return
+		}
+		out, err := d.describeEndpoints()
+		if err != nil {
+			r.Error = err
+			return
+		}
+		*output = *out
+	})
+	op := &request.Operation{Name: "DescribeEndpoints"}
+	clientInfo := metadata.ClientInfo{ServiceName: ServiceName}
+	return request.New(aws.Config{}, clientInfo, h, nil, op, input, output), output
 }
 
-func (d *Dax) DescribeEndpointsRequest(*dynamodb.DescribeEndpointsInput) (*request.Request, *dynamodb.DescribeEndpointsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeEndpointsOutput{}
+func (d *Dax) describeEndpoints() (*dynamodb.DescribeEndpointsOutput, error) {
+	if d.isClosed() {
+		return nil, ErrClientClosed
+	}
+	n, ok := d.client.(interface{ Nodes() []string })
+	if !ok {
+		return nil, d.unImpl("DescribeEndpoints")
+	}
+	period := int64((d.config.ClusterUpdateInterval + time.Minute - 1) / time.Minute)
+	if period < 1 {
+		period = 1
+	}
+	nodes := n.Nodes()
+	output := &dynamodb.DescribeEndpointsOutput{Endpoints: make([]*dynamodb.Endpoint, 0, len(nodes))}
+	for _, node := range nodes {
+		output.Endpoints = append(output.Endpoints, &dynamodb.Endpoint{
+			Address:              aws.String(node),
+			CachePeriodInMinutes: aws.Int64(period),
+		})
+	}
+	return output, nil
 }
 
 func (d *Dax) DescribeGlobalTable(*dynamodb.DescribeGlobalTableInput) (*dynamodb.DescribeGlobalTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeGlobalTable")
 }
 
 func (d *Dax) DescribeGlobalTableWithContext(aws.Context, *dynamodb.DescribeGlobalTableInput, ...request.Option) (*dynamodb.DescribeGlobalTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeGlobalTable")
 }
 
 func (d *Dax) DescribeGlobalTableRequest(*dynamodb.DescribeGlobalTableInput) (*request.Request, *dynamodb.DescribeGlobalTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeGlobalTableOutput{}
+	return newRequestForUnimplementedOperation("DescribeGlobalTable"), &dynamodb.DescribeGlobalTableOutput{}
 }
 
 func (d *Dax) DescribeGlobalTableSettings(*dynamodb.DescribeGlobalTableSettingsInput) (*dynamodb.DescribeGlobalTableSettingsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeGlobalTableSettings")
 }
 
 func (d *Dax) DescribeGlobalTableSettingsWithContext(aws.Context, *dynamodb.DescribeGlobalTableSettingsInput, ...request.Option) (*dynamodb.DescribeGlobalTableSettingsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeGlobalTableSettings")
 }
 
 func (d *Dax) DescribeGlobalTableSettingsRequest(*dynamodb.DescribeGlobalTableSettingsInput) (*request.Request, *dynamodb.DescribeGlobalTableSettingsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeGlobalTableSettingsOutput{}
+	return newRequestForUnimplementedOperation("DescribeGlobalTableSettings"), &dynamodb.DescribeGlobalTableSettingsOutput{}
 }
 
 func (d *Dax) DescribeLimits(*dynamodb.DescribeLimitsInput) (*dynamodb.DescribeLimitsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeLimits")
 }
 
 func (d *Dax) DescribeLimitsWithContext(aws.Context, *dynamodb.DescribeLimitsInput, ...request.Option) (*dynamodb.DescribeLimitsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeLimits")
 }
 
 func (d *Dax) DescribeLimitsRequest(*dynamodb.DescribeLimitsInput) (*request.Request, *dynamodb.DescribeLimitsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeLimitsOutput{}
+	return newRequestForUnimplementedOperation("DescribeLimits"), &dynamodb.DescribeLimitsOutput{}
 }
 
 func (d *Dax) DescribeTable(*dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeTable")
 }
 
 func (d *Dax) DescribeTableWithContext(aws.Context, *dynamodb.DescribeTableInput, ...request.Option) (*dynamodb.DescribeTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeTable")
 }
 
 func (d *Dax) DescribeTableRequest(*dynamodb.DescribeTableInput) (*request.Request, *dynamodb.DescribeTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeTableOutput{}
+	return newRequestForUnimplementedOperation("DescribeTable"), &dynamodb.DescribeTableOutput{}
 }
 
 func (d *Dax) DescribeTableReplicaAutoScaling(*dynamodb.DescribeTableReplicaAutoScalingInput) (*dynamodb.DescribeTableReplicaAutoScalingOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeTableReplicaAutoScaling")
 }
 
 func (d *Dax) DescribeTableReplicaAutoScalingWithContext(aws.Context, *dynamodb.DescribeTableReplicaAutoScalingInput, ...request.Option) (*dynamodb.DescribeTableReplicaAutoScalingOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeTableReplicaAutoScaling")
 }
 
 func (d *Dax) DescribeTableReplicaAutoScalingRequest(*dynamodb.DescribeTableReplicaAutoScalingInput) (*request.Request, *dynamodb.DescribeTableReplicaAutoScalingOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeTableReplicaAutoScalingOutput{}
+	return newRequestForUnimplementedOperation("DescribeTableReplicaAutoScaling"), &dynamodb.DescribeTableReplicaAutoScalingOutput{}
 }
 
 func (d *Dax) DescribeTimeToLive(*dynamodb.DescribeTimeToLiveInput) (*dynamodb.DescribeTimeToLiveOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeTimeToLive")
 }
 
 func (d *Dax) DescribeTimeToLiveWithContext(aws.Context, *dynamodb.DescribeTimeToLiveInput, ...request.Option) (*dynamodb.DescribeTimeToLiveOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeTimeToLive")
 }
 
 func (d *Dax) DescribeTimeToLiveRequest(*dynamodb.DescribeTimeToLiveInput) (*request.Request, *dynamodb.DescribeTimeToLiveOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeTimeToLiveOutput{}
-}
-
-func (d *Dax) BatchExecuteStatement(*dynamodb.BatchExecuteStatementInput) (*dynamodb.BatchExecuteStatementOutput, error) {
-	return nil, d.unImpl()
-}
-
-func (d *Dax) BatchExecuteStatementRequest(*dynamodb.BatchExecuteStatementInput) (*request.Request, *dynamodb.BatchExecuteStatementOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.BatchExecuteStatementOutput{}
-}
-
-func (d *Dax) BatchExecuteStatementWithContext(aws.Context, *dynamodb.BatchExecuteStatementInput, ...request.Option) (*dynamodb.BatchExecuteStatementOutput, error) {
-	return nil, d.unImpl()
+	return newRequestForUnimplementedOperation("DescribeTimeToLive"), &dynamodb.DescribeTimeToLiveOutput{}
 }
 
 func (d *Dax) DescribeExport(*dynamodb.DescribeExportInput) (*dynamodb.DescribeExportOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeExport")
 }
 
 func (d *Dax) DescribeExportWithContext(aws.Context, *dynamodb.DescribeExportInput, ...request.Option) (*dynamodb.DescribeExportOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeExport")
 }
 
 func (d *Dax) DescribeExportRequest(*dynamodb.DescribeExportInput) (*request.Request, *dynamodb.DescribeExportOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeExportOutput{}
+	return newRequestForUnimplementedOperation("DescribeExport"), &dynamodb.DescribeExportOutput{}
 }
 
 func (d *Dax) DescribeKinesisStreamingDestination(*dynamodb.DescribeKinesisStreamingDestinationInput) (*dynamodb.DescribeKinesisStreamingDestinationOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeKinesisStreamingDestination")
 }
 
 func (d *Dax) DescribeKinesisStreamingDestinationWithContext(aws.Context, *dynamodb.DescribeKinesisStreamingDestinationInput, ...request.Option) (*dynamodb.DescribeKinesisStreamingDestinationOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DescribeKinesisStreamingDestination")
 }
 
 func (d *Dax) DescribeKinesisStreamingDestinationRequest(*dynamodb.DescribeKinesisStreamingDestinationInput) (*request.Request, *dynamodb.DescribeKinesisStreamingDestinationOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DescribeKinesisStreamingDestinationOutput{}
+	return newRequestForUnimplementedOperation("DescribeKinesisStreamingDestination"), &dynamodb.DescribeKinesisStreamingDestinationOutput{}
 }
 
 func (d *Dax) DisableKinesisStreamingDestination(*dynamodb.DisableKinesisStreamingDestinationInput) (*dynamodb.DisableKinesisStreamingDestinationOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DisableKinesisStreamingDestination")
 }
 
 func (d *Dax) DisableKinesisStreamingDestinationWithContext(aws.Context, *dynamodb.DisableKinesisStreamingDestinationInput, ...request.Option) (*dynamodb.DisableKinesisStreamingDestinationOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("DisableKinesisStreamingDestination")
 }
 
 func (d *Dax) DisableKinesisStreamingDestinationRequest(*dynamodb.DisableKinesisStreamingDestinationInput) (*request.Request, *dynamodb.DisableKinesisStreamingDestinationOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.DisableKinesisStreamingDestinationOutput{}
+	return newRequestForUnimplementedOperation("DisableKinesisStreamingDestination"), &dynamodb.DisableKinesisStreamingDestinationOutput{}
 }
 
 func (d *Dax) EnableKinesisStreamingDestination(*dynamodb.EnableKinesisStreamingDestinationInput) (*dynamodb.EnableKinesisStreamingDestinationOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("EnableKinesisStreamingDestination")
 }
 
 func (d *Dax) EnableKinesisStreamingDestinationWithContext(aws.Context, *dynamodb.EnableKinesisStreamingDestinationInput, ...request.Option) (*dynamodb.EnableKinesisStreamingDestinationOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("EnableKinesisStreamingDestination")
 }
 
 func (d *Dax) EnableKinesisStreamingDestinationRequest(*dynamodb.EnableKinesisStreamingDestinationInput) (*request.Request, *dynamodb.EnableKinesisStreamingDestinationOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.EnableKinesisStreamingDestinationOutput{}
-}
-
-func (d *Dax) ExecuteStatement(*dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error) {
-	return nil, d.unImpl()
-}
-
-func (d *Dax) ExecuteStatementWithContext(aws.Context, *dynamodb.ExecuteStatementInput, ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
-	return nil, d.unImpl()
-}
-
-func (d *Dax) ExecuteStatementRequest(*dynamodb.ExecuteStatementInput) (*request.Request, *dynamodb.ExecuteStatementOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ExecuteStatementOutput{}
-}
-
-func (d *Dax) ExecuteTransaction(*dynamodb.ExecuteTransactionInput) (*dynamodb.ExecuteTransactionOutput, error) {
-	return nil, d.unImpl()
-}
-
-func (d *Dax) ExecuteTransactionWithContext(aws.Context, *dynamodb.ExecuteTransactionInput, ...request.Option) (*dynamodb.ExecuteTransactionOutput, error) {
-	return nil, d.unImpl()
-}
-
-func (d *Dax) ExecuteTransactionRequest(*dynamodb.ExecuteTransactionInput) (*request.Request, *dynamodb.ExecuteTransactionOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ExecuteTransactionOutput{}
+	return newRequestForUnimplementedOperation("EnableKinesisStreamingDestination"), &dynamodb.EnableKinesisStreamingDestinationOutput{}
 }
 
 func (d *Dax) ExportTableToPointInTime(*dynamodb.ExportTableToPointInTimeInput) (*dynamodb.ExportTableToPointInTimeOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ExportTableToPointInTime")
 }
 
 func (d *Dax) ExportTableToPointInTimeWithContext(aws.Context, *dynamodb.ExportTableToPointInTimeInput, ...request.Option) (*dynamodb.ExportTableToPointInTimeOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ExportTableToPointInTime")
 }
 
 func (d *Dax) ExportTableToPointInTimeRequest(*dynamodb.ExportTableToPointInTimeInput) (*request.Request, *dynamodb.ExportTableToPointInTimeOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ExportTableToPointInTimeOutput{}
+	return newRequestForUnimplementedOperation("ExportTableToPointInTime"), &dynamodb.ExportTableToPointInTimeOutput{}
 }
 
 func (d *Dax) ListBackups(*dynamodb.ListBackupsInput) (*dynamodb.ListBackupsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListBackups")
 }
 
 func (d *Dax) ListBackupsWithContext(aws.Context, *dynamodb.ListBackupsInput, ...request.Option) (*dynamodb.ListBackupsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListBackups")
 }
 
 func (d *Dax) ListBackupsRequest(*dynamodb.ListBackupsInput) (*request.Request, *dynamodb.ListBackupsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ListBackupsOutput{}
+	return newRequestForUnimplementedOperation("ListBackups"), &dynamodb.ListBackupsOutput{}
 }
 
 func (d *Dax) ListContributorInsights(*dynamodb.ListContributorInsightsInput) (*dynamodb.ListContributorInsightsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListContributorInsights")
 }
 
 func (d *Dax) ListContributorInsightsWithContext(aws.Context, *dynamodb.ListContributorInsightsInput, ...request.Option) (*dynamodb.ListContributorInsightsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListContributorInsights")
 }
 
 func (d *Dax) ListContributorInsightsRequest(*dynamodb.ListContributorInsightsInput) (*request.Request, *dynamodb.ListContributorInsightsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ListContributorInsightsOutput{}
+	return newRequestForUnimplementedOperation("ListContributorInsights"), &dynamodb.ListContributorInsightsOutput{}
 }
 
 func (d *Dax) ListContributorInsightsPages(*dynamodb.ListContributorInsightsInput, func(*dynamodb.ListContributorInsightsOutput, bool) bool) error {
-	return d.unImpl()
+	return d.unImpl("ListContributorInsights")
 }
 
 func (d *Dax) ListContributorInsightsPagesWithContext(aws.Context, *dynamodb.ListContributorInsightsInput, func(*dynamodb.ListContributorInsightsOutput, bool) bool, ...request.Option) error {
-	return d.unImpl()
+	return d.unImpl("ListContributorInsights")
 }
 
 func (d *Dax) ListExports(*dynamodb.ListExportsInput) (*dynamodb.ListExportsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListExports")
 }
 
 func (d *Dax) ListExportsWithContext(aws.Context, *dynamodb.ListExportsInput, ...request.Option) (*dynamodb.ListExportsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListExports")
 }
 
 func (d *Dax) ListExportsRequest(*dynamodb.ListExportsInput) (*request.Request, *dynamodb.ListExportsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ListExportsOutput{}
+	return newRequestForUnimplementedOperation("ListExports"), &dynamodb.ListExportsOutput{}
 }
 
 func (d *Dax) ListExportsPages(*dynamodb.ListExportsInput, func(*dynamodb.ListExportsOutput, bool) bool) error {
-	return d.unImpl()
+	return d.unImpl("ListExports")
 }
 
 func (d *Dax) ListExportsPagesWithContext(aws.Context, *dynamodb.ListExportsInput, func(*dynamodb.ListExportsOutput, bool) bool, ...request.Option) error {
-	return d.unImpl()
+	return d.unImpl("ListExports")
 }
 
 func (d *Dax) ListGlobalTables(*dynamodb.ListGlobalTablesInput) (*dynamodb.ListGlobalTablesOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListGlobalTables")
 }
 
 func (d *Dax) ListGlobalTablesWithContext(aws.Context, *dynamodb.ListGlobalTablesInput, ...request.Option) (*dynamodb.ListGlobalTablesOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListGlobalTables")
 }
 
 func (d *Dax) ListGlobalTablesRequest(*dynamodb.ListGlobalTablesInput) (*request.Request, *dynamodb.ListGlobalTablesOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ListGlobalTablesOutput{}
+	return newRequestForUnimplementedOperation("ListGlobalTables"), &dynamodb.ListGlobalTablesOutput{}
 }
 
 func (d *Dax) ListTables(*dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListTables")
 }
 
 func (d *Dax) ListTablesWithContext(aws.Context, *dynamodb.ListTablesInput, ...request.Option) (*dynamodb.ListTablesOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListTables")
 }
 
 func (d *Dax) ListTablesRequest(*dynamodb.ListTablesInput) (*request.Request, *dynamodb.ListTablesOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ListTablesOutput{}
+	return newRequestForUnimplementedOperation("ListTables"), &dynamodb.ListTablesOutput{}
 }
 
 func (d *Dax) ListTablesPages(*dynamodb.ListTablesInput, func(*dynamodb.ListTablesOutput, bool) bool) error {
-	return d.unImpl()
+	return d.unImpl("ListTables")
 }
 
 func (d *Dax) ListTablesPagesWithContext(aws.Context, *dynamodb.ListTablesInput, func(*dynamodb.ListTablesOutput, bool) bool, ...request.Option) error {
-	return d.unImpl()
+	return d.unImpl("ListTables")
 }
 
 func (d *Dax) ListTagsOfResource(*dynamodb.ListTagsOfResourceInput) (*dynamodb.ListTagsOfResourceOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListTagsOfResource")
 }
 
 func (d *Dax) ListTagsOfResourceWithContext(aws.Context, *dynamodb.ListTagsOfResourceInput, ...request.Option) (*dynamodb.ListTagsOfResourceOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("ListTagsOfResource")
 }
 
 func (d *Dax) ListTagsOfResourceRequest(*dynamodb.ListTagsOfResourceInput) (*request.Request, *dynamodb.ListTagsOfResourceOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.ListTagsOfResourceOutput{}
+	return newRequestForUnimplementedOperation("ListTagsOfResource"), &dynamodb.ListTagsOfResourceOutput{}
 }
 
 func (d *Dax) RestoreTableFromBackup(*dynamodb.RestoreTableFromBackupInput) (*dynamodb.RestoreTableFromBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("RestoreTableFromBackup")
 }
 
 func (d *Dax) RestoreTableFromBackupWithContext(aws.Context, *dynamodb.RestoreTableFromBackupInput, ...request.Option) (*dynamodb.RestoreTableFromBackupOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("RestoreTableFromBackup")
 }
 
 func (d *Dax) RestoreTableFromBackupRequest(*dynamodb.RestoreTableFromBackupInput) (*request.Request, *dynamodb.RestoreTableFromBackupOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.RestoreTableFromBackupOutput{}
+	return newRequestForUnimplementedOperation("RestoreTableFromBackup"), &dynamodb.RestoreTableFromBackupOutput{}
 }
 
 func (d *Dax) RestoreTableToPointInTime(*dynamodb.RestoreTableToPointInTimeInput) (*dynamodb.RestoreTableToPointInTimeOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("RestoreTableToPointInTime")
 }
 
 func (d *Dax) RestoreTableToPointInTimeWithContext(aws.Context, *dynamodb.RestoreTableToPointInTimeInput, ...request.Option) (*dynamodb.RestoreTableToPointInTimeOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("RestoreTableToPointInTime")
 }
 
 func (d *Dax) RestoreTableToPointInTimeRequest(*dynamodb.RestoreTableToPointInTimeInput) (*request.Request, *dynamodb.RestoreTableToPointInTimeOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.RestoreTableToPointInTimeOutput{}
+	return newRequestForUnimplementedOperation("RestoreTableToPointInTime"), &dynamodb.RestoreTableToPointInTimeOutput{}
 }
 
 func (d *Dax) TagResource(*dynamodb.TagResourceInput) (*dynamodb.TagResourceOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("TagResource")
 }
 
 func (d *Dax) TagResourceWithContext(aws.Context, *dynamodb.TagResourceInput, ...request.Option) (*dynamodb.TagResourceOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("TagResource")
 }
 
 func (d *Dax) TagResourceRequest(*dynamodb.TagResourceInput) (*request.Request, *dynamodb.TagResourceOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.TagResourceOutput{}
+	return newRequestForUnimplementedOperation("TagResource"), &dynamodb.TagResourceOutput{}
 }
 
 func (d *Dax) UntagResource(*dynamodb.UntagResourceInput) (*dynamodb.UntagResourceOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UntagResource")
 }
 
 func (d *Dax) UntagResourceWithContext(aws.Context, *dynamodb.UntagResourceInput, ...request.Option) (*dynamodb.UntagResourceOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UntagResource")
 }
 
 func (d *Dax) UntagResourceRequest(*dynamodb.UntagResourceInput) (*request.Request, *dynamodb.UntagResourceOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UntagResourceOutput{}
+	return newRequestForUnimplementedOperation("UntagResource"), &dynamodb.UntagResourceOutput{}
 }
 
 func (d *Dax) UpdateContinuousBackups(*dynamodb.UpdateContinuousBackupsInput) (*dynamodb.UpdateContinuousBackupsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateContinuousBackups")
 }
 
 func (d *Dax) UpdateContinuousBackupsWithContext(aws.Context, *dynamodb.UpdateContinuousBackupsInput, ...request.Option) (*dynamodb.UpdateContinuousBackupsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateContinuousBackups")
 }
 
 func (d *Dax) UpdateContinuousBackupsRequest(*dynamodb.UpdateContinuousBackupsInput) (*request.Request, *dynamodb.UpdateContinuousBackupsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateContinuousBackupsOutput{}
+	return newRequestForUnimplementedOperation("UpdateContinuousBackups"), &dynamodb.UpdateContinuousBackupsOutput{}
 }
 
 func (d *Dax) UpdateContributorInsights(*dynamodb.UpdateContributorInsightsInput) (*dynamodb.UpdateContributorInsightsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateContributorInsights")
 }
 
 func (d *Dax) UpdateContributorInsightsWithContext(aws.Context, *dynamodb.UpdateContributorInsightsInput, ...request.Option) (*dynamodb.UpdateContributorInsightsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateContributorInsights")
 }
 
 func (d *Dax) UpdateContributorInsightsRequest(*dynamodb.UpdateContributorInsightsInput) (*request.Request, *dynamodb.UpdateContributorInsightsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateContributorInsightsOutput{}
+	return newRequestForUnimplementedOperation("UpdateContributorInsights"), &dynamodb.UpdateContributorInsightsOutput{}
 }
 
 func (d *Dax) UpdateGlobalTable(*dynamodb.UpdateGlobalTableInput) (*dynamodb.UpdateGlobalTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateGlobalTable")
 }
 
 func (d *Dax) UpdateGlobalTableWithContext(aws.Context, *dynamodb.UpdateGlobalTableInput, ...request.Option) (*dynamodb.UpdateGlobalTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateGlobalTable")
 }
 
 func (d *Dax) UpdateGlobalTableRequest(*dynamodb.UpdateGlobalTableInput) (*request.Request, *dynamodb.UpdateGlobalTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateGlobalTableOutput{}
+	return newRequestForUnimplementedOperation("UpdateGlobalTable"), &dynamodb.UpdateGlobalTableOutput{}
 }
 
 func (d *Dax) UpdateGlobalTableSettings(*dynamodb.UpdateGlobalTableSettingsInput) (*dynamodb.UpdateGlobalTableSettingsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateGlobalTableSettings")
 }
 
 func (d *Dax) UpdateGlobalTableSettingsWithContext(aws.Context, *dynamodb.UpdateGlobalTableSettingsInput, ...request.Option) (*dynamodb.UpdateGlobalTableSettingsOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateGlobalTableSettings")
 }
 
 func (d *Dax) UpdateGlobalTableSettingsRequest(*dynamodb.UpdateGlobalTableSettingsInput) (*request.Request, *dynamodb.UpdateGlobalTableSettingsOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateGlobalTableSettingsOutput{}
+	return newRequestForUnimplementedOperation("UpdateGlobalTableSettings"), &dynamodb.UpdateGlobalTableSettingsOutput{}
 }
 
 func (d *Dax) UpdateTable(*dynamodb.UpdateTableInput) (*dynamodb.UpdateTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateTable")
 }
 
 func (d *Dax) UpdateTableWithContext(aws.Context, *dynamodb.UpdateTableInput, ...request.Option) (*dynamodb.UpdateTableOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateTable")
 }
 
 func (d *Dax) UpdateTableRequest(*dynamodb.UpdateTableInput) (*request.Request, *dynamodb.UpdateTableOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateTableOutput{}
+	return newRequestForUnimplementedOperation("UpdateTable"), &dynamodb.UpdateTableOutput{}
 }
 
 func (d *Dax) UpdateTableReplicaAutoScaling(*dynamodb.UpdateTableReplicaAutoScalingInput) (*dynamodb.UpdateTableReplicaAutoScalingOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateTableReplicaAutoScaling")
 }
 
 func (d *Dax) UpdateTableReplicaAutoScalingWithContext(aws.Context, *dynamodb.UpdateTableReplicaAutoScalingInput, ...request.Option) (*dynamodb.UpdateTableReplicaAutoScalingOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateTableReplicaAutoScaling")
 }
 
 func (d *Dax) UpdateTableReplicaAutoScalingRequest(*dynamodb.UpdateTableReplicaAutoScalingInput) (*request.Request, *dynamodb.UpdateTableReplicaAutoScalingOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateTableReplicaAutoScalingOutput{}
+	return newRequestForUnimplementedOperation("UpdateTableReplicaAutoScaling"), &dynamodb.UpdateTableReplicaAutoScalingOutput{}
 }
 
 func (d *Dax) UpdateTimeToLive(*dynamodb.UpdateTimeToLiveInput) (*dynamodb.UpdateTimeToLiveOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateTimeToLive")
 }
 
 func (d *Dax) UpdateTimeToLiveWithContext(aws.Context, *dynamodb.UpdateTimeToLiveInput, ...request.Option) (*dynamodb.UpdateTimeToLiveOutput, error) {
-	return nil, d.unImpl()
+	return nil, d.unImpl("UpdateTimeToLive")
 }
 
 func (d *Dax) UpdateTimeToLiveRequest(*dynamodb.UpdateTimeToLiveInput) (*request.Request, *dynamodb.UpdateTimeToLiveOutput) {
-	return newRequestForUnimplementedOperation(), &dynamodb.UpdateTimeToLiveOutput{}
+	return newRequestForUnimplementedOperation("UpdateTimeToLive"), &dynamodb.UpdateTimeToLiveOutput{}
 }
 
+// The waiters poll DescribeTable, which DAX does not implement.
 func (d *Dax) WaitUntilTableExists(*dynamodb.DescribeTableInput) error {
-	return d.unImpl()
+	return d.unImpl("DescribeTable")
 }
 
 func (d *Dax) WaitUntilTableExistsWithContext(aws.Context, *dynamodb.DescribeTableInput, ...request.WaiterOption) error {
-	return d.unImpl()
+	return d.unImpl("DescribeTable")
 }
 
 func (d *Dax) WaitUntilTableNotExists(*dynamodb.DescribeTableInput) error {
-	return d.unImpl()
+	return d.unImpl("DescribeTable")
 }
 
 func (d *Dax) WaitUntilTableNotExistsWithContext(aws.Context, *dynamodb.DescribeTableInput, ...request.WaiterOption) error {
-	return d.unImpl()
+	return d.unImpl("DescribeTable")
 }
 
-func (d *Dax) unImpl() error {
-	return errors.New(client.ErrCodeNotImplemented)
+func (d *Dax) unImpl(op string) error {
+	return &NotImplementedError{Operation: op}
+}
+
+// InvalidateTableCache evicts the cached key schema of the table, e.g. after
+// the table was recreated with a different key schema. The next request for
+// the table fetches the key schema again.
+func (d *Dax) InvalidateTableCache(table string) {
+	if i, ok := d.client.(interface{ InvalidateTableCache(string) }); ok {
+		i.InvalidateTableCache(table)
+	}
 }
 
+// RefreshEndpoints discovers the nodes of the cluster now, e.g. after nodes
+// were replaced, instead of at the next ClusterUpdateInterval. If discovery
+// fails, its error is returned and the known nodes are kept. Concurrent calls
+// share a single discovery.
+func (d *Dax) RefreshEndpoints(ctx aws.Context) error {
+	if d.isClosed() {
+		return ErrClientClosed
+	}
+	if r, ok := d.client.(interface{ RefreshEndpoints(aws.Context) error }); ok {
+		return r.RefreshEndpoints(ctx)
+	}
+	return nil
+}
+
+// Stats returns the connection and request counters of the client.
+func (d *Dax) Stats() Stats {
+	var s Stats
+	if p, ok := d.client.(interface{ Stats() client.Stats }); ok {
+		s = p.Stats()
+	}
+	s.DegradedRequests = atomic.LoadInt64(&d.degradedRequests)
+	return s
+}
+
+// ActiveCluster returns the name of the cluster requests are sent to:
+// SecondaryCluster after a failover to Config.Secondary, PrimaryCluster
+// otherwise.
+func (d *Dax) ActiveCluster() string {
+	if f, ok := d.client.(interface{ ActiveCluster() string }); ok {
+		return f.ActiveCluster()
+	}
+	return PrimaryCluster
+}
+
+// DiscoveryStatus returns the time of the last successful discovery of the
+// nodes of the cluster requests are sent to, and the error and number of the
+// discoveries failed since, see Config.OnDiscoveryFailure.
+func (d *Dax) DiscoveryStatus() DiscoveryStatus {
+	if p, ok := d.client.(interface{ DiscoveryStatus() DiscoveryStatus }); ok {
+		return p.DiscoveryStatus()
+	}
+	return DiscoveryStatus{}
+}
+
+// Failback sends requests to the primary cluster again after a failover to
+// Config.Secondary. It fails if the primary is still unreachable, or if no
+// secondary cluster is configured.
+func (d *Dax) Failback() error {
+	if d.isClosed() {
+		return ErrClientClosed
+	}
+	if f, ok := d.client.(interface{ Failback() error }); ok {
+		return f.Failback()
+	}
+	return awserr.New(request.InvalidParameterErrCode, "no Secondary cluster is configured", nil)
+}
+
+// NodeStats returns the counters of each node of the cluster by "host:port"
+// address, e.g. the Requests sent to each node with Config.KeyAffinityRouting.
+func (d *Dax) NodeStats() map[string]Stats {
+	if p, ok := d.client.(interface{ NodeStats() map[string]Stats }); ok {
+		return p.NodeStats()
+	}
+	return map[string]Stats{}
+}
+
+// ClusterStats returns the counters of each cluster by name, PrimaryCluster
+// and, if configured, SecondaryCluster. Unlike Stats, they do not count the
+// requests sent to Config.Fallback.
+func (d *Dax) ClusterStats() map[string]Stats {
+	if f, ok := d.client.(interface{ ClusterStats() map[string]Stats }); ok {
+		return f.ClusterStats()
+	}
+	var s Stats
+	if p, ok := d.client.(interface{ Stats() client.Stats }); ok {
+		s = p.Stats()
+	}
+	return map[string]Stats{PrimaryCluster: s}
+}
+
+// Close releases all resources held by the client. Once closed, every
+// operation fails with ErrClientClosed. Close blocks until all background
+// goroutines started by the client have exited. Calling Close more than once is safe.
 func (d *Dax) Close() error {
+	if !atomic.CompareAndSwapInt32(&d.closed, 0, 1) {
+		return nil
+	}
 	if c, ok := d.client.(io.Closer); ok {
 		return c.Close()
 	}
@@ -1,10 +1,20 @@
 package dax
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 // https://github.com/aws/aws-dax-go/issues/27
@@ -17,9 +27,7 @@ func TestUnimplementedBehavior(t *testing.T) {
 	if o != nil {
 		t.Errorf("expect nil from unimplemented method, got %v", o)
 	}
-	if err == nil || err.Error() != client.ErrCodeNotImplemented {
-		t.Errorf("expect not implemented error, got %v", err)
-	}
+	expectNotImplemented(t, err, "CreateBackup")
 }
 
 func TestUnimplementedRequestBehavior(t *testing.T) {
@@ -34,23 +42,112 @@ func TestUnimplementedRequestBehavior(t *testing.T) {
 
 	// Build() should return an error
 	err := req.Build()
-	if err == nil || err.Error() != client.ErrCodeNotImplemented {
-		t.Errorf("expect not implemented error, got %v", err)
-	}
+	expectNotImplemented(t, err, "CreateGlobalTable")
 	if o.GlobalTableDescription != nil {
 		t.Errorf("expect unfilled response from unimplemented method, got %v", o)
 	}
 
 	// Send() should return an error
 	err = req.Send()
-	if err == nil || err.Error() != client.ErrCodeNotImplemented {
-		t.Errorf("expect not implemented error, got %v", err)
-	}
+	expectNotImplemented(t, err, "CreateGlobalTable")
 	if o.GlobalTableDescription != nil {
 		t.Errorf("expect unfilled response from unimplemented method, got %v", o)
 	}
 }
 
+// Every operation DAX does not implement reports the name of the API operation,
+// whichever of its methods is called.
+func TestUnimplementedOperations(t *testing.T) {
+	implemented := map[string]bool{
+		client.OpGetItem:            true,
+		client.OpPutItem:            true,
+		client.OpUpdateItem:         true,
+		client.OpDeleteItem:         true,
+		client.OpQuery:              true,
+		client.OpScan:               true,
+		client.OpBatchGetItem:       true,
+		client.OpBatchWriteItem:     true,
+		client.OpTransactGetItems:   true,
+		client.OpTransactWriteItems: true,
+		"DescribeEndpoints":         true,
+	}
+	db := NewWithInternalClient(client.NewClientStub(nil, nil, nil))
+	api := reflect.TypeOf((*dynamodbiface.DynamoDBAPI)(nil)).Elem()
+	for i := 0; i < api.NumMethod(); i++ {
+		name := api.Method(i).Name
+		op := strings.TrimSuffix(name, "WithContext")
+		op = strings.TrimSuffix(op, "Request")
+		op = strings.TrimSuffix(op, "Pages")
+		if strings.HasPrefix(op, "WaitUntilTable") {
+			op = "DescribeTable"
+		}
+		if implemented[op] {
+			continue
+		}
+
+		m := reflect.ValueOf(db).MethodByName(name)
+		n := m.Type().NumIn()
+		if m.Type().IsVariadic() {
+			n--
+		}
+		args := make([]reflect.Value, n)
+		for j := range args {
+			args[j] = reflect.Zero(m.Type().In(j))
+		}
+		out := m.Call(args)
+		var err error
+		if req, ok := out[0].Interface().(*request.Request); ok {
+			err = req.Send()
+		} else if e := out[len(out)-1].Interface(); e != nil {
+			err = e.(error)
+		}
+		t.Run(name, func(t *testing.T) {
+			expectNotImplemented(t, err, op)
+		})
+	}
+}
+
+func TestIsNotImplemented(t *testing.T) {
+	cases := []struct {
+		err    error
+		expect bool
+	}{
+		{nil, false},
+		{errors.New(client.ErrCodeNotImplemented), false},
+		{&NotImplementedError{Operation: "CreateTable"}, true},
+		{awserr.New(client.ErrCodeNotImplemented, "", nil), true},
+		{awserr.New(ErrCodeNotImplementedException, "", nil), true},
+		{awserr.New(request.ErrCodeSerialization, "", &NotImplementedError{Operation: "CreateTable"}), true},
+		{awserr.New(client.ErrCodeValidationException, "", nil), false},
+		{ErrClientClosed, false},
+	}
+	for _, c := range cases {
+		if actual := IsNotImplemented(c.err); actual != c.expect {
+			t.Errorf("expect IsNotImplemented(%v) %v, got %v", c.err, c.expect, actual)
+		}
+	}
+}
+
+func expectNotImplemented(t *testing.T, err error, op string) {
+	t.Helper()
+	var nerr *NotImplementedError
+	if !errors.As(err, &nerr) {
+		t.Fatalf("expect NotImplementedError, got %v", err)
+	}
+	if nerr.Operation != op {
+		t.Errorf("expect operation %s, got %s", op, nerr.Operation)
+	}
+	if nerr.Code() != ErrCodeNotImplementedException {
+		t.Errorf("expect code %s, got %s", ErrCodeNotImplementedException, nerr.Code())
+	}
+	if !strings.HasPrefix(err.Error(), client.ErrCodeNotImplemented+": ") || !strings.Contains(err.Error(), op) {
+		t.Errorf("expect error naming %s, got %s", op, err.Error())
+	}
+	if !IsNotImplemented(err) {
+		t.Errorf("expect IsNotImplemented(%v)", err)
+	}
+}
+
 func createClient(t *testing.T) *Dax {
 	cfg := DefaultConfig()
 	cfg.HostPorts = []string{"127.0.0.1:8111"}
@@ -61,3 +158,176 @@ func createClient(t *testing.T) *Dax {
 	}
 	return dax
 }
+
+func TestClosedClientBehavior(t *testing.T) {
+	dax := createClient(t)
+	if err := dax.Close(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// Close is idempotent
+	if err := dax.Close(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("table"),
+		Key:       map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("key")}},
+	}
+	o, err := dax.GetItem(input)
+	if o != nil {
+		t.Errorf("expect nil output from closed client, got %v", o)
+	}
+	if err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeClientClosed {
+		t.Errorf("expect awserr.Error with code %s, got %v", ErrCodeClientClosed, err)
+	}
+
+	err = dax.QueryPages(&dynamodb.QueryInput{TableName: aws.String("table")}, func(*dynamodb.QueryOutput, bool) bool { return true })
+	if err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+
+	req, _ := dax.PutItemRequest(&dynamodb.PutItemInput{TableName: aws.String("table")})
+	if err := req.Send(); err == nil || err.(awserr.Error).Code() != ErrCodeClientClosed {
+		t.Errorf("expect %s, got %v", ErrCodeClientClosed, err)
+	}
+
+	if err := dax.RefreshEndpoints(context.Background()); err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestDescribeEndpoints(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.SetNodes("10.0.0.1:8111", "10.0.0.2:8111")
+	dax := NewWithInternalClient(stub)
+	dax.config.ClusterUpdateInterval = 90 * time.Second
+
+	expect := func(addrs ...string) *dynamodb.DescribeEndpointsOutput {
+		o := &dynamodb.DescribeEndpointsOutput{Endpoints: []*dynamodb.Endpoint{}}
+		for _, a := range addrs {
+			o.Endpoints = append(o.Endpoints, &dynamodb.Endpoint{Address: aws.String(a), CachePeriodInMinutes: aws.Int64(2)})
+		}
+		return o
+	}
+
+	o, err := dax.DescribeEndpoints(&dynamodb.DescribeEndpointsInput{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e := expect("10.0.0.1:8111", "10.0.0.2:8111"); !reflect.DeepEqual(e, o) {
+		t.Errorf("expect %v, got %v", e, o)
+	}
+
+	// a refresh replaced a node
+	stub.SetNodes("10.0.0.2:8111", "10.0.0.3:8111")
+	req, o := dax.DescribeEndpointsRequest(&dynamodb.DescribeEndpointsInput{})
+	if err := req.Send(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e := expect("10.0.0.2:8111", "10.0.0.3:8111"); !reflect.DeepEqual(e, o) {
+		t.Errorf("expect %v, got %v", e, o)
+	}
+
+	// the context and the options apply
+	var applied bool
+	o, err = dax.DescribeEndpointsWithContext(context.Background(), &dynamodb.DescribeEndpointsInput{}, func(r *request.Request) { applied = true })
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !applied {
+		t.Errorf("expect the option applied")
+	}
+	if e := expect("10.0.0.2:8111", "10.0.0.3:8111"); !reflect.DeepEqual(e, o) {
+		t.Errorf("expect %v, got %v", e, o)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dax.DescribeEndpointsWithContext(ctx, &dynamodb.DescribeEndpointsInput{})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode || !errors.Is(err, context.Canceled) {
+		t.Errorf("expect %s wrapping %v, got %v", request.CanceledErrorCode, context.Canceled, err)
+	}
+	input := &dynamodb.DescribeEndpointsInput{}
+	if req, _ := dax.DescribeEndpointsRequest(input); req.Params != input {
+		t.Errorf("expect the input of the request kept, got %v", req.Params)
+	}
+
+	dax.Close()
+	if _, err := dax.DescribeEndpoints(nil); err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestCloseWithConcurrentRequests(t *testing.T) {
+	dax := createClient(t)
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("table"),
+		Key:       map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("key")}},
+	}
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for j := 0; j < 50; j++ {
+				ctx, cfn := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				dax.GetItemWithContext(ctx, input)
+				cfn()
+			}
+		}()
+	}
+	close(start)
+	time.Sleep(5 * time.Millisecond)
+	if err := dax.Close(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	wg.Wait()
+
+	if _, err := dax.GetItemWithContext(context.Background(), input); err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestSecondaryCluster(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	secondary := cfg.Config
+	secondary.HostPorts = []string{"127.0.0.1:8112"}
+	cfg.Secondary = &secondary
+	if _, err := New(cfg); err == nil {
+		t.Errorf("expect an error without health checks of the primary cluster")
+	}
+
+	cfg.HealthCheckInterval = time.Hour
+	db, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer db.Close()
+	if e, a := PrimaryCluster, db.ActiveCluster(); e != a {
+		t.Errorf("expect active cluster %s, got %s", e, a)
+	}
+	if stats := db.ClusterStats(); len(stats) != 2 {
+		t.Errorf("expect the stats of 2 clusters, got %v", stats)
+	}
+	if err := db.Failback(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	db, _ = newFallbackClient(nil, false)
+	if e, a := PrimaryCluster, db.ActiveCluster(); e != a {
+		t.Errorf("expect active cluster %s, got %s", e, a)
+	}
+	if _, ok := db.ClusterStats()[PrimaryCluster]; !ok {
+		t.Errorf("expect the stats of the primary cluster")
+	}
+	if err := db.Failback(); err == nil {
+		t.Errorf("expect an error without a secondary cluster")
+	}
+}
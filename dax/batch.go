@@ -0,0 +1,213 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returned by backoff when the next attempt would start after the context deadline.
+var errBackoffPastDeadline = errors.New("backoff past context deadline")
+
+// BatchGetItemAll is like BatchGetItemWithContext, but sends the UnprocessedKeys
+// of each response again until every key is processed, with an exponential
+// backoff with jitter between attempts.
+//
+// It gives up once UnprocessedRetries attempts were made, or once the next
+// attempt would start after the deadline of the context, and returns the keys
+// still unprocessed in the UnprocessedKeys of the output. Responses and
+// ConsumedCapacity are merged across attempts. When an attempt fails, the
+// output holds what the previous attempts returned and the keys of the failed
+// attempt as UnprocessedKeys.
+//
+// If ctx is nil, RequestTimeout bounds all the attempts together.
+func (d *Dax) BatchGetItemAll(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	if d.isClosed() {
+		return nil, ErrClientClosed
+	}
+	ctx, cfn := d.config.requestContext(ctx)
+	if cfn != nil {
+		defer cfn()
+	}
+
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       make(map[string][]map[string]*dynamodb.AttributeValue),
+		UnprocessedKeys: make(map[string]*dynamodb.KeysAndAttributes),
+	}
+	in := input
+	for attempt := 0; ; attempt++ {
+		out, err := d.BatchGetItemWithContext(ctx, in, opts...)
+		if out != nil {
+			for table, items := range out.Responses {
+				output.Responses[table] = append(output.Responses[table], items...)
+			}
+			output.ConsumedCapacity = client.MergeConsumedCapacity(output.ConsumedCapacity, out.ConsumedCapacity)
+		}
+		if err != nil {
+			if out != nil {
+				// a request split between DAX and Config.Fallback failed on one side only
+				output.UnprocessedKeys = out.UnprocessedKeys
+			} else if in != nil {
+				output.UnprocessedKeys = in.RequestItems
+			}
+			return output, err
+		}
+
+		output.UnprocessedKeys = make(map[string]*dynamodb.KeysAndAttributes)
+		for table, ka := range out.UnprocessedKeys {
+			if ka != nil && len(ka.Keys) > 0 {
+				output.UnprocessedKeys[table] = ka
+			}
+		}
+		if len(output.UnprocessedKeys) == 0 || attempt >= d.config.UnprocessedRetries {
+			return output, nil
+		}
+		if err := d.backoff(ctx, attempt); err != nil {
+			if err == errBackoffPastDeadline {
+				return output, nil
+			}
+			return output, err
+		}
+		var next dynamodb.BatchGetItemInput
+		if input != nil {
+			next = *input
+		}
+		next.RequestItems = output.UnprocessedKeys
+		in = &next
+	}
+}
+
+// BatchWriteItemAll is like BatchWriteItemWithContext, but sends the
+// UnprocessedItems of each response again until every item is processed, with
+// an exponential backoff with jitter between attempts. Only the items returned
+// as unprocessed are sent again.
+//
+// It gives up once UnprocessedRetries attempts were made, or once the next
+// attempt would start after the deadline of the context, and returns the items
+// still unprocessed in the UnprocessedItems of the output. ConsumedCapacity and
+// ItemCollectionMetrics are merged across attempts. When an attempt fails, the
+// UnprocessedItems of the output are the items of the failed attempt not known
+// to be written, see also BatchWriteError.
+//
+// If ctx is nil, RequestTimeout bounds all the attempts together.
+func (d *Dax) BatchWriteItemAll(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	if d.isClosed() {
+		return nil, ErrClientClosed
+	}
+	ctx, cfn := d.config.requestContext(ctx)
+	if cfn != nil {
+		defer cfn()
+	}
+
+	output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: make(map[string][]*dynamodb.WriteRequest)}
+	in := input
+	for attempt := 0; ; attempt++ {
+		out, err := d.BatchWriteItemWithContext(ctx, in, opts...)
+		if out != nil {
+			output.ConsumedCapacity = client.MergeConsumedCapacity(output.ConsumedCapacity, out.ConsumedCapacity)
+			for table, metrics := range out.ItemCollectionMetrics {
+				if output.ItemCollectionMetrics == nil {
+					output.ItemCollectionMetrics = make(map[string][]*dynamodb.ItemCollectionMetrics)
+				}
+				output.ItemCollectionMetrics[table] = append(output.ItemCollectionMetrics[table], metrics...)
+			}
+		}
+		if err != nil {
+			if berr, ok := err.(*BatchWriteError); ok {
+				// only part of the items were sent in a failed request
+				output.UnprocessedItems = make(map[string][]*dynamodb.WriteRequest)
+				var unprocessed map[string][]*dynamodb.WriteRequest
+				if out != nil {
+					unprocessed = out.UnprocessedItems
+				}
+				for _, items := range []map[string][]*dynamodb.WriteRequest{unprocessed, berr.Failed, berr.NotAttempted} {
+					for table, writes := range items {
+						output.UnprocessedItems[table] = append(output.UnprocessedItems[table], writes...)
+					}
+				}
+			} else if out != nil {
+				// a request split between DAX and Config.Fallback failed on one side only
+				output.UnprocessedItems = out.UnprocessedItems
+			} else if in != nil {
+				output.UnprocessedItems = in.RequestItems
+			}
+			return output, err
+		}
+
+		output.UnprocessedItems = make(map[string][]*dynamodb.WriteRequest)
+		for table, writes := range out.UnprocessedItems {
+			if len(writes) > 0 {
+				output.UnprocessedItems[table] = writes
+			}
+		}
+		if len(output.UnprocessedItems) == 0 || attempt >= d.config.UnprocessedRetries {
+			return output, nil
+		}
+		if err := d.backoff(ctx, attempt); err != nil {
+			if err == errBackoffPastDeadline {
+				return output, nil
+			}
+			return output, err
+		}
+		var next dynamodb.BatchWriteItemInput
+		if input != nil {
+			next = *input
+		}
+		next.RequestItems = output.UnprocessedItems
+		in = &next
+	}
+}
+
+// Waits before the attempt following attempt, for a random duration between
+// half and all of the UnprocessedBaseDelay doubled at each attempt, up to
+// UnprocessedMaxDelay. Returns errBackoffPastDeadline without waiting if the
+// next attempt would start after the deadline of ctx.
+func (d *Dax) backoff(ctx aws.Context, attempt int) error {
+	delay := d.config.UnprocessedBaseDelay
+	for i := 0; i < attempt && delay < d.config.UnprocessedMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.config.UnprocessedMaxDelay {
+		delay = d.config.UnprocessedMaxDelay
+	}
+	if delay > 1 {
+		jitter := rand.Int63n
+		if d.jitter != nil {
+			jitter = d.jitter
+		}
+		delay = delay/2 + time.Duration(jitter(int64(delay/2)+1))
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return errBackoffPastDeadline
+	}
+	sleep := d.sleep
+	if sleep == nil {
+		sleep = func(ctx aws.Context, delay time.Duration) error {
+			return client.Sleep(&d.config.Config, ctx, delay)
+		}
+	}
+	if err := sleep(ctx, delay); err != nil {
+		return client.WrapError(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Answers batch requests with scripted outputs, or errors when outputs run out.
+type batchStub struct {
+	*client.ClientStub
+	getInputs  []*dynamodb.BatchGetItemInput
+	getOutputs []*dynamodb.BatchGetItemOutput
+	getErr     error
+
+	writeInputs  []*dynamodb.BatchWriteItemInput
+	writeOutputs []*dynamodb.BatchWriteItemOutput
+	writeErr     error
+	// called before answering each write request
+	onWrite func(attempt int)
+}
+
+func (s *batchStub) BatchWriteItemWithOptions(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt client.RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	s.writeInputs = append(s.writeInputs, input)
+	if s.onWrite != nil {
+		s.onWrite(len(s.writeInputs))
+	}
+	if len(s.writeOutputs) == 0 {
+		return nil, s.writeErr
+	}
+	output, s.writeOutputs = s.writeOutputs[0], s.writeOutputs[1:]
+	return output, nil
+}
+
+func (s *batchStub) BatchGetItemWithOptions(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt client.RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
+	s.getInputs = append(s.getInputs, input)
+	if len(s.getOutputs) == 0 {
+		return nil, s.getErr
+	}
+	output, s.getOutputs = s.getOutputs[0], s.getOutputs[1:]
+	return output, nil
+}
+
+// Records the delays of the backoff of db instead of waiting, with no jitter.
+func recordBackoff(db *Dax) *[]time.Duration {
+	var delays []time.Duration
+	db.sleep = func(ctx aws.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	db.jitter = func(n int64) int64 { return n - 1 }
+	return &delays
+}
+
+func batchKeys(pks ...string) []map[string]*dynamodb.AttributeValue {
+	keys := make([]map[string]*dynamodb.AttributeValue, len(pks))
+	for i, pk := range pks {
+		keys[i] = map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(pk)}}
+	}
+	return keys
+}
+
+func batchGetOutput(processed []string, unprocessed []string) *dynamodb.BatchGetItemOutput {
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:        map[string][]map[string]*dynamodb.AttributeValue{"table": batchKeys(processed...)},
+		ConsumedCapacity: []*dynamodb.ConsumedCapacity{{TableName: aws.String("table"), CapacityUnits: aws.Float64(float64(len(processed)))}},
+	}
+	if len(unprocessed) > 0 {
+		output.UnprocessedKeys = map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys(unprocessed...)}}
+	}
+	return output
+}
+
+func TestBatchGetItemAll(t *testing.T) {
+	stub := &batchStub{getOutputs: []*dynamodb.BatchGetItemOutput{
+		batchGetOutput([]string{"a", "b"}, []string{"c", "d", "e"}),
+		batchGetOutput([]string{"c"}, []string{"d", "e"}),
+		batchGetOutput([]string{"d"}, []string{"e"}),
+		batchGetOutput([]string{"e"}, nil),
+	}}
+	db := NewWithInternalClient(stub)
+	delays := recordBackoff(db)
+	db.config.UnprocessedBaseDelay = 40 * time.Millisecond
+	db.config.UnprocessedMaxDelay = 100 * time.Millisecond
+
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems:           map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a", "b", "c", "d", "e")}},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+	output, err := db.BatchGetItemAll(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if e, a := batchKeys("a", "b", "c", "d", "e"), output.Responses["table"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected responses %v, got %v", e, a)
+	}
+	if len(output.UnprocessedKeys) != 0 {
+		t.Errorf("expected no unprocessed keys, got %v", output.UnprocessedKeys)
+	}
+	if e, a := 5.0, aws.Float64Value(output.ConsumedCapacity[0].CapacityUnits); len(output.ConsumedCapacity) != 1 || e != a {
+		t.Errorf("expected %v capacity units, got %v", e, output.ConsumedCapacity)
+	}
+	expected := [][]map[string]*dynamodb.AttributeValue{
+		batchKeys("a", "b", "c", "d", "e"), batchKeys("c", "d", "e"), batchKeys("d", "e"), batchKeys("e"),
+	}
+	if len(stub.getInputs) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(stub.getInputs))
+	}
+	for i, in := range stub.getInputs {
+		if !reflect.DeepEqual(expected[i], in.RequestItems["table"].Keys) {
+			t.Errorf("expected request %d for %v, got %v", i, expected[i], in.RequestItems["table"].Keys)
+		}
+		if aws.StringValue(in.ReturnConsumedCapacity) != dynamodb.ReturnConsumedCapacityTotal {
+			t.Errorf("expected request %d to keep the options of the input", i)
+		}
+	}
+	// 40ms, 80ms then capped to 100ms, all at the top of their jitter range
+	if e, a := []time.Duration{40 * time.Millisecond, 80 * time.Millisecond, 100 * time.Millisecond}, *delays; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected delays %v, got %v", e, a)
+	}
+}
+
+func TestBatchGetItemAll_RetriesExhausted(t *testing.T) {
+	stub := &batchStub{getOutputs: []*dynamodb.BatchGetItemOutput{
+		batchGetOutput([]string{"a"}, []string{"b", "c"}),
+		batchGetOutput([]string{"b"}, []string{"c"}),
+		batchGetOutput(nil, []string{"c"}),
+		batchGetOutput([]string{"c"}, nil),
+	}}
+	db := NewWithInternalClient(stub)
+	delays := recordBackoff(db)
+	db.config.UnprocessedRetries = 2
+
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a", "b", "c")}}}
+	output, err := db.BatchGetItemAll(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(stub.getInputs) != 3 || len(*delays) != 2 {
+		t.Errorf("expected 3 requests and 2 delays, got %d and %v", len(stub.getInputs), *delays)
+	}
+	if e, a := batchKeys("a", "b"), output.Responses["table"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected responses %v, got %v", e, a)
+	}
+	if e, a := batchKeys("c"), output.UnprocessedKeys["table"].Keys; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected unprocessed keys %v, got %v", e, a)
+	}
+}
+
+func TestBatchGetItemAll_Deadline(t *testing.T) {
+	stub := &batchStub{getOutputs: []*dynamodb.BatchGetItemOutput{
+		batchGetOutput([]string{"a"}, []string{"b"}),
+		batchGetOutput([]string{"b"}, nil),
+	}}
+	db := NewWithInternalClient(stub)
+	delays := recordBackoff(db)
+	db.config.UnprocessedBaseDelay = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a", "b")}}}
+	output, err := db.BatchGetItemAll(ctx, input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(stub.getInputs) != 1 || len(*delays) != 0 {
+		t.Errorf("expected no retry past the deadline, got %d requests and delays %v", len(stub.getInputs), *delays)
+	}
+	if e, a := batchKeys("b"), output.UnprocessedKeys["table"].Keys; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected unprocessed keys %v, got %v", e, a)
+	}
+}
+
+func TestBatchGetItemAll_Error(t *testing.T) {
+	failure := awserr.New(dynamodb.ErrCodeResourceNotFoundException, "not found", nil)
+	stub := &batchStub{
+		getOutputs: []*dynamodb.BatchGetItemOutput{batchGetOutput([]string{"a"}, []string{"b", "c"})},
+		getErr:     failure,
+	}
+	db := NewWithInternalClient(stub)
+	recordBackoff(db)
+
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a", "b", "c")}}}
+	output, err := db.BatchGetItemAll(context.Background(), input)
+	if err != failure {
+		t.Fatalf("expected %v, got %v", failure, err)
+	}
+	if e, a := batchKeys("a"), output.Responses["table"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected responses %v, got %v", e, a)
+	}
+	if e, a := batchKeys("b", "c"), output.UnprocessedKeys["table"].Keys; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected unprocessed keys %v, got %v", e, a)
+	}
+}
+
+func TestBatchGetItemAll_DeadlineExceeded(t *testing.T) {
+	stub := &batchStub{getOutputs: []*dynamodb.BatchGetItemOutput{batchGetOutput([]string{"a"}, []string{"b"})}}
+	db := NewWithInternalClient(stub)
+	// the deadline passes during the wait before the second attempt
+	db.sleep = func(ctx aws.Context, d time.Duration) error {
+		return context.DeadlineExceeded
+	}
+
+	keys := &dynamodb.KeysAndAttributes{Keys: batchKeys("a", "b")}
+	_, err := db.BatchGetItemAll(context.Background(), &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": keys}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an error wrapping %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func batchWrites(pks ...string) []*dynamodb.WriteRequest {
+	writes := make([]*dynamodb.WriteRequest, len(pks))
+	for i, key := range batchKeys(pks...) {
+		if i%2 == 0 {
+			writes[i] = &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: key}}
+		} else {
+			writes[i] = &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key}}
+		}
+	}
+	return writes
+}
+
+func batchWriteOutput(processed int, unprocessed []*dynamodb.WriteRequest) *dynamodb.BatchWriteItemOutput {
+	output := &dynamodb.BatchWriteItemOutput{
+		ConsumedCapacity:      []*dynamodb.ConsumedCapacity{{TableName: aws.String("table"), CapacityUnits: aws.Float64(float64(processed))}},
+		ItemCollectionMetrics: map[string][]*dynamodb.ItemCollectionMetrics{"table": {{SizeEstimateRangeGB: []*float64{aws.Float64(1)}}}},
+	}
+	if len(unprocessed) > 0 {
+		output.UnprocessedItems = map[string][]*dynamodb.WriteRequest{"table": unprocessed}
+	}
+	return output
+}
+
+func TestBatchWriteItemAll(t *testing.T) {
+	writes := batchWrites("a", "b", "c", "d", "e")
+	stub := &batchStub{writeOutputs: []*dynamodb.BatchWriteItemOutput{
+		batchWriteOutput(2, writes[2:]),
+		batchWriteOutput(2, writes[4:]),
+		batchWriteOutput(1, nil),
+	}}
+	db := NewWithInternalClient(stub)
+	delays := recordBackoff(db)
+
+	input := &dynamodb.BatchWriteItemInput{
+		RequestItems:           map[string][]*dynamodb.WriteRequest{"table": writes},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+	output, err := db.BatchWriteItemAll(context.Background(), input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(output.UnprocessedItems) != 0 {
+		t.Errorf("expected no unprocessed items, got %v", output.UnprocessedItems)
+	}
+	if e, a := 5.0, aws.Float64Value(output.ConsumedCapacity[0].CapacityUnits); len(output.ConsumedCapacity) != 1 || e != a {
+		t.Errorf("expected %v capacity units, got %v", e, output.ConsumedCapacity)
+	}
+	if len(output.ItemCollectionMetrics["table"]) != 3 {
+		t.Errorf("expected the item collection metrics of every attempt, got %v", output.ItemCollectionMetrics)
+	}
+
+	// only unprocessed items are sent again
+	expected := [][]*dynamodb.WriteRequest{writes, writes[2:], writes[4:]}
+	if len(stub.writeInputs) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(stub.writeInputs))
+	}
+	for i, in := range stub.writeInputs {
+		if !reflect.DeepEqual(expected[i], in.RequestItems["table"]) {
+			t.Errorf("expected request %d for %v, got %v", i, expected[i], in.RequestItems["table"])
+		}
+	}
+	if e, a := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}, *delays; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected delays %v, got %v", e, a)
+	}
+}
+
+func TestBatchWriteItemAll_RetriesExhausted(t *testing.T) {
+	writes := batchWrites("a", "b", "c")
+	stub := &batchStub{writeOutputs: []*dynamodb.BatchWriteItemOutput{
+		batchWriteOutput(1, writes[1:]),
+		batchWriteOutput(0, writes[1:]),
+		batchWriteOutput(1, writes[2:]),
+		batchWriteOutput(1, nil),
+	}}
+	db := NewWithInternalClient(stub)
+	recordBackoff(db)
+	db.config.UnprocessedRetries = 2
+
+	output, err := db.BatchWriteItemAll(context.Background(), &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"table": writes}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(stub.writeInputs) != 3 {
+		t.Errorf("expected 3 requests, got %d", len(stub.writeInputs))
+	}
+	if e, a := writes[2:], output.UnprocessedItems["table"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected unprocessed items %v, got %v", e, a)
+	}
+	if e, a := 2.0, aws.Float64Value(output.ConsumedCapacity[0].CapacityUnits); e != a {
+		t.Errorf("expected %v capacity units, got %v", e, a)
+	}
+}
+
+func TestBatchWriteItemAll_Canceled(t *testing.T) {
+	writes := batchWrites("a", "b", "c")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stub := &batchStub{
+		writeOutputs: []*dynamodb.BatchWriteItemOutput{
+			batchWriteOutput(1, writes[1:]),
+			batchWriteOutput(1, writes[2:]),
+			batchWriteOutput(1, nil),
+		},
+		onWrite: func(attempt int) {
+			if attempt == 2 {
+				cancel()
+			}
+		},
+	}
+	db := NewWithInternalClient(stub)
+	db.config.UnprocessedBaseDelay = time.Millisecond
+
+	output, err := db.BatchWriteItemAll(ctx, &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"table": writes}})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Fatalf("expected canceled error, got %v", err)
+	}
+	if len(stub.writeInputs) != 2 {
+		t.Errorf("expected no request after the cancellation, got %d requests", len(stub.writeInputs))
+	}
+	if e, a := writes[2:], output.UnprocessedItems["table"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected unprocessed items %v, got %v", e, a)
+	}
+}
+
+func TestBatchWriteItemAll_SplitFailure(t *testing.T) {
+	writes := batchWrites("a", "b", "c", "d")
+	failure := &BatchWriteError{
+		Err:          awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil),
+		Failed:       map[string][]*dynamodb.WriteRequest{"table": writes[2:3]},
+		NotAttempted: map[string][]*dynamodb.WriteRequest{"table": writes[3:]},
+	}
+	stub := &batchStub{writeErr: failure}
+	db := NewWithInternalClient(stub)
+
+	output, err := db.BatchWriteItemAll(context.Background(), &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"table": writes}})
+	if err != failure {
+		t.Fatalf("expected %v, got %v", failure, err)
+	}
+	if e, a := writes[2:], output.UnprocessedItems["table"]; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected unprocessed items %v, got %v", e, a)
+	}
+}
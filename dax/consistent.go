@@ -0,0 +1,75 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// WithConsistentRead returns a request.Option making GetItem, Query, Scan and
+// BatchGetItem requests strongly consistent, as if ConsistentRead were set on
+// their input, or on every table of a BatchGetItem. DAX passes such requests
+// through to DynamoDB instead of serving them from its caches.
+//
+// The input of the caller is not modified. The option does not change other
+// requests, and also applies to the requests of a dynamodb.DynamoDB client.
+func WithConsistentRead() request.Option {
+	return func(r *request.Request) {
+		r.Params = consistentReadInput(r.Params)
+	}
+}
+
+// Returns a copy of params reading with strong consistency, or params if it is
+// not the input of a read.
+func consistentReadInput(params interface{}) interface{} {
+	switch in := params.(type) {
+	case *dynamodb.GetItemInput:
+		if in != nil {
+			c := *in
+			c.ConsistentRead = aws.Bool(true)
+			return &c
+		}
+	case *dynamodb.QueryInput:
+		if in != nil {
+			c := *in
+			c.ConsistentRead = aws.Bool(true)
+			return &c
+		}
+	case *dynamodb.ScanInput:
+		if in != nil {
+			c := *in
+			c.ConsistentRead = aws.Bool(true)
+			return &c
+		}
+	case *dynamodb.BatchGetItemInput:
+		if in != nil {
+			c := *in
+			c.RequestItems = make(map[string]*dynamodb.KeysAndAttributes, len(in.RequestItems))
+			for table, ka := range in.RequestItems {
+				if ka != nil {
+					cka := *ka
+					cka.ConsistentRead = aws.Bool(true)
+					ka = &cka
+				}
+				c.RequestItems[table] = ka
+			}
+			return &c
+		}
+	}
+	return params
+}
@@ -0,0 +1,118 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestWithConsistentRead(t *testing.T) {
+	stub := client.NewClientStub(nil, []*dynamodb.QueryOutput{{}, {}}, nil)
+	db := NewWithInternalClient(stub)
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	table := aws.String("table")
+
+	get := &dynamodb.GetItemInput{TableName: table, Key: key}
+	query := &dynamodb.QueryInput{TableName: table, ConsistentRead: aws.Bool(false)}
+	scan := &dynamodb.ScanInput{TableName: table}
+	batch := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{
+		"a": {Keys: []map[string]*dynamodb.AttributeValue{key}},
+		"b": {Keys: []map[string]*dynamodb.AttributeValue{key}, ConsistentRead: aws.Bool(false)},
+	}}
+	if _, err := db.GetItemWithContext(nil, get, WithConsistentRead()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := db.QueryWithContext(nil, query, WithConsistentRead()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := db.ScanWithContext(nil, scan, WithConsistentRead()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := db.BatchGetItemWithContext(nil, batch, WithConsistentRead()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := NewQueryPaginator(db, query).NextPage(nil, WithConsistentRead()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	consistent := func(cr *bool) bool { return aws.BoolValue(cr) }
+	if in := stub.Requests(client.OpGetItem)[0].(*dynamodb.GetItemInput); !consistent(in.ConsistentRead) || !reflect.DeepEqual(key, in.Key) {
+		t.Errorf("expect a consistent GetItem of %v, got %v", key, in)
+	}
+	for i, r := range stub.Requests(client.OpQuery) {
+		if in := r.(*dynamodb.QueryInput); !consistent(in.ConsistentRead) {
+			t.Errorf("expect query %d to be consistent, got %v", i, in)
+		}
+	}
+	if in := stub.Requests(client.OpScan)[0].(*dynamodb.ScanInput); !consistent(in.ConsistentRead) {
+		t.Errorf("expect a consistent Scan, got %v", in)
+	}
+	in := stub.Requests(client.OpBatchGetItem)[0].(*dynamodb.BatchGetItemInput)
+	for _, table := range []string{"a", "b"} {
+		if ka := in.RequestItems[table]; !consistent(ka.ConsistentRead) || !reflect.DeepEqual(batch.RequestItems[table].Keys, ka.Keys) {
+			t.Errorf("expect a consistent read of table %s, got %v", table, ka)
+		}
+	}
+
+	// the inputs of the caller are left unchanged
+	if get.ConsistentRead != nil || aws.BoolValue(query.ConsistentRead) || scan.ConsistentRead != nil ||
+		batch.RequestItems["a"].ConsistentRead != nil || aws.BoolValue(batch.RequestItems["b"].ConsistentRead) {
+		t.Errorf("expect the inputs unchanged, got %v %v %v %v", get, query, scan, batch)
+	}
+
+	// and without the option, requests are sent as is
+	if _, err := db.GetItemWithContext(nil, get); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if in := stub.Requests(client.OpGetItem)[1].(*dynamodb.GetItemInput); in != get {
+		t.Errorf("expect the input of the caller, got %v", in)
+	}
+}
+
+func TestWithConsistentRead_Request(t *testing.T) {
+	get := &dynamodb.GetItemInput{TableName: aws.String("table")}
+
+	// the option applies to the requests of DAX and of DynamoDB alike
+	db := NewWithInternalClient(client.NewClientStub(nil, nil, nil))
+	req, _ := db.GetItemRequest(get)
+	req.ApplyOptions(WithConsistentRead())
+	if in := req.Params.(*dynamodb.GetItemInput); !aws.BoolValue(in.ConsistentRead) {
+		t.Errorf("expect a consistent DAX request, got %v", in)
+	}
+	ddb := dynamodb.New(session.Must(session.NewSession(&aws.Config{Region: aws.String("us-west-2")})))
+	req, _ = ddb.GetItemRequest(get)
+	req.ApplyOptions(WithConsistentRead())
+	if in := req.Params.(*dynamodb.GetItemInput); !aws.BoolValue(in.ConsistentRead) {
+		t.Errorf("expect a consistent DynamoDB request, got %v", in)
+	}
+	if get.ConsistentRead != nil {
+		t.Errorf("expect the input unchanged, got %v", get)
+	}
+
+	// other requests are not changed
+	put := &dynamodb.PutItemInput{TableName: aws.String("table")}
+	req, _ = db.PutItemRequest(put)
+	req.ApplyOptions(WithConsistentRead())
+	if req.Params != put {
+		t.Errorf("expect the put input unchanged, got %v", req.Params)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returns a DialContext refusing the first failures dials, as while the
+// network of the process is not ready yet.
+func refusingDial(failures int32) func(ctx context.Context, network, address string) (net.Conn, error) {
+	var dials int32
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) <= failures {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+}
+
+func TestNew_BootstrapTimeout(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.CreateTable("orders", dynamodb.AttributeDefinition{AttributeName: aws.String("customer"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := s.Config()
+	cfg.BootstrapTimeout = 10 * time.Second
+	// each discovery attempt dials up to three times
+	cfg.DialContext = refusingDial(7)
+	start := time.Now()
+	client, err := dax.New(cfg)
+	if err != nil {
+		t.Fatalf("New failed after %s: %v", time.Since(start), err)
+	}
+	defer client.Close()
+	if elapsed := time.Since(start); elapsed >= cfg.BootstrapTimeout {
+		t.Errorf("New took %s", elapsed)
+	}
+	if status := client.DiscoveryStatus(); status.LastSuccess.IsZero() || status.ConsecutiveFailures != 0 {
+		t.Errorf("unexpected discovery status %+v", status)
+	}
+	if _, err := client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: map[string]*dynamodb.AttributeValue{"customer": {S: aws.String("alice")}}}); err != nil {
+		t.Errorf("GetItem failed after bootstrap: %v", err)
+	}
+}
+
+func TestNew_BootstrapTimeoutExpires(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cfg := s.Config()
+	cfg.BootstrapTimeout = 300 * time.Millisecond
+	cfg.DialContext = refusingDial(1 << 30)
+	start := time.Now()
+	_, err = dax.New(cfg)
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("New succeeded without discovering the cluster")
+	}
+	if elapsed < cfg.BootstrapTimeout || elapsed > 3*time.Second {
+		t.Errorf("New gave up after %s", elapsed)
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dax.ErrCodeServiceUnavailable {
+		t.Errorf("unexpected error %v", err)
+	}
+	for _, want := range []string{"attempt 1 after", "attempt 2 after", "connection refused"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestNew_BootstrapTimeoutAbortsDiscovery(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cfg := s.Config()
+	cfg.BootstrapTimeout = 300 * time.Millisecond
+	cfg.ConnectTimeout = time.Minute
+	// the network drops the packets: the dials hang until aborted
+	cfg.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	start := time.Now()
+	_, err = dax.New(cfg)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("New gave up after %s", elapsed)
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dax.ErrCodeServiceUnavailable {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestNewWithContext_BootstrapCanceled(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cfg := s.Config()
+	cfg.BootstrapTimeout = time.Minute
+	cfg.DialContext = refusingDial(1 << 30)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = dax.NewWithContext(ctx, cfg)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("New aborted after %s", elapsed)
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Names of the requests the client sends on its own to define key schemas and
+// attribute lists.
+const (
+	opDefineKeySchema       = "DefineKeySchema"
+	opDefineAttributeList   = "DefineAttributeList"
+	opDefineAttributeListID = "DefineAttributeListId"
+)
+
+// Recorder is a dax.FrameCapture keeping a copy of every captured frame.
+// Set it as the Config.FrameCapture of a client.
+type Recorder struct {
+	mu     sync.Mutex
+	frames []dax.Frame
+}
+
+// CaptureFrame records a copy of f.
+func (r *Recorder) CaptureFrame(f dax.Frame) {
+	f.Bytes = append([]byte(nil), f.Bytes...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, f)
+}
+
+// Frames returns the frames recorded so far, in capture order.
+func (r *Recorder) Frames() []dax.Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]dax.Frame(nil), r.frames...)
+}
+
+// Responses returns the response frames of op recorded so far, in capture
+// order.
+func (r *Recorder) Responses(op string) []dax.Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var frames []dax.Frame
+	for _, f := range r.frames {
+		if f.Op == op && f.Direction == dax.FrameResponse {
+			frames = append(frames, f)
+		}
+	}
+	return frames
+}
+
+// Replayer decodes captured response frames into the outputs the client
+// returned for them, without connecting to a cluster. Responses refer to the
+// key schemas of their tables and to attribute lists defined by the node that
+// sent them, which are either defined explicitly or learnt from the frames
+// the client exchanged to fetch them.
+type Replayer struct {
+	keySchemas map[string][]dynamodb.AttributeDefinition
+	attrLists  map[string]map[int64][]string
+}
+
+// NewReplayer returns a Replayer with no key schema nor attribute list.
+func NewReplayer() *Replayer {
+	return &Replayer{
+		keySchemas: make(map[string][]dynamodb.AttributeDefinition),
+		attrLists:  make(map[string]map[int64][]string),
+	}
+}
+
+// DefineKeySchema sets the key schema of table.
+func (r *Replayer) DefineKeySchema(table string, keys ...dynamodb.AttributeDefinition) {
+	r.keySchemas[table] = keys
+}
+
+// DefineAttributeList sets the attribute names of the attribute list id of
+// node.
+func (r *Replayer) DefineAttributeList(node string, id int64, names ...string) {
+	ids, ok := r.attrLists[node]
+	if !ok {
+		ids = make(map[int64][]string)
+		r.attrLists[node] = ids
+	}
+	ids[id] = names
+}
+
+// Learn defines the key schemas and attribute lists fetched by the requests
+// captured in frames. The frames of a client captured since its creation
+// hold every definition its responses refer to.
+func (r *Replayer) Learn(frames []dax.Frame) error {
+	// responses of a node arrive in request order, at least on each connection
+	type pending struct{ node, op string }
+	requests := make(map[pending][]interface{})
+	for _, f := range frames {
+		k := pending{f.Node, f.Op}
+		switch f.Op {
+		case opDefineKeySchema, opDefineAttributeList, opDefineAttributeListID:
+		default:
+			continue
+		}
+		if f.Direction == dax.FrameRequest {
+			arg, err := readDefinitionRequest(f.Bytes)
+			if err != nil {
+				return fmt.Errorf("daxtest: invalid %s request: %v", f.Op, err)
+			}
+			requests[k] = append(requests[k], arg)
+			continue
+		}
+		if len(requests[k]) == 0 {
+			return fmt.Errorf("daxtest: %s response from %s without request", f.Op, f.Node)
+		}
+		arg := requests[k][0]
+		requests[k] = requests[k][1:]
+		out, err := r.Replay(f, nil)
+		if err != nil {
+			// failed definitions define nothing
+			continue
+		}
+		switch f.Op {
+		case opDefineKeySchema:
+			r.DefineKeySchema(arg.(string), out.([]dynamodb.AttributeDefinition)...)
+		case opDefineAttributeList:
+			r.DefineAttributeList(f.Node, arg.(int64), out.([]string)...)
+		case opDefineAttributeListID:
+			r.DefineAttributeList(f.Node, out.(int64), arg.([]string)...)
+		}
+	}
+	return nil
+}
+
+// Replay decodes f, the response to a request made with input, such as a
+// *dynamodb.GetItemInput for a GetItem response, into the output the client
+// returned for it. Errors returned by DAX are returned as the client returns
+// them.
+func (r *Replayer) Replay(f dax.Frame, input interface{}) (interface{}, error) {
+	if f.Direction != dax.FrameResponse {
+		return nil, fmt.Errorf("daxtest: cannot replay a %s frame", f.Direction)
+	}
+	keySchema := func(table string) ([]dynamodb.AttributeDefinition, error) {
+		keys, ok := r.keySchemas[table]
+		if !ok {
+			return nil, fmt.Errorf("daxtest: unknown key schema of table %s", table)
+		}
+		return keys, nil
+	}
+	attrNames := func(id int64) ([]string, error) {
+		names, ok := r.attrLists[f.Node][id]
+		if !ok {
+			return nil, fmt.Errorf("daxtest: unknown attribute list %d of node %s", id, f.Node)
+		}
+		return names, nil
+	}
+	return client.DecodeResponse(f.Op, input, f.Bytes, keySchema, attrNames)
+}
+
+// Reads the argument of a request defining a key schema or an attribute
+// list: the table name, the attribute list id or the attribute names.
+func readDefinitionRequest(b []byte) (interface{}, error) {
+	r := cbor.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	if _, err := r.ReadInt(); err != nil { // service
+		return nil, err
+	}
+	method, err := r.ReadInt()
+	if err != nil {
+		return nil, err
+	}
+	switch method {
+	case methodDefineKeySchema:
+		name, err := r.ReadBytes()
+		return string(name), err
+	case methodDefineAttributeList:
+		return r.ReadInt64()
+	case methodDefineAttributeListID:
+		n, err := r.ReadArrayLength()
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, n)
+		for i := range names {
+			if names[i], err = r.ReadString(); err != nil {
+				return nil, err
+			}
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("unexpected method %d", method)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returns a client of s capturing its frames into rec.
+func captureClient(t *testing.T, s *Server, rec *Recorder, pipelineDepth int) *dax.Dax {
+	cfg := s.Config()
+	cfg.FrameCapture = rec
+	cfg.PipelineDepth = pipelineDepth
+	client, err := dax.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestReplayer_RoundTrip(t *testing.T) {
+	s, plain := startServer(t)
+	defer stopServer(s, plain)
+	rec := &Recorder{}
+	client := captureClient(t, s, rec, 0)
+	defer client.Close()
+
+	type call struct {
+		op     string
+		input  interface{}
+		output interface{}
+		err    error
+	}
+	var calls []call
+	record := func(op string, input, output interface{}, err error) {
+		calls = append(calls, call{op, input, output, err})
+	}
+
+	item := order("alice", 1, "status", "new")
+	item["tags"] = &dynamodb.AttributeValue{SS: []*string{aws.String("gift")}}
+	put := &dynamodb.PutItemInput{TableName: aws.String("orders"), Item: item}
+	putOut, err := client.PutItem(put)
+	record(OpPutItem, put, putOut, err)
+	cond := &dynamodb.PutItemInput{
+		TableName:           aws.String("orders"),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	}
+	_, err = client.PutItem(cond)
+	if err == nil {
+		t.Fatal("expect conditional check to fail")
+	}
+	record(OpPutItem, cond, nil, err)
+	get := &dynamodb.GetItemInput{TableName: aws.String("orders"), Key: orderKey("alice", 1)}
+	getOut, err := client.GetItem(get)
+	record(OpGetItem, get, getOut, err)
+	projected := &dynamodb.GetItemInput{
+		TableName:                aws.String("orders"),
+		Key:                      orderKey("alice", 1),
+		ProjectionExpression:     aws.String("#s"),
+		ExpressionAttributeNames: map[string]*string{"#s": aws.String("status")},
+	}
+	getOut, err = client.GetItem(projected)
+	record(OpGetItem, projected, getOut, err)
+	update := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("orders"),
+		Key:                       orderKey("alice", 1),
+		UpdateExpression:          aws.String("SET #s = :s"),
+		ExpressionAttributeNames:  map[string]*string{"#s": aws.String("status")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":s": {S: aws.String("paid")}},
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+	updateOut, err := client.UpdateItem(update)
+	record(OpUpdateItem, update, updateOut, err)
+	query := &dynamodb.QueryInput{
+		TableName:                 aws.String("orders"),
+		KeyConditionExpression:    aws.String("customer = :c"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}},
+	}
+	queryOut, err := client.Query(query)
+	record(OpQuery, query, queryOut, err)
+	scan := &dynamodb.ScanInput{TableName: aws.String("orders")}
+	scanOut, err := client.Scan(scan)
+	record(OpScan, scan, scanOut, err)
+	del := &dynamodb.DeleteItemInput{
+		TableName:    aws.String("orders"),
+		Key:          orderKey("alice", 1),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	}
+	delOut, err := client.DeleteItem(del)
+	record(OpDeleteItem, del, delOut, err)
+
+	r := NewReplayer()
+	if err := r.Learn(rec.Frames()); err != nil {
+		t.Fatal(err)
+	}
+	responses := make(map[string][]dax.Frame)
+	for _, c := range calls {
+		if _, ok := responses[c.op]; !ok {
+			responses[c.op] = rec.Responses(c.op)
+		}
+	}
+	for i, c := range calls {
+		if len(responses[c.op]) == 0 {
+			t.Fatalf("%d: no %s response captured", i, c.op)
+		}
+		f := responses[c.op][0]
+		responses[c.op] = responses[c.op][1:]
+		if f.Node != s.Addr() {
+			t.Errorf("%d: expect node %s, got %s", i, s.Addr(), f.Node)
+		}
+		out, err := r.Replay(f, c.input)
+		if c.err != nil {
+			expect, _ := c.err.(awserr.Error)
+			actual, ok := err.(awserr.Error)
+			if !ok || expect.Code() != actual.Code() || expect.Message() != actual.Message() {
+				t.Errorf("%d: expect error %v, got %v", i, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error %v", i, err)
+		} else if !reflect.DeepEqual(c.output, out) {
+			t.Errorf("%d: expect %v, got %v", i, c.output, out)
+		}
+	}
+}
+
+func TestReplayer_Pipelined(t *testing.T) {
+	s, plain := startServer(t)
+	defer stopServer(s, plain)
+	const n = 20
+	for i := 0; i < n; i++ {
+		item := order("bob", i, "n", strconv.Itoa(i))
+		if _, err := plain.PutItem(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := &Recorder{}
+	client := captureClient(t, s, rec, 4)
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: orderKey("bob", i)})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	r := NewReplayer()
+	if err := r.Learn(rec.Frames()); err != nil {
+		t.Fatal(err)
+	}
+	frames := rec.Responses(OpGetItem)
+	if len(frames) != n {
+		t.Fatalf("expect %d responses, got %d", n, len(frames))
+	}
+	var replayed []int
+	for _, f := range frames {
+		// the key of the output is taken from the input, the other attributes from the frame
+		out, err := r.Replay(f, &dynamodb.GetItemInput{TableName: aws.String("orders"), Key: orderKey("bob", 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := strconv.Atoi(aws.StringValue(out.(*dynamodb.GetItemOutput).Item["n"].S))
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed = append(replayed, i)
+	}
+	sort.Ints(replayed)
+	for i := range replayed {
+		if replayed[i] != i {
+			t.Fatalf("expect items 0 to %d, got %v", n-1, replayed)
+		}
+	}
+}
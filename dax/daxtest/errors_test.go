@@ -0,0 +1,198 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type errorPredicates struct {
+	throttle, retryable, conditionalCheckFailed, transactionCanceled, validation, clientClosed bool
+}
+
+func predicates(err error) errorPredicates {
+	return errorPredicates{
+		throttle:               dax.IsThrottle(err),
+		retryable:              dax.IsRetryable(err),
+		conditionalCheckFailed: dax.IsConditionalCheckFailed(err),
+		transactionCanceled:    dax.IsTransactionCanceled(err),
+		validation:             dax.IsValidation(err),
+		clientClosed:           dax.IsClientClosed(err),
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	err = s.CreateTable("orders",
+		dynamodb.AttributeDefinition{AttributeName: aws.String("customer"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(client *dax.Dax, condition string) error {
+		input := &dynamodb.PutItemInput{TableName: aws.String("orders"), Item: order("alice", 1)}
+		if condition != "" {
+			input.ConditionExpression = aws.String(condition)
+		}
+		_, err := client.PutItem(input)
+		return err
+	}
+	faulty := func(fault error) *dax.Dax {
+		cfg := s.Config()
+		cfg.ReadRetries, cfg.WriteRetries = 0, 0
+		cfg.FaultInjector = &RandomFaults{ErrorRate: 1, Err: fault}
+		client, err := dax.New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+
+	client, err := dax.New(s.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := put(client, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		err    func() error
+		code   string
+		expect errorPredicates
+	}{
+		{
+			name:   "conditional check failed",
+			err:    func() error { return put(client, "attribute_not_exists(customer)") },
+			code:   dax.ErrCodeConditionalCheckFailedException,
+			expect: errorPredicates{conditionalCheckFailed: true},
+		},
+		{
+			name: "item too large",
+			err: func() error {
+				item := order("alice", 2, "blob", strings.Repeat("x", 400*1024))
+				_, err := client.PutItem(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: item})
+				return err
+			},
+			code:   dax.ErrCodeValidationException,
+			expect: errorPredicates{validation: true},
+		},
+		{
+			name: "missing parameter",
+			err: func() error {
+				_, err := client.GetItem(&dynamodb.GetItemInput{Key: orderKey("alice", 1)})
+				return err
+			},
+			expect: errorPredicates{validation: true},
+		},
+		{
+			name: "throttled",
+			err: func() error {
+				c := faulty(dax.NewFaultError([]int{4, 37, 38, 39, 50}, dax.ErrCodeThrottlingException, "slow down", 400))
+				defer c.Close()
+				return put(c, "")
+			},
+			code:   dax.ErrCodeThrottlingException,
+			expect: errorPredicates{throttle: true, retryable: true},
+		},
+		{
+			name: "throughput exceeded",
+			err: func() error {
+				c := faulty(dax.NewFaultError([]int{4, 37, 38, 39, 40}, dax.ErrCodeProvisionedThroughputExceededException, "slow down", 400))
+				defer c.Close()
+				return put(c, "")
+			},
+			code:   dax.ErrCodeProvisionedThroughputExceededException,
+			expect: errorPredicates{throttle: true, retryable: true},
+		},
+		{
+			name: "service unavailable",
+			err: func() error {
+				c := faulty(dax.NewFaultError([]int{2}, dax.ErrCodeServiceUnavailable, "unavailable", 503))
+				defer c.Close()
+				return put(c, "")
+			},
+			code:   dax.ErrCodeServiceUnavailable,
+			expect: errorPredicates{retryable: true},
+		},
+		{
+			name: "validation",
+			err: func() error {
+				c := faulty(dax.NewFaultError([]int{4, 37, 38, 39, 46}, dax.ErrCodeValidationException, "invalid key", 400))
+				defer c.Close()
+				return put(c, "")
+			},
+			code:   dax.ErrCodeValidationException,
+			expect: errorPredicates{validation: true},
+		},
+		{
+			name: "transaction canceled",
+			err: func() error {
+				c := faulty(dax.NewFaultError([]int{4, 37, 38, 39, 58}, dax.ErrCodeTransactionCanceledException, "canceled", 400))
+				defer c.Close()
+				return put(c, "")
+			},
+			code:   dax.ErrCodeTransactionCanceledException,
+			expect: errorPredicates{transactionCanceled: true},
+		},
+		{
+			name: "client closed",
+			err: func() error {
+				c, err := dax.New(s.Config())
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Close()
+				return put(c, "")
+			},
+			code:   dax.ErrCodeClientClosed,
+			expect: errorPredicates{clientClosed: true},
+		},
+	}
+	for _, c := range cases {
+		err := c.err()
+		if err == nil {
+			t.Errorf("%s: expect an error", c.name)
+			continue
+		}
+		if c.code != "" && !strings.Contains(err.Error(), c.code) {
+			t.Errorf("%s: expect code %s, got %v", c.name, c.code, err)
+		}
+		if got := predicates(err); got != c.expect {
+			t.Errorf("%s: expect %+v, got %+v for %v", c.name, c.expect, got, err)
+		}
+		if got := predicates(fmt.Errorf("wrapped: %w", err)); got != c.expect {
+			t.Errorf("%s: expect %+v for the wrapped error, got %+v", c.name, c.expect, got)
+		}
+	}
+
+	if predicates(nil) != (errorPredicates{}) {
+		t.Errorf("expect no predicate to hold for nil")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest_test
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-dax-go/dax/daxtest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// CountOrders is application code to be tested, taking a dax.DynamoDBAPI
+// rather than a *dax.Dax.
+func CountOrders(db dax.DynamoDBAPI, customer string) (int, error) {
+	count := 0
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String("orders"),
+		KeyConditionExpression:    aws.String("customer = :c"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String(customer)}},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		count += len(page.Items)
+		return true
+	})
+	return count, err
+}
+
+func Example() {
+	m := daxtest.New()
+	m.AddResponse(daxtest.OpQuery, &dynamodb.QueryOutput{
+		Items:            []map[string]*dynamodb.AttributeValue{{"id": {S: aws.String("1")}}, {"id": {S: aws.String("2")}}},
+		LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"id": {S: aws.String("2")}},
+	})
+	m.AddResponse(daxtest.OpQuery, &dynamodb.QueryOutput{
+		Items: []map[string]*dynamodb.AttributeValue{{"id": {S: aws.String("3")}}},
+	})
+
+	count, err := CountOrders(m, "customer#1")
+	fmt.Println(count, err)
+	fmt.Println(m.CallCount(daxtest.OpQuery))
+
+	input := m.Inputs(daxtest.OpQuery)[1].(*dynamodb.QueryInput)
+	fmt.Println(aws.StringValue(input.ExclusiveStartKey["id"].S))
+
+	// Output:
+	// 3 <nil>
+	// 2
+	// 2
+}
+
+func ExampleMock_AddError() {
+	m := daxtest.New()
+	m.AddError(daxtest.OpQuery, fmt.Errorf("throttled"))
+
+	_, err := CountOrders(m, "customer#1")
+	fmt.Println(err)
+
+	// Output:
+	// throttled
+}
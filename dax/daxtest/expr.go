@@ -0,0 +1,708 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Operators of the expressions encoded by the client.
+const (
+	opEqual = iota
+	opNotEqual
+	opLessThan
+	opGreaterEqual
+	opGreaterThan
+	opLessEqual
+	opAnd
+	opOr
+	opNot
+	opBetween
+	opIn
+	opAttributeExists
+	opAttributeNotExists
+	opAttributeType
+	opBeginsWith
+	opContains
+	opSize
+	opVariable
+	opDocumentPath
+	opSetAction
+	opAddAction
+	opDeleteAction
+	opRemoveAction
+	opIfNotExists
+	opListAppend
+	opPlus
+	opMinus
+)
+
+// Tag of the list indexes of a document path.
+const tagDocumentPathOrdinal = 3324
+
+// An expression as encoded by the client: nested arrays starting with an
+// operator, and the values of the variables referred to by their index.
+type expression struct {
+	expr   interface{}
+	values []*dynamodb.AttributeValue
+}
+
+// An element of a document path, either an attribute name or a list index.
+type pathElement struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+func decodeExpression(b []byte) (*expression, error) {
+	r := cbor.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	n, err := r.ReadArrayLength()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.ReadInt(); err != nil { // encoding version
+		return nil, err
+	}
+	e := &expression{}
+	if e.expr, err = readValue(r); err != nil {
+		return nil, err
+	}
+	if n > 2 {
+		c, err := r.ReadArrayLength()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < c; i++ {
+			av, err := cbor.DecodeAttributeValue(r)
+			if err != nil {
+				return nil, err
+			}
+			e.values = append(e.values, av)
+		}
+	}
+	return e, nil
+}
+
+// Evaluates the expression as a condition on item, which is nil if the item
+// does not exist.
+func (e *expression) condition(item map[string]*dynamodb.AttributeValue) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	return e.cond(item, e.expr)
+}
+
+func (e *expression) cond(item map[string]*dynamodb.AttributeValue, x interface{}) (bool, error) {
+	op, args, err := operation(x)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case opEqual, opNotEqual, opLessThan, opGreaterEqual, opGreaterThan, opLessEqual:
+		if len(args) != 2 {
+			return false, invalidExpression()
+		}
+		a, b, err := e.operands(item, args[0], args[1])
+		if err != nil {
+			return false, err
+		}
+		return compare(op, a, b), nil
+	case opAnd, opOr:
+		if len(args) != 2 {
+			return false, invalidExpression()
+		}
+		a, err := e.cond(item, args[0])
+		if err != nil || a == (op == opOr) {
+			return a, err
+		}
+		return e.cond(item, args[1])
+	case opNot:
+		if len(args) != 1 {
+			return false, invalidExpression()
+		}
+		a, err := e.cond(item, args[0])
+		return !a, err
+	case opBetween:
+		if len(args) != 3 {
+			return false, invalidExpression()
+		}
+		a, lo, err := e.operands(item, args[0], args[1])
+		if err != nil {
+			return false, err
+		}
+		hi, err := e.operand(item, args[2])
+		if err != nil {
+			return false, err
+		}
+		return compare(opGreaterEqual, a, lo) && compare(opLessEqual, a, hi), nil
+	case opIn:
+		list, ok := args[len(args)-1].([]interface{})
+		if len(args) != 2 || !ok {
+			return false, invalidExpression()
+		}
+		a, err := e.operand(item, args[0])
+		if err != nil {
+			return false, err
+		}
+		for _, x := range list {
+			b, err := e.operand(item, x)
+			if err != nil {
+				return false, err
+			}
+			if compare(opEqual, a, b) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case opAttributeExists, opAttributeNotExists:
+		if len(args) != 1 {
+			return false, invalidExpression()
+		}
+		a, err := e.operand(item, args[0])
+		return (a != nil) == (op == opAttributeExists), err
+	case opAttributeType:
+		if len(args) != 2 {
+			return false, invalidExpression()
+		}
+		a, t, err := e.operands(item, args[0], args[1])
+		if err != nil {
+			return false, err
+		}
+		if t == nil || t.S == nil {
+			return false, validationError("Invalid ConditionExpression: Incorrect operand type for operator or function; operator or function: attribute_type")
+		}
+		return a != nil && typeOf(a) == *t.S, nil
+	case opBeginsWith:
+		if len(args) != 2 {
+			return false, invalidExpression()
+		}
+		a, b, err := e.operands(item, args[0], args[1])
+		if err != nil || a == nil || b == nil {
+			return false, err
+		}
+		switch {
+		case a.S != nil && b.S != nil:
+			return strings.HasPrefix(*a.S, *b.S), nil
+		case a.B != nil && b.B != nil:
+			return bytes.HasPrefix(a.B, b.B), nil
+		}
+		return false, nil
+	case opContains:
+		if len(args) != 2 {
+			return false, invalidExpression()
+		}
+		a, b, err := e.operands(item, args[0], args[1])
+		if err != nil || a == nil || b == nil {
+			return false, err
+		}
+		return contains(a, b), nil
+	}
+	return false, invalidExpression()
+}
+
+func (e *expression) operands(item map[string]*dynamodb.AttributeValue, x, y interface{}) (*dynamodb.AttributeValue, *dynamodb.AttributeValue, error) {
+	a, err := e.operand(item, x)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := e.operand(item, y)
+	return a, b, err
+}
+
+// Returns the value of an operand, or nil if it refers to a missing attribute.
+func (e *expression) operand(item map[string]*dynamodb.AttributeValue, x interface{}) (*dynamodb.AttributeValue, error) {
+	op, args, err := operation(x)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case opDocumentPath:
+		p, err := path(x)
+		if err != nil {
+			return nil, err
+		}
+		return resolve(item, p), nil
+	case opVariable:
+		id, ok := args[0].(int64)
+		if len(args) != 1 || !ok || id < 0 || id >= int64(len(e.values)) {
+			return nil, invalidExpression()
+		}
+		return e.values[id], nil
+	case opSize:
+		if len(args) != 1 {
+			return nil, invalidExpression()
+		}
+		a, err := e.operand(item, args[0])
+		if err != nil || a == nil {
+			return nil, err
+		}
+		n, ok := size(a)
+		if !ok {
+			return nil, validationError("Invalid ConditionExpression: Incorrect operand type for operator or function; operator or function: size, operand type: %s", typeOf(a))
+		}
+		s := big.NewRat(int64(n), 1).RatString()
+		return &dynamodb.AttributeValue{N: &s}, nil
+	case opIfNotExists:
+		if len(args) != 2 {
+			return nil, invalidExpression()
+		}
+		a, err := e.operand(item, args[0])
+		if err != nil || a != nil {
+			return a, err
+		}
+		return e.operand(item, args[1])
+	case opListAppend:
+		if len(args) != 2 {
+			return nil, invalidExpression()
+		}
+		a, b, err := e.operands(item, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		if a == nil || b == nil || a.L == nil || b.L == nil {
+			return nil, validationError("Invalid UpdateExpression: Incorrect operand type for operator or function; operator or function: list_append")
+		}
+		l := append(append([]*dynamodb.AttributeValue{}, a.L...), b.L...)
+		return &dynamodb.AttributeValue{L: l}, nil
+	case opPlus, opMinus:
+		if len(args) != 2 {
+			return nil, invalidExpression()
+		}
+		a, b, err := e.operands(item, args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		if a == nil || b == nil {
+			return nil, validationError("The provided expression refers to an attribute that does not exist in the item")
+		}
+		x, okx := number(a)
+		y, oky := number(b)
+		if !okx || !oky {
+			return nil, validationError("An operand in the update expression has an incorrect data type")
+		}
+		if op == opMinus {
+			y = new(big.Rat).Neg(y)
+		}
+		s := formatNumber(new(big.Rat).Add(x, y))
+		return &dynamodb.AttributeValue{N: &s}, nil
+	}
+	return nil, invalidExpression()
+}
+
+// Applies the update actions of the expression to item, operands being
+// evaluated on old. Returns the names of the top-level attributes updated.
+func (e *expression) update(old, item map[string]*dynamodb.AttributeValue) ([]string, error) {
+	actions, ok := e.expr.([]interface{})
+	if !ok {
+		return nil, invalidExpression()
+	}
+	var updated []string
+	for _, action := range actions {
+		op, args, err := operation(action)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			return nil, invalidExpression()
+		}
+		p, err := path(args[0])
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, p[0].name)
+		switch op {
+		case opSetAction:
+			if len(args) != 2 {
+				return nil, invalidExpression()
+			}
+			v, err := e.operand(old, args[1])
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, validationError("The provided expression refers to an attribute that does not exist in the item")
+			}
+			if err := setPath(item, p, v); err != nil {
+				return nil, err
+			}
+		case opRemoveAction:
+			removePath(item, p)
+		case opAddAction, opDeleteAction:
+			if len(args) != 2 || len(p) != 1 {
+				return nil, invalidExpression()
+			}
+			v, err := e.operand(old, args[1])
+			if err != nil {
+				return nil, err
+			}
+			var r *dynamodb.AttributeValue
+			if op == opAddAction {
+				r, err = add(item[p[0].name], v)
+			} else {
+				r, err = remove(item[p[0].name], v)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if r == nil {
+				delete(item, p[0].name)
+			} else {
+				item[p[0].name] = r
+			}
+		default:
+			return nil, invalidExpression()
+		}
+	}
+	return updated, nil
+}
+
+// Returns the values of the paths of a projection present in item, by
+// ordinal of their path.
+func (e *expression) project(item map[string]*dynamodb.AttributeValue) (map[int]*dynamodb.AttributeValue, error) {
+	paths, ok := e.expr.([]interface{})
+	if !ok {
+		return nil, invalidExpression()
+	}
+	values := make(map[int]*dynamodb.AttributeValue)
+	for i, x := range paths {
+		p, err := path(x)
+		if err != nil {
+			return nil, err
+		}
+		if v := resolve(item, p); v != nil {
+			values[i] = v
+		}
+	}
+	return values, nil
+}
+
+// Splits an array of the expression into its operator and arguments.
+func operation(x interface{}) (int64, []interface{}, error) {
+	a, ok := x.([]interface{})
+	if !ok || len(a) == 0 {
+		return 0, nil, invalidExpression()
+	}
+	op, ok := a[0].(int64)
+	if !ok {
+		return 0, nil, invalidExpression()
+	}
+	return op, a[1:], nil
+}
+
+func path(x interface{}) ([]pathElement, error) {
+	op, args, err := operation(x)
+	if err != nil {
+		return nil, err
+	}
+	if op != opDocumentPath || len(args) == 0 {
+		return nil, invalidExpression()
+	}
+	p := make([]pathElement, len(args))
+	for i, a := range args {
+		switch v := a.(type) {
+		case string:
+			p[i] = pathElement{name: v}
+		case tagged:
+			index, ok := v.value.(int64)
+			if v.tag != tagDocumentPathOrdinal || !ok || i == 0 {
+				return nil, invalidExpression()
+			}
+			p[i] = pathElement{index: int(index), isIndex: true}
+		default:
+			return nil, invalidExpression()
+		}
+	}
+	if p[0].isIndex {
+		return nil, invalidExpression()
+	}
+	return p, nil
+}
+
+// Returns the value at path p of item, or nil if there is none.
+func resolve(item map[string]*dynamodb.AttributeValue, p []pathElement) *dynamodb.AttributeValue {
+	v := item[p[0].name]
+	for _, el := range p[1:] {
+		switch {
+		case v == nil:
+			return nil
+		case el.isIndex:
+			if v.L == nil || el.index < 0 || el.index >= len(v.L) {
+				return nil
+			}
+			v = v.L[el.index]
+		default:
+			if v.M == nil {
+				return nil
+			}
+			v = v.M[el.name]
+		}
+	}
+	return v
+}
+
+func setPath(item map[string]*dynamodb.AttributeValue, p []pathElement, v *dynamodb.AttributeValue) error {
+	if len(p) == 1 {
+		item[p[0].name] = v
+		return nil
+	}
+	parent := resolve(item, p[:len(p)-1])
+	last := p[len(p)-1]
+	switch {
+	case parent != nil && last.isIndex && parent.L != nil:
+		if last.index < len(parent.L) {
+			parent.L[last.index] = v
+		} else {
+			parent.L = append(parent.L, v)
+		}
+		return nil
+	case parent != nil && !last.isIndex && parent.M != nil:
+		parent.M[last.name] = v
+		return nil
+	}
+	return validationError("The document path provided in the update expression is invalid for update")
+}
+
+func removePath(item map[string]*dynamodb.AttributeValue, p []pathElement) {
+	if len(p) == 1 {
+		delete(item, p[0].name)
+		return
+	}
+	parent := resolve(item, p[:len(p)-1])
+	last := p[len(p)-1]
+	switch {
+	case parent == nil:
+	case last.isIndex && parent.L != nil:
+		if last.index >= 0 && last.index < len(parent.L) {
+			parent.L = append(parent.L[:last.index], parent.L[last.index+1:]...)
+		}
+	case !last.isIndex && parent.M != nil:
+		delete(parent.M, last.name)
+	}
+}
+
+// Adds v to a number, or to a set, returning the new value.
+func add(a, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if a == nil {
+		return v, nil
+	}
+	if a.N != nil && v.N != nil {
+		x, okx := number(a)
+		y, oky := number(v)
+		if okx && oky {
+			s := formatNumber(new(big.Rat).Add(x, y))
+			return &dynamodb.AttributeValue{N: &s}, nil
+		}
+	}
+	if typeOf(a) != typeOf(v) || !isSet(a) {
+		return nil, validationError("An operand in the update expression has an incorrect data type")
+	}
+	r := copyItem(map[string]*dynamodb.AttributeValue{"": a})[""]
+	for _, e := range setElements(v) {
+		if !setContains(r, e) {
+			appendToSet(r, e)
+		}
+	}
+	return r, nil
+}
+
+// Removes the elements of v from a set, returning nil if none is left.
+func remove(a, v *dynamodb.AttributeValue) (*dynamodb.AttributeValue, error) {
+	if a == nil {
+		return nil, nil
+	}
+	if typeOf(a) != typeOf(v) || !isSet(a) {
+		return nil, validationError("An operand in the update expression has an incorrect data type")
+	}
+	r := &dynamodb.AttributeValue{}
+	for _, e := range setElements(a) {
+		if !setContains(v, e) {
+			appendToSet(r, e)
+		}
+	}
+	if typeOf(r) == "" {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func isSet(av *dynamodb.AttributeValue) bool {
+	return av.SS != nil || av.NS != nil || av.BS != nil
+}
+
+// Returns the elements of a set as scalars.
+func setElements(av *dynamodb.AttributeValue) []*dynamodb.AttributeValue {
+	var elems []*dynamodb.AttributeValue
+	for _, s := range av.SS {
+		elems = append(elems, &dynamodb.AttributeValue{S: s})
+	}
+	for _, n := range av.NS {
+		elems = append(elems, &dynamodb.AttributeValue{N: n})
+	}
+	for _, b := range av.BS {
+		elems = append(elems, &dynamodb.AttributeValue{B: b})
+	}
+	return elems
+}
+
+func setContains(set, e *dynamodb.AttributeValue) bool {
+	for _, x := range setElements(set) {
+		if scalarString(x) == scalarString(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func appendToSet(set, e *dynamodb.AttributeValue) {
+	switch {
+	case e.S != nil:
+		set.SS = append(set.SS, e.S)
+	case e.N != nil:
+		set.NS = append(set.NS, e.N)
+	case e.B != nil:
+		set.BS = append(set.BS, e.B)
+	}
+}
+
+// Compares a to b with a comparison operator. Missing values and values of
+// different types are only not equal.
+func compare(op int64, a, b *dynamodb.AttributeValue) bool {
+	if a == nil || b == nil {
+		return op == opNotEqual
+	}
+	switch op {
+	case opEqual:
+		return equal(a, b)
+	case opNotEqual:
+		return !equal(a, b)
+	}
+	t := typeOf(a)
+	if t != typeOf(b) || (t != dynamodb.ScalarAttributeTypeS && t != dynamodb.ScalarAttributeTypeN && t != dynamodb.ScalarAttributeTypeB) {
+		return false
+	}
+	c := compareScalars(a, b)
+	switch op {
+	case opLessThan:
+		return c < 0
+	case opLessEqual:
+		return c <= 0
+	case opGreaterThan:
+		return c > 0
+	case opGreaterEqual:
+		return c >= 0
+	}
+	return false
+}
+
+func equal(a, b *dynamodb.AttributeValue) bool {
+	t := typeOf(a)
+	if t != typeOf(b) {
+		return false
+	}
+	switch {
+	case a.S != nil, a.N != nil, a.B != nil:
+		return scalarString(a) == scalarString(b)
+	case a.BOOL != nil:
+		return *a.BOOL == *b.BOOL
+	case a.NULL != nil:
+		return true
+	case isSet(a):
+		ea, eb := setElements(a), setElements(b)
+		if len(ea) != len(eb) {
+			return false
+		}
+		for _, e := range ea {
+			if !setContains(b, e) {
+				return false
+			}
+		}
+		return true
+	case a.L != nil:
+		if len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equal(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	case a.M != nil:
+		if len(a.M) != len(b.M) {
+			return false
+		}
+		for k, v := range a.M {
+			if w, ok := b.M[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Reports whether a string contains a substring, or a set or a list contains
+// an element.
+func contains(a, b *dynamodb.AttributeValue) bool {
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Contains(*a.S, *b.S)
+	case a.B != nil && b.B != nil:
+		return bytes.Contains(a.B, b.B)
+	case isSet(a):
+		return setContains(a, b)
+	case a.L != nil:
+		for _, e := range a.L {
+			if equal(e, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func size(av *dynamodb.AttributeValue) (int, bool) {
+	switch {
+	case av.S != nil:
+		return len(*av.S), true
+	case av.B != nil:
+		return len(av.B), true
+	case isSet(av):
+		return len(setElements(av)), true
+	case av.L != nil:
+		return len(av.L), true
+	case av.M != nil:
+		return len(av.M), true
+	}
+	return 0, false
+}
+
+func number(av *dynamodb.AttributeValue) (*big.Rat, bool) {
+	if av.N == nil {
+		return nil, false
+	}
+	return parseNumber(*av.N)
+}
+
+func invalidExpression() error {
+	return validationError("Invalid expression: unsupported by the emulator")
+}
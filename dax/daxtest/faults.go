@@ -0,0 +1,79 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax"
+)
+
+// RandomFaults is a dax.FaultInjector failing or delaying attempts at random.
+// Set it as the Config.FaultInjector of a client.
+type RandomFaults struct {
+	// Ops restricts the faults to these operations, such as OpGetItem.
+	// Empty means every operation.
+	Ops []string
+	// ErrorRate is the probability, between 0 and 1, of an attempt to fail
+	// with Err.
+	ErrorRate float64
+	Err       error
+	// DelayRate is the probability, between 0 and 1, of an attempt to be
+	// delayed by Delay.
+	DelayRate float64
+	Delay     time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRandomFaults returns a RandomFaults drawing faults from a source seeded
+// with seed, so that runs with the same seed draw the same faults.
+func NewRandomFaults(seed int64) *RandomFaults {
+	return &RandomFaults{rand: rand.New(rand.NewSource(seed))}
+}
+
+// InjectFault draws the fault of an attempt.
+func (f *RandomFaults) InjectFault(op, node string, attempt int) dax.Fault {
+	if len(f.Ops) > 0 {
+		found := false
+		for _, o := range f.Ops {
+			found = found || o == op
+		}
+		if !found {
+			return dax.Fault{}
+		}
+	}
+	var fault dax.Fault
+	if f.DelayRate > 0 && f.float64() < f.DelayRate {
+		fault.Delay = f.Delay
+	}
+	if f.ErrorRate > 0 && f.float64() < f.ErrorRate {
+		fault.Err = f.Err
+	}
+	return fault
+}
+
+func (f *RandomFaults) float64() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rand == nil {
+		f.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return f.rand.Float64()
+}
@@ -0,0 +1,69 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRandomFaults(t *testing.T) {
+	failure := errors.New("failure")
+	f := NewRandomFaults(1)
+	f.Ops = []string{OpGetItem}
+	f.ErrorRate = 0.25
+	f.Err = failure
+	f.DelayRate = 0.5
+	f.Delay = time.Millisecond
+
+	const n = 10000
+	errs, delays := 0, 0
+	for i := 0; i < n; i++ {
+		fault := f.InjectFault(OpGetItem, "127.0.0.1:8111", 0)
+		if fault.Err != nil {
+			if fault.Err != failure {
+				t.Fatalf("expect %v, got %v", failure, fault.Err)
+			}
+			errs++
+		}
+		if fault.Delay != 0 {
+			if fault.Delay != time.Millisecond {
+				t.Fatalf("expect %v, got %v", time.Millisecond, fault.Delay)
+			}
+			delays++
+		}
+	}
+	if errs < n/5 || errs > n*3/10 {
+		t.Errorf("expect about %d errors, got %d", n/4, errs)
+	}
+	if delays < n*45/100 || delays > n*55/100 {
+		t.Errorf("expect about %d delays, got %d", n/2, delays)
+	}
+
+	for i := 0; i < 100; i++ {
+		if fault := f.InjectFault(OpPutItem, "127.0.0.1:8111", 0); fault.Err != nil || fault.Delay != 0 {
+			t.Fatalf("expect no fault for %s, got %v", OpPutItem, fault)
+		}
+	}
+}
+
+func TestRandomFaults_Zero(t *testing.T) {
+	f := &RandomFaults{ErrorRate: 1, Err: errors.New("failure")}
+	if fault := f.InjectFault(OpQuery, "127.0.0.1:8111", 1); fault.Err == nil {
+		t.Errorf("expect a fault")
+	}
+}
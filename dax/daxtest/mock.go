@@ -0,0 +1,423 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+// Package daxtest provides a mock of the DynamoDB item methods, to unit test
+// code written against dax.DynamoDBAPI without a DAX cluster, and Server, an
+// in-process DAX server to run the DAX client end to end. Recorder and Replayer
+// capture the raw frames exchanged by a client and decode them again, to
+// debug wire-level issues.
+package daxtest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Operation names, as recorded in Call.Operation.
+const (
+	OpGetItem            = "GetItem"
+	OpPutItem            = "PutItem"
+	OpDeleteItem         = "DeleteItem"
+	OpUpdateItem         = "UpdateItem"
+	OpQuery              = "Query"
+	OpScan               = "Scan"
+	OpBatchGetItem       = "BatchGetItem"
+	OpBatchWriteItem     = "BatchWriteItem"
+	OpTransactGetItems   = "TransactGetItems"
+	OpTransactWriteItems = "TransactWriteItems"
+)
+
+// ErrCodeNoResponse is the error code returned by a call for which no
+// response was queued.
+const ErrCodeNoResponse = "NoResponse"
+
+var outputTypes = map[string]reflect.Type{
+	OpGetItem:            reflect.TypeOf((*dynamodb.GetItemOutput)(nil)),
+	OpPutItem:            reflect.TypeOf((*dynamodb.PutItemOutput)(nil)),
+	OpDeleteItem:         reflect.TypeOf((*dynamodb.DeleteItemOutput)(nil)),
+	OpUpdateItem:         reflect.TypeOf((*dynamodb.UpdateItemOutput)(nil)),
+	OpQuery:              reflect.TypeOf((*dynamodb.QueryOutput)(nil)),
+	OpScan:               reflect.TypeOf((*dynamodb.ScanOutput)(nil)),
+	OpBatchGetItem:       reflect.TypeOf((*dynamodb.BatchGetItemOutput)(nil)),
+	OpBatchWriteItem:     reflect.TypeOf((*dynamodb.BatchWriteItemOutput)(nil)),
+	OpTransactGetItems:   reflect.TypeOf((*dynamodb.TransactGetItemsOutput)(nil)),
+	OpTransactWriteItems: reflect.TypeOf((*dynamodb.TransactWriteItemsOutput)(nil)),
+}
+
+var _ dax.DynamoDBAPI = (*Mock)(nil)
+
+// Call is a call received by a Mock.
+type Call struct {
+	Operation string
+	// Input is a copy of the input of the call, such as a *dynamodb.GetItemInput.
+	Input interface{}
+}
+
+type response struct {
+	output interface{}
+	err    error
+}
+
+// Mock implements dax.DynamoDBAPI, answering each call with the next response
+// queued for its operation and recording it. Pages methods call the page
+// method, such as Query for QueryPages, for each page, until a page has no
+// LastEvaluatedKey, or UnprocessedKeys for BatchGetItemPages.
+//
+// The zero value is ready to use. A Mock is safe to use concurrently, responses
+// being consumed in the order calls are received.
+type Mock struct {
+	mu        sync.Mutex
+	responses map[string][]response
+	calls     []Call
+}
+
+// New returns a Mock with no response queued.
+func New() *Mock {
+	return &Mock{}
+}
+
+// AddResponse queues output as a response to the operation op. output must be
+// the output type of op, such as *dynamodb.GetItemOutput for OpGetItem.
+func (m *Mock) AddResponse(op string, output interface{}) {
+	typ, ok := outputTypes[op]
+	if !ok {
+		panic(fmt.Sprintf("daxtest: unknown operation %s", op))
+	}
+	if reflect.TypeOf(output) != typ {
+		panic(fmt.Sprintf("daxtest: %s output must be %v, got %T", op, typ, output))
+	}
+	m.add(op, response{output: output})
+}
+
+// AddError queues err as a response to the operation op.
+func (m *Mock) AddError(op string, err error) {
+	if _, ok := outputTypes[op]; !ok {
+		panic(fmt.Sprintf("daxtest: unknown operation %s", op))
+	}
+	m.add(op, response{err: err})
+}
+
+func (m *Mock) add(op string, r response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.responses == nil {
+		m.responses = make(map[string][]response)
+	}
+	m.responses[op] = append(m.responses[op], r)
+}
+
+// Pending returns the number of responses queued for op not consumed yet.
+func (m *Mock) Pending(op string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.responses[op])
+}
+
+// Calls returns the calls received, in order.
+func (m *Mock) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// Inputs returns the inputs of the calls to op, in order.
+func (m *Mock) Inputs(op string) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var inputs []interface{}
+	for _, c := range m.calls {
+		if c.Operation == op {
+			inputs = append(inputs, c.Input)
+		}
+	}
+	return inputs
+}
+
+// CallCount returns the number of calls to op.
+func (m *Mock) CallCount(op string) int {
+	return len(m.Inputs(op))
+}
+
+// AssertCallCount fails t unless op was called n times.
+func (m *Mock) AssertCallCount(t testing.TB, op string, n int) {
+	t.Helper()
+	if a := m.CallCount(op); a != n {
+		t.Errorf("expect %d %s calls, got %d", n, op, a)
+	}
+}
+
+// AssertInput fails t unless the i-th call to op, counting from 0, had
+// input as input.
+func (m *Mock) AssertInput(t testing.TB, op string, i int, input interface{}) {
+	t.Helper()
+	inputs := m.Inputs(op)
+	if i >= len(inputs) {
+		t.Errorf("expect %s call %d, got %d calls", op, i, len(inputs))
+		return
+	}
+	if !reflect.DeepEqual(input, inputs[i]) {
+		t.Errorf("expect %s call %d input %s, got %s", op, i, awsutil.Prettify(input), awsutil.Prettify(inputs[i]))
+	}
+}
+
+// Records the call and returns its response.
+func (m *Mock) call(ctx aws.Context, op string, input interface{}) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Operation: op, Input: awsutil.CopyOf(input)})
+	if ctx != nil && ctx.Err() != nil {
+		return nil, client.WrapError(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+	queue := m.responses[op]
+	if len(queue) == 0 {
+		return nil, awserr.New(ErrCodeNoResponse, "daxtest: no response queued for "+op, nil)
+	}
+	r := queue[0]
+	m.responses[op] = queue[1:]
+	return r.output, r.err
+}
+
+// GetItem returns the next response queued for GetItem.
+func (m *Mock) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return m.GetItemWithContext(nil, input)
+}
+
+// GetItemWithContext returns the next response queued for GetItem, or a canceled
+// error if ctx is done.
+func (m *Mock) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	output, err := m.call(ctx, OpGetItem, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.GetItemOutput), err
+}
+
+// PutItem returns the next response queued for PutItem.
+func (m *Mock) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return m.PutItemWithContext(nil, input)
+}
+
+// PutItemWithContext returns the next response queued for PutItem, or a canceled
+// error if ctx is done.
+func (m *Mock) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	output, err := m.call(ctx, OpPutItem, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.PutItemOutput), err
+}
+
+// DeleteItem returns the next response queued for DeleteItem.
+func (m *Mock) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return m.DeleteItemWithContext(nil, input)
+}
+
+// DeleteItemWithContext returns the next response queued for DeleteItem, or a canceled
+// error if ctx is done.
+func (m *Mock) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	output, err := m.call(ctx, OpDeleteItem, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.DeleteItemOutput), err
+}
+
+// UpdateItem returns the next response queued for UpdateItem.
+func (m *Mock) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return m.UpdateItemWithContext(nil, input)
+}
+
+// UpdateItemWithContext returns the next response queued for UpdateItem, or a canceled
+// error if ctx is done.
+func (m *Mock) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	output, err := m.call(ctx, OpUpdateItem, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.UpdateItemOutput), err
+}
+
+// Query returns the next response queued for Query.
+func (m *Mock) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	return m.QueryWithContext(nil, input)
+}
+
+// QueryWithContext returns the next response queued for Query, or a canceled
+// error if ctx is done.
+func (m *Mock) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	output, err := m.call(ctx, OpQuery, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.QueryOutput), err
+}
+
+// Scan returns the next response queued for Scan.
+func (m *Mock) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return m.ScanWithContext(nil, input)
+}
+
+// ScanWithContext returns the next response queued for Scan, or a canceled
+// error if ctx is done.
+func (m *Mock) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	output, err := m.call(ctx, OpScan, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.ScanOutput), err
+}
+
+// BatchGetItem returns the next response queued for BatchGetItem.
+func (m *Mock) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	return m.BatchGetItemWithContext(nil, input)
+}
+
+// BatchGetItemWithContext returns the next response queued for BatchGetItem, or a canceled
+// error if ctx is done.
+func (m *Mock) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	output, err := m.call(ctx, OpBatchGetItem, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.BatchGetItemOutput), err
+}
+
+// BatchWriteItem returns the next response queued for BatchWriteItem.
+func (m *Mock) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	return m.BatchWriteItemWithContext(nil, input)
+}
+
+// BatchWriteItemWithContext returns the next response queued for BatchWriteItem, or a canceled
+// error if ctx is done.
+func (m *Mock) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	output, err := m.call(ctx, OpBatchWriteItem, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.BatchWriteItemOutput), err
+}
+
+// TransactGetItems returns the next response queued for TransactGetItems.
+func (m *Mock) TransactGetItems(input *dynamodb.TransactGetItemsInput) (*dynamodb.TransactGetItemsOutput, error) {
+	return m.TransactGetItemsWithContext(nil, input)
+}
+
+// TransactGetItemsWithContext returns the next response queued for TransactGetItems, or a canceled
+// error if ctx is done.
+func (m *Mock) TransactGetItemsWithContext(ctx aws.Context, input *dynamodb.TransactGetItemsInput, opts ...request.Option) (*dynamodb.TransactGetItemsOutput, error) {
+	output, err := m.call(ctx, OpTransactGetItems, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.TransactGetItemsOutput), err
+}
+
+// TransactWriteItems returns the next response queued for TransactWriteItems.
+func (m *Mock) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	return m.TransactWriteItemsWithContext(nil, input)
+}
+
+// TransactWriteItemsWithContext returns the next response queued for TransactWriteItems, or a canceled
+// error if ctx is done.
+func (m *Mock) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	output, err := m.call(ctx, OpTransactWriteItems, input)
+	if output == nil {
+		return nil, err
+	}
+	return output.(*dynamodb.TransactWriteItemsOutput), err
+}
+
+// QueryPages calls Query for each page, until fn returns false.
+func (m *Mock) QueryPages(input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+	return m.QueryPagesWithContext(nil, input, fn)
+}
+
+// QueryPagesWithContext calls QueryWithContext for each page, until fn returns false.
+func (m *Mock) QueryPagesWithContext(ctx aws.Context, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	var in dynamodb.QueryInput
+	if input != nil {
+		in = *input
+	}
+	for {
+		page, err := m.QueryWithContext(ctx, &in, opts...)
+		if err != nil {
+			return err
+		}
+		last := len(page.LastEvaluatedKey) == 0
+		if !fn(page, last) || last {
+			return nil
+		}
+		in.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+}
+
+// ScanPages calls Scan for each page, until fn returns false.
+func (m *Mock) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	return m.ScanPagesWithContext(nil, input, fn)
+}
+
+// ScanPagesWithContext calls ScanWithContext for each page, until fn returns false.
+func (m *Mock) ScanPagesWithContext(ctx aws.Context, input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	var in dynamodb.ScanInput
+	if input != nil {
+		in = *input
+	}
+	for {
+		page, err := m.ScanWithContext(ctx, &in, opts...)
+		if err != nil {
+			return err
+		}
+		last := len(page.LastEvaluatedKey) == 0
+		if !fn(page, last) || last {
+			return nil
+		}
+		in.ExclusiveStartKey = page.LastEvaluatedKey
+	}
+}
+
+// BatchGetItemPages calls BatchGetItem for each page, until fn returns false.
+func (m *Mock) BatchGetItemPages(input *dynamodb.BatchGetItemInput, fn func(*dynamodb.BatchGetItemOutput, bool) bool) error {
+	return m.BatchGetItemPagesWithContext(nil, input, fn)
+}
+
+// BatchGetItemPagesWithContext calls BatchGetItemWithContext for each page,
+// until fn returns false.
+func (m *Mock) BatchGetItemPagesWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, fn func(*dynamodb.BatchGetItemOutput, bool) bool, opts ...request.Option) error {
+	var in dynamodb.BatchGetItemInput
+	if input != nil {
+		in = *input
+	}
+	for {
+		page, err := m.BatchGetItemWithContext(ctx, &in, opts...)
+		if err != nil {
+			return err
+		}
+		last := len(page.UnprocessedKeys) == 0
+		if !fn(page, last) || last {
+			return nil
+		}
+		in.RequestItems = page.UnprocessedKeys
+	}
+}
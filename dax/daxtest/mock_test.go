@@ -0,0 +1,212 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func item(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"key": {S: aws.String(key)}}
+}
+
+func TestMock_Responses(t *testing.T) {
+	m := New()
+	failure := errors.New("failure")
+	m.AddResponse(OpGetItem, &dynamodb.GetItemOutput{Item: item("a")})
+	m.AddError(OpGetItem, failure)
+	m.AddResponse(OpGetItem, &dynamodb.GetItemOutput{Item: item("b")})
+	m.AddResponse(OpPutItem, &dynamodb.PutItemOutput{})
+
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: item("a")}
+	if out, err := m.GetItem(input); err != nil || !reflect.DeepEqual(item("a"), out.Item) {
+		t.Errorf("expect item a, got %v, %v", out, err)
+	}
+	if out, err := m.GetItemWithContext(context.Background(), input); err != failure || out != nil {
+		t.Errorf("expect %v, got %v, %v", failure, out, err)
+	}
+	if _, err := m.PutItem(&dynamodb.PutItemInput{TableName: aws.String("table"), Item: item("c")}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if out, err := m.GetItem(input); err != nil || !reflect.DeepEqual(item("b"), out.Item) {
+		t.Errorf("expect item b, got %v, %v", out, err)
+	}
+	_, err := m.GetItem(input)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNoResponse {
+		t.Errorf("expect %v, got %v", ErrCodeNoResponse, err)
+	}
+
+	m.AssertCallCount(t, OpGetItem, 4)
+	m.AssertCallCount(t, OpPutItem, 1)
+	m.AssertInput(t, OpGetItem, 3, input)
+	var ops []string
+	for _, c := range m.Calls() {
+		ops = append(ops, c.Operation)
+	}
+	if e, a := []string{OpGetItem, OpGetItem, OpPutItem, OpGetItem, OpGetItem}, ops; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 0, m.Pending(OpGetItem); e != a {
+		t.Errorf("expect %v pending, got %v", e, a)
+	}
+}
+
+func TestMock_InputCopied(t *testing.T) {
+	m := New()
+	m.AddResponse(OpUpdateItem, &dynamodb.UpdateItemOutput{})
+	input := &dynamodb.UpdateItemInput{TableName: aws.String("table"), Key: item("a")}
+	m.UpdateItem(input)
+	input.TableName = aws.String("other")
+
+	m.AssertInput(t, OpUpdateItem, 0, &dynamodb.UpdateItemInput{TableName: aws.String("table"), Key: item("a")})
+}
+
+func TestMock_Canceled(t *testing.T) {
+	m := New()
+	m.AddResponse(OpScan, &dynamodb.ScanOutput{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := m.ScanWithContext(ctx, &dynamodb.ScanInput{})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Errorf("expect %v, got %v", request.CanceledErrorCode, err)
+	}
+	if e, a := 1, m.Pending(OpScan); e != a {
+		t.Errorf("expect the response to stay queued, got %v pending", a)
+	}
+}
+
+func TestMock_DeadlineExceeded(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(1, 0))
+	defer cancel()
+
+	_, err := m.GetItemWithContext(ctx, &dynamodb.GetItemInput{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expect an error wrapping %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestMock_WrongOutputType(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expect a panic")
+		}
+	}()
+	New().AddResponse(OpGetItem, &dynamodb.PutItemOutput{})
+}
+
+func TestMock_QueryPages(t *testing.T) {
+	m := New()
+	m.AddResponse(OpQuery, &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{item("a"), item("b")}, LastEvaluatedKey: item("b")})
+	m.AddResponse(OpQuery, &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{item("c")}, LastEvaluatedKey: item("c")})
+	m.AddResponse(OpQuery, &dynamodb.QueryOutput{})
+
+	var items []map[string]*dynamodb.AttributeValue
+	var lasts []bool
+	input := &dynamodb.QueryInput{TableName: aws.String("table")}
+	err := m.QueryPages(input, func(page *dynamodb.QueryOutput, last bool) bool {
+		items = append(items, page.Items...)
+		lasts = append(lasts, last)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := []map[string]*dynamodb.AttributeValue{item("a"), item("b"), item("c")}, items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := []bool{false, false, true}, lasts; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	m.AssertCallCount(t, OpQuery, 3)
+	m.AssertInput(t, OpQuery, 0, input)
+	m.AssertInput(t, OpQuery, 2, &dynamodb.QueryInput{TableName: aws.String("table"), ExclusiveStartKey: item("c")})
+}
+
+func TestMock_ScanPagesError(t *testing.T) {
+	m := New()
+	failure := errors.New("failure")
+	m.AddResponse(OpScan, &dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{item("a")}, LastEvaluatedKey: item("a")})
+	m.AddError(OpScan, failure)
+
+	pages := 0
+	err := m.ScanPages(&dynamodb.ScanInput{}, func(page *dynamodb.ScanOutput, last bool) bool {
+		pages++
+		return true
+	})
+	if err != failure || pages != 1 {
+		t.Errorf("expect %v after 1 page, got %v after %d", failure, err, pages)
+	}
+}
+
+func TestMock_BatchGetItemPages(t *testing.T) {
+	m := New()
+	unprocessed := map[string]*dynamodb.KeysAndAttributes{"table": {Keys: []map[string]*dynamodb.AttributeValue{item("b")}}}
+	m.AddResponse(OpBatchGetItem, &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{"table": {item("a")}},
+		UnprocessedKeys: unprocessed,
+	})
+	m.AddResponse(OpBatchGetItem, &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]*dynamodb.AttributeValue{"table": {item("b")}},
+	})
+
+	pages := 0
+	err := m.BatchGetItemPages(&dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: []map[string]*dynamodb.AttributeValue{item("a"), item("b")}}},
+	}, func(page *dynamodb.BatchGetItemOutput, last bool) bool {
+		pages++
+		return true
+	})
+	if err != nil || pages != 2 {
+		t.Errorf("expect 2 pages, got %d, %v", pages, err)
+	}
+	m.AssertInput(t, OpBatchGetItem, 1, &dynamodb.BatchGetItemInput{RequestItems: unprocessed})
+}
+
+func TestMock_Concurrent(t *testing.T) {
+	m := New()
+	const n = 50
+	for i := 0; i < n; i++ {
+		m.AddResponse(OpDeleteItem, &dynamodb.DeleteItemOutput{})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.DeleteItem(&dynamodb.DeleteItemInput{TableName: aws.String("table"), Key: item("a")}); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			m.CallCount(OpDeleteItem)
+		}()
+	}
+	wg.Wait()
+	m.AssertCallCount(t, OpDeleteItem, n)
+	if e, a := 0, m.Pending(OpDeleteItem); e != a {
+		t.Errorf("expect %v pending, got %v", e, a)
+	}
+}
@@ -0,0 +1,1380 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	magic        = "J7yne5G"
+	daxServiceID = 1
+)
+
+// Methods of the DAX protocol served.
+const (
+	methodAuthorizeConnection   = 1489122155
+	methodDefineAttributeList   = 670678385
+	methodDefineAttributeListID = -1230579644
+	methodDefineKeySchema       = -742646399
+	methodEndpoints             = 455855874
+	methodGetItem               = 263244906
+	methodPutItem               = -2106490455
+	methodDeleteItem            = 1013539361
+	methodUpdateItem            = 1425579023
+	methodQuery                 = -931250863
+	methodScan                  = -1875390620
+)
+
+// Keys of the optional parameters of requests.
+const (
+	paramProjectionExpression = iota
+	paramExpressionAttributeNames
+	paramConsistentRead
+	paramReturnConsumedCapacity
+	paramConditionExpression
+	paramExpressionAttributeValues
+	paramReturnItemCollectionMetrics
+	paramReturnValues
+	paramUpdateExpression
+	paramExclusiveStartKey
+	paramFilterExpression
+	paramIndexName
+	paramKeyConditionExpression
+	paramLimit
+	paramScanIndexForward
+	paramSelect
+	paramSegment
+	paramTotalSegments
+)
+
+const (
+	returnValuesAllOld = 2 + iota
+	returnValuesUpdatedOld
+	returnValuesAllNew
+	returnValuesUpdatedNew
+)
+
+// Values of the Select parameter.
+const (
+	selectAllAttributes = 1 + iota
+	selectAllProjectedAttributes
+	selectCount
+)
+
+// Keys of the responses.
+const (
+	responseItem             = 0
+	responseAttributes       = 2
+	responseItems            = 7
+	responseCount            = 8
+	responseLastEvaluatedKey = 9
+	responseScannedCount     = 10
+)
+
+// Keys of an endpoint.
+const (
+	endpointNodeID = iota
+	endpointHostname
+	endpointAddress
+	endpointPort
+	endpointRole
+	endpointAvailabilityZone
+)
+
+// Server is an in-process DAX server backed by in-memory tables, to run the
+// DAX client end to end over a real socket, such as in integration tests.
+//
+// It implements the DAX protocol for GetItem, PutItem, DeleteItem,
+// UpdateItem, Query and Scan on tables, and Query and Scan on their secondary
+// indexes, with condition, update, filter and projection expressions. It has
+// no caching semantics: every request is served from the tables, and any
+// credentials are accepted. Requests of other operations fail with a
+// ValidationException.
+//
+// Pages of Query and Scan hold up to Limit items and have a LastEvaluatedKey
+// only when items are left. The key condition of a Query is evaluated as a
+// condition on the items of the table or index.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu        sync.Mutex
+	tables    map[string]*table
+	attrLists map[string]int64
+	attrNames map[int64][]string
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// NewServer returns a Server listening on a local port, with no table.
+// The server must be closed with Close when no longer used.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:        ln,
+		tables:    make(map[string]*table),
+		attrLists: make(map[string]int64),
+		attrNames: make(map[int64][]string),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	s.attrListID([]string{}) // the client reserves id 1 for the empty list
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Config returns a DAX configuration connecting to the server.
+func (s *Server) Config() dax.Config {
+	cfg := dax.DefaultConfig()
+	cfg.HostPorts = []string{s.Addr()}
+	cfg.Region = "us-west-2"
+	cfg.Credentials = credentials.NewStaticCredentials("daxtest", "daxtest", "")
+	return cfg
+}
+
+// CreateTable creates the empty table name, whose key is made of the hash
+// key keys[0] and, if any, of the range key keys[1]. An existing table of the
+// same name is replaced, along with its indexes.
+func (s *Server) CreateTable(name string, keys ...dynamodb.AttributeDefinition) error {
+	if err := checkKeys(keys); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tables[name] = newTable(append([]dynamodb.AttributeDefinition{}, keys...))
+	return nil
+}
+
+// CreateGlobalSecondaryIndex adds the global secondary index name to table,
+// keyed by the hash key keys[0] and, if any, by the range key keys[1].
+// The items of the index are the items of the table having these key
+// attributes, with the attributes of projection. A nil projection projects all
+// the attributes. An existing index of the same name is replaced.
+func (s *Server) CreateGlobalSecondaryIndex(table, name string, projection *dynamodb.Projection, keys ...dynamodb.AttributeDefinition) error {
+	if err := checkKeys(keys); err != nil {
+		return err
+	}
+	return s.createIndex(table, name, projection, true, keys)
+}
+
+// CreateLocalSecondaryIndex adds the local secondary index name to table, keyed
+// by the hash key of the table and by rangeKey. Like for the indexes of
+// CreateGlobalSecondaryIndex, a nil projection projects all the attributes.
+// Queries of the index fetch the attributes that are not projected from the
+// table, as DynamoDB does.
+func (s *Server) CreateLocalSecondaryIndex(table, name string, projection *dynamodb.Projection, rangeKey dynamodb.AttributeDefinition) error {
+	if err := checkKeys([]dynamodb.AttributeDefinition{rangeKey}); err != nil {
+		return err
+	}
+	return s.createIndex(table, name, projection, false, []dynamodb.AttributeDefinition{rangeKey})
+}
+
+func (s *Server) createIndex(table, name string, projection *dynamodb.Projection, global bool, keys []dynamodb.AttributeDefinition) error {
+	x := &index{name: name, global: global, projection: dynamodb.ProjectionTypeAll}
+	if projection != nil && projection.ProjectionType != nil {
+		x.projection = *projection.ProjectionType
+	}
+	switch x.projection {
+	case dynamodb.ProjectionTypeAll, dynamodb.ProjectionTypeKeysOnly:
+	case dynamodb.ProjectionTypeInclude:
+		for _, n := range projection.NonKeyAttributes {
+			x.nonKey = append(x.nonKey, aws.StringValue(n))
+		}
+	default:
+		return fmt.Errorf("daxtest: invalid projection type %s", x.projection)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tables[table]
+	if !ok {
+		return fmt.Errorf("daxtest: no table %s", table)
+	}
+	if !global {
+		keys = append([]dynamodb.AttributeDefinition{t.keys[0]}, keys...)
+	}
+	x.keys = append([]dynamodb.AttributeDefinition{}, keys...)
+	t.indexes[name] = x
+	return nil
+}
+
+func checkKeys(keys []dynamodb.AttributeDefinition) error {
+	if len(keys) < 1 || len(keys) > 2 {
+		return fmt.Errorf("daxtest: a key has 1 or 2 attributes, got %d", len(keys))
+	}
+	for _, k := range keys {
+		if k.AttributeName == nil || k.AttributeType == nil {
+			return fmt.Errorf("daxtest: key attributes need a name and a type")
+		}
+		switch *k.AttributeType {
+		case dynamodb.ScalarAttributeTypeS, dynamodb.ScalarAttributeTypeN, dynamodb.ScalarAttributeTypeB:
+		default:
+			return fmt.Errorf("daxtest: invalid key attribute type %s", *k.AttributeType)
+		}
+	}
+	return nil
+}
+
+// Close stops the server, closing the connections of the clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	err := s.ln.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// Serves the requests of a connection until it is closed, or until a request
+// cannot be read.
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := cbor.NewReader(bufio.NewReader(conn))
+	w := cbor.NewWriter(bufio.NewWriter(conn))
+	if err := readHandshake(r); err != nil {
+		return
+	}
+	var body bytes.Buffer
+	for {
+		service, err := r.ReadInt()
+		if err != nil || service != daxServiceID {
+			return
+		}
+		method, err := r.ReadInt()
+		if err != nil {
+			return
+		}
+		if method == methodAuthorizeConnection {
+			// access key, signature, string to sign, session token and user agent
+			if err := skipValues(r, 5); err != nil {
+				return
+			}
+			continue
+		}
+
+		body.Reset()
+		bw := cbor.NewWriter(&body)
+		err = s.handle(method, r, bw)
+		if err == nil {
+			err = bw.Flush()
+		}
+		bw.Close()
+		if err != nil {
+			e, ok := err.(*serverError)
+			if !ok {
+				return
+			}
+			if err := writeError(w, e); err != nil || w.Flush() != nil || e.fatal {
+				return
+			}
+			continue
+		}
+		if err := w.WriteArrayHeader(0); err != nil { // no error
+			return
+		}
+		if err := w.Write(body.Bytes()); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func readHandshake(r *cbor.Reader) error {
+	m, err := r.ReadString()
+	if err != nil {
+		return err
+	}
+	if m != magic {
+		return fmt.Errorf("daxtest: unexpected magic %q", m)
+	}
+	// layering, session, header and client mode
+	return skipValues(r, 4)
+}
+
+// Reads the request of method and writes the body of its response to w.
+// Returns a *serverError if the request failed once read, any other error
+// leaving the connection in an unknown state.
+func (s *Server) handle(method int, r *cbor.Reader, w *cbor.Writer) error {
+	switch method {
+	case methodEndpoints:
+		return s.endpoints(w)
+	case methodDefineAttributeListID:
+		return s.defineAttributeListID(r, w)
+	case methodDefineAttributeList:
+		return s.defineAttributeList(r, w)
+	case methodDefineKeySchema:
+		return s.defineKeySchema(r, w)
+	case methodGetItem:
+		return s.getItem(r, w)
+	case methodPutItem:
+		return s.putItem(r, w)
+	case methodDeleteItem:
+		return s.deleteItem(r, w)
+	case methodUpdateItem:
+		return s.updateItem(r, w)
+	case methodQuery:
+		return s.query(r, w)
+	case methodScan:
+		return s.scan(r, w)
+	}
+	// the rest of the request cannot be read
+	e := validationError("Operation %d is not supported by the emulator", method).(*serverError)
+	e.fatal = true
+	return e
+}
+
+func (s *Server) endpoints(w *cbor.Writer) error {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	if err := w.WriteArrayHeader(1); err != nil {
+		return err
+	}
+	if err := w.WriteMapHeader(6); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, endpointNodeID, func() error { return w.WriteInt(0) }); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, endpointHostname, func() error { return w.WriteString(addr.IP.String()) }); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, endpointAddress, func() error { return w.WriteBytes(addr.IP.To4()) }); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, endpointPort, func() error { return w.WriteInt(addr.Port) }); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, endpointRole, func() error { return w.WriteInt(1) }); err != nil { // leader
+		return err
+	}
+	return writeIntKey(w, endpointAvailabilityZone, func() error { return w.WriteString("local") })
+}
+
+func (s *Server) defineAttributeListID(r *cbor.Reader, w *cbor.Writer) error {
+	n, err := r.ReadArrayLength()
+	if err != nil {
+		return err
+	}
+	names := make([]string, n)
+	for i := range names {
+		if names[i], err = r.ReadString(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return w.WriteInt64(s.attrListID(names))
+}
+
+func (s *Server) defineAttributeList(r *cbor.Reader, w *cbor.Writer) error {
+	id, err := r.ReadInt64()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	names, ok := s.attrNames[id]
+	s.mu.Unlock()
+	if !ok {
+		return validationError("Unknown attribute list id %d", id)
+	}
+	if err := w.WriteArrayHeader(len(names)); err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := w.WriteString(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) defineKeySchema(r *cbor.Reader, w *cbor.Writer) error {
+	name, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(string(name))
+	if err != nil {
+		return err
+	}
+	if err := w.WriteMapHeader(len(t.keys)); err != nil {
+		return err
+	}
+	for _, k := range t.keys {
+		if err := w.WriteString(*k.AttributeName); err != nil {
+			return err
+		}
+		if err := w.WriteString(*k.AttributeType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) getItem(r *cbor.Reader, w *cbor.Writer) error {
+	name, kb, err := readTableKey(r)
+	if err != nil {
+		return err
+	}
+	p, err := readParams(r)
+	if err != nil {
+		return err
+	}
+	projection, err := p.expression(paramProjectionExpression)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, key, err := s.tableKey(name, kb)
+	if err != nil {
+		return err
+	}
+	item := t.items[key]
+	if item == nil {
+		return w.WriteMapHeader(0)
+	}
+	if err := w.WriteMapHeader(1); err != nil {
+		return err
+	}
+	if err := w.WriteInt(responseItem); err != nil {
+		return err
+	}
+	if projection != nil {
+		return writeProjection(w, projection, item)
+	}
+	return s.writeAttributes(w, t, item)
+}
+
+func (s *Server) putItem(r *cbor.Reader, w *cbor.Writer) error {
+	name, kb, err := readTableKey(r)
+	if err != nil {
+		return err
+	}
+	ab, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	p, err := readParams(r)
+	if err != nil {
+		return err
+	}
+	condition, err := p.expression(paramConditionExpression)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, key, err := s.tableKey(name, kb)
+	if err != nil {
+		return err
+	}
+	item, err := s.decodeAttributes(ab)
+	if err != nil {
+		return err
+	}
+	for k, v := range decodeKey(t, kb) {
+		item[k] = v
+	}
+	old := t.items[key]
+	if ok, err := condition.condition(old); err != nil {
+		return err
+	} else if !ok {
+		return conditionalCheckFailed()
+	}
+	t.items[key] = item
+	if rv, _ := p.int(paramReturnValues); rv == returnValuesAllOld && old != nil {
+		return s.writeResponseAttributes(w, t, old)
+	}
+	return w.WriteMapHeader(0)
+}
+
+func (s *Server) deleteItem(r *cbor.Reader, w *cbor.Writer) error {
+	name, kb, err := readTableKey(r)
+	if err != nil {
+		return err
+	}
+	p, err := readParams(r)
+	if err != nil {
+		return err
+	}
+	condition, err := p.expression(paramConditionExpression)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, key, err := s.tableKey(name, kb)
+	if err != nil {
+		return err
+	}
+	old := t.items[key]
+	if ok, err := condition.condition(old); err != nil {
+		return err
+	} else if !ok {
+		return conditionalCheckFailed()
+	}
+	delete(t.items, key)
+	if rv, _ := p.int(paramReturnValues); rv == returnValuesAllOld && old != nil {
+		return s.writeResponseAttributes(w, t, old)
+	}
+	return w.WriteMapHeader(0)
+}
+
+func (s *Server) updateItem(r *cbor.Reader, w *cbor.Writer) error {
+	name, kb, err := readTableKey(r)
+	if err != nil {
+		return err
+	}
+	p, err := readParams(r)
+	if err != nil {
+		return err
+	}
+	condition, err := p.expression(paramConditionExpression)
+	if err != nil {
+		return err
+	}
+	update, err := p.expression(paramUpdateExpression)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, key, err := s.tableKey(name, kb)
+	if err != nil {
+		return err
+	}
+	old := t.items[key]
+	if ok, err := condition.condition(old); err != nil {
+		return err
+	} else if !ok {
+		return conditionalCheckFailed()
+	}
+	item := copyItem(old)
+	if item == nil {
+		item = decodeKey(t, kb)
+	}
+	var updated []string
+	if update != nil {
+		if updated, err = update.update(old, item); err != nil {
+			return err
+		}
+	}
+	for _, n := range updated {
+		if t.isKey(n) {
+			return validationError("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", n)
+		}
+	}
+	t.items[key] = item
+
+	rv, _ := p.int(paramReturnValues)
+	switch {
+	case rv == returnValuesAllOld && old != nil:
+		return s.writeResponseAttributes(w, t, old)
+	case rv == returnValuesAllNew:
+		return s.writeResponseAttributes(w, t, item)
+	case rv == returnValuesUpdatedOld && old != nil, rv == returnValuesUpdatedNew:
+		values := item
+		if rv == returnValuesUpdatedOld {
+			values = old
+		}
+		return s.writeUpdatedAttributes(w, values, updated)
+	}
+	return w.WriteMapHeader(0)
+}
+
+func (s *Server) query(r *cbor.Reader, w *cbor.Writer) error {
+	name, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	kc, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	p, err := readParams(r)
+	if err != nil {
+		return err
+	}
+	keyCondition, err := decodeExpression(kc)
+	if err != nil {
+		return validationError("Invalid KeyConditionExpression: %v", err)
+	}
+	return s.scanQuery(string(name), keyCondition, p, w)
+}
+
+func (s *Server) scan(r *cbor.Reader, w *cbor.Writer) error {
+	name, err := r.ReadBytes()
+	if err != nil {
+		return err
+	}
+	p, err := readParams(r)
+	if err != nil {
+		return err
+	}
+	return s.scanQuery(string(name), nil, p, w)
+}
+
+// Serves a Query if keyCondition is set, a Scan otherwise.
+func (s *Server) scanQuery(name string, keyCondition *expression, p params, w *cbor.Writer) error {
+	filter, err := p.expression(paramFilterExpression)
+	if err != nil {
+		return err
+	}
+	projection, err := p.expression(paramProjectionExpression)
+	if err != nil {
+		return err
+	}
+	limit, _ := p.int(paramLimit)
+	sel, _ := p.int(paramSelect)
+	forward := true
+	if f, ok := p.int(paramScanIndexForward); ok {
+		forward = f != 0
+	}
+	segment, _ := p.int(paramSegment)
+	total, segmented := p.int(paramTotalSegments)
+	if segmented && (total <= 0 || segment < 0 || segment >= total) {
+		return validationError("The Segment parameter must be less than TotalSegments")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.table(name)
+	if err != nil {
+		return err
+	}
+	var x *index
+	if n, ok := p[paramIndexName].([]byte); ok {
+		if x, ok = t.indexes[string(n)]; !ok {
+			return validationError("The table does not have the specified index: %s", n)
+		}
+	}
+	if err := checkIndexParams(x, sel, p); err != nil {
+		return err
+	}
+	if sel == 0 && projection == nil && x != nil {
+		sel = selectAllProjectedAttributes
+	}
+	// the attributes of the items seen by the filter and returned; local
+	// indexes fetch from the table the attributes not projected
+	fetch := x == nil || !x.global
+	view := func(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+		if x != nil && x.global {
+			return x.project(t, item)
+		}
+		return item
+	}
+	returned := func(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+		if fetch && sel == selectAllProjectedAttributes {
+			return x.project(t, item)
+		}
+		return view(item)
+	}
+
+	var start map[string]*dynamodb.AttributeValue
+	if kb, ok := p[paramExclusiveStartKey].([]byte); ok {
+		if x == nil {
+			start, err = decodeItemKey(t, kb)
+		} else {
+			start, err = decodeCompoundKey(t, x, kb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var candidates []map[string]*dynamodb.AttributeValue
+	for _, item := range t.indexed(x) {
+		if segmented && t.segment(item, total) != segment {
+			continue
+		}
+		if ok, err := keyCondition.condition(item); err != nil {
+			return err
+		} else if ok {
+			candidates = append(candidates, item)
+		}
+	}
+	if !forward {
+		for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		}
+	}
+	if start != nil {
+		i := 0
+		for ; i < len(candidates); i++ {
+			c := t.compareIn(x, candidates[i], start)
+			if (forward && c > 0) || (!forward && c < 0) {
+				break
+			}
+		}
+		candidates = candidates[i:]
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	var last map[string]*dynamodb.AttributeValue
+	scanned := 0
+	for i, item := range candidates {
+		if limit > 0 && int64(scanned) == limit {
+			last = candidates[i-1]
+			break
+		}
+		scanned++
+		if ok, err := filter.condition(view(item)); err != nil {
+			return err
+		} else if ok {
+			items = append(items, returned(item))
+		}
+	}
+
+	entries := 3
+	if sel == selectCount {
+		entries--
+	}
+	if last != nil {
+		entries++
+	}
+	if err := w.WriteMapHeader(entries); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, responseCount, func() error { return w.WriteInt(len(items)) }); err != nil {
+		return err
+	}
+	if err := writeIntKey(w, responseScannedCount, func() error { return w.WriteInt(scanned) }); err != nil {
+		return err
+	}
+	if sel != selectCount {
+		err := writeIntKey(w, responseItems, func() error {
+			if err := w.WriteArrayHeader(len(items)); err != nil {
+				return err
+			}
+			for _, item := range items {
+				if err := s.writeItem(w, t, projection, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if last != nil {
+		return writeIntKey(w, responseLastEvaluatedKey, func() error {
+			if x == nil {
+				return writeKey(w, t, last)
+			}
+			return writeCompoundKey(w, t, x, last)
+		})
+	}
+	return nil
+}
+
+// Returns the ValidationException of DynamoDB for the parameters of a Query or
+// Scan of x, or of the table if x is nil, that the index does not support.
+func checkIndexParams(x *index, sel int64, p params) error {
+	if x == nil {
+		if sel == selectAllProjectedAttributes {
+			return validationError("One or more parameter values were invalid: Select type ALL_PROJECTED_ATTRIBUTES is supported only for index queries or scans")
+		}
+		return nil
+	}
+	if !x.global {
+		return nil
+	}
+	if cr, _ := p.int(paramConsistentRead); cr != 0 {
+		return validationError("Consistent reads are not supported on global secondary indexes")
+	}
+	if sel == selectAllAttributes && x.projection != dynamodb.ProjectionTypeAll {
+		return validationError("One or more parameter values were invalid: Select type ALL_ATTRIBUTES is not supported for global secondary index %s because its projection type is not ALL", x.name)
+	}
+	return nil
+}
+
+// Returns the table name, or a ResourceNotFoundException.
+func (s *Server) table(name string) (*table, error) {
+	t, ok := s.tables[name]
+	if !ok {
+		return nil, resourceNotFound()
+	}
+	return t, nil
+}
+
+// Returns the table name and the key of the item of key bytes kb.
+func (s *Server) tableKey(name string, kb []byte) (*table, string, error) {
+	t, err := s.table(name)
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := decodeItemKey(t, kb)
+	if err != nil {
+		return nil, "", err
+	}
+	k, ok := t.keyOf(key)
+	if !ok {
+		return nil, "", validationError("The provided key element does not match the schema")
+	}
+	return t, k, nil
+}
+
+// Returns the id of a list of attribute names, defining it if needed.
+func (s *Server) attrListID(names []string) int64 {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+	k := strings.Join(quoted, ",")
+	if id, ok := s.attrLists[k]; ok {
+		return id
+	}
+	id := int64(len(s.attrLists) + 1)
+	s.attrLists[k] = id
+	s.attrNames[id] = names
+	return id
+}
+
+// Decodes the non-key attributes of an item: the id of their sorted names,
+// followed by their values.
+func (s *Server) decodeAttributes(b []byte) (map[string]*dynamodb.AttributeValue, error) {
+	r := cbor.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	id, err := r.ReadInt64()
+	if err != nil {
+		return nil, validationError("Invalid item: %v", err)
+	}
+	names, ok := s.attrNames[id]
+	if !ok {
+		return nil, validationError("Unknown attribute list id %d", id)
+	}
+	item := make(map[string]*dynamodb.AttributeValue, len(names))
+	for _, n := range names {
+		if item[n], err = cbor.DecodeAttributeValue(r); err != nil {
+			return nil, validationError("Invalid item: %v", err)
+		}
+	}
+	return item, nil
+}
+
+// Writes an item of a Query or Scan: its projection, or its key followed by
+// its non-key attributes.
+func (s *Server) writeItem(w *cbor.Writer, t *table, projection *expression, item map[string]*dynamodb.AttributeValue) error {
+	if projection != nil {
+		return writeProjection(w, projection, item)
+	}
+	if err := w.WriteArrayHeader(2); err != nil {
+		return err
+	}
+	if err := writeKey(w, t, item); err != nil {
+		return err
+	}
+	return s.writeAttributes(w, t, item)
+}
+
+// Writes the non-key attributes of item, which the client completes with the
+// key of the request.
+func (s *Server) writeAttributes(w *cbor.Writer, t *table, item map[string]*dynamodb.AttributeValue) error {
+	names := make([]string, 0, len(item))
+	for n := range item {
+		if !t.isKey(n) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	aw := cbor.NewWriter(&buf)
+	defer aw.Close()
+	if err := aw.WriteInt64(s.attrListID(names)); err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := cbor.EncodeAttributeValue(item[n], aw); err != nil {
+			return err
+		}
+	}
+	if err := aw.Flush(); err != nil {
+		return err
+	}
+	return w.WriteBytes(buf.Bytes())
+}
+
+func (s *Server) writeResponseAttributes(w *cbor.Writer, t *table, item map[string]*dynamodb.AttributeValue) error {
+	if err := w.WriteMapHeader(1); err != nil {
+		return err
+	}
+	if err := w.WriteInt(responseAttributes); err != nil {
+		return err
+	}
+	return s.writeAttributes(w, t, item)
+}
+
+// Writes the attributes of item named names: the id of their names, followed by
+// their values by ordinal of their name.
+func (s *Server) writeUpdatedAttributes(w *cbor.Writer, item map[string]*dynamodb.AttributeValue, names []string) error {
+	present := make([]string, 0, len(names))
+	for _, n := range names {
+		if item[n] != nil {
+			present = append(present, n)
+		}
+	}
+	sort.Strings(present)
+	for i := len(present) - 1; i > 0; i-- {
+		if present[i] == present[i-1] {
+			present = append(present[:i], present[i+1:]...)
+		}
+	}
+	if len(present) == 0 {
+		return w.WriteMapHeader(0)
+	}
+
+	var buf bytes.Buffer
+	aw := cbor.NewWriter(&buf)
+	defer aw.Close()
+	if err := aw.WriteInt64(s.attrListID(present)); err != nil {
+		return err
+	}
+	if err := aw.WriteMapHeader(len(present)); err != nil {
+		return err
+	}
+	for i, n := range present {
+		if err := aw.WriteInt(i); err != nil {
+			return err
+		}
+		if err := cbor.EncodeAttributeValue(item[n], aw); err != nil {
+			return err
+		}
+	}
+	if err := aw.Flush(); err != nil {
+		return err
+	}
+	if err := w.WriteMapHeader(1); err != nil {
+		return err
+	}
+	if err := w.WriteInt(responseAttributes); err != nil {
+		return err
+	}
+	return w.WriteBytes(buf.Bytes())
+}
+
+// Writes the values of the paths of projection in item, by ordinal of their path.
+func writeProjection(w *cbor.Writer, projection *expression, item map[string]*dynamodb.AttributeValue) error {
+	values, err := projection.project(item)
+	if err != nil {
+		return err
+	}
+	ords := make([]int, 0, len(values))
+	for o := range values {
+		ords = append(ords, o)
+	}
+	sort.Ints(ords)
+	if err := w.WriteMapHeader(len(ords)); err != nil {
+		return err
+	}
+	for _, o := range ords {
+		if err := w.WriteInt(o); err != nil {
+			return err
+		}
+		if err := cbor.EncodeAttributeValue(values[o], w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKey(w *cbor.Writer, t *table, item map[string]*dynamodb.AttributeValue) error {
+	kb, err := cbor.GetEncodedItemKey(item, t.keys)
+	if err != nil {
+		return err
+	}
+	return w.WriteBytes(kb)
+}
+
+func writeIntKey(w *cbor.Writer, key int, value func() error) error {
+	if err := w.WriteInt(key); err != nil {
+		return err
+	}
+	return value()
+}
+
+func readTableKey(r *cbor.Reader) (string, []byte, error) {
+	name, err := r.ReadBytes()
+	if err != nil {
+		return "", nil, err
+	}
+	kb, err := r.ReadBytes()
+	if err != nil {
+		return "", nil, err
+	}
+	return string(name), kb, nil
+}
+
+// Decodes the key bytes kb of an item of t.
+func decodeItemKey(t *table, kb []byte) (map[string]*dynamodb.AttributeValue, error) {
+	var buf bytes.Buffer
+	bw := cbor.NewWriter(&buf)
+	err := bw.WriteBytes(kb)
+	if err == nil {
+		err = bw.Flush()
+	}
+	bw.Close()
+	if err != nil {
+		return nil, err
+	}
+	r := cbor.NewReader(&buf)
+	defer r.Close()
+	key, err := cbor.DecodeItemKey(r, t.keys)
+	if err != nil {
+		return nil, validationError("The provided key element does not match the schema")
+	}
+	return key, nil
+}
+
+// Like decodeItemKey, for keys already validated.
+func decodeKey(t *table, kb []byte) map[string]*dynamodb.AttributeValue {
+	key, _ := decodeItemKey(t, kb)
+	return key
+}
+
+// Decodes the start key kb of a Query or Scan of x: the attributes of the keys
+// of the table and of the index.
+func decodeCompoundKey(t *table, x *index, kb []byte) (map[string]*dynamodb.AttributeValue, error) {
+	invalid := validationError("The provided starting key is invalid")
+	r := cbor.NewReader(bytes.NewReader(kb))
+	defer r.Close()
+	if hdr, err := r.PeekHeader(); err != nil || hdr != cbor.MapStream {
+		return nil, invalid
+	}
+	if _, err := r.ReadMapLength(); err != nil {
+		return nil, invalid
+	}
+	key := make(map[string]*dynamodb.AttributeValue)
+	for {
+		if end, err := readBreak(r); err != nil {
+			return nil, invalid
+		} else if end {
+			break
+		}
+		n, err := r.ReadString()
+		if err != nil {
+			return nil, invalid
+		}
+		if key[n], err = cbor.DecodeAttributeValue(r); err != nil {
+			return nil, invalid
+		}
+	}
+	if _, ok := t.keyOf(key); !ok || !x.contains(key) || len(key) != len(compoundKey(t, x, key)) {
+		return nil, invalid
+	}
+	return key, nil
+}
+
+// Returns the attributes of the keys of the table and of x in item.
+func compoundKey(t *table, x *index, item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	key := t.key(item)
+	for _, k := range x.keys {
+		key[*k.AttributeName] = item[*k.AttributeName]
+	}
+	return key
+}
+
+// Writes the LastEvaluatedKey of a Query or Scan of x ending with item.
+func writeCompoundKey(w *cbor.Writer, t *table, x *index, item map[string]*dynamodb.AttributeValue) error {
+	key := compoundKey(t, x, item)
+	names := make([]string, 0, len(key))
+	for n := range key {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	kw := cbor.NewWriter(&buf)
+	defer kw.Close()
+	if err := kw.WriteMapStreamHeader(); err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := kw.WriteString(n); err != nil {
+			return err
+		}
+		if err := cbor.EncodeAttributeValue(key[n], kw); err != nil {
+			return err
+		}
+	}
+	if err := kw.WriteStreamBreak(); err != nil {
+		return err
+	}
+	if err := kw.Flush(); err != nil {
+		return err
+	}
+	return w.WriteBytes(buf.Bytes())
+}
+
+// The optional parameters of a request.
+type params map[int]interface{}
+
+func readParams(r *cbor.Reader) (params, error) {
+	v, err := readValue(r)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("daxtest: expected a map of parameters, got %T", v)
+	}
+	p := make(params, len(m))
+	for k, v := range m {
+		i, ok := k.(int64)
+		if !ok {
+			return nil, fmt.Errorf("daxtest: expected an integer parameter key, got %T", k)
+		}
+		p[int(i)] = v
+	}
+	return p, nil
+}
+
+func (p params) int(key int) (int64, bool) {
+	v, ok := p[key].(int64)
+	return v, ok
+}
+
+// Returns the expression of key, or nil if there is none.
+func (p params) expression(key int) (*expression, error) {
+	b, ok := p[key].([]byte)
+	if !ok {
+		return nil, nil
+	}
+	e, err := decodeExpression(b)
+	if err != nil {
+		return nil, validationError("Invalid expression: %v", err)
+	}
+	return e, nil
+}
+
+// A tagged value.
+type tagged struct {
+	tag   uint64
+	value interface{}
+}
+
+// Reads any value: an int64, a []byte, a string, a []interface{}, a
+// map[interface{}]interface{}, a tagged value, a bool, a float64 or nil.
+func readValue(r *cbor.Reader) (interface{}, error) {
+	hdr, err := r.PeekHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch hdr & cbor.MajorTypeMask {
+	case cbor.PosInt, cbor.NegInt:
+		return r.ReadInt64()
+	case cbor.Bytes:
+		return r.ReadBytes()
+	case cbor.Utf:
+		return r.ReadString()
+	case cbor.Array:
+		n, err := r.ReadArrayLength()
+		if err != nil {
+			return nil, err
+		}
+		a := []interface{}{}
+		for i := 0; hdr == cbor.ArrayStream || i < n; i++ {
+			if hdr == cbor.ArrayStream {
+				if end, err := readBreak(r); err != nil || end {
+					return a, err
+				}
+			}
+			v, err := readValue(r)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case cbor.Map:
+		n, err := r.ReadMapLength()
+		if err != nil {
+			return nil, err
+		}
+		m := map[interface{}]interface{}{}
+		for i := 0; hdr == cbor.MapStream || i < n; i++ {
+			if hdr == cbor.MapStream {
+				if end, err := readBreak(r); err != nil || end {
+					return m, err
+				}
+			}
+			k, err := readValue(r)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := k.([]byte); ok {
+				k = string(b)
+			}
+			v, err := readValue(r)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case cbor.Tag:
+		tag, err := r.ReadTag()
+		if err != nil {
+			return nil, err
+		}
+		v, err := readValue(r)
+		if err != nil {
+			return nil, err
+		}
+		return tagged{tag: tag, value: v}, nil
+	}
+	switch hdr {
+	case cbor.False, cbor.True, cbor.Nil, cbor.Undefined:
+		if err := r.ReadNil(); err != nil {
+			return nil, err
+		}
+		if hdr == cbor.False || hdr == cbor.True {
+			return hdr == cbor.True, nil
+		}
+		return nil, nil
+	case cbor.Float16, cbor.Float32, cbor.Float64:
+		return r.ReadFloat64()
+	}
+	return nil, fmt.Errorf("daxtest: unexpected cbor header %#x", hdr)
+}
+
+func readBreak(r *cbor.Reader) (bool, error) {
+	hdr, err := r.PeekHeader()
+	if err != nil || hdr != cbor.Break {
+		return false, err
+	}
+	return true, r.ReadBreak()
+}
+
+func skipValues(r *cbor.Reader, n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := readValue(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// An error returned to the client, whose codes make the client convert it to
+// the error of the same name of the DynamoDB API.
+type serverError struct {
+	codes   []int
+	code    string
+	message string
+	fatal   bool // the connection is closed once the error is sent
+}
+
+func (e *serverError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &serverError{codes: []int{4, 37, 38, 39, 46}, code: "ValidationException", message: fmt.Sprintf(format, args...)}
+}
+
+func resourceNotFound() error {
+	return &serverError{codes: []int{4, 37, 38, 39, 41}, code: dynamodb.ErrCodeResourceNotFoundException, message: "Requested resource not found"}
+}
+
+func conditionalCheckFailed() error {
+	return &serverError{codes: []int{4, 37, 38, 39, 43}, code: dynamodb.ErrCodeConditionalCheckFailedException, message: "The conditional request failed"}
+}
+
+func writeError(w *cbor.Writer, e *serverError) error {
+	if err := w.WriteArrayHeader(len(e.codes)); err != nil {
+		return err
+	}
+	for _, c := range e.codes {
+		if err := w.WriteInt(c); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteString(e.message); err != nil {
+		return err
+	}
+	// request id, error code and status code
+	if err := w.WriteArrayHeader(3); err != nil {
+		return err
+	}
+	if err := w.WriteNull(); err != nil {
+		return err
+	}
+	if err := w.WriteString(e.code); err != nil {
+		return err
+	}
+	return w.WriteInt(400)
+}
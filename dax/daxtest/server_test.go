@@ -0,0 +1,520 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returns a client of a server with the table "orders", keyed by the string
+// "customer" and the number "id".
+func startServer(t *testing.T) (*Server, *dax.Dax) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateTable("orders",
+		dynamodb.AttributeDefinition{AttributeName: aws.String("customer"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := dax.New(s.Config())
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func stopServer(s *Server, client *dax.Dax) {
+	client.Close()
+	s.Close()
+}
+
+func order(customer string, id int, attrs ...string) map[string]*dynamodb.AttributeValue {
+	item := map[string]*dynamodb.AttributeValue{
+		"customer": {S: aws.String(customer)},
+		"id":       {N: aws.String(fmt.Sprint(id))},
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		item[attrs[i]] = &dynamodb.AttributeValue{S: aws.String(attrs[i+1])}
+	}
+	return item
+}
+
+func orderKey(customer string, id int) map[string]*dynamodb.AttributeValue {
+	return order(customer, id)
+}
+
+func TestServer_CRUD(t *testing.T) {
+	s, client := startServer(t)
+	defer stopServer(s, client)
+
+	item := order("alice", 1, "status", "new")
+	item["total"] = &dynamodb.AttributeValue{N: aws.String("12")}
+	item["tags"] = &dynamodb.AttributeValue{SS: []*string{aws.String("gift")}}
+	item["lines"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{
+		{M: map[string]*dynamodb.AttributeValue{"sku": {S: aws.String("a")}}},
+	}}
+	if _, err := client.PutItem(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: item}); err != nil {
+		t.Fatal(err)
+	}
+
+	get, err := client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: orderKey("alice", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(item, get.Item) {
+		t.Errorf("expect %v, got %v", item, get.Item)
+	}
+
+	get, err = client.GetItem(&dynamodb.GetItemInput{
+		TableName:                aws.String("orders"),
+		Key:                      orderKey("alice", 1),
+		ProjectionExpression:     aws.String("#s, lines[0].sku"),
+		ExpressionAttributeNames: map[string]*string{"#s": aws.String("status")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projected := map[string]*dynamodb.AttributeValue{
+		"status": {S: aws.String("new")},
+		"lines": {L: []*dynamodb.AttributeValue{
+			{M: map[string]*dynamodb.AttributeValue{"sku": {S: aws.String("a")}}},
+		}},
+	}
+	if !reflect.DeepEqual(projected, get.Item) {
+		t.Errorf("expect %v, got %v", projected, get.Item)
+	}
+
+	update, err := client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String("orders"),
+		Key:                      orderKey("alice", 1),
+		UpdateExpression:         aws.String("SET #s = :s, total = total + :n REMOVE lines ADD tags :t"),
+		ConditionExpression:      aws.String("#s = :new"),
+		ExpressionAttributeNames: map[string]*string{"#s": aws.String("status")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":s":   {S: aws.String("paid")},
+			":new": {S: aws.String("new")},
+			":n":   {N: aws.String("3")},
+			":t":   {SS: []*string{aws.String("express")}},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := order("alice", 1, "status", "paid")
+	updated["total"] = &dynamodb.AttributeValue{N: aws.String("15")}
+	updated["tags"] = &dynamodb.AttributeValue{SS: []*string{aws.String("gift"), aws.String("express")}}
+	if !reflect.DeepEqual(updated, update.Attributes) {
+		t.Errorf("expect %v, got %v", updated, update.Attributes)
+	}
+
+	update, err = client.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String("orders"),
+		Key:                       orderKey("alice", 1),
+		UpdateExpression:          aws.String("SET note = :n"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":n": {S: aws.String("fragile")}},
+		ReturnValues:              aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := map[string]*dynamodb.AttributeValue{"note": {S: aws.String("fragile")}}
+	if !reflect.DeepEqual(note, update.Attributes) {
+		t.Errorf("expect %v, got %v", note, update.Attributes)
+	}
+	updated["note"] = note["note"]
+
+	del, err := client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:    aws.String("orders"),
+		Key:          orderKey("alice", 1),
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(updated, del.Attributes) {
+		t.Errorf("expect %v, got %v", updated, del.Attributes)
+	}
+
+	get, err = client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: orderKey("alice", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.Item != nil {
+		t.Errorf("expect no item, got %v", get.Item)
+	}
+}
+
+func TestServer_Pagination(t *testing.T) {
+	s, client := startServer(t)
+	defer stopServer(s, client)
+
+	for i := 0; i < 10; i++ {
+		status := "new"
+		if i%2 == 1 {
+			status = "paid"
+		}
+		for _, customer := range []string{"alice", "bob"} {
+			if _, err := client.PutItem(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: order(customer, i, "status", status)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cases := []struct {
+		name    string
+		input   *dynamodb.QueryInput
+		pages   int
+		ids     []int
+		scanned int64
+	}{
+		{
+			name: "all",
+			input: &dynamodb.QueryInput{
+				KeyConditionExpression:    aws.String("customer = :c"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}},
+				Limit:                     aws.Int64(3),
+			},
+			pages:   4,
+			ids:     []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+			scanned: 10,
+		},
+		{
+			name: "range backward",
+			input: &dynamodb.QueryInput{
+				KeyConditionExpression: aws.String("customer = :c AND id BETWEEN :lo AND :hi"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":c":  {S: aws.String("bob")},
+					":lo": {N: aws.String("2")},
+					":hi": {N: aws.String("6")},
+				},
+				ScanIndexForward: aws.Bool(false),
+				Limit:            aws.Int64(2),
+			},
+			pages:   3,
+			ids:     []int{6, 5, 4, 3, 2},
+			scanned: 5,
+		},
+		{
+			name: "latest first",
+			input: &dynamodb.QueryInput{
+				KeyConditionExpression:    aws.String("customer = :c"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}},
+				ScanIndexForward:          aws.Bool(false),
+				Limit:                     aws.Int64(3),
+			},
+			pages:   4,
+			ids:     []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+			scanned: 10,
+		},
+		{
+			name: "filter",
+			input: &dynamodb.QueryInput{
+				KeyConditionExpression:    aws.String("customer = :c"),
+				FilterExpression:          aws.String("#s = :s"),
+				ExpressionAttributeNames:  map[string]*string{"#s": aws.String("status")},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}, ":s": {S: aws.String("paid")}},
+				Limit:                     aws.Int64(4),
+			},
+			pages:   3,
+			ids:     []int{1, 3, 5, 7, 9},
+			scanned: 10,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.input.TableName = aws.String("orders")
+			var pages int
+			var ids []int
+			var scanned int64
+			err := client.QueryPages(c.input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+				pages++
+				scanned += aws.Int64Value(page.ScannedCount)
+				for _, item := range page.Items {
+					var id int
+					fmt.Sscan(aws.StringValue(item["id"].N), &id)
+					ids = append(ids, id)
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages != c.pages || scanned != c.scanned || !reflect.DeepEqual(c.ids, ids) {
+				t.Errorf("expect %d pages, %d scanned, ids %v, got %d, %d, %v", c.pages, c.scanned, c.ids, pages, scanned, ids)
+			}
+		})
+	}
+
+	items, err := client.ScanAll(nil, &dynamodb.ScanInput{TableName: aws.String("orders"), Limit: aws.Int64(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 20 {
+		t.Errorf("expect 20 items, got %d", len(items))
+	}
+
+	var segmented int
+	for segment := int64(0); segment < 3; segment++ {
+		err := client.ScanPages(&dynamodb.ScanInput{
+			TableName:     aws.String("orders"),
+			Segment:       aws.Int64(segment),
+			TotalSegments: aws.Int64(3),
+			Limit:         aws.Int64(4),
+		}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			segmented += len(page.Items)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if segmented != 20 {
+		t.Errorf("expect 20 items over the segments, got %d", segmented)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	s, client := startServer(t)
+	defer stopServer(s, client)
+
+	if _, err := client.PutItem(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: order("alice", 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		call func() error
+		code string
+	}{
+		{
+			name: "condition",
+			call: func() error {
+				_, err := client.PutItem(&dynamodb.PutItemInput{
+					TableName:           aws.String("orders"),
+					Item:                order("alice", 1),
+					ConditionExpression: aws.String("attribute_not_exists(customer)"),
+				})
+				return err
+			},
+			code: dynamodb.ErrCodeConditionalCheckFailedException,
+		},
+		{
+			name: "key update",
+			call: func() error {
+				_, err := client.UpdateItem(&dynamodb.UpdateItemInput{
+					TableName:                 aws.String("orders"),
+					Key:                       orderKey("alice", 1),
+					UpdateExpression:          aws.String("SET customer = :c"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("bob")}},
+				})
+				return err
+			},
+			code: "ValidationException",
+		},
+		{
+			name: "unknown table",
+			call: func() error {
+				_, err := client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("missing"), Key: orderKey("alice", 1)})
+				return err
+			},
+			code: dynamodb.ErrCodeResourceNotFoundException,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.call()
+			if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != c.code {
+				t.Errorf("expect %s, got %v", c.code, err)
+			}
+		})
+	}
+
+	// the connections are still usable after the errors
+	get, err := client.GetItem(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: orderKey("alice", 1)})
+	if err != nil || !reflect.DeepEqual(order("alice", 1), get.Item) {
+		t.Errorf("expect %v, got %v, %v", order("alice", 1), get, err)
+	}
+}
+
+func TestServer_Indexes(t *testing.T) {
+	s, client := startServer(t)
+	defer stopServer(s, client)
+
+	str := func(name string) dynamodb.AttributeDefinition {
+		return dynamodb.AttributeDefinition{AttributeName: aws.String(name), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	}
+	err := s.CreateGlobalSecondaryIndex("orders", "by-status", &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeKeysOnly)}, str("status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateLocalSecondaryIndex("orders", "by-date", &dynamodb.Projection{
+		ProjectionType:   aws.String(dynamodb.ProjectionTypeInclude),
+		NonKeyAttributes: []*string{aws.String("status")},
+	}, str("date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the later the id, the earlier the date; alice's order 5 has no date
+	items := []map[string]*dynamodb.AttributeValue{order("bob", 0, "status", "paid", "date", "2024-02-01", "note", "b0")}
+	for i := 0; i < 6; i++ {
+		status := "new"
+		if i%2 == 1 {
+			status = "paid"
+		}
+		item := order("alice", i, "status", status, "note", fmt.Sprint("a", i))
+		if i < 5 {
+			item["date"] = &dynamodb.AttributeValue{S: aws.String(fmt.Sprintf("2024-01-%02d", 10-i))}
+		}
+		items = append(items, item)
+	}
+	for _, item := range items {
+		if _, err := client.PutItem(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: item}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := func(id int, attrs ...string) map[string]*dynamodb.AttributeValue {
+		item := copyItem(items[id+1])
+		keep := map[string]bool{"customer": true, "id": true}
+		for _, a := range attrs {
+			keep[a] = true
+		}
+		for n := range item {
+			if !keep[n] {
+				delete(item, n)
+			}
+		}
+		return item
+	}
+
+	cases := []struct {
+		name  string
+		input *dynamodb.QueryInput
+		pages int
+		items []map[string]*dynamodb.AttributeValue
+	}{
+		{
+			name: "global keys only",
+			input: &dynamodb.QueryInput{
+				IndexName:                 aws.String("by-status"),
+				KeyConditionExpression:    aws.String("#s = :s"),
+				ExpressionAttributeNames:  map[string]*string{"#s": aws.String("status")},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":s": {S: aws.String("paid")}},
+				Limit:                     aws.Int64(3),
+			},
+			pages: 2,
+			items: []map[string]*dynamodb.AttributeValue{
+				alice(1, "status"), alice(3, "status"), alice(5, "status"),
+				{"customer": {S: aws.String("bob")}, "id": {N: aws.String("0")}, "status": {S: aws.String("paid")}},
+			},
+		},
+		{
+			name: "local projected",
+			input: &dynamodb.QueryInput{
+				IndexName:                 aws.String("by-date"),
+				KeyConditionExpression:    aws.String("customer = :c"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}},
+				Limit:                     aws.Int64(2),
+			},
+			pages: 3,
+			items: []map[string]*dynamodb.AttributeValue{
+				alice(4, "date", "status"), alice(3, "date", "status"), alice(2, "date", "status"),
+				alice(1, "date", "status"), alice(0, "date", "status"),
+			},
+		},
+		{
+			name: "local fetching",
+			input: &dynamodb.QueryInput{
+				IndexName:                 aws.String("by-date"),
+				KeyConditionExpression:    aws.String("customer = :c AND #d < :d"),
+				FilterExpression:          aws.String("note <> :n"),
+				ExpressionAttributeNames:  map[string]*string{"#d": aws.String("date")},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}, ":d": {S: aws.String("2024-01-09")}, ":n": {S: aws.String("a3")}},
+				Select:                    aws.String(dynamodb.SelectAllAttributes),
+				ScanIndexForward:          aws.Bool(false),
+				Limit:                     aws.Int64(2),
+			},
+			pages: 2,
+			items: []map[string]*dynamodb.AttributeValue{items[3], items[5]},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.input.TableName = aws.String("orders")
+			var pages int
+			var got []map[string]*dynamodb.AttributeValue
+			err := client.QueryPages(c.input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+				pages++
+				got = append(got, page.Items...)
+				if !lastPage {
+					// the key of the table and of the index
+					last := page.LastEvaluatedKey
+					if _, ok := last["customer"]; !ok || len(last) != 3 {
+						t.Errorf("unexpected last evaluated key %v", last)
+					}
+				}
+				return true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pages != c.pages || !reflect.DeepEqual(c.items, got) {
+				t.Errorf("expect %d pages of %v, got %d of %v", c.pages, c.items, pages, got)
+			}
+		})
+	}
+
+	scan, err := client.ScanAll(nil, &dynamodb.ScanInput{
+		TableName:            aws.String("orders"),
+		IndexName:            aws.String("by-date"),
+		ProjectionExpression: aws.String("note"),
+		Limit:                aws.Int64(4),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scan) != 6 || !reflect.DeepEqual(map[string]*dynamodb.AttributeValue{"note": {S: aws.String("a4")}}, scan[0]) {
+		t.Errorf("expect the notes of the 6 dated orders, got %v", scan)
+	}
+
+	invalid := []*dynamodb.QueryInput{
+		{IndexName: aws.String("by-status"), Select: aws.String(dynamodb.SelectAllAttributes)},
+		{IndexName: aws.String("by-status"), ConsistentRead: aws.Bool(true)},
+		{IndexName: aws.String("missing")},
+		{Select: aws.String(dynamodb.SelectAllProjectedAttributes)},
+	}
+	for _, input := range invalid {
+		input.TableName = aws.String("orders")
+		input.KeyConditionExpression = aws.String("customer = :c")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":c": {S: aws.String("alice")}}
+		_, err := client.Query(input)
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "ValidationException" {
+			t.Errorf("expect ValidationException for %v, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package daxtest
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// An in-memory table, items being indexed by their key.
+type table struct {
+	keys    []dynamodb.AttributeDefinition // hash key, then range key if any
+	items   map[string]map[string]*dynamodb.AttributeValue
+	indexes map[string]*index
+}
+
+func newTable(keys []dynamodb.AttributeDefinition) *table {
+	return &table{
+		keys:    keys,
+		items:   make(map[string]map[string]*dynamodb.AttributeValue),
+		indexes: make(map[string]*index),
+	}
+}
+
+// Returns the key of item, or false if a key attribute is missing or not of
+// the type of the key schema.
+func (t *table) keyOf(item map[string]*dynamodb.AttributeValue) (string, bool) {
+	var b strings.Builder
+	for _, k := range t.keys {
+		av := item[*k.AttributeName]
+		if av == nil || typeOf(av) != *k.AttributeType {
+			return "", false
+		}
+		b.WriteString(strconv.Quote(scalarString(av)))
+	}
+	return b.String(), true
+}
+
+// Returns the key attributes of item.
+func (t *table) key(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	key := make(map[string]*dynamodb.AttributeValue, len(t.keys))
+	for _, k := range t.keys {
+		key[*k.AttributeName] = item[*k.AttributeName]
+	}
+	return key
+}
+
+func (t *table) isKey(name string) bool {
+	for _, k := range t.keys {
+		if *k.AttributeName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *table) compare(a, b map[string]*dynamodb.AttributeValue) int {
+	return compareKeys(t.keys, a, b)
+}
+
+// Returns the items of x, or of the table if x is nil, in key order: by the key
+// of the index, then by the key of the table.
+func (t *table) indexed(x *index) []map[string]*dynamodb.AttributeValue {
+	items := make([]map[string]*dynamodb.AttributeValue, 0, len(t.items))
+	for _, item := range t.items {
+		if x.contains(item) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return t.compareIn(x, items[i], items[j]) < 0
+	})
+	return items
+}
+
+// Compares two items of x, or of the table if x is nil.
+func (t *table) compareIn(x *index, a, b map[string]*dynamodb.AttributeValue) int {
+	if x != nil {
+		if c := compareKeys(x.keys, a, b); c != 0 {
+			return c
+		}
+	}
+	return t.compare(a, b)
+}
+
+func compareKeys(keys []dynamodb.AttributeDefinition, a, b map[string]*dynamodb.AttributeValue) int {
+	for _, k := range keys {
+		if c := compareScalars(a[*k.AttributeName], b[*k.AttributeName]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// A secondary index of a table. Its items are the items of the table having all
+// the key attributes of the index, with the projected attributes only.
+type index struct {
+	name       string
+	keys       []dynamodb.AttributeDefinition // hash key, then range key if any
+	global     bool
+	projection string   // a dynamodb.ProjectionType
+	nonKey     []string // the attributes projected by ProjectionTypeInclude
+}
+
+// Returns whether item is in x, which holds every item if nil.
+func (x *index) contains(item map[string]*dynamodb.AttributeValue) bool {
+	if x == nil {
+		return true
+	}
+	for _, k := range x.keys {
+		if av := item[*k.AttributeName]; av == nil || typeOf(av) != *k.AttributeType {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the attributes of item projected in x: the keys of the table and of
+// the index, and the attributes of the projection of x.
+func (x *index) project(t *table, item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if x == nil || x.projection == dynamodb.ProjectionTypeAll {
+		return item
+	}
+	projected := t.key(item)
+	for _, k := range x.keys {
+		projected[*k.AttributeName] = item[*k.AttributeName]
+	}
+	if x.projection == dynamodb.ProjectionTypeInclude {
+		for _, n := range x.nonKey {
+			if av := item[n]; av != nil {
+				projected[n] = av
+			}
+		}
+	}
+	return projected
+}
+
+// Returns the segment of item among total segments of a parallel scan.
+func (t *table) segment(item map[string]*dynamodb.AttributeValue, total int64) int64 {
+	hash := scalarString(item[*t.keys[0].AttributeName])
+	return int64(crc32.ChecksumIEEE([]byte(hash))) % total
+}
+
+// Returns the DynamoDB type of av, such as "S" or "NS".
+func typeOf(av *dynamodb.AttributeValue) string {
+	switch {
+	case av.S != nil:
+		return dynamodb.ScalarAttributeTypeS
+	case av.N != nil:
+		return dynamodb.ScalarAttributeTypeN
+	case av.B != nil:
+		return dynamodb.ScalarAttributeTypeB
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	case av.M != nil:
+		return "M"
+	case av.L != nil:
+		return "L"
+	case av.NULL != nil:
+		return "NULL"
+	case av.BOOL != nil:
+		return "BOOL"
+	}
+	return ""
+}
+
+// Returns a string identifying the value of a scalar, numbers being
+// normalized so that equal numbers have the same string.
+func scalarString(av *dynamodb.AttributeValue) string {
+	switch {
+	case av.S != nil:
+		return "S" + *av.S
+	case av.N != nil:
+		if r, ok := parseNumber(*av.N); ok {
+			return "N" + r.RatString()
+		}
+		return "N" + *av.N
+	case av.B != nil:
+		return "B" + string(av.B)
+	}
+	return ""
+}
+
+// Compares two scalars of the same type. Numbers are compared by value,
+// strings and binaries byte by byte.
+func compareScalars(a, b *dynamodb.AttributeValue) int {
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S)
+	case a.N != nil && b.N != nil:
+		x, _ := parseNumber(*a.N)
+		y, _ := parseNumber(*b.N)
+		return x.Cmp(y)
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B)
+	}
+	return 0
+}
+
+func parseNumber(n string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(n)
+}
+
+// Digits of precision of DynamoDB numbers.
+const numberPrecision = 38
+
+// Formats r as a decimal number, with no more digits than needed.
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	for prec := 1; prec < numberPrecision; prec++ {
+		s := r.FloatString(prec)
+		if f, _ := parseNumber(s); f.Cmp(r) == 0 {
+			return s
+		}
+	}
+	return r.FloatString(numberPrecision)
+}
+
+func copyItem(item map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	if item == nil {
+		return nil
+	}
+	return awsutil.CopyOf(&dynamodb.GetItemOutput{Item: item}).(*dynamodb.GetItemOutput).Item
+}
@@ -0,0 +1,132 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"net"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The codes of the errors returned by DAX, in addition to ErrCodeClientClosed,
+// ErrCodeOverloaded, returned when the requests in flight exhaust
+// Config.MaxConcurrentRequests, ErrCodeConnectionFailed, ErrCodeConnectTimeout,
+// ErrCodeNotImplementedException and ErrCodeItemNotFound. Errors of DynamoDB,
+// such as a failed condition, keep their dynamodb code.
+const (
+	ErrCodeNotImplemented      = client.ErrCodeNotImplemented
+	ErrCodeValidationException = client.ErrCodeValidationException
+	ErrCodeServiceUnavailable  = client.ErrCodeServiceUnavailable
+	ErrCodeThrottlingException = client.ErrCodeThrottlingException
+	ErrCodeUnknown             = client.ErrCodeUnknown
+
+	ErrCodeConditionalCheckFailedException        = dynamodb.ErrCodeConditionalCheckFailedException
+	ErrCodeTransactionCanceledException           = dynamodb.ErrCodeTransactionCanceledException
+	ErrCodeProvisionedThroughputExceededException = dynamodb.ErrCodeProvisionedThroughputExceededException
+)
+
+// Returns whether match returns true for err or an error it wraps, reached
+// through the OrigErr of an awserr.Error or the Unwrap method of other errors.
+func anyError(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+		switch e := err.(type) {
+		case awserr.Error:
+			err = e.OrigErr()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Returns whether err or an error it wraps has one of codes.
+func hasCode(err error, codes ...string) bool {
+	return anyError(err, func(e error) bool {
+		aerr, ok := e.(awserr.Error)
+		if !ok {
+			return false
+		}
+		for _, code := range codes {
+			if aerr.Code() == code {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// IsThrottle reports whether err, or an error it wraps, tells that the request
+// was throttled, such as a ThrottlingException or a
+// ProvisionedThroughputExceededException.
+func IsThrottle(err error) bool {
+	return anyError(err, request.IsErrorThrottle)
+}
+
+// IsRetryable reports whether err, or an error it wraps, is transient, such as
+// a throttling error, an unavailable node or a network error, so that the
+// request may succeed if sent again. Errors of the request itself, such as a
+// failed condition or a validation error, are not.
+func IsRetryable(err error) bool {
+	if err == nil || err == ErrClientClosed || IsValidation(err) || hasCode(err, request.InvalidParameterErrCode, request.CanceledErrorCode) {
+		return false
+	}
+	return anyError(err, func(e error) bool {
+		if aerr, ok := e.(awserr.Error); ok {
+			switch aerr.Code() {
+			case ErrCodeServiceUnavailable, ErrCodeConnectionFailed, ErrCodeConnectTimeout, ErrCodeOverloaded, dynamodb.ErrCodeInternalServerError:
+				return true
+			}
+			return request.IsErrorThrottle(aerr) || request.IsErrorRetryable(aerr)
+		}
+		if nerr, ok := e.(net.Error); ok {
+			return nerr.Timeout() || nerr.Temporary()
+		}
+		return false
+	})
+}
+
+// IsConditionalCheckFailed reports whether err, or an error it wraps, tells
+// that the condition of a write failed.
+func IsConditionalCheckFailed(err error) bool {
+	return hasCode(err, ErrCodeConditionalCheckFailedException)
+}
+
+// IsTransactionCanceled reports whether err, or an error it wraps, tells that
+// a transaction was canceled. Its CancellationReasons tell why.
+func IsTransactionCanceled(err error) bool {
+	return hasCode(err, ErrCodeTransactionCanceledException)
+}
+
+// IsValidation reports whether err, or an error it wraps, is a validation
+// error, returned by the cluster or by the client before sending the request,
+// such as an ItemTooLargeError.
+func IsValidation(err error) bool {
+	return hasCode(err, ErrCodeValidationException, request.InvalidParameterErrCode, request.ParamRequiredErrCode)
+}
+
+// IsClientClosed reports whether err, or an error it wraps, is
+// ErrClientClosed.
+func IsClientClosed(err error) bool {
+	return hasCode(err, ErrCodeClientClosed)
+}
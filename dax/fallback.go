@@ -0,0 +1,145 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/gofrs/uuid"
+)
+
+// ErrCodeNoFallback is the error code of the requests to be sent to
+// Config.Fallback when it is not set.
+const ErrCodeNoFallback = "NoFallback"
+
+func (d *Dax) BatchExecuteStatement(input *dynamodb.BatchExecuteStatementInput) (*dynamodb.BatchExecuteStatementOutput, error) {
+	return d.BatchExecuteStatementWithContext(nil, input)
+}
+
+// BatchExecuteStatementWithContext sends the PartiQL statements to
+// Config.Fallback like ExecuteStatementWithContext. The output is returned as
+// is: a statement failing is reported by its Error in Responses, not by the
+// error of the call.
+func (d *Dax) BatchExecuteStatementWithContext(ctx aws.Context, input *dynamodb.BatchExecuteStatementInput, opts ...request.Option) (*dynamodb.BatchExecuteStatementOutput, error) {
+	var output *dynamodb.BatchExecuteStatementOutput
+	err := d.partiQLFallback(ctx, "BatchExecuteStatement", func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+		output, err = fallback.BatchExecuteStatementWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (d *Dax) BatchExecuteStatementRequest(input *dynamodb.BatchExecuteStatementInput) (*request.Request, *dynamodb.BatchExecuteStatementOutput) {
+	if d.config.EnablePartiQLFallback && d.config.Fallback != nil {
+		return d.config.Fallback.BatchExecuteStatementRequest(input)
+	}
+	return newRequestForUnimplementedOperation("BatchExecuteStatement"), &dynamodb.BatchExecuteStatementOutput{}
+}
+
+func (d *Dax) ExecuteStatement(input *dynamodb.ExecuteStatementInput) (*dynamodb.ExecuteStatementOutput, error) {
+	return d.ExecuteStatementWithContext(nil, input)
+}
+
+// ExecuteStatementWithContext sends the PartiQL statement to Config.Fallback
+// if Config.EnablePartiQLFallback is set, and fails with a not implemented
+// error otherwise. The statement is not served by DAX: it neither reads from
+// nor updates its caches.
+func (d *Dax) ExecuteStatementWithContext(ctx aws.Context, input *dynamodb.ExecuteStatementInput, opts ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
+	var output *dynamodb.ExecuteStatementOutput
+	err := d.partiQLFallback(ctx, "ExecuteStatement", func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+		output, err = fallback.ExecuteStatementWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (d *Dax) ExecuteStatementRequest(input *dynamodb.ExecuteStatementInput) (*request.Request, *dynamodb.ExecuteStatementOutput) {
+	if d.config.EnablePartiQLFallback && d.config.Fallback != nil {
+		return d.config.Fallback.ExecuteStatementRequest(input)
+	}
+	return newRequestForUnimplementedOperation("ExecuteStatement"), &dynamodb.ExecuteStatementOutput{}
+}
+
+func (d *Dax) ExecuteTransaction(input *dynamodb.ExecuteTransactionInput) (*dynamodb.ExecuteTransactionOutput, error) {
+	return d.ExecuteTransactionWithContext(nil, input)
+}
+
+// ExecuteTransactionWithContext sends the PartiQL transaction to
+// Config.Fallback like ExecuteStatementWithContext. A ClientRequestToken is
+// set on input if it has none, so that retries of the transaction with the
+// same input are idempotent.
+func (d *Dax) ExecuteTransactionWithContext(ctx aws.Context, input *dynamodb.ExecuteTransactionInput, opts ...request.Option) (*dynamodb.ExecuteTransactionOutput, error) {
+	var output *dynamodb.ExecuteTransactionOutput
+	err := d.partiQLFallback(ctx, "ExecuteTransaction", func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) error {
+		if err := setClientRequestToken(input); err != nil {
+			return err
+		}
+		var err error
+		output, err = fallback.ExecuteTransactionWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (d *Dax) ExecuteTransactionRequest(input *dynamodb.ExecuteTransactionInput) (*request.Request, *dynamodb.ExecuteTransactionOutput) {
+	if d.config.EnablePartiQLFallback && d.config.Fallback != nil {
+		return d.config.Fallback.ExecuteTransactionRequest(input)
+	}
+	return newRequestForUnimplementedOperation("ExecuteTransaction"), &dynamodb.ExecuteTransactionOutput{}
+}
+
+func setClientRequestToken(input *dynamodb.ExecuteTransactionInput) error {
+	if input == nil || input.ClientRequestToken != nil {
+		return nil
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	input.ClientRequestToken = aws.String(id.String())
+	return nil
+}
+
+// Sends the PartiQL request of operation op with send to Config.Fallback, if
+// enabled, with ctx or if nil a context bounded by RequestTimeout.
+func (d *Dax) partiQLFallback(ctx aws.Context, op string, send func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) error) error {
+	if d.isClosed() {
+		return ErrClientClosed
+	}
+	if !d.config.EnablePartiQLFallback {
+		return d.unImpl(op)
+	}
+	if d.config.Fallback == nil {
+		return awserr.New(ErrCodeNoFallback, "PartiQL requests need a Config.Fallback client", nil)
+	}
+	return d.sendFallback(ctx, send)
+}
+
+// Sends a request with send to Config.Fallback with ctx or if nil a context
+// bounded by RequestTimeout.
+func (d *Dax) sendFallback(ctx aws.Context, send func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) error) error {
+	if d.config.Fallback == nil {
+		return awserr.New(ErrCodeNoFallback, "the request needs a Config.Fallback client", nil)
+	}
+	ctx, cfn := d.config.requestContext(ctx)
+	if cfn != nil {
+		defer cfn()
+	}
+	return send(d.config.Fallback, ctx)
+}
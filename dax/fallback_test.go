@@ -0,0 +1,482 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// A DynamoDB client recording the PartiQL requests it receives.
+type fallbackStub struct {
+	dynamodbiface.DynamoDBAPI
+
+	ctxs       []aws.Context
+	opts       [][]request.Option
+	statements []*dynamodb.ExecuteStatementInput
+	txs        []*dynamodb.ExecuteTransactionInput
+	batches    []*dynamodb.BatchExecuteStatementInput
+	batchOut   *dynamodb.BatchExecuteStatementOutput
+	gets       []*dynamodb.GetItemInput
+	puts       []*dynamodb.PutItemInput
+	queries    []*dynamodb.QueryInput
+	batchGets  []*dynamodb.BatchGetItemInput
+	getOut     *dynamodb.BatchGetItemOutput
+	getErr     error
+	batchPuts  []*dynamodb.BatchWriteItemInput
+	writeOut   *dynamodb.BatchWriteItemOutput
+}
+
+func (s *fallbackStub) ExecuteStatementWithContext(ctx aws.Context, input *dynamodb.ExecuteStatementInput, opts ...request.Option) (*dynamodb.ExecuteStatementOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.statements = append(s.statements, input)
+	return &dynamodb.ExecuteStatementOutput{Items: []map[string]*dynamodb.AttributeValue{{"pk": {S: input.Statement}}}}, nil
+}
+
+func (s *fallbackStub) ExecuteTransactionWithContext(ctx aws.Context, input *dynamodb.ExecuteTransactionInput, opts ...request.Option) (*dynamodb.ExecuteTransactionOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.txs = append(s.txs, input)
+	return &dynamodb.ExecuteTransactionOutput{}, nil
+}
+
+func (s *fallbackStub) BatchExecuteStatementWithContext(ctx aws.Context, input *dynamodb.BatchExecuteStatementInput, opts ...request.Option) (*dynamodb.BatchExecuteStatementOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.batches = append(s.batches, input)
+	return s.batchOut, nil
+}
+
+func (s *fallbackStub) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.gets = append(s.gets, input)
+	return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"from": {S: aws.String("fallback")}}}, nil
+}
+
+func (s *fallbackStub) GetItemRequest(input *dynamodb.GetItemInput) (*request.Request, *dynamodb.GetItemOutput) {
+	output := &dynamodb.GetItemOutput{}
+	clientInfo := metadata.ClientInfo{ServiceName: dynamodb.ServiceName}
+	return request.New(aws.Config{}, clientInfo, request.Handlers{}, nil, &request.Operation{Name: "GetItem"}, input, output), output
+}
+
+func (s *fallbackStub) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.puts = append(s.puts, input)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (s *fallbackStub) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.queries = append(s.queries, input)
+	out := &dynamodb.QueryOutput{Count: aws.Int64(1)}
+	if input.ExclusiveStartKey == nil {
+		out.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}
+	}
+	return out, nil
+}
+
+func (s *fallbackStub) BatchGetItemWithContext(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts ...request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.batchGets = append(s.batchGets, input)
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	return s.getOut, nil
+}
+
+func (s *fallbackStub) BatchWriteItemWithContext(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts ...request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	s.ctxs = append(s.ctxs, ctx)
+	s.opts = append(s.opts, opts)
+	s.batchPuts = append(s.batchPuts, input)
+	return s.writeOut, nil
+}
+
+func newFallbackClient(fallback dynamodbiface.DynamoDBAPI, enabled bool) (*Dax, *client.ClientStub) {
+	stub := client.NewClientStub(nil, nil, nil)
+	cfg := DefaultConfig()
+	cfg.Fallback = fallback
+	cfg.EnablePartiQLFallback = enabled
+	return &Dax{client: stub, config: cfg}, stub
+}
+
+func TestExecuteStatementFallback(t *testing.T) {
+	fallback := &fallbackStub{}
+	db, stub := newFallbackClient(fallback, true)
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	retries := func(r *request.Request) { r.Config.MaxRetries = aws.Int(7) }
+	input := &dynamodb.ExecuteStatementInput{Statement: aws.String(`SELECT * FROM "table"`)}
+	out, err := db.ExecuteStatementWithContext(ctx, input, retries)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := input.Statement, out.Items[0]["pk"].S; e != a {
+		t.Errorf("expect the output of the fallback, got %v", out)
+	}
+	if len(fallback.statements) != 1 || fallback.statements[0] != input {
+		t.Fatalf("expect the statement sent to the fallback, got %v", fallback.statements)
+	}
+	if e, a := "caller", fallback.ctxs[0].Value(key{}); e != a {
+		t.Errorf("expect the context of the caller, got %v", fallback.ctxs[0])
+	}
+	r := &request.Request{}
+	r.ApplyOptions(fallback.opts[0]...)
+	if e, a := 7, aws.IntValue(r.Config.MaxRetries); e != a {
+		t.Errorf("expect the options of the caller, got %v retries", a)
+	}
+
+	// without a context, RequestTimeout bounds the request
+	if _, err := db.ExecuteStatement(input); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, ok := fallback.ctxs[1].Deadline(); !ok {
+		t.Errorf("expect a deadline from RequestTimeout")
+	}
+
+	if reqs := len(stub.GetRequestOptions()); reqs != 0 {
+		t.Errorf("expect no request sent to DAX, got %d", reqs)
+	}
+}
+
+func TestExecuteStatementFallback_Disabled(t *testing.T) {
+	fallback := &fallbackStub{}
+	input := &dynamodb.ExecuteStatementInput{Statement: aws.String(`SELECT * FROM "table"`)}
+
+	db, _ := newFallbackClient(fallback, false)
+	if _, err := db.ExecuteStatement(input); !IsNotImplemented(err) {
+		t.Errorf("expect not implemented error, got %v", err)
+	}
+	req, _ := db.ExecuteStatementRequest(input)
+	if err := req.Send(); !IsNotImplemented(err) {
+		t.Errorf("expect not implemented error, got %v", err)
+	}
+	if len(fallback.statements) != 0 {
+		t.Errorf("expect nothing sent to the fallback, got %v", fallback.statements)
+	}
+
+	db, _ = newFallbackClient(nil, true)
+	_, err := db.ExecuteStatement(input)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNoFallback {
+		t.Errorf("expect %s, got %v", ErrCodeNoFallback, err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.EnablePartiQLFallback = true
+	if _, err := New(cfg); err == nil {
+		t.Errorf("expect an error enabling the fallback without a Fallback client")
+	}
+
+	db, _ = newFallbackClient(fallback, true)
+	db.Close()
+	if _, err := db.ExecuteStatement(input); err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestExecuteTransactionFallback(t *testing.T) {
+	fallback := &fallbackStub{}
+	db, stub := newFallbackClient(fallback, true)
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	retries := func(r *request.Request) { r.Config.MaxRetries = aws.Int(7) }
+	input := &dynamodb.ExecuteTransactionInput{TransactStatements: []*dynamodb.ParameterizedStatement{
+		{Statement: aws.String(`UPDATE "table" SET v = 1 WHERE pk = 'a'`)},
+	}}
+	if _, err := db.ExecuteTransactionWithContext(ctx, input, retries); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(fallback.txs) != 1 || fallback.txs[0] != input {
+		t.Fatalf("expect the transaction sent to the fallback, got %v", fallback.txs)
+	}
+	token := aws.StringValue(fallback.txs[0].ClientRequestToken)
+	if token == "" {
+		t.Errorf("expect a generated ClientRequestToken")
+	}
+	if e, a := "caller", fallback.ctxs[0].Value(key{}); e != a {
+		t.Errorf("expect the context of the caller, got %v", fallback.ctxs[0])
+	}
+	r := &request.Request{}
+	r.ApplyOptions(fallback.opts[0]...)
+	if e, a := 7, aws.IntValue(r.Config.MaxRetries); e != a {
+		t.Errorf("expect the options of the caller, got %v retries", a)
+	}
+
+	// a retry of the same input keeps its token
+	if _, err := db.ExecuteTransaction(input); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := token, aws.StringValue(fallback.txs[1].ClientRequestToken); e != a {
+		t.Errorf("expect ClientRequestToken %s, got %s", e, a)
+	}
+
+	// a token of the caller is not replaced, and a new input gets a new one
+	if _, err := db.ExecuteTransaction(&dynamodb.ExecuteTransactionInput{ClientRequestToken: aws.String("caller")}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := "caller", aws.StringValue(fallback.txs[2].ClientRequestToken); e != a {
+		t.Errorf("expect ClientRequestToken %s, got %s", e, a)
+	}
+	if _, err := db.ExecuteTransaction(&dynamodb.ExecuteTransactionInput{}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if a := aws.StringValue(fallback.txs[3].ClientRequestToken); a == "" || a == token {
+		t.Errorf("expect a new ClientRequestToken, got %q", a)
+	}
+
+	if reqs := len(stub.GetRequestOptions()); reqs != 0 {
+		t.Errorf("expect no request sent to DAX, got %d", reqs)
+	}
+}
+
+func TestExecuteTransactionFallback_Disabled(t *testing.T) {
+	fallback := &fallbackStub{}
+	input := &dynamodb.ExecuteTransactionInput{}
+
+	db, _ := newFallbackClient(fallback, false)
+	if _, err := db.ExecuteTransaction(input); !IsNotImplemented(err) {
+		t.Errorf("expect not implemented error, got %v", err)
+	}
+	req, _ := db.ExecuteTransactionRequest(input)
+	if err := req.Send(); !IsNotImplemented(err) {
+		t.Errorf("expect not implemented error, got %v", err)
+	}
+	if len(fallback.txs) != 0 || input.ClientRequestToken != nil {
+		t.Errorf("expect nothing sent to the fallback, got %v", fallback.txs)
+	}
+
+	db, _ = newFallbackClient(nil, true)
+	_, err := db.ExecuteTransaction(input)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNoFallback {
+		t.Errorf("expect %s, got %v", ErrCodeNoFallback, err)
+	}
+}
+
+func TestBatchExecuteStatementFallback(t *testing.T) {
+	// the second statement fails, the others succeed
+	out := &dynamodb.BatchExecuteStatementOutput{Responses: []*dynamodb.BatchStatementResponse{
+		{TableName: aws.String("table"), Item: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}},
+		{Error: &dynamodb.BatchStatementError{Code: aws.String(dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed), Message: aws.String("condition failed")}},
+		{TableName: aws.String("table")},
+	}}
+	fallback := &fallbackStub{batchOut: out}
+	db, stub := newFallbackClient(fallback, true)
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	retries := func(r *request.Request) { r.Config.MaxRetries = aws.Int(7) }
+	input := &dynamodb.BatchExecuteStatementInput{Statements: []*dynamodb.BatchStatementRequest{
+		{Statement: aws.String(`SELECT * FROM "table" WHERE pk = 'a'`)},
+		{Statement: aws.String(`UPDATE "table" SET v = 1 WHERE pk = 'b'`)},
+		{Statement: aws.String(`SELECT * FROM "table" WHERE pk = 'c'`)},
+	}}
+	res, err := db.BatchExecuteStatementWithContext(ctx, input, retries)
+	if err != nil {
+		t.Fatalf("expect failed statements not to fail the call, got %v", err)
+	}
+	if res != out {
+		t.Errorf("expect the output of the fallback unchanged, got %v", res)
+	}
+	if e, a := len(input.Statements), len(res.Responses); e != a {
+		t.Fatalf("expect %d responses, got %d", e, a)
+	}
+	if res.Responses[0].Error != nil || res.Responses[2].Error != nil {
+		t.Errorf("expect statements 0 and 2 to succeed, got %v", res.Responses)
+	}
+	if e, a := dynamodb.BatchStatementErrorCodeEnumConditionalCheckFailed, aws.StringValue(res.Responses[1].Error.Code); e != a {
+		t.Errorf("expect statement 1 to fail with %s, got %s", e, a)
+	}
+	if len(fallback.batches) != 1 || fallback.batches[0] != input {
+		t.Fatalf("expect the statements sent to the fallback, got %v", fallback.batches)
+	}
+	if e, a := "caller", fallback.ctxs[0].Value(key{}); e != a {
+		t.Errorf("expect the context of the caller, got %v", fallback.ctxs[0])
+	}
+	r := &request.Request{}
+	r.ApplyOptions(fallback.opts[0]...)
+	if e, a := 7, aws.IntValue(r.Config.MaxRetries); e != a {
+		t.Errorf("expect the options of the caller, got %v retries", a)
+	}
+	if reqs := len(stub.GetRequestOptions()); reqs != 0 {
+		t.Errorf("expect no request sent to DAX, got %d", reqs)
+	}
+}
+
+func TestBatchExecuteStatementFallback_Disabled(t *testing.T) {
+	fallback := &fallbackStub{}
+	input := &dynamodb.BatchExecuteStatementInput{}
+
+	db, _ := newFallbackClient(fallback, false)
+	if _, err := db.BatchExecuteStatement(input); !IsNotImplemented(err) {
+		t.Errorf("expect not implemented error, got %v", err)
+	}
+	req, _ := db.BatchExecuteStatementRequest(input)
+	if err := req.Send(); !IsNotImplemented(err) {
+		t.Errorf("expect not implemented error, got %v", err)
+	}
+	if len(fallback.batches) != 0 {
+		t.Errorf("expect nothing sent to the fallback, got %v", fallback.batches)
+	}
+
+	db, _ = newFallbackClient(nil, true)
+	_, err := db.BatchExecuteStatement(input)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNoFallback {
+		t.Errorf("expect %s, got %v", ErrCodeNoFallback, err)
+	}
+}
+
+// A client stub reporting the reachability of its cluster as a cluster client.
+type reachabilityStub struct {
+	*client.ClientStub
+	reachable bool
+}
+
+func (s *reachabilityStub) Reachable() bool {
+	return s.reachable
+}
+
+func newDegradedClient(fallback dynamodbiface.DynamoDBAPI, allowWrites bool) (*Dax, *reachabilityStub) {
+	stub := &reachabilityStub{ClientStub: client.NewClientStub(nil, nil, nil), reachable: true}
+	cfg := DefaultConfig()
+	cfg.Fallback = fallback
+	cfg.EnableDegradedMode = true
+	cfg.AllowDegradedWrites = allowWrites
+	return &Dax{client: stub, config: cfg}, stub
+}
+
+func TestDegradedMode(t *testing.T) {
+	fallback := &fallbackStub{}
+	db, stub := newDegradedClient(fallback, false)
+	get := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}
+	put := &dynamodb.PutItemInput{TableName: aws.String("table"), Item: get.Key}
+
+	// reachable: everything is sent to the cluster
+	db.GetItem(get)
+	db.PutItem(put)
+	if len(stub.Requests(client.OpGetItem)) != 1 || len(stub.Requests(client.OpPutItem)) != 1 {
+		t.Errorf("expect requests sent to the cluster")
+	}
+
+	// unreachable: reads are sent to the fallback, writes to the cluster
+	stub.reachable = false
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "caller")
+	out, err := db.GetItemWithContext(ctx, get, WithConsistentRead())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := "fallback", aws.StringValue(out.Item["from"].S); e != a {
+		t.Errorf("expect the item of the fallback, got %v", out)
+	}
+	if len(fallback.gets) != 1 || fallback.gets[0] != get {
+		t.Fatalf("expect the GetItem sent to the fallback, got %v", fallback.gets)
+	}
+	if e, a := "caller", fallback.ctxs[0].Value(key{}); e != a {
+		t.Errorf("expect the context of the caller, got %v", fallback.ctxs[0])
+	}
+	if len(fallback.opts[0]) != 1 {
+		t.Errorf("expect the options of the caller, got %v", fallback.opts[0])
+	}
+	if _, err := db.PutItem(put); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(fallback.puts) != 0 || len(stub.Requests(client.OpPutItem)) != 2 {
+		t.Errorf("expect writes sent to the cluster, got %d sent to the fallback", len(fallback.puts))
+	}
+	if req, _ := db.GetItemRequest(get); req.ClientInfo.ServiceName == ServiceName {
+		t.Errorf("expect a request of the fallback, got %s", req.ClientInfo.ServiceName)
+	}
+
+	// paginators switch to the fallback too
+	pages := 0
+	err = db.QueryPages(&dynamodb.QueryInput{TableName: aws.String("table")}, func(*dynamodb.QueryOutput, bool) bool {
+		pages++
+		return true
+	})
+	if err != nil || pages != 2 || len(fallback.queries) != 2 {
+		t.Errorf("expect 2 pages from the fallback, got %d pages, %d queries, error %v", pages, len(fallback.queries), err)
+	}
+	if _, ok := fallback.ctxs[len(fallback.ctxs)-1].Deadline(); !ok {
+		t.Errorf("expect a deadline from RequestTimeout")
+	}
+	if e, a := int64(4), db.Stats().DegradedRequests; e != a {
+		t.Errorf("expect %d degraded requests, got %d", e, a)
+	}
+
+	// recovered: everything is sent to the cluster again
+	stub.reachable = true
+	db.GetItem(get)
+	if len(fallback.gets) != 1 || len(stub.Requests(client.OpGetItem)) != 2 {
+		t.Errorf("expect reads sent to the cluster once it recovered")
+	}
+}
+
+func TestDegradedMode_Writes(t *testing.T) {
+	fallback := &fallbackStub{}
+	db, stub := newDegradedClient(fallback, true)
+	put := &dynamodb.PutItemInput{TableName: aws.String("table")}
+
+	stub.reachable = false
+	if _, err := db.PutItem(put); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(fallback.puts) != 1 || len(stub.Requests(client.OpPutItem)) != 0 {
+		t.Errorf("expect writes sent to the fallback")
+	}
+
+	db.config.EnableDegradedMode = false
+	db.PutItem(put)
+	if len(fallback.puts) != 1 || len(stub.Requests(client.OpPutItem)) != 1 {
+		t.Errorf("expect writes sent to the cluster unless degraded mode is enabled")
+	}
+
+	db.config.EnableDegradedMode = true
+	db.Close()
+	if _, err := db.PutItem(put); err != ErrClientClosed {
+		t.Errorf("expect %v, got %v", ErrClientClosed, err)
+	}
+}
+
+func TestDegradedMode_Config(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.EnableDegradedMode = true
+	cfg.HealthCheckInterval = time.Second
+	if _, err := New(cfg); err == nil {
+		t.Errorf("expect an error enabling degraded mode without a Fallback client")
+	}
+	cfg.Fallback = &fallbackStub{}
+	cfg.HealthCheckInterval = 0
+	if _, err := New(cfg); err == nil {
+		t.Errorf("expect an error enabling degraded mode without health checks")
+	}
+}
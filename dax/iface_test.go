@@ -0,0 +1,62 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	_ DynamoDBAPI     = (*dynamodb.DynamoDB)(nil)
+	_ DynamoDBAPI     = (*Dax)(nil)
+	_ FullDynamoDBAPI = (*dynamodb.DynamoDB)(nil)
+	_ FullDynamoDBAPI = (*Dax)(nil)
+)
+
+func ExampleDynamoDBAPI() {
+	sess := session.Must(session.NewSession())
+
+	// use DAX where a cluster is configured, and DynamoDB otherwise
+	var db DynamoDBAPI
+	if endpoint := os.Getenv("DAX_ENDPOINT"); endpoint != "" {
+		cfg := NewConfigWithSession(*sess)
+		cfg.HostPorts = []string{endpoint}
+		d, err := New(cfg)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer d.Close()
+		db = d
+	} else {
+		db = dynamodb.New(sess)
+	}
+
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("orders"),
+		Key:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String("order#1")}},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(out.Item)
+}
@@ -16,6 +16,7 @@
 package cbor
 
 import (
+	"encoding/base64"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -47,6 +48,9 @@ func EncodeAttributeValue(value *dynamodb.AttributeValue, writer *Writer) error
 	case value.B != nil:
 		err = writer.WriteBytes(value.B)
 	case value.SS != nil:
+		if err = checkStringSet(value.SS); err != nil {
+			return err
+		}
 		if err = writer.writeType(Tag, tagStringSet); err != nil {
 			return err
 		}
@@ -54,11 +58,17 @@ func EncodeAttributeValue(value *dynamodb.AttributeValue, writer *Writer) error
 			return err
 		}
 		for _, sp := range value.SS {
+			if sp == nil {
+				return awserr.New(request.InvalidParameterErrCode, "invalid string set: nil element", nil)
+			}
 			if err := writer.WriteString(*sp); err != nil {
 				return err
 			}
 		}
 	case value.NS != nil:
+		if err = checkNumberSet(value.NS); err != nil {
+			return err
+		}
 		if err = writer.writeType(Tag, tagNumberSet); err != nil {
 			return err
 		}
@@ -66,11 +76,17 @@ func EncodeAttributeValue(value *dynamodb.AttributeValue, writer *Writer) error
 			return err
 		}
 		for _, sp := range value.NS {
+			if sp == nil {
+				return awserr.New(request.InvalidParameterErrCode, "invalid number set: nil element", nil)
+			}
 			if err := writeStringNumber(*sp, writer); err != nil {
 				return err
 			}
 		}
 	case value.BS != nil:
+		if err = checkBinarySet(value.BS); err != nil {
+			return err
+		}
 		if err = writer.writeType(Tag, tagBinarySet); err != nil {
 			return err
 		}
@@ -86,9 +102,9 @@ func EncodeAttributeValue(value *dynamodb.AttributeValue, writer *Writer) error
 		if err = writer.WriteArrayHeader(len(value.L)); err != nil {
 			return err
 		}
-		for _, v := range value.L {
+		for i, v := range value.L {
 			if err := EncodeAttributeValue(v, writer); err != nil {
-				return err
+				return withPathElement(err, "["+strconv.Itoa(i)+"]")
 			}
 		}
 	case value.M != nil:
@@ -100,7 +116,7 @@ func EncodeAttributeValue(value *dynamodb.AttributeValue, writer *Writer) error
 				return err
 			}
 			if err = EncodeAttributeValue(v, writer); err != nil {
-				return err
+				return withPathElement(err, k)
 			}
 		}
 	case value.BOOL != nil:
@@ -115,6 +131,9 @@ func EncodeAttributeValue(value *dynamodb.AttributeValue, writer *Writer) error
 }
 
 func writeStringNumber(val string, writer *Writer) error {
+	if reason := checkNumber(val); reason != "" {
+		return &NumberError{Value: val, Reason: reason}
+	}
 	if strings.IndexAny(val, ".eE") >= 0 {
 		dec := new(Decimal)
 		if _, ok := dec.SetString(val); !ok {
@@ -124,8 +143,10 @@ func writeStringNumber(val string, writer *Writer) error {
 		return err
 	}
 	if len(val) > 18 {
-		bint := new(big.Int)
-		bint.SetString(val, 10)
+		bint, ok := new(big.Int).SetString(val, 10)
+		if !ok {
+			return awserr.New(request.InvalidParameterErrCode, fmt.Sprintf("invalid number %v", val), nil)
+		}
 		err := writer.WriteBigInt(bint)
 		return err
 	}
@@ -137,7 +158,123 @@ func writeStringNumber(val string, writer *Writer) error {
 	return err
 }
 
+// checkStringSet returns the error DynamoDB would for a string set without
+// members or with duplicate members. Nil members are left to the encoder.
+func checkStringSet(ss []*string) error {
+	if len(ss) == 0 {
+		return emptySetError("string")
+	}
+	seen := make(map[string]struct{}, len(ss))
+	for _, s := range ss {
+		if s == nil {
+			continue
+		}
+		if _, ok := seen[*s]; ok {
+			return duplicateSetError(aws.StringValueSlice(ss))
+		}
+		seen[*s] = struct{}{}
+	}
+	return nil
+}
+
+// checkNumberSet is checkStringSet for number sets, where members are
+// duplicates when their values are equal, eg: "1" and "1.0". Invalid numbers
+// are left to the encoder.
+func checkNumberSet(ns []*string) error {
+	if len(ns) == 0 {
+		return emptySetError("number")
+	}
+	seen := make(map[string]struct{}, len(ns))
+	for _, n := range ns {
+		if n == nil || checkNumber(*n) != "" {
+			continue
+		}
+		k := normalizeNumber(*n)
+		if _, ok := seen[k]; ok {
+			return duplicateSetError(aws.StringValueSlice(ns))
+		}
+		seen[k] = struct{}{}
+	}
+	return nil
+}
+
+// checkBinarySet is checkStringSet for binary sets, whose members are compared
+// byte by byte.
+func checkBinarySet(bs [][]byte) error {
+	if len(bs) == 0 {
+		return emptySetError("binary")
+	}
+	seen := make(map[string]struct{}, len(bs))
+	for _, b := range bs {
+		if _, ok := seen[string(b)]; ok {
+			members := make([]string, len(bs))
+			for i, b := range bs {
+				members[i] = base64.StdEncoding.EncodeToString(b)
+			}
+			return duplicateSetError(members)
+		}
+		seen[string(b)] = struct{}{}
+	}
+	return nil
+}
+
+func emptySetError(typ string) error {
+	return awserr.New(request.InvalidParameterErrCode, fmt.Sprintf("One or more parameter values were invalid: An %s set  may not be empty", typ), nil)
+}
+
+func duplicateSetError(members []string) error {
+	return awserr.New(request.InvalidParameterErrCode, fmt.Sprintf("One or more parameter values were invalid: Input collection [%s] contains duplicates.", strings.Join(members, ", ")), nil)
+}
+
 func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
+	var d *ItemDecoder
+	return d.DecodeAttributeValue(reader)
+}
+
+// An ItemDecoder decodes the attribute values of the items of a single response,
+// sharing one string among all occurrences of a map attribute name.
+// The zero value is ready to use, a nil *ItemDecoder decodes without sharing names.
+// An ItemDecoder must not be used concurrently.
+type ItemDecoder struct {
+	names map[string]string
+}
+
+// Bounds the capacity allocated upfront for collections, whose length is read from the stream.
+const maxPresizedLen = 1024
+
+func presize(len int) (int, error) {
+	if len < 0 {
+		return 0, ErrNegLength
+	}
+	if len > maxPresizedLen {
+		return maxPresizedLen, nil
+	}
+	return len, nil
+}
+
+// Bounds the names shared by an ItemDecoder, for maps keyed by unique values.
+const maxItemDecoderNames = 4096
+
+func (d *ItemDecoder) readName(reader *Reader) (string, error) {
+	if d == nil || len(d.names) >= maxItemDecoderNames {
+		return reader.ReadString()
+	}
+	if d.names == nil {
+		d.names = make(map[string]string)
+	}
+	return reader.readInternedString(d.names)
+}
+
+// Bounds the nesting of lists and maps in decoded values, as DynamoDB does,
+// so that malformed input cannot exhaust the stack.
+const maxNestingDepth = 32
+
+func (d *ItemDecoder) DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
+	return d.decodeAttributeValue(reader, 0)
+}
+
+// Decodes an attribute value nested in depth lists and maps.
+func (d *ItemDecoder) decodeAttributeValue(reader *Reader, depth int) (*dynamodb.AttributeValue, error) {
 	hdr, err := reader.PeekHeader()
 	if err != nil {
 		return nil, err
@@ -145,6 +282,10 @@ func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
 	major := hdr & MajorTypeMask
 	minor := hdr & MinorTypeMask
 
+	if (major == Array || major == Map) && depth >= maxNestingDepth {
+		return nil, awserr.New(request.ErrCodeSerialization, fmt.Sprintf("attribute value nested deeper than %d levels", maxNestingDepth), nil)
+	}
+
 	switch major {
 	case Utf:
 		s, err := reader.ReadString()
@@ -163,13 +304,17 @@ func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
 		if err != nil {
 			return nil, err
 		}
-		as := make([]*dynamodb.AttributeValue, len)
+		c, err := presize(len)
+		if err != nil {
+			return nil, err
+		}
+		as := make([]*dynamodb.AttributeValue, 0, c)
 		for i := 0; i < len; i++ {
-			a, err := DecodeAttributeValue(reader)
+			a, err := d.decodeAttributeValue(reader, depth+1)
 			if err != nil {
 				return nil, err
 			}
-			as[i] = a
+			as = append(as, a)
 		}
 		return &dynamodb.AttributeValue{L: as}, nil
 	case Map:
@@ -177,13 +322,17 @@ func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
 		if err != nil {
 			return nil, err
 		}
-		m := make(map[string]*dynamodb.AttributeValue, len)
+		c, err := presize(len)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]*dynamodb.AttributeValue, c)
 		for i := 0; i < len; i++ {
-			k, err := reader.ReadString()
+			k, err := d.readName(reader)
 			if err != nil {
 				return nil, err
 			}
-			v, err := DecodeAttributeValue(reader)
+			v, err := d.decodeAttributeValue(reader, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -235,13 +384,17 @@ func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
 				if err != nil {
 					return nil, err
 				}
-				ss := make([]*string, len)
+				c, err := presize(len)
+				if err != nil {
+					return nil, err
+				}
+				ss := make([]*string, 0, c)
 				for i := 0; i < len; i++ {
 					s, err := reader.ReadString()
 					if err != nil {
 						return nil, err
 					}
-					ss[i] = &s
+					ss = append(ss, &s)
 				}
 				return &dynamodb.AttributeValue{SS: ss}, nil
 			case tagNumberSet:
@@ -249,13 +402,20 @@ func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
 				if err != nil {
 					return nil, err
 				}
-				ss := make([]*string, len)
+				c, err := presize(len)
+				if err != nil {
+					return nil, err
+				}
+				ss := make([]*string, 0, c)
 				for i := 0; i < len; i++ {
-					av, err := DecodeAttributeValue(reader)
+					av, err := d.decodeAttributeValue(reader, depth+1)
 					if err != nil {
 						return nil, err
 					}
-					ss[i] = av.N
+					if av.N == nil {
+						return nil, awserr.New(request.ErrCodeSerialization, "number set with a non-number element", nil)
+					}
+					ss = append(ss, av.N)
 				}
 				return &dynamodb.AttributeValue{NS: ss}, nil
 			case tagBinarySet:
@@ -263,13 +423,17 @@ func DecodeAttributeValue(reader *Reader) (*dynamodb.AttributeValue, error) {
 				if err != nil {
 					return nil, err
 				}
-				bs := make([][]byte, len)
+				c, err := presize(len)
+				if err != nil {
+					return nil, err
+				}
+				bs := make([][]byte, 0, c)
 				for i := 0; i < len; i++ {
 					b, err := reader.ReadBytes()
 					if err != nil {
 						return nil, err
 					}
-					bs[i] = b
+					bs = append(bs, b)
 				}
 				return &dynamodb.AttributeValue{BS: bs}, nil
 			default:
@@ -0,0 +1,276 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package cbor
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Decoding with an ItemDecoder must be indistinguishable from DecodeAttributeValue.
+func FuzzItemDecoder(f *testing.F) {
+	seeds := []*dynamodb.AttributeValue{
+		{S: aws.String("abc")},
+		{N: aws.String("-123456789012345678901234567890")},
+		{SS: []*string{aws.String("abc"), aws.String("def")}},
+		{L: []*dynamodb.AttributeValue{{M: map[string]*dynamodb.AttributeValue{"k": {S: aws.String("v")}}}, {B: []byte{1}}}},
+		{M: map[string]*dynamodb.AttributeValue{"k": {M: map[string]*dynamodb.AttributeValue{"k": {BOOL: aws.Bool(true)}}}, "": {NULL: aws.Bool(true)}}},
+	}
+	for _, v := range seeds {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := EncodeAttributeValue(v, w); err != nil {
+			f.Fatal(err)
+		}
+		w.Flush()
+		w.Close()
+		f.Add(append(buf.Bytes(), buf.Bytes()...))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var want []*dynamodb.AttributeValue
+		var wantErr error
+		r := NewReader(bytes.NewReader(b))
+		for wantErr == nil {
+			var v *dynamodb.AttributeValue
+			if v, wantErr = DecodeAttributeValue(r); wantErr == nil {
+				want = append(want, v)
+			}
+		}
+		r.Close()
+
+		var got []*dynamodb.AttributeValue
+		var gotErr error
+		d := &ItemDecoder{}
+		r = NewReader(bytes.NewReader(b))
+		for gotErr == nil {
+			var v *dynamodb.AttributeValue
+			if v, gotErr = d.DecodeAttributeValue(r); gotErr == nil {
+				got = append(got, v)
+			}
+		}
+		r.Close()
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+		if wantErr.Error() != gotErr.Error() {
+			t.Errorf("expected error %v, got %v", wantErr, gotErr)
+		}
+	})
+}
+
+// Arbitrary bytes must either fail to decode or decode into a value which
+// encodes into bytes decoding into the same value.
+func FuzzDecodeAttributeValue(f *testing.F) {
+	for _, v := range goldenAttributeValues {
+		b, err := encodeAttributeValue(v.val)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	for _, b := range [][]byte{
+		{0x81, 0x81, 0x81, 0x81, 0x80},             // nested lists
+		{0xd9, 0x0c, 0xfa, 0x82, 0x61, 0x61, 0x01}, // number set of a string and a number
+		{0xc4, 0x82, 0x21, 0xc2, 0x41, 0x01},       // decimal with a bignum mantissa
+		{0xbf, 0x61, 0x61, 0xf6, 0xff},             // indefinite map
+	} {
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		v, err := decodeAttributeValue(b)
+		if err != nil {
+			return
+		}
+		enc, err := encodeAttributeValue(v)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == request.InvalidParameterErrCode {
+			return // decoded a value DynamoDB cannot store, such as an empty set
+		}
+		if err != nil {
+			t.Fatalf("decoded %v fails to encode: %v", v, err)
+		}
+		again, err := decodeAttributeValue(enc)
+		if err != nil {
+			t.Fatalf("encoded %v fails to decode: %v", v, err)
+		}
+		if !reflect.DeepEqual(v, again) {
+			t.Fatalf("expected %v, got %v", v, again)
+		}
+	})
+}
+
+// Generated attribute values must decode into equal values once encoded.
+func FuzzAttributeValueRoundTrip(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{8, 3, 9, 0, 1, 2, 5, 7, 4, 6, 9, 9, 9, 3})
+	f.Add(bytes.Repeat([]byte{7, 1}, 40))
+	f.Add([]byte{1, 2, 40, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		g := &attributeValueGenerator{b: b}
+		v := g.value(0)
+		enc, err := encodeAttributeValue(v)
+		if err != nil {
+			t.Fatalf("%v fails to encode: %v", v, err)
+		}
+		got, err := decodeAttributeValue(enc)
+		if err != nil {
+			t.Fatalf("%v fails to decode: %v", v, err)
+		}
+		if !equalAttributeValues(v, got) {
+			t.Fatalf("expected %v, got %v", v, got)
+		}
+	})
+}
+
+// Generates attribute values out of fuzzed bytes, each byte read being a choice.
+type attributeValueGenerator struct {
+	b []byte
+}
+
+func (g *attributeValueGenerator) byte() byte {
+	if len(g.b) == 0 {
+		return 0
+	}
+	c := g.b[0]
+	g.b = g.b[1:]
+	return c
+}
+
+func (g *attributeValueGenerator) bytes() []byte {
+	n := int(g.byte()) % 16
+	if n > len(g.b) {
+		n = len(g.b)
+	}
+	b := append([]byte{}, g.b[:n]...)
+	g.b = g.b[n:]
+	return b
+}
+
+func (g *attributeValueGenerator) string() string {
+	return string(g.bytes())
+}
+
+// Returns a number of up to 38 digits, with an exponent within the range of
+// DynamoDB numbers.
+func (g *attributeValueGenerator) number() string {
+	digits := 1 + int(g.byte())%38
+	n := make([]byte, 0, digits+8)
+	if g.byte()%2 == 1 {
+		n = append(n, '-')
+	}
+	for i := 0; i < digits; i++ {
+		n = append(n, '0'+g.byte()%10)
+	}
+	switch g.byte() % 3 {
+	case 1:
+		// keeps the most significant digit within 1E-130 to 1E125
+		n = append(n, 'E')
+		n = strconv.AppendInt(n, int64(minNumberExponent+int(g.byte())%(maxNumberExponent-minNumberExponent+2-digits)), 10)
+	case 2:
+		if digits > 1 {
+			dot := len(n) - 1 - int(g.byte())%(digits-1)
+			n = append(n[:dot], append([]byte{'.'}, n[dot:]...)...)
+		}
+	}
+	return string(n)
+}
+
+func (g *attributeValueGenerator) len() int {
+	return int(g.byte()) % 5
+}
+
+// Returns the length of a set, which cannot be empty.
+func (g *attributeValueGenerator) setLen() int {
+	return 1 + int(g.byte())%4
+}
+
+func (g *attributeValueGenerator) value(depth int) *dynamodb.AttributeValue {
+	kind := g.byte() % 10
+	if depth >= maxNestingDepth-1 && kind >= 6 {
+		kind = 0
+	}
+	switch kind {
+	case 0:
+		return &dynamodb.AttributeValue{S: aws.String(g.string())}
+	case 1:
+		return &dynamodb.AttributeValue{N: aws.String(g.number())}
+	case 2:
+		return &dynamodb.AttributeValue{B: g.bytes()}
+	case 3:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(g.byte()%2 == 0)}
+	case 4:
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+	case 5:
+		switch g.byte() % 3 {
+		// sets skip the members duplicating earlier ones
+		case 0:
+			var ss []*string
+			seen := make(map[string]bool)
+			for i, n := 0, g.setLen(); i < n; i++ {
+				if s := g.string(); !seen[s] {
+					seen[s] = true
+					ss = append(ss, aws.String(s))
+				}
+			}
+			return &dynamodb.AttributeValue{SS: ss}
+		case 1:
+			var ns []*string
+			seen := make(map[string]bool)
+			for i, n := 0, g.setLen(); i < n; i++ {
+				if s := g.number(); !seen[normalizeNumber(s)] {
+					seen[normalizeNumber(s)] = true
+					ns = append(ns, aws.String(s))
+				}
+			}
+			return &dynamodb.AttributeValue{NS: ns}
+		default:
+			var bs [][]byte
+			seen := make(map[string]bool)
+			for i, n := 0, g.setLen(); i < n; i++ {
+				if b := g.bytes(); !seen[string(b)] {
+					seen[string(b)] = true
+					bs = append(bs, b)
+				}
+			}
+			return &dynamodb.AttributeValue{BS: bs}
+		}
+	case 6, 7:
+		l := make([]*dynamodb.AttributeValue, g.len())
+		for i := range l {
+			l[i] = g.value(depth + 1)
+		}
+		return &dynamodb.AttributeValue{L: l}
+	default:
+		m := make(map[string]*dynamodb.AttributeValue)
+		for i, n := 0, g.len(); i < n; i++ {
+			m[g.string()] = g.value(depth + 1)
+		}
+		return &dynamodb.AttributeValue{M: m}
+	}
+}
@@ -0,0 +1,245 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package cbor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden wire-format vectors in testdata")
+
+const goldenAttributeValuesFile = "testdata/attrval.golden"
+
+// Attribute values whose encoding is checked against the golden vectors.
+// Maps have at most one attribute, as attributes are encoded in map order.
+var goldenAttributeValues = []struct {
+	name string
+	val  *dynamodb.AttributeValue
+}{
+	{"string", &dynamodb.AttributeValue{S: aws.String("abc")}},
+	{"empty-string", &dynamodb.AttributeValue{S: aws.String("")}},
+	{"unicode-string", &dynamodb.AttributeValue{S: aws.String("héllo ✓")}},
+	{"long-string", &dynamodb.AttributeValue{S: aws.String(strings.Repeat("x", 300))}},
+	{"zero", &dynamodb.AttributeValue{N: aws.String("0")}},
+	{"int-23", &dynamodb.AttributeValue{N: aws.String("23")}},
+	{"int-24", &dynamodb.AttributeValue{N: aws.String("24")}},
+	{"int-256", &dynamodb.AttributeValue{N: aws.String("256")}},
+	{"int-65536", &dynamodb.AttributeValue{N: aws.String("65536")}},
+	{"int-4294967296", &dynamodb.AttributeValue{N: aws.String("4294967296")}},
+	{"negative-int", &dynamodb.AttributeValue{N: aws.String("-25")}},
+	{"max-int64", &dynamodb.AttributeValue{N: aws.String("9223372036854775807")}},
+	{"min-int64", &dynamodb.AttributeValue{N: aws.String("-9223372036854775808")}},
+	{"max-uint64", &dynamodb.AttributeValue{N: aws.String("18446744073709551615")}},
+	{"min-negint64", &dynamodb.AttributeValue{N: aws.String("-18446744073709551616")}},
+	{"bigint", &dynamodb.AttributeValue{N: aws.String("123456789012345678901234567890")}},
+	{"negative-bigint", &dynamodb.AttributeValue{N: aws.String("-123456789012345678901234567890")}},
+	{"decimal", &dynamodb.AttributeValue{N: aws.String("314E-2")}},
+	{"negative-decimal", &dynamodb.AttributeValue{N: aws.String("-314E-2")}},
+	{"decimal-38-digits", &dynamodb.AttributeValue{N: aws.String("12345678901234567890123456789012345678E-130")}},
+	{"decimal-positive-exponent", &dynamodb.AttributeValue{N: aws.String("1E125")}},
+	{"binary", &dynamodb.AttributeValue{B: []byte{1, 2, 3}}},
+	{"empty-binary", &dynamodb.AttributeValue{B: []byte{}}},
+	{"string-set", &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"abc", "def"})}},
+	{"number-set", &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"1", "-2", "123456789012345678901234567890", "314E-2"})}},
+	{"binary-set", &dynamodb.AttributeValue{BS: [][]byte{{1}, {2, 3}}}},
+	{"list", &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{{S: aws.String("abc")}, {N: aws.String("1")}, {NULL: aws.Bool(true)}}}},
+	{"empty-list", &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}},
+	{"map", &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"k": {BOOL: aws.Bool(true)}}}},
+	{"empty-map", &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{}}},
+	{"nested", &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+		"l": {L: []*dynamodb.AttributeValue{{M: map[string]*dynamodb.AttributeValue{"m": {L: []*dynamodb.AttributeValue{}}}}}},
+	}}},
+	{"deep", deepList(maxNestingDepth - 1)},
+	{"true", &dynamodb.AttributeValue{BOOL: aws.Bool(true)}},
+	{"false", &dynamodb.AttributeValue{BOOL: aws.Bool(false)}},
+	{"null", &dynamodb.AttributeValue{NULL: aws.Bool(true)}},
+}
+
+// Returns an empty list nested in depth lists.
+func deepList(depth int) *dynamodb.AttributeValue {
+	v := &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+	for i := 0; i < depth; i++ {
+		v = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{v}}
+	}
+	return v
+}
+
+// Encodings must not change unintentionally, run with -update to accept new ones.
+func TestAttributeValueGolden(t *testing.T) {
+	if *updateGolden {
+		var buf bytes.Buffer
+		fmt.Fprintln(&buf, "# Wire-format vectors of attribute values: name, then hex encoded CBOR.")
+		for _, g := range goldenAttributeValues {
+			b, err := encodeAttributeValue(g.val)
+			if err != nil {
+				t.Fatalf("%s: %v", g.name, err)
+			}
+			fmt.Fprintf(&buf, "%s %x\n", g.name, b)
+		}
+		if err := ioutil.WriteFile(goldenAttributeValuesFile, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vectors, err := readGoldenVectors(goldenAttributeValuesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range goldenAttributeValues {
+		expected, ok := vectors[g.name]
+		if !ok {
+			t.Errorf("%s: no golden vector, run with -update", g.name)
+			continue
+		}
+		actual, err := encodeAttributeValue(g.val)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", g.name, err)
+			continue
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("%s: expected encoding %x, got %x", g.name, expected, actual)
+		}
+		v, err := decodeAttributeValue(expected)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", g.name, err)
+			continue
+		}
+		if !equalAttributeValues(g.val, v) {
+			t.Errorf("%s: expected %v, got %v", g.name, g.val, v)
+		}
+	}
+}
+
+func readGoldenVectors(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vectors := make(map[string][]byte)
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid golden vector %q", line)
+		}
+		b, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid golden vector %s: %v", fields[0], err)
+		}
+		vectors[fields[0]] = b
+	}
+	return vectors, s.Err()
+}
+
+func encodeAttributeValue(v *dynamodb.AttributeValue) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	defer w.Close()
+	if err := EncodeAttributeValue(v, w); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeAttributeValue(b []byte) (*dynamodb.AttributeValue, error) {
+	r := NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return DecodeAttributeValue(r)
+}
+
+// Reports whether a and b are equal, numbers being compared by value.
+func equalAttributeValues(a, b *dynamodb.AttributeValue) bool {
+	switch {
+	case a.N != nil:
+		return b.N != nil && equalNumbers(*a.N, *b.N)
+	case a.NS != nil:
+		if len(a.NS) != len(b.NS) {
+			return false
+		}
+		for i := range a.NS {
+			if !equalNumbers(*a.NS[i], *b.NS[i]) {
+				return false
+			}
+		}
+		return true
+	case a.B != nil:
+		return b.B != nil && bytes.Equal(a.B, b.B)
+	case a.BS != nil:
+		if b.BS == nil || len(a.BS) != len(b.BS) {
+			return false
+		}
+		for i := range a.BS {
+			if !bytes.Equal(a.BS[i], b.BS[i]) {
+				return false
+			}
+		}
+		return true
+	case a.L != nil:
+		if b.L == nil || len(a.L) != len(b.L) {
+			return false
+		}
+		for i := range a.L {
+			if !equalAttributeValues(a.L[i], b.L[i]) {
+				return false
+			}
+		}
+		return true
+	case a.M != nil:
+		if b.M == nil || len(a.M) != len(b.M) {
+			return false
+		}
+		for k, v := range a.M {
+			w, ok := b.M[k]
+			if !ok || !equalAttributeValues(v, w) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+func equalNumbers(a, b string) bool {
+	x, ok := new(big.Rat).SetString(a)
+	if !ok {
+		return false
+	}
+	y, ok := new(big.Rat).SetString(b)
+	return ok && x.Cmp(y) == 0
+}
@@ -18,9 +18,12 @@ package cbor
 import (
 	"bytes"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"reflect"
 	"testing"
+	"unsafe"
 )
 
 func TestAttrVal(t *testing.T) {
@@ -106,3 +109,139 @@ func TestDecodeIntBoundariesFromCbor(t *testing.T) {
 		}
 	}
 }
+
+func TestItemDecoderSharesNames(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	vals := []*dynamodb.AttributeValue{
+		{M: map[string]*dynamodb.AttributeValue{"name": {S: aws.String("a")}, "nested": {M: map[string]*dynamodb.AttributeValue{"name": {N: aws.String("1")}}}}},
+		{M: map[string]*dynamodb.AttributeValue{"name": {S: aws.String("b")}, "other": {L: []*dynamodb.AttributeValue{{M: map[string]*dynamodb.AttributeValue{"name": {NULL: aws.Bool(true)}}}}}}},
+	}
+	for _, v := range vals {
+		if err := EncodeAttributeValue(v, w); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	w.Flush()
+
+	r := NewReader(&buf)
+	defer r.Close()
+	d := &ItemDecoder{}
+	var names []string
+	for _, v := range vals {
+		rval, err := d.DecodeAttributeValue(r)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(v, rval) {
+			t.Errorf("expected: %v, actual: %v", v, rval)
+		}
+		for k := range rval.M {
+			if k == "name" {
+				names = append(names, k)
+			}
+		}
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 names, got %d", len(names))
+	}
+	data := func(s string) uintptr {
+		return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	}
+	if data(names[0]) != data(names[1]) {
+		t.Errorf("expected repeated names to share their bytes")
+	}
+}
+
+func TestDecodeAttributeValueMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		enc  []byte
+	}{
+		{"too deep", append(bytes.Repeat([]byte{0x81}, 100000), 0x80)},
+		{"number set of a string", fromHex("0xd90cfa826161" + "01")},
+		{"decimal exponent over int32", fromHex("0xc4821a8000000001")},
+		{"decimal exponent under int32", fromHex("0xc4823a8000000001")},
+	}
+	for _, c := range cases {
+		if v, err := decodeAttributeValue(c.enc); err == nil {
+			t.Errorf("%s: expected error, got %v", c.name, v)
+		}
+	}
+}
+
+func TestEncodeAttributeValueInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		val  *dynamodb.AttributeValue
+	}{
+		{"nil string set element", &dynamodb.AttributeValue{SS: []*string{aws.String("a"), nil}}},
+		{"nil number set element", &dynamodb.AttributeValue{NS: []*string{nil}}},
+		{"invalid big number", &dynamodb.AttributeValue{N: aws.String("1234567890123456789x")}},
+		{"nil list element", &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{nil}}},
+	}
+	for _, c := range cases {
+		if b, err := encodeAttributeValue(c.val); err == nil {
+			t.Errorf("%s: expected error, got %x", c.name, b)
+		}
+	}
+}
+
+func TestEncodeAttributeValueSets(t *testing.T) {
+	cases := []struct {
+		name string
+		val  *dynamodb.AttributeValue
+		err  string
+	}{
+		{"empty string set", &dynamodb.AttributeValue{SS: []*string{}}, "An string set  may not be empty"},
+		{"empty number set", &dynamodb.AttributeValue{NS: []*string{}}, "An number set  may not be empty"},
+		{"empty binary set", &dynamodb.AttributeValue{BS: [][]byte{}}, "An binary set  may not be empty"},
+		{"duplicate strings", &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"a", "b", "a"})}, "Input collection [a, b, a] contains duplicates."},
+		{"duplicate numbers", &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"1", "-1", "1.00"})}, "Input collection [1, -1, 1.00] contains duplicates."},
+		{"equal numbers", &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"120", "1.2E2"})}, "Input collection [120, 1.2E2] contains duplicates."},
+		{"duplicate zeros", &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"0", "-0.0"})}, "Input collection [0, -0.0] contains duplicates."},
+		{"duplicate binaries", &dynamodb.AttributeValue{BS: [][]byte{{1, 2}, {1, 2}}}, "Input collection [AQI=, AQI=] contains duplicates."},
+		{"unique strings", &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"a", "A", "a "})}, ""},
+		{"unique numbers", &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"1", "10", "0.1", "-1"})}, ""},
+		{"binaries differing in length", &dynamodb.AttributeValue{BS: [][]byte{{1}, {1, 0}, {}}}, ""},
+	}
+	for _, c := range cases {
+		_, err := encodeAttributeValue(c.val)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != request.InvalidParameterErrCode {
+			t.Errorf("%s: expected %s error, got %v", c.name, request.InvalidParameterErrCode, err)
+			continue
+		}
+		if expected := "One or more parameter values were invalid: " + c.err; aerr.Message() != expected {
+			t.Errorf("%s: expected %q, got %q", c.name, expected, aerr.Message())
+		}
+	}
+}
+
+func TestDecodeAttributeValueSetOrder(t *testing.T) {
+	// sets keep the order of their members on a round trip
+	cases := []*dynamodb.AttributeValue{
+		{SS: aws.StringSlice([]string{"c", "a", "b"})},
+		{NS: aws.StringSlice([]string{"3", "-1", "2"})},
+		{BS: [][]byte{{3}, {1}, {2, 0}, {2}}},
+	}
+	for _, c := range cases {
+		b, err := encodeAttributeValue(c)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		v, err := decodeAttributeValue(b)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(c, v) {
+			t.Errorf("expected %v, got %v", c, v)
+		}
+	}
+}
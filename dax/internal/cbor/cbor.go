@@ -17,6 +17,7 @@ package cbor
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -46,27 +47,29 @@ type Writer struct {
 	recycle bool
 }
 
-var bufferedWriterPool = sync.Pool{
+// Writers over unbuffered streams are pooled along with their buffer.
+var writerPool = sync.Pool{
 	New: func() interface{} {
-		return bufio.NewWriterSize(nil, defaultBufSize)
+		w := &Writer{bw: bufio.NewWriterSize(nil, defaultBufSize), recycle: true}
+		w.buf = w.scratch[:]
+		return w
 	},
 }
 
+// NewWriter returns a Writer writing to w. Unless w is a *bufio.Writer, the Writer
+// is taken from a pool and must be released with Close.
 func NewWriter(w io.Writer) *Writer {
 	// Check if writer is already buffered.
-	bw, ok := w.(*bufio.Writer)
-	if !ok {
-		bw = bufferedWriterPool.Get().(*bufio.Writer)
-		bw.Reset(w)
+	if bw, ok := w.(*bufio.Writer); ok {
+		cw := &Writer{w: w, bw: bw}
+		cw.buf = cw.scratch[:]
+		return cw
 	}
 
-	cw := Writer{
-		w:       w,
-		bw:      bw,
-		recycle: !ok,
-	}
-	cw.buf = cw.scratch[:]
-	return &cw
+	cw := writerPool.Get().(*Writer)
+	cw.w = w
+	cw.bw.Reset(w)
+	return cw
 }
 
 func (w *Writer) Flush() error {
@@ -226,16 +229,22 @@ func (w *Writer) writeType64(typ uint64, ui uint64) error {
 	return err
 }
 
+// Close releases the writer, which must not be used afterwards.
 func (w *Writer) Close() error {
 	if w.recycle {
-		bufferedWriterPool.Put(w.bw)
+		w.w = nil
+		w.bw.Reset(nil)
+		writerPool.Put(w)
 	}
 	return nil
 }
 
-var bufferedReaderPool = sync.Pool{
+// Readers over unbuffered streams are pooled along with their buffer.
+var readerPool = sync.Pool{
 	New: func() interface{} {
-		return bufio.NewReaderSize(nil, defaultBufSize)
+		r := &Reader{br: bufio.NewReaderSize(nil, defaultBufSize), recycle: true}
+		r.buf = r.scratch[:]
+		return r
 	},
 }
 
@@ -246,47 +255,100 @@ type Reader struct {
 	buf     []byte
 	scratch [8]byte
 	recycle bool
+	limited io.LimitedReader // source of readers returned by BytesReader
 }
 
+// NewReader returns a Reader reading from r. Unless r is a *bufio.Reader, the Reader
+// is taken from a pool and must be released with Close.
 func NewReader(r io.Reader) *Reader {
-	br, ok := r.(*bufio.Reader)
-	if !ok {
-		br = bufferedReaderPool.Get().(*bufio.Reader)
-		br.Reset(r)
-	}
-	rdr := Reader{
-		r:       r,
-		br:      br,
-		recycle: !ok,
+	if br, ok := r.(*bufio.Reader); ok {
+		rdr := &Reader{r: r, br: br}
+		rdr.buf = rdr.scratch[:]
+		return rdr
 	}
-	rdr.buf = rdr.scratch[:]
-	return &rdr
+
+	rdr := readerPool.Get().(*Reader)
+	rdr.r = r
+	rdr.br.Reset(r)
+	return rdr
 }
 
 func (r *Reader) ReadString() (string, error) {
+	value, err := r.readStringHeader()
+	if err != nil || value == 0 {
+		return "", err
+	}
+	return r.readStringValue(value)
+}
+
+// Strings up to this length are looked up while still in the read buffer.
+const maxInternedLen = 256
+
+// Reads a string like ReadString, returning the string from names if an equal one was read before.
+func (r *Reader) readInternedString(names map[string]string) (string, error) {
+	value, err := r.readStringHeader()
+	if err != nil || value == 0 {
+		return "", err
+	}
+	if value <= maxInternedLen {
+		if b, err := r.br.Peek(int(value)); err == nil {
+			s, ok := names[string(b)]
+			if !ok {
+				s = string(b)
+				names[s] = s
+			}
+			_, err = r.br.Discard(len(b))
+			return s, err
+		}
+	}
+	return r.readStringValue(value)
+}
+
+func (r *Reader) readStringHeader() (int, error) {
 	// TODO skip tags, indef length strings
 	hdr, value, err := r.readTypeHeader()
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 	if err = r.verifyMajorType(hdr, Utf); err != nil {
-		return "", err
+		return 0, err
 	}
 	if value > maxObjLenBytes {
-		return "", ErrObjTooBig
+		return 0, ErrObjTooBig
 	} else if value < 0 {
-		return "", ErrNegLength
-	} else if value == 0 {
-		return "", nil
+		return 0, ErrNegLength
 	}
-	b := make([]byte, value)
-	_, err = io.ReadFull(r.br, b)
+	return int(value), nil
+}
+
+func (r *Reader) readStringValue(value int) (string, error) {
+	b, err := r.readFull(uint64(value))
 	if err != nil {
 		return "", err
 	}
 	return string(b), err
 }
 
+// Lengths up to this size are allocated upfront, larger ones as the data arrives.
+const maxPresizedRead = 64 * 1024
+
+// Reads exactly n bytes, with the same errors as io.ReadFull.
+// A corrupt length doesn't allocate more memory than the data actually read.
+func (r *Reader) readFull(n uint64) ([]byte, error) {
+	if n <= maxPresizedRead {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r.br, b)
+		return b, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(maxPresizedRead)
+	read, err := io.CopyN(&buf, r.br, int64(n))
+	if err == io.EOF && read > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), err
+}
+
 func (r *Reader) ReadRawBytes(o io.Writer) error {
 	hdr, value, err := r.readRawTypeHeader(o)
 	if err != nil {
@@ -318,8 +380,7 @@ func (r *Reader) ReadBytes() ([]byte, error) {
 	} else if value == 0 {
 		return []byte{}, nil
 	}
-	b := make([]byte, value)
-	_, err = io.ReadFull(r.br, b)
+	b, err := r.readFull(value)
 	if err != nil {
 		return nil, err
 	}
@@ -336,8 +397,11 @@ func (r *Reader) BytesReader() (*Reader, error) {
 		return nil, err
 	}
 	// TODO avoid double buffering
-	lr := io.LimitReader(r.br, int64(value))
-	return NewReader(lr), nil
+	rdr := readerPool.Get().(*Reader)
+	rdr.limited = io.LimitedReader{R: r.br, N: int64(value)}
+	rdr.r = &rdr.limited
+	rdr.br.Reset(rdr.r)
+	return rdr, nil
 }
 
 func (r *Reader) ReadMapLength() (int, error) {
@@ -373,6 +437,18 @@ func (r *Reader) ReadArrayLength() (int, error) {
 	return int(value), err
 }
 
+// ReadTag reads a tag header and returns its tag number.
+func (r *Reader) ReadTag() (uint64, error) {
+	hdr, value, err := r.readTypeHeader()
+	if err != nil {
+		return 0, err
+	}
+	if err = r.verifyMajorType(hdr, Tag); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
 func (r *Reader) ReadFloat64() (float64, error) {
 	hdr, value, err := r.readTypeHeader()
 	if err != nil {
@@ -383,15 +459,14 @@ func (r *Reader) ReadFloat64() (float64, error) {
 		//return math.Float64frombits(value), nil
 		return float64(value), nil
 	case NegInt:
-		return float64(^value), nil
+		return -float64(value) - 1, nil
 	case Simple:
 	default:
 		return 0, ErrNaN
 	}
 	switch hdr & MinorTypeMask {
 	case Float16 & MinorTypeMask:
-		// TODO b16 to b32
-		panic("unimpl")
+		return float16ToFloat64(uint16(value)), nil
 	case Float32 & MinorTypeMask:
 		return float64(math.Float32frombits(uint32(value))), nil
 	case Float64 & MinorTypeMask:
@@ -540,9 +615,18 @@ func (r *Reader) ReadCborIntegerToString() (string, error) {
 	}
 }
 
+// Buffered returns the number of bytes read from the underlying reader but not yet consumed.
+func (r *Reader) Buffered() int {
+	return r.br.Buffered()
+}
+
+// Close releases the reader, which must not be used afterwards.
 func (r *Reader) Close() error {
 	if r.recycle {
-		bufferedReaderPool.Put(r.br)
+		r.r = nil
+		r.limited = io.LimitedReader{}
+		r.br.Reset(nil)
+		readerPool.Put(r)
 	}
 	return nil
 }
@@ -24,6 +24,7 @@ import (
 	"math/big"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -493,6 +494,52 @@ func TestCborFloat64(t *testing.T) {
 	}
 }
 
+func TestCborReadFloat64(t *testing.T) {
+	// Only float64 values are written, but other encoders may use any
+	// precision or integers for whole numbers.
+	values := []struct {
+		value float64
+		cbor  []byte
+	}{
+		// Examples from rfc7409: https://tools.ietf.org/html/rfc7049#appendix-A
+		{0.0, fromHex("0xf90000")},
+		{math.Copysign(0, -1), fromHex("0xf98000")},
+		{1.0, fromHex("0xf93c00")},
+		{1.5, fromHex("0xf93e00")},
+		{65504.0, fromHex("0xf97bff")},
+		{5.960464477539063e-8, fromHex("0xf90001")},
+		{0.00006103515625, fromHex("0xf90400")},
+		{-4.0, fromHex("0xf9c400")},
+		{math.Inf(0), fromHex("0xf97c00")},
+		{math.NaN(), fromHex("0xf97e00")},
+		{math.Inf(-1), fromHex("0xf9fc00")},
+		{100000.0, fromHex("0xfa47c35000")},
+		{3.4028234663852886e+38, fromHex("0xfa7f7fffff")},
+		{math.Inf(0), fromHex("0xfa7f800000")},
+		{math.NaN(), fromHex("0xfa7fc00000")},
+		{math.Inf(-1), fromHex("0xfaff800000")},
+		{0, fromHex("0x00")},
+		{1000000, fromHex("0x1a000f4240")},
+		{-1, fromHex("0x20")},
+		{-1000, fromHex("0x3903e7")},
+		{-18446744073709551616, fromHex("0x3bffffffffffffffff")},
+	}
+
+	for _, tt := range values {
+		r := NewReader(bytes.NewReader(tt.cbor))
+		v, err := r.ReadFloat64()
+		if err != nil {
+			t.Errorf("ReadFloat64(%x) error = %v, want = nil", tt.cbor, err)
+		} else if math.IsNaN(tt.value) {
+			if !math.IsNaN(v) {
+				t.Errorf("ReadFloat64(%x) want NaN got %v", tt.cbor, v)
+			}
+		} else if v != tt.value || math.Signbit(v) != math.Signbit(tt.value) {
+			t.Errorf("ReadFloat64(%x) got %v want %v", tt.cbor, v, tt.value)
+		}
+	}
+}
+
 func TestCborMap(t *testing.T) {
 	var buf bytes.Buffer
 	w := NewWriter(&buf)
@@ -706,3 +753,108 @@ func benchmarkDecodeInt(value int, b *testing.B) {
 		br.Seek(0, 0)
 	}
 }
+
+// Writes each payload as a nested byte string and reads it back through pooled writers and readers.
+func roundTripNested(payloads [][]byte) error {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, p := range payloads {
+		var nested bytes.Buffer
+		nw := NewWriter(&nested)
+		if err := nw.WriteBytes(p); err != nil {
+			return err
+		}
+		if err := nw.Flush(); err != nil {
+			return err
+		}
+		nw.Close()
+		if err := w.WriteBytes(nested.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.Close()
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	defer r.Close()
+	for i, p := range payloads {
+		nr, err := r.BytesReader()
+		if err != nil {
+			return err
+		}
+		b, err := nr.ReadBytes()
+		nr.Close()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(p, b) {
+			return fmt.Errorf("payload %d: expected %d bytes starting with %x, got %d bytes starting with %x",
+				i, len(p), p[:1], len(b), b[:1])
+		}
+	}
+	return nil
+}
+
+func TestCborPooledReadersAndWritersConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				// mix payloads smaller and larger than the pooled buffers
+				sizes := []int{1, 100, defaultBufSize - 1, 3*defaultBufSize + 7, 256 * 1024}
+				payloads := make([][]byte, len(sizes))
+				for j, size := range sizes {
+					payloads[j] = bytes.Repeat([]byte{byte(g*len(sizes) + j)}, size)
+				}
+				if err := roundTripNested(payloads); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func BenchmarkCborNestedRoundTrip(b *testing.B) {
+	payloads := [][]byte{[]byte("key"), bytes.Repeat([]byte{1}, 1024), bytes.Repeat([]byte{2}, 100)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := roundTripNested(payloads); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCborTag(t *testing.T) {
+	for _, tag := range []uint64{TagDecimal, 23, 24, 255, 256, 1 << 20} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.WriteTag(tag)
+		w.WriteString("value")
+		w.Flush()
+
+		r := NewReader(&buf)
+		rt, err := r.ReadTag()
+		if err != nil || rt != tag {
+			t.Errorf("ReadTag() = %v, %v, want %v", rt, err, tag)
+		}
+		if s, err := r.ReadString(); err != nil || s != "value" {
+			t.Errorf("ReadString() = %v, %v, want value", s, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteString("value")
+	w.Flush()
+	r := NewReader(&buf)
+	exp := awserr.New(request.ErrCodeSerialization, fmt.Sprintf("cbor: expected major type %d, got %d", Tag, Utf), nil)
+	if _, err := r.ReadTag(); !reflect.DeepEqual(exp, err) {
+		t.Errorf("expected %v, got %v", exp, err)
+	}
+}
@@ -16,11 +16,19 @@
 package cbor
 
 import (
+	"math"
 	"math/big"
 	"strconv"
 	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 )
 
+// ErrDecimalExponentRange is returned when decoding a decimal whose exponent
+// does not fit in 32 bits.
+var ErrDecimalExponentRange = awserr.New(request.ErrCodeSerialization, "cbor: decimal exponent out of range", nil)
+
 // Decimal represents an arbitrary-precision signed decimal number. It consists
 // of an arbitrary precision integer unscaled value and a scale. If zero or
 // positive, the scale is the number of digits to the right of the decimal
@@ -149,14 +157,18 @@ func (r *Reader) ReadDecimal() (*Decimal, error) {
 		case TagDecimal:
 			size, err := r.ReadArrayLength()
 			if err == nil && size == 2 {
-				var scale int
+				var scale int64
 				var v *big.Int
-				scale, err = r.ReadInt()
+				scale, err = r.ReadInt64()
+				if err == nil && (scale < math.MinInt32 || scale > math.MaxInt32) {
+					// exponents are parsed as 32 bits by SetString
+					err = ErrDecimalExponentRange
+				}
 				if err == nil {
 					v, err = r.ReadBigInt()
 				}
 				if err == nil {
-					return NewDecimal(v, -scale), nil
+					return NewDecimal(v, int(-scale)), nil
 				}
 			}
 			if err != nil {
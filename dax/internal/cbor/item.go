@@ -65,7 +65,7 @@ func GetEncodedItemKey(item map[string]*dynamodb.AttributeValue, keydef []dynamo
 			if hkval.N == nil {
 				return nil, ErrMissingKey
 			}
-			if err := EncodeAttributeValue(hkval, w); err != nil {
+			if err := EncodeAttribute(*hk.AttributeName, hkval, w); err != nil {
 				return nil, err
 			}
 		case dynamodb.ScalarAttributeTypeB:
@@ -93,7 +93,7 @@ func GetEncodedItemKey(item map[string]*dynamodb.AttributeValue, keydef []dynamo
 			if hkval.N == nil {
 				return nil, ErrMissingKey
 			}
-			if err := EncodeAttributeValue(hkval, w); err != nil {
+			if err := EncodeAttribute(*hk.AttributeName, hkval, w); err != nil {
 				return nil, err
 			}
 		case dynamodb.ScalarAttributeTypeB:
@@ -127,6 +127,9 @@ func GetEncodedItemKey(item map[string]*dynamodb.AttributeValue, keydef []dynamo
 			if n == nil {
 				return nil, ErrMissingKey
 			}
+			if reason := checkNumber(*n); reason != "" {
+				return nil, &NumberError{Path: *rk.AttributeName, Value: *n, Reason: reason}
+			}
 			d := new(Decimal)
 			d, ok := d.SetString(*n)
 			if !ok {
@@ -156,7 +159,7 @@ func GetEncodedItemKey(item map[string]*dynamodb.AttributeValue, keydef []dynamo
 
 func DecodeItemKey(reader *Reader, keydef []dynamodb.AttributeDefinition) (map[string]*dynamodb.AttributeValue, error) {
 	hk := keydef[0]
-	keys := make(map[string]*dynamodb.AttributeValue)
+	keys := make(map[string]*dynamodb.AttributeValue, len(keydef))
 
 	if len(keydef) == 1 {
 		switch *hk.AttributeType {
@@ -277,8 +280,8 @@ func EncodeItemNonKeyAttributes(ctx aws.Context, item map[string]*dynamodb.Attri
 	if err = writer.WriteInt64(id.(int64)); err != nil {
 		return err
 	}
-	for _, v := range nonKeyAttrValues {
-		if err := EncodeAttributeValue(v, writer); err != nil {
+	for i, v := range nonKeyAttrValues {
+		if err := EncodeAttribute(nonKeyAttrNames[i], v, writer); err != nil {
 			return err
 		}
 	}
@@ -287,6 +290,11 @@ func EncodeItemNonKeyAttributes(ctx aws.Context, item map[string]*dynamodb.Attri
 }
 
 func DecodeItemNonKeyAttributes(ctx aws.Context, reader *Reader, attrListIdToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error) {
+	var d *ItemDecoder
+	return d.DecodeItemNonKeyAttributes(ctx, reader, attrListIdToNames)
+}
+
+func (d *ItemDecoder) DecodeItemNonKeyAttributes(ctx aws.Context, reader *Reader, attrListIdToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error) {
 	id, err := reader.ReadInt64()
 	if err != nil {
 		return nil, err
@@ -296,9 +304,11 @@ func DecodeItemNonKeyAttributes(ctx aws.Context, reader *Reader, attrListIdToNam
 		return nil, err
 	}
 
-	attrs := make(map[string]*dynamodb.AttributeValue)
-	for _, n := range attrNames.([]string) {
-		av, err := DecodeAttributeValue(reader)
+	names := attrNames.([]string)
+	// leave room for the key attributes that callers add to the item
+	attrs := make(map[string]*dynamodb.AttributeValue, len(names)+2)
+	for _, n := range names {
+		av, err := d.DecodeAttributeValue(reader)
 		if err != nil {
 			return nil, err
 		}
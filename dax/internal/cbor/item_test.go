@@ -191,6 +191,51 @@ func TestItemKey(t *testing.T) {
 	}
 }
 
+func TestItemKeyRoundTrip(t *testing.T) {
+	values := map[string][]*dynamodb.AttributeValue{
+		dynamodb.ScalarAttributeTypeS: {{S: aws.String("a")}, {S: aws.String("\x00b")}},
+		dynamodb.ScalarAttributeTypeN: {{N: aws.String("-1")}, {N: aws.String("0")}, {N: aws.String("25E-1")},
+			{N: aws.String("123456789012345678901234567890")}, {N: aws.String("-9E-130")}, {N: aws.String("1E125")}},
+		dynamodb.ScalarAttributeTypeB: {{B: []byte{0}}, {B: []byte{1, 0}}, {B: []byte{0xff, 0xfe}}, {B: []byte{0x80}}},
+	}
+	types := []string{dynamodb.ScalarAttributeTypeS, dynamodb.ScalarAttributeTypeN, dynamodb.ScalarAttributeTypeB}
+
+	for _, hkt := range types {
+		for _, rkt := range append([]string{""}, types...) {
+			keydef := []dynamodb.AttributeDefinition{{AttributeName: aws.String("hk"), AttributeType: aws.String(hkt)}}
+			rks := []*dynamodb.AttributeValue{nil}
+			if rkt != "" {
+				keydef = append(keydef, dynamodb.AttributeDefinition{AttributeName: aws.String("rk"), AttributeType: aws.String(rkt)})
+				rks = values[rkt]
+			}
+			for _, hk := range values[hkt] {
+				for _, rk := range rks {
+					key := map[string]*dynamodb.AttributeValue{"hk": hk}
+					if rk != nil {
+						key["rk"] = rk
+					}
+					var buf bytes.Buffer
+					w := NewWriter(&buf)
+					if err := EncodeItemKey(key, keydef, w); err != nil {
+						t.Fatalf("unexpected error %v for %v", err, key)
+					}
+					if err := w.Flush(); err != nil {
+						t.Fatalf("unexpected error %v for %v", err, key)
+					}
+					actual, err := DecodeItemKey(NewReader(&buf), keydef)
+					if err != nil {
+						t.Errorf("unexpected error %v for %v", err, key)
+						continue
+					}
+					if !reflect.DeepEqual(key, actual) {
+						t.Errorf("expected %v, got %v", key, actual)
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestItemNonKeyAttributes(t *testing.T) {
 	keydef := []dynamodb.AttributeDefinition{
 		{AttributeName: aws.String("hks"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
@@ -243,7 +243,7 @@ func decode(reader BytesReader, xormask int) (*Decimal, error) {
 		if err != nil {
 			return nil, err
 		}
-		exponent = v ^ xormask ^ 0x7fffffff
+		exponent = int(int32(uint32(v) ^ uint32(xormask) ^ 0x7fffffff))
 
 	case 0x81, 0xfe:
 		digitAdjust = 12
@@ -251,7 +251,8 @@ func decode(reader BytesReader, xormask int) (*Decimal, error) {
 		if err != nil {
 			return nil, err
 		}
-		exponent = v ^ xormask ^ 0x80000000
+		// the exponent is xored as an int32, which must not be sign extended first
+		exponent = int(int32(uint32(v) ^ uint32(xormask) ^ 0x80000000))
 
 	default:
 		exponent = (int(b) ^ xormask) & 0xff
@@ -348,12 +349,11 @@ func encodeInt32BE(v int, writer BytesWriter) error {
 
 func decodeInt32BE(reader BytesReader) (int, error) {
 	var bytes [4]byte
-	len, err := reader.Read(bytes[:])
-	if err != nil {
-		return len, nil
-	}
-	if len != 4 {
-		return len, awserr.New(request.ErrCodeSerialization, "incomplete lexdecimal", nil)
+	if _, err := io.ReadFull(reader, bytes[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, awserr.New(request.ErrCodeSerialization, "incomplete lexdecimal", err)
+		}
+		return 0, err
 	}
 	v := int32(binary.BigEndian.Uint32(bytes[:]))
 	return int(v), nil
@@ -128,6 +128,62 @@ func TestLexDecimal(t *testing.T) {
 	}
 }
 
+func TestLexDecimalExponentRange(t *testing.T) {
+	// exponents outside -62..61 are encoded in four bytes following the header
+	cases := []struct {
+		in, out string
+	}{
+		{in: "-9.9999999999999999999999999999999999999E+125", out: "-99999999999999999999999999999999999999E88"},
+		{in: "-1E125", out: "-1E125"},
+		{in: "-1E62", out: "-1E62"},
+		{in: "-1E61", out: "-1E61"},
+		{in: "-1E-62", out: "-1E-62"},
+		{in: "-1E-63", out: "-1E-63"},
+		{in: "-1E-130", out: "-1E-130"},
+		{in: "1E-130", out: "1E-130"},
+		{in: "123E-100", out: "123E-100"},
+		{in: "1E-63", out: "1E-63"},
+		{in: "1E-62", out: "1E-62"},
+		{in: "1E61", out: "1E61"},
+		{in: "1E62", out: "1E62"},
+		{in: "25E99", out: "25E99"},
+		{in: "1E125", out: "1E125"},
+		{in: "9.9999999999999999999999999999999999999E+125", out: "99999999999999999999999999999999999999E88"},
+	}
+
+	var last []byte
+	for _, c := range cases {
+		var buf bytes.Buffer
+		var dec Decimal
+		dec.SetString(c.in)
+		if _, err := EncodeLexDecimal(&dec, &buf); err != nil {
+			t.Errorf("unexpected encoding error %v for %s", err, c.in)
+			continue
+		}
+		encoded := append([]byte{}, buf.Bytes()...)
+		if last != nil && bytes.Compare(last, encoded) >= 0 {
+			t.Errorf("expected %v to be greater than last", c.in)
+		}
+		last = encoded
+
+		actual, err := DecodeLexDecimal(&buf)
+		if err != nil {
+			t.Errorf("unexpected decoding error %v for %s", err, c.in)
+			continue
+		}
+		if c.out != actual.String() {
+			t.Errorf("expected=%s, actual=%v", c.out, actual)
+		}
+
+		// truncated exponents are reported rather than decoded as zero
+		if encoded[0] == 0x01 || encoded[0] == 0x7e || encoded[0] == 0x81 || encoded[0] == 0xfe {
+			if _, err := DecodeLexDecimal(bytes.NewBuffer(encoded[:3])); err == nil {
+				t.Errorf("expected error decoding truncated %x", encoded[:3])
+			}
+		}
+	}
+}
+
 func BenchmarkLexDecimalEncode(b *testing.B) {
 	dec := new(Decimal)
 	dec.SetString("123456789.123")
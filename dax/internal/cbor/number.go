@@ -0,0 +1,172 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package cbor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Limits of the numbers DynamoDB can store: up to 38 significant digits,
+// with magnitudes from 1E-130 to 9.9999999999999999999999999999999999999E+125.
+const (
+	maxNumberPrecision = 38
+	maxNumberExponent  = 125
+	minNumberExponent  = -130
+)
+
+// NumberError is returned when encoding a number DynamoDB cannot store.
+type NumberError struct {
+	Path   string // path of the number in the attribute, eg: "a.b[2]", empty if unknown
+	Value  string
+	Reason string
+}
+
+func (e *NumberError) Error() string {
+	return awserr.SprintError(e.Code(), e.Message(), "", nil)
+}
+
+func (e *NumberError) Code() string {
+	return request.InvalidParameterErrCode
+}
+
+func (e *NumberError) Message() string {
+	if e.Path == "" {
+		return fmt.Sprintf("invalid number %q: %s", e.Value, e.Reason)
+	}
+	return fmt.Sprintf("invalid number %q at %s: %s", e.Value, e.Path, e.Reason)
+}
+
+func (e *NumberError) OrigErr() error {
+	return nil
+}
+
+// EncodeAttribute encodes the value of the named attribute, naming it in the
+// path of any NumberError.
+func EncodeAttribute(name string, value *dynamodb.AttributeValue, writer *Writer) error {
+	return withPathElement(EncodeAttributeValue(value, writer), name)
+}
+
+// withPathElement prefixes the path of a NumberError with a map key or a
+// list index formatted as "[i]".
+func withPathElement(err error, element string) error {
+	ne, ok := err.(*NumberError)
+	if !ok {
+		return err
+	}
+	switch {
+	case ne.Path == "":
+		ne.Path = element
+	case ne.Path[0] == '[':
+		ne.Path = element + ne.Path
+	default:
+		ne.Path = element + "." + ne.Path
+	}
+	return ne
+}
+
+// checkNumber returns why DynamoDB cannot store the number, or "" if it can.
+func checkNumber(val string) string {
+	_, _, _, reason := parseNumber(val)
+	return reason
+}
+
+// NormalizeNumber returns the same string for numbers DynamoDB considers equal,
+// eg: "1", "1.0" and "10E-1", or false if DynamoDB cannot store the number.
+func NormalizeNumber(val string) (string, bool) {
+	if checkNumber(val) != "" {
+		return "", false
+	}
+	return normalizeNumber(val), true
+}
+
+// normalizeNumber returns the same string for numbers DynamoDB considers equal,
+// eg: "1", "1.0" and "10E-1". The number must be valid.
+func normalizeNumber(val string) string {
+	neg, digits, exp, _ := parseNumber(val)
+	if digits == "" {
+		return "0"
+	}
+	n := digits + "E" + strconv.Itoa(exp)
+	if neg {
+		return "-" + n
+	}
+	return n
+}
+
+// parseNumber splits a number into its sign, its significant digits without
+// leading or trailing zeros, empty for zero, and the exponent of the last
+// digit, eg: "-1.50" is (true, "15", -1). The reason is why DynamoDB cannot
+// store the number, or "" if it can.
+func parseNumber(val string) (neg bool, digits string, exp int, reason string) {
+	s := val
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		neg = s[0] == '-'
+		s = s[1:]
+	}
+	switch strings.ToLower(s) {
+	case "nan", "inf", "infinity":
+		return neg, "", 0, "NaN and Infinity are not supported"
+	}
+
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+				return neg, "", 0, "exponent out of range"
+			}
+			return neg, "", 0, "not a number"
+		}
+		exp, s = e, s[:i]
+	}
+
+	digits = s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		exp -= len(s) - i - 1
+	}
+	if len(digits) == 0 {
+		return neg, "", 0, "not a number"
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return neg, "", 0, "not a number"
+		}
+	}
+
+	digits = strings.TrimLeft(digits, "0")
+	if len(digits) == 0 {
+		return false, "", 0, ""
+	}
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	digits = trimmed
+	if len(digits) > maxNumberPrecision {
+		return neg, digits, exp, fmt.Sprintf("more than %d significant digits", maxNumberPrecision)
+	}
+	// exponent of the most significant digit, eg: 2 for 123
+	if top := exp + len(digits) - 1; top > maxNumberExponent {
+		return neg, digits, exp, "magnitude larger than 9.9999999999999999999999999999999999999E+125"
+	} else if top < minNumberExponent {
+		return neg, digits, exp, "magnitude smaller than 1E-130"
+	}
+	return neg, digits, exp, ""
+}
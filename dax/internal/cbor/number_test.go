@@ -0,0 +1,146 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package cbor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestCheckNumber(t *testing.T) {
+	cases := []struct {
+		val    string
+		reason string
+	}{
+		{"0", ""},
+		{"-0", ""},
+		{"+12", ""},
+		{"0.000", ""},
+		{"1.5e3", ""},
+		{"12345678901234567890123456789012345678", ""},
+		{"1234567890123456789012345678901234567800000", ""},
+		{"0.00012345678901234567890123456789012345678", ""},
+		{"9.9999999999999999999999999999999999999E+125", ""},
+		{"-9.9999999999999999999999999999999999999E+125", ""},
+		{"99999999999999999999999999999999999999E88", ""},
+		{"1E-130", ""},
+		{"-1E-130", ""},
+		{"10E-131", ""},
+		{"0E999999", ""},
+
+		{"NaN", "NaN and Infinity are not supported"},
+		{"-Infinity", "NaN and Infinity are not supported"},
+		{"inf", "NaN and Infinity are not supported"},
+		{"", "not a number"},
+		{"-", "not a number"},
+		{".", "not a number"},
+		{"1.2.3", "not a number"},
+		{"1e", "not a number"},
+		{"0x10", "not a number"},
+		{"1,000", "not a number"},
+		{" 1", "not a number"},
+		{"123456789012345678901234567890123456789", "more than 38 significant digits"},
+		{"1.23456789012345678901234567890123456789", "more than 38 significant digits"},
+		{"1E126", "magnitude larger than 9.9999999999999999999999999999999999999E+125"},
+		{"-10E125", "magnitude larger than 9.9999999999999999999999999999999999999E+125"},
+		{"1E-131", "magnitude smaller than 1E-130"},
+		{"0.1E-130", "magnitude smaller than 1E-130"},
+		{"1E99999999999999999999", "exponent out of range"},
+	}
+	for _, c := range cases {
+		if reason := checkNumber(c.val); reason != c.reason {
+			t.Errorf("expected %q, got %q for %q", c.reason, reason, c.val)
+		}
+	}
+}
+
+func TestEncodeAttributeValueNumberError(t *testing.T) {
+	cases := []struct {
+		name string
+		val  *dynamodb.AttributeValue
+		path string
+	}{
+		{"number", &dynamodb.AttributeValue{N: aws.String("NaN")}, "n"},
+		{"number set", &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"1", "NaN"})}, "n"},
+		{"list", &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{{S: aws.String("a")}, {N: aws.String("NaN")}}}, "n[1]"},
+		{"map", &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"m": {N: aws.String("NaN")}}}, "n.m"},
+		{"nested", &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+			"m": {L: []*dynamodb.AttributeValue{{L: []*dynamodb.AttributeValue{{M: map[string]*dynamodb.AttributeValue{
+				"k": {NS: aws.StringSlice([]string{"NaN"})},
+			}}}}}},
+		}}, "n.m[0][0].k"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		err := EncodeAttribute("n", c.val, w)
+		ne, ok := err.(*NumberError)
+		if !ok {
+			t.Errorf("%s: expected NumberError, got %v", c.name, err)
+			continue
+		}
+		if ne.Path != c.path || ne.Value != "NaN" {
+			t.Errorf("%s: expected NaN at %s, got %s at %s", c.name, c.path, ne.Value, ne.Path)
+		}
+		if !strings.Contains(ne.Error(), "NaN and Infinity are not supported") {
+			t.Errorf("%s: expected the rule violated in %q", c.name, ne.Error())
+		}
+	}
+}
+
+func TestEncodeItemKeyNumberError(t *testing.T) {
+	keydef := []dynamodb.AttributeDefinition{
+		{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+		{AttributeName: aws.String("rk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+	}
+	cases := []struct {
+		item map[string]*dynamodb.AttributeValue
+		path string
+	}{
+		{map[string]*dynamodb.AttributeValue{"hk": {N: aws.String("Infinity")}, "rk": {N: aws.String("1")}}, "hk"},
+		{map[string]*dynamodb.AttributeValue{"hk": {N: aws.String("1")}, "rk": {N: aws.String("Infinity")}}, "rk"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		err := EncodeItemKey(c.item, keydef, NewWriter(&buf))
+		if ne, ok := err.(*NumberError); !ok || ne.Path != c.path {
+			t.Errorf("expected NumberError at %s, got %v", c.path, err)
+		}
+	}
+}
+
+func TestNormalizeNumber(t *testing.T) {
+	cases := []struct {
+		vals []string
+		norm string
+	}{
+		{[]string{"0", "-0", "0.00", "0E10"}, "0"},
+		{[]string{"1", "1.0", "+1", "10E-1", "0.1E1"}, "1E0"},
+		{[]string{"-120", "-1.2E2", "-0120.0"}, "-12E1"},
+		{[]string{"0.05", "5E-2"}, "5E-2"},
+	}
+	for _, c := range cases {
+		for _, v := range c.vals {
+			if norm := normalizeNumber(v); norm != c.norm {
+				t.Errorf("expected %s, got %s for %s", c.norm, norm, v)
+			}
+		}
+	}
+}
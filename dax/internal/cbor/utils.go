@@ -29,3 +29,26 @@ func isNaN(f float64) bool {
 	x := math.Float64bits(f)
 	return uint32(x>>shift)&mask == mask && x != uvinf && x != uvneginf
 }
+
+// Converts an IEEE 754 half-precision float, as in RFC 7049 Appendix D.
+func float16ToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = math.Copysign(v, -1)
+	}
+	return v
+}
@@ -0,0 +1,232 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"hash/fnv"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ringPointsPerNode is the number of points of each node on the hash ring of
+// Config.KeyAffinityRouting. More points spread the keys more evenly.
+const ringPointsPerNode = 100
+
+// A consistent hash ring of the nodes of a cluster: a key belongs to the node
+// of the first point at or after its hash, so adding or removing a node only
+// moves the keys of its own points.
+type hashRing struct {
+	points []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash   uint64
+	addr   string
+	client DaxAPI
+}
+
+// Returns the ring of nodes, or nil if there are none.
+func newHashRing(nodes map[hostPort]DaxAPI) *hashRing {
+	if len(nodes) == 0 {
+		return nil
+	}
+	points := make([]ringPoint, 0, len(nodes)*ringPointsPerNode)
+	for hp, client := range nodes {
+		addr := net.JoinHostPort(hp.host, strconv.Itoa(hp.port))
+		for i := 0; i < ringPointsPerNode; i++ {
+			points = append(points, ringPoint{hash: hashString(addr + "#" + strconv.Itoa(i)), addr: addr, client: client})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return points[i].addr < points[j].addr
+	})
+	return &hashRing{points: points}
+}
+
+// Returns the node of h, or the next node of the ring if it is skip or
+// unhealthy. If no other node is healthy, returns the next node other than
+// skip, or the node of h if there is none.
+func (r *hashRing) node(h uint64, skip DaxAPI, unhealthy func(DaxAPI) bool) DaxAPI {
+	n := len(r.points)
+	i := sort.Search(n, func(i int) bool { return r.points[i].hash >= h })
+	fallback := -1
+	for k := 0; k < n; k++ {
+		j := (i + k) % n
+		p := r.points[j]
+		if p.client == skip {
+			continue
+		}
+		if unhealthy == nil || !unhealthy(p.client) {
+			return p.client
+		}
+		if fallback < 0 {
+			fallback = j
+		}
+	}
+	if fallback >= 0 {
+		return r.points[fallback].client
+	}
+	return r.points[i%n].client
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	// fnv spreads similar strings poorly, mix the bits (splitmix64 finalizer)
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Returns the client of the node of h on the ring, or the next node if it is
+// prev or its last attempt failed to reach it.
+func (c *cluster) affinityClient(h uint64, prev DaxAPI) (DaxAPI, error) {
+	c.lock.RLock()
+	ring, states := c.ring, c.states
+	c.lock.RUnlock()
+	if ring == nil {
+		return c.client(prev)
+	}
+	return ring.node(h, prev, func(client DaxAPI) bool {
+		s := states[client]
+		return s != nil && atomic.LoadInt32(&s.failures) > 0
+	}), nil
+}
+
+// Returns the key schema of table if one of the nodes has it cached.
+func (c *cluster) cachedKeySchema(table string) ([]dynamodb.AttributeDefinition, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, route := range c.routes {
+		if p, ok := route.(interface {
+			cachedKeySchema(string) ([]dynamodb.AttributeDefinition, bool)
+		}); ok {
+			if keys, ok := p.cachedKeySchema(table); ok && len(keys) > 0 {
+				return keys, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Returns the statistics of each node by "host:port" address.
+func (c *cluster) nodeStats() map[string]Stats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	stats := make(map[string]Stats, len(c.active))
+	for hp, client := range c.active {
+		if p, ok := client.(statsProvider); ok {
+			stats[net.JoinHostPort(hp.host, strconv.Itoa(hp.port))] = p.Stats()
+		}
+	}
+	return stats
+}
+
+// Returns the pick of the requests for the partition key of hash h.
+func (cc *ClusterDaxClient) affinityPick(h uint64) func(prev DaxAPI) (DaxAPI, error) {
+	atomic.AddInt64(&cc.affinityRouted, 1)
+	return func(prev DaxAPI) (DaxAPI, error) {
+		return cc.cluster.affinityClient(h, prev)
+	}
+}
+
+// Returns the hash of the partition key of the item of input.
+func (cc *ClusterDaxClient) getItemAffinity(input *dynamodb.GetItemInput) (uint64, bool) {
+	if !cc.config.KeyAffinityRouting || input.TableName == nil {
+		return 0, false
+	}
+	var name string
+	if len(input.Key) == 1 {
+		for n := range input.Key {
+			name = n
+		}
+	} else {
+		keys, ok := cc.cluster.cachedKeySchema(*input.TableName)
+		if !ok {
+			return 0, false
+		}
+		name = aws.StringValue(keys[0].AttributeName)
+	}
+	return affinityHash(*input.TableName, name, input.Key[name])
+}
+
+// Returns the hash of the partition key of the items queried by input. Queries
+// of an index are not routed by key, as their partition key is not known.
+func (cc *ClusterDaxClient) queryAffinity(input *dynamodb.QueryInput) (uint64, bool) {
+	if !cc.config.KeyAffinityRouting || input.TableName == nil || input.IndexName != nil {
+		return 0, false
+	}
+	keys, ok := cc.cluster.cachedKeySchema(*input.TableName)
+	if !ok {
+		return 0, false
+	}
+	name := aws.StringValue(keys[0].AttributeName)
+	var value *dynamodb.AttributeValue
+	if c, ok := input.KeyConditions[name]; ok {
+		if aws.StringValue(c.ComparisonOperator) == dynamodb.ComparisonOperatorEq && len(c.AttributeValueList) == 1 {
+			value = c.AttributeValueList[0]
+		}
+	} else if input.KeyConditionExpression != nil {
+		value = keyConditionValue(*input.KeyConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, name)
+	}
+	return affinityHash(*input.TableName, name, value)
+}
+
+func affinityHash(table, name string, value *dynamodb.AttributeValue) (uint64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	var b strings.Builder
+	b.WriteString(strconv.Quote(table))
+	if !writeKey(&b, []string{name}, map[string]*dynamodb.AttributeValue{name: value}) {
+		return 0, false
+	}
+	return hashString(b.String()), true
+}
+
+var equalityCondition = regexp.MustCompile(`([#:]?\w+)\s*=\s*([#:]?\w+)`)
+
+// Returns the value the attribute name is compared to for equality in the key
+// condition expression, or nil if there is none.
+func keyConditionValue(expr string, names map[string]*string, values map[string]*dynamodb.AttributeValue, name string) *dynamodb.AttributeValue {
+	operand := func(s string) string {
+		if strings.HasPrefix(s, "#") {
+			return aws.StringValue(names[s])
+		}
+		return s
+	}
+	for _, m := range equalityCondition.FindAllStringSubmatch(expr, -1) {
+		l, r := m[1], m[2]
+		if operand(r) == name {
+			l, r = r, l
+		}
+		if operand(l) == name && strings.HasPrefix(r, ":") {
+			return values[r]
+		}
+	}
+	return nil
+}
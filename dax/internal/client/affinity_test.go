@@ -0,0 +1,361 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/require"
+)
+
+func ringNodes(n int) map[hostPort]DaxAPI {
+	nodes := make(map[hostPort]DaxAPI, n)
+	for i := 1; i <= n; i++ {
+		hp := hostPort{fmt.Sprintf("10.0.0.%d", i), 8111}
+		nodes[hp] = &testClient{hp: hp}
+	}
+	return nodes
+}
+
+func TestHashRing_deterministic(t *testing.T) {
+	nodes := ringNodes(3)
+	r1, r2 := newHashRing(nodes), newHashRing(nodes)
+	counts := map[hostPort]int{}
+	const keys = 3000
+	for i := 0; i < keys; i++ {
+		h := hashString("key" + strconv.Itoa(i))
+		n := r1.node(h, nil, nil)
+		require.Equal(t, n, r1.node(h, nil, nil))
+		require.Equal(t, n, r2.node(h, nil, nil))
+		counts[n.(*testClient).hp]++
+	}
+	require.Len(t, counts, 3)
+	for hp, c := range counts {
+		require.True(t, c > keys/5 && c < keys/2, "uneven share of %v: %d of %d keys", hp, c, keys)
+	}
+	require.Nil(t, newHashRing(nil))
+}
+
+func TestHashRing_skip(t *testing.T) {
+	r := newHashRing(ringNodes(3))
+	for i := 0; i < 100; i++ {
+		h := hashString("key" + strconv.Itoa(i))
+		preferred := r.node(h, nil, nil)
+		next := r.node(h, preferred, nil)
+		require.NotEqual(t, preferred, next)
+		require.Equal(t, next, r.node(h, preferred, nil), "the fallback must be deterministic too")
+	}
+
+	single := newHashRing(ringNodes(1))
+	n := single.node(1, nil, nil)
+	require.Equal(t, n, single.node(1, n, nil), "a single node is used even if it failed")
+}
+
+func TestHashRing_unhealthy(t *testing.T) {
+	r := newHashRing(ringNodes(3))
+	down := map[DaxAPI]bool{}
+	unhealthy := func(client DaxAPI) bool { return down[client] }
+	for i := 0; i < 100; i++ {
+		h := hashString("key" + strconv.Itoa(i))
+		preferred := r.node(h, nil, nil)
+		down[preferred] = true
+		next := r.node(h, nil, unhealthy)
+		require.NotEqual(t, preferred, next)
+		require.Equal(t, next, r.node(h, nil, unhealthy), "the fallback must be deterministic too")
+		require.Equal(t, next, r.node(h, preferred, nil), "expect the node used after a failed attempt")
+
+		// neither prev nor an unhealthy node if a healthy one remains
+		down[next] = true
+		last := r.node(h, nil, unhealthy)
+		require.NotEqual(t, preferred, last)
+		require.NotEqual(t, next, last)
+		require.Equal(t, last, r.node(h, preferred, unhealthy))
+
+		// all nodes down: the next node other than prev
+		down[last] = true
+		require.Equal(t, preferred, r.node(h, nil, unhealthy))
+		require.Equal(t, next, r.node(h, preferred, unhealthy))
+		down = map[DaxAPI]bool{}
+	}
+}
+
+func TestHashRing_addNode(t *testing.T) {
+	before := ringNodes(3)
+	after := ringNodes(4)
+	for hp := range before {
+		after[hp] = before[hp]
+	}
+	added := after[hostPort{"10.0.0.4", 8111}]
+	r1, r2 := newHashRing(before), newHashRing(after)
+
+	const keys = 10000
+	moved := 0
+	for i := 0; i < keys; i++ {
+		h := hashString("key" + strconv.Itoa(i))
+		if n1, n2 := r1.node(h, nil, nil), r2.node(h, nil, nil); n1 != n2 {
+			require.Equal(t, added, n2, "keys may only move to the added node")
+			moved++
+		}
+	}
+	// about a quarter of the keys move to the fourth node
+	require.True(t, moved > keys/8 && moved < keys*2/5, "%d of %d keys moved", moved, keys)
+}
+
+func TestAffinityHash_numbers(t *testing.T) {
+	h, ok := affinityHash("table", "pk", &dynamodb.AttributeValue{N: aws.String("1")})
+	require.True(t, ok)
+	for _, n := range []string{"1.0", "01", "10E-1"} {
+		o, ok := affinityHash("table", "pk", &dynamodb.AttributeValue{N: aws.String(n)})
+		require.True(t, ok)
+		require.Equal(t, h, o, "%s must be routed as 1", n)
+	}
+	o, _ := affinityHash("table", "pk", &dynamodb.AttributeValue{S: aws.String("1")})
+	require.NotEqual(t, h, o)
+}
+
+func TestKeyConditionValue(t *testing.T) {
+	v := &dynamodb.AttributeValue{S: aws.String("alice")}
+	values := map[string]*dynamodb.AttributeValue{":v": v, ":s": {N: aws.String("1")}}
+	names := map[string]*string{"#pk": aws.String("customer")}
+	cases := []struct {
+		expr   string
+		expect *dynamodb.AttributeValue
+	}{
+		{"customer = :v", v},
+		{"customer=:v AND id > :s", v},
+		{"id >= :s AND :v = customer", v},
+		{"#pk = :v AND begins_with(id, :s)", v},
+		{"(customer = :v)", v},
+		{"id = :s", nil},
+		{"customer <= :v", nil},
+		{"customer = :missing", nil},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.expect, keyConditionValue(c.expr, names, values, "customer"), c.expr)
+	}
+}
+
+// Builds clients recording the requests sent to each node, with the key
+// schema of every table cached once schema is set.
+type affinityTestBuilder struct {
+	mu     sync.Mutex
+	schema []dynamodb.AttributeDefinition
+	fail   map[string]bool // nodes failing requests
+	failed map[string]int  // failed requests by node
+	sent   map[string]int  // requests by node
+	keys   map[string]map[string]bool
+}
+
+func (b *affinityTestBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
+	return &affinityTestClient{testClient: &testClient{hp: hostPort{ip.String(), port}}, b: b}, nil
+}
+
+// Records a request for key to the node at addr.
+func (b *affinityTestBuilder) record(addr, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail[addr] {
+		b.failed[addr]++
+		return errors.New("node failure")
+	}
+	b.sent[addr]++
+	if b.keys[key] == nil {
+		b.keys[key] = map[string]bool{}
+	}
+	b.keys[key][addr] = true
+	return nil
+}
+
+type affinityTestClient struct {
+	*testClient
+	b *affinityTestBuilder
+}
+
+func (c *affinityTestClient) addr() string {
+	return net.JoinHostPort(c.hp.host, strconv.Itoa(c.hp.port))
+}
+
+func (c *affinityTestClient) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
+	return output, c.b.record(c.addr(), aws.StringValue(input.Key["pk"].S))
+}
+
+func (c *affinityTestClient) QueryWithOptions(input *dynamodb.QueryInput, output *dynamodb.QueryOutput, opt RequestOptions) (*dynamodb.QueryOutput, error) {
+	return output, c.b.record(c.addr(), aws.StringValue(input.ExpressionAttributeValues[":pk"].S))
+}
+
+func (c *affinityTestClient) cachedKeySchema(table string) ([]dynamodb.AttributeDefinition, bool) {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	return c.b.schema, c.b.schema != nil
+}
+
+func (c *affinityTestClient) Stats() Stats {
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	return Stats{Requests: int64(c.b.sent[c.addr()])}
+}
+
+func (c *affinityTestClient) Close() error {
+	return nil
+}
+
+func TestClusterDaxClient_KeyAffinityRouting(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.KeyAffinityRouting = true
+	cluster, _ := newTestClusterWithConfig(cfg)
+	b := &affinityTestBuilder{fail: map[string]bool{}, failed: map[string]int{}, sent: map[string]int{}, keys: map[string]map[string]bool{}}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+	defer cluster.Close()
+	nodes := func(n int) []serviceEndpoint {
+		var eps []serviceEndpoint
+		for i := 1; i <= n; i++ {
+			eps = append(eps, serviceEndpoint{address: net.IPv4(10, 0, 0, byte(i)).To4(), port: 8111})
+		}
+		return eps
+	}
+	cluster.update(nodes(3))
+
+	get := func(key map[string]*dynamodb.AttributeValue) {
+		_, err := cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: key}, &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: 1})
+		require.NoError(t, err)
+	}
+	pk := func(i int) *dynamodb.AttributeValue {
+		return &dynamodb.AttributeValue{S: aws.String("k" + strconv.Itoa(i))}
+	}
+
+	// every key is always read from the same node
+	const keys = 30
+	for r := 0; r < 10; r++ {
+		for i := 0; i < keys; i++ {
+			get(map[string]*dynamodb.AttributeValue{"pk": pk(i)})
+		}
+	}
+	require.Len(t, b.keys, keys)
+	for key, addrs := range b.keys {
+		require.Len(t, addrs, 1, "key %s was read from %v", key, addrs)
+	}
+	s := cc.Stats()
+	require.Equal(t, int64(10*keys), s.AffinityRoutedRequests)
+	var total int64
+	for _, ns := range cc.NodeStats() {
+		total += ns.Requests
+	}
+	require.Equal(t, int64(10*keys), total)
+	require.Len(t, cc.NodeStats(), 3)
+
+	preferred := func(i int) string {
+		for addr := range b.keys["k"+strconv.Itoa(i)] {
+			return addr
+		}
+		return ""
+	}
+
+	// the partition key of a composite key, or of a query, is known from the
+	// cached key schema
+	b.keys = map[string]map[string]bool{}
+	get(map[string]*dynamodb.AttributeValue{"pk": pk(1), "sk": {N: aws.String("1")}})
+	require.Equal(t, int64(10*keys), cc.Stats().AffinityRoutedRequests, "unknown key schema")
+	b.schema = []dynamodb.AttributeDefinition{
+		{AttributeName: aws.String("pk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		{AttributeName: aws.String("sk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+	}
+	b.keys = map[string]map[string]bool{}
+	for i := 0; i < keys; i++ {
+		get(map[string]*dynamodb.AttributeValue{"pk": pk(i), "sk": {N: aws.String("1")}})
+		_, err := cc.QueryWithOptions(&dynamodb.QueryInput{
+			TableName:                 aws.String("orders"),
+			KeyConditionExpression:    aws.String("#k = :pk AND sk > :sk"),
+			ExpressionAttributeNames:  map[string]*string{"#k": aws.String("pk")},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":pk": pk(i), ":sk": {N: aws.String("0")}},
+		}, &dynamodb.QueryOutput{}, RequestOptions{})
+		require.NoError(t, err)
+	}
+	for key, addrs := range b.keys {
+		require.Len(t, addrs, 1, "key %s was read from %v", key, addrs)
+	}
+	require.Equal(t, int64(10*keys+2*keys), cc.Stats().AffinityRoutedRequests)
+
+	// a failed attempt on the node of a key is retried on another node
+	failed := preferred(0)
+	b.fail[failed] = true
+	b.keys = map[string]map[string]bool{}
+	get(map[string]*dynamodb.AttributeValue{"pk": pk(0)})
+	require.NotContains(t, b.keys["k0"], failed)
+	require.Len(t, b.keys["k0"], 1)
+	require.Equal(t, 1, b.failed[failed])
+
+	// the keys of the unhealthy node go to the next node until it recovers
+	for i := 0; i < keys; i++ {
+		get(map[string]*dynamodb.AttributeValue{"pk": pk(i)})
+	}
+	require.Equal(t, 1, b.failed[failed])
+	delete(b.fail, failed)
+	require.NoError(t, cluster.checkHealth())
+	b.keys = map[string]map[string]bool{}
+	get(map[string]*dynamodb.AttributeValue{"pk": pk(0)})
+	require.Equal(t, failed, preferred(0))
+
+	// a new node only takes over some of the keys
+	owners := map[int]string{}
+	b.keys = map[string]map[string]bool{}
+	for i := 0; i < keys; i++ {
+		get(map[string]*dynamodb.AttributeValue{"pk": pk(i)})
+		owners[i] = preferred(i)
+	}
+	cluster.update(nodes(4))
+	b.keys = map[string]map[string]bool{}
+	moved := 0
+	for i := 0; i < keys; i++ {
+		get(map[string]*dynamodb.AttributeValue{"pk": pk(i)})
+		if p := preferred(i); p != owners[i] {
+			require.Equal(t, "10.0.0.4:8111", p)
+			moved++
+		}
+	}
+	require.True(t, moved > 0 && moved < keys/2, "%d of %d keys moved", moved, keys)
+}
+
+func TestClusterDaxClient_KeyAffinityRoutingDisabled(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	b := &affinityTestBuilder{fail: map[string]bool{}, failed: map[string]int{}, sent: map[string]int{}, keys: map[string]map[string]bool{}}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	defer cluster.Close()
+	cluster.update([]serviceEndpoint{
+		{address: net.IPv4(10, 0, 0, 1).To4(), port: 8111},
+		{address: net.IPv4(10, 0, 0, 2).To4(), port: 8111},
+		{address: net.IPv4(10, 0, 0, 3).To4(), port: 8111},
+	})
+	require.Nil(t, cluster.ring)
+
+	for i := 0; i < 100; i++ {
+		_, err := cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("k")}}}, &dynamodb.GetItemOutput{}, RequestOptions{})
+		require.NoError(t, err)
+	}
+	require.Len(t, b.keys["k"], 3, "requests are spread across the nodes")
+	require.Zero(t, cc.Stats().AffinityRoutedRequests)
+}
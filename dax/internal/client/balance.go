@@ -0,0 +1,74 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// NewLeastOutstandingRouting returns a RoutingPolicy sending each read to the
+// node with the fewest attempts in flight of two random nodes, shifting reads
+// away from slow nodes. Writes are sent to random nodes. See
+// Stats.LoadBalancedRequests.
+func NewLeastOutstandingRouting() RoutingPolicy {
+	return &leastOutstandingRouting{}
+}
+
+type leastOutstandingRouting struct {
+	balanced int64 // accessed atomically
+	shifted  int64 // accessed atomically
+}
+
+func (p *leastOutstandingRouting) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	if !op.Read {
+		return randomRouting{}.Pick(op, nodes)
+	}
+	atomic.AddInt64(&p.balanced, 1)
+	n := len(nodes)
+	if n == 1 {
+		return nodes[0], nil
+	}
+	i, j := rand.Intn(n), rand.Intn(n-1)
+	if j >= i {
+		j++
+	}
+	a, b := nodes[i], nodes[j]
+	if a.Addr == op.Previous {
+		return b, nil
+	}
+	if b.Addr == op.Previous {
+		return a, nil
+	}
+	if a.Outstanding == b.Outstanding {
+		return a, nil
+	}
+	atomic.AddInt64(&p.shifted, 1)
+	if a.Outstanding < b.Outstanding {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (*leastOutstandingRouting) Observe(NodeInfo, time.Duration, error) {}
+
+func (*leastOutstandingRouting) NodesChanged([]NodeInfo) {}
+
+func (p *leastOutstandingRouting) stats(s *Stats) {
+	s.LoadBalancedRequests += atomic.LoadInt64(&p.balanced)
+	s.LoadShiftedRequests += atomic.LoadInt64(&p.shifted)
+}
@@ -0,0 +1,184 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/require"
+)
+
+// Builds clients recording the GetItem and PutItem requests sent to each node.
+type countingClientBuilder struct {
+	mu   sync.Mutex
+	sent map[string]int
+}
+
+func (b *countingClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	return &countingClient{testClient: &testClient{hp: hostPort{ip.String(), port}}, b: b, addr: addr}, nil
+}
+
+func (b *countingClientBuilder) shares() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	shares := make(map[string]int, len(b.sent))
+	for addr, n := range b.sent {
+		shares[addr] = n
+	}
+	return shares
+}
+
+type countingClient struct {
+	*testClient
+	b    *countingClientBuilder
+	addr string
+}
+
+func (c *countingClient) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
+	c.b.mu.Lock()
+	c.b.sent[c.addr]++
+	c.b.mu.Unlock()
+	return output, nil
+}
+
+func (c *countingClient) PutItemWithOptions(input *dynamodb.PutItemInput, output *dynamodb.PutItemOutput, opt RequestOptions) (*dynamodb.PutItemOutput, error) {
+	_, err := c.GetItemWithOptions(nil, nil, opt)
+	return output, err
+}
+
+func (c *countingClient) Close() error {
+	return nil
+}
+
+// slowNodeBacklog is the number of attempts kept in flight on the slow node
+// of sendToSlowNode.
+const slowNodeBacklog = 10
+
+// Sends n requests by op to a slow node, with slowNodeBacklog attempts in
+// flight, and two idle ones, and returns the number of requests sent to each
+// node.
+func sendToSlowNode(t *testing.T, policy RoutingPolicy, op string, n int) (map[string]int, Stats) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.RoutingPolicy = policy
+	cluster, _ := newTestClusterWithConfig(cfg)
+	b := &countingClientBuilder{sent: map[string]int{}}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+	defer cluster.Close()
+	cluster.update([]serviceEndpoint{
+		{address: net.IPv4(10, 0, 0, 1).To4(), port: 8111},
+		{address: net.IPv4(10, 0, 0, 2).To4(), port: 8111},
+		{address: net.IPv4(10, 0, 0, 3).To4(), port: 8111},
+	})
+	states := map[string]*nodeState{}
+	for _, s := range cluster.states {
+		states[s.addr] = s
+	}
+	atomic.AddInt64(&states["10.0.0.1:8111"].inFlight, slowNodeBacklog)
+
+	for i := 0; i < n; i++ {
+		var err error
+		if op == OpPutItem {
+			_, err = cc.PutItemWithOptions(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("k")}}}, &dynamodb.PutItemOutput{}, RequestOptions{})
+		} else {
+			_, err = cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("k")}}}, &dynamodb.GetItemOutput{}, RequestOptions{})
+		}
+		require.NoError(t, err)
+	}
+	// every attempt released its slot
+	for addr, s := range states {
+		expect := int64(0)
+		if addr == "10.0.0.1:8111" {
+			expect = slowNodeBacklog
+		}
+		require.Equal(t, expect, atomic.LoadInt64(&s.inFlight), addr)
+	}
+	return b.shares(), cc.Stats()
+}
+
+func TestClusterDaxClient_LeastOutstandingRouting(t *testing.T) {
+	const total = 300
+
+	shares, s := sendToSlowNode(t, NewLeastOutstandingRouting(), OpGetItem, total)
+	// either node compared to the slow one has fewer attempts in flight
+	require.Zero(t, shares["10.0.0.1:8111"], "%v", shares)
+	require.Equal(t, total, shares["10.0.0.2:8111"]+shares["10.0.0.3:8111"])
+	require.True(t, shares["10.0.0.2:8111"] > 0 && shares["10.0.0.3:8111"] > 0, "%v", shares)
+	require.Equal(t, int64(total), s.LoadBalancedRequests)
+	require.True(t, s.LoadShiftedRequests > 0 && s.LoadShiftedRequests <= s.LoadBalancedRequests)
+
+	// writes are sent to random nodes
+	shares, s = sendToSlowNode(t, NewLeastOutstandingRouting(), OpPutItem, total)
+	require.True(t, shares["10.0.0.1:8111"] > total/6, "%v", shares)
+	require.Zero(t, s.LoadBalancedRequests)
+}
+
+func TestClusterDaxClient_RandomRouting(t *testing.T) {
+	const total = 300
+	shares, s := sendToSlowNode(t, nil, OpGetItem, total)
+	require.True(t, shares["10.0.0.1:8111"] > total/6, "%v", shares)
+	require.Zero(t, s.LoadBalancedRequests)
+	require.Zero(t, s.LoadShiftedRequests)
+}
+
+func TestCluster_attemptReleasesSlotOnPanic(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	defer cluster.Close()
+	require.NoError(t, cluster.update([]serviceEndpoint{{address: net.IPv4(10, 0, 0, 1).To4(), port: 8111}}))
+	client, err := cluster.client(nil)
+	require.NoError(t, err)
+	noFault := func() error { return nil }
+	for _, fault := range []func() error{
+		noFault,
+		func() error { panic("fault injector failed") },
+		func() error { return errors.New("injected") },
+	} {
+		client, s, err := cluster.acquire(context.Background(), OpGetItem, client, nil)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), atomic.LoadInt64(&s.inFlight))
+		func() {
+			defer func() { recover() }()
+			cluster.attempt(s, client, systemClock{}, fault, func() error { panic("action failed") })
+		}()
+		require.Zero(t, atomic.LoadInt64(&s.inFlight))
+	}
+}
+
+func TestLeastOutstandingRouting_Pick(t *testing.T) {
+	p := NewLeastOutstandingRouting()
+	nodes := []NodeInfo{{Addr: "10.0.0.1:8111", Outstanding: 5}, {Addr: "10.0.0.2:8111"}}
+	for i := 0; i < 20; i++ {
+		node, err := p.Pick(OperationInfo{Name: OpGetItem, Read: true}, nodes)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.2:8111", node.Addr)
+
+		node, err = p.Pick(OperationInfo{Name: OpGetItem, Read: true, Attempt: 1, Previous: "10.0.0.2:8111"}, nodes)
+		require.NoError(t, err)
+		require.Equal(t, "10.0.0.1:8111", node.Addr)
+	}
+}
@@ -0,0 +1,418 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Maximum number of items of a BatchWriteItem request.
+const maxBatchWriteItems = 25
+
+// BatchWriteError is returned by BatchWriteItem when some of the requests a
+// BatchWriteItem over 25 items was split into failed. The output returned with
+// it holds the merged outputs of the requests that succeeded, in particular their
+// UnprocessedItems, which were not written.
+//
+// BatchWriteError implements awserr.Error with the code and message of the
+// error of the first failed request.
+type BatchWriteError struct {
+	// Err is the error of the first failed request.
+	Err error
+	// Failed holds the items of the requests that failed. They may or may not
+	// have been written.
+	Failed map[string][]*dynamodb.WriteRequest
+	// NotAttempted holds the items of the requests that were not sent because
+	// of the failure. They were not written.
+	NotAttempted map[string][]*dynamodb.WriteRequest
+}
+
+func (e *BatchWriteError) Error() string {
+	return fmt.Sprintf("batch write failed, %d items failed, %d not attempted: %v", countWrites(e.Failed), countWrites(e.NotAttempted), e.Err)
+}
+
+func (e *BatchWriteError) Code() string {
+	if ae, ok := e.Err.(awserr.Error); ok {
+		return ae.Code()
+	}
+	return ErrCodeUnknown
+}
+
+func (e *BatchWriteError) Message() string {
+	if ae, ok := e.Err.(awserr.Error); ok {
+		return ae.Message()
+	}
+	return e.Err.Error()
+}
+
+func (e *BatchWriteError) OrigErr() error {
+	return e.Err
+}
+
+func countWrites(items map[string][]*dynamodb.WriteRequest) int {
+	n := 0
+	for _, writes := range items {
+		n += len(writes)
+	}
+	return n
+}
+
+// Splits input into requests of at most max keys, in the order of the tables
+// names and of the keys of each table. Returns nil if input does not need to
+// be split.
+func splitBatchGetItem(input *dynamodb.BatchGetItemInput, max int) []*dynamodb.BatchGetItemInput {
+	total := 0
+	for _, ka := range input.RequestItems {
+		if ka != nil {
+			total += len(ka.Keys)
+		}
+	}
+	if total <= max {
+		return nil
+	}
+
+	var chunks []*dynamodb.BatchGetItemInput
+	var chunk *dynamodb.BatchGetItemInput
+	size := 0
+	for _, table := range sortedTables(input.RequestItems) {
+		ka := input.RequestItems[table]
+		if ka == nil {
+			continue
+		}
+		for keys := ka.Keys; len(keys) > 0; {
+			if chunk == nil || size == max {
+				chunk = &dynamodb.BatchGetItemInput{
+					RequestItems:           make(map[string]*dynamodb.KeysAndAttributes),
+					ReturnConsumedCapacity: input.ReturnConsumedCapacity,
+				}
+				chunks = append(chunks, chunk)
+				size = 0
+			}
+			n := max - size
+			if n > len(keys) {
+				n = len(keys)
+			}
+			part := *ka
+			part.Keys = keys[:n:n]
+			chunk.RequestItems[table] = &part
+			keys = keys[n:]
+			size += n
+		}
+	}
+	return chunks
+}
+
+func sortedTables(items map[string]*dynamodb.KeysAndAttributes) []string {
+	tables := make([]string, 0, len(items))
+	for table := range items {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Splits input into requests of at most max items, in the order of the tables
+// names and of the items of each table. Returns nil if input does not need to
+// be split.
+func splitBatchWriteItem(input *dynamodb.BatchWriteItemInput, max int) []*dynamodb.BatchWriteItemInput {
+	total := 0
+	tables := make([]string, 0, len(input.RequestItems))
+	for table, writes := range input.RequestItems {
+		total += len(writes)
+		tables = append(tables, table)
+	}
+	if total <= max {
+		return nil
+	}
+	sort.Strings(tables)
+
+	var chunks []*dynamodb.BatchWriteItemInput
+	var chunk *dynamodb.BatchWriteItemInput
+	size := 0
+	for _, table := range tables {
+		for writes := input.RequestItems[table]; len(writes) > 0; {
+			if chunk == nil || size == max {
+				chunk = &dynamodb.BatchWriteItemInput{
+					RequestItems:                make(map[string][]*dynamodb.WriteRequest),
+					ReturnConsumedCapacity:      input.ReturnConsumedCapacity,
+					ReturnItemCollectionMetrics: input.ReturnItemCollectionMetrics,
+				}
+				chunks = append(chunks, chunk)
+				size = 0
+			}
+			n := max - size
+			if n > len(writes) {
+				n = len(writes)
+			}
+			chunk.RequestItems[table] = writes[:n:n]
+			writes = writes[n:]
+			size += n
+		}
+	}
+	return chunks
+}
+
+// Executes the chunks of a split BatchGetItem, up to concurrency at once, and
+// merges their outputs into output in the order of the chunks. The keys of the
+// chunks that failed for a transient reason, such as throttling, are merged into
+// the UnprocessedKeys. Returns the error of the first chunk that failed for
+// another reason, or of the first chunk if all the chunks failed.
+func (cc *ClusterDaxClient) batchGetItemChunks(chunks []*dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
+	outputs := make([]*dynamodb.BatchGetItemOutput, len(chunks))
+	start := rand.Intn(1 << 20)
+	errs, _ := runChunks(len(chunks), cc.config.BatchConcurrency, false, func(i int) error {
+		out, err := cc.batchGetItemWith(cc.chunkClient(OpBatchGetItem, start+i), chunks[i], &dynamodb.BatchGetItemOutput{}, opt)
+		outputs[i] = out
+		return err
+	})
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			// sending the keys again would fail the same way
+			if !isTransientChunkError(err) {
+				return output, err
+			}
+			failed++
+		}
+	}
+	if failed == len(chunks) {
+		return output, errs[0]
+	}
+
+	if output == nil {
+		output = &dynamodb.BatchGetItemOutput{}
+	}
+	output.Responses = make(map[string][]map[string]*dynamodb.AttributeValue)
+	output.UnprocessedKeys = make(map[string]*dynamodb.KeysAndAttributes)
+	output.ConsumedCapacity = nil
+	for i, out := range outputs {
+		unprocessed := chunks[i].RequestItems
+		if errs[i] == nil {
+			for table, items := range out.Responses {
+				output.Responses[table] = append(output.Responses[table], items...)
+			}
+			output.ConsumedCapacity = MergeConsumedCapacity(output.ConsumedCapacity, out.ConsumedCapacity)
+			unprocessed = out.UnprocessedKeys
+		}
+		for _, table := range sortedTables(unprocessed) {
+			ka := unprocessed[table]
+			if ka == nil || len(ka.Keys) == 0 {
+				continue
+			}
+			if merged, ok := output.UnprocessedKeys[table]; ok {
+				merged.Keys = append(merged.Keys, ka.Keys...)
+			} else {
+				part := *ka
+				part.Keys = append([]map[string]*dynamodb.AttributeValue(nil), ka.Keys...)
+				output.UnprocessedKeys[table] = &part
+			}
+		}
+	}
+	return output, nil
+}
+
+// Returns whether a chunk failed for a transient reason, so that its keys may
+// be reported as unprocessed for the caller to send them again.
+func isTransientChunkError(err error) bool {
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case ErrCodeServiceUnavailable, ErrCodeConnectionFailed, ErrCodeConnectTimeout, ErrCodeOverloaded, dynamodb.ErrCodeInternalServerError:
+			return true
+		}
+	}
+	return request.IsErrorRetryable(err)
+}
+
+// Returns a function picking the client of the i-th route for the first attempt
+// of a chunk of op, so that the chunks of a request are spread over the nodes,
+// and the node chosen by the routing policy for the next attempts.
+func (cc *ClusterDaxClient) chunkClient(op string, i int) func(prev DaxAPI) (DaxAPI, error) {
+	attempt := 0
+	return func(prev DaxAPI) (DaxAPI, error) {
+		attempt++
+		if attempt == 1 {
+			return cc.cluster.clientAt(i)
+		}
+		return cc.cluster.route(op, attempt-1, prev)
+	}
+}
+
+// Executes the chunks of a split BatchWriteItem, up to concurrency at once, and
+// merges their outputs into output. Returns a *BatchWriteError if a chunk failed,
+// chunks not yet sent at that point are skipped.
+func (cc *ClusterDaxClient) batchWriteItemChunks(chunks []*dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	outputs := make([]*dynamodb.BatchWriteItemOutput, len(chunks))
+	start := rand.Intn(1 << 20)
+	errs, sent := runChunks(len(chunks), cc.config.BatchConcurrency, true, func(i int) error {
+		out, err := cc.batchWriteItemWith(cc.chunkClient(OpBatchWriteItem, start+i), chunks[i], &dynamodb.BatchWriteItemOutput{}, opt)
+		outputs[i] = out
+		return err
+	})
+
+	if output == nil {
+		output = &dynamodb.BatchWriteItemOutput{}
+	}
+	output.UnprocessedItems = make(map[string][]*dynamodb.WriteRequest)
+	output.ItemCollectionMetrics = nil
+	output.ConsumedCapacity = nil
+	var failure *BatchWriteError
+	for i, chunk := range chunks {
+		if i >= sent || errs[i] != nil {
+			if failure == nil {
+				failure = &BatchWriteError{
+					Failed:       make(map[string][]*dynamodb.WriteRequest),
+					NotAttempted: make(map[string][]*dynamodb.WriteRequest),
+				}
+			}
+			items := failure.NotAttempted
+			if i < sent {
+				items = failure.Failed
+				if failure.Err == nil {
+					failure.Err = errs[i]
+				}
+			}
+			for table, writes := range chunk.RequestItems {
+				items[table] = append(items[table], writes...)
+			}
+			continue
+		}
+		out := outputs[i]
+		for table, writes := range out.UnprocessedItems {
+			if len(writes) > 0 {
+				output.UnprocessedItems[table] = append(output.UnprocessedItems[table], writes...)
+			}
+		}
+		for table, metrics := range out.ItemCollectionMetrics {
+			if output.ItemCollectionMetrics == nil {
+				output.ItemCollectionMetrics = make(map[string][]*dynamodb.ItemCollectionMetrics)
+			}
+			output.ItemCollectionMetrics[table] = append(output.ItemCollectionMetrics[table], metrics...)
+		}
+		output.ConsumedCapacity = MergeConsumedCapacity(output.ConsumedCapacity, out.ConsumedCapacity)
+	}
+	if failure != nil {
+		return output, failure
+	}
+	return output, nil
+}
+
+// Runs fn for each of the n chunks in order, with up to concurrency calls at once.
+// If stopOnFailure, stops starting chunks once one failed. Returns the error of
+// each chunk, and the number of chunks started.
+func runChunks(n, concurrency int, stopOnFailure bool, fn func(i int) error) ([]error, int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, n)
+	var failed bool
+	var lock sync.Mutex
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	sent := 0
+	for ; sent < n; sent++ {
+		sem <- struct{}{}
+		lock.Lock()
+		stop := failed
+		lock.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(i); err != nil {
+				lock.Lock()
+				errs[i] = err
+				failed = stopOnFailure
+				lock.Unlock()
+			}
+		}(sent)
+	}
+	wg.Wait()
+	return errs, sent
+}
+
+// MergeConsumedCapacity adds the capacity consumed per table of add to total.
+func MergeConsumedCapacity(total []*dynamodb.ConsumedCapacity, add []*dynamodb.ConsumedCapacity) []*dynamodb.ConsumedCapacity {
+	for _, c := range add {
+		if c == nil {
+			continue
+		}
+		var merged *dynamodb.ConsumedCapacity
+		for _, t := range total {
+			if aws.StringValue(t.TableName) == aws.StringValue(c.TableName) {
+				merged = t
+				break
+			}
+		}
+		if merged == nil {
+			merged = &dynamodb.ConsumedCapacity{TableName: c.TableName}
+			total = append(total, merged)
+		}
+		merged.CapacityUnits = addUnits(merged.CapacityUnits, c.CapacityUnits)
+		merged.ReadCapacityUnits = addUnits(merged.ReadCapacityUnits, c.ReadCapacityUnits)
+		merged.WriteCapacityUnits = addUnits(merged.WriteCapacityUnits, c.WriteCapacityUnits)
+		merged.Table = addCapacity(merged.Table, c.Table)
+		merged.GlobalSecondaryIndexes = addIndexCapacity(merged.GlobalSecondaryIndexes, c.GlobalSecondaryIndexes)
+		merged.LocalSecondaryIndexes = addIndexCapacity(merged.LocalSecondaryIndexes, c.LocalSecondaryIndexes)
+	}
+	return total
+}
+
+func addUnits(total, add *float64) *float64 {
+	if add == nil {
+		return total
+	}
+	return aws.Float64(aws.Float64Value(total) + *add)
+}
+
+func addCapacity(total, add *dynamodb.Capacity) *dynamodb.Capacity {
+	if add == nil {
+		return total
+	}
+	if total == nil {
+		total = &dynamodb.Capacity{}
+	}
+	total.CapacityUnits = addUnits(total.CapacityUnits, add.CapacityUnits)
+	total.ReadCapacityUnits = addUnits(total.ReadCapacityUnits, add.ReadCapacityUnits)
+	total.WriteCapacityUnits = addUnits(total.WriteCapacityUnits, add.WriteCapacityUnits)
+	return total
+}
+
+func addIndexCapacity(total, add map[string]*dynamodb.Capacity) map[string]*dynamodb.Capacity {
+	for index, c := range add {
+		if total == nil {
+			total = make(map[string]*dynamodb.Capacity)
+		}
+		total[index] = addCapacity(total[index], c)
+	}
+	return total
+}
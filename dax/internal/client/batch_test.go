@@ -0,0 +1,426 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchTestClient(t *testing.T, b *testClientBuilder) *ClusterDaxClient {
+	cluster, builder := newTestCluster([]string{"127.0.0.1:8111"})
+	builder.getItem, builder.batchGetItem, builder.batchWriteItem = b.getItem, b.batchGetItem, b.batchWriteItem
+	builder.validateBatch = b.validateBatch
+	if err := cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return &ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+}
+
+func batchGetKeys(prefix string, n int) []map[string]*dynamodb.AttributeValue {
+	keys := make([]map[string]*dynamodb.AttributeValue, n)
+	for i := range keys {
+		keys[i] = map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(prefix + strconv.Itoa(i))}}
+	}
+	return keys
+}
+
+func TestClusterDaxClient_BatchGetItemSplit(t *testing.T) {
+	var lock sync.Mutex
+	var sizes []int
+	var inFlight, maxInFlight int32
+	cc := newBatchTestClient(t, &testClientBuilder{batchGetItem: func(_ hostPort, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		time.Sleep(5 * time.Millisecond)
+
+		output := &dynamodb.BatchGetItemOutput{
+			Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+			UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+		}
+		size := 0
+		for table, ka := range input.RequestItems {
+			size += len(ka.Keys)
+			require.Equal(t, "pk, v", aws.StringValue(ka.ProjectionExpression))
+			for i, key := range ka.Keys {
+				if i%10 == 9 {
+					// every tenth key is left unprocessed
+					if output.UnprocessedKeys[table] == nil {
+						output.UnprocessedKeys[table] = &dynamodb.KeysAndAttributes{ProjectionExpression: ka.ProjectionExpression}
+					}
+					output.UnprocessedKeys[table].Keys = append(output.UnprocessedKeys[table].Keys, key)
+					continue
+				}
+				output.Responses[table] = append(output.Responses[table], key)
+			}
+			output.ConsumedCapacity = append(output.ConsumedCapacity, &dynamodb.ConsumedCapacity{
+				TableName:     aws.String(table),
+				CapacityUnits: aws.Float64(float64(len(ka.Keys))),
+			})
+		}
+		lock.Lock()
+		sizes = append(sizes, size)
+		if n > maxInFlight {
+			maxInFlight = n
+		}
+		lock.Unlock()
+		return output, nil
+	}})
+	cc.config.BatchConcurrency = 2
+
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			"a": {Keys: batchGetKeys("a", 150), ProjectionExpression: aws.String("pk, v")},
+			"b": {Keys: batchGetKeys("b", 100), ProjectionExpression: aws.String("pk, v")},
+		},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+	output, err := cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []int{100, 100, 50}, sizes)
+	require.Equal(t, int32(2), maxInFlight)
+	for table, n := range map[string]int{"a": 150, "b": 100} {
+		var processed, unprocessed []map[string]*dynamodb.AttributeValue
+		for _, key := range input.RequestItems[table].Keys {
+			pk := aws.StringValue(key["pk"].S)
+			i, _ := strconv.Atoi(pk[1:])
+			if i%10 == 9 {
+				unprocessed = append(unprocessed, key)
+			} else {
+				processed = append(processed, key)
+			}
+		}
+		require.Equal(t, processed, output.Responses[table], "responses of %s must be in the order of the keys", table)
+		require.Equal(t, unprocessed, output.UnprocessedKeys[table].Keys)
+		require.Equal(t, "pk, v", aws.StringValue(output.UnprocessedKeys[table].ProjectionExpression))
+		require.Len(t, processed, n-n/10)
+	}
+	require.ElementsMatch(t, []*dynamodb.ConsumedCapacity{
+		{TableName: aws.String("a"), CapacityUnits: aws.Float64(150)},
+		{TableName: aws.String("b"), CapacityUnits: aws.Float64(100)},
+	}, output.ConsumedCapacity)
+
+	// the input is left untouched
+	require.Len(t, input.RequestItems["a"].Keys, 150)
+	require.Len(t, input.RequestItems["b"].Keys, 100)
+}
+
+func TestClusterDaxClient_BatchGetItemSplitFailure(t *testing.T) {
+	failure := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	var calls int32
+	failing := map[string]bool{"b": true}
+	cc := newBatchTestClient(t, &testClientBuilder{batchGetItem: func(_ hostPort, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		atomic.AddInt32(&calls, 1)
+		output := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+		for table, ka := range input.RequestItems {
+			if failing[table] {
+				return nil, failure
+			}
+			output.Responses[table] = ka.Keys
+		}
+		return output, nil
+	}})
+	cc.config.BatchConcurrency = 1
+
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{
+		"a": {Keys: batchGetKeys("a", 100), ConsistentRead: aws.Bool(true)},
+		"b": {Keys: batchGetKeys("b", 100), ConsistentRead: aws.Bool(true)},
+		"c": {Keys: batchGetKeys("c", 100), ConsistentRead: aws.Bool(true)},
+	}}
+	output, err := cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls), "a failed request must not stop the others")
+	require.Equal(t, input.RequestItems["a"].Keys, output.Responses["a"])
+	require.Equal(t, input.RequestItems["c"].Keys, output.Responses["c"])
+	require.Len(t, output.UnprocessedKeys, 1)
+	require.Equal(t, input.RequestItems["b"], output.UnprocessedKeys["b"], "keys of a failed request must be unprocessed")
+
+	// the call fails if no request succeeded
+	failing = map[string]bool{"a": true, "b": true, "c": true}
+	_, err = cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+	require.Equal(t, failure, err)
+
+	// keys failing for another reason are not reported as unprocessed
+	for _, f := range []awserr.Error{
+		awserr.New(ErrCodeValidationException, "invalid key", nil),
+		awserr.New("AccessDeniedException", "denied", nil),
+		&dynamodb.ResourceNotFoundException{Message_: aws.String("no table")},
+	} {
+		failure = f
+		failing = map[string]bool{"b": true}
+		_, err = cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+		require.Equal(t, failure, err)
+	}
+}
+
+func TestClusterDaxClient_BatchGetItemSplitAcrossNodes(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	var inFlight, maxInFlight int32
+	fail := map[string]bool{}
+
+	cluster, builder := newTestCluster([]string{"127.0.0.1:8111"})
+	builder.batchGetItem = func(hp hostPort, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		lock.Lock()
+		requests[hp.host]++
+		if n > maxInFlight {
+			maxInFlight = n
+		}
+		failing := fail[hp.host]
+		lock.Unlock()
+		if hp.host == "127.0.0.2" { // slow node
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if failing {
+			return nil, awserr.New(ErrCodeServiceUnavailable, "unavailable", nil)
+		}
+		return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{"a": input.RequestItems["a"].Keys}}, nil
+	}
+	err := cluster.update([]serviceEndpoint{
+		{address: []byte{127, 0, 0, 1}, port: 8121},
+		{address: []byte{127, 0, 0, 2}, port: 8121},
+		{address: []byte{127, 0, 0, 3}, port: 8121},
+	})
+	require.NoError(t, err)
+	cc := &ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	cc.config.BatchConcurrency = 3
+
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"a": {Keys: batchGetKeys("a", 600)}}}
+	output, err := cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, input.RequestItems["a"].Keys, output.Responses["a"], "responses must be merged in the order of the keys")
+	require.Equal(t, map[string]int{"127.0.0.1": 2, "127.0.0.2": 2, "127.0.0.3": 2}, requests)
+	require.Equal(t, int32(3), maxInFlight)
+
+	// requests failing on a node are retried on another one
+	requests = map[string]int{}
+	fail["127.0.0.2"] = true
+	output, err = cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{MaxRetries: 1})
+	require.NoError(t, err)
+	require.ElementsMatch(t, input.RequestItems["a"].Keys, output.Responses["a"])
+	require.Empty(t, output.UnprocessedKeys)
+	require.Equal(t, 2, requests["127.0.0.2"])
+	require.Equal(t, 6, requests["127.0.0.1"]+requests["127.0.0.3"])
+
+	// and returned as unprocessed once out of retries
+	output, err = cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Len(t, output.Responses["a"], 400)
+	require.Len(t, output.UnprocessedKeys["a"].Keys, 200)
+}
+
+func TestClusterDaxClient_BatchGetItemNotSplit(t *testing.T) {
+	var calls int32
+	cc := newBatchTestClient(t, &testClientBuilder{batchGetItem: func(_ hostPort, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		atomic.AddInt32(&calls, 1)
+		return &dynamodb.BatchGetItemOutput{}, nil
+	}})
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{
+		"a": {Keys: batchGetKeys("a", 60)},
+		"b": {Keys: batchGetKeys("b", 40)},
+	}}
+	_, err := cc.BatchGetItemWithOptions(input, &dynamodb.BatchGetItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), calls)
+}
+
+// Returns n writes alternating puts and deletes.
+func batchWrites(prefix string, n int) []*dynamodb.WriteRequest {
+	writes := make([]*dynamodb.WriteRequest, n)
+	for i := range writes {
+		key := map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(prefix + strconv.Itoa(i))}}
+		if i%2 == 0 {
+			writes[i] = &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: key}}
+		} else {
+			writes[i] = &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key}}
+		}
+	}
+	return writes
+}
+
+func writeRequestKey(w *dynamodb.WriteRequest) string {
+	if w.PutRequest != nil {
+		return aws.StringValue(w.PutRequest.Item["pk"].S)
+	}
+	return aws.StringValue(w.DeleteRequest.Key["pk"].S)
+}
+
+func TestClusterDaxClient_BatchWriteItemSplit(t *testing.T) {
+	var lock sync.Mutex
+	var sizes []int
+	written := map[string]int{}
+	cc := newBatchTestClient(t, &testClientBuilder{batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		output := &dynamodb.BatchWriteItemOutput{
+			UnprocessedItems:      map[string][]*dynamodb.WriteRequest{},
+			ItemCollectionMetrics: map[string][]*dynamodb.ItemCollectionMetrics{},
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		size := 0
+		for table, writes := range input.RequestItems {
+			size += len(writes)
+			for _, w := range writes {
+				// the first write of each table in a request is left unprocessed
+				if w == writes[0] {
+					output.UnprocessedItems[table] = append(output.UnprocessedItems[table], w)
+					continue
+				}
+				written[writeRequestKey(w)]++
+			}
+			output.ItemCollectionMetrics[table] = []*dynamodb.ItemCollectionMetrics{{SizeEstimateRangeGB: []*float64{aws.Float64(1)}}}
+			output.ConsumedCapacity = append(output.ConsumedCapacity, &dynamodb.ConsumedCapacity{
+				TableName:     aws.String(table),
+				CapacityUnits: aws.Float64(float64(len(writes))),
+			})
+		}
+		sizes = append(sizes, size)
+		return output, nil
+	}})
+
+	input := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{
+			"a": batchWrites("a", 35),
+			"b": batchWrites("b", 25),
+		},
+		ReturnConsumedCapacity:      aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		ReturnItemCollectionMetrics: aws.String(dynamodb.ReturnItemCollectionMetricsSize),
+	}
+	output, err := cc.BatchWriteItemWithOptions(input, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+
+	// requests: a0-a24, a25-a34 and b0-b14, b15-b24
+	require.ElementsMatch(t, []int{25, 25, 10}, sizes)
+	unprocessed := []string{"a0", "a25", "b0", "b15"}
+	var actual []string
+	for _, writes := range output.UnprocessedItems {
+		for _, w := range writes {
+			actual = append(actual, writeRequestKey(w))
+		}
+	}
+	require.ElementsMatch(t, unprocessed, actual)
+	require.Len(t, written, 60-len(unprocessed))
+	for _, n := range written {
+		require.Equal(t, 1, n)
+	}
+	require.Len(t, output.ItemCollectionMetrics["a"], 2)
+	require.Len(t, output.ItemCollectionMetrics["b"], 2)
+	require.ElementsMatch(t, []*dynamodb.ConsumedCapacity{
+		{TableName: aws.String("a"), CapacityUnits: aws.Float64(35)},
+		{TableName: aws.String("b"), CapacityUnits: aws.Float64(25)},
+	}, output.ConsumedCapacity)
+}
+
+func TestClusterDaxClient_BatchWriteItemSplitDuplicates(t *testing.T) {
+	keySchema := &lru.Lru{
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			return []dynamodb.AttributeDefinition{{AttributeName: aws.String("pk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}}, nil
+		},
+	}
+	var calls int32
+	cc := newBatchTestClient(t, &testClientBuilder{
+		batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			return &dynamodb.BatchWriteItemOutput{}, nil
+		},
+		validateBatch: func(input *dynamodb.BatchWriteItemInput) error {
+			return validateBatchWriteItemInput(nil, input, keySchema)
+		},
+	})
+
+	// the duplicate would be sent in the second request
+	writes := batchWrites("a", 30)
+	writes[27] = &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: writes[2].PutRequest.Item}}
+	input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"a": writes}}
+	_, err := cc.BatchWriteItemWithOptions(input, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.Error(t, err)
+	aerr, ok := err.(awserr.RequestFailure)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, ErrCodeValidationException, aerr.Code())
+	require.Equal(t, `Provided list of item keys contains duplicates: RequestItems[a][2] and RequestItems[a][27] both write the item with key {pk: "a2"}`, aerr.Message())
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	writes[27] = &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("b")}}}}
+	_, err = cc.BatchWriteItemWithOptions(input, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestClusterDaxClient_InvalidParamsNotSent(t *testing.T) {
+	var calls int32
+	cc := newBatchTestClient(t, &testClientBuilder{
+		getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			return &dynamodb.GetItemOutput{}, nil
+		},
+		batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			return &dynamodb.BatchWriteItemOutput{}, nil
+		},
+	})
+
+	_, err := cc.GetItemWithOptions(&dynamodb.GetItemInput{Key: map[string]*dynamodb.AttributeValue{}}, &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: 2})
+	require.Error(t, err)
+	invalid, ok := err.(request.ErrInvalidParams)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, 2, invalid.Len())
+
+	writes := batchWrites("a", 30)
+	writes[29] = &dynamodb.WriteRequest{}
+	_, err = cc.BatchWriteItemWithOptions(&dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"a": writes}}, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.Error(t, err)
+	require.Equal(t, request.InvalidParameterErrCode, err.(awserr.Error).Code())
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestClusterDaxClient_BatchWriteItemSplitFailure(t *testing.T) {
+	failure := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	var calls int32
+	cc := newBatchTestClient(t, &testClientBuilder{batchWriteItem: func(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			return nil, failure
+		}
+		return &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]*dynamodb.WriteRequest{"a": input.RequestItems["a"][:1]}}, nil
+	}})
+	cc.config.BatchConcurrency = 1
+
+	input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"a": batchWrites("a", 60)}}
+	output, err := cc.BatchWriteItemWithOptions(input, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.Error(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	berr, ok := err.(*BatchWriteError)
+	require.True(t, ok, "expected a *BatchWriteError, got %T", err)
+	require.Equal(t, failure, berr.Err)
+	require.Equal(t, dynamodb.ErrCodeProvisionedThroughputExceededException, berr.Code())
+	require.Equal(t, input.RequestItems["a"][25:50], berr.Failed["a"])
+	require.Equal(t, input.RequestItems["a"][50:], berr.NotAttempted["a"])
+	require.Equal(t, input.RequestItems["a"][:1], output.UnprocessedItems["a"])
+}
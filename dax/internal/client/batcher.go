@@ -0,0 +1,248 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Maximum number of keys of a BatchGetItem request.
+const maxBatchGetItemKeys = 100
+
+type getItemFunc func(*dynamodb.GetItemInput, *dynamodb.GetItemOutput, RequestOptions) (*dynamodb.GetItemOutput, error)
+type batchGetItemFunc func(*dynamodb.BatchGetItemInput, *dynamodb.BatchGetItemOutput, RequestOptions) (*dynamodb.BatchGetItemOutput, error)
+
+// Combines GetItem calls for the same table made within a window into a single
+// BatchGetItem request. A nil batcher does not batch anything.
+type getItemBatcher struct {
+	window   time.Duration
+	maxSize  int
+	clock    clock
+	get      getItemFunc
+	batchGet batchGetItemFunc
+
+	batched int64 // accessed atomically
+
+	mu      sync.Mutex
+	pending map[string]*getItemBatch // protected by mu
+}
+
+type getItemBatch struct {
+	table  string
+	names  []string // key attribute names, in order
+	opt    RequestOptions
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// protected by the batcher mu
+	keys    []map[string]*dynamodb.AttributeValue
+	calls   map[string]int // number of calls per key
+	waiters int
+
+	// set before done is closed
+	items       map[string]map[string]*dynamodb.AttributeValue
+	unprocessed map[string]bool
+	err         error
+}
+
+// Returns a batcher, or nil if batching is disabled.
+func newGetItemBatcher(window time.Duration, maxSize int, clk clock, get getItemFunc, batchGet batchGetItemFunc) *getItemBatcher {
+	if window <= 0 {
+		return nil
+	}
+	if maxSize <= 0 || maxSize > maxBatchGetItemKeys {
+		maxSize = maxBatchGetItemKeys
+	}
+	return &getItemBatcher{
+		window:   window,
+		maxSize:  maxSize,
+		clock:    clockOrSystem(clk),
+		get:      get,
+		batchGet: batchGet,
+		pending:  make(map[string]*getItemBatch),
+	}
+}
+
+// Returns whether the call can be served by a BatchGetItem request shared with other calls.
+// Calls returning a subset of the item, consumed capacity or using custom retries are not batched.
+func batchable(input *dynamodb.GetItemInput, opt RequestOptions) bool {
+	return input.TableName != nil && len(input.Key) > 0 &&
+		!aws.BoolValue(input.ConsistentRead) &&
+		input.ProjectionExpression == nil && len(input.AttributesToGet) == 0 && len(input.ExpressionAttributeNames) == 0 &&
+		(input.ReturnConsumedCapacity == nil || *input.ReturnConsumedCapacity == dynamodb.ReturnConsumedCapacityNone) &&
+		opt.RetryDelay == 0 && opt.Retryer == (DaxRetryer{}) && opt.SleepDelayFn == nil
+}
+
+// Executes the call as part of a batch if possible, and as a GetItem otherwise.
+// Keys left unprocessed by the batch, or calls of a batch rejected as invalid,
+// are executed as GetItem so that each call gets its own result.
+func (b *getItemBatcher) do(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
+	if !batchable(input, opt) {
+		return b.get(input, output, opt)
+	}
+	names := sortedKeyNames(input.Key)
+	var kb strings.Builder
+	if !writeKey(&kb, names, input.Key) {
+		return b.get(input, output, opt)
+	}
+	key := kb.String()
+	group := strconv.Quote(*input.TableName)
+	for _, name := range names {
+		group += strconv.Quote(name)
+	}
+	group += strconv.Itoa(opt.MaxRetries)
+
+	batch := b.add(group, key, input, opt)
+	ctx := opt.Context
+	if ctx == nil {
+		ctx = aws.BackgroundContext()
+	}
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		b.abandon(batch)
+		return nil, WrapError(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+
+	if batch.err != nil {
+		if e, ok := batch.err.(awserr.Error); ok && e.Code() == ErrCodeValidationException {
+			return b.get(input, output, opt)
+		}
+		return nil, batch.err
+	}
+	if batch.unprocessed[key] {
+		return b.get(input, output, opt)
+	}
+	atomic.AddInt64(&b.batched, 1)
+	if output == nil {
+		output = &dynamodb.GetItemOutput{}
+	}
+	output.Item = batch.items[key]
+	b.mu.Lock()
+	shared := batch.calls[key] > 1
+	b.mu.Unlock()
+	if output.Item != nil && shared {
+		output.Item = awsutil.CopyOf(&dynamodb.GetItemOutput{Item: output.Item}).(*dynamodb.GetItemOutput).Item
+	}
+	return output, nil
+}
+
+// Adds the key to the pending batch of its group, which is executed once full
+// or once the window elapsed.
+func (b *getItemBatcher) add(group, key string, input *dynamodb.GetItemInput, opt RequestOptions) *getItemBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch, ok := b.pending[group]
+	if !ok {
+		ctx, cancel := context.WithCancel(aws.BackgroundContext())
+		batch = &getItemBatch{
+			table:  *input.TableName,
+			names:  sortedKeyNames(input.Key),
+			opt:    opt,
+			ctx:    ctx,
+			cancel: cancel,
+			done:   make(chan struct{}),
+			calls:  make(map[string]int),
+		}
+		b.pending[group] = batch
+		b.clock.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			owner := b.pending[group] == batch
+			if owner {
+				delete(b.pending, group)
+			}
+			b.mu.Unlock()
+			if owner {
+				b.execute(batch)
+			}
+		})
+	}
+	batch.waiters++
+	if batch.calls[key] == 0 {
+		batch.keys = append(batch.keys, input.Key)
+	}
+	batch.calls[key]++
+	if len(batch.keys) >= b.maxSize {
+		delete(b.pending, group)
+		go b.execute(batch)
+	}
+	return batch
+}
+
+// Stops waiting for the batch, which is canceled once no call waits for it.
+func (b *getItemBatcher) abandon(batch *getItemBatch) {
+	b.mu.Lock()
+	batch.waiters--
+	abandoned := batch.waiters == 0
+	b.mu.Unlock()
+	if abandoned {
+		batch.cancel()
+	}
+}
+
+func (b *getItemBatcher) execute(batch *getItemBatch) {
+	defer close(batch.done)
+	defer batch.cancel()
+
+	// keys are no longer added once the batch is executed
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{batch.table: {Keys: batch.keys}},
+	}
+	opt := batch.opt
+	opt.Context = batch.ctx
+	output, err := b.batchGet(input, &dynamodb.BatchGetItemOutput{}, opt)
+	if err != nil {
+		batch.err = err
+		return
+	}
+
+	batch.items = make(map[string]map[string]*dynamodb.AttributeValue)
+	for _, item := range output.Responses[batch.table] {
+		var kb strings.Builder
+		if writeKey(&kb, batch.names, item) {
+			batch.items[kb.String()] = item
+		}
+	}
+	batch.unprocessed = make(map[string]bool)
+	if u := output.UnprocessedKeys[batch.table]; u != nil {
+		for _, key := range u.Keys {
+			var kb strings.Builder
+			if writeKey(&kb, batch.names, key) {
+				batch.unprocessed[kb.String()] = true
+			}
+		}
+	}
+}
+
+// Adds the batcher counters to s.
+func (b *getItemBatcher) stats(s *Stats) {
+	if b == nil {
+		return
+	}
+	s.BatchedGetItems += atomic.LoadInt64(&b.batched)
+}
@@ -0,0 +1,99 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestPutBufferDropsLargeBuffers(t *testing.T) {
+	b := getBuffer()
+	b.Write(make([]byte, maxPooledBufferSize+1))
+	putBuffer(b)
+	for i := 0; i < 10; i++ {
+		if getBuffer() == b {
+			t.Fatal("expected buffer over the size cap not to be pooled")
+		}
+	}
+}
+
+func roundTripCompoundKey(key map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	if err := encodeCompoundKey(key, w); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	r := cbor.NewReader(&buf)
+	defer r.Close()
+	return decodeCompoundKey(r)
+}
+
+func TestCompoundKeyRoundTripConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				// alternate keys smaller and larger than the pooled buffer cap
+				size := 10
+				if i%2 == 1 {
+					size = maxPooledBufferSize + 100
+				}
+				key := map[string]*dynamodb.AttributeValue{
+					"hk": {S: aws.String(strings.Repeat(fmt.Sprint(g), size))},
+					"rk": {N: aws.String(fmt.Sprint(g*1000 + i))},
+				}
+				out, err := roundTripCompoundKey(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(key, out) {
+					t.Errorf("goroutine %d: round trip of key %d returned a different key", g, i)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func BenchmarkCompoundKeyRoundTrip(b *testing.B) {
+	key := map[string]*dynamodb.AttributeValue{
+		"hk": {S: aws.String("user#1234")},
+		"rk": {N: aws.String("42")},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := roundTripCompoundKey(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
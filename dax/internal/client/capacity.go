@@ -0,0 +1,189 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Limits the attempts in flight on each node of a cluster, see
+// Config.MaxInFlightPerNode. A nil nodeSlots does not limit anything.
+type nodeSlots struct {
+	spilled  int64 // accessed atomically
+	queued   int64 // accessed atomically
+	timeouts int64 // accessed atomically
+	waiters  int32 // accessed atomically
+
+	lock  sync.Mutex
+	freed chan struct{} // closed once a slot is freed, protected by lock
+
+	max     int64
+	timeout time.Duration
+	clock   clock
+}
+
+// Returns nodeSlots allowing up to max attempts in flight on each node, or nil
+// if max isn't positive. Attempts wait up to timeout for a free slot.
+func newNodeSlots(max int, timeout time.Duration, clk clock) *nodeSlots {
+	if max <= 0 {
+		return nil
+	}
+	return &nodeSlots{max: int64(max), timeout: timeout, clock: clockOrSystem(clk), freed: make(chan struct{})}
+}
+
+// Takes a slot of s if the node has one free.
+func (n *nodeSlots) tryAcquire(s *nodeState) bool {
+	for {
+		in := atomic.LoadInt64(&s.inFlight)
+		if in >= n.max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&s.inFlight, in, in+1) {
+			return true
+		}
+	}
+}
+
+// Returns the channel closed once a slot is freed, registering a waiter until
+// done is called.
+func (n *nodeSlots) wait() (ch <-chan struct{}, done func()) {
+	atomic.AddInt32(&n.waiters, 1)
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.freed, func() { atomic.AddInt32(&n.waiters, -1) }
+}
+
+// Wakes up the waiters once a slot is freed.
+func (n *nodeSlots) notify() {
+	if atomic.LoadInt32(&n.waiters) == 0 {
+		return
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	close(n.freed)
+	n.freed = make(chan struct{})
+}
+
+func (n *nodeSlots) stats(s *Stats) {
+	if n == nil {
+		return
+	}
+	s.SpilledRequests += atomic.LoadInt64(&n.spilled)
+	s.QueuedRequests += atomic.LoadInt64(&n.queued)
+	s.SlotTimeouts += atomic.LoadInt64(&n.timeouts)
+}
+
+// Takes a slot of the node of client for an attempt of op, prev being the
+// client of the previous attempt, and returns the client and the state of the
+// node whose slot was taken. With Config.MaxInFlightPerNode, a read finding
+// the node saturated spills to the next healthy node with a free slot other
+// than prev, and waits for a free slot only if every such node is saturated.
+// A write waits for a free slot of its node. The slot is released by attempt
+// or release.
+func (c *cluster) acquire(ctx context.Context, op string, client, prev DaxAPI) (DaxAPI, *nodeState, error) {
+	s := c.nodeStateOf(client)
+	if s == nil {
+		return client, nil, nil
+	}
+	n := c.slots
+	if n == nil {
+		atomic.AddInt64(&s.inFlight, 1)
+		return client, s, nil
+	}
+	if n.tryAcquire(s) {
+		return client, s, nil
+	}
+
+	read := isReadOp(op)
+	if read {
+		if spill, t := c.spill(client, prev); spill != nil {
+			atomic.AddInt64(&n.spilled, 1)
+			return spill, t, nil
+		}
+	}
+	atomic.AddInt64(&n.queued, 1)
+	var expired <-chan time.Time
+	if n.timeout > 0 {
+		timer := n.clock.NewTimer(n.timeout)
+		defer timer.Stop()
+		expired = timer.C()
+	}
+	for {
+		ch, done := n.wait()
+		if n.tryAcquire(s) {
+			done()
+			return client, s, nil
+		}
+		if read {
+			if spill, t := c.spill(client, prev); spill != nil {
+				done()
+				atomic.AddInt64(&n.spilled, 1)
+				return spill, t, nil
+			}
+		}
+		select {
+		case <-ch:
+			done()
+		case <-ctx.Done():
+			done()
+			return nil, nil, WrapError(request.CanceledErrorCode, "request context canceled", ctx.Err())
+		case <-expired:
+			done()
+			atomic.AddInt64(&n.timeouts, 1)
+			return nil, nil, ErrOverloaded
+		}
+	}
+}
+
+// Takes a slot of the first healthy node after the node of client in the
+// routes with a free slot, other than prev, and returns its client and state.
+func (c *cluster) spill(client, prev DaxAPI) (DaxAPI, *nodeState) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	start := 0
+	for i, route := range c.routes {
+		if route == client {
+			start = i + 1
+			break
+		}
+	}
+	for i := 0; i < len(c.routes); i++ {
+		route := c.routes[(start+i)%len(c.routes)]
+		if route == client || route == prev {
+			continue
+		}
+		if t := c.states[route]; t != nil && atomic.LoadInt32(&t.failures) == 0 && c.slots.tryAcquire(t) {
+			return route, t
+		}
+	}
+	return nil, nil
+}
+
+// Releases the slot of s taken by acquire.
+func (c *cluster) release(s *nodeState) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.inFlight, -1)
+	if c.slots != nil {
+		c.slots.notify()
+	}
+}
@@ -0,0 +1,142 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Picks the first node, the node of the previous attempt included.
+type firstNodePolicy struct {
+	recordingPolicy
+}
+
+func (p *firstNodePolicy) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	return nodes[0], nil
+}
+
+func TestClusterDaxClient_MaxInFlightPerNode(t *testing.T) {
+	cc, _ := newRoutingTestClient(t, &firstNodePolicy{})
+	defer cc.Close()
+	clock := newFakeClock()
+	cc.cluster.slots = newNodeSlots(1, 20*time.Millisecond, clock)
+	saturated, spare := cc.cluster.routes[0], cc.cluster.routes[1]
+
+	// saturate the first node
+	started, unblock := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error {
+			close(started)
+			<-unblock
+			return nil
+		}, RequestOptions{})
+	}()
+	<-started
+
+	// reads spill to the other node
+	for i := 0; i < 3; i++ {
+		var sentTo DaxAPI
+		err := cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error {
+			sentTo = client
+			return nil
+		}, RequestOptions{})
+		require.NoError(t, err)
+		require.Equal(t, spare, sentTo)
+	}
+	s := cc.Stats()
+	require.Equal(t, int64(3), s.SpilledRequests)
+	require.Zero(t, s.QueuedRequests)
+
+	// writes queue for their node
+	written := make(chan DaxAPI, 1)
+	go func() {
+		require.NoError(t, cc.retry(OpPutItem, func(client DaxAPI, o RequestOptions) error {
+			written <- client
+			return nil
+		}, RequestOptions{}))
+	}()
+	clock.waitForTimers(t, 1)
+	require.Equal(t, int64(1), cc.Stats().QueuedRequests)
+	select {
+	case <-written:
+		t.Fatal("write sent to a saturated node")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(unblock)
+	require.NoError(t, <-done)
+	require.Equal(t, saturated, <-written)
+	require.Equal(t, int64(3), cc.Stats().SpilledRequests)
+}
+
+func TestClusterDaxClient_MaxInFlightPerNodeAllSaturated(t *testing.T) {
+	cc, _ := newRoutingTestClient(t, &firstNodePolicy{})
+	defer cc.Close()
+	clock := newFakeClock()
+	cc.cluster.slots = newNodeSlots(1, 20*time.Millisecond, clock)
+
+	unblock := make(chan struct{})
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		started := make(chan struct{})
+		go func() {
+			done <- cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error {
+				close(started)
+				<-unblock
+				return nil
+			}, RequestOptions{})
+		}()
+		<-started
+	}
+
+	// reads wait once every node is saturated, up to AcquireTimeout
+	rejected := make(chan error)
+	go func() {
+		rejected <- cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error { return nil }, RequestOptions{})
+	}()
+	require.Equal(t, 20*time.Millisecond, clock.waitForTimers(t, 1))
+	clock.Advance(20 * time.Millisecond)
+	err := <-rejected
+	require.Error(t, err)
+	require.Equal(t, ErrOverloaded, err)
+	s := cc.Stats()
+	require.Equal(t, int64(1), s.QueuedRequests)
+	require.Equal(t, int64(1), s.SlotTimeouts)
+	require.Zero(t, s.RejectedRequests)
+
+	// and until a slot is freed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cc.cluster.slots.timeout = 0
+	waited := make(chan error)
+	go func() {
+		waited <- cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error { return nil }, RequestOptions{Context: ctx})
+	}()
+	select {
+	case err := <-waited:
+		t.Fatalf("read sent to a saturated node with %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(unblock)
+	require.NoError(t, <-waited)
+	require.NoError(t, <-done)
+	require.NoError(t, <-done)
+	require.Equal(t, int64(2), cc.Stats().QueuedRequests)
+}
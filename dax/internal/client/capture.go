@@ -0,0 +1,256 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// FrameDirection tells whether a Frame was sent to or received from a node.
+type FrameDirection int
+
+const (
+	// FrameRequest is a request sent to a node.
+	FrameRequest FrameDirection = iota
+	// FrameResponse is a response received from a node.
+	FrameResponse
+)
+
+func (d FrameDirection) String() string {
+	if d == FrameRequest {
+		return "request"
+	}
+	return "response"
+}
+
+// Frame is the raw bytes of a request sent to, or of a response received
+// from, a node.
+type Frame struct {
+	// Op is the operation name, such as "GetItem". Requests the client sends
+	// on its own are named "DefineKeySchema", "DefineAttributeList",
+	// "DefineAttributeListId" and "Endpoints".
+	Op string
+	// Node is the "host:port" address of the node.
+	Node      string
+	Direction FrameDirection
+	// Bytes is the CBOR encoded request or response. It is only valid during
+	// the call to CaptureFrame and must be copied to be retained.
+	Bytes []byte
+}
+
+// FrameCapture captures the frames exchanged with the nodes of a cluster, for
+// debugging.
+type FrameCapture interface {
+	// CaptureFrame is called with the request of each attempt once it is
+	// encoded, and with its response once it is decoded or failed to decode.
+	// Authentication requests are never captured. CaptureFrame is called by
+	// the goroutines sending requests and must be safe for concurrent use.
+	CaptureFrame(f Frame)
+}
+
+// A connection recording the bytes read from it until they are captured as
+// response frames.
+type recordingConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.buf = append(c.buf, b[:n]...)
+	return n, err
+}
+
+// Drops the first n recorded bytes.
+func (c *recordingConn) discard(n int) {
+	rest := len(c.buf) - n
+	if cap(c.buf) > maxPooledBufferSize && rest <= maxPooledBufferSize {
+		// don't keep the memory of a large response pinned
+		c.buf = append([]byte(nil), c.buf[n:]...)
+		return
+	}
+	copy(c.buf, c.buf[n:])
+	c.buf = c.buf[:rest]
+}
+
+// Returns encoder writing its request through a buffer captured as the
+// request frame of op, or encoder itself if frames are not captured.
+func (client *SingleDaxClient) captureRequest(op string, encoder func(writer *cbor.Writer) error) func(writer *cbor.Writer) error {
+	capture := client.pool.connConfig.frameCapture
+	if capture == nil {
+		return encoder
+	}
+	return func(writer *cbor.Writer) error {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		w := cbor.NewWriter(buf)
+		defer w.Close()
+		if err := encoder(w); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		capture.CaptureFrame(Frame{Op: op, Node: client.pool.address, Direction: FrameRequest, Bytes: buf.Bytes()})
+		return writer.Write(buf.Bytes())
+	}
+}
+
+// Captures the bytes read from t since its previous response, and not left
+// buffered for the next one, as the response frame of op.
+func (client *SingleDaxClient) captureResponse(op string, t tube) {
+	capture := client.pool.connConfig.frameCapture
+	if capture == nil {
+		return
+	}
+	nt, ok := t.(*netConnTube)
+	if !ok {
+		return
+	}
+	rc, ok := nt.conn.(*recordingConn)
+	if !ok {
+		return
+	}
+	n := len(rc.buf) - nt.cborReader.Buffered()
+	if n <= 0 {
+		return
+	}
+	capture.CaptureFrame(Frame{Op: op, Node: client.pool.address, Direction: FrameResponse, Bytes: rc.buf[:n]})
+	rc.discard(n)
+}
+
+// DecodeResponse decodes frame, a captured response to a request of
+// operation op made with input, such as a *dynamodb.GetItemInput for
+// "GetItem", into the output the client returned for it. Errors returned by
+// DAX are returned as the client returns them. The key schemas of tables and
+// the attribute names of attribute list IDs are resolved with keySchema and
+// attrNames.
+//
+// The responses to the requests the client sends on its own are decoded into
+// a []dynamodb.AttributeDefinition for "DefineKeySchema", a []string for
+// "DefineAttributeList" and an int64 for "DefineAttributeListId".
+func DecodeResponse(op string, input interface{}, frame []byte,
+	keySchema func(table string) ([]dynamodb.AttributeDefinition, error),
+	attrNames func(id int64) ([]string, error)) (interface{}, error) {
+	keySchemas := &lru.Lru{
+		MaxEntries: keySchemaLruCacheSize,
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			return keySchema(key.(string))
+		},
+	}
+	attrListIdToNames := &lru.Lru{
+		MaxEntries: attributeListLruCacheSize,
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			id := key.(int64)
+			if id == emptyAttributeListId {
+				return []string{}, nil
+			}
+			return attrNames(id)
+		},
+	}
+
+	reader := cbor.NewReader(bytes.NewReader(frame))
+	defer reader.Close()
+	ex, err := decodeError(reader)
+	if err != nil {
+		return nil, err
+	}
+	if ex != nil {
+		if d, ok := ex.(daxError); ok {
+			return nil, convertDaxError(d)
+		}
+		return nil, ex
+	}
+
+	ctx := aws.BackgroundContext()
+	invalidInput := func() (interface{}, error) {
+		return nil, awserr.New(request.InvalidParameterErrCode, "unexpected input type for "+op, nil)
+	}
+	switch op {
+	case opDefineKeySchema:
+		return decodeDefineKeySchemaOutput(reader)
+	case opDefineAttributeList:
+		return decodeDefineAttributeListOutput(reader)
+	case opDefineAttributeListId:
+		return decodeDefineAttributeListIdOutput(reader)
+	case OpGetItem:
+		in, ok := input.(*dynamodb.GetItemInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeGetItemOutput(ctx, reader, in, attrListIdToNames, &dynamodb.GetItemOutput{})
+	case OpPutItem:
+		in, ok := input.(*dynamodb.PutItemInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodePutItemOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.PutItemOutput{})
+	case OpDeleteItem:
+		in, ok := input.(*dynamodb.DeleteItemInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeDeleteItemOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.DeleteItemOutput{})
+	case OpUpdateItem:
+		in, ok := input.(*dynamodb.UpdateItemInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeUpdateItemOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.UpdateItemOutput{})
+	case OpQuery:
+		in, ok := input.(*dynamodb.QueryInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeQueryOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.QueryOutput{})
+	case OpScan:
+		in, ok := input.(*dynamodb.ScanInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeScanOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.ScanOutput{})
+	case OpBatchGetItem:
+		in, ok := input.(*dynamodb.BatchGetItemInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeBatchGetItemOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.BatchGetItemOutput{})
+	case OpBatchWriteItem:
+		return decodeBatchWriteItemOutput(ctx, reader, keySchemas, attrListIdToNames, &dynamodb.BatchWriteItemOutput{})
+	case OpTransactGetItems:
+		in, ok := input.(*dynamodb.TransactGetItemsInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeTransactGetItemsOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.TransactGetItemsOutput{})
+	case OpTransactWriteItems:
+		in, ok := input.(*dynamodb.TransactWriteItemsInput)
+		if !ok {
+			return invalidInput()
+		}
+		return decodeTransactWriteItemsOutput(ctx, reader, in, keySchemas, attrListIdToNames, &dynamodb.TransactWriteItemsOutput{})
+	default:
+		return nil, awserr.New(request.InvalidParameterErrCode, "cannot decode responses of "+op, nil)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// The source of time of a client: the delays between retries, the wait for a
+// request permit, the GetItem batch window, the cluster refreshes, the reaping
+// and pinging of idle connections and the expiry of cached key schemas. Tests
+// substitute a fake clock to control time. Deadlines of network I/O and of
+// contexts always use the system time.
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) timer
+	// AfterFunc calls f in its own goroutine once d elapsed, unless the
+	// returned timer is stopped first.
+	AfterFunc(d time.Duration, f func()) timer
+	// Sleep waits for d to elapse. It returns ctx.Err() if ctx is done first.
+	Sleep(ctx aws.Context, d time.Duration) error
+}
+
+// A timer of a clock, as a time.Timer.
+type timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) timer {
+	return systemTimer{time.AfterFunc(d, f)}
+}
+
+func (systemClock) Sleep(ctx aws.Context, d time.Duration) error {
+	return aws.SleepWithContext(ctx, d)
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// Returns c, or the system clock if c is nil.
+func clockOrSystem(c clock) clock {
+	if c == nil {
+		return systemClock{}
+	}
+	return c
+}
+
+// Sleep waits for d to elapse on the clock of cfg. It returns ctx.Err() if ctx
+// is done first.
+func Sleep(cfg *Config, ctx aws.Context, d time.Duration) error {
+	return clockOrSystem(cfg.clock).Sleep(ctx, d)
+}
@@ -0,0 +1,143 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// A clock whose time only moves when advanced by the test.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer // pending timers
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	when  time.Time
+	c     chan time.Time
+	f     func() // called instead of sending on c if not nil
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1500000000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	return c.add(d, nil)
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) timer {
+	return c.add(d, f)
+}
+
+func (c *fakeClock) Sleep(ctx aws.Context, d time.Duration) error {
+	t := c.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *fakeClock) add(d time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), c: make(chan time.Time, 1), f: f}
+	if d <= 0 {
+		t.fire(c.now)
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	return t
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.timers {
+		if p == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		go t.f()
+	} else {
+		t.c <- now
+	}
+}
+
+// Advance moves the time forward by d, firing the timers due by then in order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+	n := 0
+	for ; n < len(c.timers) && !c.timers[n].when.After(c.now); n++ {
+		c.timers[n].fire(c.timers[n].when)
+	}
+	c.timers = c.timers[n:]
+}
+
+// Waits for at least n timers to be pending, as goroutines arm their timers
+// asynchronously, and returns the duration until the next one fires.
+func (c *fakeClock) waitForTimers(t *testing.T, n int) time.Duration {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		if len(c.timers) >= n {
+			next := c.timers[0].when
+			for _, p := range c.timers {
+				if p.when.Before(next) {
+					next = p.when
+				}
+			}
+			d := next.Sub(c.now)
+			c.mu.Unlock()
+			return d
+		}
+		pending := len(c.timers)
+		c.mu.Unlock()
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pending timers, got %d", n, pending)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net"
 	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -45,6 +46,7 @@ type serviceEndpoint struct {
 	role             int
 	availabilityZone string
 	leaderSessionId  int64
+	priority, weight int // of the SRV record of the node
 }
 
 func (e *serviceEndpoint) hostPort() hostPort {
@@ -63,21 +65,250 @@ type Config struct {
 	ClusterUpdateThreshold       time.Duration
 	ClusterUpdateInterval        time.Duration
 
+	// HostPorts are the "host:port" addresses of the cluster discovery
+	// endpoint or of nodes of the cluster, answering the DAX discovery
+	// protocol. Alternatively, HostPorts may all be "srv://name" entries, such
+	// as "srv://_dax._tcp.example.internal": the nodes of the cluster are then
+	// the targets of the DNS SRV records of the names, resolved again every
+	// ClusterUpdateInterval, and the default RoutingPolicy is
+	// NewWeightedRouting, following the priorities and weights of the records.
+	// Nodes are dialed by hostname, whose addresses are cached for a fixed 30s
+	// rather than the TTLs of the DNS records.
 	HostPorts   []string
 	Region      string
 	Credentials *credentials.Credentials
 	DialContext func(ctx context.Context, network string, address string) (net.Conn, error)
 	connConfig  connConfig
 
+	// ConnectTimeout limits the time spent establishing a new connection to
+	// a node, dialing it and writing the connection handshake, TLS included,
+	// independently of the deadline of the request waiting for it. A connection
+	// timing out fails the attempt with ErrCodeConnectTimeout, which is retried
+	// on another node, and marks the node unhealthy to the RoutingPolicy until
+	// an attempt reaches it again. Defaults to 3 seconds, zero means no limit.
+	// See Stats.ConnectTimeouts.
+	ConnectTimeout time.Duration
+
 	SkipHostnameVerification bool
-	logger                   aws.Logger
-	logLevel                 aws.LogLevelType
+
+	// NodeFilter, if not nil, restricts the nodes of the cluster to those it
+	// returns true for, given the "host:port" address and the availability
+	// zone of each node found by a discovery, e.g. to pin requests to a single
+	// node. Other nodes are neither connected to nor sent requests, but the
+	// HostPorts are still used for discovery. A discovery whose nodes are all
+	// filtered out fails with an InvalidParameter error and keeps the known
+	// nodes.
+	NodeFilter func(addr, az string) bool
+
+	// KeyAffinityRouting sends the GetItem and Query requests for a partition
+	// key to the same node, so that its reads hit the same item and query
+	// caches instead of warming up the caches of every node. Keys are assigned
+	// to nodes by consistent hashing: when nodes are added or removed, only
+	// their own keys move. An attempt failing on the node of a key is retried
+	// on the next node, which also serves the keys of the node until an
+	// attempt or a health check reaches it again. The partition key is read from the key schema of the
+	// table once a node has it cached, or from the key of a GetItem with a
+	// single attribute. Other requests, queries of an index and batched GetItem
+	// calls are sent to random nodes. See Stats.AffinityRoutedRequests and
+	// NodeStats.
+	KeyAffinityRouting bool
+
+	// RoutingPolicy chooses the node of each attempt of a request, from the
+	// address, availability zone, role, health and attempts in flight of the
+	// nodes, and is told the results of the attempts and the changes of the
+	// nodes of the cluster. NewRandomRouting is the default, see also
+	// NewRoundRobinRouting and NewLeastOutstandingRouting. Requests routed by
+	// KeyAffinityRouting and the first attempts of the chunks of split
+	// batches, spread over the nodes in turn, are not affected; the retries of
+	// the chunks are. The node picked must be one of the nodes passed to Pick
+	// that is still a node of the cluster, or the attempt fails.
+	RoutingPolicy RoutingPolicy
+
+	// MaxConcurrentRequests limits the number of requests in flight at once.
+	// Requests over the limit wait up to AcquireTimeout and then fail with
+	// ErrOverloaded. Zero means no limit.
+	MaxConcurrentRequests int
+	AcquireTimeout        time.Duration
+
+	// MaxInFlightPerNode limits the number of attempts in flight on each node,
+	// so that a node slow to answer does not absorb the requests while the
+	// others are idle. A read whose node is at the limit is sent to the next
+	// healthy node below it instead, and waits only if every node is at the
+	// limit. A write waits for its node. Requests wait up to AcquireTimeout, if
+	// positive, and then fail with ErrOverloaded. Zero means no limit. See
+	// Stats.SpilledRequests and Stats.SlotTimeouts.
+	MaxInFlightPerNode int
+
+	// PipelineDepth enables pipelining when positive: requests to a node are
+	// written back-to-back on a single connection with up to PipelineDepth
+	// requests awaiting their responses. Zero keeps one request per connection.
+	PipelineDepth int
+
+	// PingAfterIdle enables a liveness check of connections that have been idle for
+	// at least this long before they are used again. Connections failing the check
+	// are replaced. Zero disables the check.
+	PingAfterIdle time.Duration
+
+	// CoalesceGetItems makes concurrent identical GetItem calls share a single
+	// request: calls for the same table, key and projection made while such a
+	// call is in flight receive copies of its output. Consistent reads are never
+	// coalesced.
+	CoalesceGetItems bool
+
+	// GetItemBatchWindow enables batching of GetItem calls when positive: calls
+	// for the same table made within this window are sent as a single
+	// BatchGetItem request of up to MaxGetItemBatchSize keys, and each call
+	// receives its own item. A call waits up to the window before its batch is
+	// sent, unless the batch fills up earlier. Consistent reads, calls with a
+	// projection or returning consumed capacity, and calls with custom retry
+	// options are sent on their own.
+	GetItemBatchWindow time.Duration
+	// MaxGetItemBatchSize is the maximum number of keys of a batch, at most 100.
+	// Zero means 100.
+	MaxGetItemBatchSize int
+
+	// BatchConcurrency is the maximum number of requests sent at once when a
+	// BatchGetItem of more than 100 keys or a BatchWriteItem of more than 25
+	// items is split into requests within the API limits. Zero means 1.
+	BatchConcurrency int
+
+	// KeySchemaTTL bounds how long the key schema of a table is cached before it
+	// is fetched again. Schemas used during the last quarter of their TTL are
+	// refreshed in the background, so only the first request for a table waits
+	// for its schema. Cached key schemas are also evicted when a request fails
+	// because the table does not exist or its key does not match. Zero means
+	// key schemas are cached until evicted.
+	KeySchemaTTL time.Duration
+
+	// ExpressionCacheSize is the number of parsed expressions cached per node.
+	// Expressions are cached by their string, attribute values are encoded on
+	// every request. Zero disables the cache.
+	ExpressionCacheSize int
+
+	// FaultInjector, if not nil, is called before each attempt of each request
+	// to inject delays and errors, for chaos testing.
+	FaultInjector FaultInjector
+
+	// SkipClientValidation disables the checks made before requests are sent,
+	// such as the limits on the size of items and transactions and the writes of
+	// the same item within a batch, leaving the validation of requests to the
+	// server.
+	SkipClientValidation bool
+
+	// FrameCapture, if not nil, receives the raw bytes of the requests and
+	// responses of each attempt, for debugging. Captured response frames can be
+	// decoded again with daxtest.Replayer. Frames are neither copied nor
+	// retained when FrameCapture is nil.
+	FrameCapture FrameCapture
+
+	// HealthCheckInterval enables the health checks of the cluster when
+	// positive: every HealthCheckInterval, each node is sent a request and the
+	// cluster is deemed reachable if any node answers within the interval. The
+	// cluster becomes unreachable after UnreachableThreshold consecutive checks
+	// failed to reach every node, and reachable again after ReachableThreshold
+	// consecutive checks reached a node. Nodes answering requests with errors
+	// are reachable. Zero disables the checks and the cluster is always deemed
+	// reachable.
+	HealthCheckInterval  time.Duration
+	UnreachableThreshold int
+	ReachableThreshold   int
+
+	// OnReachabilityChange, if not nil, is called with the new state of the
+	// cluster when it becomes unreachable or reachable again, see
+	// HealthCheckInterval.
+	OnReachabilityChange func(reachable bool)
+
+	// OnThrottle, if not nil, is called whenever an attempt of a request fails
+	// with a throttling error, before the attempt is retried, with the
+	// operation, the table of the request, or the empty string if the request
+	// is for several tables, the "host:port" address of the node and the
+	// error. It is called on the goroutine of the request, which waits for it
+	// to return: it must not block. Throttled attempts are also counted by
+	// Stats.
+	OnThrottle func(op, table, node string, err error)
+
+	// OnDiscoveryFailure, if not nil, is called whenever a discovery of the
+	// nodes of the cluster fails, with its error and the number of discoveries
+	// failed in a row, e.g. to raise an alarm while the known nodes go stale.
+	// It is called on the goroutine of the discovery, usually the background
+	// refresh: it must not block. See also DiscoveryStatus.
+	OnDiscoveryFailure func(err error, consecutiveFailures int)
+
+	// OnTopologyChange, if not nil, is called whenever a discovery adds,
+	// removes or changes the role, or the SRV priority or weight, of nodes of
+	// the cluster, with the nodes before and after the change, the first
+	// discovery included, so that the changes can be told apart by comparing
+	// the two by Addr. It is called on a goroutine of its own, one call at a
+	// time, and does not block the refreshes: the changes made while a call
+	// runs are notified by a single call with the latest nodes, the nodes of
+	// the previous call as old. Close drops the changes not notified yet and
+	// waits for a running call to return, so it must not be called from
+	// OnTopologyChange.
+	OnTopologyChange func(old, new []NodeInfo)
+
+	// BootstrapTimeout, when positive, makes New wait for the first discovery
+	// of the nodes of the cluster, retrying failed discoveries with exponential
+	// backoff for up to BootstrapTimeout, e.g. while the network of a starting
+	// container is not ready yet. New then fails with the errors of all the
+	// attempts. Zero returns from New at once, the nodes being discovered in
+	// the background: requests fail until they are.
+	BootstrapTimeout time.Duration
+
+	// DetailedErrors wraps the error of a request failing once sent to the
+	// cluster in a RequestError telling the operation, the node of the last
+	// attempt, the number of attempts and the time elapsed, and the error of
+	// an attempt attributable to a node in a NodeError. The wrapped errors are
+	// reached by errors.As, from Go 1.13 on, or by awserr.Error.OrigErr. By
+	// default, the error of the last attempt is returned as is, such as a
+	// *dynamodb.ConditionalCheckFailedException, and the details of the
+	// request are available from WithResponseMetadata.
+	DetailedErrors bool
+
+	// SlowRequestThreshold enables the logging of slow requests when positive:
+	// requests taking longer than SlowRequestThreshold, retries included, are
+	// logged at warn level with their table, attempts and nodes, and the time
+	// spent waiting for a connection from the pool and on the wire. Zero
+	// disables the logging.
+	SlowRequestThreshold time.Duration
+
+	// UserAgentExtra, if not empty, is appended to the user agent sent to the
+	// nodes, which identifies the version of the client, of Go and the OS and
+	// architecture, e.g. to tell the clients of several applications apart.
+	UserAgentExtra string
+
+	// ContextFields, if not nil, is called with the context of a request and
+	// returns key/value pairs, such as a trace ID, appended to the lines
+	// logged while the request is served, including those of its retries and
+	// errors. It is called once per request, and only if a line is logged.
+	ContextFields func(ctx context.Context) []interface{}
+
+	logger   aws.Logger
+	logLevel aws.LogLevelType
+	clock    clock // nil means the system clock
 }
 
 type connConfig struct {
 	isEncrypted              bool
 	hostname                 string
+	connectTimeout           time.Duration
 	skipHostnameVerification bool
+	pingAfterIdle            time.Duration
+	pipelineDepth            int
+	expressionCacheSize      int
+	keySchemaTTL             time.Duration
+	skipValidation           bool
+	frameCapture             FrameCapture
+	userAgent                string // empty means defaultUserAgent
+	clock                    clock
+	hosts                    *hostCache // shared by the nodes of a cluster
+}
+
+// Returns the user agent of the connections.
+func (c connConfig) agent() string {
+	if c.userAgent == "" {
+		return defaultUserAgent
+	}
+	return c.userAgent
 }
 
 func (cfg *Config) validate() error {
@@ -93,6 +324,51 @@ func (cfg *Config) validate() error {
 	if cfg.MaxPendingConnectionsPerHost < 0 {
 		return awserr.New(request.InvalidParameterErrCode, "MaxPendingConnectionsPerHost cannot be negative", nil)
 	}
+	if cfg.MaxConcurrentRequests < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "MaxConcurrentRequests cannot be negative", nil)
+	}
+	if cfg.AcquireTimeout < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "AcquireTimeout cannot be negative", nil)
+	}
+	if cfg.MaxInFlightPerNode < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "MaxInFlightPerNode cannot be negative", nil)
+	}
+	if cfg.PipelineDepth < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "PipelineDepth cannot be negative", nil)
+	}
+	if cfg.BootstrapTimeout < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "BootstrapTimeout cannot be negative", nil)
+	}
+	if cfg.ConnectTimeout < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "ConnectTimeout cannot be negative", nil)
+	}
+	if cfg.PingAfterIdle < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "PingAfterIdle cannot be negative", nil)
+	}
+	if cfg.KeySchemaTTL < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "KeySchemaTTL cannot be negative", nil)
+	}
+	if cfg.GetItemBatchWindow < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "GetItemBatchWindow cannot be negative", nil)
+	}
+	if cfg.MaxGetItemBatchSize < 0 || cfg.MaxGetItemBatchSize > maxBatchGetItemKeys {
+		return awserr.New(request.InvalidParameterErrCode, "MaxGetItemBatchSize must be between 0 and 100", nil)
+	}
+	if cfg.BatchConcurrency < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "BatchConcurrency cannot be negative", nil)
+	}
+	if cfg.ExpressionCacheSize < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "ExpressionCacheSize cannot be negative", nil)
+	}
+	if cfg.HealthCheckInterval < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "HealthCheckInterval cannot be negative", nil)
+	}
+	if cfg.UnreachableThreshold < 0 || cfg.ReachableThreshold < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "UnreachableThreshold and ReachableThreshold cannot be negative", nil)
+	}
+	if cfg.SlowRequestThreshold < 0 {
+		return awserr.New(request.InvalidParameterErrCode, "SlowRequestThreshold cannot be negative", nil)
+	}
 	return nil
 }
 
@@ -111,6 +387,13 @@ var defaultConfig = Config{
 	MaxPendingConnectionsPerHost: 10,
 	ClusterUpdateInterval:        time.Second * 4,
 	ClusterUpdateThreshold:       time.Millisecond * 125,
+	ConnectTimeout:               time.Second * 3,
+	KeySchemaTTL:                 time.Hour,
+	ExpressionCacheSize:          1000,
+	MaxGetItemBatchSize:          maxBatchGetItemKeys,
+	BatchConcurrency:             4,
+	UnreachableThreshold:         3,
+	ReachableThreshold:           3,
 
 	Credentials: defaults.CredChain(defaults.Config(), defaults.Handlers()),
 
@@ -123,6 +406,7 @@ var defaultConfig = Config{
 var defaultPorts = map[string]int{
 	"dax":  8111,
 	"daxs": 9111,
+	"srv":  0,
 }
 
 func DefaultConfig() Config {
@@ -130,22 +414,47 @@ func DefaultConfig() Config {
 }
 
 type ClusterDaxClient struct {
-	config  Config
-	cluster *cluster
+	config    Config
+	cluster   *cluster
+	limiter   *requestLimiter
+	coalescer *getItemCoalescer
+	batcher   *getItemBatcher
+	throttles *throttleCounter
+
+	affinityRouted int64 // accessed atomically
 
 	handlers *request.Handlers
 }
 
 func New(config Config) (*ClusterDaxClient, error) {
+	return NewWithContext(aws.BackgroundContext(), config)
+}
+
+// NewWithContext is New with ctx aborting the wait for the first discovery of
+// the cluster, see Config.BootstrapTimeout.
+func NewWithContext(ctx aws.Context, config Config) (*ClusterDaxClient, error) {
 	cluster, err := newCluster(config)
 	if err != nil {
 		return nil, err
 	}
+	if config.BootstrapTimeout > 0 {
+		if err = cluster.bootstrap(ctx); err != nil {
+			cluster.Close()
+			return nil, err
+		}
+	}
 	err = cluster.start()
 	if err != nil {
 		return nil, err
 	}
-	client := &ClusterDaxClient{config: config, cluster: cluster}
+	client := &ClusterDaxClient{
+		config:    config,
+		cluster:   cluster,
+		limiter:   newRequestLimiter(config.MaxConcurrentRequests, config.AcquireTimeout, config.clock),
+		coalescer: newGetItemCoalescer(config.CoalesceGetItems),
+		throttles: newThrottleCounter(config.clock),
+	}
+	client.batcher = newGetItemBatcher(config.GetItemBatchWindow, config.MaxGetItemBatchSize, config.clock, client.getItem, client.BatchGetItemWithOptions)
 	client.handlers = client.buildHandlers()
 	return client, nil
 }
@@ -154,6 +463,66 @@ func (cc *ClusterDaxClient) Close() error {
 	return cc.cluster.Close()
 }
 
+// Stats returns the counters of the client's connections across all nodes.
+func (cc *ClusterDaxClient) Stats() Stats {
+	s := cc.cluster.stats()
+	cc.limiter.stats(&s)
+	cc.coalescer.stats(&s)
+	cc.batcher.stats(&s)
+	cc.throttles.stats(&s)
+	cc.cluster.health.stats(&s)
+	cc.cluster.discoveryStats(&s)
+	cc.cluster.slots.stats(&s)
+	s.AffinityRoutedRequests += atomic.LoadInt64(&cc.affinityRouted)
+	if p, ok := cc.cluster.policy.(interface{ stats(*Stats) }); ok {
+		p.stats(&s)
+	}
+	return s
+}
+
+// NodeStats returns the counters of each node of the cluster by "host:port"
+// address, e.g. to see how requests are distributed among the nodes.
+func (cc *ClusterDaxClient) NodeStats() map[string]Stats {
+	return cc.cluster.nodeStats()
+}
+
+// DiscoveryStatus returns the status of the discoveries of the nodes of the
+// cluster.
+func (cc *ClusterDaxClient) DiscoveryStatus() DiscoveryStatus {
+	return cc.cluster.discoveryStatus()
+}
+
+// Reachable returns false while the health checks of the cluster find it
+// unreachable, see Config.HealthCheckInterval.
+func (cc *ClusterDaxClient) Reachable() bool {
+	return cc.cluster.health.reachable()
+}
+
+// Nodes returns the sorted "host:port" addresses of the nodes of the cluster
+// in use.
+func (cc *ClusterDaxClient) Nodes() []string {
+	return cc.cluster.nodes()
+}
+
+// RefreshEndpoints pulls the endpoints of the cluster now, instead of at the
+// next ClusterUpdateInterval, and applies them. If the pull fails, its error is
+// returned and the current endpoints are kept. Concurrent calls share a single
+// pull.
+func (cc *ClusterDaxClient) RefreshEndpoints(ctx context.Context) error {
+	return cc.cluster.refreshEndpoints(ctx)
+}
+
+// Encrypted returns whether the connections to the cluster use TLS, as
+// configured by the daxs scheme of its endpoint.
+func (cc *ClusterDaxClient) Encrypted() bool {
+	return cc.cluster.config.connConfig.isEncrypted
+}
+
+// InvalidateTableCache evicts the cached key schema of the table on all nodes.
+func (cc *ClusterDaxClient) InvalidateTableCache(table string) {
+	cc.cluster.invalidateTableCache(table)
+}
+
 func (cc *ClusterDaxClient) endpoints(opt RequestOptions) ([]serviceEndpoint, error) {
 	var out []serviceEndpoint
 	var err error
@@ -168,11 +537,15 @@ func (cc *ClusterDaxClient) endpoints(opt RequestOptions) ([]serviceEndpoint, er
 }
 
 func (cc *ClusterDaxClient) PutItemWithOptions(input *dynamodb.PutItemInput, output *dynamodb.PutItemOutput, opt RequestOptions) (*dynamodb.PutItemOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.PutItemWithOptions(input, output, o)
 		return err
 	}
+	opt.table = inputTable(input)
 	if err = cc.retry(OpPutItem, action, opt); err != nil {
 		return output, err
 	}
@@ -180,11 +553,15 @@ func (cc *ClusterDaxClient) PutItemWithOptions(input *dynamodb.PutItemInput, out
 }
 
 func (cc *ClusterDaxClient) DeleteItemWithOptions(input *dynamodb.DeleteItemInput, output *dynamodb.DeleteItemOutput, opt RequestOptions) (*dynamodb.DeleteItemOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.DeleteItemWithOptions(input, output, o)
 		return err
 	}
+	opt.table = inputTable(input)
 	if err = cc.retry(OpDeleteItem, action, opt); err != nil {
 		return output, err
 	}
@@ -192,35 +569,92 @@ func (cc *ClusterDaxClient) DeleteItemWithOptions(input *dynamodb.DeleteItemInpu
 }
 
 func (cc *ClusterDaxClient) UpdateItemWithOptions(input *dynamodb.UpdateItemInput, output *dynamodb.UpdateItemOutput, opt RequestOptions) (*dynamodb.UpdateItemOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.UpdateItemWithOptions(input, output, o)
 		return err
 	}
+	opt.table = inputTable(input)
 	if err = cc.retry(OpUpdateItem, action, opt); err != nil {
 		return output, err
 	}
 	return output, nil
 }
 
+// BatchWriteItemWithOptions splits requests of more than 25 items into requests
+// of at most 25 items, sent to the nodes in turn up to Config.BatchConcurrency
+// at once, and merges their outputs. Items of a split request may be written in
+// any order, and a failure of some of the requests is reported as a *BatchWriteError.
 func (cc *ClusterDaxClient) BatchWriteItemWithOptions(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
+	if chunks := splitBatchWriteItem(input, maxBatchWriteItems); chunks != nil {
+		// writes of the same item split into different requests would not be detected by the nodes
+		if err := cc.validateBatchWriteItem(opt.Context, input); err != nil {
+			return output, err
+		}
+		return cc.batchWriteItemChunks(chunks, output, opt)
+	}
+	return cc.batchWriteItem(input, output, opt)
+}
+
+// batchWriteValidator is implemented by clients checking batch writes before
+// they are sent.
+type batchWriteValidator interface {
+	validateBatchWriteItem(ctx aws.Context, input *dynamodb.BatchWriteItemInput) error
+}
+
+// Checks the whole input with the key schemas cached by a node, if any. Errors
+// picking a node are left to the requests.
+func (cc *ClusterDaxClient) validateBatchWriteItem(ctx aws.Context, input *dynamodb.BatchWriteItemInput) error {
+	client, err := cc.cluster.client(nil)
+	if err != nil {
+		return nil
+	}
+	v, ok := client.(batchWriteValidator)
+	if !ok {
+		return nil
+	}
+	if err = v.validateBatchWriteItem(ctx, input); err != nil {
+		if daxErr, ok := err.(daxError); ok {
+			return convertDaxError(daxErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (cc *ClusterDaxClient) batchWriteItem(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	return cc.batchWriteItemWith(cc.pick(OpBatchWriteItem), input, output, opt)
+}
+
+func (cc *ClusterDaxClient) batchWriteItemWith(pick func(prev DaxAPI) (DaxAPI, error), input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.BatchWriteItemWithOptions(input, output, o)
 		return err
 	}
-	if err = cc.retry(OpBatchWriteItem, action, opt); err != nil {
+	opt.table = inputTable(input)
+	if err = cc.retryWith(OpBatchWriteItem, pick, action, opt); err != nil {
 		return output, err
 	}
 	return output, nil
 }
 
 func (cc *ClusterDaxClient) TransactWriteItemsWithOptions(input *dynamodb.TransactWriteItemsInput, output *dynamodb.TransactWriteItemsOutput, opt RequestOptions) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.TransactWriteItemsWithOptions(input, output, o)
 		return err
 	}
+	opt.table = inputTable(input)
 	if err = cc.retry(OpTransactWriteItems, action, opt); err != nil {
 		return output, err
 	}
@@ -228,11 +662,15 @@ func (cc *ClusterDaxClient) TransactWriteItemsWithOptions(input *dynamodb.Transa
 }
 
 func (cc *ClusterDaxClient) TransactGetItemsWithOptions(input *dynamodb.TransactGetItemsInput, output *dynamodb.TransactGetItemsOutput, opt RequestOptions) (*dynamodb.TransactGetItemsOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.TransactGetItemsWithOptions(input, output, o)
 		return err
 	}
+	opt.table = inputTable(input)
 	if err = cc.retry(OpTransactGetItems, action, opt); err != nil {
 		return output, err
 	}
@@ -240,48 +678,104 @@ func (cc *ClusterDaxClient) TransactGetItemsWithOptions(input *dynamodb.Transact
 }
 
 func (cc *ClusterDaxClient) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
+	if cc.coalescer == nil && cc.batcher == nil {
+		return cc.getItem(input, output, opt)
+	}
+	out, err := cc.coalescer.do(cc.newContext(opt), input, func() (*dynamodb.GetItemOutput, error) {
+		if cc.batcher != nil {
+			return cc.batcher.do(input, output, opt)
+		}
+		return cc.getItem(input, output, opt)
+	})
+	if out != nil && output != nil && out != output {
+		*output = *out
+		out = output
+	}
+	return out, err
+}
+
+func (cc *ClusterDaxClient) getItem(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.GetItemWithOptions(input, output, o)
 		return err
 	}
-	if err = cc.retry(OpGetItem, action, opt); err != nil {
+	opt.table = inputTable(input)
+	pick := cc.pick(OpGetItem)
+	if h, ok := cc.getItemAffinity(input); ok {
+		pick = cc.affinityPick(h)
+	}
+	if err = cc.retryWith(OpGetItem, pick, action, opt); err != nil {
 		return output, err
 	}
 	return output, nil
 }
 
 func (cc *ClusterDaxClient) QueryWithOptions(input *dynamodb.QueryInput, output *dynamodb.QueryOutput, opt RequestOptions) (*dynamodb.QueryOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.QueryWithOptions(input, output, o)
 		return err
 	}
-	if err = cc.retry(OpQuery, action, opt); err != nil {
+	opt.table = inputTable(input)
+	pick := cc.pick(OpQuery)
+	if h, ok := cc.queryAffinity(input); ok {
+		pick = cc.affinityPick(h)
+	}
+	if err = cc.retryWith(OpQuery, pick, action, opt); err != nil {
 		return output, err
 	}
 	return output, nil
 }
 
 func (cc *ClusterDaxClient) ScanWithOptions(input *dynamodb.ScanInput, output *dynamodb.ScanOutput, opt RequestOptions) (*dynamodb.ScanOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.ScanWithOptions(input, output, o)
 		return err
 	}
+	opt.table = inputTable(input)
 	if err = cc.retry(OpScan, action, opt); err != nil {
 		return output, err
 	}
 	return output, nil
 }
 
+// BatchGetItemWithOptions splits requests of more than 100 keys into requests
+// of at most 100 keys, sent to the nodes in turn up to Config.BatchConcurrency
+// at once, and merges their outputs. The keys of the requests that failed are
+// returned as UnprocessedKeys, the call fails only if every request failed.
 func (cc *ClusterDaxClient) BatchGetItemWithOptions(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
+	if err := validateParams(input); err != nil {
+		return output, err
+	}
+	if chunks := splitBatchGetItem(input, maxBatchGetItemKeys); chunks != nil {
+		return cc.batchGetItemChunks(chunks, output, opt)
+	}
+	return cc.batchGetItem(input, output, opt)
+}
+
+func (cc *ClusterDaxClient) batchGetItem(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
+	return cc.batchGetItemWith(cc.pick(OpBatchGetItem), input, output, opt)
+}
+
+func (cc *ClusterDaxClient) batchGetItemWith(pick func(prev DaxAPI) (DaxAPI, error), input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
 	var err error
 	action := func(client DaxAPI, o RequestOptions) error {
 		output, err = client.BatchGetItemWithOptions(input, output, o)
 		return err
 	}
-	if err = cc.retry(OpBatchGetItem, action, opt); err != nil {
+	opt.table = inputTable(input)
+	if err = cc.retryWith(OpBatchGetItem, pick, action, opt); err != nil {
 		return output, err
 	}
 	return output, nil
@@ -321,26 +815,73 @@ func (cc *ClusterDaxClient) send(req *request.Request) {
 		client.send(req)
 		return req.Error
 	}
+	opt.table = inputTable(req.Params)
 	if err := cc.retry(req.Operation.Name, action, opt); err != nil {
 		req.Error = err
 	}
 }
 
-func (cc *ClusterDaxClient) retry(op string, action func(client DaxAPI, o RequestOptions) error, opt RequestOptions) (err error) {
+func (cc *ClusterDaxClient) retry(op string, action func(client DaxAPI, o RequestOptions) error, opt RequestOptions) error {
+	return cc.retryWith(op, cc.pick(op), action, opt)
+}
+
+// retryWith is retry with pick choosing the client of each attempt from the client
+// of the previous attempt, nil for the first attempt.
+func (cc *ClusterDaxClient) retryWith(op string, pick func(prev DaxAPI) (DaxAPI, error), action func(client DaxAPI, o RequestOptions) error, opt RequestOptions) (err error) {
+	clk := clockOrSystem(cc.config.clock)
+	start := clk.Now()
+	var client DaxAPI
+	var failedOn DaxAPI       // node of the error of the last attempt, if attributable to one
+	var timings *requestTimer // nil unless slow requests are logged
+	made := 0
+	var id string // generated once needed
+	correlationID := func() string {
+		if id == "" {
+			id = newCorrelationID()
+		}
+		return id
+	}
 	defer func() {
 		if daxErr, ok := err.(daxError); ok {
 			err = convertDaxError(daxErr)
 		}
+		if made == 0 || err == ErrClientClosed {
+			return
+		}
+		elapsed := clk.Now().Sub(start)
+		md := ResponseMetadata{Op: op, Attempts: made, Elapsed: elapsed}
+		md.Node, md.AZ = cc.cluster.nodeInfo(client)
+		if err != nil && cc.config.DetailedErrors {
+			if failedOn != nil {
+				addr, az := cc.cluster.nodeInfo(failedOn)
+				err = &NodeError{Addr: addr, AZ: az, Err: err}
+			}
+			err = &RequestError{Op: op, CorrelationID: correlationID(), Node: md.Node, Attempts: made, Elapsed: elapsed, Err: err}
+		}
+		completeRequest(op, opt, md, err, correlationID)
+		cc.logSlowRequest(op, opt, md, elapsed, timings, correlationID)
 	}()
 
+	if cc.config.SlowRequestThreshold > 0 {
+		timings = &requestTimer{}
+		opt.Context = withRequestTimer(cc.newContext(opt), timings)
+	}
 	ctx := cc.newContext(opt)
+	opt.Logger = withContextFields(opt.Logger, ctx, cc.config.ContextFields)
+	if err := cc.limiter.acquire(ctx); err != nil {
+		if err == ctx.Err() {
+			return WrapError(request.CanceledErrorCode, "request context canceled", err)
+		}
+		return err
+	}
+	defer cc.limiter.release()
 
 	var sleepFun func() error
 	if opt.RetryDelay > 0 {
 		retryDelay := opt.RetryDelay
 		if opt.SleepDelayFn == nil {
 			sleepFun = func() error {
-				return aws.SleepWithContext(ctx, retryDelay)
+				return clk.Sleep(ctx, retryDelay)
 			}
 		} else {
 			sleepFun = func() error {
@@ -355,22 +896,44 @@ func (cc *ClusterDaxClient) retry(op string, action func(client DaxAPI, o Reques
 
 	var req request.Request
 	var ok bool
-	var client DaxAPI
 	// Start from 0 to accomodate for the initial request
 	for i := 0; i <= attempts; i++ {
 		if i > 0 && opt.Logger != nil && opt.LogLevel.Matches(aws.LogDebugWithRequestRetries) {
-			opt.Logger.Log(fmt.Sprintf("DEBUG: Retrying Request %s/%s, attempt %d", service, op, i))
+			opt.Logger.Log(fmt.Sprintf("DEBUG: Retrying Request %s/%s %s, attempt %d", service, op, correlationID(), i))
+		}
+		made++
+		prev := client
+		client, err = pick(prev)
+		var node *nodeState
+		if err == nil {
+			if client, node, err = cc.cluster.acquire(ctx, op, client, prev); err != nil {
+				return err
+			}
 		}
-		client, err = cc.cluster.client(client)
 		if err != nil {
 			if req, ok = cc.shouldRetry(opt, err); !ok {
 				return err
 			}
 		}
 
+		failedOn = nil
 		if err == nil {
-			if err = action(client, opt); err == nil {
+			attemptStart := clk.Now()
+			err = cc.cluster.attempt(node, client, clk, func() error { return cc.injectFault(ctx, op, client, i) }, func() error { return action(client, opt) })
+			if timings != nil {
+				timings.addAttempt(cc.cluster.nodeOf(client), clk.Now().Sub(attemptStart))
+			}
+			if err == nil {
 				return nil
+			}
+			if !isClientSideError(err) {
+				failedOn = client
+			}
+			cc.observeThrottle(op, opt, client, err)
+			if cc.cluster.isClosed() {
+				return ErrClientClosed
+			} else if ctx.Err() != nil {
+				return err
 			} else if req, ok = cc.shouldRetry(opt, err); !ok {
 				return err
 			}
@@ -381,18 +944,19 @@ func (cc *ClusterDaxClient) retry(op string, action func(client DaxAPI, o Reques
 			delay := opt.Retryer.RetryRules(&req)
 			if delay != 0 {
 				if opt.SleepDelayFn == nil {
-					aws.SleepWithContext(ctx, delay)
+					clk.Sleep(ctx, delay)
 				} else {
 					opt.SleepDelayFn(delay)
 				}
 			} else if sleepFun != nil {
 				if err := sleepFun(); err != nil {
-					return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+					failedOn = nil
+					return WrapError(request.CanceledErrorCode, "request context canceled", err)
 				}
 			}
 
 			if err != nil && opt.Logger != nil && opt.LogLevel.Matches(aws.LogDebugWithRequestRetries) {
-				opt.Logger.Log(fmt.Sprintf("DEBUG: Error in executing request %s/%s. : %s", service, op, err))
+				opt.Logger.Log(fmt.Sprintf("DEBUG: Error in executing request %s/%s %s. : %s", service, op, correlationID(), err))
 			}
 		}
 	}
@@ -409,6 +973,16 @@ func (cc *ClusterDaxClient) newContext(o RequestOptions) aws.Context {
 func (cc *ClusterDaxClient) shouldRetry(o RequestOptions, err error) (request.Request, bool) {
 	req := request.Request{}
 	req.Error = err
+	if err == ErrClientClosed {
+		return req, false
+	}
+	if _, ok := err.(*ItemTooLargeError); ok {
+		return req, false
+	}
+	// the request could not be encoded, eg: it holds a number DynamoDB cannot store
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == request.InvalidParameterErrCode {
+		return req, false
+	}
 	if _, ok := err.(daxError); ok {
 		retry := o.Retryer.ShouldRetry(&req)
 		return req, retry
@@ -417,17 +991,37 @@ func (cc *ClusterDaxClient) shouldRetry(o RequestOptions, err error) (request.Re
 }
 
 type cluster struct {
-	lock           sync.RWMutex
-	active         map[hostPort]DaxAPI // protected by lock
-	routes         []DaxAPI            // protected by lock
-	closed         bool                // protected by lock
-	lastRefreshErr error               // protected by lock
+	retired Stats // counters of closed clients, accessed atomically
 
-	lastUpdateNs int64
-	executor     *taskExecutor
+	lock           sync.RWMutex
+	active         map[hostPort]DaxAPI   // protected by lock
+	zones          map[hostPort]string   // availability zones of the active nodes, protected by lock
+	routes         []DaxAPI              // protected by lock
+	ring           *hashRing             // nodes of Config.KeyAffinityRouting, protected by lock
+	states         map[DaxAPI]*nodeState // of the active nodes, protected by lock
+	closed         bool                  // protected by lock
+	lastRefreshErr error                 // protected by lock
+	discovery      DiscoveryStatus       // protected by lock
+
+	discoveryFailures int64 // accessed atomically
+
+	lastUpdateNs  int64
+	executor      *taskExecutor
+	closers       sync.WaitGroup // tracks clients being closed in the background
+	health        *healthMonitor
+	refreshErrLog *repeatedLog // suppresses the repeated refresh errors
+
+	pullMu      sync.Mutex // serializes the refreshes, so that the last pull started is applied last
+	refreshMu   sync.Mutex
+	refreshCall *refreshCall // forced refresh in flight, protected by refreshMu
 
 	seeds         []hostPort
+	srv           bool // seeds are names of SRV records
+	resolver      resolver
 	config        Config
+	policy        RoutingPolicy
+	topology      *topologyNotifier // nil without Config.OnTopologyChange
+	slots         *nodeSlots
 	clientBuilder clientBuilder
 }
 
@@ -439,11 +1033,29 @@ func newCluster(cfg Config) (*cluster, error) {
 	if err != nil {
 		return nil, err
 	}
+	_, _, scheme, _ := parseHostPort(cfg.HostPorts[0])
+	srv := scheme == "srv"
 	cfg.connConfig.isEncrypted = isEncrypted
 	cfg.connConfig.skipHostnameVerification = cfg.SkipHostnameVerification
 	cfg.connConfig.hostname = hostname
+	cfg.connConfig.pingAfterIdle = cfg.PingAfterIdle
+	cfg.connConfig.pipelineDepth = cfg.PipelineDepth
+	cfg.connConfig.expressionCacheSize = cfg.ExpressionCacheSize
+	cfg.connConfig.keySchemaTTL = cfg.KeySchemaTTL
+	cfg.connConfig.skipValidation = cfg.SkipClientValidation
+	cfg.connConfig.frameCapture = cfg.FrameCapture
+	cfg.connConfig.userAgent = userAgentString(cfg.UserAgentExtra)
+	cfg.connConfig.clock = cfg.clock
+	cfg.connConfig.connectTimeout = cfg.ConnectTimeout
+	cfg.connConfig.hosts = newHostCache(net.DefaultResolver, cfg.clock)
 	cfg.validateConnConfig()
-	return &cluster{seeds: seeds, config: cfg, executor: newExecutor(), clientBuilder: &singleClientBuilder{}}, nil
+	policy := cfg.RoutingPolicy
+	if policy == nil && srv {
+		policy = NewWeightedRouting()
+	} else if policy == nil {
+		policy = NewRandomRouting()
+	}
+	return &cluster{seeds: seeds, srv: srv, resolver: net.DefaultResolver, config: cfg, policy: policy, topology: newTopologyNotifier(cfg.OnTopologyChange), slots: newNodeSlots(cfg.MaxInFlightPerNode, cfg.AcquireTimeout, cfg.clock), executor: newExecutor(cfg.clock), health: newHealthMonitor(cfg), refreshErrLog: newRepeatedLog(cfg.clock), clientBuilder: &singleClientBuilder{}}, nil
 }
 
 func getHostPorts(hosts []string) (hostPorts []hostPort, hostname string, isEncrypted bool, err error) {
@@ -453,11 +1065,17 @@ func getHostPorts(hosts []string) (hostPorts []hostPort, hostname string, isEncr
 		return nil, "", false, e
 	}
 
+	srv := false
 	for i, hp := range hosts {
 		host, port, scheme, err := parseHostPort(hp)
 		if err != nil {
 			return handle(err)
 		}
+		if i == 0 {
+			srv = scheme == "srv"
+		} else if srv != (scheme == "srv") {
+			return handle(awserr.New(request.ErrCodeRequestError, "Inconsistency between the schemes of provided endpoints.", nil))
+		}
 
 		if isEncrypted != (scheme == "daxs") {
 			if i == 0 {
@@ -504,6 +1122,8 @@ func parseHostPort(hostPort string) (host string, port int, scheme string, err e
 	port, err = strconv.Atoi(portStr)
 	if err != nil {
 		port = defaultPorts[scheme]
+	} else if scheme == "srv" {
+		return handle(awserr.New(request.ErrCodeRequestError, "srv endpoints take their ports from their SRV records", nil))
 	}
 
 	if _, ok := defaultPorts[scheme]; !ok {
@@ -520,24 +1140,48 @@ func (c *cluster) start() error {
 		return nil
 	})
 	c.executor.start(idleConnectionReapDelay, c.reapIdleConnections)
-	c.safeRefresh(false)
+	if c.config.HealthCheckInterval > 0 {
+		c.executor.start(c.config.HealthCheckInterval, c.checkHealth)
+	}
+	if c.config.BootstrapTimeout <= 0 {
+		c.safeRefresh(false)
+	}
 	return nil
 }
 
+// Close stops the background refresh and reaper tasks and closes all clients.
+// It blocks until every goroutine started by the cluster has exited.
 func (c *cluster) Close() error {
-	c.executor.stopAll()
-
 	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.closed = true
-	for _, client := range c.routes {
-		c.closeClient(client)
+	if c.closed {
+		c.lock.Unlock()
+		return nil
 	}
+	c.closed = true
+	routes := c.routes
 	c.routes = nil
 	c.active = nil
+	c.zones = nil
+	c.ring = nil
+	c.states = nil
+	c.lock.Unlock()
+
+	// must not hold the lock here as a running refresh may be waiting for it
+	c.executor.stopAll()
+	c.topology.close()
+	for _, client := range routes {
+		c.closeClient(client)
+	}
+	c.closers.Wait()
 	return nil
 }
 
+func (c *cluster) isClosed() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.closed
+}
+
 func (c *cluster) reapIdleConnections() error {
 	c.lock.RLock()
 	clients := c.routes
@@ -551,13 +1195,28 @@ func (c *cluster) reapIdleConnections() error {
 	return nil
 }
 
+func (c *cluster) invalidateTableCache(table string) {
+	c.lock.RLock()
+	clients := c.routes
+	c.lock.RUnlock()
+
+	for _, client := range clients {
+		if i, ok := client.(tableCacheInvalidator); ok {
+			i.InvalidateTableCache(table)
+		}
+	}
+}
+
 func (c *cluster) client(prev DaxAPI) (DaxAPI, error) {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
+	if c.closed {
+		return nil, ErrClientClosed
+	}
 	n := len(c.routes)
 	if n == 0 {
-		return nil, awserr.New(ErrCodeServiceUnavailable, "No routes found", c.lastRefreshError())
+		return nil, WrapError(ErrCodeServiceUnavailable, "No routes found", c.lastRefreshError())
 	}
 	if n == 1 {
 		return c.routes[0], nil
@@ -572,6 +1231,53 @@ func (c *cluster) client(prev DaxAPI) (DaxAPI, error) {
 	return c.routes[r], nil
 }
 
+// Returns the client of the i-th route, modulo the number of routes.
+func (c *cluster) clientAt(i int) (DaxAPI, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	n := len(c.routes)
+	if n == 0 {
+		return nil, WrapError(ErrCodeServiceUnavailable, "No routes found", c.lastRefreshError())
+	}
+	return c.routes[i%n], nil
+}
+
+// Returns the "host:port" address of the node of client, or the empty string
+// if client is not a node of the cluster.
+func (c *cluster) nodeOf(client DaxAPI) string {
+	addr, _ := c.nodeInfo(client)
+	return addr
+}
+
+// Returns the sorted "host:port" addresses of the active nodes.
+func (c *cluster) nodes() []string {
+	c.lock.RLock()
+	nodes := make([]string, 0, len(c.active))
+	for hp := range c.active {
+		nodes = append(nodes, net.JoinHostPort(hp.host, strconv.Itoa(hp.port)))
+	}
+	c.lock.RUnlock()
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Returns the "host:port" address and the availability zone of the node of
+// client, or empty strings if client is not a node of the cluster.
+func (c *cluster) nodeInfo(client DaxAPI) (addr, az string) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for hp, cli := range c.active {
+		if cli == client {
+			return net.JoinHostPort(hp.host, strconv.Itoa(hp.port)), c.zones[hp]
+		}
+	}
+	return "", ""
+}
+
 func (c *cluster) safeRefresh(force bool) {
 	err := c.refresh(force)
 	c.lock.Lock()
@@ -587,7 +1293,7 @@ func (c *cluster) lastRefreshError() error {
 
 func (c *cluster) refresh(force bool) error {
 	last := atomic.LoadInt64(&c.lastUpdateNs)
-	now := time.Now().UnixNano()
+	now := clockOrSystem(c.config.clock).Now().UnixNano()
 	if now-last > c.config.ClusterUpdateThreshold.Nanoseconds() || force {
 		if atomic.CompareAndSwapInt64(&c.lastUpdateNs, last, now) {
 			return c.refreshNow()
@@ -596,18 +1302,104 @@ func (c *cluster) refresh(force bool) error {
 	return nil
 }
 
+// A forced refresh shared by concurrent refreshEndpoints calls.
+type refreshCall struct {
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// Pulls the endpoints of the cluster now and applies them, leaving the
+// current endpoints in place if the pull fails. Concurrent calls share a
+// single pull. Returns early if ctx is done, the pull then completes in the
+// background.
+func (c *cluster) refreshEndpoints(ctx context.Context) error {
+	c.refreshMu.Lock()
+	call := c.refreshCall
+	if call == nil {
+		c.lock.Lock()
+		if c.closed {
+			c.lock.Unlock()
+			c.refreshMu.Unlock()
+			return ErrClientClosed
+		}
+		c.closers.Add(1)
+		c.lock.Unlock()
+		call = &refreshCall{done: make(chan struct{})}
+		c.refreshCall = call
+		go func() {
+			defer c.closers.Done()
+			atomic.StoreInt64(&c.lastUpdateNs, clockOrSystem(c.config.clock).Now().UnixNano())
+			err := c.refreshNow()
+			c.lock.Lock()
+			c.lastRefreshErr = err
+			c.lock.Unlock()
+			c.refreshMu.Lock()
+			c.refreshCall = nil
+			c.refreshMu.Unlock()
+			call.err = err
+			close(call.done)
+		}()
+	}
+	c.refreshMu.Unlock()
+
+	if ctx == nil {
+		ctx = aws.BackgroundContext()
+	}
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return WrapError(request.CanceledErrorCode, "request context canceled", ctx.Err())
+	}
+}
+
 func (c *cluster) refreshNow() error {
-	cfg, err := c.pullEndpoints()
+	return c.refreshNowWith(aws.BackgroundContext())
+}
+
+// refreshNowWith is refreshNow with ctx aborting the discovery. The periodic,
+// forced and bootstrap refreshes all go through it one at a time, so that the
+// endpoints of a pull started before another never replace those of the other.
+func (c *cluster) refreshNowWith(ctx aws.Context) error {
+	c.pullMu.Lock()
+	defer c.pullMu.Unlock()
+	cfg, err := c.pullEndpoints(ctx)
+	c.discovered(err)
+	if err == nil {
+		cfg, err = c.filterNodes(cfg)
+	}
 	if err != nil {
-		c.config.logger.Log(fmt.Sprintf("ERROR: Failed to refresh endpoint : %s", err))
+		if line := c.refreshErrLog.filter(fmt.Sprintf("ERROR: Failed to refresh endpoint : %s", err)); line != "" {
+			c.config.logger.Log(line)
+		}
 		return err
 	}
+	c.refreshErrLog.reset()
 	if !c.hasChanged(cfg) {
 		return nil
 	}
 	return c.update(cfg)
 }
 
+// Returns the endpoints accepted by Config.NodeFilter, or an error if it
+// rejects all of them.
+func (c *cluster) filterNodes(config []serviceEndpoint) ([]serviceEndpoint, error) {
+	if c.config.NodeFilter == nil || len(config) == 0 {
+		return config, nil
+	}
+	filtered := make([]serviceEndpoint, 0, len(config))
+	for _, ep := range config {
+		hp := ep.hostPort()
+		if c.config.NodeFilter(net.JoinHostPort(hp.host, strconv.Itoa(hp.port)), ep.availabilityZone) {
+			filtered = append(filtered, ep)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, awserr.New(request.InvalidParameterErrCode, fmt.Sprintf("NodeFilter rejected all %d nodes of the cluster", len(config)), nil)
+	}
+	return filtered, nil
+}
+
 func (c *cluster) update(config []serviceEndpoint) error {
 	newEndpoints := make(map[hostPort]struct{}, len(config))
 	for _, cfg := range config {
@@ -615,7 +1407,9 @@ func (c *cluster) update(config []serviceEndpoint) error {
 	}
 
 	newActive := make(map[hostPort]DaxAPI, len(config))
+	newZones := make(map[hostPort]string, len(config))
 	newRoutes := make([]DaxAPI, len(config))
+	newNodes := make(map[DaxAPI]*nodeState, len(config))
 
 	c.lock.RLock()
 	cls := c.closed
@@ -632,24 +1426,58 @@ func (c *cluster) update(config []serviceEndpoint) error {
 			toClose = append(toClose, cli)
 		}
 	}
+	var created []DaxAPI
 	for i, ep := range config {
 		cli, ok := oldActive[ep.hostPort()]
 		var err error
 		if !ok {
 			cli, err = c.newSingleClient(ep)
 			if err != nil {
+				for _, client := range created {
+					c.closeClient(client)
+				}
 				return nil
 			}
+			created = append(created, cli)
 		}
 		newActive[ep.hostPort()] = cli
+		newZones[ep.hostPort()] = ep.availabilityZone
 		newRoutes[i] = cli
 	}
 	c.lock.Lock()
+	if c.closed {
+		// closed concurrently; old clients are closed by Close
+		c.lock.Unlock()
+		for _, client := range created {
+			c.closeClient(client)
+		}
+		return nil
+	}
 	c.active = newActive
+	c.zones = newZones
 	c.routes = newRoutes
+	if c.config.KeyAffinityRouting {
+		c.ring = newHashRing(newActive)
+	}
+	for _, ep := range config {
+		cli := newActive[ep.hostPort()]
+		if s := c.states[cli]; s != nil {
+			s.set(ep)
+			newNodes[cli] = s
+		} else {
+			newNodes[cli] = newNodeState(ep)
+		}
+	}
+	c.states = newNodes
+	nodes := c.nodeInfosLocked()
+	c.topology.changed(nodes)
+	c.closers.Add(1)
 	c.lock.Unlock()
 
+	c.policy.NodesChanged(nodes)
+
 	go func() {
+		defer c.closers.Done()
 		for _, client := range toClose {
 			c.closeClient(client)
 		}
@@ -661,101 +1489,95 @@ func (c *cluster) hasChanged(cfg []serviceEndpoint) bool {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	for _, se := range cfg {
-		_, ok := c.active[se.hostPort()]
+		cli, ok := c.active[se.hostPort()]
 		if !ok {
 			return true
 		}
+		if s := c.states[cli]; s != nil && s.changed(se) {
+			return true
+		}
 	}
 	return len(cfg) != len(c.active)
 }
 
-func (c *cluster) pullEndpoints() ([]serviceEndpoint, error) {
-	var lastErr error // TODO chain errors?
-	for _, s := range c.seeds {
-		ips, err := net.LookupIP(s.host)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		if len(ips) > 1 {
-			// randomize multiple addresses; in-place fischer-yates shuffle.
-			for j := len(ips) - 1; j > 0; j-- {
-				k := rand.Intn(j + 1)
-				ips[k], ips[j] = ips[j], ips[k]
-			}
-		}
-
-		for _, ip := range ips {
-			endpoints, err := c.pullEndpointsFrom(ip, s.port)
-			if err != nil {
-				lastErr = err
-				continue
-			}
-			if c.config.logger != nil && c.config.logLevel.AtLeast(aws.LogDebug) {
-				c.config.logger.Log(fmt.Sprintf("DEBUG: Pulled endpoints from %s : %v", ip, endpoints))
-			}
-			if len(endpoints) > 0 {
-				return endpoints, nil
-			}
-		}
+func (c *cluster) closeClient(client DaxAPI) {
+	if d, ok := client.(io.Closer); ok {
+		d.Close()
 	}
-	return nil, lastErr
-}
-
-func (c *cluster) pullEndpointsFrom(ip net.IP, port int) ([]serviceEndpoint, error) {
-	client, err := c.clientBuilder.newClient(ip, port, c.config.connConfig, c.config.Region, c.config.Credentials, c.config.MaxPendingConnectionsPerHost, c.config.DialContext)
-	if err != nil {
-		return nil, err
+	if s, ok := client.(statsProvider); ok {
+		c.retired.add(s.Stats())
 	}
-	defer c.closeClient(client)
-	ctx, cfn := context.WithTimeout(aws.BackgroundContext(), 5*time.Second)
-	defer cfn()
-	return client.endpoints(RequestOptions{MaxRetries: 2, Context: ctx})
 }
 
-func (c *cluster) closeClient(client DaxAPI) {
-	if d, ok := client.(io.Closer); ok {
-		d.Close()
+// Returns the counters of all clients created by the cluster, including closed ones.
+func (c *cluster) stats() Stats {
+	s := c.retired.load()
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for _, client := range c.routes {
+		if p, ok := client.(statsProvider); ok {
+			s.add(p.Stats())
+		}
 	}
+	return s
 }
 
 func (c *cluster) newSingleClient(cfg serviceEndpoint) (DaxAPI, error) {
-	return c.clientBuilder.newClient(net.IP(cfg.address), cfg.port, c.config.connConfig, c.config.Region, c.config.Credentials, c.config.MaxPendingConnectionsPerHost, c.config.DialContext)
+	client, err := c.clientBuilder.newClient(cfg.hostname, net.IP(cfg.address), cfg.port, c.config.connConfig, c.config.Region, c.config.Credentials, c.config.MaxPendingConnectionsPerHost, c.config.DialContext)
+	if s, ok := client.(*SingleDaxClient); ok {
+		// a stale key schema is cached by the other nodes too
+		s.invalidateTable = c.invalidateTableCache
+	}
+	return client, err
 }
 
+// Builds the client of a node. The node is identified by ip and port; host is
+// its hostname, dialed instead of ip unless empty.
 type clientBuilder interface {
-	newClient(net.IP, int, connConfig, string, *credentials.Credentials, int, dialContext) (DaxAPI, error)
+	newClient(string, net.IP, int, connConfig, string, *credentials.Credentials, int, dialContext) (DaxAPI, error)
 }
 
 type singleClientBuilder struct{}
 
-func (*singleClientBuilder) newClient(ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxPendingConnects int, dialContextFn dialContext) (DaxAPI, error) {
-	endpoint := fmt.Sprintf("%s:%d", ip, port)
+// The client dials host, when given, so that the connection pool resolves it
+// through the host cache and tries all of its addresses, not only ip.
+func (*singleClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxPendingConnects int, dialContextFn dialContext) (DaxAPI, error) {
+	endpoint := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	if host != "" {
+		endpoint = net.JoinHostPort(host, strconv.Itoa(port))
+	}
 	return newSingleClientWithOptions(endpoint, connConfigData, region, credentials, maxPendingConnects, dialContextFn)
 }
 
 type taskExecutor struct {
 	tasks int32
 	close chan struct{}
+	wg    sync.WaitGroup
+	clock clock
 }
 
-func newExecutor() *taskExecutor {
+func newExecutor(clk clock) *taskExecutor {
 	return &taskExecutor{
 		close: make(chan struct{}),
+		clock: clockOrSystem(clk),
 	}
 }
 
+// Runs action every d until the executor is stopped. Like a ticker, runs
+// missed while action was running are skipped.
 func (e *taskExecutor) start(d time.Duration, action func() error) {
-	ticker := time.NewTicker(d)
+	timer := e.clock.NewTimer(d)
 	atomic.AddInt32(&e.tasks, 1)
+	e.wg.Add(1)
 	go func() {
+		defer e.wg.Done()
 		for {
 			select {
-			case <-ticker.C:
+			case <-timer.C():
+				timer = e.clock.NewTimer(d)
 				action() // TODO recover from panic()?
 			case <-e.close:
-				ticker.Stop()
+				timer.Stop()
 				atomic.AddInt32(&e.tasks, -1)
 				return
 			}
@@ -767,6 +1589,8 @@ func (e *taskExecutor) numTasks() int32 {
 	return atomic.LoadInt32(&e.tasks)
 }
 
+// Stops all tasks and waits for any running action to return.
 func (e *taskExecutor) stopAll() {
 	close(e.close)
+	e.wg.Wait()
 }
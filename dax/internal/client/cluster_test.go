@@ -16,16 +16,20 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"net"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -33,10 +37,12 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 )
 
-func testTaskExecutor(t *testing.T) { // disabled as test is time sensitive
-	executor := newExecutor()
+func TestTaskExecutor(t *testing.T) {
+	clock := newFakeClock()
+	executor := newExecutor(clock)
 
 	var cnt1, cnt2, cnt3 int32
 	executor.start(10*time.Millisecond, func() error {
@@ -51,33 +57,23 @@ func testTaskExecutor(t *testing.T) { // disabled as test is time sensitive
 		atomic.AddInt32(&cnt3, 1)
 		return nil
 	})
-	<-time.After(105 * time.Millisecond)
-	if c := atomic.LoadInt32(&cnt1); c != 10 {
-		t.Errorf("expected 10, got %d", c)
-	}
-	if c := atomic.LoadInt32(&cnt2); c != 5 {
-		t.Errorf("expected 10, got %d", c)
-	}
-	if c := atomic.LoadInt32(&cnt3); c != 2 {
-		t.Errorf("expected 10, got %d", c)
+	for i := 0; i < 10; i++ {
+		clock.waitForTimers(t, 3)
+		clock.Advance(10 * time.Millisecond)
 	}
-	if executor.numTasks() != 3 {
-		t.Errorf("expected 3, got %d", executor.numTasks())
+	clock.waitForTimers(t, 3)
+	counts := func(c1, c2, c3 int32) func() bool {
+		return func() bool {
+			return atomic.LoadInt32(&cnt1) == c1 && atomic.LoadInt32(&cnt2) == c2 && atomic.LoadInt32(&cnt3) == c3
+		}
 	}
+	require.Eventually(t, counts(10, 5, 2), time.Second, time.Millisecond)
+	require.Equal(t, int32(3), executor.numTasks())
+
 	executor.stopAll()
-	<-time.After(105 * time.Millisecond)
-	if c := atomic.LoadInt32(&cnt1); c != 10 {
-		t.Errorf("expected 10, got %d", c)
-	}
-	if c := atomic.LoadInt32(&cnt2); c != 5 {
-		t.Errorf("expected 10, got %d", c)
-	}
-	if c := atomic.LoadInt32(&cnt3); c != 2 {
-		t.Errorf("expected 10, got %d", c)
-	}
-	if executor.numTasks() != 0 {
-		t.Errorf("expected 0, got %d", executor.numTasks())
-	}
+	clock.Advance(100 * time.Millisecond)
+	require.True(t, counts(10, 5, 2)(), "tasks ran after being stopped")
+	require.Equal(t, int32(0), executor.numTasks())
 }
 
 func TestClusterDaxClient_retry(t *testing.T) {
@@ -175,6 +171,226 @@ func TestClusterDaxClient_retryReturnsLastError(t *testing.T) {
 	}
 }
 
+func TestClusterDaxClient_Nodes(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	require.Empty(t, cc.Nodes())
+	require.False(t, cc.Encrypted())
+
+	cluster.update([]serviceEndpoint{
+		{address: net.IPv4(127, 0, 0, 2).To4(), port: 8111},
+		{address: net.IPv4(127, 0, 0, 1).To4(), port: 8111},
+	})
+	require.Equal(t, []string{"127.0.0.1:8111", "127.0.0.2:8111"}, cc.Nodes())
+}
+
+func TestClusterDaxClient_retryNodeError(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{address: net.IPv4(127, 0, 0, 1).To4(), port: 8121, availabilityZone: "us-east-1a"}})
+	cfg := DefaultConfig()
+	cfg.DetailedErrors = true
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	server := newDaxRequestFailure([]int{4, 37, 38, 39, 47}, "", "internal error", "id", 500)
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}
+	for _, failure := range []error{dial, server, timeout} {
+		action := func(client DaxAPI, o RequestOptions) error {
+			return failure
+		}
+		err := cc.retry(OpGetItem, action, RequestOptions{MaxRetries: 1, RetryDelay: 1})
+		var nerr *NodeError
+		require.True(t, errors.As(err, &nerr), "expected a *NodeError in %v", err)
+		require.Equal(t, "127.0.0.1:8121", nerr.Addr)
+		require.Equal(t, "us-east-1a", nerr.AZ)
+		require.Contains(t, err.Error(), "node 127.0.0.1:8121 (az=us-east-1a)")
+	}
+
+	// the availability zone follows the topology refresh
+	cluster.update([]serviceEndpoint{{address: net.IPv4(127, 0, 0, 1).To4(), port: 8121, availabilityZone: "us-east-1b"}})
+	err := cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error { return dial }, RequestOptions{})
+	var nerr *NodeError
+	require.True(t, errors.As(err, &nerr), "expected a *NodeError in %v", err)
+	require.Equal(t, "us-east-1b", nerr.AZ)
+	aerr, ok := err.(awserr.Error)
+	require.True(t, ok)
+	require.Equal(t, ErrCodeUnknown, aerr.Code())
+
+	// errors raised by the client itself carry no node
+	for _, failure := range []error{
+		&ItemTooLargeError{Table: "t", Path: "Item", Size: 500000},
+		awserr.New(request.InvalidParameterErrCode, "invalid number", nil),
+	} {
+		action := func(client DaxAPI, o RequestOptions) error {
+			return failure
+		}
+		err := cc.retry(OpPutItem, action, RequestOptions{MaxRetries: 2})
+		require.False(t, errors.As(err, &nerr), "unexpected *NodeError in %v", err)
+		require.Equal(t, failure, err.(*RequestError).Err)
+	}
+
+	// without DetailedErrors, the node is told by the metadata of the request
+	cc.config.DetailedErrors = false
+	var md ResponseMetadata
+	err = cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error { return dial }, RequestOptions{Context: WithResponseMetadata(context.Background(), &md)})
+	require.False(t, errors.As(err, &nerr), "unexpected *NodeError in %v", err)
+	require.Equal(t, dial, err)
+	require.Equal(t, "127.0.0.1:8121", md.Node)
+	require.Equal(t, "us-east-1b", md.AZ)
+	cc.config.DetailedErrors = true
+
+	// as do failures to pick a node
+	cluster.update(nil)
+	err = cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error { return nil }, RequestOptions{})
+	require.Error(t, err)
+	require.False(t, errors.As(err, &nerr), "unexpected *NodeError in %v", err)
+}
+
+func TestClusterDaxClient_retryRequestError(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{address: net.IPv4(127, 0, 0, 1).To4(), port: 8121}})
+	cfg := DefaultConfig()
+	cfg.DetailedErrors = true
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}
+	action := func(client DaxAPI, o RequestOptions) error {
+		return timeout
+	}
+	err := cc.retry(OpGetItem, action, RequestOptions{MaxRetries: 2, RetryDelay: 1})
+	rerr, ok := err.(*RequestError)
+	require.True(t, ok, "expected a *RequestError, got %T", err)
+	require.Equal(t, OpGetItem, rerr.Op)
+	require.Equal(t, "127.0.0.1:8121", rerr.Node)
+	require.Equal(t, 3, rerr.Attempts)
+	require.True(t, rerr.Elapsed > 0)
+	for _, field := range []string{"GetItem failed", "node=127.0.0.1:8121", "attempts=3", "elapsed=", timeout.Error()} {
+		require.Contains(t, err.Error(), field)
+	}
+	var nerr net.Error
+	require.True(t, errors.As(err, &nerr), "expected a net.Error in %v", err)
+	require.True(t, nerr.Timeout())
+
+	// typed service errors are reached, and their code is kept
+	action = func(client DaxAPI, o RequestOptions) error {
+		return newDaxRequestFailure([]int{4, 37, 38, 39, 43}, "", "The conditional request failed", "id", 400)
+	}
+	err = cc.retry(OpPutItem, action, RequestOptions{MaxRetries: 2})
+	var cerr *dynamodb.ConditionalCheckFailedException
+	require.True(t, errors.As(err, &cerr), "expected a ConditionalCheckFailedException in %v", err)
+	aerr, ok := err.(awserr.RequestFailure)
+	require.True(t, ok)
+	require.Equal(t, dynamodb.ErrCodeConditionalCheckFailedException, aerr.Code())
+	require.Equal(t, 400, aerr.StatusCode())
+	require.Equal(t, "id", aerr.RequestID())
+	require.Equal(t, 1, err.(*RequestError).Attempts)
+
+	// without DetailedErrors, the typed service error is returned as is
+	cc.config.DetailedErrors = false
+	var md ResponseMetadata
+	err = cc.retry(OpPutItem, action, RequestOptions{MaxRetries: 2, Context: WithResponseMetadata(context.Background(), &md)})
+	_, ok = err.(*dynamodb.ConditionalCheckFailedException)
+	require.True(t, ok, "expected a *dynamodb.ConditionalCheckFailedException, got %T", err)
+	require.Equal(t, OpPutItem, md.Op)
+	require.Equal(t, "127.0.0.1:8121", md.Node)
+	require.Equal(t, 1, md.Attempts)
+	require.NotEmpty(t, md.CorrelationID)
+	require.Equal(t, "id", md.RequestID)
+
+	// no attempt is made by a closed client
+	cluster.Close()
+	err = cc.retry(OpGetItem, action, RequestOptions{})
+	require.Equal(t, ErrClientClosed, err)
+}
+
+func TestClusterDaxClient_retryWrapsContextError(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}
+	action := func(client DaxAPI, o RequestOptions) error {
+		return translateError(timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// the deadline expires waiting to retry
+	var md ResponseMetadata
+	err := cc.retry(OpGetItem, action, RequestOptions{Context: WithResponseMetadata(ctx, &md), MaxRetries: 2, RetryDelay: time.Hour})
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "expected context.DeadlineExceeded in %v", err)
+	require.Equal(t, 1, md.Attempts)
+
+	err = cc.retry(OpGetItem, action, RequestOptions{MaxRetries: 1})
+	var opErr *net.OpError
+	require.True(t, errors.As(err, &opErr), "expected a *net.OpError in %v", err)
+	require.True(t, opErr.Timeout())
+	require.Equal(t, request.ErrCodeResponseTimeout, err.(awserr.Error).Code())
+}
+
+func TestClusterDaxClient_retryItemTooLarge(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+
+	tooLarge := &ItemTooLargeError{Table: "table", Path: "Item", Size: maxItemSize + 1, Limit: maxItemSize}
+	calls := 0
+	action := func(client DaxAPI, o RequestOptions) error {
+		calls++
+		return tooLarge
+	}
+
+	err := cc.retry("op", action, RequestOptions{MaxRetries: 2})
+	if err != tooLarge {
+		t.Fatalf("Wrong error. Expected %v, but got %v", tooLarge, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call, but made %d", calls)
+	}
+}
+
+func TestClusterDaxClient_retryNumberError(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+
+	invalid := &NumberError{Path: "a", Value: "NaN", Reason: "NaN and Infinity are not supported"}
+	calls := 0
+	action := func(client DaxAPI, o RequestOptions) error {
+		calls++
+		return invalid
+	}
+
+	err := cc.retry("op", action, RequestOptions{MaxRetries: 2})
+	if err != invalid {
+		t.Fatalf("Wrong error. Expected %v, but got %v", invalid, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call, but made %d", calls)
+	}
+}
+
+func TestClusterDaxClient_retryInvalidParameter(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+
+	invalid := awserr.New(request.InvalidParameterErrCode, "One or more parameter values were invalid: An string set  may not be empty", nil)
+	calls := 0
+	action := func(client DaxAPI, o RequestOptions) error {
+		calls++
+		return invalid
+	}
+
+	err := cc.retry("op", action, RequestOptions{MaxRetries: 2})
+	if err != invalid {
+		t.Fatalf("Wrong error. Expected %v, but got %v", invalid, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call, but made %d", calls)
+	}
+}
+
 func TestClusterDaxClient_retryReturnsCorrectErrorType(t *testing.T) {
 	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
 	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
@@ -385,6 +601,190 @@ func TestCluster_refreshThreshold(t *testing.T) {
 	assertDiscoveryClient(clientBuilder.clients[1], t)
 }
 
+func TestClusterDaxClient_RefreshEndpoints(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	b := &discoveryClientBuilder{}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	defer cluster.Close()
+
+	b.setPull(func() ([]serviceEndpoint, error) {
+		return []serviceEndpoint{{address: net.IPv4(127, 0, 0, 2).To4(), port: 8111}}, nil
+	})
+	require.NoError(t, cc.RefreshEndpoints(context.Background()))
+	require.Equal(t, []string{"127.0.0.2:8111"}, cc.Nodes())
+
+	// nodes replaced
+	b.setPull(func() ([]serviceEndpoint, error) {
+		return []serviceEndpoint{
+			{address: net.IPv4(127, 0, 0, 3).To4(), port: 8111},
+			{address: net.IPv4(127, 0, 0, 4).To4(), port: 8111},
+		}, nil
+	})
+	require.NoError(t, cc.RefreshEndpoints(context.Background()))
+	require.Equal(t, []string{"127.0.0.3:8111", "127.0.0.4:8111"}, cc.Nodes())
+
+	// a failed discovery keeps the nodes
+	failure := errors.New("discovery failed")
+	b.setPull(func() ([]serviceEndpoint, error) { return nil, failure })
+	require.Equal(t, failure, cc.RefreshEndpoints(context.Background()))
+	require.Equal(t, []string{"127.0.0.3:8111", "127.0.0.4:8111"}, cc.Nodes())
+	require.Equal(t, failure, cluster.lastRefreshError())
+	require.Equal(t, 3, b.numPulls())
+}
+
+func TestClusterDaxClient_RefreshEndpointsCoalesced(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	b := &discoveryClientBuilder{}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	defer cluster.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	b.setPull(func() ([]serviceEndpoint, error) {
+		close(started)
+		<-release
+		return []serviceEndpoint{{address: net.IPv4(127, 0, 0, 2).To4(), port: 8111}}, nil
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- cc.RefreshEndpoints(context.Background()) }()
+	<-started
+
+	// callers whose context is done join the refresh in flight, rather than
+	// start another pull, and stop waiting for it
+	const n = 4
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		canceled := make(chan error, 1)
+		go func() { canceled <- cc.RefreshEndpoints(ctx) }()
+		cancel()
+		err := <-canceled
+		require.Error(t, err)
+		require.Equal(t, request.CanceledErrorCode, err.(awserr.Error).Code())
+	}
+
+	close(release)
+	require.NoError(t, <-errs)
+	require.Equal(t, 1, b.numPulls())
+	require.Equal(t, []string{"127.0.0.2:8111"}, cc.Nodes())
+}
+
+func TestClusterDaxClient_RefreshEndpointsAfterPeriodicRefresh(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	b := &discoveryClientBuilder{}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	defer cluster.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var pulls int32
+	b.setPull(func() ([]serviceEndpoint, error) {
+		if atomic.AddInt32(&pulls, 1) == 1 {
+			// the periodic pull, stale once the forced one is requested
+			close(started)
+			<-release
+			return []serviceEndpoint{{address: net.IPv4(127, 0, 0, 2).To4(), port: 8111}}, nil
+		}
+		return []serviceEndpoint{{address: net.IPv4(127, 0, 0, 3).To4(), port: 8111}}, nil
+	})
+
+	periodic := make(chan struct{})
+	go func() {
+		defer close(periodic)
+		cluster.safeRefresh(true)
+	}()
+	<-started
+	forced := make(chan error, 1)
+	go func() { forced <- cc.RefreshEndpoints(context.Background()) }()
+	require.Never(t, func() bool { return len(forced) > 0 }, 50*time.Millisecond, time.Millisecond, "expect the forced refresh to wait for the periodic one")
+
+	close(release)
+	<-periodic
+	require.NoError(t, <-forced)
+	require.Equal(t, int32(2), atomic.LoadInt32(&pulls))
+	require.Equal(t, []string{"127.0.0.3:8111"}, cc.Nodes())
+}
+
+func TestClusterDaxClient_RefreshEndpointsClosed(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	cluster.Close()
+	require.Equal(t, ErrClientClosed, cc.RefreshEndpoints(context.Background()))
+}
+
+func TestClusterDaxClient_NodeFilter(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.SetLogger(aws.LoggerFunc(func(...interface{}) {}), aws.LogOff)
+	pinned := "10.0.0.2:8111"
+	cfg.NodeFilter = func(addr, az string) bool { return addr == pinned }
+	cluster, _ := newTestClusterWithConfig(cfg)
+	b := &discoveryClientBuilder{}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+	defer cluster.Close()
+
+	discover := func(last byte, azs ...string) func() ([]serviceEndpoint, error) {
+		return func() ([]serviceEndpoint, error) {
+			var eps []serviceEndpoint
+			for i, az := range azs {
+				eps = append(eps, serviceEndpoint{address: net.IPv4(10, 0, 0, last+byte(i)).To4(), port: 8111, availabilityZone: az})
+			}
+			return eps, nil
+		}
+	}
+	sent := map[string]int{}
+	send := func() error {
+		return cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error {
+			addr, _ := cluster.nodeInfo(client)
+			sent[addr]++
+			return nil
+		}, RequestOptions{})
+	}
+
+	b.setPull(discover(1, "us-west-2a", "us-west-2b", "us-west-2c"))
+	require.NoError(t, cc.RefreshEndpoints(context.Background()))
+	require.Equal(t, []string{pinned}, cc.Nodes())
+	for i := 0; i < 100; i++ {
+		require.NoError(t, send())
+	}
+	require.Equal(t, map[string]int{pinned: 100}, sent)
+	require.Equal(t, []string{"127.0.0.1:8111", pinned}, b.builtClients(), "filtered out nodes must not be connected to")
+
+	// the filter applies to the nodes of every discovery
+	b.setPull(discover(2, "us-west-2a", "us-west-2b", "us-west-2c"))
+	require.NoError(t, cc.RefreshEndpoints(context.Background()))
+	require.Equal(t, []string{pinned}, cc.Nodes())
+
+	// a filter rejecting every node fails the discovery and keeps the nodes
+	b.setPull(discover(3, "us-west-2a", "us-west-2b"))
+	err := cc.RefreshEndpoints(context.Background())
+	require.Error(t, err)
+	require.Equal(t, request.InvalidParameterErrCode, err.(awserr.Error).Code())
+	require.Contains(t, err.Error(), "NodeFilter rejected all 2 nodes")
+	require.Equal(t, []string{pinned}, cc.Nodes())
+	require.NoError(t, send())
+	require.Equal(t, map[string]int{pinned: 101}, sent)
+}
+
+func TestCluster_NodeFilterRejectsAll(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.SetLogger(aws.LoggerFunc(func(...interface{}) {}), aws.LogOff)
+	cfg.NodeFilter = func(addr, az string) bool { return az == "us-west-2c" }
+	cluster, _ := newTestClusterWithConfig(cfg)
+	setExpectation(cluster, []serviceEndpoint{{address: net.IPv4(10, 0, 0, 1).To4(), port: 8111, availabilityZone: "us-west-2a"}})
+	cluster.safeRefresh(false)
+
+	_, err := cluster.client(nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "No routes found")
+	require.Contains(t, err.Error(), "NodeFilter rejected all 1 nodes of the cluster")
+}
+
 func TestCluster_refreshDup(t *testing.T) {
 	cluster, clientBuilder := newTestCluster([]string{"127.0.0.1:8111"})
 	setExpectation(cluster, []serviceEndpoint{{hostname: "localhost", port: 8121}})
@@ -558,6 +958,132 @@ func TestCluster_Close(t *testing.T) {
 	}
 }
 
+func newHealthTestCluster(t *testing.T, onChange func(bool)) (*cluster, *testClientBuilder) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.HealthCheckInterval = time.Second
+	cfg.UnreachableThreshold = 3
+	cfg.ReachableThreshold = 2
+	cfg.OnReachabilityChange = onChange
+	cluster, clientBuilder := newTestClusterWithConfig(cfg)
+	setExpectation(cluster, []serviceEndpoint{{hostname: "localhost", port: 8121}, {hostname: "localhost", port: 8122}})
+	if err := cluster.refreshNow(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	assertNumRoutes(cluster, 2, t)
+	return cluster, clientBuilder
+}
+
+// Sets the error of the health checks of the nodes of the cluster.
+func setNodeErrors(cluster *cluster, errs ...error) {
+	for i, client := range cluster.routes {
+		client.(*testClient).endpointsErr = errs[i]
+	}
+}
+
+func TestCluster_checkHealth(t *testing.T) {
+	var changes []bool
+	cluster, _ := newHealthTestCluster(t, func(reachable bool) { changes = append(changes, reachable) })
+	down := awserr.New(request.ErrCodeRequestError, "connection refused", nil)
+	failing := newDaxRequestFailure([]int{4, 37, 38, 39, 43}, "ThrottlingException", "throttled", "", 400)
+
+	// a node answering, even with an error, keeps the cluster reachable
+	for i := 0; i < 5; i++ {
+		setNodeErrors(cluster, down, failing)
+		cluster.checkHealth()
+	}
+	if !cluster.health.reachable() || len(changes) != 0 {
+		t.Fatalf("expect the cluster to stay reachable, got changes %v", changes)
+	}
+
+	// full outage
+	setNodeErrors(cluster, down, down)
+	for i := 0; i < 2; i++ {
+		cluster.checkHealth()
+	}
+	if !cluster.health.reachable() {
+		t.Fatalf("expect the cluster reachable before UnreachableThreshold checks")
+	}
+	cluster.checkHealth()
+	if cluster.health.reachable() {
+		t.Fatalf("expect the cluster unreachable after UnreachableThreshold checks")
+	}
+	if !reflect.DeepEqual([]bool{false}, changes) {
+		t.Errorf("expect [false], got %v", changes)
+	}
+
+	// recovery
+	setNodeErrors(cluster, nil, down)
+	cluster.checkHealth()
+	if cluster.health.reachable() {
+		t.Fatalf("expect the cluster unreachable before ReachableThreshold checks")
+	}
+	cluster.checkHealth()
+	if !cluster.health.reachable() {
+		t.Fatalf("expect the cluster reachable after ReachableThreshold checks")
+	}
+	if !reflect.DeepEqual([]bool{false, true}, changes) {
+		t.Errorf("expect [false true], got %v", changes)
+	}
+	for _, client := range cluster.routes {
+		if e, a := 10, client.(*testClient).endpointsCalls; e != a {
+			t.Errorf("expect %d health checks, got %d", e, a)
+		}
+	}
+
+	s := Stats{}
+	cluster.health.stats(&s)
+	if s.ClusterUnreachable != 0 || s.ReachabilityChanges != 2 {
+		t.Errorf("expect reachable after 2 changes, got %+v", s)
+	}
+}
+
+func TestCluster_checkHealthFlapping(t *testing.T) {
+	var changes []bool
+	cluster, _ := newHealthTestCluster(t, func(reachable bool) { changes = append(changes, reachable) })
+	down := awserr.New(request.ErrCodeRequestError, "connection refused", nil)
+
+	// intermittent failures shorter than UnreachableThreshold
+	for i := 0; i < 10; i++ {
+		setNodeErrors(cluster, down, down)
+		cluster.checkHealth()
+		cluster.checkHealth()
+		setNodeErrors(cluster, nil, down)
+		cluster.checkHealth()
+	}
+	if !cluster.health.reachable() || len(changes) != 0 {
+		t.Fatalf("expect the cluster to stay reachable, got changes %v", changes)
+	}
+
+	// intermittent successes shorter than ReachableThreshold
+	setNodeErrors(cluster, down, down)
+	for i := 0; i < 3; i++ {
+		cluster.checkHealth()
+	}
+	for i := 0; i < 10; i++ {
+		setNodeErrors(cluster, down, nil)
+		cluster.checkHealth()
+		setNodeErrors(cluster, down, down)
+		cluster.checkHealth()
+	}
+	if cluster.health.reachable() {
+		t.Errorf("expect the cluster to stay unreachable")
+	}
+	if !reflect.DeepEqual([]bool{false}, changes) {
+		t.Errorf("expect [false], got %v", changes)
+	}
+}
+
+func TestCluster_checkHealthNoRoutes(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.health = newHealthMonitor(Config{UnreachableThreshold: 1})
+	cluster.checkHealth()
+	if cluster.health.reachable() {
+		t.Errorf("expect a cluster without routes to be unreachable")
+	}
+}
+
 func Test_CorrectHostPortUrlFormat(t *testing.T) {
 	hostPort := "dax://test.nds.clustercfg.dax.usw2integ.cache.amazonaws.com:1234"
 	host, port, scheme, _ := parseHostPort(hostPort)
@@ -739,25 +1265,85 @@ func TestCluster_customDialer(t *testing.T) {
 }
 
 type testClientBuilder struct {
-	ep      []serviceEndpoint
-	clients []*testClient
+	ep             []serviceEndpoint
+	clients        []*testClient
+	getItem        func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	batchGetItem   func(hostPort, *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
+	batchWriteItem func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	validateBatch  func(*dynamodb.BatchWriteItemInput) error
 }
 
-func (b *testClientBuilder) newClient(ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
-	t := &testClient{ep: b.ep, hp: hostPort{ip.String(), port}}
+func (b *testClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
+	t := &testClient{ep: b.ep, hp: hostPort{ip.String(), port}, getItem: b.getItem, batchGetItem: b.batchGetItem, batchWriteItem: b.batchWriteItem, validateBatch: b.validateBatch}
 	b.clients = append(b.clients, []*testClient{t}...)
 	return t, nil
 }
 
+// Builds clients whose endpoints calls are answered by pull, safe for
+// concurrent refreshes.
+type discoveryClientBuilder struct {
+	mu    sync.Mutex
+	pull  func() ([]serviceEndpoint, error)
+	pulls int
+	built []string // addresses of the clients built
+}
+
+func (b *discoveryClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.built = append(b.built, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	return &discoveryClient{testClient: &testClient{hp: hostPort{ip.String(), port}}, b: b}, nil
+}
+
+func (b *discoveryClientBuilder) builtClients() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.built...)
+}
+
+func (b *discoveryClientBuilder) setPull(pull func() ([]serviceEndpoint, error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pull = pull
+}
+
+func (b *discoveryClientBuilder) numPulls() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pulls
+}
+
+type discoveryClient struct {
+	*testClient
+	b *discoveryClientBuilder
+}
+
+func (c *discoveryClient) endpoints(opt RequestOptions) ([]serviceEndpoint, error) {
+	c.b.mu.Lock()
+	c.b.pulls++
+	pull := c.b.pull
+	c.b.mu.Unlock()
+	return pull()
+}
+
+func (c *discoveryClient) Close() error {
+	return nil
+}
+
 type testClient struct {
 	hp                         hostPort
 	ep                         []serviceEndpoint
 	endpointsCalls, closeCalls int
+	endpointsErr               error
+	getItem                    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	batchGetItem               func(hostPort, *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error)
+	batchWriteItem             func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	validateBatch              func(*dynamodb.BatchWriteItemInput) error
 }
 
 func (c *testClient) endpoints(opt RequestOptions) ([]serviceEndpoint, error) {
 	c.endpointsCalls++
-	return c.ep, nil
+	return c.ep, c.endpointsErr
 }
 
 func (c *testClient) Close() error {
@@ -776,6 +1362,9 @@ func (c *testClient) UpdateItemWithOptions(input *dynamodb.UpdateItemInput, outp
 }
 
 func (c *testClient) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
+	if c.getItem != nil {
+		return c.getItem(input)
+	}
 	panic("unimpl")
 }
 func (c *testClient) ScanWithOptions(input *dynamodb.ScanInput, output *dynamodb.ScanOutput, opt RequestOptions) (*dynamodb.ScanOutput, error) {
@@ -786,9 +1375,21 @@ func (c *testClient) QueryWithOptions(input *dynamodb.QueryInput, output *dynamo
 }
 
 func (c *testClient) BatchWriteItemWithOptions(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	if c.batchWriteItem != nil {
+		return c.batchWriteItem(input)
+	}
 	panic("unimpl")
 }
+func (c *testClient) validateBatchWriteItem(ctx aws.Context, input *dynamodb.BatchWriteItemInput) error {
+	if c.validateBatch != nil {
+		return c.validateBatch(input)
+	}
+	return nil
+}
 func (c *testClient) BatchGetItemWithOptions(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
+	if c.batchGetItem != nil {
+		return c.batchGetItem(c.hp, input)
+	}
 	panic("unimpl")
 }
 func (c *testClient) NewDaxRequest(op *request.Operation, input, output interface{}, opt RequestOptions) *request.Request {
@@ -804,3 +1405,692 @@ func (c *testClient) TransactGetItemsWithOptions(input *dynamodb.TransactGetItem
 
 func (c *testClient) build(req *request.Request) { panic("unimpl") }
 func (c *testClient) send(req *request.Request)  { panic("unimpl") }
+
+func TestClusterDaxClient_CloseLeavesNoGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start server: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// every chunk read is answered with an endpoints response pointing back to this server
+	var resp bytes.Buffer
+	w := cbor.NewWriter(&resp)
+	w.WriteArrayHeader(0)
+	w.WriteArrayHeader(1)
+	w.WriteMapHeader(2)
+	w.WriteInt(keyAddress)
+	w.WriteBytes(net.IPv4(127, 0, 0, 1).To4())
+	w.WriteInt(keyPort)
+	w.WriteInt(port)
+	w.Flush()
+
+	var conns sync.WaitGroup
+	accepted := make(chan struct{})
+	answered := make(chan struct{}, 16)
+	go func() {
+		defer close(accepted)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				defer conn.Close()
+				b := make([]byte, 4096)
+				for {
+					if _, err := conn.Read(b); err != nil {
+						return
+					}
+					if _, err := conn.Write(resp.Bytes()); err != nil {
+						return
+					}
+					select {
+					case answered <- struct{}{}:
+					default:
+					}
+				}
+			}()
+		}
+	}()
+
+	clock := newFakeClock()
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{listener.Addr().String()}
+	cfg.Region = "us-west-2"
+	cfg.Credentials = credentials.NewStaticCredentials("id", "secret", "tok")
+	cfg.ClusterUpdateInterval = 10 * time.Millisecond
+	cfg.clock = clock
+	cc, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+		if _, err := cc.endpoints(RequestOptions{Context: ctx}); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		cfn()
+	}
+	// let a few refreshes run, the last one may still be running on close
+	for len(answered) > 0 {
+		<-answered
+	}
+	for i := 0; i < 3; i++ {
+		// refreshes are skipped within ClusterUpdateThreshold of the previous one
+		clock.Advance(cfg.ClusterUpdateThreshold + cfg.ClusterUpdateInterval)
+		<-answered
+	}
+	if err := cc.Close(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	listener.Close()
+	<-accepted
+	conns.Wait()
+}
+
+func TestClusterDaxClient_MaxConcurrentRequests(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster, limiter: newRequestLimiter(3, time.Second, nil)}
+
+	var current, max int32
+	action := func(client DaxAPI, o RequestOptions) error {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cc.retry("op", action, RequestOptions{}); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.True(t, atomic.LoadInt32(&max) <= 3, "expected at most 3 concurrent requests, got %d", max)
+	s := cc.Stats()
+	require.Equal(t, int64(0), s.InFlightRequests)
+	require.Equal(t, int64(0), s.RejectedRequests)
+}
+
+func TestClusterDaxClient_AcquireTimeout(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	clock := newFakeClock()
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster, limiter: newRequestLimiter(1, 20*time.Millisecond, clock)}
+
+	started, unblock := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- cc.retry("op", func(client DaxAPI, o RequestOptions) error {
+			close(started)
+			<-unblock
+			return nil
+		}, RequestOptions{})
+	}()
+	<-started
+	require.Equal(t, int64(1), cc.Stats().InFlightRequests)
+
+	noop := func(client DaxAPI, o RequestOptions) error { return nil }
+	rejected := make(chan error)
+	go func() { rejected <- cc.retry("op", noop, RequestOptions{}) }()
+	require.Equal(t, 20*time.Millisecond, clock.waitForTimers(t, 1))
+	clock.Advance(20*time.Millisecond - 1)
+	select {
+	case err := <-rejected:
+		t.Fatalf("acquire gave up early with %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(1)
+	require.Equal(t, ErrOverloaded, <-rejected)
+	require.Equal(t, int64(1), cc.Stats().RejectedRequests)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(5*time.Millisecond, cancel)
+	cc.limiter.timeout = time.Minute
+	err := cc.retry("op", noop, RequestOptions{Context: ctx})
+	require.Error(t, err)
+	require.Equal(t, request.CanceledErrorCode, err.(awserr.Error).Code())
+
+	close(unblock)
+	require.NoError(t, <-done)
+
+	func() {
+		defer func() { recover() }()
+		cc.retry("op", func(client DaxAPI, o RequestOptions) error { panic("boom") }, RequestOptions{})
+	}()
+	require.NoError(t, cc.retry("op", noop, RequestOptions{}), "permit must be released after a panic")
+	require.Equal(t, int64(0), cc.Stats().InFlightRequests)
+}
+
+func newCoalescingTestClient(t *testing.T, getItem func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)) *ClusterDaxClient {
+	cluster, b := newTestCluster([]string{"127.0.0.1:8111"})
+	b.getItem = getItem
+	if err := cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return &ClusterDaxClient{config: DefaultConfig(), cluster: cluster, coalescer: newGetItemCoalescer(true)}
+}
+
+func TestClusterDaxClient_CoalesceGetItems(t *testing.T) {
+	const n = 20
+	var calls int32
+	release := make(chan struct{})
+	cc := newCoalescingTestClient(t, func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+			"pk":    input.Key["pk"],
+			"value": {L: []*dynamodb.AttributeValue{{S: aws.String("v")}}},
+		}}, nil
+	})
+
+	outputs := make([]*dynamodb.GetItemOutput, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			input := &dynamodb.GetItemInput{
+				TableName: aws.String("table"),
+				Key:       map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("key")}},
+			}
+			out, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			outputs[i] = out
+		}(i)
+	}
+	for cc.Stats().CoalescedGetItems < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	expected := map[string]*dynamodb.AttributeValue{
+		"pk":    {S: aws.String("key")},
+		"value": {L: []*dynamodb.AttributeValue{{S: aws.String("v")}}},
+	}
+	for _, out := range outputs {
+		require.Equal(t, expected, out.Item)
+	}
+
+	// every caller owns its output
+	outputs[0].Item["value"].L[0].S = aws.String("changed")
+	outputs[1].Item["pk"] = nil
+	for _, out := range outputs[2:] {
+		require.Equal(t, expected, out.Item)
+	}
+	require.Equal(t, int64(n-1), cc.Stats().CoalescedGetItems)
+}
+
+func TestClusterDaxClient_CoalesceGetItemsNotShared(t *testing.T) {
+	var calls int32
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	cc := newCoalescingTestClient(t, func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+		return &dynamodb.GetItemOutput{}, nil
+	})
+
+	key := func(v string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(v)}}
+	}
+	inputs := []*dynamodb.GetItemInput{
+		{TableName: aws.String("table"), Key: key("a")},
+		{TableName: aws.String("table"), Key: key("a"), ConsistentRead: aws.Bool(true)},
+		{TableName: aws.String("table"), Key: key("a"), ConsistentRead: aws.Bool(true)},
+		{TableName: aws.String("table"), Key: key("b")},
+		{TableName: aws.String("other"), Key: key("a")},
+		{TableName: aws.String("table"), Key: key("a"), ProjectionExpression: aws.String("pk")},
+		{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {N: aws.String("1")}}},
+		{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("1")}}},
+	}
+	var wg sync.WaitGroup
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input *dynamodb.GetItemInput) {
+			defer wg.Done()
+			if _, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{}); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}(input)
+	}
+	for range inputs {
+		<-started
+	}
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(len(inputs)), atomic.LoadInt32(&calls))
+	require.Equal(t, int64(0), cc.Stats().CoalescedGetItems)
+}
+
+func TestClusterDaxClient_CoalesceGetItemsErrors(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	failure := awserr.New(dynamodb.ErrCodeResourceNotFoundException, "not found", nil)
+	cc := newCoalescingTestClient(t, func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil, failure
+	})
+
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+			errs <- err
+		}()
+	}
+	for cc.Stats().CoalescedGetItems < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a waiter whose context is done stops waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{Context: ctx})
+	require.Error(t, err)
+	require.Equal(t, request.CanceledErrorCode, err.(awserr.Error).Code())
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, failure, <-errs)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestClusterDaxClient_CoalesceGetItemsPanic(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	cc := newCoalescingTestClient(t, func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			panic("decoder failure")
+		}
+		return &dynamodb.GetItemOutput{}, nil
+	})
+
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+		waiter <- err
+	}()
+	for cc.Stats().CoalescedGetItems < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the waiter executes the call on its own, and later calls are not left waiting
+	close(release)
+	require.Equal(t, "decoder failure", <-panicked)
+	require.NoError(t, <-waiter)
+	_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestClusterDaxClient_CoalesceGetItemsDisabled(t *testing.T) {
+	require.False(t, DefaultConfig().CoalesceGetItems)
+	require.Nil(t, newGetItemCoalescer(false))
+
+	var calls int32
+	cc := newCoalescingTestClient(t, func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		atomic.AddInt32(&calls, 1)
+		return &dynamodb.GetItemOutput{}, nil
+	})
+	cc.coalescer = nil
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}
+	for i := 0; i < 3; i++ {
+		_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+type batchingTestStub struct {
+	lock     sync.Mutex
+	items    map[string]map[string]*dynamodb.AttributeValue
+	skip     map[string]bool // keys left unprocessed by BatchGetItem
+	batchErr error
+	batches  [][]map[string]*dynamodb.AttributeValue
+	gets     []string
+}
+
+func (s *batchingTestStub) getItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pk := aws.StringValue(input.Key["pk"].S)
+	s.gets = append(s.gets, pk)
+	if pk == "invalid" {
+		return nil, awserr.New(ErrCodeValidationException, "invalid key", nil)
+	}
+	return &dynamodb.GetItemOutput{Item: s.items[pk]}, nil
+}
+
+func (s *batchingTestStub) batchGetItem(_ hostPort, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := input.RequestItems["table"].Keys
+	s.batches = append(s.batches, keys)
+	if s.batchErr != nil {
+		return nil, s.batchErr
+	}
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	// responses are not in the order of the keys
+	for i := len(keys) - 1; i >= 0; i-- {
+		pk := aws.StringValue(keys[i]["pk"].S)
+		if s.skip[pk] {
+			if output.UnprocessedKeys["table"] == nil {
+				output.UnprocessedKeys["table"] = &dynamodb.KeysAndAttributes{}
+			}
+			output.UnprocessedKeys["table"].Keys = append(output.UnprocessedKeys["table"].Keys, keys[i])
+		} else if item, ok := s.items[pk]; ok {
+			output.Responses["table"] = append(output.Responses["table"], item)
+		}
+	}
+	return output, nil
+}
+
+func newBatchingTestClient(t *testing.T, window time.Duration, size int, stub *batchingTestStub) *ClusterDaxClient {
+	cluster, b := newTestCluster([]string{"127.0.0.1:8111"})
+	b.getItem = stub.getItem
+	b.batchGetItem = stub.batchGetItem
+	if err := cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cc := &ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	cc.batcher = newGetItemBatcher(window, size, nil, cc.getItem, cc.BatchGetItemWithOptions)
+	return cc
+}
+
+func testItem(pk string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(pk)}, "value": {S: aws.String("value of " + pk)}}
+}
+
+// Gets the keys concurrently, returning the outputs and errors in the order of the keys.
+func getItemsConcurrently(cc *ClusterDaxClient, pks ...string) ([]*dynamodb.GetItemOutput, []error) {
+	outputs, errs := make([]*dynamodb.GetItemOutput, len(pks)), make([]error, len(pks))
+	var wg sync.WaitGroup
+	for i, pk := range pks {
+		wg.Add(1)
+		go func(i int, pk string) {
+			defer wg.Done()
+			input := &dynamodb.GetItemInput{
+				TableName: aws.String("table"),
+				Key:       map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(pk)}},
+			}
+			outputs[i], errs[i] = cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+		}(i, pk)
+	}
+	wg.Wait()
+	return outputs, errs
+}
+
+func TestClusterDaxClient_BatchGetItems(t *testing.T) {
+	stub := &batchingTestStub{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	for _, pk := range []string{"a", "b", "c", "d"} {
+		stub.items[pk] = testItem(pk)
+	}
+	cc := newBatchingTestClient(t, 50*time.Millisecond, 100, stub)
+
+	pks := []string{"a", "b", "c", "d", "missing", "a"}
+	outputs, errs := getItemsConcurrently(cc, pks...)
+	for i, pk := range pks {
+		require.NoError(t, errs[i])
+		if pk == "missing" {
+			require.Nil(t, outputs[i].Item)
+		} else {
+			require.Equal(t, testItem(pk), outputs[i].Item)
+		}
+	}
+	require.Len(t, stub.batches, 1)
+	require.Len(t, stub.batches[0], 5, "duplicate keys must be requested once")
+	require.Empty(t, stub.gets)
+	require.Equal(t, int64(len(pks)), cc.Stats().BatchedGetItems)
+
+	// calls for the same key own their item
+	outputs[0].Item["value"].S = aws.String("changed")
+	require.Equal(t, testItem("a"), outputs[5].Item)
+}
+
+func TestClusterDaxClient_BatchGetItemsNumberKeys(t *testing.T) {
+	cluster, b := newTestCluster([]string{"127.0.0.1:8111"})
+	var batches int32
+	b.batchGetItem = func(_ hostPort, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+		atomic.AddInt32(&batches, 1)
+		// the server returns the keys normalized
+		var items []map[string]*dynamodb.AttributeValue
+		for _, key := range input.RequestItems["table"].Keys {
+			n := strings.TrimSuffix(strings.TrimLeft(aws.StringValue(key["pk"].N), "0"), ".0")
+			items = append(items, map[string]*dynamodb.AttributeValue{"pk": {N: aws.String(n)}, "value": {S: aws.String("v" + n)}})
+		}
+		return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{"table": items}}, nil
+	}
+	require.NoError(t, cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}}))
+	cc := &ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	cc.batcher = newGetItemBatcher(50*time.Millisecond, 100, nil, cc.getItem, cc.BatchGetItemWithOptions)
+
+	pks := []string{"1.0", "01", "1", "2.0"}
+	outputs := make([]*dynamodb.GetItemOutput, len(pks))
+	var wg sync.WaitGroup
+	for i, pk := range pks {
+		wg.Add(1)
+		go func(i int, pk string) {
+			defer wg.Done()
+			input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {N: aws.String(pk)}}}
+			out, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+			if err != nil {
+				t.Errorf("unexpected error %v", err)
+				return
+			}
+			outputs[i] = out
+		}(i, pk)
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&batches))
+	for i, value := range []string{"v1", "v1", "v1", "v2"} {
+		require.NotNil(t, outputs[i].Item, "no item for %s", pks[i])
+		require.Equal(t, value, aws.StringValue(outputs[i].Item["value"].S))
+	}
+}
+
+func TestClusterDaxClient_BatchGetItemsUnprocessedKeys(t *testing.T) {
+	stub := &batchingTestStub{items: map[string]map[string]*dynamodb.AttributeValue{}, skip: map[string]bool{"b": true, "d": true}}
+	for _, pk := range []string{"a", "b", "c", "d"} {
+		stub.items[pk] = testItem(pk)
+	}
+	cc := newBatchingTestClient(t, 20*time.Millisecond, 100, stub)
+
+	pks := []string{"a", "b", "c", "d"}
+	outputs, errs := getItemsConcurrently(cc, pks...)
+	for i, pk := range pks {
+		require.NoError(t, errs[i])
+		require.Equal(t, testItem(pk), outputs[i].Item)
+	}
+	require.Len(t, stub.batches, 1)
+	require.ElementsMatch(t, []string{"b", "d"}, stub.gets, "unprocessed keys must be fetched on their own")
+	require.Equal(t, int64(2), cc.Stats().BatchedGetItems)
+}
+
+func TestClusterDaxClient_BatchGetItemsErrors(t *testing.T) {
+	// a batch rejected as invalid is retried key by key so that only the invalid key fails
+	stub := &batchingTestStub{
+		items:    map[string]map[string]*dynamodb.AttributeValue{"a": testItem("a")},
+		batchErr: awserr.New(ErrCodeValidationException, "invalid key", nil),
+	}
+	cc := newBatchingTestClient(t, 20*time.Millisecond, 100, stub)
+	outputs, errs := getItemsConcurrently(cc, "a", "invalid")
+	require.NoError(t, errs[0])
+	require.Equal(t, testItem("a"), outputs[0].Item)
+	require.Error(t, errs[1])
+	require.Equal(t, ErrCodeValidationException, errs[1].(awserr.Error).Code())
+	require.ElementsMatch(t, []string{"a", "invalid"}, stub.gets)
+
+	// other errors apply to every call
+	failure := awserr.New(dynamodb.ErrCodeResourceNotFoundException, "not found", nil)
+	stub = &batchingTestStub{batchErr: failure}
+	cc = newBatchingTestClient(t, 20*time.Millisecond, 100, stub)
+	_, errs = getItemsConcurrently(cc, "a", "b")
+	require.Equal(t, []error{failure, failure}, errs)
+	require.Empty(t, stub.gets)
+}
+
+func TestClusterDaxClient_BatchGetItemsWindow(t *testing.T) {
+	const window = 50 * time.Millisecond
+	stub := &batchingTestStub{items: map[string]map[string]*dynamodb.AttributeValue{"a": testItem("a")}}
+	cc := newBatchingTestClient(t, window, 3, stub)
+	clock := newFakeClock()
+	cc.batcher = newGetItemBatcher(window, 3, clock, cc.getItem, cc.BatchGetItemWithOptions)
+
+	// a lone call is sent once the window elapsed
+	sent := make(chan []error)
+	go func() {
+		_, errs := getItemsConcurrently(cc, "a")
+		sent <- errs
+	}()
+	require.Equal(t, window, clock.waitForTimers(t, 1))
+	clock.Advance(window - 1)
+	select {
+	case <-sent:
+		t.Fatal("batch sent before the window elapsed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Advance(1)
+	require.Equal(t, []error{nil}, <-sent)
+	require.Len(t, stub.batches, 1)
+
+	// a full batch is sent without waiting for the window
+	cc = newBatchingTestClient(t, time.Hour, 3, stub)
+	start := time.Now()
+	_, errs := getItemsConcurrently(cc, "a", "b", "c")
+	require.Equal(t, []error{nil, nil, nil}, errs)
+	require.True(t, time.Since(start) < time.Second)
+
+	// a call stops waiting for its batch once its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}
+	_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{Context: ctx})
+	require.Error(t, err)
+	require.Equal(t, request.CanceledErrorCode, err.(awserr.Error).Code())
+}
+
+func TestClusterDaxClient_BatchGetItemsBypassed(t *testing.T) {
+	stub := &batchingTestStub{items: map[string]map[string]*dynamodb.AttributeValue{"a": testItem("a")}}
+	cc := newBatchingTestClient(t, time.Hour, 100, stub)
+
+	key := map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}
+	inputs := []*dynamodb.GetItemInput{
+		{TableName: aws.String("table"), Key: key, ConsistentRead: aws.Bool(true)},
+		{TableName: aws.String("table"), Key: key, ProjectionExpression: aws.String("pk")},
+		{TableName: aws.String("table"), Key: key, ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal)},
+	}
+	for _, input := range inputs {
+		out, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+		require.NoError(t, err)
+		require.Equal(t, testItem("a"), out.Item)
+	}
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+	_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{RetryDelay: time.Millisecond})
+	require.NoError(t, err)
+	require.Len(t, stub.gets, 4)
+	require.Empty(t, stub.batches)
+
+	require.Nil(t, newGetItemBatcher(0, 100, nil, nil, nil), "batching is disabled by default")
+	require.Equal(t, time.Duration(0), DefaultConfig().GetItemBatchWindow)
+}
+
+// Builds real clients for the nodes of blackholed, whose connections time out,
+// and test clients for the others.
+type blackholeClientBuilder struct {
+	testClientBuilder
+	blackholed string
+}
+
+func (b *blackholeClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
+	if addr := net.JoinHostPort(ip.String(), strconv.Itoa(port)); addr == b.blackholed {
+		return newSingleClientWithOptions(addr, connConfigData, region, credentials, maxConns, blackholeDial)
+	}
+	return b.testClientBuilder.newClient(host, ip, port, connConfigData, region, credentials, maxConns, dialContextFn)
+}
+
+// Picks the first node unless it was the node of the previous attempt.
+type firstUnlessPreviousPolicy struct {
+	recordingPolicy
+}
+
+func (p *firstUnlessPreviousPolicy) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	if nodes[0].Addr == op.Previous {
+		return nodes[1], nil
+	}
+	return nodes[0], nil
+}
+
+func TestClusterDaxClient_ConnectTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.ConnectTimeout = 50 * time.Millisecond
+	cfg.RoutingPolicy = &firstUnlessPreviousPolicy{}
+	cluster, _ := newCluster(cfg)
+	b := &blackholeClientBuilder{blackholed: "10.255.255.1:8111"}
+	b.getItem = func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}, nil
+	}
+	cluster.clientBuilder = b
+	cc := &ClusterDaxClient{config: cfg, cluster: cluster}
+	defer cc.Close()
+	require.NoError(t, cluster.update([]serviceEndpoint{
+		{address: net.IPv4(10, 255, 255, 1).To4(), port: 8111},
+		{address: net.IPv4(10, 0, 0, 2).To4(), port: 8111},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	out, err := cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}, &dynamodb.GetItemOutput{}, RequestOptions{Context: ctx, MaxRetries: 1})
+	elapsed := time.Since(start)
+	require.NoError(t, err)
+	require.Equal(t, "a", aws.StringValue(out.Item["pk"].S))
+	require.True(t, elapsed >= cfg.ConnectTimeout && elapsed < time.Second, "connect abandoned after %s", elapsed)
+
+	require.Equal(t, int64(1), cc.Stats().ConnectTimeouts)
+	nodes := cluster.nodeInfos()
+	require.Equal(t, "10.255.255.1:8111", nodes[0].Addr)
+	require.False(t, nodes[0].Healthy)
+	require.True(t, nodes[1].Healthy)
+}
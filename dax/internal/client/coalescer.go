@@ -0,0 +1,193 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Shares a single in-flight request between concurrent identical eventually
+// consistent GetItem calls. A nil coalescer does not coalesce anything.
+type getItemCoalescer struct {
+	coalesced int64 // accessed atomically
+
+	mu    sync.Mutex
+	calls map[string]*getItemCall // protected by mu
+}
+
+type getItemCall struct {
+	done    chan struct{}
+	waiters int // protected by the coalescer mu
+
+	// set before done is closed, output is a copy reserved to the waiters
+	output   *dynamodb.GetItemOutput
+	err      error
+	panicked bool // the call did not complete, waiters execute it on their own
+}
+
+// Returns a coalescer, or nil if coalescing is disabled.
+func newGetItemCoalescer(enabled bool) *getItemCoalescer {
+	if !enabled {
+		return nil
+	}
+	return &getItemCoalescer{calls: make(map[string]*getItemCall)}
+}
+
+// Executes get, unless an identical call is in flight in which case its output is copied.
+// A call canceled by its own context is executed again for the waiters whose context is not done.
+func (c *getItemCoalescer) do(ctx context.Context, input *dynamodb.GetItemInput, get func() (*dynamodb.GetItemOutput, error)) (*dynamodb.GetItemOutput, error) {
+	if c == nil || aws.BoolValue(input.ConsistentRead) {
+		return get()
+	}
+	key, ok := getItemCoalescingKey(input)
+	if !ok {
+		return get()
+	}
+
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		call.waiters++
+		c.mu.Unlock()
+		atomic.AddInt64(&c.coalesced, 1)
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, WrapError(request.CanceledErrorCode, "request context canceled", ctx.Err())
+		}
+		if call.panicked {
+			return get()
+		}
+		if call.err != nil {
+			if e, ok := call.err.(awserr.Error); ok && e.Code() == request.CanceledErrorCode && ctx.Err() == nil {
+				return get()
+			}
+			return nil, call.err
+		}
+		return awsutil.CopyOf(call.output).(*dynamodb.GetItemOutput), nil
+	}
+	call := &getItemCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	completed := false
+	var output *dynamodb.GetItemOutput
+	var err error
+	// waiters are released even if get panics
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		waiters := call.waiters
+		c.mu.Unlock()
+		if !completed {
+			call.panicked = true
+		} else if waiters > 0 {
+			call.err = err
+			if err == nil && output != nil {
+				call.output = awsutil.CopyOf(output).(*dynamodb.GetItemOutput)
+			}
+		}
+		close(call.done)
+	}()
+
+	output, err = get()
+	completed = true
+	return output, err
+}
+
+// Adds the coalescer counters to s.
+func (c *getItemCoalescer) stats(s *Stats) {
+	if c == nil {
+		return
+	}
+	s.CoalescedGetItems += atomic.LoadInt64(&c.coalesced)
+}
+
+// Returns a key identifying the item and the attributes returned by the call.
+// Returns false if the input cannot be coalesced.
+func getItemCoalescingKey(input *dynamodb.GetItemInput) (string, bool) {
+	if input.TableName == nil || len(input.Key) == 0 {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(strconv.Quote(*input.TableName))
+	if !writeKey(&b, sortedKeyNames(input.Key), input.Key) {
+		return "", false
+	}
+
+	b.WriteString("|" + strconv.Quote(aws.StringValue(input.ProjectionExpression)))
+	attrNames := make([]string, 0, len(input.ExpressionAttributeNames))
+	for name, v := range input.ExpressionAttributeNames {
+		attrNames = append(attrNames, strconv.Quote(name)+"="+strconv.Quote(aws.StringValue(v)))
+	}
+	sort.Strings(attrNames)
+	b.WriteString(strings.Join(attrNames, ","))
+	b.WriteString("|")
+	for _, a := range input.AttributesToGet {
+		b.WriteString(strconv.Quote(aws.StringValue(a)))
+	}
+	b.WriteString("|" + aws.StringValue(input.ReturnConsumedCapacity))
+	return b.String(), true
+}
+
+// Returns the attribute names of key in order.
+func sortedKeyNames(key map[string]*dynamodb.AttributeValue) []string {
+	names := make([]string, 0, len(key))
+	for name := range key {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Writes the names attributes of item to b. Returns false if one of them is
+// missing or not a scalar.
+func writeKey(b *strings.Builder, names []string, item map[string]*dynamodb.AttributeValue) bool {
+	for _, name := range names {
+		av := item[name]
+		if av == nil {
+			return false
+		}
+		b.WriteString(strconv.Quote(name))
+		switch {
+		case av.S != nil:
+			b.WriteString("S" + strconv.Quote(*av.S))
+		case av.N != nil:
+			// numbers are returned normalized, "1.0" is returned as "1"
+			n, ok := cbor.NormalizeNumber(*av.N)
+			if !ok {
+				return false
+			}
+			b.WriteString("N" + strconv.Quote(n))
+		case av.B != nil:
+			b.WriteString("B" + strconv.Quote(string(av.B)))
+		default:
+			return false // not a valid key, let the request fail on its own
+		}
+	}
+	return true
+}
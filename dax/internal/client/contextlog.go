@@ -0,0 +1,63 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// A logger appending the fields of the context of a request to its lines, see
+// Config.ContextFields. The fields are only evaluated once a line is logged.
+type contextLogger struct {
+	logger   aws.Logger
+	ctx      context.Context
+	fieldsOf func(ctx context.Context) []interface{}
+
+	once   sync.Once
+	fields string
+}
+
+// Returns logger appending the key/value pairs returned by fieldsOf for ctx to
+// its lines, or logger itself if fieldsOf is nil.
+func withContextFields(logger aws.Logger, ctx context.Context, fieldsOf func(ctx context.Context) []interface{}) aws.Logger {
+	if logger == nil || fieldsOf == nil {
+		return logger
+	}
+	return &contextLogger{logger: logger, ctx: ctx, fieldsOf: fieldsOf}
+}
+
+func (l *contextLogger) Log(args ...interface{}) {
+	l.once.Do(func() { l.fields = formatFields(l.fieldsOf(l.ctx)) })
+	l.logger.Log(fmt.Sprint(args...) + l.fields)
+}
+
+// Formats the key/value pairs of fields as " key=value" suffixes.
+func formatFields(fields []interface{}) string {
+	var b bytes.Buffer
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			fmt.Fprintf(&b, " !BADKEY=%v", fields[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", fields[i], fields[i+1])
+	}
+	return b.String()
+}
@@ -0,0 +1,118 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/require"
+)
+
+type traceKey struct{}
+
+func TestClusterDaxClient_ContextFields(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{address: net.IPv4(127, 0, 0, 1).To4(), port: 8121}})
+	cfg := DefaultConfig()
+	cfg.ContextFields = func(ctx context.Context) []interface{} {
+		return []interface{}{"trace_id", ctx.Value(traceKey{}), "service", "orders"}
+	}
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+
+	var lock sync.Mutex
+	var logs []string
+	logger := aws.LoggerFunc(func(args ...interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		logs = append(logs, fmt.Sprint(args...))
+	})
+
+	// two requests retried concurrently, each attempt waiting for the other
+	var attempts sync.WaitGroup
+	attempts.Add(2)
+	var wg sync.WaitGroup
+	for _, trace := range []string{"trace-a", "trace-b"} {
+		wg.Add(1)
+		go func(trace string) {
+			defer wg.Done()
+			calls := 0
+			action := func(client DaxAPI, o RequestOptions) error {
+				calls++
+				if calls == 1 {
+					attempts.Done()
+					attempts.Wait()
+					return fmt.Errorf("failed")
+				}
+				return nil
+			}
+			opt := RequestOptions{Context: context.WithValue(context.Background(), traceKey{}, trace), MaxRetries: 1, RetryDelay: 1, Logger: logger, LogLevel: aws.LogDebugWithRequestRetries}
+			require.NoError(t, cc.retry(OpGetItem, action, opt))
+		}(trace)
+	}
+	wg.Wait()
+
+	counts := map[string]int{}
+	for _, log := range logs {
+		a, b := strings.Contains(log, "trace_id=trace-a"), strings.Contains(log, "trace_id=trace-b")
+		require.True(t, a != b, "expect the trace ID of a single request in %q", log)
+		require.True(t, strings.HasSuffix(log, " service=orders"), "expect the fields at the end of %q", log)
+		if a {
+			counts["trace-a"]++
+		} else {
+			counts["trace-b"]++
+		}
+	}
+	// the retry, the error and the completion of each request
+	require.Equal(t, map[string]int{"trace-a": 3, "trace-b": 3}, counts)
+
+	// the fields of requests logging nothing are not evaluated
+	var calls int32
+	cc.config.ContextFields = func(ctx context.Context) []interface{} {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+	opt := RequestOptions{Context: context.Background(), Logger: logger, LogLevel: aws.LogOff}
+	require.NoError(t, cc.retry(OpGetItem, func(client DaxAPI, o RequestOptions) error { return nil }, opt))
+	require.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestWithContextFields(t *testing.T) {
+	var logs []string
+	logger := aws.LoggerFunc(func(args ...interface{}) { logs = append(logs, fmt.Sprint(args...)) })
+
+	var calls int
+	fieldsOf := func(ctx context.Context) []interface{} {
+		calls++
+		return []interface{}{"k", ctx.Value(traceKey{}), "odd"}
+	}
+	_, wrapped := withContextFields(logger, context.Background(), nil).(*contextLogger)
+	require.False(t, wrapped, "expect no fields appended")
+	require.Nil(t, withContextFields(nil, context.Background(), fieldsOf))
+
+	l := withContextFields(logger, context.WithValue(context.Background(), traceKey{}, 1), fieldsOf)
+	require.Equal(t, 0, calls, "expect the fields evaluated only once a line is logged")
+	l.Log("DEBUG: line")
+	l.Log("DEBUG: other line")
+	require.Equal(t, 1, calls)
+	require.Equal(t, []string{"DEBUG: line k=1 !BADKEY=odd", "DEBUG: other line k=1 !BADKEY=odd"}, logs)
+}
@@ -16,9 +16,12 @@
 package client
 
 import (
+	"context"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 )
 
@@ -101,4 +104,72 @@ func TestRetryOnAuthenticationRequiredException(t *testing.T) {
 		t.Errorf("error %v", err)
 	}
 
-}
\ No newline at end of file
+}
+func TestRetryThrottleBackoffSchedule(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	clock := newFakeClock()
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	cc.config.clock = clock
+
+	const retries = 12
+	var calls int32
+	action := func(client DaxAPI, o RequestOptions) error {
+		atomic.AddInt32(&calls, 1)
+		return newDaxRequestFailure([]int{0}, "ThrottlingException", "", "", 400)
+	}
+	done := make(chan error)
+	go func() { done <- cc.retry("op", action, RequestOptions{MaxRetries: retries}) }()
+
+	for attempt := 1; attempt <= retries; attempt++ {
+		minDelay := time.Duration(1<<uint64(attempt)) * DefaultBaseRetryDelay
+		if minDelay > DefaultMaxBackoffDelay {
+			minDelay = DefaultMaxBackoffDelay
+		}
+		delay := clock.waitForTimers(t, 1)
+		if delay < minDelay/2 || delay > minDelay {
+			t.Errorf("retry %d: expected a delay in [%v, %v], got %v", attempt, minDelay/2, minDelay, delay)
+		}
+		clock.Advance(delay)
+	}
+	err := <-done
+	if err == nil || err.(awserr.Error).Code() != "ThrottlingException" {
+		t.Errorf("expected the throttling error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != retries+1 {
+		t.Errorf("expected %d calls, got %d", retries+1, n)
+	}
+}
+
+func TestRetryDelayCanceled(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{hostname: "localhost", port: 8121}})
+	clock := newFakeClock()
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	cc.config.clock = clock
+
+	var calls int32
+	action := func(client DaxAPI, o RequestOptions) error {
+		atomic.AddInt32(&calls, 1)
+		return newDaxRequestFailure([]int{1}, "", "", "", 500)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cc.retry("op", action, RequestOptions{Context: ctx, MaxRetries: 3, RetryDelay: time.Second})
+	}()
+
+	if delay := clock.waitForTimers(t, 1); delay != time.Second {
+		t.Errorf("expected a delay of %v, got %v", time.Second, delay)
+	}
+	clock.Advance(time.Second)
+	clock.waitForTimers(t, 1)
+	cancel()
+	err := <-done
+	if err == nil || err.(awserr.Error).Code() != request.CanceledErrorCode {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected 2 calls, got %d", n)
+	}
+}
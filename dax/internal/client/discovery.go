@@ -0,0 +1,137 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Backoff between the attempts of the first discovery, see
+// Config.BootstrapTimeout.
+const (
+	bootstrapBaseDelay = 100 * time.Millisecond
+	bootstrapMaxDelay  = 5 * time.Second
+)
+
+// DiscoveryStatus describes the discoveries of the nodes of a cluster, made
+// every Config.ClusterUpdateInterval, on errors and by RefreshEndpoints.
+type DiscoveryStatus struct {
+	// Time of the last successful discovery, zero if none succeeded yet.
+	LastSuccess time.Time
+
+	// Error of the last discovery, nil if it succeeded.
+	LastError error
+
+	// Number of discoveries failed since the last successful one. The known
+	// nodes of the cluster may be stale while it is not zero.
+	ConsecutiveFailures int
+}
+
+// Records the result of a discovery, and reports a failure to
+// Config.OnDiscoveryFailure.
+func (c *cluster) discovered(err error) {
+	c.lock.Lock()
+	if err == nil {
+		c.discovery = DiscoveryStatus{LastSuccess: clockOrSystem(c.config.clock).Now()}
+		c.lock.Unlock()
+		return
+	}
+	c.discovery.LastError = err
+	c.discovery.ConsecutiveFailures++
+	failures := c.discovery.ConsecutiveFailures
+	c.lock.Unlock()
+
+	atomic.AddInt64(&c.discoveryFailures, 1)
+	if c.config.OnDiscoveryFailure != nil {
+		c.config.OnDiscoveryFailure(err, failures)
+	}
+}
+
+func (c *cluster) discoveryStatus() DiscoveryStatus {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.discovery
+}
+
+// Adds the discovery counters to s.
+func (c *cluster) discoveryStats(s *Stats) {
+	s.DiscoveryFailures += atomic.LoadInt64(&c.discoveryFailures)
+	s.ConsecutiveDiscoveryFailures += int64(c.discoveryStatus().ConsecutiveFailures)
+}
+
+// Discovers the nodes of the cluster, retrying with exponential backoff until
+// a discovery finds nodes, Config.BootstrapTimeout elapsed or ctx is done. A
+// discovery still in progress at the deadline is aborted.
+func (c *cluster) bootstrap(ctx aws.Context) error {
+	clk := clockOrSystem(c.config.clock)
+	start := clk.Now()
+	deadline := start.Add(c.config.BootstrapTimeout)
+	attemptCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	delay := bootstrapBaseDelay
+	var history []string
+	var err error
+	for attempt := 1; ; attempt++ {
+		atomic.StoreInt64(&c.lastUpdateNs, clk.Now().UnixNano())
+		err = c.refreshNowWith(attemptCtx)
+		if err == nil && !c.hasRoutes() {
+			err = awserr.New(ErrCodeServiceUnavailable, "no nodes discovered", nil)
+		}
+		c.lock.Lock()
+		c.lastRefreshErr = err
+		c.lock.Unlock()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return WrapError(request.CanceledErrorCode, "DAX cluster discovery canceled", ctx.Err())
+		}
+		history = append(history, fmt.Sprintf("attempt %d after %s: %s", attempt, clk.Now().Sub(start).Round(time.Millisecond), err))
+
+		remaining := deadline.Sub(clk.Now())
+		if remaining <= 0 {
+			break
+		}
+		if delay > remaining {
+			delay = remaining
+		}
+		if c.config.logger != nil && c.config.logLevel.AtLeast(aws.LogDebug) {
+			c.config.logger.Log(fmt.Sprintf("DEBUG: DAX cluster discovery attempt %d failed, retrying in %s : %s", attempt, delay, err))
+		}
+		if serr := clk.Sleep(ctx, delay); serr != nil {
+			return WrapError(request.CanceledErrorCode, "DAX cluster discovery canceled", serr)
+		}
+		if delay *= 2; delay > bootstrapMaxDelay {
+			delay = bootstrapMaxDelay
+		}
+	}
+	msg := fmt.Sprintf("DAX cluster discovery failed %d times in %s: %s", len(history), c.config.BootstrapTimeout, strings.Join(history, "; "))
+	return WrapError(ErrCodeServiceUnavailable, msg, err)
+}
+
+func (c *cluster) hasRoutes() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.routes) > 0
+}
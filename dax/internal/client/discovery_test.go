@@ -0,0 +1,90 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterDaxClient_DiscoveryStatus(t *testing.T) {
+	clk := newFakeClock()
+	var mu sync.Mutex
+	var failures []int
+	var failureErrs []error
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.clock = clk
+	cfg.SetLogger(aws.LoggerFunc(func(...interface{}) {}), aws.LogOff)
+	cfg.OnDiscoveryFailure = func(err error, consecutiveFailures int) {
+		mu.Lock()
+		defer mu.Unlock()
+		failureErrs = append(failureErrs, err)
+		failures = append(failures, consecutiveFailures)
+	}
+	calls := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), failures...)
+	}
+
+	cluster, _ := newTestClusterWithConfig(cfg)
+	b := &discoveryClientBuilder{}
+	cluster.clientBuilder = b
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+	require.Equal(t, DiscoveryStatus{}, cc.DiscoveryStatus())
+
+	nodes := func() ([]serviceEndpoint, error) {
+		return []serviceEndpoint{{address: net.IPv4(127, 0, 0, 2).To4(), port: 8111}}, nil
+	}
+	b.setPull(nodes)
+	require.NoError(t, cluster.start())
+	defer cluster.Close()
+	firstSuccess := clk.Now()
+	require.Equal(t, DiscoveryStatus{LastSuccess: firstSuccess}, cc.DiscoveryStatus())
+
+	// the background refresh fails in a row
+	failure := errors.New("discovery failed")
+	b.setPull(func() ([]serviceEndpoint, error) { return nil, failure })
+	for i := 1; i <= 3; i++ {
+		clk.Advance(cfg.ClusterUpdateInterval)
+		require.Eventually(t, func() bool { return len(calls()) == i }, 5*time.Second, time.Millisecond)
+	}
+	require.Equal(t, []int{1, 2, 3}, calls())
+	require.Equal(t, []error{failure, failure, failure}, failureErrs)
+	require.Equal(t, DiscoveryStatus{LastSuccess: firstSuccess, LastError: failure, ConsecutiveFailures: 3}, cc.DiscoveryStatus())
+	s := cc.Stats()
+	require.Equal(t, int64(3), s.DiscoveryFailures)
+	require.Equal(t, int64(3), s.ConsecutiveDiscoveryFailures)
+	require.Equal(t, []string{"127.0.0.2:8111"}, cc.Nodes(), "a failed discovery keeps the nodes")
+
+	// a successful discovery resets the consecutive failures
+	b.setPull(nodes)
+	clk.Advance(cfg.ClusterUpdateInterval)
+	require.Eventually(t, func() bool { return cc.DiscoveryStatus().ConsecutiveFailures == 0 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, DiscoveryStatus{LastSuccess: clk.Now()}, cc.DiscoveryStatus())
+	s = cc.Stats()
+	require.Equal(t, int64(3), s.DiscoveryFailures)
+	require.Equal(t, int64(0), s.ConsecutiveDiscoveryFailures)
+	require.Equal(t, []int{1, 2, 3}, calls())
+}
@@ -19,6 +19,8 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/cbor"
 	"github.com/aws/aws-dax-go/dax/internal/lru"
@@ -35,8 +37,216 @@ const (
 	ErrCodeServiceUnavailable  = "ServiceUnavailable"
 	ErrCodeUnknown             = "Unknown"
 	ErrCodeThrottlingException = "ThrottlingException"
+	ErrCodeClientClosed        = "ClientClosed"
+	ErrCodeOverloaded          = "Overloaded"
+	ErrCodeConnectionFailed    = "ConnectionFailed"
+	ErrCodeConnectTimeout      = "ConnectTimeout"
 )
 
+// ErrClientClosed is returned by every operation invoked on a client after it has been closed.
+var ErrClientClosed = awserr.New(ErrCodeClientClosed, "dax client is closed", nil)
+
+// ErrOverloaded is returned when MaxConcurrentRequests requests are in flight
+// and no request completed within AcquireTimeout.
+var ErrOverloaded = awserr.New(ErrCodeOverloaded, "too many concurrent requests", nil)
+
+// RequestError is returned, with Config.DetailedErrors, by the requests of a
+// ClusterDaxClient failing once at least one attempt was made. It tells the
+// operation, the node of the last attempt, the number of attempts made and the
+// time elapsed, and wraps the error of the last attempt.
+//
+// RequestError implements awserr.RequestFailure with the code, message,
+// status code and request ID of Err, so that checks of the code of an error are
+// unaffected. The status code is 0 and the request ID empty if Err is not an
+// awserr.RequestFailure, such as a network error.
+type RequestError struct {
+	// Op is the name of the operation, such as GetItem.
+	Op string
+	// CorrelationID is the identifier generated by the client for the request,
+	// see ResponseMetadata.
+	CorrelationID string
+	// Node is the "host:port" address of the node of the last attempt, or the
+	// empty string if no node was picked.
+	Node string
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Elapsed is the time elapsed from the start of the request to its failure.
+	Elapsed time.Duration
+	// Err is the error of the last attempt.
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s failed (correlationID=%s node=%s attempts=%d elapsed=%s): %v", e.Op, e.CorrelationID, e.Node, e.Attempts, e.Elapsed, e.Err)
+}
+
+func (e *RequestError) Code() string {
+	if ae, ok := e.Err.(awserr.Error); ok {
+		return ae.Code()
+	}
+	return ErrCodeUnknown
+}
+
+func (e *RequestError) Message() string {
+	if ae, ok := e.Err.(awserr.Error); ok {
+		return ae.Message()
+	}
+	return e.Err.Error()
+}
+
+func (e *RequestError) OrigErr() error {
+	return e.Err
+}
+
+func (e *RequestError) StatusCode() int {
+	if rf, ok := e.Err.(awserr.RequestFailure); ok {
+		return rf.StatusCode()
+	}
+	return 0
+}
+
+func (e *RequestError) RequestID() string {
+	if rf, ok := e.Err.(awserr.RequestFailure); ok {
+		return rf.RequestID()
+	}
+	return ""
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// NodeError wraps, with Config.DetailedErrors, the error of an attempt
+// attributable to a node of the cluster, such as a failure to dial it, a
+// timeout waiting for its response or an error returned by the server. It is
+// wrapped in turn by the RequestError of the request. Without
+// Config.DetailedErrors, the node is told by ResponseMetadata. Errors raised by the client before sending a request, such as
+// validation errors, carry no NodeError.
+//
+// NodeError implements awserr.RequestFailure the way RequestError does.
+type NodeError struct {
+	// Addr is the "host:port" address of the node.
+	Addr string
+	// AZ is the availability zone of the node, or the empty string if the
+	// cluster did not report it.
+	AZ string
+	// Err is the error of the attempt.
+	Err error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("node %s (az=%s): %v", e.Addr, e.AZ, e.Err)
+}
+
+func (e *NodeError) Code() string {
+	if ae, ok := e.Err.(awserr.Error); ok {
+		return ae.Code()
+	}
+	return ErrCodeUnknown
+}
+
+func (e *NodeError) Message() string {
+	if ae, ok := e.Err.(awserr.Error); ok {
+		return ae.Message()
+	}
+	return e.Err.Error()
+}
+
+func (e *NodeError) OrigErr() error {
+	return e.Err
+}
+
+func (e *NodeError) StatusCode() int {
+	if rf, ok := e.Err.(awserr.RequestFailure); ok {
+		return rf.StatusCode()
+	}
+	return 0
+}
+
+func (e *NodeError) RequestID() string {
+	if rf, ok := e.Err.(awserr.RequestFailure); ok {
+		return rf.RequestID()
+	}
+	return ""
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// Returns whether err, returned by an attempt sent to a node, was raised by the
+// client itself before the request reached the node.
+func isClientSideError(err error) bool {
+	switch e := err.(type) {
+	case *ItemTooLargeError, request.ErrInvalidParams:
+		return true
+	case awserr.Error:
+		return e.Code() == request.InvalidParameterErrCode || e.Code() == ErrCodeClientClosed
+	}
+	return false
+}
+
+// ErrCodeNotImplementedException is the code of a NotImplementedError.
+const ErrCodeNotImplementedException = "NotImplementedException"
+
+// NotImplementedError is returned by the operations DAX does not implement,
+// such as the control plane operations of DynamoDB. Its Operation names the
+// operation that was invoked.
+//
+// NotImplementedError implements awserr.Error. Its message starts with the
+// NotImplemented code previously returned as the whole error string.
+type NotImplementedError struct {
+	// Operation is the name of the DynamoDB operation, such as CreateTable.
+	Operation string
+}
+
+func (e *NotImplementedError) Error() string {
+	return ErrCodeNotImplemented + ": " + e.Message()
+}
+
+func (e *NotImplementedError) Code() string {
+	return ErrCodeNotImplementedException
+}
+
+func (e *NotImplementedError) Message() string {
+	return fmt.Sprintf("DAX does not implement %s", e.Operation)
+}
+
+func (e *NotImplementedError) OrigErr() error {
+	return nil
+}
+
+// WrapError is awserr.New returning an error that also unwraps to origErr, so
+// that errors.Is and errors.As reach it, e.g. to tell a context.DeadlineExceeded
+// or a net.Error.
+func WrapError(code, message string, origErr error) awserr.Error {
+	return &wrappedError{err: awserr.New(code, message, origErr)}
+}
+
+type wrappedError struct {
+	err awserr.Error
+}
+
+func (e *wrappedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *wrappedError) Code() string {
+	return e.err.Code()
+}
+
+func (e *wrappedError) Message() string {
+	return e.err.Message()
+}
+
+func (e *wrappedError) OrigErr() error {
+	return e.err.OrigErr()
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err.OrigErr()
+}
+
 type daxError interface {
 	awserr.RequestFailure
 	CodeSequence() []int
@@ -62,6 +272,12 @@ func newDaxRequestFailure(codes []int, errorCode, message, requestId string, sta
 	}
 }
 
+// newValidationFailure returns the failure the server reports for an invalid
+// request, for requests found invalid before being sent.
+func newValidationFailure(message string) *daxRequestFailure {
+	return newDaxRequestFailure([]int{4, 37, 38, 39, 46}, ErrCodeValidationException, message, "", 400)
+}
+
 func newDaxTransactionCanceledFailure(codes []int, errorCode, message, requestId string, statusCode int,
 	cancellationReasonCodes, cancellationReasonMsgs []*string, cancellationReasonItems []byte) *daxTransactionCanceledFailure {
 	return &daxTransactionCanceledFailure{
@@ -99,9 +315,9 @@ func translateError(err error) awserr.Error {
 		if e.Timeout() {
 			code = request.ErrCodeResponseTimeout
 		}
-		return awserr.New(code, "network error", e)
+		return WrapError(code, "network error", e)
 	default:
-		return awserr.New("UnknownError", "unknown error", err)
+		return WrapError("UnknownError", "unknown error", err)
 	}
 }
 
@@ -311,13 +527,14 @@ func convertDaxError(e daxError) error {
 							Message_:     aws.String(e.Message()),
 						}
 					case 58:
-						tcFailure, ok := e.(*daxTransactionCanceledFailure)
-						if ok {
-							return &dynamodb.TransactionCanceledException{
-								RespMetadata:        md,
-								Message_:            aws.String(e.Message()),
-								CancellationReasons: tcFailure.cancellationReasons,
-							}
+						var reasons []*dynamodb.CancellationReason
+						if tcFailure, ok := e.(*daxTransactionCanceledFailure); ok {
+							reasons = tcFailure.cancellationReasons
+						}
+						return &dynamodb.TransactionCanceledException{
+							RespMetadata:        md,
+							Message_:            aws.String(e.Message()),
+							CancellationReasons: reasons,
 						}
 					case 59:
 						return &dynamodb.TransactionInProgressException{
@@ -339,6 +556,37 @@ func convertDaxError(e daxError) error {
 	return awserr.NewRequestFailure(awserr.New(ErrCodeUnknown, e.Message(), nil), e.StatusCode(), e.RequestID())
 }
 
+// Messages of validation errors returned when a request does not match the key schema of the table.
+var keySchemaMismatchMessages = []string{
+	"key element does not match the schema",
+	"missing the key",
+	"missed key schema element",
+}
+
+// Returns true if err indicates that the cached key schema of a table may be stale,
+// e.g. because the table was deleted or recreated with a different key schema.
+// A key that does not match the cached schema is rejected before being sent.
+func isStaleKeySchemaError(err error) bool {
+	if err == cbor.ErrMissingKey {
+		return true
+	}
+	if d, ok := err.(daxError); ok {
+		err = convertDaxError(d)
+	}
+	if _, ok := err.(*dynamodb.ResourceNotFoundException); ok {
+		return true
+	}
+	if e, ok := err.(awserr.Error); ok && e.Code() == ErrCodeValidationException {
+		msg := strings.ToLower(e.Message())
+		for _, m := range keySchemaMismatchMessages {
+			if strings.Contains(msg, m) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func decodeTransactionCancellationReasons(ctx aws.Context, failure *daxTransactionCanceledFailure,
 	keys []map[string]*dynamodb.AttributeValue, attrListIdToNames *lru.Lru) ([]*dynamodb.CancellationReason, error) {
 	inputL := len(keys)
@@ -355,7 +603,7 @@ func decodeTransactionCancellationReasons(ctx aws.Context, failure *daxTransacti
 		if consumed, err := consumeNil(r); err != nil {
 			return nil, err
 		} else if !consumed {
-			item, err := decodeNonKeyAttributes(ctx, r, attrListIdToNames, nil)
+			item, err := decodeNonKeyAttributes(ctx, r, nil, attrListIdToNames, nil)
 			if err != nil {
 				return nil, err
 			}
@@ -302,11 +302,11 @@ func TestTranslateError(t *testing.T) {
 		},
 		{
 			input:  new(net.UnknownNetworkError),
-			output: awserr.New(dynamodb.ErrCodeInternalServerError, "network error", new(net.UnknownNetworkError)),
+			output: WrapError(dynamodb.ErrCodeInternalServerError, "network error", new(net.UnknownNetworkError)),
 		},
 		{
 			input:  errors.New("ex"),
-			output: awserr.New("UnknownError", "unknown error", errors.New("ex")),
+			output: WrapError("UnknownError", "unknown error", errors.New("ex")),
 		},
 	}
 
@@ -0,0 +1,258 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The names of the clusters of a FailoverClient.
+const (
+	PrimaryCluster   = "primary"
+	SecondaryCluster = "secondary"
+)
+
+// FailoverClient sends requests to a primary cluster, or to a secondary
+// cluster once the health checks of the primary find it unreachable. Requests
+// are sent to the primary again when it is reachable again if failback is
+// automatic, or when Failback is called otherwise.
+type FailoverClient struct {
+	primary   *ClusterDaxClient
+	secondary *ClusterDaxClient
+
+	failedOver int32 // 1 while requests are sent to the secondary, accessed atomically
+	failovers  int64 // accessed atomically
+
+	automaticFailback bool
+	logger            aws.Logger
+}
+
+// NewFailover returns a client of the primary and secondary clusters. The
+// health checks of the primary, see Config.HealthCheckInterval, must be
+// enabled.
+func NewFailover(primary, secondary Config, automaticFailback bool) (*FailoverClient, error) {
+	return NewFailoverWithContext(aws.BackgroundContext(), primary, secondary, automaticFailback)
+}
+
+// NewFailoverWithContext is NewFailover with ctx aborting the wait for the
+// first discoveries of the clusters, see Config.BootstrapTimeout.
+func NewFailoverWithContext(ctx aws.Context, primary, secondary Config, automaticFailback bool) (*FailoverClient, error) {
+	if primary.HealthCheckInterval <= 0 {
+		return nil, awserr.New(request.InvalidParameterErrCode, "failover requires the HealthCheckInterval of the primary cluster", nil)
+	}
+	p, err := NewWithContext(ctx, primary)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewWithContext(ctx, secondary)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	return newFailoverClient(p, s, automaticFailback), nil
+}
+
+func newFailoverClient(primary, secondary *ClusterDaxClient, automaticFailback bool) *FailoverClient {
+	f := &FailoverClient{primary: primary, secondary: secondary, automaticFailback: automaticFailback, logger: primary.config.logger}
+	primary.cluster.health.subscribe(f.primaryChanged)
+	return f
+}
+
+func (f *FailoverClient) primaryChanged(reachable bool) {
+	if !reachable {
+		if atomic.CompareAndSwapInt32(&f.failedOver, 0, 1) {
+			atomic.AddInt64(&f.failovers, 1)
+			f.log("WARN: Sending requests to the secondary DAX cluster")
+		}
+	} else if f.automaticFailback {
+		if atomic.CompareAndSwapInt32(&f.failedOver, 1, 0) {
+			f.log("INFO: Sending requests to the primary DAX cluster again")
+		}
+	}
+}
+
+func (f *FailoverClient) log(msg string) {
+	if f.logger != nil {
+		f.logger.Log(msg)
+	}
+}
+
+// Failback sends requests to the primary cluster again after a failover. It
+// fails if the health checks still find the primary unreachable.
+func (f *FailoverClient) Failback() error {
+	if !f.primary.Reachable() {
+		return awserr.New(ErrCodeServiceUnavailable, "the primary cluster is unreachable", nil)
+	}
+	if atomic.CompareAndSwapInt32(&f.failedOver, 1, 0) {
+		f.log("INFO: Sending requests to the primary DAX cluster again")
+	}
+	return nil
+}
+
+// ActiveCluster returns the name of the cluster requests are sent to,
+// PrimaryCluster or SecondaryCluster.
+func (f *FailoverClient) ActiveCluster() string {
+	if atomic.LoadInt32(&f.failedOver) != 0 {
+		return SecondaryCluster
+	}
+	return PrimaryCluster
+}
+
+func (f *FailoverClient) active() *ClusterDaxClient {
+	if atomic.LoadInt32(&f.failedOver) != 0 {
+		return f.secondary
+	}
+	return f.primary
+}
+
+// Nodes returns the nodes of the cluster requests are sent to.
+func (f *FailoverClient) Nodes() []string {
+	return f.active().Nodes()
+}
+
+// Encrypted returns whether the connections to the cluster requests are sent
+// to use TLS.
+func (f *FailoverClient) Encrypted() bool {
+	return f.active().Encrypted()
+}
+
+// RefreshEndpoints refreshes the endpoints of both clusters now, returning the
+// error of the primary cluster, if any, or else that of the secondary.
+func (f *FailoverClient) RefreshEndpoints(ctx context.Context) error {
+	err := f.primary.RefreshEndpoints(ctx)
+	if serr := f.secondary.RefreshEndpoints(ctx); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// DiscoveryStatus returns the status of the discoveries of the cluster
+// requests are sent to.
+func (f *FailoverClient) DiscoveryStatus() DiscoveryStatus {
+	return f.active().DiscoveryStatus()
+}
+
+// Reachable returns whether the cluster requests are sent to is reachable.
+func (f *FailoverClient) Reachable() bool {
+	return f.active().Reachable()
+}
+
+// Stats returns the counters of both clusters added up, with the
+// ClusterUnreachable and ConsecutiveDiscoveryFailures of the active cluster.
+func (f *FailoverClient) Stats() Stats {
+	s := f.primary.Stats()
+	o := f.secondary.Stats()
+	s.add(o)
+	a := f.active().Stats()
+	s.ClusterUnreachable = a.ClusterUnreachable
+	s.ConsecutiveDiscoveryFailures = a.ConsecutiveDiscoveryFailures
+	s.Failovers = atomic.LoadInt64(&f.failovers)
+	return s
+}
+
+// NodeStats returns the counters of the nodes of both clusters by address.
+func (f *FailoverClient) NodeStats() map[string]Stats {
+	s := f.primary.NodeStats()
+	for addr, o := range f.secondary.NodeStats() {
+		s[addr] = o
+	}
+	return s
+}
+
+// ClusterStats returns the counters of each cluster by name.
+func (f *FailoverClient) ClusterStats() map[string]Stats {
+	return map[string]Stats{
+		PrimaryCluster:   f.primary.Stats(),
+		SecondaryCluster: f.secondary.Stats(),
+	}
+}
+
+// InvalidateTableCache evicts the cached key schema of the table in both clusters.
+func (f *FailoverClient) InvalidateTableCache(table string) {
+	f.primary.InvalidateTableCache(table)
+	f.secondary.InvalidateTableCache(table)
+}
+
+func (f *FailoverClient) Close() error {
+	err := f.primary.Close()
+	if serr := f.secondary.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+func (f *FailoverClient) PutItemWithOptions(input *dynamodb.PutItemInput, output *dynamodb.PutItemOutput, opt RequestOptions) (*dynamodb.PutItemOutput, error) {
+	return f.active().PutItemWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) DeleteItemWithOptions(input *dynamodb.DeleteItemInput, output *dynamodb.DeleteItemOutput, opt RequestOptions) (*dynamodb.DeleteItemOutput, error) {
+	return f.active().DeleteItemWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) UpdateItemWithOptions(input *dynamodb.UpdateItemInput, output *dynamodb.UpdateItemOutput, opt RequestOptions) (*dynamodb.UpdateItemOutput, error) {
+	return f.active().UpdateItemWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
+	return f.active().GetItemWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) ScanWithOptions(input *dynamodb.ScanInput, output *dynamodb.ScanOutput, opt RequestOptions) (*dynamodb.ScanOutput, error) {
+	return f.active().ScanWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) QueryWithOptions(input *dynamodb.QueryInput, output *dynamodb.QueryOutput, opt RequestOptions) (*dynamodb.QueryOutput, error) {
+	return f.active().QueryWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) BatchWriteItemWithOptions(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	return f.active().BatchWriteItemWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) BatchGetItemWithOptions(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
+	return f.active().BatchGetItemWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) TransactWriteItemsWithOptions(input *dynamodb.TransactWriteItemsInput, output *dynamodb.TransactWriteItemsOutput, opt RequestOptions) (*dynamodb.TransactWriteItemsOutput, error) {
+	return f.active().TransactWriteItemsWithOptions(input, output, opt)
+}
+
+func (f *FailoverClient) TransactGetItemsWithOptions(input *dynamodb.TransactGetItemsInput, output *dynamodb.TransactGetItemsOutput, opt RequestOptions) (*dynamodb.TransactGetItemsOutput, error) {
+	return f.active().TransactGetItemsWithOptions(input, output, opt)
+}
+
+// NewDaxRequest returns a request of the cluster active when it is created.
+func (f *FailoverClient) NewDaxRequest(op *request.Operation, input, output interface{}, opt RequestOptions) *request.Request {
+	return f.active().NewDaxRequest(op, input, output, opt)
+}
+
+func (f *FailoverClient) build(req *request.Request) {
+	f.active().build(req)
+}
+
+func (f *FailoverClient) send(req *request.Request) {
+	f.active().send(req)
+}
+
+func (f *FailoverClient) endpoints(opt RequestOptions) ([]serviceEndpoint, error) {
+	return f.active().endpoints(opt)
+}
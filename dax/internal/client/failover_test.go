@@ -0,0 +1,137 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returns a failover client of two test clusters whose GetItem outputs tell
+// the cluster serving them.
+func newFailoverTestClient(t *testing.T, automaticFailback bool) (*FailoverClient, *cluster) {
+	newClient := func(name string) *ClusterDaxClient {
+		cluster, b := newHealthTestCluster(t, nil)
+		b.getItem = func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{"cluster": {S: aws.String(name)}}}, nil
+		}
+		for _, client := range cluster.routes {
+			client.(*testClient).getItem = b.getItem
+		}
+		return &ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	}
+	primary := newClient(PrimaryCluster)
+	return newFailoverClient(primary, newClient(SecondaryCluster), automaticFailback), primary.cluster
+}
+
+func servingCluster(t *testing.T, f *FailoverClient) string {
+	out, err := f.GetItemWithOptions(&dynamodb.GetItemInput{
+		TableName: aws.String("table"),
+		Key:       map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}},
+	}, &dynamodb.GetItemOutput{}, RequestOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return aws.StringValue(out.Item["cluster"].S)
+}
+
+func TestFailoverClient(t *testing.T) {
+	f, primary := newFailoverTestClient(t, false)
+	down := awserr.New(request.ErrCodeRequestError, "connection refused", nil)
+
+	if e, a := PrimaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s, got %s", e, a)
+	}
+
+	// primary outage
+	setNodeErrors(primary, down, down)
+	primary.checkHealth()
+	primary.checkHealth()
+	if e, a := PrimaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s before UnreachableThreshold checks, got %s", e, a)
+	}
+	primary.checkHealth()
+	if e, a := SecondaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s, got %s", e, a)
+	}
+	if e, a := SecondaryCluster, f.ActiveCluster(); e != a {
+		t.Errorf("expect active cluster %s, got %s", e, a)
+	}
+	if err := f.Failback(); err == nil {
+		t.Errorf("expect failback to fail while the primary is unreachable")
+	}
+
+	// the primary recovers, but failback is manual
+	setNodeErrors(primary, nil, nil)
+	primary.checkHealth()
+	primary.checkHealth()
+	if !primary.health.reachable() {
+		t.Fatalf("expect the primary reachable")
+	}
+	if e, a := SecondaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s until failback, got %s", e, a)
+	}
+	if err := f.Failback(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := PrimaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s after failback, got %s", e, a)
+	}
+
+	s := f.Stats()
+	if s.Failovers != 1 || s.ClusterUnreachable != 0 || s.ReachabilityChanges != 2 {
+		t.Errorf("expect 1 failover and a reachable cluster, got %+v", s)
+	}
+	if c := f.ClusterStats(); len(c) != 2 || c[PrimaryCluster].ReachabilityChanges != 2 || c[SecondaryCluster].ReachabilityChanges != 0 {
+		t.Errorf("expect the stats of each cluster, got %+v", c)
+	}
+}
+
+func TestFailoverClient_AutomaticFailback(t *testing.T) {
+	f, primary := newFailoverTestClient(t, true)
+	down := awserr.New(request.ErrCodeRequestError, "connection refused", nil)
+
+	setNodeErrors(primary, down, down)
+	for i := 0; i < 3; i++ {
+		primary.checkHealth()
+	}
+	if e, a := SecondaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s, got %s", e, a)
+	}
+
+	setNodeErrors(primary, nil, down)
+	primary.checkHealth()
+	if e, a := SecondaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s before ReachableThreshold checks, got %s", e, a)
+	}
+	primary.checkHealth()
+	if e, a := PrimaryCluster, servingCluster(t, f); e != a {
+		t.Errorf("expect requests served by %s after ReachableThreshold checks, got %s", e, a)
+	}
+}
+
+func TestNewFailover(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	if _, err := NewFailover(cfg, cfg, true); err == nil {
+		t.Errorf("expect an error without health checks of the primary")
+	}
+}
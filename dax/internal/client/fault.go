@@ -0,0 +1,66 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// FaultInjector injects faults into the requests of a client, for chaos testing.
+type FaultInjector interface {
+	// InjectFault is called before each attempt of a request, the first
+	// attempt being 0, with the operation name, such as "GetItem", and the
+	// "host:port" address of the node the attempt is sent to. It returns the
+	// fault of the attempt, the zero Fault letting the attempt proceed.
+	InjectFault(op, node string, attempt int) Fault
+}
+
+// Fault is a fault injected into an attempt by a FaultInjector.
+type Fault struct {
+	// Delay is waited before the attempt, or until the request context is done.
+	Delay time.Duration
+	// Err, if not nil, fails the attempt without sending it, as if Err was
+	// read from the connection. Errors returned by NewFaultError are handled
+	// as errors returned by DAX: they are retried or not depending on their
+	// codes, and converted to DynamoDB errors. Any other error is handled as a
+	// network error, which is retried.
+	Err error
+}
+
+// NewFaultError returns an error as returned by DAX with the code sequence
+// codes, such as [4 37 38 39 46] for a ValidationException, to be injected
+// with a Fault.
+func NewFaultError(codes []int, code, message string, statusCode int) error {
+	return newDaxRequestFailure(codes, code, message, "", statusCode)
+}
+
+// Waits for and returns the fault injected into the attempt of op sent with
+// client, if any.
+func (cc *ClusterDaxClient) injectFault(ctx aws.Context, op string, client DaxAPI, attempt int) error {
+	if cc.config.FaultInjector == nil {
+		return nil
+	}
+	f := cc.config.FaultInjector.InjectFault(op, cc.cluster.nodeOf(client), attempt)
+	if f.Delay > 0 {
+		if err := clockOrSystem(cc.config.clock).Sleep(ctx, f.Delay); err != nil {
+			return WrapError(request.CanceledErrorCode, "request context canceled", err)
+		}
+	}
+	return f.Err
+}
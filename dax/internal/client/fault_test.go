@@ -0,0 +1,131 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type faultFunc func(op, node string, attempt int) Fault
+
+func (f faultFunc) InjectFault(op, node string, attempt int) Fault {
+	return f(op, node, attempt)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+type injectedAttempt struct {
+	op, node string
+	attempt  int
+}
+
+func newFaultTestClient(t *testing.T, injector FaultInjector) (*ClusterDaxClient, *int) {
+	calls := 0
+	cluster, b := newTestCluster([]string{"127.0.0.1:8111"})
+	b.getItem = func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		calls++
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	if err := cluster.update([]serviceEndpoint{{address: []byte{127, 0, 0, 1}, port: 8121}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	config := DefaultConfig()
+	config.FaultInjector = injector
+	return &ClusterDaxClient{config: config, cluster: cluster}, &calls
+}
+
+func faultTestInput() *dynamodb.GetItemInput {
+	return &dynamodb.GetItemInput{
+		TableName: aws.String("table"),
+		Key:       map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("key")}},
+	}
+}
+
+func TestClusterDaxClient_FaultInjectorTimeoutRetried(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []injectedAttempt
+	cc, calls := newFaultTestClient(t, faultFunc(func(op, node string, attempt int) Fault {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, injectedAttempt{op, node, attempt})
+		if attempt == 0 {
+			return Fault{Err: timeoutError{}}
+		}
+		return Fault{}
+	}))
+
+	if _, err := cc.GetItemWithOptions(faultTestInput(), &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: 2}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := 1, *calls; e != a {
+		t.Errorf("expect %v requests sent, got %v", e, a)
+	}
+	expected := []injectedAttempt{{OpGetItem, "127.0.0.1:8121", 0}, {OpGetItem, "127.0.0.1:8121", 1}}
+	if len(attempts) != len(expected) || attempts[0] != expected[0] || attempts[1] != expected[1] {
+		t.Errorf("expect %v, got %v", expected, attempts)
+	}
+}
+
+func TestClusterDaxClient_FaultInjectorNotRetried(t *testing.T) {
+	injected := 0
+	cc, calls := newFaultTestClient(t, faultFunc(func(op, node string, attempt int) Fault {
+		injected++
+		return Fault{Err: NewFaultError([]int{4, 37, 38, 39, 46}, ErrCodeValidationException, "invalid key", 400)}
+	}))
+
+	_, err := cc.GetItemWithOptions(faultTestInput(), &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: 2})
+	if aerr, ok := err.(awserr.RequestFailure); !ok || aerr.Code() != ErrCodeValidationException || aerr.StatusCode() != 400 {
+		t.Errorf("expect %v, got %v", ErrCodeValidationException, err)
+	}
+	if e, a := 1, injected; e != a {
+		t.Errorf("expect %v attempts, got %v", e, a)
+	}
+	if e, a := 0, *calls; e != a {
+		t.Errorf("expect %v requests sent, got %v", e, a)
+	}
+}
+
+func TestClusterDaxClient_FaultInjectorDelayCanceled(t *testing.T) {
+	cc, calls := newFaultTestClient(t, faultFunc(func(op, node string, attempt int) Fault {
+		return Fault{Delay: time.Hour}
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cc.GetItemWithOptions(faultTestInput(), &dynamodb.GetItemOutput{}, RequestOptions{Context: ctx, MaxRetries: 2})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Errorf("expect %v, got %v", request.CanceledErrorCode, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expect the delay to stop with the context, took %v", elapsed)
+	}
+	if e, a := 0, *calls; e != a {
+		t.Errorf("expect %v requests sent, got %v", e, a)
+	}
+}
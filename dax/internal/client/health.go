@@ -0,0 +1,152 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Tracks whether a cluster is reachable from the results of its health checks.
+// The state changes only after a run of consecutive checks agreeing on the
+// other state, so that a cluster failing intermittently does not flap between
+// both states.
+type healthMonitor struct {
+	unreachable int32 // 1 while the cluster is unreachable, accessed atomically
+	changes     int64 // accessed atomically
+
+	lock      sync.Mutex
+	failures  int                    // consecutive checks finding the cluster unreachable, protected by lock
+	successes int                    // consecutive checks finding the cluster reachable, protected by lock
+	listeners []func(reachable bool) // protected by lock
+
+	unreachableAfter int
+	reachableAfter   int
+	onChange         func(reachable bool)
+	logger           aws.Logger
+}
+
+func newHealthMonitor(cfg Config) *healthMonitor {
+	return &healthMonitor{
+		unreachableAfter: atLeastOne(cfg.UnreachableThreshold),
+		reachableAfter:   atLeastOne(cfg.ReachableThreshold),
+		onChange:         cfg.OnReachabilityChange,
+		logger:           cfg.logger,
+	}
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (m *healthMonitor) reachable() bool {
+	return atomic.LoadInt32(&m.unreachable) == 0
+}
+
+// Records the result of a health check, changing the state of the cluster
+// once enough consecutive checks found it in the other state.
+func (m *healthMonitor) record(reachable bool) {
+	m.lock.Lock()
+	if reachable {
+		m.successes++
+		m.failures = 0
+	} else {
+		m.failures++
+		m.successes = 0
+	}
+	changed := false
+	if m.reachable() && m.failures >= m.unreachableAfter {
+		atomic.StoreInt32(&m.unreachable, 1)
+		changed = true
+	} else if !m.reachable() && m.successes >= m.reachableAfter {
+		atomic.StoreInt32(&m.unreachable, 0)
+		changed = true
+	}
+	listeners := m.listeners
+	m.lock.Unlock()
+
+	if !changed {
+		return
+	}
+	atomic.AddInt64(&m.changes, 1)
+	if m.logger != nil {
+		if reachable {
+			m.logger.Log("INFO: DAX cluster is reachable again")
+		} else {
+			m.logger.Log(fmt.Sprintf("WARN: DAX cluster is unreachable after %d failed health checks", m.unreachableAfter))
+		}
+	}
+	for _, fn := range listeners {
+		fn(reachable)
+	}
+	if m.onChange != nil {
+		m.onChange(reachable)
+	}
+}
+
+// Makes fn be called, before Config.OnReachabilityChange, when the cluster
+// becomes unreachable or reachable again.
+func (m *healthMonitor) subscribe(fn func(reachable bool)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+func (m *healthMonitor) stats(s *Stats) {
+	s.ClusterUnreachable = int64(atomic.LoadInt32(&m.unreachable))
+	s.ReachabilityChanges = atomic.LoadInt64(&m.changes)
+}
+
+// Probes every node of the cluster at once and records whether any of them
+// answered, the nodes answering being healthy again. A node answering with an error is reachable: only failures to
+// reach it, such as connection errors and timeouts, count against it.
+func (c *cluster) checkHealth() error {
+	c.lock.RLock()
+	routes := c.routes
+	c.lock.RUnlock()
+
+	var reachable int32
+	var wg sync.WaitGroup
+	for _, client := range routes {
+		wg.Add(1)
+		go func(client DaxAPI) {
+			defer wg.Done()
+			ctx, cfn := context.WithTimeout(aws.BackgroundContext(), c.config.HealthCheckInterval)
+			defer cfn()
+			_, err := client.endpoints(RequestOptions{Context: ctx})
+			if _, ok := err.(daxError); err == nil || ok {
+				atomic.StoreInt32(&reachable, 1)
+				if s := c.nodeStateOf(client); s != nil {
+					atomic.StoreInt32(&s.failures, 0)
+				}
+			}
+		}(client)
+	}
+	wg.Wait()
+
+	if c.isClosed() {
+		return nil
+	}
+	c.health.record(reachable != 0)
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Time for which the addresses of a hostname are cached. The resolver of the
+// standard library does not report the TTLs of the records, so this is a
+// fixed 30s for all of them, whatever their TTLs: a record changed in DNS may
+// be dialed at its old addresses for up to 30s, or resolved again before its
+// TTL expired.
+const hostCacheTTL = 30 * time.Second
+
+// Caches the addresses of the hostnames dialed by the connection pools of a
+// client, and remembers the address of each hostname which connected last.
+type hostCache struct {
+	resolver resolver
+	clock    clock
+
+	lock  sync.Mutex
+	hosts map[string]*hostEntry // protected by lock
+}
+
+type hostEntry struct {
+	addrs   []net.IP
+	expires time.Time
+	good    net.IP // the address which connected last, nil if none
+}
+
+func newHostCache(r resolver, clk clock) *hostCache {
+	return &hostCache{resolver: r, clock: clockOrSystem(clk), hosts: make(map[string]*hostEntry)}
+}
+
+// Returns all the addresses of host, the address which connected last first,
+// resolving host again once its addresses expired.
+func (c *hostCache) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	now := c.clock.Now()
+	c.lock.Lock()
+	e := c.hosts[host]
+	if e != nil && now.Before(e.expires) {
+		addrs := e.ordered()
+		c.lock.Unlock()
+		return addrs, nil
+	}
+	c.lock.Unlock()
+
+	resolved, err := c.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.IP, len(resolved))
+	for i, a := range resolved {
+		addrs[i] = a.IP
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e = &hostEntry{addrs: addrs, expires: now.Add(hostCacheTTL), good: e.lastGood()}
+	c.hosts[host] = e
+	return e.ordered(), nil
+}
+
+// Records that ip, an address of host, connected.
+func (c *hostCache) connected(host string, ip net.IP) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e := c.hosts[host]; e != nil {
+		e.good = ip
+	}
+}
+
+// Returns the address of host which connected last, nil if none.
+func (c *hostCache) lastGood(host string) net.IP {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.hosts[host].lastGood()
+}
+
+// Expires the addresses of host, none of which connected, so that the next
+// lookup resolves host again.
+func (c *hostCache) failed(host string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e := c.hosts[host]; e != nil {
+		e.expires = time.Time{}
+	}
+}
+
+func (e *hostEntry) lastGood() net.IP {
+	if e == nil {
+		return nil
+	}
+	return e.good
+}
+
+// Returns the addresses of the entry, the address which connected last first,
+// in the order of the resolver otherwise.
+func (e *hostEntry) ordered() []net.IP {
+	addrs := make([]net.IP, 0, len(e.addrs))
+	for _, ip := range e.addrs {
+		if ip.Equal(e.good) {
+			addrs = append(addrs, ip)
+		}
+	}
+	for _, ip := range e.addrs {
+		if !ip.Equal(e.good) {
+			addrs = append(addrs, ip)
+		}
+	}
+	return addrs
+}
+
+// Dials the address of the pool. A hostname dialed by the default dialer is
+// resolved to all of its addresses, dialed in turn until one connects, the
+// address which connected last first. As net.Dialer does, each address is
+// given an equal share of the time left to connect.
+func (p *tubePool) dial(ctx context.Context) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(p.address)
+	if p.hosts == nil || err != nil || host == "" || net.ParseIP(host) != nil {
+		return p.dialContext(ctx, network, p.address)
+	}
+	addrs, err := p.hosts.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	for i, ip := range addrs {
+		dctx := ctx
+		if deadline, ok := ctx.Deadline(); ok && i < len(addrs)-1 {
+			share := deadline.Sub(time.Now()) / time.Duration(len(addrs)-i)
+			var cancel context.CancelFunc
+			dctx, cancel = context.WithTimeout(ctx, share)
+			defer cancel()
+		}
+		var conn net.Conn
+		conn, err = p.dialContext(dctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			p.hosts.connected(host, ip)
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	p.hosts.failed(host)
+	return nil, err
+}
@@ -0,0 +1,90 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostCache(t *testing.T) {
+	r := newFakeResolver()
+	r.hosts["node.example.internal"] = []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)}
+	clock := newFakeClock()
+	c := newHostCache(r, clock)
+	ctx := context.Background()
+
+	addrs, err := c.lookup(ctx, "node.example.internal")
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)}, addrs)
+
+	// the address which connected last comes first
+	c.connected("node.example.internal", net.IPv4(10, 0, 0, 2))
+	addrs, err = c.lookup(ctx, "node.example.internal")
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{net.IPv4(10, 0, 0, 2), net.IPv4(10, 0, 0, 1)}, addrs)
+	require.Equal(t, 1, r.ipLookups)
+
+	// resolved again once expired, the last good address still first
+	r.hosts["node.example.internal"] = []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), net.IPv4(10, 0, 0, 3)}
+	clock.Advance(hostCacheTTL)
+	addrs, err = c.lookup(ctx, "node.example.internal")
+	require.NoError(t, err)
+	require.Equal(t, []net.IP{net.IPv4(10, 0, 0, 2), net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 3)}, addrs)
+	require.Equal(t, 2, r.ipLookups)
+
+	// and once no address connected
+	c.failed("node.example.internal")
+	_, err = c.lookup(ctx, "node.example.internal")
+	require.NoError(t, err)
+	require.Equal(t, 3, r.ipLookups)
+}
+
+func TestSingleClient_DialsAllAddresses(t *testing.T) {
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		_, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0})
+		return err
+	})
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// the first address refuses the connections, nothing listens on it
+	r := newFakeResolver()
+	r.hosts["node.example.internal"] = []net.IP{net.IPv4(127, 0, 0, 2), net.IPv4(127, 0, 0, 1)}
+	hosts := newHostCache(r, nil)
+	cfg := connConfigData
+	cfg.hosts = hosts
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(net.JoinHostPort("node.example.internal", strconv.Itoa(port)), cfg, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	_, err = cli.endpoints(RequestOptions{MaxRetries: 0, Context: context.Background()})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), cli.Stats().ConnectionErrors)
+
+	addrs, err := hosts.lookup(context.Background(), "node.example.internal")
+	require.NoError(t, err)
+	require.Equal(t, net.IPv4(127, 0, 0, 1), addrs[0], "the address which connected is tried first")
+	require.Equal(t, 1, r.ipLookups)
+}
@@ -31,6 +31,15 @@ const (
 
 func translateLegacyGetItemInput(input *dynamodb.GetItemInput) (*dynamodb.GetItemInput, error) {
 	f, err := hasAttributesToGet(input.AttributesToGet, input.ProjectionExpression)
+	if err != nil {
+		return input, err
+	}
+	err = checkMixedParameters(
+		parameterNames{}.
+			add("AttributesToGet", f),
+		parameterNames{}.
+			add("ProjectionExpression", input.ProjectionExpression != nil).
+			add("ExpressionAttributeNames", len(input.ExpressionAttributeNames) != 0))
 	if err != nil || !f {
 		return input, err
 	}
@@ -46,6 +55,17 @@ func translateLegacyGetItemInput(input *dynamodb.GetItemInput) (*dynamodb.GetIte
 
 func translateLegacyPutItemInput(input *dynamodb.PutItemInput) (*dynamodb.PutItemInput, error) {
 	f, err := hasExpected(input.Expected, input.ConditionExpression)
+	if err != nil {
+		return input, err
+	}
+	err = checkMixedParameters(
+		parameterNames{}.
+			add("Expected", f).
+			add("ConditionalOperator", input.ConditionalOperator != nil),
+		parameterNames{}.
+			add("ConditionExpression", input.ConditionExpression != nil).
+			add("ExpressionAttributeNames", len(input.ExpressionAttributeNames) != 0).
+			add("ExpressionAttributeValues", len(input.ExpressionAttributeValues) != 0))
 	if err != nil || !f {
 		return input, err
 	}
@@ -63,6 +83,17 @@ func translateLegacyPutItemInput(input *dynamodb.PutItemInput) (*dynamodb.PutIte
 
 func translateLegacyDeleteItemInput(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemInput, error) {
 	f, err := hasExpected(input.Expected, input.ConditionExpression)
+	if err != nil {
+		return input, err
+	}
+	err = checkMixedParameters(
+		parameterNames{}.
+			add("Expected", f).
+			add("ConditionalOperator", input.ConditionalOperator != nil),
+		parameterNames{}.
+			add("ConditionExpression", input.ConditionExpression != nil).
+			add("ExpressionAttributeNames", len(input.ExpressionAttributeNames) != 0).
+			add("ExpressionAttributeValues", len(input.ExpressionAttributeValues) != 0))
 	if err != nil || !f {
 		return input, err
 	}
@@ -87,6 +118,19 @@ func translateLegacyUpdateItemInput(input *dynamodb.UpdateItemInput) (*dynamodb.
 	if err != nil {
 		return input, err
 	}
+	err = checkMixedParameters(
+		parameterNames{}.
+			add("AttributeUpdates", uf).
+			add("Expected", cf).
+			add("ConditionalOperator", input.ConditionalOperator != nil),
+		parameterNames{}.
+			add("UpdateExpression", input.UpdateExpression != nil).
+			add("ConditionExpression", input.ConditionExpression != nil).
+			add("ExpressionAttributeNames", len(input.ExpressionAttributeNames) != 0).
+			add("ExpressionAttributeValues", len(input.ExpressionAttributeValues) != 0))
+	if err != nil {
+		return input, err
+	}
 	if !uf && !cf {
 		return input, nil
 	}
@@ -98,7 +142,6 @@ func translateLegacyUpdateItemInput(input *dynamodb.UpdateItemInput) (*dynamodb.
 		if err != nil {
 			return input, err
 		}
-		output.ConditionalOperator = nil
 		output.Expected = nil
 	}
 	if uf {
@@ -109,6 +152,8 @@ func translateLegacyUpdateItemInput(input *dynamodb.UpdateItemInput) (*dynamodb.
 		}
 		output.AttributeUpdates = nil
 	}
+	// ConditionalOperator only applies to the legacy parameters, which are all translated now
+	output.ConditionalOperator = nil
 	return output, nil
 }
 
@@ -121,6 +166,19 @@ func translateLegacyScanInput(input *dynamodb.ScanInput) (*dynamodb.ScanInput, e
 	if err != nil {
 		return input, err
 	}
+	err = checkMixedParameters(
+		parameterNames{}.
+			add("AttributesToGet", pf).
+			add("ScanFilter", cf).
+			add("ConditionalOperator", input.ConditionalOperator != nil),
+		parameterNames{}.
+			add("ProjectionExpression", input.ProjectionExpression != nil).
+			add("FilterExpression", input.FilterExpression != nil).
+			add("ExpressionAttributeNames", len(input.ExpressionAttributeNames) != 0).
+			add("ExpressionAttributeValues", len(input.ExpressionAttributeValues) != 0))
+	if err != nil {
+		return input, err
+	}
 	if !pf && !cf {
 		return input, nil
 	}
@@ -140,10 +198,11 @@ func translateLegacyScanInput(input *dynamodb.ScanInput) (*dynamodb.ScanInput, e
 		if err != nil {
 			return input, err
 		}
-		output.ConditionalOperator = nil
 		output.ScanFilter = nil
 	}
 
+	// ConditionalOperator only applies to the legacy parameters, which are all translated now
+	output.ConditionalOperator = nil
 	return output, nil
 }
 
@@ -160,6 +219,21 @@ func translateLegacyQueryInput(input *dynamodb.QueryInput) (*dynamodb.QueryInput
 	if err != nil {
 		return input, err
 	}
+	err = checkMixedParameters(
+		parameterNames{}.
+			add("AttributesToGet", pf).
+			add("KeyConditions", kf).
+			add("QueryFilter", ff).
+			add("ConditionalOperator", input.ConditionalOperator != nil),
+		parameterNames{}.
+			add("ProjectionExpression", input.ProjectionExpression != nil).
+			add("KeyConditionExpression", input.KeyConditionExpression != nil).
+			add("FilterExpression", input.FilterExpression != nil).
+			add("ExpressionAttributeNames", len(input.ExpressionAttributeNames) != 0).
+			add("ExpressionAttributeValues", len(input.ExpressionAttributeValues) != 0))
+	if err != nil {
+		return input, err
+	}
 	if !pf && !ff && !kf {
 		return input, nil
 	}
@@ -179,7 +253,6 @@ func translateLegacyQueryInput(input *dynamodb.QueryInput) (*dynamodb.QueryInput
 		if err != nil {
 			return input, err
 		}
-		output.ConditionalOperator = nil
 		output.QueryFilter = nil
 	}
 	if kf {
@@ -191,6 +264,8 @@ func translateLegacyQueryInput(input *dynamodb.QueryInput) (*dynamodb.QueryInput
 		output.KeyConditions = nil
 	}
 
+	// ConditionalOperator only applies to the legacy parameters, which are all translated now
+	output.ConditionalOperator = nil
 	return output, nil
 }
 
@@ -199,20 +274,34 @@ func translateLegacyBatchGetItemInput(input *dynamodb.BatchGetItemInput) (*dynam
 		return input, nil
 	}
 
-	for _, kaas := range input.RequestItems {
+	output := *input
+	output.RequestItems = make(map[string]*dynamodb.KeysAndAttributes, len(input.RequestItems))
+	for table, kaas := range input.RequestItems {
+		output.RequestItems[table] = kaas
 		f, err := hasAttributesToGet(kaas.AttributesToGet, kaas.ProjectionExpression)
 		if err != nil {
 			return input, err
 		}
+		err = checkMixedParameters(
+			parameterNames{}.
+				add("AttributesToGet", f),
+			parameterNames{}.
+				add("ProjectionExpression", kaas.ProjectionExpression != nil).
+				add("ExpressionAttributeNames", len(kaas.ExpressionAttributeNames) != 0))
+		if err != nil {
+			return input, err
+		}
 		if !f {
 			continue
 		}
-		kaas.ProjectionExpression, kaas.ExpressionAttributeNames, err = translateAttributesToGet(kaas.AttributesToGet, kaas.ExpressionAttributeNames)
+		translated := *kaas
+		translated.ProjectionExpression, translated.ExpressionAttributeNames, err = translateAttributesToGet(kaas.AttributesToGet, kaas.ExpressionAttributeNames)
 		if err != nil {
 			return input, err
 		}
+		output.RequestItems[table] = &translated
 	}
-	return input, nil
+	return &output, nil
 }
 
 func hasAttributesToGet(a []*string, p *string) (bool, error) {
@@ -251,6 +340,26 @@ func hasFilter(c map[string]*dynamodb.Condition, e *string) (bool, error) {
 	return cf, nil
 }
 
+// parameterNames collects the names of the parameters set on a request.
+type parameterNames []string
+
+func (p parameterNames) add(name string, set bool) parameterNames {
+	if set {
+		return append(p, name)
+	}
+	return p
+}
+
+// checkMixedParameters rejects requests that use both legacy and expression parameters, as DynamoDB does.
+func checkMixedParameters(legacy, expression parameterNames) error {
+	if len(legacy) == 0 || len(expression) == 0 {
+		return nil
+	}
+	return awserr.New(ErrCodeValidationException,
+		fmt.Sprintf("Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {%s} Expression parameters: {%s}",
+			strings.Join(legacy, ", "), strings.Join(expression, ", ")), nil)
+}
+
 func translateAttributesToGet(attrs []*string, subs map[string]*string) (*string, map[string]*string, error) {
 	out, sub := appendAttributeNames(nil, attrs, subs)
 	return aws.String(string(out)), sub, nil
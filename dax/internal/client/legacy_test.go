@@ -18,6 +18,7 @@ package client
 import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"reflect"
 	"testing"
@@ -267,6 +268,20 @@ func TestTranslateLegacyPositive(t *testing.T) {
 				},
 			},
 		},
+		{
+			&dynamodb.DeleteItemInput{
+				ConditionalOperator: aws.String(dynamodb.ConditionalOperatorOr),
+				Expected: map[string]*dynamodb.ExpectedAttributeValue{
+					"a": {ComparisonOperator: aws.String(dynamodb.ComparisonOperatorIn),
+						AttributeValueList: []*dynamodb.AttributeValue{{N: aws.String("5")}, {N: aws.String("6")}}},
+				},
+			},
+			&dynamodb.DeleteItemInput{
+				ConditionExpression:       aws.String("#key0 in (:val0,:val1)"),
+				ExpressionAttributeNames:  map[string]*string{"#key0": aws.String("a")},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":val0": {N: aws.String("5")}, ":val1": {N: aws.String("6")}},
+			},
+		},
 		{
 			&dynamodb.ScanInput{
 				AttributesToGet:     []*string{aws.String("a1"), aws.String("a2")},
@@ -451,6 +466,63 @@ func TestTranslateLegacyNegative(t *testing.T) {
 			},
 			awserr.New(ErrCodeValidationException, "Unsupported operator on KeyCondition: CONTAINS", nil),
 		},
+		{
+			&dynamodb.GetItemInput{
+				AttributesToGet:          []*string{aws.String("a1")},
+				ExpressionAttributeNames: map[string]*string{"#a": aws.String("a1")},
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {AttributesToGet} Expression parameters: {ExpressionAttributeNames}", nil),
+		},
+		{
+			&dynamodb.PutItemInput{
+				ConditionalOperator: aws.String(dynamodb.ConditionalOperatorAnd),
+				ConditionExpression: aws.String("attribute_exists(a)"),
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {ConditionalOperator} Expression parameters: {ConditionExpression}", nil),
+		},
+		{
+			&dynamodb.DeleteItemInput{
+				Expected:                  map[string]*dynamodb.ExpectedAttributeValue{"a": {Exists: aws.Bool(false)}},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":v": {N: aws.String("5")}},
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {Expected} Expression parameters: {ExpressionAttributeValues}", nil),
+		},
+		{
+			&dynamodb.UpdateItemInput{
+				UpdateExpression: aws.String("set a = :v"),
+				Expected:         map[string]*dynamodb.ExpectedAttributeValue{"a": {Exists: aws.Bool(false)}},
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {Expected} Expression parameters: {UpdateExpression}", nil),
+		},
+		{
+			&dynamodb.ScanInput{
+				ScanFilter:           map[string]*dynamodb.Condition{"a": {ComparisonOperator: aws.String(dynamodb.ComparisonOperatorNotNull)}},
+				ProjectionExpression: aws.String("a"),
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {ScanFilter} Expression parameters: {ProjectionExpression}", nil),
+		},
+		{
+			&dynamodb.QueryInput{
+				QueryFilter:            map[string]*dynamodb.Condition{"a": {ComparisonOperator: aws.String(dynamodb.ComparisonOperatorNotNull)}},
+				ConditionalOperator:    aws.String(dynamodb.ConditionalOperatorOr),
+				KeyConditionExpression: aws.String("k = :k"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":k": {S: aws.String("abc")},
+				},
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {QueryFilter, ConditionalOperator} Expression parameters: {KeyConditionExpression, ExpressionAttributeValues}", nil),
+		},
+		{
+			&dynamodb.BatchGetItemInput{
+				RequestItems: map[string]*dynamodb.KeysAndAttributes{
+					"table1": {
+						AttributesToGet:          []*string{aws.String("a1")},
+						ExpressionAttributeNames: map[string]*string{"#a": aws.String("a1")},
+					},
+				},
+			},
+			awserr.New(ErrCodeValidationException, "Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {AttributesToGet} Expression parameters: {ExpressionAttributeNames}", nil),
+		},
 	}
 
 	for _, c := range cases {
@@ -462,3 +534,53 @@ func TestTranslateLegacyNegative(t *testing.T) {
 		}
 	}
 }
+
+func TestTranslateLegacyTwice(t *testing.T) {
+	// a retried request translates its input again
+	inputs := []interface{}{
+		&dynamodb.GetItemInput{AttributesToGet: []*string{aws.String("a1")}},
+		&dynamodb.PutItemInput{Expected: map[string]*dynamodb.ExpectedAttributeValue{"a": {Exists: aws.Bool(false)}}},
+		&dynamodb.QueryInput{
+			ConditionalOperator: aws.String(dynamodb.ConditionalOperatorOr),
+			QueryFilter:         map[string]*dynamodb.Condition{"a": {ComparisonOperator: aws.String(dynamodb.ComparisonOperatorNotNull)}},
+			KeyConditions: map[string]*dynamodb.Condition{
+				"k": {ComparisonOperator: aws.String(dynamodb.ComparisonOperatorEq), AttributeValueList: []*dynamodb.AttributeValue{{S: aws.String("abc")}}},
+			},
+		},
+		&dynamodb.ScanInput{
+			AttributesToGet:     []*string{aws.String("a1")},
+			ConditionalOperator: aws.String(dynamodb.ConditionalOperatorAnd),
+		},
+		&dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				"table1": {AttributesToGet: []*string{aws.String("a1")}},
+			},
+		},
+	}
+
+	for _, inp := range inputs {
+		fn := reflect.ValueOf(functions[reflect.TypeOf(inp)])
+		for i := 0; i < 2; i++ {
+			out := fn.Call([]reflect.Value{reflect.ValueOf(inp)})
+			if err := out[1].Interface(); err != nil {
+				t.Errorf("unexpected error %v on attempt %d for %T", err, i, inp)
+			}
+		}
+	}
+}
+
+func TestTranslateLegacyBatchGetItemKeepsInput(t *testing.T) {
+	inp := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			"table1": {AttributesToGet: []*string{aws.String("a1")}},
+			"table2": {ProjectionExpression: aws.String("a2")},
+		},
+	}
+	before := awsutil.CopyOf(inp)
+	if _, err := translateLegacyBatchGetItemInput(inp); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(before, inp) {
+		t.Errorf("expected input to be left unchanged, got %v", inp)
+	}
+}
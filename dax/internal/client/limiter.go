@@ -0,0 +1,91 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Limits the number of concurrent requests of a client.
+// A nil limiter does not limit anything.
+type requestLimiter struct {
+	inFlight int64 // accessed atomically
+	rejected int64 // accessed atomically
+
+	// Represents a semaphore, being a channel it must be initialized with the limit as the buffer size.
+	permits chan struct{}
+	timeout time.Duration
+	clock   clock
+}
+
+// Returns a limiter allowing up to max concurrent requests, waiting up to timeout for a permit.
+// Returns nil if max isn't positive.
+func newRequestLimiter(max int, timeout time.Duration, clk clock) *requestLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &requestLimiter{permits: make(chan struct{}, max), timeout: timeout, clock: clockOrSystem(clk)}
+}
+
+// Acquires a permit, waiting up to the limiter timeout if none is available.
+// Returns ErrOverloaded if no permit could be acquired in time or ctx error if ctx is done first.
+// release must be called once the request completes.
+func (l *requestLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.permits <- struct{}{}:
+		atomic.AddInt64(&l.inFlight, 1)
+		return nil
+	default:
+	}
+
+	if l.timeout > 0 {
+		timer := l.clock.NewTimer(l.timeout)
+		defer timer.Stop()
+		select {
+		case l.permits <- struct{}{}:
+			atomic.AddInt64(&l.inFlight, 1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+	atomic.AddInt64(&l.rejected, 1)
+	return ErrOverloaded
+}
+
+// Returns a permit acquired with acquire.
+func (l *requestLimiter) release() {
+	if l == nil {
+		return
+	}
+	atomic.AddInt64(&l.inFlight, -1)
+	<-l.permits
+}
+
+// Adds the limiter counters to s.
+func (l *requestLimiter) stats(s *Stats) {
+	if l == nil {
+		return
+	}
+	s.InFlightRequests += atomic.LoadInt64(&l.inFlight)
+	s.RejectedRequests += atomic.LoadInt64(&l.rejected)
+}
@@ -0,0 +1,75 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// repeatedLogInterval is the interval between the summaries of a repeated log
+// line.
+const repeatedLogInterval = time.Minute
+
+// Suppresses the repeats of an identical log line, such as the connection
+// error of a node that is down: the first occurrence is logged, then a summary
+// of its repeats at most once per repeatedLogInterval, until a different line
+// is logged or reset is called. A nil repeatedLog suppresses nothing.
+type repeatedLog struct {
+	clock clock
+
+	lock    sync.Mutex
+	last    string    // protected by lock
+	repeats int       // suppressed since logged, protected by lock
+	logged  time.Time // when last or its summary was logged, protected by lock
+}
+
+func newRepeatedLog(clk clock) *repeatedLog {
+	return &repeatedLog{clock: clockOrSystem(clk)}
+}
+
+// Returns the line to log for line: line itself, a summary of its repeats, or
+// the empty string if it must be suppressed.
+func (l *repeatedLog) filter(line string) string {
+	if l == nil {
+		return line
+	}
+	now := l.clock.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if line != l.last {
+		l.last, l.repeats, l.logged = line, 0, now
+		return line
+	}
+	l.repeats++
+	if now.Sub(l.logged) < repeatedLogInterval {
+		return ""
+	}
+	repeats := l.repeats
+	l.repeats, l.logged = 0, now
+	return fmt.Sprintf("%s (repeated %d times in the last minute)", line, repeats)
+}
+
+// Forgets the last line, once the condition it reported is over.
+func (l *repeatedLog) reset() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	l.last, l.repeats = "", 0
+	l.lock.Unlock()
+}
@@ -0,0 +1,85 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTubePool_repeatedConnectionErrors(t *testing.T) {
+	clk := newFakeClock()
+	down := true
+	pool := newTubePoolWithOptions(":9121", tubePoolOptions{1, time.Second, func(ctx context.Context, network, address string) (net.Conn, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return &mockConn{}, nil
+	}}, connConfig{clock: clk})
+	defer pool.Close()
+	var logs []string
+	opt := RequestOptions{Logger: aws.LoggerFunc(func(args ...interface{}) { logs = append(logs, fmt.Sprint(args...)) }), LogLevel: aws.LogDebug}
+
+	// the node is down for an hour, with an attempt to connect every second
+	for i := 0; i < 3600; i++ {
+		_, err := pool.alloc(0, opt)
+		require.Error(t, err)
+		clk.Advance(time.Second)
+	}
+	require.Len(t, logs, 60)
+	require.Equal(t, "DEBUG: Error in establishing connection to address :9121 : connection refused", logs[0])
+	for _, log := range logs[1:] {
+		require.True(t, strings.HasSuffix(log, "connection refused (repeated 60 times in the last minute)"), "unexpected log %q", log)
+	}
+	require.Equal(t, int64(3600), pool.stats().ConnectionErrors)
+
+	// the first error after the node recovered is logged again
+	down = false
+	tube, err := pool.alloc(0, opt)
+	require.NoError(t, err)
+	tube.Close()
+	down = true
+	_, err = pool.alloc(0, opt)
+	require.Error(t, err)
+	require.Len(t, logs, 61)
+	require.Equal(t, logs[0], logs[60])
+	require.Equal(t, int64(3601), pool.stats().ConnectionErrors)
+}
+
+func TestRepeatedLog(t *testing.T) {
+	clk := newFakeClock()
+	l := newRepeatedLog(clk)
+	require.Equal(t, "a", l.filter("a"))
+	require.Equal(t, "", l.filter("a"))
+	require.Equal(t, "b", l.filter("b"), "a different line is logged")
+	clk.Advance(30 * time.Second)
+	require.Equal(t, "", l.filter("b"))
+	clk.Advance(30 * time.Second)
+	require.Equal(t, "b (repeated 2 times in the last minute)", l.filter("b"))
+	require.Equal(t, "", l.filter("b"))
+
+	var none *repeatedLog
+	require.Equal(t, "a", none.filter("a"))
+	require.Equal(t, "a", none.filter("a"))
+}
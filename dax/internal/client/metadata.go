@@ -0,0 +1,100 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gofrs/uuid"
+)
+
+// ResponseMetadata describes how a request of a ClusterDaxClient was served.
+type ResponseMetadata struct {
+	// Op is the name of the operation, such as GetItem.
+	Op string
+	// CorrelationID is an identifier generated by the client for the request.
+	// It is also written to the debug logs of the request, and is the
+	// CorrelationID of the RequestError of a failed request, see
+	// Config.DetailedErrors.
+	CorrelationID string
+	// Node is the "host:port" address of the node of the last attempt, or the
+	// empty string if no node was picked.
+	Node string
+	// AZ is the availability zone of Node, or the empty string if the cluster
+	// did not report it.
+	AZ string
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Elapsed is the time elapsed from the start of the request to its
+	// completion, retries included.
+	Elapsed time.Duration
+	// RequestID is the request ID returned by the cluster with the error of
+	// the last attempt, if any. Successful responses of DAX carry none.
+	RequestID string
+}
+
+type responseMetadataKey struct{}
+
+// WithResponseMetadata returns a copy of ctx such that the requests of a
+// ClusterDaxClient made with it fill md once they complete, successfully or
+// not. Requests made before any attempt, e.g. of a closed client, do not.
+func WithResponseMetadata(ctx aws.Context, md *ResponseMetadata) aws.Context {
+	if ctx == nil {
+		ctx = aws.BackgroundContext()
+	}
+	return context.WithValue(ctx, responseMetadataKey{}, md)
+}
+
+// Returns a new correlation ID, or the empty string if none could be generated.
+func newCorrelationID() string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return ""
+	}
+	return id.String()
+}
+
+// Fills the ResponseMetadata of the context of the request of op, if any, with
+// md completed by err and logs the completion of the request at debug level.
+// correlationID is only called if the ID is reported.
+func completeRequest(op string, opt RequestOptions, md ResponseMetadata, err error, correlationID func() string) {
+	var dst *ResponseMetadata
+	if opt.Context != nil {
+		dst, _ = opt.Context.Value(responseMetadataKey{}).(*ResponseMetadata)
+	}
+	debug := opt.Logger != nil && opt.LogLevel.AtLeast(aws.LogDebug)
+	if dst == nil && !debug {
+		return
+	}
+	md.CorrelationID = correlationID()
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		md.RequestID = rf.RequestID()
+	}
+	if dst != nil {
+		*dst = md
+	}
+	if debug {
+		if err != nil {
+			opt.Logger.Log(fmt.Sprintf("DEBUG: Request %s/%s %s failed on %s after %d attempts : %s", service, op, md.CorrelationID, md.Node, md.Attempts, err))
+		} else {
+			opt.Logger.Log(fmt.Sprintf("DEBUG: Request %s/%s %s served by %s after %d attempts", service, op, md.CorrelationID, md.Node, md.Attempts))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterDaxClient_ResponseMetadata(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{address: net.IPv4(127, 0, 0, 1).To4(), port: 8121}})
+	cc := ClusterDaxClient{config: DefaultConfig(), cluster: cluster}
+	var logs []string
+	logger := aws.LoggerFunc(func(args ...interface{}) { logs = append(logs, fmt.Sprint(args...)) })
+
+	calls := 0
+	action := func(client DaxAPI, o RequestOptions) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	}
+	var md ResponseMetadata
+	opt := RequestOptions{Context: WithResponseMetadata(context.Background(), &md), MaxRetries: 2, RetryDelay: 1, Logger: logger, LogLevel: aws.LogDebugWithRequestRetries}
+	require.NoError(t, cc.retry(OpGetItem, action, opt))
+	require.NotEmpty(t, md.CorrelationID)
+	require.Equal(t, "127.0.0.1:8121", md.Node)
+	require.Equal(t, 2, md.Attempts)
+	require.Equal(t, OpGetItem, md.Op)
+	require.Empty(t, md.RequestID)
+	require.NotEmpty(t, logs)
+	for _, log := range logs {
+		require.Contains(t, log, md.CorrelationID)
+	}
+
+	// a failed request also fills the metadata, matching its RequestError
+	action = func(client DaxAPI, o RequestOptions) error {
+		return newDaxRequestFailure([]int{4, 23, 24}, "", "not found", "rid", 400)
+	}
+	var failed ResponseMetadata
+	logs = nil
+	opt.Context = WithResponseMetadata(context.Background(), &failed)
+	cc.config.DetailedErrors = true
+	err := cc.retry(OpGetItem, action, opt)
+	rerr, ok := err.(*RequestError)
+	require.True(t, ok, "expected a *RequestError, got %T", err)
+	require.Equal(t, ResponseMetadata{Op: OpGetItem, CorrelationID: rerr.CorrelationID, Node: "127.0.0.1:8121", Attempts: 1, Elapsed: rerr.Elapsed, RequestID: "rid"}, failed)
+	require.NotEqual(t, md.CorrelationID, failed.CorrelationID)
+	require.Contains(t, err.Error(), failed.CorrelationID)
+	require.True(t, len(logs) == 1 && strings.Contains(logs[0], failed.CorrelationID), "expected the correlation ID logged, got %v", logs)
+}
+
+func TestRequestOptions_MergeResponseMetadata(t *testing.T) {
+	var md ResponseMetadata
+	withMetadata := func(r *request.Request) {
+		r.SetContext(WithResponseMetadata(r.Context(), &md))
+	}
+	o := RequestOptions{}
+	require.NoError(t, o.MergeFromRequestOptions(context.Background(), withMetadata))
+	require.Equal(t, &md, o.Context.Value(responseMetadataKey{}))
+}
@@ -0,0 +1,247 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+)
+
+const (
+	pipelineRequestQueued int32 = iota
+	pipelineRequestWritten
+	pipelineRequestAbandoned
+)
+
+// A connection shared by concurrent requests.
+// A writer goroutine writes queued requests back-to-back and a reader goroutine
+// matches responses, which the server sends in request order, to their callers.
+// Up to depth requests are written before their responses are read.
+type pipeline struct {
+	client *SingleDaxClient
+	t      tube
+
+	queue   chan *pipelineRequest // requests waiting to be written
+	pending chan *pipelineRequest // requests written and waiting for a response
+	slots   chan struct{}         // semaphore bounding the number of pending requests
+
+	done     chan struct{} // closed once the pipeline failed or was closed
+	released chan struct{} // closed once the reader and writer exited and the tube was released
+	once     sync.Once
+	err      error // reason of failure, set before done is closed
+	discard  bool  // whether the tube must be discarded rather than closed, set before done is closed
+}
+
+type pipelineRequest struct {
+	op      string
+	encoder func(writer *cbor.Writer) error
+	decoder func(reader *cbor.Reader) error
+	state   int32 // accessed atomically
+	result  chan error
+}
+
+// Starts a pipeline over the tube. The pipeline owns the tube from now on.
+func newPipeline(client *SingleDaxClient, t tube, depth int) *pipeline {
+	p := &pipeline{
+		client:   client,
+		t:        t,
+		queue:    make(chan *pipelineRequest, depth),
+		pending:  make(chan *pipelineRequest, depth),
+		slots:    make(chan struct{}, depth),
+		done:     make(chan struct{}),
+		released: make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.writeLoop()
+	}()
+	go func() {
+		defer wg.Done()
+		p.readLoop()
+	}()
+	go func() {
+		wg.Wait()
+		if p.discard {
+			p.client.pool.discard(p.t)
+		} else {
+			p.t.Close()
+		}
+		close(p.released)
+	}()
+	return p
+}
+
+// Sends the request and waits for its response.
+// Returns ctx error if ctx is done first. A request abandoned before being written is never sent.
+func (p *pipeline) execute(ctx context.Context, op string, encoder func(writer *cbor.Writer) error, decoder func(reader *cbor.Reader) error) error {
+	r := &pipelineRequest{op: op, encoder: encoder, decoder: decoder, result: make(chan error, 1)}
+	select {
+	case p.queue <- r:
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-r.result:
+		return err
+	case <-p.done:
+		select {
+		case err := <-r.result:
+			return err
+		default:
+			return p.err
+		}
+	case <-ctx.Done():
+		if !atomic.CompareAndSwapInt32(&r.state, pipelineRequestQueued, pipelineRequestAbandoned) {
+			// the request was already written and the connection has no read deadline,
+			// fail the pipeline rather than wait on a peer that may never respond
+			p.fail(ctx.Err())
+		}
+		return ctx.Err()
+	}
+}
+
+func (p *pipeline) writeLoop() {
+	writer := p.t.CborWriter()
+	unflushed := false
+	// requests are written back-to-back and flushed only before the writer would block
+	flush := func() bool {
+		if unflushed {
+			if err := writer.Flush(); err != nil {
+				p.fail(err)
+				return false
+			}
+			unflushed = false
+		}
+		return true
+	}
+	for {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			if !flush() {
+				return
+			}
+			select {
+			case p.slots <- struct{}{}:
+			case <-p.done:
+				return
+			}
+		}
+
+		var r *pipelineRequest
+		select {
+		case r = <-p.queue:
+		default:
+			if !flush() {
+				return
+			}
+			select {
+			case r = <-p.queue:
+			case <-p.done:
+				return
+			}
+		}
+		if !atomic.CompareAndSwapInt32(&r.state, pipelineRequestQueued, pipelineRequestWritten) {
+			<-p.slots // abandoned
+			continue
+		}
+
+		err := p.client.auth(p.t)
+		if err == nil {
+			err = p.client.captureRequest(r.op, r.encoder)(writer)
+		}
+		if err != nil {
+			// the request may be partially written
+			r.result <- err
+			p.fail(err)
+			return
+		}
+		unflushed = true
+		p.pending <- r // never blocks, bounded by slots
+	}
+}
+
+func (p *pipeline) readLoop() {
+	reader := p.t.CborReader()
+	for {
+		var r *pipelineRequest
+		select {
+		case r = <-p.pending:
+		case <-p.done:
+			return
+		}
+		ex, err := decodeError(reader)
+		if err == nil && ex == nil {
+			err = r.decoder(reader)
+		}
+		p.client.captureResponse(r.op, p.t)
+		if err != nil {
+			p.fail(err)
+			r.result <- p.err
+			return
+		}
+		r.result <- ex
+		if ex != nil {
+			// IO streams are guaranteed to be completely drained only on daxRequestException,
+			// and authentication failures require a new connection.
+			if d, ok := ex.(*daxRequestFailure); !ok || d.authError() {
+				p.fail(ex)
+				return
+			}
+		}
+		<-p.slots
+	}
+}
+
+// Fails all queued and pending requests with a retryable error and discards the tube.
+func (p *pipeline) fail(cause error) {
+	p.shutdown(WrapError(ErrCodeConnectionFailed, "pipelined connection failed", cause), true)
+}
+
+// Closes the pipeline and waits for its goroutines to exit.
+func (p *pipeline) Close() error {
+	p.shutdown(ErrClientClosed, false)
+	<-p.released
+	return nil
+}
+
+func (p *pipeline) shutdown(err error, discard bool) {
+	p.once.Do(func() {
+		p.err = err
+		p.discard = discard
+		close(p.done)
+		// unblock any I/O of the reader and writer, the tube is released once they exit
+		p.t.SetDeadline(aLongTimeAgo)
+	})
+}
+
+// Returns true if the pipeline can no longer be used.
+func (p *pipeline) failed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
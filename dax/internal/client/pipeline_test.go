@@ -0,0 +1,294 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+const echoMethodId = 1
+
+// Starts a server answering echo requests with their argument.
+// respond is called before each response with the index of the connection and the echoed value,
+// returning false closes the connection without responding.
+func startEchoServer(t testing.TB, respond func(conn int, v int) bool) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveEcho(conn, n, respond)
+		}
+	}()
+	return listener
+}
+
+func serveEcho(conn net.Conn, n int, respond func(conn int, v int) bool) {
+	defer conn.Close()
+	r := cbor.NewReader(conn)
+	defer r.Close()
+	bw := bufio.NewWriter(conn)
+	w := cbor.NewWriter(bw)
+	defer w.Close()
+	if err := skipHandshake(r); err != nil {
+		return
+	}
+	for {
+		if _, err := r.ReadInt(); err != nil { // service id
+			return
+		}
+		method, err := r.ReadInt()
+		if err != nil {
+			return
+		}
+		switch method {
+		case authorizeConnection_1489122155_1_Id:
+			if err := skipAuth(r); err != nil {
+				return
+			}
+		case echoMethodId:
+			v, err := r.ReadInt()
+			if err != nil {
+				return
+			}
+			if respond != nil && !respond(n, v) {
+				return
+			}
+			w.WriteArrayHeader(0)
+			w.WriteInt(v)
+			// flush only once all requests received so far were answered
+			if r.Buffered() == 0 {
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+func echo(cli *SingleDaxClient, ctx context.Context, v int) (int, error) {
+	var out int
+	err := cli.executeWithContext(ctx, OpGetItem, func(writer *cbor.Writer) error {
+		if err := encodeServiceAndMethod(echoMethodId, writer); err != nil {
+			return err
+		}
+		return writer.WriteInt(v)
+	}, func(reader *cbor.Reader) error {
+		var err error
+		out, err = reader.ReadInt()
+		return err
+	}, RequestOptions{})
+	return out, err
+}
+
+func newPipelinedTestClient(t testing.TB, address string, depth int, dials *int32) *SingleDaxClient {
+	cc := connConfigData
+	cc.pipelineDepth = depth
+	dialFn := func(ctx context.Context, network, address string) (net.Conn, error) {
+		if dials != nil {
+			atomic.AddInt32(dials, 1)
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(address, cc, "us-west-2", creds, 10, dialFn)
+	require.NoError(t, err)
+	return cli
+}
+
+func TestPipeline_Ordering(t *testing.T) {
+	listener := startEchoServer(t, nil)
+	defer listener.Close()
+	var dials int32
+	cli := newPipelinedTestClient(t, listener.Addr().String(), 8, &dials)
+	defer cli.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(v int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				ctx, cfn := context.WithTimeout(context.Background(), 5*time.Second)
+				out, err := echo(cli, ctx, v*100+j)
+				cfn()
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+					return
+				}
+				if out != v*100+j {
+					t.Errorf("expected %d, got %d", v*100+j, out)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&dials), "expected all requests on a single connection")
+}
+
+func TestPipeline_CancelQueuedRequest(t *testing.T) {
+	release := make(chan struct{})
+	var received int32
+	listener := startEchoServer(t, func(conn int, v int) bool {
+		atomic.AddInt32(&received, 1)
+		if v == 1 {
+			<-release
+		}
+		return true
+	})
+	defer listener.Close()
+	cli := newPipelinedTestClient(t, listener.Addr().String(), 1, nil)
+	defer cli.Close()
+
+	first := make(chan error)
+	go func() {
+		_, err := echo(cli, context.Background(), 1)
+		first <- err
+	}()
+	for atomic.LoadInt32(&received) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the pipeline is full, the second request stays queued until canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := echo(cli, ctx, 2)
+	require.Equal(t, context.Canceled, err)
+	require.True(t, time.Since(start) < time.Second)
+
+	close(release)
+	require.NoError(t, <-first)
+
+	out, err := echo(cli, context.Background(), 3)
+	require.NoError(t, err)
+	require.Equal(t, 3, out)
+	require.Equal(t, int32(2), atomic.LoadInt32(&received), "canceled request must not be sent")
+}
+
+func TestPipeline_ConnectionFailure(t *testing.T) {
+	received := make(chan struct{}, 10)
+	listener := startEchoServer(t, func(conn int, v int) bool {
+		if conn == 0 {
+			received <- struct{}{}
+			if v == 3 {
+				return false // break the first connection mid-stream
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return true
+	})
+	defer listener.Close()
+	cli := newPipelinedTestClient(t, listener.Addr().String(), 4, nil)
+	defer cli.Close()
+
+	p, err := cli.pipeline(context.Background(), OpGetItem, RequestOptions{})
+	require.NoError(t, err)
+
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		v := i
+		go func() {
+			_, err := echo(cli, context.Background(), v)
+			errs <- err
+		}()
+	}
+	var failures int
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			failures++
+			aerr, ok := err.(awserr.Error)
+			require.True(t, ok, "expected awserr.Error, got %T %v", err, err)
+			require.Equal(t, ErrCodeConnectionFailed, aerr.Code())
+		}
+	}
+	require.True(t, failures > 0, "expected queued requests to fail")
+	require.True(t, p.failed())
+
+	// the next request starts a new pipeline
+	out, err := echo(cli, context.Background(), 42)
+	require.NoError(t, err)
+	require.Equal(t, 42, out)
+}
+
+func TestPipeline_StalledPeer(t *testing.T) {
+	stall := make(chan struct{})
+	defer close(stall)
+	listener := startEchoServer(t, func(conn int, v int) bool {
+		if conn == 0 {
+			<-stall // the first connection never responds
+		}
+		return true
+	})
+	defer listener.Close()
+	cli := newPipelinedTestClient(t, listener.Addr().String(), 4, nil)
+	defer cli.Close()
+
+	p, err := cli.pipeline(context.Background(), OpGetItem, RequestOptions{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = echo(cli, ctx, 1)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, p.failed(), "a written request timing out must fail the pipeline")
+
+	// the next request starts a new pipeline on a new connection
+	out, err := echo(cli, context.Background(), 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, out)
+}
+
+func benchmarkEcho(b *testing.B, depth int) {
+	listener := startEchoServer(b, nil)
+	defer listener.Close()
+	cli := newPipelinedTestClient(b, listener.Addr().String(), depth, nil)
+	defer cli.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := echo(cli, context.Background(), 1); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkEcho_Pooled(b *testing.B) {
+	benchmarkEcho(b, 0)
+}
+
+func BenchmarkEcho_Pipelined(b *testing.B) {
+	benchmarkEcho(b, 16)
+}
@@ -63,46 +63,42 @@ func buildDocumentPath(path string, expressionAttributeNames map[string]*string)
 		substitutes = expressionAttributeNames
 	}
 
+	invalid := awserr.New(request.InvalidParameterErrCode, "invalid path: "+path, nil)
 	res := strings.Split(path, ".")
 	var elements []documentPathElement
 
 	for _, re := range res {
+		re = strings.TrimSpace(re)
 		idx := strings.Index(re, "[")
 		if idx == -1 {
+			if re == "" || strings.Contains(re, "]") {
+				return documentPath{}, invalid
+			}
 			elements = append(elements, documentPathElementFromName(getOrDefault(substitutes, re, re)))
 			continue
 		}
 
-		if idx == 0 {
-			return documentPath{}, awserr.New(request.InvalidParameterErrCode, "invalid path: "+path, nil)
+		pre := strings.TrimSpace(re[0:idx])
+		if pre == "" {
+			return documentPath{}, invalid
 		}
-
-		pre := re[0:idx]
 		elements = append(elements, documentPathElementFromName(getOrDefault(substitutes, pre, pre)))
 
-		for idx != -1 {
-			re = re[idx+1:]
+		// any number of list indexes may follow the name, eg: "a[1][2]"
+		for re = re[idx:]; re != ""; re = strings.TrimSpace(re[idx+1:]) {
+			if re[0] != '[' {
+				return documentPath{}, invalid
+			}
 			idx = strings.Index(re, "]")
-
 			if idx == -1 {
-				return documentPath{}, awserr.New(request.InvalidParameterErrCode, "invalid path: "+path, nil)
+				return documentPath{}, invalid
 			}
 
-			lidx, err := strconv.Atoi(re[:idx])
-			if err != nil {
-				return documentPath{}, err
+			lidx, err := strconv.Atoi(strings.TrimSpace(re[1:idx]))
+			if err != nil || lidx < 0 {
+				return documentPath{}, invalid
 			}
 			elements = append(elements, documentPathElementFromIndex(lidx))
-
-			re = re[idx+1:]
-			idx = strings.Index(re, "[")
-			if idx > 0 {
-				return documentPath{}, awserr.New(request.InvalidParameterErrCode, "invalid path: "+path, nil)
-			}
-		}
-
-		if len(elements) == 0 {
-			return documentPath{}, awserr.New(request.InvalidParameterErrCode, "invalid path: "+path, nil)
 		}
 	}
 
@@ -127,6 +123,7 @@ func (in *itemNode) toAttribute() *dynamodb.AttributeValue {
 	if in == nil {
 		return nil
 	}
+	// a value projected at this node already contains anything projected beneath it, eg: "a, a.b"
 	if in.value != nil {
 		return in.value
 	}
@@ -161,6 +158,9 @@ type itemBuilder struct {
 }
 
 func (ib *itemBuilder) insert(path documentPath, value *dynamodb.AttributeValue) {
+	if value == nil {
+		return
+	}
 	if ib.root == nil {
 		var children map[documentPathElement]*itemNode
 		ib.root = &itemNode{children: children}
@@ -169,10 +169,10 @@ func (ib *itemBuilder) insert(path documentPath, value *dynamodb.AttributeValue)
 }
 
 func (ib *itemBuilder) toItem() map[string]*dynamodb.AttributeValue {
-	item := make(map[string]*dynamodb.AttributeValue)
 	if ib.root == nil {
-		return item
+		return make(map[string]*dynamodb.AttributeValue)
 	}
+	item := make(map[string]*dynamodb.AttributeValue, len(ib.root.children))
 
 	c := ib.root.children
 	for k, v := range c { // top level attribute names are strings
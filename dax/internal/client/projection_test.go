@@ -63,6 +63,26 @@ func TestBuildDocumentPath(t *testing.T) {
 				documentPathElement{name: "sub.field", index: -1},
 			}},
 		},
+		{
+			"a.#b[0][12].c.#d[3]", map[string]*string{"#b": aws.String("b"), "#d": aws.String("d")},
+			documentPath{[]documentPathElement{
+				documentPathElement{name: "a", index: -1},
+				documentPathElement{name: "b", index: -1},
+				documentPathElement{name: "", index: 0},
+				documentPathElement{name: "", index: 12},
+				documentPathElement{name: "c", index: -1},
+				documentPathElement{name: "d", index: -1},
+				documentPathElement{name: "", index: 3},
+			}},
+		},
+		{
+			" a . b [1] ", nil,
+			documentPath{[]documentPathElement{
+				documentPathElement{name: "a", index: -1},
+				documentPathElement{name: "b", index: -1},
+				documentPathElement{name: "", index: 1},
+			}},
+		},
 	}
 
 	for _, c := range cases {
@@ -76,6 +96,16 @@ func TestBuildDocumentPath(t *testing.T) {
 	}
 }
 
+func TestBuildDocumentPathErrors(t *testing.T) {
+	cases := []string{"", "a..b", "[0]", "a.[0]", "a[", "a[x]", "a[-1]", "a[0]b", "a[0].b]"}
+
+	for _, c := range cases {
+		if _, err := buildDocumentPath(c, nil); err == nil {
+			t.Errorf("expected error for %q", c)
+		}
+	}
+}
+
 func TestBuildProjectionOrdinals(t *testing.T) {
 	cases := []struct {
 		projectionExpression     string
@@ -264,6 +294,88 @@ func TestItemBuilder(t *testing.T) {
 				},
 			},
 		},
+		{
+			"a.b.c.d.e[1].f", nil,
+			map[int]*dynamodb.AttributeValue{
+				0: &dynamodb.AttributeValue{BOOL: aws.Bool(true)},
+			},
+			map[string]*dynamodb.AttributeValue{
+				"a": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+					"b": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+						"c": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+							"d": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+								"e": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{
+									&dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+										"f": &dynamodb.AttributeValue{BOOL: aws.Bool(true)},
+									}},
+								}},
+							}},
+						}},
+					}},
+				}},
+			},
+		},
+		{
+			// the item has no a[5], so nothing is returned for that ordinal
+			"a[0],a[5],#m.#k", map[string]*string{"#m": aws.String("m"), "#k": aws.String("k")},
+			map[int]*dynamodb.AttributeValue{
+				0: &dynamodb.AttributeValue{S: aws.String("av0")},
+				2: &dynamodb.AttributeValue{S: aws.String("mk")},
+			},
+			map[string]*dynamodb.AttributeValue{
+				"a": &dynamodb.AttributeValue{
+					L: []*dynamodb.AttributeValue{
+						&dynamodb.AttributeValue{S: aws.String("av0")},
+					},
+				},
+				"m": &dynamodb.AttributeValue{
+					M: map[string]*dynamodb.AttributeValue{
+						"k": &dynamodb.AttributeValue{S: aws.String("mk")},
+					},
+				},
+			},
+		},
+		{
+			"a[5]", nil,
+			map[int]*dynamodb.AttributeValue{
+				0: nil,
+			},
+			map[string]*dynamodb.AttributeValue{},
+		},
+		{
+			"a.b,a",
+			nil,
+			map[int]*dynamodb.AttributeValue{
+				0: &dynamodb.AttributeValue{S: aws.String("ab")},
+				1: &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+					"b": &dynamodb.AttributeValue{S: aws.String("ab")},
+					"c": &dynamodb.AttributeValue{S: aws.String("ac")},
+				}},
+			},
+			map[string]*dynamodb.AttributeValue{
+				"a": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+					"b": &dynamodb.AttributeValue{S: aws.String("ab")},
+					"c": &dynamodb.AttributeValue{S: aws.String("ac")},
+				}},
+			},
+		},
+		{
+			"a.b,a.c[1],a.b",
+			nil,
+			map[int]*dynamodb.AttributeValue{
+				0: &dynamodb.AttributeValue{S: aws.String("ab")},
+				1: &dynamodb.AttributeValue{S: aws.String("ac1")},
+				2: &dynamodb.AttributeValue{S: aws.String("ab")},
+			},
+			map[string]*dynamodb.AttributeValue{
+				"a": &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+					"b": &dynamodb.AttributeValue{S: aws.String("ab")},
+					"c": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{
+						&dynamodb.AttributeValue{S: aws.String("ac1")},
+					}},
+				}},
+			},
+		},
 	}
 
 	for _, c := range cases {
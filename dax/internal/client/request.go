@@ -16,8 +16,8 @@
 package client
 
 import (
-	"bytes"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 
@@ -144,6 +144,9 @@ const (
 
 const maxWriteBatchSize = 25
 
+// The longest client request token DynamoDB accepts for a transaction.
+const maxClientRequestTokenLength = 36
+
 func encodeEndpointsInput(writer *cbor.Writer) error {
 	if err := encodeServiceAndMethod(endpoints_455855874_1_Id, writer); err != nil {
 		return err
@@ -214,7 +217,7 @@ func encodeDefineKeySchemaInput(table string, writer *cbor.Writer) error {
 	return writer.WriteBytes([]byte(table))
 }
 
-func encodePutItemInput(ctx aws.Context, input *dynamodb.PutItemInput, keySchema *lru.Lru, attrNamesListToId *lru.Lru, writer *cbor.Writer) error {
+func encodePutItemInput(ctx aws.Context, input *dynamodb.PutItemInput, keySchema *lru.Lru, attrNamesListToId *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -246,10 +249,10 @@ func encodePutItemInput(ctx aws.Context, input *dynamodb.PutItemInput, keySchema
 	}
 
 	return encodeItemOperationOptionalParams(input.ReturnValues, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil,
-		nil, input.ConditionExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues, writer)
+		nil, input.ConditionExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues, expressions, writer)
 }
 
-func encodeDeleteItemInput(ctx aws.Context, input *dynamodb.DeleteItemInput, keySchema *lru.Lru, writer *cbor.Writer) error {
+func encodeDeleteItemInput(ctx aws.Context, input *dynamodb.DeleteItemInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -278,10 +281,10 @@ func encodeDeleteItemInput(ctx aws.Context, input *dynamodb.DeleteItemInput, key
 	}
 
 	return encodeItemOperationOptionalParams(input.ReturnValues, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil,
-		nil, input.ConditionExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues, writer)
+		nil, input.ConditionExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues, expressions, writer)
 }
 
-func encodeUpdateItemInput(ctx aws.Context, input *dynamodb.UpdateItemInput, keySchema *lru.Lru, writer *cbor.Writer) error {
+func encodeUpdateItemInput(ctx aws.Context, input *dynamodb.UpdateItemInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -310,10 +313,10 @@ func encodeUpdateItemInput(ctx aws.Context, input *dynamodb.UpdateItemInput, key
 	}
 
 	return encodeItemOperationOptionalParams(input.ReturnValues, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil,
-		nil, input.ConditionExpression, input.UpdateExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, writer)
+		nil, input.ConditionExpression, input.UpdateExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues, expressions, writer)
 }
 
-func encodeGetItemInput(ctx aws.Context, input *dynamodb.GetItemInput, keySchema *lru.Lru, writer *cbor.Writer) error {
+func encodeGetItemInput(ctx aws.Context, input *dynamodb.GetItemInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -340,10 +343,10 @@ func encodeGetItemInput(ctx aws.Context, input *dynamodb.GetItemInput, keySchema
 		return err
 	}
 	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, nil, input.ConsistentRead,
-		input.ProjectionExpression, nil, nil, input.ExpressionAttributeNames, nil, writer)
+		input.ProjectionExpression, nil, nil, input.ExpressionAttributeNames, nil, expressions, writer)
 }
 
-func encodeScanInput(ctx aws.Context, input *dynamodb.ScanInput, keySchema *lru.Lru, writer *cbor.Writer) error {
+func encodeScanInput(ctx aws.Context, input *dynamodb.ScanInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -360,15 +363,15 @@ func encodeScanInput(ctx aws.Context, input *dynamodb.ScanInput, keySchema *lru.
 	if err := writer.WriteBytes([]byte(*input.TableName)); err != nil {
 		return err
 	}
-	expressions, err := encodeExpressions(input.ProjectionExpression, input.FilterExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	encoded, err := encodeExpressions(expressions, input.ProjectionExpression, input.FilterExpression, nil, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
 	if err != nil {
 		return err
 	}
 	return encodeScanQueryOptionalParams(ctx, input.IndexName, input.Select, input.ReturnConsumedCapacity, input.ConsistentRead,
-		expressions, input.Segment, input.TotalSegments, input.Limit, nil, input.ExclusiveStartKey, keySchema, *input.TableName, writer)
+		encoded, input.Segment, input.TotalSegments, input.Limit, nil, input.ExclusiveStartKey, keySchema, *input.TableName, writer)
 }
 
-func encodeQueryInput(ctx aws.Context, input *dynamodb.QueryInput, keySchema *lru.Lru, writer *cbor.Writer) error {
+func encodeQueryInput(ctx aws.Context, input *dynamodb.QueryInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -388,15 +391,15 @@ func encodeQueryInput(ctx aws.Context, input *dynamodb.QueryInput, keySchema *lr
 	if err := writer.WriteBytes([]byte(*input.TableName)); err != nil {
 		return err
 	}
-	expressions, err := encodeExpressions(input.ProjectionExpression, input.FilterExpression, input.KeyConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	encoded, err := encodeExpressions(expressions, input.ProjectionExpression, input.FilterExpression, input.KeyConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
 	if err != nil {
 		return err
 	}
-	if err = writer.WriteBytes(expressions[parser.KeyConditionExpr]); err != nil {
+	if err = writer.WriteBytes(encoded[parser.KeyConditionExpr]); err != nil {
 		return err
 	}
 	return encodeScanQueryOptionalParams(ctx, input.IndexName, input.Select, input.ReturnConsumedCapacity, input.ConsistentRead,
-		expressions, nil, nil, input.Limit, input.ScanIndexForward, input.ExclusiveStartKey, keySchema, *input.TableName, writer)
+		encoded, nil, nil, input.Limit, input.ScanIndexForward, input.ExclusiveStartKey, keySchema, *input.TableName, writer)
 }
 
 func encodeBatchWriteItemInput(ctx aws.Context, input *dynamodb.BatchWriteItemInput, keySchema *lru.Lru, attrNamesListToId *lru.Lru, writer *cbor.Writer) error {
@@ -462,10 +465,10 @@ func encodeBatchWriteItemInput(ctx aws.Context, input *dynamodb.BatchWriteItemIn
 			}
 		}
 	}
-	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil, nil, nil, nil, nil, nil, writer)
+	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil, nil, nil, nil, nil, nil, nil, writer)
 }
 
-func encodeBatchGetItemInput(ctx aws.Context, input *dynamodb.BatchGetItemInput, keySchema *lru.Lru, writer *cbor.Writer) error {
+func encodeBatchGetItemInput(ctx aws.Context, input *dynamodb.BatchGetItemInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, fmt.Sprintf("input cannot be nil"), nil)
 	}
@@ -499,17 +502,19 @@ func encodeBatchGetItemInput(ctx aws.Context, input *dynamodb.BatchGetItemInput,
 			return err
 		}
 		if kaas.ProjectionExpression != nil {
-			expressions := make(map[int]string)
-			expressions[parser.ProjectionExpr] = *kaas.ProjectionExpression
-			encoder := parser.NewExpressionEncoder(expressions, kaas.ExpressionAttributeNames, nil)
+			exprs := make(map[int]string)
+			exprs[parser.ProjectionExpr] = *kaas.ProjectionExpression
+			encoder := expressions.NewEncoder(exprs, kaas.ExpressionAttributeNames, nil)
 			if _, err = encoder.Parse(); err != nil {
 				return err
 			}
-			var buf bytes.Buffer
-			if err = encoder.Write(parser.ProjectionExpr, &buf); err != nil {
-				return err
+			buf := getBuffer()
+			err = encoder.Write(parser.ProjectionExpr, buf)
+			if err == nil {
+				err = writer.WriteBytes(buf.Bytes())
 			}
-			if err = writer.WriteBytes(buf.Bytes()); err != nil {
+			putBuffer(buf)
+			if err != nil {
 				return err
 			}
 		} else {
@@ -535,10 +540,10 @@ func encodeBatchGetItemInput(ctx aws.Context, input *dynamodb.BatchGetItemInput,
 		}
 	}
 
-	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, nil, nil, nil, nil, nil, nil, nil, writer)
+	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, nil, nil, nil, nil, nil, nil, nil, expressions, writer)
 }
 
-func encodeTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, keySchema *lru.Lru, attrNamesListToId *lru.Lru, writer *cbor.Writer, extractedKeys []map[string]*dynamodb.AttributeValue) error {
+func encodeTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, keySchema *lru.Lru, attrNamesListToId *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer, extractedKeys []map[string]*dynamodb.AttributeValue) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, "input cannot be nil", nil)
 	}
@@ -546,20 +551,34 @@ func encodeTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWrit
 	if err = input.Validate(); err != nil {
 		return err
 	}
+	if input.ClientRequestToken != nil && len(*input.ClientRequestToken) > maxClientRequestTokenLength {
+		invalidParams := request.ErrInvalidParams{Context: "TransactWriteItemsInput"}
+		invalidParams.Add(request.NewErrParamMaxLen("ClientRequestToken", maxClientRequestTokenLength, *input.ClientRequestToken))
+		return invalidParams
+	}
 
 	if err = encodeServiceAndMethod(transactWriteItems_N1160037738_1_Id, writer); err != nil {
 		return err
 	}
 
-	var operationsBuf, tableNamesBuf, keysBuf, valuesBuf, conditionExpressionsBuf,
-		updateExpressionsBuf, rvOnConditionCheckFailureBuf bytes.Buffer
-	operationWriter := cbor.NewWriter(&operationsBuf)
-	tableNamesWriter := cbor.NewWriter(&tableNamesBuf)
-	keysWriter := cbor.NewWriter(&keysBuf)
-	valuesWriter := cbor.NewWriter(&valuesBuf)
-	conditionExpressionsWriter := cbor.NewWriter(&conditionExpressionsBuf)
-	updateExpressionsWriter := cbor.NewWriter(&updateExpressionsBuf)
-	rvOnConditionCheckFailureWriter := cbor.NewWriter(&rvOnConditionCheckFailureBuf)
+	operationsBuf, tableNamesBuf, keysBuf, valuesBuf := getBuffer(), getBuffer(), getBuffer(), getBuffer()
+	conditionExpressionsBuf, updateExpressionsBuf, rvOnConditionCheckFailureBuf := getBuffer(), getBuffer(), getBuffer()
+	defer func() {
+		putBuffer(operationsBuf)
+		putBuffer(tableNamesBuf)
+		putBuffer(keysBuf)
+		putBuffer(valuesBuf)
+		putBuffer(conditionExpressionsBuf)
+		putBuffer(updateExpressionsBuf)
+		putBuffer(rvOnConditionCheckFailureBuf)
+	}()
+	operationWriter := cbor.NewWriter(operationsBuf)
+	tableNamesWriter := cbor.NewWriter(tableNamesBuf)
+	keysWriter := cbor.NewWriter(keysBuf)
+	valuesWriter := cbor.NewWriter(valuesBuf)
+	conditionExpressionsWriter := cbor.NewWriter(conditionExpressionsBuf)
+	updateExpressionsWriter := cbor.NewWriter(updateExpressionsBuf)
+	rvOnConditionCheckFailureWriter := cbor.NewWriter(rvOnConditionCheckFailureBuf)
 
 	l := len(input.TransactItems)
 
@@ -670,7 +689,7 @@ func encodeTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWrit
 
 		keydef, err := getKeySchema(ctx, keySchema, *tableName)
 		if err != nil {
-			return nil
+			return err
 		}
 
 		// Check if duplicate [key, tableName] pair exists
@@ -710,7 +729,7 @@ func encodeTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWrit
 
 		extractedKeys[i] = key
 
-		encoded, err := parseExpressions(conditionExpression, updateExpression, nil, expressionAttributeNames, expressionAttributeValues)
+		encoded, err := parseExpressions(expressions, conditionExpression, updateExpression, nil, expressionAttributeNames, expressionAttributeValues)
 		if err != nil {
 			return err
 		}
@@ -799,10 +818,10 @@ func encodeTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWrit
 		}
 		input.ClientRequestToken = aws.String(id.String())
 	}
-	return encodeItemOperationOptionalParamsWithToken(nil, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil, nil, nil, nil, nil, nil, input.ClientRequestToken, writer)
+	return encodeItemOperationOptionalParamsWithToken(nil, input.ReturnConsumedCapacity, input.ReturnItemCollectionMetrics, nil, nil, nil, nil, nil, nil, input.ClientRequestToken, expressions, writer)
 }
 
-func encodeTransactGetItemsInput(ctx aws.Context, input *dynamodb.TransactGetItemsInput, keySchema *lru.Lru, writer *cbor.Writer, extractedKeys []map[string]*dynamodb.AttributeValue) error {
+func encodeTransactGetItemsInput(ctx aws.Context, input *dynamodb.TransactGetItemsInput, keySchema *lru.Lru, expressions *parser.ExpressionCache, writer *cbor.Writer, extractedKeys []map[string]*dynamodb.AttributeValue) error {
 	if input == nil {
 		return awserr.New(request.ParamRequiredErrCode, "input cannot be nil", nil)
 	}
@@ -815,10 +834,15 @@ func encodeTransactGetItemsInput(ctx aws.Context, input *dynamodb.TransactGetIte
 		return err
 	}
 
-	var tableNamesBuf, keysBuf, projectionExpressionsBuf bytes.Buffer
-	tableNamesWriter := cbor.NewWriter(&tableNamesBuf)
-	keysWriter := cbor.NewWriter(&keysBuf)
-	projectionExpressionsWriter := cbor.NewWriter(&projectionExpressionsBuf)
+	tableNamesBuf, keysBuf, projectionExpressionsBuf := getBuffer(), getBuffer(), getBuffer()
+	defer func() {
+		putBuffer(tableNamesBuf)
+		putBuffer(keysBuf)
+		putBuffer(projectionExpressionsBuf)
+	}()
+	tableNamesWriter := cbor.NewWriter(tableNamesBuf)
+	keysWriter := cbor.NewWriter(keysBuf)
+	projectionExpressionsWriter := cbor.NewWriter(projectionExpressionsBuf)
 
 	len := len(input.TransactItems)
 
@@ -867,7 +891,7 @@ func encodeTransactGetItemsInput(ctx aws.Context, input *dynamodb.TransactGetIte
 			return err
 		}
 
-		encoded, err := parseExpressions(nil, nil, projectionExpression, expressionAttributeNames, nil)
+		encoded, err := parseExpressions(expressions, nil, nil, projectionExpression, expressionAttributeNames, nil)
 		if err != nil {
 			return err
 		}
@@ -902,12 +926,13 @@ func encodeTransactGetItemsInput(ctx aws.Context, input *dynamodb.TransactGetIte
 		return err
 	}
 
-	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, nil, nil, nil, nil, nil, nil, nil, writer)
+	return encodeItemOperationOptionalParams(nil, input.ReturnConsumedCapacity, nil, nil, nil, nil, nil, nil, nil, expressions, writer)
 }
 
 func encodeCompoundKey(key map[string]*dynamodb.AttributeValue, writer *cbor.Writer) error {
-	var buf bytes.Buffer
-	w := cbor.NewWriter(&buf)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	w := cbor.NewWriter(buf)
 	defer w.Close()
 	if err := w.WriteMapStreamHeader(); err != nil {
 		return err
@@ -917,7 +942,7 @@ func encodeCompoundKey(key map[string]*dynamodb.AttributeValue, writer *cbor.Wri
 			if err := w.WriteString(k); err != nil {
 				return err
 			}
-			if err := cbor.EncodeAttributeValue(v, w); err != nil {
+			if err := cbor.EncodeAttribute(k, v, w); err != nil {
 				return err
 			}
 		}
@@ -933,8 +958,9 @@ func encodeCompoundKey(key map[string]*dynamodb.AttributeValue, writer *cbor.Wri
 
 func encodeNonKeyAttributes(ctx aws.Context, item map[string]*dynamodb.AttributeValue, keys []dynamodb.AttributeDefinition,
 	attrNamesListToId *lru.Lru, writer *cbor.Writer) error {
-	var buf bytes.Buffer
-	w := cbor.NewWriter(&buf)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	w := cbor.NewWriter(buf)
 	defer w.Close()
 	if err := cbor.EncodeItemNonKeyAttributes(ctx, item, keys, attrNamesListToId, w); err != nil {
 		return err
@@ -997,7 +1023,7 @@ func encodeScanQueryOptionalParams(ctx aws.Context, index, selection, returnCons
 		if index == nil {
 			tableKeys, err := getKeySchema(ctx, keySchema, table)
 			if err != nil {
-				return nil
+				return err
 			}
 			if err = cbor.EncodeItemKey(startKey, tableKeys, writer); err != nil {
 				return err
@@ -1065,7 +1091,7 @@ func encodeScanQueryOptionalParams(ctx aws.Context, index, selection, returnCons
 }
 
 func encodeItemOperationOptionalParamsWithToken(returnValues, returnConsumedCapacity, returnItemCollectionMetrics *string, consistentRead *bool,
-	projectionExp, conditionalExpr, updateExpr *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue, clientRequestToken *string, writer *cbor.Writer) error {
+	projectionExp, conditionalExpr, updateExpr *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue, clientRequestToken *string, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	if err := writer.WriteMapStreamHeader(); err != nil {
 		return err
 	}
@@ -1107,7 +1133,7 @@ func encodeItemOperationOptionalParamsWithToken(returnValues, returnConsumedCapa
 	}
 
 	if conditionalExpr != nil || updateExpr != nil || projectionExp != nil {
-		encoded, err := parseExpressions(conditionalExpr, updateExpr, projectionExp, exprAttrNames, exprAttrValues)
+		encoded, err := parseExpressions(expressions, conditionalExpr, updateExpr, projectionExp, exprAttrNames, exprAttrValues)
 		if err != nil {
 			return err
 		}
@@ -1145,23 +1171,23 @@ func encodeItemOperationOptionalParamsWithToken(returnValues, returnConsumedCapa
 }
 
 func encodeItemOperationOptionalParams(returnValues, returnConsumedCapacity, returnItemCollectionMetrics *string, consistentRead *bool,
-	projectionExp, conditionalExpr, updateExpr *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue, writer *cbor.Writer) error {
+	projectionExp, conditionalExpr, updateExpr *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue, expressions *parser.ExpressionCache, writer *cbor.Writer) error {
 	return encodeItemOperationOptionalParamsWithToken(returnValues, returnConsumedCapacity, returnItemCollectionMetrics, consistentRead,
-		projectionExp, conditionalExpr, updateExpr, exprAttrNames, exprAttrValues, nil, writer)
+		projectionExp, conditionalExpr, updateExpr, exprAttrNames, exprAttrValues, nil, expressions, writer)
 }
 
-func parseExpressions(conditionalExpr, updateExpr, projectionExp *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue) (map[int][]byte, error) {
-	expressions := make(map[int]string)
+func parseExpressions(expressions *parser.ExpressionCache, conditionalExpr, updateExpr, projectionExp *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue) (map[int][]byte, error) {
+	exprs := make(map[int]string)
 	if conditionalExpr != nil {
-		expressions[parser.ConditionExpr] = *conditionalExpr
+		exprs[parser.ConditionExpr] = *conditionalExpr
 	}
 	if updateExpr != nil {
-		expressions[parser.UpdateExpr] = *updateExpr
+		exprs[parser.UpdateExpr] = *updateExpr
 	}
 	if projectionExp != nil {
-		expressions[parser.ProjectionExpr] = *projectionExp
+		exprs[parser.ProjectionExpr] = *projectionExp
 	}
-	encoder := parser.NewExpressionEncoder(expressions, exprAttrNames, exprAttrValues)
+	encoder := expressions.NewEncoder(exprs, exprAttrNames, exprAttrValues)
 	encoded, err := encoder.Parse()
 	if err != nil {
 		return nil, err
@@ -1176,18 +1202,18 @@ func encodeServiceAndMethod(method int, writer *cbor.Writer) error {
 	return writer.WriteInt(method)
 }
 
-func encodeExpressions(projection, filter, keyCondition *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue) (map[int][]byte, error) {
-	expressions := make(map[int]string)
+func encodeExpressions(expressions *parser.ExpressionCache, projection, filter, keyCondition *string, exprAttrNames map[string]*string, exprAttrValues map[string]*dynamodb.AttributeValue) (map[int][]byte, error) {
+	exprs := make(map[int]string)
 	if projection != nil {
-		expressions[parser.ProjectionExpr] = *projection
+		exprs[parser.ProjectionExpr] = *projection
 	}
 	if filter != nil {
-		expressions[parser.FilterExpr] = *filter
+		exprs[parser.FilterExpr] = *filter
 	}
 	if keyCondition != nil {
-		expressions[parser.KeyConditionExpr] = *keyCondition
+		exprs[parser.KeyConditionExpr] = *keyCondition
 	}
-	encoder := parser.NewExpressionEncoder(expressions, exprAttrNames, exprAttrValues)
+	encoder := expressions.NewEncoder(exprs, exprAttrNames, exprAttrValues)
 	return encoder.Parse()
 }
 
@@ -1261,6 +1287,83 @@ func translateScanIndexForward(b *bool) int {
 	return 0
 }
 
+// InputTables returns the tables of the request of input, once per table for
+// batches and once per item for transactions.
+func InputTables(input interface{}) []string {
+	if v := reflect.ValueOf(input); !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	switch in := input.(type) {
+	case *dynamodb.GetItemInput:
+		return []string{aws.StringValue(in.TableName)}
+	case *dynamodb.PutItemInput:
+		return []string{aws.StringValue(in.TableName)}
+	case *dynamodb.DeleteItemInput:
+		return []string{aws.StringValue(in.TableName)}
+	case *dynamodb.UpdateItemInput:
+		return []string{aws.StringValue(in.TableName)}
+	case *dynamodb.QueryInput:
+		return []string{aws.StringValue(in.TableName)}
+	case *dynamodb.ScanInput:
+		return []string{aws.StringValue(in.TableName)}
+	case *dynamodb.BatchGetItemInput:
+		return batchGetTables(in)
+	case *dynamodb.BatchWriteItemInput:
+		return batchWriteTables(in)
+	case *dynamodb.TransactGetItemsInput:
+		return transactGetTables(in)
+	case *dynamodb.TransactWriteItemsInput:
+		return transactWriteTables(in)
+	}
+	return nil
+}
+
+func batchWriteTables(input *dynamodb.BatchWriteItemInput) []string {
+	tables := make([]string, 0, len(input.RequestItems))
+	for table := range input.RequestItems {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func batchGetTables(input *dynamodb.BatchGetItemInput) []string {
+	tables := make([]string, 0, len(input.RequestItems))
+	for table := range input.RequestItems {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func transactWriteTables(input *dynamodb.TransactWriteItemsInput) []string {
+	tables := make([]string, 0, len(input.TransactItems))
+	for _, item := range input.TransactItems {
+		if item == nil {
+			continue
+		}
+		switch {
+		case item.ConditionCheck != nil:
+			tables = append(tables, aws.StringValue(item.ConditionCheck.TableName))
+		case item.Put != nil:
+			tables = append(tables, aws.StringValue(item.Put.TableName))
+		case item.Delete != nil:
+			tables = append(tables, aws.StringValue(item.Delete.TableName))
+		case item.Update != nil:
+			tables = append(tables, aws.StringValue(item.Update.TableName))
+		}
+	}
+	return tables
+}
+
+func transactGetTables(input *dynamodb.TransactGetItemsInput) []string {
+	tables := make([]string, 0, len(input.TransactItems))
+	for _, item := range input.TransactItems {
+		if item != nil && item.Get != nil {
+			tables = append(tables, aws.StringValue(item.Get.TableName))
+		}
+	}
+	return tables
+}
+
 func hasDuplicatesWriteRequests(wrs []*dynamodb.WriteRequest, d []dynamodb.AttributeDefinition) bool {
 	if len(wrs) <= 1 {
 		return false
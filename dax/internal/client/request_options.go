@@ -35,6 +35,8 @@ type RequestOptions struct {
 	//SleepDelayFn is used for non-throttled retryable requests
 	SleepDelayFn func(time.Duration)
 	Context      aws.Context
+
+	table string // the table of the request, see inputTable
 }
 
 func (o *RequestOptions) applyTo(r *request.Request) {
@@ -53,19 +55,33 @@ func (o *RequestOptions) applyTo(r *request.Request) {
 
 func (o *RequestOptions) MergeFromRequestOptions(ctx aws.Context, opts ...request.Option) error {
 	if len(opts) == 0 {
-		if ctx != nil {
-			o.Context = ctx
-		}
-		return nil
+		return o.MergeFromAppliedOptions(ctx, nil)
 	}
 
 	// New request has to be created to avoid panics when setting fields
 	r := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{}, nil, nil)
 	r.ApplyOptions(opts...)
+	return o.MergeFromAppliedOptions(ctx, r)
+}
+
+// MergeFromAppliedOptions is MergeFromRequestOptions with the options already
+// applied to r, a request standing in for the request they are made with. r
+// may be nil if there are no options.
+func (o *RequestOptions) MergeFromAppliedOptions(ctx aws.Context, r *request.Request) error {
+	if r == nil {
+		if ctx != nil {
+			o.Context = ctx
+		}
+		return nil
+	}
 	if err := o.mergeFromRequest(r, true); err != nil {
 		return err
 	}
 	if ctx != nil {
+		// keep the ResponseMetadata set by the options
+		if md, ok := r.Context().Value(responseMetadataKey{}).(*ResponseMetadata); ok && ctx.Value(responseMetadataKey{}) == nil {
+			ctx = WithResponseMetadata(ctx, md)
+		}
 		o.Context = ctx
 	}
 	return nil
@@ -1,9 +1,16 @@
 package client
 
 import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-dax-go/dax/internal/parser"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"testing"
 )
 
 func TestHasDuplicatesWriteRequests(t *testing.T) {
@@ -156,3 +163,175 @@ func reverse(a []interface{}) {
 		a[i], a[opp] = a[opp], a[i]
 	}
 }
+
+func TestEncodeExpressions_Cache(t *testing.T) {
+	cache := parser.NewExpressionCache(10)
+	keyCondition := aws.String("hk = :hk and rk > :rk")
+	filter := aws.String("#s = :s")
+	projection := aws.String("hk, rk, #s")
+	names := map[string]*string{"#s": aws.String("status")}
+
+	var previous map[int][]byte
+	for i := 0; i < 3; i++ {
+		values := map[string]*dynamodb.AttributeValue{
+			":hk": {S: aws.String("key" + strconv.Itoa(i))},
+			":rk": {N: aws.String(strconv.Itoa(i))},
+			":s":  {S: aws.String("OPEN")},
+		}
+		expected, err := encodeExpressions(nil, projection, filter, keyCondition, names, values)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		actual, err := encodeExpressions(cache, projection, filter, keyCondition, names, values)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if bytes.Equal(previous[parser.KeyConditionExpr], actual[parser.KeyConditionExpr]) {
+			t.Errorf("expected a different key condition for different values")
+		}
+		previous = actual
+	}
+	if hits, misses := cache.Stats(); hits != 6 || misses != 3 {
+		t.Errorf("expected 6 hits and 3 misses, got %d and %d", hits, misses)
+	}
+}
+
+func TestEncodeConsistentRead(t *testing.T) {
+	keySchema := &lru.Lru{
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			return []dynamodb.AttributeDefinition{{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}}, nil
+		},
+	}
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	keyCondition := aws.String("hk = :hk")
+	values := map[string]*dynamodb.AttributeValue{":hk": {S: aws.String("a")}}
+
+	// the encoded request, and the number of values preceding its optional params
+	type encoded func(cr *bool, w *cbor.Writer) error
+	cases := []struct {
+		name   string
+		encode encoded
+		values int
+	}{
+		{
+			name: "GetItem",
+			encode: func(cr *bool, w *cbor.Writer) error {
+				return encodeGetItemInput(nil, &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key, ConsistentRead: cr}, keySchema, nil, w)
+			},
+			values: 2, // table, key
+		},
+		{
+			name: "Query",
+			encode: func(cr *bool, w *cbor.Writer) error {
+				return encodeQueryInput(nil, &dynamodb.QueryInput{TableName: aws.String("table"), KeyConditionExpression: keyCondition, ExpressionAttributeValues: values, ConsistentRead: cr}, keySchema, nil, w)
+			},
+			values: 2, // table, key condition
+		},
+		{
+			name: "Scan",
+			encode: func(cr *bool, w *cbor.Writer) error {
+				return encodeScanInput(nil, &dynamodb.ScanInput{TableName: aws.String("table"), ConsistentRead: cr}, keySchema, nil, w)
+			},
+			values: 1, // table
+		},
+	}
+	for _, c := range cases {
+		for _, cr := range []*bool{nil, aws.Bool(false), aws.Bool(true)} {
+			var buf bytes.Buffer
+			w := cbor.NewWriter(&buf)
+			if err := c.encode(cr, w); err != nil {
+				t.Fatalf("%s: unexpected error %v", c.name, err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			r := cbor.NewReader(&buf)
+			for i := 0; i < 2+c.values; i++ { // service, method and values
+				if err := skipValue(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sent := -1
+			err := readParams(r, map[int]func(r *cbor.Reader) error{
+				requestParamConsistentRead: func(r *cbor.Reader) (err error) {
+					// a boolean for GetItem, an integer for Query and Scan
+					hdr, err := r.PeekHeader()
+					if err != nil {
+						return err
+					}
+					if hdr == cbor.True || hdr == cbor.False {
+						sent = 0
+						if hdr == cbor.True {
+							sent = 1
+						}
+						return r.ReadNil()
+					}
+					sent, err = r.ReadInt()
+					return err
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := -1
+			if cr != nil && *cr {
+				expected = 1
+			} else if cr != nil {
+				expected = 0
+			}
+			if sent != expected {
+				t.Errorf("%s: expected ConsistentRead %v to be sent as %d, got %d", c.name, aws.BoolValue(cr), expected, sent)
+			}
+		}
+	}
+
+	// BatchGetItem sends the flag of each table
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	input := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{
+		"consistent": {Keys: []map[string]*dynamodb.AttributeValue{key}, ConsistentRead: aws.Bool(true)},
+		"eventual":   {Keys: []map[string]*dynamodb.AttributeValue{key}},
+	}}
+	if err := encodeBatchGetItemInput(nil, input, keySchema, nil, w); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r := cbor.NewReader(&buf)
+	for i := 0; i < 2; i++ { // service and method
+		if err := skipValue(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := r.ReadMapLength()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := map[string]bool{}
+	for i := 0; i < n; i++ {
+		table, err := r.ReadString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.ReadArrayLength(); err != nil { // consistent read, projection and keys
+			t.Fatal(err)
+		}
+		hdr, err := r.PeekHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent[table] = hdr == cbor.True
+		for j := 0; j < 3; j++ {
+			if err := skipValue(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if expected := map[string]bool{"consistent": true, "eventual": false}; !reflect.DeepEqual(expected, sent) {
+		t.Errorf("expected ConsistentRead %v, got %v", expected, sent)
+	}
+}
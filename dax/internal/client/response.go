@@ -201,8 +201,8 @@ func decodePutItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.P
 				return err
 			}
 		case responseParamAttributes:
-			attrs, err := decodeNonKeyAttributes(ctx, reader, attrListIdToNames, nil)
-			if err != nil {
+			attrs, err := decodeNonKeyAttributes(ctx, reader, nil, attrListIdToNames, nil)
+			if err != nil || attrs == nil {
 				return err
 			}
 			keys, err := getKeySchema(ctx, keySchemaCache, tableName)
@@ -253,8 +253,8 @@ func decodeDeleteItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynamod
 				return err
 			}
 		case responseParamAttributes:
-			attrs, err := decodeNonKeyAttributes(ctx, reader, attrListIdToNames, nil)
-			if err != nil {
+			attrs, err := decodeNonKeyAttributes(ctx, reader, nil, attrListIdToNames, nil)
+			if err != nil || attrs == nil {
 				return err
 			}
 			for k, v := range input.Key {
@@ -306,8 +306,8 @@ func decodeUpdateItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynamod
 			}
 			switch *rv {
 			case dynamodb.ReturnValueAllNew, dynamodb.ReturnValueAllOld:
-				attrs, err := decodeNonKeyAttributes(ctx, reader, attrListIdToNames, nil)
-				if err != nil {
+				attrs, err := decodeNonKeyAttributes(ctx, reader, nil, attrListIdToNames, nil)
+				if err != nil || attrs == nil {
 					return err
 				}
 				for k, v := range input.Key {
@@ -354,7 +354,7 @@ func decodeGetItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.G
 				return err
 			}
 		case responseParamItem:
-			item, err := decodeNonKeyAttributes(ctx, reader, attrListIdToNames, projectionOrdinals)
+			item, err := decodeNonKeyAttributes(ctx, reader, nil, attrListIdToNames, projectionOrdinals)
 			if err != nil {
 				return err
 			}
@@ -377,7 +377,7 @@ func decodeGetItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.G
 }
 
 func decodeScanOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.ScanInput, keySchemaCache *lru.Lru, attrNamesListToId *lru.Lru, output *dynamodb.ScanOutput) (*dynamodb.ScanOutput, error) {
-	out, err := decodeScanQueryOutput(ctx, reader, *input.TableName, input.IndexName != nil, input.ProjectionExpression, input.ExpressionAttributeNames, keySchemaCache, attrNamesListToId)
+	out, err := decodeScanQueryOutput(ctx, reader, *input.TableName, input.IndexName != nil, input.Select, input.ProjectionExpression, input.ExpressionAttributeNames, keySchemaCache, attrNamesListToId)
 	if err != nil {
 		return output, err
 	}
@@ -388,7 +388,7 @@ func decodeScanOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.Scan
 }
 
 func decodeQueryOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.QueryInput, keySchemaCache *lru.Lru, attrNamesListToId *lru.Lru, output *dynamodb.QueryOutput) (*dynamodb.QueryOutput, error) {
-	out, err := decodeScanQueryOutput(ctx, reader, *input.TableName, input.IndexName != nil, input.ProjectionExpression, input.ExpressionAttributeNames, keySchemaCache, attrNamesListToId)
+	out, err := decodeScanQueryOutput(ctx, reader, *input.TableName, input.IndexName != nil, input.Select, input.ProjectionExpression, input.ExpressionAttributeNames, keySchemaCache, attrNamesListToId)
 	if err != nil {
 		return output, err
 	}
@@ -398,6 +398,9 @@ func decodeQueryOutput(ctx aws.Context, reader *cbor.Reader, input *dynamodb.Que
 	return out.queryOutput(output), nil
 }
 
+// Bounds the capacity allocated upfront for the items of a response, which a corrupt length could inflate.
+const maxPresizedItems = 10000
+
 type scanQueryOutput struct {
 	dynamodb.ScanOutput
 }
@@ -432,15 +435,20 @@ func (o *scanQueryOutput) queryOutput(output *dynamodb.QueryOutput) *dynamodb.Qu
 	}
 }
 
-func decodeScanQueryOutput(ctx aws.Context, reader *cbor.Reader, table string, indexed bool, projection *string, exprAttrNames map[string]*string, keySchemaCache *lru.Lru, attrNamesListToId *lru.Lru) (*scanQueryOutput, error) {
+// Decodes the response of a scan or query. The responses of Select=COUNT requests
+// have no items, their count being that of the items matched.
+func decodeScanQueryOutput(ctx aws.Context, reader *cbor.Reader, table string, indexed bool, selection, projection *string, exprAttrNames map[string]*string, keySchemaCache *lru.Lru, attrNamesListToId *lru.Lru) (*scanQueryOutput, error) {
 	if consumed, err := consumeNil(reader); err != nil {
 		return nil, err
 	} else if consumed {
 		return nil, nil
 	}
 
+	countOnly := aws.StringValue(selection) == dynamodb.SelectCount
 	out := &scanQueryOutput{}
-	out.Items = []map[string]*dynamodb.AttributeValue{}
+	if !countOnly {
+		out.Items = []map[string]*dynamodb.AttributeValue{}
+	}
 	var err error
 	err = consumeMap(reader, func(key int, reader *cbor.Reader) error {
 		switch key {
@@ -449,9 +457,16 @@ func decodeScanQueryOutput(ctx aws.Context, reader *cbor.Reader, table string, i
 			if err != nil {
 				return err
 			}
-			if out.Items, err = decodeScanQueryItems(ctx, reader, table, keySchemaCache, attrNamesListToId, projectionOrdinals); err != nil {
+			count := out.Count
+			if countOnly {
+				count = nil // no items to make room for
+			}
+			if out.Items, err = decodeScanQueryItems(ctx, reader, table, count, keySchemaCache, attrNamesListToId, projectionOrdinals); err != nil {
 				return err
 			}
+			if countOnly && len(out.Items) == 0 {
+				out.Items = nil
+			}
 		case responseParamConsumedCapacity:
 			if out.ConsumedCapacity, err = decodeConsumedCapacity(reader); err != nil {
 				return err
@@ -525,7 +540,7 @@ func decodeBatchWriteItemOutput(ctx aws.Context, reader *cbor.Reader, keySchemaC
 				if err != nil {
 					return output, err
 				}
-				item, err := decodeNonKeyAttributes(ctx, reader, attrNamesListToId, nil)
+				item, err := decodeNonKeyAttributes(ctx, reader, nil, attrNamesListToId, nil)
 				if err != nil {
 					return output, err
 				}
@@ -560,36 +575,9 @@ func decodeBatchWriteItemOutput(ctx aws.Context, reader *cbor.Reader, keySchemaC
 		}
 	}
 
-	icmLen, err := reader.ReadMapLength()
-	if err != nil {
+	if output.ItemCollectionMetrics, err = decodeItemCollectionMetricsByTable(ctx, reader, keySchemaCache); err != nil {
 		return output, err
 	}
-	if icmLen > 0 {
-		output.ItemCollectionMetrics = make(map[string][]*dynamodb.ItemCollectionMetrics, icmLen)
-		for i := 0; i < icmLen; i++ {
-			table, err := reader.ReadString()
-			if err != nil {
-				return output, err
-			}
-			keys, err := getKeySchema(ctx, keySchemaCache, table)
-			if err != nil {
-				return output, err
-			}
-			pkey := *keys[0].AttributeName
-			numMetrics, err := reader.ReadArrayLength()
-			if err != nil {
-				return output, err
-			}
-			metrics := make([]*dynamodb.ItemCollectionMetrics, numMetrics)
-			for j := 0; j < numMetrics; j++ {
-				metrics[j], err = decodeItemCollectionMetrics(reader, pkey)
-				if err != nil {
-					return output, err
-				}
-			}
-			output.ItemCollectionMetrics[table] = metrics
-		}
-	}
 
 	return output, nil
 }
@@ -630,6 +618,7 @@ func decodeBatchGetItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynam
 	}
 	if numTables > 0 {
 		output.Responses = make(map[string][]map[string]*dynamodb.AttributeValue, numTables)
+		d := &cbor.ItemDecoder{}
 		for i := 0; i < numTables; i++ {
 			table, err := reader.ReadString()
 			if err != nil {
@@ -644,7 +633,7 @@ func decodeBatchGetItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynam
 				}
 				items := make([]map[string]*dynamodb.AttributeValue, numItems)
 				for j := 0; j < numItems; j++ {
-					if items[j], err = decodeNonKeyAttributes(ctx, reader, attrNamesListToId, projections); err != nil {
+					if items[j], err = decodeNonKeyAttributes(ctx, reader, d, attrNamesListToId, projections); err != nil {
 						return output, err
 					}
 				}
@@ -665,7 +654,7 @@ func decodeBatchGetItemOutput(ctx aws.Context, reader *cbor.Reader, input *dynam
 					if err != nil {
 						return output, err
 					}
-					item, err := decodeNonKeyAttributes(ctx, reader, attrNamesListToId, projections)
+					item, err := decodeNonKeyAttributes(ctx, reader, d, attrNamesListToId, projections)
 					if err != nil {
 						return output, err
 					}
@@ -763,42 +752,15 @@ func decodeTransactWriteItemsOutput(ctx aws.Context, reader *cbor.Reader, input
 	if numCC > 0 {
 		output.ConsumedCapacity = make([]*dynamodb.ConsumedCapacity, numCC)
 		for i := 0; i < numCC; i++ {
-			if output.ConsumedCapacity[i], err = decodeConsumedCapacityExtended(reader); err != nil {
+			if output.ConsumedCapacity[i], err = decodeConsumedCapacity(reader); err != nil {
 				return output, err
 			}
 		}
 	}
 
-	icmLen, err := reader.ReadMapLength()
-	if err != nil {
+	if output.ItemCollectionMetrics, err = decodeItemCollectionMetricsByTable(ctx, reader, keySchemaCache); err != nil {
 		return output, err
 	}
-	if icmLen > 0 {
-		output.ItemCollectionMetrics = make(map[string][]*dynamodb.ItemCollectionMetrics, icmLen)
-		for i := 0; i < icmLen; i++ {
-			table, err := reader.ReadString()
-			if err != nil {
-				return output, err
-			}
-			keys, err := getKeySchema(ctx, keySchemaCache, table)
-			if err != nil {
-				return output, err
-			}
-			pkey := *keys[0].AttributeName
-			numMetrics, err := reader.ReadArrayLength()
-			if err != nil {
-				return output, err
-			}
-			metrics := make([]*dynamodb.ItemCollectionMetrics, numMetrics)
-			for j := 0; j < numMetrics; j++ {
-				metrics[j], err = decodeItemCollectionMetrics(reader, pkey)
-				if err != nil {
-					return output, err
-				}
-			}
-			output.ItemCollectionMetrics[table] = metrics
-		}
-	}
 
 	return output, nil
 }
@@ -832,7 +794,7 @@ func decodeTransactGetItemsOutput(ctx aws.Context, reader *cbor.Reader, input *d
 		if err != nil {
 			return output, err
 		}
-		item, err := decodeNonKeyAttributes(ctx, reader, attrListIdToNames, projectionOrdinals)
+		item, err := decodeNonKeyAttributes(ctx, reader, nil, attrListIdToNames, projectionOrdinals)
 		if err != nil {
 			return output, err
 		}
@@ -853,7 +815,7 @@ func decodeTransactGetItemsOutput(ctx aws.Context, reader *cbor.Reader, input *d
 	if numCC > 0 {
 		output.ConsumedCapacity = make([]*dynamodb.ConsumedCapacity, numCC)
 		for i := 0; i < numCC; i++ {
-			if output.ConsumedCapacity[i], err = decodeConsumedCapacityExtended(reader); err != nil {
+			if output.ConsumedCapacity[i], err = decodeConsumedCapacity(reader); err != nil {
 				return output, err
 			}
 		}
@@ -862,7 +824,9 @@ func decodeTransactGetItemsOutput(ctx aws.Context, reader *cbor.Reader, input *d
 	return output, nil
 }
 
-func decodeScanQueryItems(ctx aws.Context, reader *cbor.Reader, table string, keySchemaCache *lru.Lru, attrNamesListToId *lru.Lru, projectionOrdinals []documentPath) ([]map[string]*dynamodb.AttributeValue, error) {
+// Items are decoded as they are read from the connection, the page is never buffered as a whole.
+// count, when known, is the number of items expected in the response.
+func decodeScanQueryItems(ctx aws.Context, reader *cbor.Reader, table string, count *int64, keySchemaCache *lru.Lru, attrNamesListToId *lru.Lru, projectionOrdinals []documentPath) ([]map[string]*dynamodb.AttributeValue, error) {
 	consumed, err := consumeNil(reader)
 	if err != nil {
 		return nil, err
@@ -872,9 +836,18 @@ func decodeScanQueryItems(ctx aws.Context, reader *cbor.Reader, table string, ke
 	}
 
 	items := []map[string]*dynamodb.AttributeValue{}
+	if count != nil && *count > 0 && *count <= maxPresizedItems {
+		items = make([]map[string]*dynamodb.AttributeValue, 0, *count)
+	}
+	sized := func(len int) {
+		if len > cap(items) && len <= maxPresizedItems {
+			items = make([]map[string]*dynamodb.AttributeValue, 0, len)
+		}
+	}
+	d := &cbor.ItemDecoder{}
 	if len(projectionOrdinals) > 0 {
-		err := consumeArray(reader, func(reader *cbor.Reader) error {
-			i, err := decodeProjection(reader, projectionOrdinals)
+		err := consumeSizedArray(reader, sized, func(reader *cbor.Reader) error {
+			i, err := decodeProjection(reader, d, projectionOrdinals)
 			if err != nil {
 				return err
 			}
@@ -889,7 +862,7 @@ func decodeScanQueryItems(ctx aws.Context, reader *cbor.Reader, table string, ke
 		if err != nil {
 			return nil, err
 		}
-		err = consumeArray(reader, func(reader *cbor.Reader) error {
+		err = consumeSizedArray(reader, sized, func(reader *cbor.Reader) error {
 			len, err := reader.ReadArrayLength()
 			if err != nil {
 				return err
@@ -901,7 +874,7 @@ func decodeScanQueryItems(ctx aws.Context, reader *cbor.Reader, table string, ke
 			if err != nil {
 				return err
 			}
-			item, err := decodeNonKeyAttributes(ctx, reader, attrNamesListToId, projectionOrdinals)
+			item, err := decodeNonKeyAttributes(ctx, reader, d, attrNamesListToId, projectionOrdinals)
 			if err != nil {
 				return err
 			}
@@ -939,6 +912,11 @@ func decodeLastEvaluatedKey(ctx aws.Context, reader *cbor.Reader, table string,
 }
 
 func consumeArray(reader *cbor.Reader, consumer func(reader *cbor.Reader) error) error {
+	return consumeSizedArray(reader, nil, consumer)
+}
+
+// Like consumeArray, first calling sized with the number of elements unless the array has an indefinite length.
+func consumeSizedArray(reader *cbor.Reader, sized func(len int), consumer func(reader *cbor.Reader) error) error {
 	hdr, err := reader.PeekHeader()
 	if err != nil {
 		return err
@@ -949,6 +927,8 @@ func consumeArray(reader *cbor.Reader, consumer func(reader *cbor.Reader) error)
 	}
 	if hdr == cbor.ArrayStream {
 		len = -1
+	} else if sized != nil {
+		sized(len)
 	}
 	for i := 0; len < 0 || i < len; i++ {
 		if len < 0 {
@@ -1093,7 +1073,7 @@ func decodeCompoundKey(reader *cbor.Reader) (map[string]*dynamodb.AttributeValue
 	return key, nil
 }
 
-func decodeNonKeyAttributes(ctx aws.Context, reader *cbor.Reader, attrNamesListToId *lru.Lru, projectionOrdinals []documentPath) (map[string]*dynamodb.AttributeValue, error) {
+func decodeNonKeyAttributes(ctx aws.Context, reader *cbor.Reader, d *cbor.ItemDecoder, attrNamesListToId *lru.Lru, projectionOrdinals []documentPath) (map[string]*dynamodb.AttributeValue, error) {
 	hdr, err := reader.PeekHeader()
 	if err != nil {
 		return nil, err
@@ -1112,26 +1092,26 @@ func decodeNonKeyAttributes(ctx aws.Context, reader *cbor.Reader, attrNamesListT
 			return nil, err
 		}
 		defer r.Close()
-		item, err := cbor.DecodeItemNonKeyAttributes(ctx, r, attrNamesListToId)
+		item, err := d.DecodeItemNonKeyAttributes(ctx, r, attrNamesListToId)
 		if err != nil {
 			return nil, err
 		}
 		return item, nil
 	case cbor.Map:
-		return decodeProjection(reader, projectionOrdinals)
+		return decodeProjection(reader, d, projectionOrdinals)
 	}
 	return nil, awserr.New(request.ErrCodeSerialization, fmt.Sprintf("unexpected cbor type %v", hdr), nil)
 
 }
 
-func decodeProjection(reader *cbor.Reader, projectionOrdinals []documentPath) (map[string]*dynamodb.AttributeValue, error) {
+func decodeProjection(reader *cbor.Reader, d *cbor.ItemDecoder, projectionOrdinals []documentPath) (map[string]*dynamodb.AttributeValue, error) {
 	ib := &itemBuilder{}
 	err := consumeMap(reader, func(ord int, r *cbor.Reader) error {
-		if ord > len(projectionOrdinals) {
+		if ord < 0 || ord >= len(projectionOrdinals) {
 			return awserr.New(request.ErrCodeSerialization, fmt.Sprintf("unexpected ordinal %v", ord), nil)
 		}
 		p := projectionOrdinals[ord]
-		v, err := cbor.DecodeAttributeValue(r)
+		v, err := d.DecodeAttributeValue(r)
 		if err != nil {
 			return err
 		}
@@ -1144,7 +1124,12 @@ func decodeProjection(reader *cbor.Reader, projectionOrdinals []documentPath) (m
 	return ib.toItem(), nil
 }
 
+// Decodes the attributes returned for UPDATED_OLD and UPDATED_NEW, the values of the updated attributes by their
+// ordinal in an attribute list.
 func decodeAttributeProjection(ctx aws.Context, reader *cbor.Reader, attrListIdToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error) {
+	if consumed, err := consumeNil(reader); err != nil || consumed {
+		return nil, err
+	}
 	r, err := reader.BytesReader()
 	if err != nil {
 		return nil, err
@@ -1165,7 +1150,7 @@ func decodeAttributeProjection(ctx aws.Context, reader *cbor.Reader, attrListIdT
 	}
 	attrs := make(map[string]*dynamodb.AttributeValue)
 	err = consumeMap(r, func(ord int, reader *cbor.Reader) error {
-		if ord > len(ans) {
+		if ord < 0 || ord >= len(ans) {
 			return awserr.New(request.ErrCodeSerialization, "invalid ordinal", nil)
 		}
 		av, err := cbor.DecodeAttributeValue(reader)
@@ -1175,9 +1160,16 @@ func decodeAttributeProjection(ctx aws.Context, reader *cbor.Reader, attrListIdT
 		attrs[ans[ord]] = av
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 	return attrs, nil
 }
 
+// Decodes the consumed capacity of a response, either in the legacy form of a
+// byte string holding the table name, capacity units, table capacity and the
+// capacity of each global and local secondary index, or as a map of the
+// extended form, which also carries the read and write capacity units.
 func decodeConsumedCapacity(reader *cbor.Reader) (*dynamodb.ConsumedCapacity, error) {
 	consumed, err := consumeNil(reader)
 	if err != nil {
@@ -1187,6 +1179,13 @@ func decodeConsumedCapacity(reader *cbor.Reader) (*dynamodb.ConsumedCapacity, er
 		return nil, nil
 	}
 
+	hdr, err := reader.PeekHeader()
+	if err != nil {
+		return nil, err
+	}
+	if hdr&cbor.MajorTypeMask == cbor.Map {
+		return decodeConsumedCapacityExtended(reader)
+	}
 	if _, err := reader.ReadBytesLength(); err != nil {
 		return nil, err
 	}
@@ -1412,6 +1411,52 @@ func decodeItemCollectionMetrics(reader *cbor.Reader, partitionKey string) (*dyn
 	return &icm, nil
 }
 
+// Decodes the item collection metrics of the tables written by a request.
+// Tables without metrics are left out, and nil is returned when none has any.
+func decodeItemCollectionMetricsByTable(ctx aws.Context, reader *cbor.Reader, keySchemaCache *lru.Lru) (map[string][]*dynamodb.ItemCollectionMetrics, error) {
+	numTables, err := reader.ReadMapLength()
+	if err != nil {
+		return nil, err
+	}
+	var byTable map[string][]*dynamodb.ItemCollectionMetrics
+	for i := 0; i < numTables; i++ {
+		table, err := reader.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		numMetrics, err := reader.ReadArrayLength()
+		if err != nil {
+			return nil, err
+		}
+		if numMetrics == 0 {
+			continue
+		}
+		keys, err := getKeySchema(ctx, keySchemaCache, table)
+		if err != nil {
+			return nil, err
+		}
+		pkey := *keys[0].AttributeName
+		var metrics []*dynamodb.ItemCollectionMetrics
+		for j := 0; j < numMetrics; j++ {
+			m, err := decodeItemCollectionMetrics(reader, pkey)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		if byTable == nil {
+			byTable = make(map[string][]*dynamodb.ItemCollectionMetrics, numTables)
+		}
+		byTable[table] = metrics
+	}
+	return byTable, nil
+}
+
 func getKeySchema(ctx aws.Context, keySchemaCache *lru.Lru, table string) ([]dynamodb.AttributeDefinition, error) {
 	k, err := keySchemaCache.GetWithContext(ctx, table)
 	if err != nil {
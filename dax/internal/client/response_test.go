@@ -0,0 +1,970 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/require"
+)
+
+var scanTestKeyDef = []dynamodb.AttributeDefinition{
+	{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+	{AttributeName: aws.String("rk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+}
+
+// Attribute list caches resolving ids to the sorted list of names, as ids are assigned by the server.
+func scanTestAttrListCaches() (namesToId, idToNames *lru.Lru) {
+	ids := map[string]int64{}
+	lists := map[int64][]string{}
+	namesToId = &lru.Lru{
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			names := key.([]string)
+			k := fmt.Sprint(names)
+			id, ok := ids[k]
+			if !ok {
+				id = int64(len(ids) + 1)
+				ids[k] = id
+				lists[id] = names
+			}
+			return id, nil
+		},
+		KeyMarshaller: func(key lru.Key) lru.Key {
+			return fmt.Sprint(key.([]string))
+		},
+	}
+	idToNames = &lru.Lru{
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			return lists[key.(int64)], nil
+		},
+	}
+	return namesToId, idToNames
+}
+
+func scanTestKeySchema() *lru.Lru {
+	return &lru.Lru{
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			return scanTestKeyDef, nil
+		},
+	}
+}
+
+// Encodes a scan response the way the server does, writing Count before or after the items.
+func encodeScanResponse(items []map[string]*dynamodb.AttributeValue, countFirst bool, namesToId *lru.Lru) ([]byte, error) {
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	writeCount := func() error {
+		if err := w.WriteInt(responseParamCount); err != nil {
+			return err
+		}
+		return w.WriteInt(len(items))
+	}
+	if err := w.WriteMapStreamHeader(); err != nil {
+		return nil, err
+	}
+	if countFirst {
+		if err := writeCount(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.WriteInt(responseParamItems); err != nil {
+		return nil, err
+	}
+	if err := w.WriteArrayHeader(len(items)); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := w.WriteArrayHeader(2); err != nil {
+			return nil, err
+		}
+		if err := cbor.EncodeItemKey(item, scanTestKeyDef, w); err != nil {
+			return nil, err
+		}
+		if err := encodeNonKeyAttributes(nil, item, scanTestKeyDef, namesToId, w); err != nil {
+			return nil, err
+		}
+	}
+	if !countFirst {
+		if err := writeCount(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.WriteStreamBreak(); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeScanResponse(b []byte, idToNames *lru.Lru) (*scanQueryOutput, error) {
+	r := cbor.NewReader(bytes.NewReader(b))
+	defer r.Close()
+	return decodeScanQueryOutput(nil, r, "table", false, nil, nil, nil, scanTestKeySchema(), idToNames)
+}
+
+func randomScanItem(rnd *rand.Rand, i int) map[string]*dynamodb.AttributeValue {
+	attr := func() *dynamodb.AttributeValue {
+		switch rnd.Intn(4) {
+		case 0:
+			return &dynamodb.AttributeValue{S: aws.String(fmt.Sprintf("value-%d", rnd.Intn(1000)))}
+		case 1:
+			return &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(rnd.Int63()))}
+		case 2:
+			return &dynamodb.AttributeValue{BOOL: aws.Bool(rnd.Intn(2) == 0)}
+		default:
+			return &dynamodb.AttributeValue{B: []byte{byte(rnd.Intn(256))}}
+		}
+	}
+	item := map[string]*dynamodb.AttributeValue{
+		"hk": {S: aws.String(fmt.Sprintf("user#%d", i%97))},
+		"rk": {N: aws.String(fmt.Sprint(i))},
+	}
+	for _, n := range []string{"name", "status", "score"} {
+		if rnd.Intn(4) > 0 {
+			item[n] = attr()
+		}
+	}
+	address := map[string]*dynamodb.AttributeValue{"street": attr(), "city": attr(), "zip": attr()}
+	if rnd.Intn(2) == 0 {
+		address["unique-"+fmt.Sprint(rnd.Intn(1000))] = attr()
+	}
+	item["address"] = &dynamodb.AttributeValue{M: address}
+	events := make([]*dynamodb.AttributeValue, rnd.Intn(4))
+	for j := range events {
+		events[j] = &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"type": attr(), "at": attr()}}
+	}
+	item["events"] = &dynamodb.AttributeValue{L: events}
+	return item
+}
+
+func TestDecodeScanQueryOutput_RoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 10, 500} {
+		items := make([]map[string]*dynamodb.AttributeValue, n)
+		for i := range items {
+			items[i] = randomScanItem(rnd, i)
+		}
+		for _, countFirst := range []bool{false, true} {
+			namesToId, idToNames := scanTestAttrListCaches()
+			b, err := encodeScanResponse(items, countFirst, namesToId)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			out, err := decodeScanResponse(b, idToNames)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(items, out.Items) {
+				t.Errorf("%d items, count first %v: decoded items differ from encoded ones", n, countFirst)
+			}
+			if out.Count == nil || *out.Count != int64(n) {
+				t.Errorf("expected count %d, got %v", n, out.Count)
+			}
+		}
+	}
+}
+
+func TestDecodeScanQueryOutput_Truncated(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	items := []map[string]*dynamodb.AttributeValue{randomScanItem(rnd, 0), randomScanItem(rnd, 1)}
+	namesToId, idToNames := scanTestAttrListCaches()
+	b, err := encodeScanResponse(items, false, namesToId)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for i := 0; i < len(b); i++ {
+		if _, err := decodeScanResponse(b[:i], idToNames); err == nil {
+			t.Errorf("expected error decoding the first %d of %d bytes", i, len(b))
+		}
+	}
+}
+
+// Builds a page of random items encoding to at least size bytes.
+func buildScanPage(tb testing.TB, size int, seed int64, namesToId *lru.Lru) ([]map[string]*dynamodb.AttributeValue, []byte) {
+	rnd := rand.New(rand.NewSource(seed))
+	var items []map[string]*dynamodb.AttributeValue
+	var page []byte
+	for len(page) < size {
+		for i := 0; i < 500; i++ {
+			items = append(items, randomScanItem(rnd, len(items)))
+		}
+		var err error
+		if page, err = encodeScanResponse(items, false, namesToId); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return items, page
+}
+
+// Sends a request to the endpoints server, decoding its response as a scan page.
+func scanOverConnection(ctx context.Context, cli *SingleDaxClient, idToNames *lru.Lru) (*scanQueryOutput, error) {
+	var out *scanQueryOutput
+	err := cli.executeWithContext(ctx, OpScan, func(writer *cbor.Writer) error {
+		return encodeServiceAndMethod(endpoints_455855874_1_Id, writer)
+	}, func(reader *cbor.Reader) error {
+		var err error
+		out, err = decodeScanQueryOutput(ctx, reader, "table", false, nil, nil, nil, scanTestKeySchema(), idToNames)
+		return err
+	}, RequestOptions{Context: ctx})
+	return out, err
+}
+
+func TestSingleClient_ScanLargePage(t *testing.T) {
+	namesToId, idToNames := scanTestAttrListCaches()
+	items, page := buildScanPage(t, 400*1024, 4, namesToId)
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		if _, err := w.Write([]byte{cbor.Array + 0}); err != nil {
+			return err
+		}
+		if conn == 0 {
+			// break the connection in the middle of the page
+			if _, err := w.Write(page[:len(page)/2]); err != nil {
+				return err
+			}
+			return errors.New("close")
+		}
+		_, err := w.Write(page)
+		return err
+	})
+	defer listener.Close()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	ctx, cfn := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cfn()
+	_, err = scanOverConnection(ctx, cli, idToNames)
+	require.Error(t, err)
+	require.Equal(t, int64(1), cli.Stats().DiscardedConnections)
+
+	out, err := scanOverConnection(ctx, cli, idToNames)
+	require.NoError(t, err)
+	require.Equal(t, len(items), len(out.Items))
+	require.True(t, reflect.DeepEqual(items, out.Items), "decoded items differ from encoded ones")
+	require.Equal(t, int64(1), cli.Stats().DiscardedConnections)
+}
+
+func BenchmarkDecodeScanQueryOutput_1MB(b *testing.B) {
+	namesToId, idToNames := scanTestAttrListCaches()
+	_, page := buildScanPage(b, 1024*1024, 3, namesToId)
+	// resolve the attribute lists upfront, as a warm client would
+	if _, err := decodeScanResponse(page, idToNames); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeScanResponse(page, idToNames); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Compared to BenchmarkDecodeScanQueryOutput_1MB, shows the memory used to read a page from a connection
+// beyond the decoded items, as items are decoded while the page is received.
+func BenchmarkSingleClient_Scan1MB(b *testing.B) {
+	namesToId, idToNames := scanTestAttrListCaches()
+	_, page := buildScanPage(b, 1024*1024, 3, namesToId)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer listener.Close()
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveEndpoints(conn, n, func(conn int, w io.Writer) error {
+				if _, err := w.Write([]byte{cbor.Array + 0}); err != nil {
+					return err
+				}
+				_, err := w.Write(page)
+				return err
+			})
+		}
+	}()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(b, err)
+	defer cli.Close()
+	if _, err := scanOverConnection(context.Background(), cli, idToNames); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scanOverConnection(context.Background(), cli, idToNames); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The capacity consumed on a table through an index of each kind, as returned for ReturnConsumedCapacity INDEXES.
+// Only the extended form carries read and write capacity units.
+func consumedCapacityTestValue(table string, extended bool) *dynamodb.ConsumedCapacity {
+	capacity := func(units, read, write float64) *dynamodb.Capacity {
+		c := &dynamodb.Capacity{CapacityUnits: aws.Float64(units)}
+		if extended {
+			c.ReadCapacityUnits, c.WriteCapacityUnits = aws.Float64(read), aws.Float64(write)
+		}
+		return c
+	}
+	cc := &dynamodb.ConsumedCapacity{
+		TableName:              aws.String(table),
+		CapacityUnits:          aws.Float64(7.5),
+		Table:                  capacity(3, 1, 2),
+		GlobalSecondaryIndexes: map[string]*dynamodb.Capacity{"gsi": capacity(0.5, 0.5, 0), "gsi2": capacity(1.25, 0, 1.25)},
+		LocalSecondaryIndexes:  map[string]*dynamodb.Capacity{"lsi": capacity(3.5, 1.5, 2)},
+	}
+	if extended {
+		cc.ReadCapacityUnits, cc.WriteCapacityUnits = aws.Float64(3), aws.Float64(4.5)
+	}
+	return cc
+}
+
+// Writes capacity units the way a minimizing encoder does, as integers or
+// half-precision floats when they fit.
+func writeUnits(w *cbor.Writer, units *float64) error {
+	switch f := aws.Float64Value(units); {
+	case f == float64(int(f)):
+		return w.WriteInt(int(f))
+	case f == 0.5:
+		return w.Write([]byte{cbor.Float16, 0x38, 0x00})
+	default:
+		return w.WriteFloat64(f)
+	}
+}
+
+func writeIndexCapacity(w *cbor.Writer, indexes map[string]*dynamodb.Capacity, write func(*dynamodb.Capacity) error) error {
+	if indexes == nil {
+		return w.WriteNull()
+	}
+	if err := w.WriteMapHeader(len(indexes)); err != nil {
+		return err
+	}
+	for name, c := range indexes {
+		if err := w.WriteString(name); err != nil {
+			return err
+		}
+		if err := write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encodes the legacy form of consumed capacity, a byte string holding the capacity units of the table and its indexes.
+func encodeConsumedCapacity(w *cbor.Writer, cc *dynamodb.ConsumedCapacity) error {
+	var buf bytes.Buffer
+	inner := cbor.NewWriter(&buf)
+	defer inner.Close()
+	units := func(c *dynamodb.Capacity) error { return writeUnits(inner, c.CapacityUnits) }
+	if err := inner.WriteString(aws.StringValue(cc.TableName)); err != nil {
+		return err
+	}
+	if err := writeUnits(inner, cc.CapacityUnits); err != nil {
+		return err
+	}
+	if cc.Table == nil {
+		if err := inner.WriteNull(); err != nil {
+			return err
+		}
+	} else if err := units(cc.Table); err != nil {
+		return err
+	}
+	if err := writeIndexCapacity(inner, cc.GlobalSecondaryIndexes, units); err != nil {
+		return err
+	}
+	if err := writeIndexCapacity(inner, cc.LocalSecondaryIndexes, units); err != nil {
+		return err
+	}
+	if err := inner.Flush(); err != nil {
+		return err
+	}
+	return w.WriteBytes(buf.Bytes())
+}
+
+type capacityField struct {
+	key   int
+	write func() error
+}
+
+func writeCapacityFields(w *cbor.Writer, fields []capacityField) error {
+	if err := w.WriteMapStreamHeader(); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.write == nil {
+			continue
+		}
+		if err := w.WriteInt(f.key); err != nil {
+			return err
+		}
+		if err := f.write(); err != nil {
+			return err
+		}
+	}
+	return w.WriteStreamBreak()
+}
+
+func unitsField(w *cbor.Writer, key int, units *float64) capacityField {
+	if units == nil {
+		return capacityField{key: key}
+	}
+	return capacityField{key, func() error { return writeUnits(w, units) }}
+}
+
+func writeCapacity(w *cbor.Writer, c *dynamodb.Capacity) error {
+	return writeCapacityFields(w, []capacityField{
+		unitsField(w, capacityUnits, c.CapacityUnits),
+		unitsField(w, readCapacityUnits, c.ReadCapacityUnits),
+		unitsField(w, writeCapacityUnits, c.WriteCapacityUnits),
+	})
+}
+
+// Encodes the extended form of consumed capacity, a map of its fields.
+func encodeConsumedCapacityExtended(w *cbor.Writer, cc *dynamodb.ConsumedCapacity) error {
+	write := func(c *dynamodb.Capacity) error { return writeCapacity(w, c) }
+	return writeCapacityFields(w, []capacityField{
+		{tableName, func() error { return w.WriteString(aws.StringValue(cc.TableName)) }},
+		unitsField(w, capacityUnits, cc.CapacityUnits),
+		unitsField(w, readCapacityUnits, cc.ReadCapacityUnits),
+		unitsField(w, writeCapacityUnits, cc.WriteCapacityUnits),
+		{table, func() error { return write(cc.Table) }},
+		{globalSecondaryIndexes, func() error { return writeIndexCapacity(w, cc.GlobalSecondaryIndexes, write) }},
+		{localSecondaryIndexes, func() error { return writeIndexCapacity(w, cc.LocalSecondaryIndexes, write) }},
+	})
+}
+
+func TestDecodeConsumedCapacity(t *testing.T) {
+	ctx := context.Background()
+	writeItemResponse := func(w *cbor.Writer, write func() error) error {
+		if err := w.WriteMapHeader(1); err != nil {
+			return err
+		}
+		if err := w.WriteInt(responseParamConsumedCapacity); err != nil {
+			return err
+		}
+		return write()
+	}
+	writeList := func(w *cbor.Writer, n int, write func(i int) error) error {
+		if err := w.WriteArrayHeader(n); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := write(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	single := func(cc *dynamodb.ConsumedCapacity) []*dynamodb.ConsumedCapacity {
+		if cc == nil {
+			return nil
+		}
+		return []*dynamodb.ConsumedCapacity{cc}
+	}
+
+	// Each case writes a response of the operation with the encoded consumed capacities, in the
+	// operation's layout, and returns those decoded from it. Single table operations have one.
+	cases := []struct {
+		op      string
+		tables  int
+		encode  func(w *cbor.Writer, write func(i int) error) error
+		decoded func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error)
+	}{
+		{
+			op: OpGetItem, tables: 1,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				return writeItemResponse(w, func() error { return write(0) })
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeGetItemOutput(ctx, r, &dynamodb.GetItemInput{TableName: aws.String("table0")}, nil, nil)
+				return single(out.ConsumedCapacity), err
+			},
+		},
+		{
+			op: OpPutItem, tables: 1,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				return writeItemResponse(w, func() error { return write(0) })
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodePutItemOutput(ctx, r, &dynamodb.PutItemInput{TableName: aws.String("table0")}, nil, nil, nil)
+				return single(out.ConsumedCapacity), err
+			},
+		},
+		{
+			op: OpUpdateItem, tables: 1,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				return writeItemResponse(w, func() error { return write(0) })
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeUpdateItemOutput(ctx, r, &dynamodb.UpdateItemInput{TableName: aws.String("table0")}, nil, nil, nil)
+				return single(out.ConsumedCapacity), err
+			},
+		},
+		{
+			op: OpDeleteItem, tables: 1,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				return writeItemResponse(w, func() error { return write(0) })
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeDeleteItemOutput(ctx, r, &dynamodb.DeleteItemInput{TableName: aws.String("table0")}, nil, nil, nil)
+				return single(out.ConsumedCapacity), err
+			},
+		},
+		{
+			op: OpQuery, tables: 1,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				return writeItemResponse(w, func() error { return write(0) })
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeQueryOutput(ctx, r, &dynamodb.QueryInput{TableName: aws.String("table0")}, nil, nil, nil)
+				return single(out.ConsumedCapacity), err
+			},
+		},
+		{
+			op: OpScan, tables: 1,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				return writeItemResponse(w, func() error { return write(0) })
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeScanOutput(ctx, r, &dynamodb.ScanInput{TableName: aws.String("table0")}, nil, nil, nil)
+				return single(out.ConsumedCapacity), err
+			},
+		},
+		{
+			op: OpBatchGetItem, tables: 2,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				// responses and unprocessed keys, followed by the consumed capacity of each table
+				if err := w.WriteArrayHeader(2); err != nil {
+					return err
+				}
+				if err := w.WriteMapHeader(0); err != nil {
+					return err
+				}
+				if err := w.WriteMapHeader(0); err != nil {
+					return err
+				}
+				return writeList(w, 2, write)
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeBatchGetItemOutput(ctx, r, &dynamodb.BatchGetItemInput{}, nil, nil, nil)
+				return out.ConsumedCapacity, err
+			},
+		},
+		{
+			op: OpBatchWriteItem, tables: 2,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				// unprocessed items, the consumed capacity of each table and item collection metrics
+				if err := w.WriteMapHeader(0); err != nil {
+					return err
+				}
+				if err := writeList(w, 2, write); err != nil {
+					return err
+				}
+				return w.WriteMapHeader(0)
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeBatchWriteItemOutput(ctx, r, nil, nil, nil)
+				return out.ConsumedCapacity, err
+			},
+		},
+		{
+			op: OpTransactGetItems, tables: 2,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				// responses, followed by the consumed capacity of each table
+				if err := w.WriteArrayHeader(2); err != nil {
+					return err
+				}
+				if err := w.WriteArrayHeader(0); err != nil {
+					return err
+				}
+				return writeList(w, 2, write)
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeTransactGetItemsOutput(ctx, r, &dynamodb.TransactGetItemsInput{}, nil, nil, nil)
+				return out.ConsumedCapacity, err
+			},
+		},
+		{
+			op: OpTransactWriteItems, tables: 2,
+			encode: func(w *cbor.Writer, write func(int) error) error {
+				// return values, the consumed capacity of each table and item collection metrics
+				if err := w.WriteArrayHeader(3); err != nil {
+					return err
+				}
+				if err := w.WriteArrayHeader(0); err != nil {
+					return err
+				}
+				if err := writeList(w, 2, write); err != nil {
+					return err
+				}
+				return w.WriteMapHeader(0)
+			},
+			decoded: func(r *cbor.Reader) ([]*dynamodb.ConsumedCapacity, error) {
+				out, err := decodeTransactWriteItemsOutput(ctx, r, &dynamodb.TransactWriteItemsInput{}, nil, nil, nil)
+				return out.ConsumedCapacity, err
+			},
+		},
+	}
+	forms := []struct {
+		name     string
+		extended bool
+		encode   func(*cbor.Writer, *dynamodb.ConsumedCapacity) error
+	}{
+		{"legacy", false, encodeConsumedCapacity},
+		{"extended", true, encodeConsumedCapacityExtended},
+	}
+	for _, c := range cases {
+		for _, form := range forms {
+			t.Run(c.op+"/"+form.name, func(t *testing.T) {
+				expected := make([]*dynamodb.ConsumedCapacity, c.tables)
+				for i := range expected {
+					expected[i] = consumedCapacityTestValue(fmt.Sprintf("table%d", i), form.extended)
+				}
+				var buf bytes.Buffer
+				w := cbor.NewWriter(&buf)
+				defer w.Close()
+				require.NoError(t, c.encode(w, func(i int) error { return form.encode(w, expected[i]) }))
+				require.NoError(t, w.Flush())
+
+				r := cbor.NewReader(&buf)
+				defer r.Close()
+				decoded, err := c.decoded(r)
+				require.NoError(t, err)
+				require.Equal(t, expected, decoded)
+				_, err = r.PeekHeader()
+				require.Equal(t, io.EOF, err, "the response must be fully consumed")
+			})
+		}
+	}
+}
+
+// Encodes item collection metrics the way the server does, as a byte string holding the partition key value and the
+// bounds of the size estimate.
+func encodeItemCollectionMetrics(w *cbor.Writer, m *dynamodb.ItemCollectionMetrics) error {
+	if m == nil {
+		return w.WriteNull()
+	}
+	var buf bytes.Buffer
+	inner := cbor.NewWriter(&buf)
+	defer inner.Close()
+	for _, v := range m.ItemCollectionKey {
+		if err := cbor.EncodeAttributeValue(v, inner); err != nil {
+			return err
+		}
+	}
+	for _, f := range m.SizeEstimateRangeGB {
+		if err := writeUnits(inner, f); err != nil {
+			return err
+		}
+	}
+	if err := inner.Flush(); err != nil {
+		return err
+	}
+	return w.WriteBytes(buf.Bytes())
+}
+
+func encodeItemCollectionMetricsByTable(w *cbor.Writer, byTable map[string][]*dynamodb.ItemCollectionMetrics) error {
+	if err := w.WriteMapHeader(len(byTable)); err != nil {
+		return err
+	}
+	for table, metrics := range byTable {
+		if err := w.WriteString(table); err != nil {
+			return err
+		}
+		if err := w.WriteArrayHeader(len(metrics)); err != nil {
+			return err
+		}
+		for _, m := range metrics {
+			if err := encodeItemCollectionMetrics(w, m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func itemCollectionMetricsTestValue(hk string, lo, hi float64) *dynamodb.ItemCollectionMetrics {
+	return &dynamodb.ItemCollectionMetrics{
+		ItemCollectionKey:   map[string]*dynamodb.AttributeValue{"hk": {S: aws.String(hk)}},
+		SizeEstimateRangeGB: []*float64{aws.Float64(lo), aws.Float64(hi)},
+	}
+}
+
+func TestDecodeItemCollectionMetrics(t *testing.T) {
+	ctx := context.Background()
+	metrics := itemCollectionMetricsTestValue("a", 0.5, 1.5)
+	encode := func(t *testing.T, write func(w *cbor.Writer) error) *cbor.Reader {
+		var buf bytes.Buffer
+		w := cbor.NewWriter(&buf)
+		defer w.Close()
+		require.NoError(t, write(w))
+		require.NoError(t, w.Flush())
+		return cbor.NewReader(&buf)
+	}
+	// A response of an item operation, with the item collection metrics if not nil.
+	itemResponse := func(m *dynamodb.ItemCollectionMetrics, returned bool) func(w *cbor.Writer) error {
+		return func(w *cbor.Writer) error {
+			if !returned {
+				return w.WriteMapHeader(0)
+			}
+			if err := w.WriteMapHeader(1); err != nil {
+				return err
+			}
+			if err := w.WriteInt(responseParamItemCollectionMetrics); err != nil {
+				return err
+			}
+			return encodeItemCollectionMetrics(w, m)
+		}
+	}
+	decoders := map[string]func(r *cbor.Reader) (*dynamodb.ItemCollectionMetrics, error){
+		OpPutItem: func(r *cbor.Reader) (*dynamodb.ItemCollectionMetrics, error) {
+			out, err := decodePutItemOutput(ctx, r, &dynamodb.PutItemInput{TableName: aws.String("table")}, scanTestKeySchema(), nil, nil)
+			return out.ItemCollectionMetrics, err
+		},
+		OpDeleteItem: func(r *cbor.Reader) (*dynamodb.ItemCollectionMetrics, error) {
+			out, err := decodeDeleteItemOutput(ctx, r, &dynamodb.DeleteItemInput{TableName: aws.String("table")}, scanTestKeySchema(), nil, nil)
+			return out.ItemCollectionMetrics, err
+		},
+		OpUpdateItem: func(r *cbor.Reader) (*dynamodb.ItemCollectionMetrics, error) {
+			out, err := decodeUpdateItemOutput(ctx, r, &dynamodb.UpdateItemInput{TableName: aws.String("table")}, scanTestKeySchema(), nil, nil)
+			return out.ItemCollectionMetrics, err
+		},
+	}
+	for op, decode := range decoders {
+		t.Run(op, func(t *testing.T) {
+			m, err := decode(encode(t, itemResponse(metrics, true)))
+			require.NoError(t, err)
+			require.Equal(t, metrics, m)
+
+			m, err = decode(encode(t, itemResponse(nil, true)))
+			require.NoError(t, err)
+			require.Nil(t, m)
+
+			m, err = decode(encode(t, itemResponse(nil, false)))
+			require.NoError(t, err)
+			require.Nil(t, m, "not requested")
+		})
+	}
+
+	t.Run(OpBatchWriteItem, func(t *testing.T) {
+		cases := []struct {
+			name     string
+			returned map[string][]*dynamodb.ItemCollectionMetrics
+			expected map[string][]*dynamodb.ItemCollectionMetrics
+		}{
+			{"not requested", nil, nil},
+			{"tables without metrics", map[string][]*dynamodb.ItemCollectionMetrics{"table0": {}, "table1": {nil}}, nil},
+			{
+				"tables with metrics",
+				map[string][]*dynamodb.ItemCollectionMetrics{
+					"table0": {metrics, itemCollectionMetricsTestValue("b", 0, 1)},
+					"table1": {},
+					"table2": {itemCollectionMetricsTestValue("c", 2, 3)},
+				},
+				map[string][]*dynamodb.ItemCollectionMetrics{
+					"table0": {metrics, itemCollectionMetricsTestValue("b", 0, 1)},
+					"table2": {itemCollectionMetricsTestValue("c", 2, 3)},
+				},
+			},
+		}
+		for _, c := range cases {
+			r := encode(t, func(w *cbor.Writer) error {
+				// unprocessed items, consumed capacity and item collection metrics
+				if err := w.WriteMapHeader(0); err != nil {
+					return err
+				}
+				if err := w.WriteArrayHeader(0); err != nil {
+					return err
+				}
+				return encodeItemCollectionMetricsByTable(w, c.returned)
+			})
+			out, err := decodeBatchWriteItemOutput(ctx, r, scanTestKeySchema(), nil, nil)
+			require.NoError(t, err, c.name)
+			require.Equal(t, c.expected, out.ItemCollectionMetrics, c.name)
+		}
+	})
+}
+
+func TestDecodeReturnValues(t *testing.T) {
+	ctx := context.Background()
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("user#1")}, "rk": {N: aws.String("7")}}
+	item := map[string]*dynamodb.AttributeValue{
+		"hk":    key["hk"],
+		"rk":    key["rk"],
+		"count": {N: aws.String("42")},
+		"doc": {M: map[string]*dynamodb.AttributeValue{
+			"name":   {S: aws.String("name")},
+			"tags":   {L: []*dynamodb.AttributeValue{{S: aws.String("a")}, {N: aws.String("1")}, {NULL: aws.Bool(true)}}},
+			"nested": {M: map[string]*dynamodb.AttributeValue{"flag": {BOOL: aws.Bool(false)}}},
+		}},
+		"ss": {SS: []*string{aws.String("x"), aws.String("y")}},
+		"ns": {NS: []*string{aws.String("1"), aws.String("25")}},
+		"bs": {BS: [][]byte{{1}, {2, 3}}},
+	}
+	// the attributes returned for UPDATED_OLD and UPDATED_NEW, as DynamoDB only returns the updated paths of documents
+	updated := map[string]*dynamodb.AttributeValue{
+		"count": item["count"],
+		"doc":   {M: map[string]*dynamodb.AttributeValue{"nested": item["doc"].M["nested"]}},
+		"ss":    item["ss"],
+	}
+
+	// The response returned by the server: no attributes, attributes encoded as a whole item, or as the values of an
+	// attribute list.
+	type response int
+	const (
+		none response = iota
+		null
+		all
+		projected
+	)
+	encode := func(t *testing.T, resp response, namesToId *lru.Lru) *cbor.Reader {
+		var buf bytes.Buffer
+		w := cbor.NewWriter(&buf)
+		defer w.Close()
+		if resp == none {
+			require.NoError(t, w.WriteMapHeader(0))
+		} else {
+			require.NoError(t, w.WriteMapHeader(1))
+			require.NoError(t, w.WriteInt(responseParamAttributes))
+		}
+		switch resp {
+		case null:
+			require.NoError(t, w.WriteNull())
+		case all:
+			require.NoError(t, encodeNonKeyAttributes(ctx, item, scanTestKeyDef, namesToId, w))
+		case projected:
+			names := make([]string, 0, len(updated))
+			for n := range updated {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			id, err := namesToId.GetWithContext(ctx, names)
+			require.NoError(t, err)
+			var attrs bytes.Buffer
+			aw := cbor.NewWriter(&attrs)
+			defer aw.Close()
+			require.NoError(t, aw.WriteInt64(id.(int64)))
+			require.NoError(t, aw.WriteMapHeader(len(names)))
+			for i, n := range names {
+				require.NoError(t, aw.WriteInt(i))
+				require.NoError(t, cbor.EncodeAttributeValue(updated[n], aw))
+			}
+			require.NoError(t, aw.Flush())
+			require.NoError(t, w.WriteBytes(attrs.Bytes()))
+		}
+		require.NoError(t, w.Flush())
+		return cbor.NewReader(&buf)
+	}
+
+	decoders := map[string]func(r *cbor.Reader, rv string, idToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error){
+		OpPutItem: func(r *cbor.Reader, rv string, idToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error) {
+			input := &dynamodb.PutItemInput{TableName: aws.String("table"), Item: item, ReturnValues: aws.String(rv)}
+			out, err := decodePutItemOutput(ctx, r, input, scanTestKeySchema(), idToNames, nil)
+			return out.Attributes, err
+		},
+		OpDeleteItem: func(r *cbor.Reader, rv string, idToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error) {
+			input := &dynamodb.DeleteItemInput{TableName: aws.String("table"), Key: key, ReturnValues: aws.String(rv)}
+			out, err := decodeDeleteItemOutput(ctx, r, input, scanTestKeySchema(), idToNames, nil)
+			return out.Attributes, err
+		},
+		OpUpdateItem: func(r *cbor.Reader, rv string, idToNames *lru.Lru) (map[string]*dynamodb.AttributeValue, error) {
+			input := &dynamodb.UpdateItemInput{TableName: aws.String("table"), Key: key, ReturnValues: aws.String(rv)}
+			out, err := decodeUpdateItemOutput(ctx, r, input, scanTestKeySchema(), idToNames, nil)
+			return out.Attributes, err
+		},
+	}
+	cases := []struct {
+		op       string
+		rv       string
+		resp     response
+		expected map[string]*dynamodb.AttributeValue
+	}{
+		{OpPutItem, dynamodb.ReturnValueNone, none, nil},
+		{OpPutItem, dynamodb.ReturnValueAllOld, all, item},
+		{OpPutItem, dynamodb.ReturnValueAllOld, null, nil},
+		{OpPutItem, dynamodb.ReturnValueAllOld, none, nil},
+		{OpDeleteItem, dynamodb.ReturnValueNone, none, nil},
+		{OpDeleteItem, dynamodb.ReturnValueAllOld, all, item},
+		{OpDeleteItem, dynamodb.ReturnValueAllOld, null, nil},
+		{OpDeleteItem, dynamodb.ReturnValueAllOld, none, nil},
+		{OpUpdateItem, dynamodb.ReturnValueNone, none, nil},
+		{OpUpdateItem, dynamodb.ReturnValueAllOld, all, item},
+		{OpUpdateItem, dynamodb.ReturnValueAllOld, null, nil},
+		{OpUpdateItem, dynamodb.ReturnValueAllOld, none, nil},
+		{OpUpdateItem, dynamodb.ReturnValueAllNew, all, item},
+		{OpUpdateItem, dynamodb.ReturnValueUpdatedOld, projected, updated},
+		{OpUpdateItem, dynamodb.ReturnValueUpdatedOld, null, nil},
+		{OpUpdateItem, dynamodb.ReturnValueUpdatedOld, none, nil},
+		{OpUpdateItem, dynamodb.ReturnValueUpdatedNew, projected, updated},
+		{OpUpdateItem, dynamodb.ReturnValueUpdatedNew, null, nil},
+	}
+	for _, c := range cases {
+		namesToId, idToNames := scanTestAttrListCaches()
+		attrs, err := decoders[c.op](encode(t, c.resp, namesToId), c.rv, idToNames)
+		require.NoError(t, err, "%s %s", c.op, c.rv)
+		require.Equal(t, c.expected, attrs, "%s %s", c.op, c.rv)
+	}
+}
+
+func TestDecodeAttributeProjectionInvalidOrdinal(t *testing.T) {
+	namesToId, idToNames := scanTestAttrListCaches()
+	id, err := namesToId.GetWithContext(context.Background(), []string{"a", "b"})
+	require.NoError(t, err)
+	for _, ord := range []int{2, -1} {
+		var buf bytes.Buffer
+		w := cbor.NewWriter(&buf)
+		var attrs bytes.Buffer
+		aw := cbor.NewWriter(&attrs)
+		require.NoError(t, aw.WriteInt64(id.(int64)))
+		require.NoError(t, aw.WriteMapHeader(1))
+		require.NoError(t, aw.WriteInt(ord))
+		require.NoError(t, aw.WriteString("value"))
+		require.NoError(t, aw.Flush())
+		require.NoError(t, w.WriteBytes(attrs.Bytes()))
+		require.NoError(t, w.Flush())
+
+		_, err := decodeAttributeProjection(context.Background(), cbor.NewReader(&buf), idToNames)
+		require.Error(t, err, "ordinal %d", ord)
+	}
+}
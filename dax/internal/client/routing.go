@@ -0,0 +1,413 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RoutingPolicy chooses the node of each request, see Config.RoutingPolicy.
+// Its methods may be called concurrently.
+type RoutingPolicy interface {
+	// Pick returns the node of an attempt of op, one of nodes. nodes is never
+	// empty.
+	Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error)
+
+	// Observe is called with the duration and the error, nil on success, of
+	// each attempt once it completes on node.
+	Observe(node NodeInfo, d time.Duration, err error)
+
+	// NodesChanged is called with the nodes of the cluster whenever the
+	// cluster discovers nodes added, removed or changing roles.
+	NodesChanged(nodes []NodeInfo)
+}
+
+// OperationInfo describes an attempt of a request to a RoutingPolicy.
+type OperationInfo struct {
+	// Name is the name of the operation, such as GetItem.
+	Name string
+
+	// Read tells whether the operation only reads items.
+	Read bool
+
+	// Attempt counts the previous attempts of the request, 0 for the first
+	// attempt.
+	Attempt int
+
+	// Previous is the "host:port" address of the node of the previous
+	// attempt, or the empty string.
+	Previous string
+}
+
+// NodeRole is the role of a node in its cluster.
+type NodeRole int
+
+const (
+	// RoleUnknown is the role of the nodes not reporting one.
+	RoleUnknown NodeRole = iota
+	// RoleLeader is the role of the node replicating its writes to the others.
+	RoleLeader
+	// RoleReplica is the role of the other nodes.
+	RoleReplica
+)
+
+func (r NodeRole) String() string {
+	switch r {
+	case RoleLeader:
+		return "leader"
+	case RoleReplica:
+		return "replica"
+	}
+	return "unknown"
+}
+
+// NodeInfo describes a node of the cluster to a RoutingPolicy.
+type NodeInfo struct {
+	// Addr is the "host:port" address of the node.
+	Addr string
+
+	// AZ is the availability zone of the node, empty if unknown.
+	AZ string
+
+	Role NodeRole
+
+	// Healthy is false after an attempt failed to reach the node, until an
+	// attempt reaches it again.
+	Healthy bool
+
+	// Outstanding is the number of attempts in flight on the node.
+	Outstanding int64
+
+	// Priority and Weight are those of the SRV record of the node when the
+	// nodes are discovered from SRV records, zero otherwise.
+	Priority, Weight int
+
+	client DaxAPI
+}
+
+// NewRandomRouting returns the default RoutingPolicy, sending each attempt to
+// a random node other than the node of the previous attempt.
+func NewRandomRouting() RoutingPolicy {
+	return randomRouting{}
+}
+
+type randomRouting struct{}
+
+func (randomRouting) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	n := len(nodes)
+	r := rand.Intn(n)
+	if n > 1 && nodes[r].Addr == op.Previous {
+		r = (r + 1) % n
+	}
+	return nodes[r], nil
+}
+
+func (randomRouting) Observe(NodeInfo, time.Duration, error) {}
+
+func (randomRouting) NodesChanged([]NodeInfo) {}
+
+// NewRoundRobinRouting returns a RoutingPolicy sending the attempts to the
+// nodes in turn.
+func NewRoundRobinRouting() RoutingPolicy {
+	return &roundRobinRouting{}
+}
+
+type roundRobinRouting struct {
+	next uint64 // accessed atomically
+}
+
+func (p *roundRobinRouting) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	n := uint64(len(nodes))
+	i := atomic.AddUint64(&p.next, 1) - 1
+	if n > 1 && nodes[i%n].Addr == op.Previous {
+		i = atomic.AddUint64(&p.next, 1) - 1
+	}
+	return nodes[i%n], nil
+}
+
+func (*roundRobinRouting) Observe(NodeInfo, time.Duration, error) {}
+
+func (*roundRobinRouting) NodesChanged([]NodeInfo) {}
+
+// NewWeightedRouting returns a RoutingPolicy following the priorities and
+// weights of the nodes, as DNS SRV records do: each attempt is sent to one of
+// the healthy nodes of the lowest Priority, other than the node of the
+// previous attempt, chosen at random in proportion to its Weight. Nodes of
+// zero weight are only chosen among nodes of zero weight. When no other node
+// is healthy, the attempt is sent to one of the other nodes of the lowest
+// Priority. It is the default RoutingPolicy with srv HostPorts.
+func NewWeightedRouting() RoutingPolicy {
+	return weightedRouting{}
+}
+
+type weightedRouting struct{}
+
+func (weightedRouting) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	candidates := make([]NodeInfo, 0, len(nodes))
+	for _, healthy := range []bool{true, false} {
+		for _, n := range nodes {
+			if (n.Healthy || !healthy) && (n.Addr != op.Previous || len(nodes) == 1) {
+				candidates = append(candidates, n)
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+
+	var best []NodeInfo
+	total := 0
+	for _, n := range candidates {
+		if len(best) > 0 && n.Priority > best[0].Priority {
+			continue
+		}
+		if len(best) > 0 && n.Priority < best[0].Priority {
+			best, total = best[:0], 0
+		}
+		best = append(best, n)
+		total += n.Weight
+	}
+	if total == 0 {
+		return best[rand.Intn(len(best))], nil
+	}
+	r := rand.Intn(total)
+	for _, n := range best {
+		if r -= n.Weight; r < 0 {
+			return n, nil
+		}
+	}
+	return best[len(best)-1], nil
+}
+
+func (weightedRouting) Observe(NodeInfo, time.Duration, error) {}
+
+func (weightedRouting) NodesChanged([]NodeInfo) {}
+
+// The state of a node of the cluster tracked for its RoutingPolicy.
+type nodeState struct {
+	inFlight int64 // accessed atomically
+	failures int32 // consecutive attempts failing to reach the node, accessed atomically
+
+	role             int32 // NodeRole, accessed atomically
+	priority, weight int32 // accessed atomically
+
+	addr string
+	az   string
+}
+
+func newNodeState(ep serviceEndpoint) *nodeState {
+	hp := ep.hostPort()
+	s := &nodeState{addr: net.JoinHostPort(hp.host, strconv.Itoa(hp.port)), az: ep.availabilityZone}
+	s.set(ep)
+	return s
+}
+
+// Updates the role, priority and weight of the node from its endpoint.
+func (s *nodeState) set(ep serviceEndpoint) {
+	atomic.StoreInt32(&s.role, int32(ep.role))
+	atomic.StoreInt32(&s.priority, int32(ep.priority))
+	atomic.StoreInt32(&s.weight, int32(ep.weight))
+}
+
+// Tells whether the role, priority or weight of the endpoint of the node
+// changed.
+func (s *nodeState) changed(ep serviceEndpoint) bool {
+	return atomic.LoadInt32(&s.role) != int32(ep.role) ||
+		atomic.LoadInt32(&s.priority) != int32(ep.priority) ||
+		atomic.LoadInt32(&s.weight) != int32(ep.weight)
+}
+
+func (s *nodeState) info(client DaxAPI) NodeInfo {
+	return NodeInfo{
+		Addr:        s.addr,
+		AZ:          s.az,
+		Role:        NodeRole(atomic.LoadInt32(&s.role)),
+		Healthy:     atomic.LoadInt32(&s.failures) == 0,
+		Outstanding: atomic.LoadInt64(&s.inFlight),
+		Priority:    int(atomic.LoadInt32(&s.priority)),
+		Weight:      int(atomic.LoadInt32(&s.weight)),
+		client:      client,
+	}
+}
+
+// Returns the nodes of the cluster in the order of the routes.
+func (c *cluster) nodeInfos() []NodeInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.nodeInfosLocked()
+}
+
+func (c *cluster) nodeInfosLocked() []NodeInfo {
+	return c.appendNodeInfosLocked(make([]NodeInfo, 0, len(c.routes)))
+}
+
+// Appends the nodes of the cluster to nodes in the order of the routes.
+func (c *cluster) appendNodeInfosLocked(nodes []NodeInfo) []NodeInfo {
+	for _, client := range c.routes {
+		if s := c.states[client]; s != nil {
+			nodes = append(nodes, s.info(client))
+		}
+	}
+	return nodes
+}
+
+// Returns the client of the node chosen by the routing policy for an attempt
+// of op, prev being the client of the previous attempt. The node picked must
+// still be a node of the cluster.
+func (c *cluster) route(op string, attempt int, prev DaxAPI) (DaxAPI, error) {
+	// the built-in policies do not keep the nodes past Pick, which may then
+	// be reused
+	var buf *[]NodeInfo
+	if isBuiltinPolicy(c.policy) {
+		buf = nodeInfoPool.Get().(*[]NodeInfo)
+		defer nodeInfoPool.Put(buf)
+	}
+	c.lock.RLock()
+	if c.closed {
+		c.lock.RUnlock()
+		return nil, ErrClientClosed
+	}
+	var nodes []NodeInfo
+	if buf != nil {
+		nodes = c.appendNodeInfosLocked((*buf)[:0])
+		*buf = nodes
+	} else {
+		nodes = c.appendNodeInfosLocked(make([]NodeInfo, 0, len(c.routes)))
+	}
+	info := OperationInfo{Name: op, Read: isReadOp(op), Attempt: attempt}
+	if s := c.states[prev]; s != nil {
+		info.Previous = s.addr
+	}
+	c.lock.RUnlock()
+	if len(nodes) == 0 {
+		return nil, WrapError(ErrCodeServiceUnavailable, "No routes found", c.lastRefreshError())
+	}
+
+	node, err := c.policy.Pick(info, nodes)
+	if err != nil {
+		return nil, err
+	}
+	client := c.clientOf(node)
+	if client == nil {
+		return nil, awserr.New(ErrCodeServiceUnavailable, fmt.Sprintf("RoutingPolicy picked %q, not a node of the cluster", node.Addr), nil)
+	}
+	return client, nil
+}
+
+// Returns the client of the current node of the cluster at the address of
+// node, or nil if there is none, e.g. if node was removed since it was picked.
+func (c *cluster) clientOf(node NodeInfo) DaxAPI {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if s := c.states[node.client]; s != nil && s.addr == node.Addr {
+		return node.client
+	}
+	for client, s := range c.states {
+		if s.addr == node.Addr {
+			return client
+		}
+	}
+	return nil
+}
+
+// Buffers of the nodes passed to the built-in policies.
+var nodeInfoPool = sync.Pool{New: func() interface{} { return new([]NodeInfo) }}
+
+// Returns whether p is one of the policies of this package.
+func isBuiltinPolicy(p RoutingPolicy) bool {
+	switch p.(type) {
+	case randomRouting, *roundRobinRouting, weightedRouting, *leastOutstandingRouting:
+		return true
+	}
+	return false
+}
+
+// Returns the state of the node of client, nil if client is not a node of the
+// cluster.
+func (c *cluster) nodeStateOf(client DaxAPI) *nodeState {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.states[client]
+}
+
+// Calls action on client, s being the state of its node returned by acquire,
+// releasing its slot and reporting the result to the routing policy. A fault
+// returned by fault fails the attempt before action is called, and is not
+// reported.
+func (c *cluster) attempt(s *nodeState, client DaxAPI, clk clock, fault, action func() error) error {
+	defer c.release(s)
+	if err := fault(); err != nil {
+		return err
+	}
+	if s == nil {
+		return action()
+	}
+	start := clk.Now()
+	err := action()
+	d := clk.Now().Sub(start)
+	if isUnreachableError(err) {
+		atomic.AddInt32(&s.failures, 1)
+	} else {
+		atomic.StoreInt32(&s.failures, 0)
+	}
+	c.policy.Observe(s.info(client), d, err)
+	return err
+}
+
+// Returns whether err is a failure to reach a node: not an error answered by
+// the node, nor an error of the request itself.
+func isUnreachableError(err error) bool {
+	if err == nil || isClientSideError(err) {
+		return false
+	}
+	switch err.(type) {
+	case daxError, awserr.RequestFailure:
+		return false
+	}
+	if e, ok := err.(awserr.Error); ok && e.Code() == request.CanceledErrorCode {
+		return false
+	}
+	return true
+}
+
+// Returns whether op only reads items.
+func isReadOp(op string) bool {
+	switch op {
+	case OpGetItem, OpQuery, OpScan, OpBatchGetItem, OpTransactGetItems:
+		return true
+	}
+	return false
+}
+
+// Returns the pick of the nodes of the attempts of the requests of op by the
+// routing policy.
+func (cc *ClusterDaxClient) pick(op string) func(prev DaxAPI) (DaxAPI, error) {
+	attempt := 0
+	return func(prev DaxAPI) (DaxAPI, error) {
+		client, err := cc.cluster.route(op, attempt, prev)
+		attempt++
+		return client, err
+	}
+}
@@ -0,0 +1,280 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/require"
+)
+
+// Records the calls of the client, picking the nodes in turn.
+type recordingPolicy struct {
+	mu       sync.Mutex
+	picks    []OperationInfo
+	observed []NodeInfo
+	errs     []error
+	changes  [][]NodeInfo
+	next     int
+}
+
+func (p *recordingPolicy) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.picks = append(p.picks, op)
+	p.next++
+	return nodes[p.next%len(nodes)], nil
+}
+
+func (p *recordingPolicy) Observe(node NodeInfo, d time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.observed = append(p.observed, node)
+	p.errs = append(p.errs, err)
+}
+
+func (p *recordingPolicy) NodesChanged(nodes []NodeInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, nodes)
+}
+
+func newRoutingTestClient(t *testing.T, policy RoutingPolicy) (*ClusterDaxClient, *testClientBuilder) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.RoutingPolicy = policy
+	cluster, b := newTestClusterWithConfig(cfg)
+	err := cluster.update([]serviceEndpoint{
+		{address: net.IPv4(10, 0, 0, 1).To4(), port: 8111, availabilityZone: "us-west-2a", role: roleLeader},
+		{address: net.IPv4(10, 0, 0, 2).To4(), port: 8111, availabilityZone: "us-west-2b", role: roleReplica},
+	})
+	require.NoError(t, err)
+	return &ClusterDaxClient{config: cfg, cluster: cluster}, b
+}
+
+func TestClusterDaxClient_RoutingPolicy(t *testing.T) {
+	p := &recordingPolicy{}
+	cc, b := newRoutingTestClient(t, p)
+	defer cc.Close()
+
+	require.Len(t, p.changes, 1)
+	require.Equal(t, []NodeInfo{
+		{Addr: "10.0.0.1:8111", AZ: "us-west-2a", Role: RoleLeader, Healthy: true, client: cc.cluster.routes[0]},
+		{Addr: "10.0.0.2:8111", AZ: "us-west-2b", Role: RoleReplica, Healthy: true, client: cc.cluster.routes[1]},
+	}, p.changes[0])
+
+	unreachable := errors.New("connection refused")
+	calls := 0
+	for _, c := range b.clients {
+		c.getItem = func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			calls++
+			if calls == 1 {
+				return nil, unreachable
+			}
+			return &dynamodb.GetItemOutput{}, nil
+		}
+		c.batchWriteItem = func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			return &dynamodb.BatchWriteItemOutput{}, nil
+		}
+	}
+	key := map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}
+	_, err := cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: key}, &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: 1, SleepDelayFn: func(time.Duration) {}})
+	require.NoError(t, err)
+	write := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"orders": {{PutRequest: &dynamodb.PutRequest{Item: key}}}}}
+	_, err = cc.BatchWriteItemWithOptions(write, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, []OperationInfo{
+		{Name: OpGetItem, Read: true},
+		{Name: OpGetItem, Read: true, Attempt: 1, Previous: "10.0.0.2:8111"},
+		{Name: OpBatchWriteItem},
+	}, p.picks)
+	require.Len(t, p.observed, 3)
+	require.Equal(t, []error{unreachable, nil, nil}, p.errs)
+	require.Equal(t, "10.0.0.2:8111", p.observed[0].Addr)
+	require.False(t, p.observed[0].Healthy)
+	require.Equal(t, "10.0.0.1:8111", p.observed[1].Addr)
+	require.True(t, p.observed[1].Healthy)
+	require.Equal(t, "10.0.0.2:8111", p.observed[2].Addr)
+	require.True(t, p.observed[2].Healthy, "healthy again once reached")
+
+	// changes of the nodes are notified
+	require.NoError(t, cc.cluster.update([]serviceEndpoint{
+		{address: net.IPv4(10, 0, 0, 2).To4(), port: 8111, availabilityZone: "us-west-2b", role: roleLeader},
+	}))
+	require.Len(t, p.changes, 2)
+	require.Len(t, p.changes[1], 1)
+	require.Equal(t, "10.0.0.2:8111", p.changes[1][0].Addr)
+	require.Equal(t, RoleLeader, p.changes[1][0].Role)
+}
+
+type foreignNodePolicy struct {
+	recordingPolicy
+}
+
+func (p *foreignNodePolicy) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	return NodeInfo{Addr: "10.9.9.9:8111"}, nil
+}
+
+func TestClusterDaxClient_RoutingPolicyPicksForeignNode(t *testing.T) {
+	cc, _ := newRoutingTestClient(t, &foreignNodePolicy{})
+	defer cc.Close()
+
+	_, err := cc.PutItemWithOptions(&dynamodb.PutItemInput{TableName: aws.String("orders"), Item: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}, &dynamodb.PutItemOutput{}, RequestOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "10.9.9.9:8111")
+}
+
+// Picks the node at Addr, keeping the nodes last notified by NodesChanged.
+type addrPolicy struct {
+	recordingPolicy
+	addr  string
+	known []NodeInfo
+}
+
+func (p *addrPolicy) Pick(op OperationInfo, nodes []NodeInfo) (NodeInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, n := range p.known {
+		if n.Addr == p.addr {
+			return n, nil
+		}
+	}
+	return NodeInfo{Addr: p.addr}, nil
+}
+
+func (p *addrPolicy) NodesChanged(nodes []NodeInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.known = nodes
+}
+
+func TestClusterDaxClient_RoutingPolicyPicksByAddr(t *testing.T) {
+	p := &addrPolicy{addr: "10.0.0.1:8111"}
+	cc, b := newRoutingTestClient(t, p)
+	defer cc.Close()
+	var sent []string
+	for _, c := range b.clients {
+		c := c
+		c.getItem = func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			sent = append(sent, c.hp.host)
+			return &dynamodb.GetItemOutput{}, nil
+		}
+	}
+	get := func() error {
+		key := map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}
+		_, err := cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders"), Key: key}, &dynamodb.GetItemOutput{}, RequestOptions{})
+		return err
+	}
+
+	// a node picked by its address only
+	p.known = nil
+	p.addr = "10.0.0.2:8111"
+	require.NoError(t, get())
+	require.Equal(t, []string{"10.0.0.2"}, sent)
+
+	// a node removed since the policy was told about it
+	require.NoError(t, cc.cluster.update([]serviceEndpoint{{address: net.IPv4(10, 0, 0, 2).To4(), port: 8111}}))
+	for _, c := range b.clients {
+		if c.hp.host == "10.0.0.1" {
+			p.known = []NodeInfo{{Addr: "10.0.0.1:8111", client: c}}
+		}
+	}
+	require.Len(t, p.known, 1)
+	p.addr = "10.0.0.1:8111"
+	err := get()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "10.0.0.1:8111")
+	require.Equal(t, []string{"10.0.0.2"}, sent)
+}
+
+func TestClusterDaxClient_RoutingPolicyRetriesChunks(t *testing.T) {
+	p := &recordingPolicy{}
+	cc, b := newRoutingTestClient(t, p)
+	defer cc.Close()
+
+	unreachable := errors.New("connection refused")
+	var lock sync.Mutex
+	calls := 0
+	for _, c := range b.clients {
+		c.batchWriteItem = func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			calls++
+			if calls == 1 {
+				return nil, unreachable
+			}
+			return &dynamodb.BatchWriteItemOutput{}, nil
+		}
+	}
+	write := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"orders": batchWrites("k", 30)}}
+	_, err := cc.BatchWriteItemWithOptions(write, &dynamodb.BatchWriteItemOutput{}, RequestOptions{MaxRetries: 1, SleepDelayFn: func(time.Duration) {}})
+	require.NoError(t, err)
+
+	// the first attempts of the chunks are spread over the nodes in turn, the
+	// retry is routed by the policy
+	require.Len(t, p.picks, 1)
+	require.Equal(t, OpBatchWriteItem, p.picks[0].Name)
+	require.Equal(t, 1, p.picks[0].Attempt)
+	require.NotEmpty(t, p.picks[0].Previous)
+}
+
+func TestCluster_routeBuiltinPolicyAllocations(t *testing.T) {
+	cc, _ := newRoutingTestClient(t, NewLeastOutstandingRouting())
+	defer cc.Close()
+	cc.cluster.route(OpGetItem, 0, nil) // fills the pool
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := cc.cluster.route(OpGetItem, 0, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+	require.Zero(t, allocs)
+}
+
+func TestRoundRobinRouting(t *testing.T) {
+	p := NewRoundRobinRouting()
+	nodes := []NodeInfo{{Addr: "a"}, {Addr: "b"}, {Addr: "c"}}
+	var picked []string
+	for i := 0; i < 6; i++ {
+		node, err := p.Pick(OperationInfo{Name: OpGetItem}, nodes)
+		require.NoError(t, err)
+		picked = append(picked, node.Addr)
+	}
+	require.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, picked)
+
+	// the node of the previous attempt is skipped
+	node, err := p.Pick(OperationInfo{Name: OpGetItem, Attempt: 1, Previous: "a"}, nodes)
+	require.NoError(t, err)
+	require.Equal(t, "b", node.Addr)
+}
+
+func TestRandomRouting_skipsPrevious(t *testing.T) {
+	p := NewRandomRouting()
+	nodes := []NodeInfo{{Addr: "a"}, {Addr: "b"}}
+	for i := 0; i < 20; i++ {
+		node, err := p.Pick(OperationInfo{Name: OpGetItem, Attempt: 1, Previous: "a"}, nodes)
+		require.NoError(t, err)
+		require.Equal(t, "b", node.Addr)
+	}
+	require.Equal(t, "leader", RoleLeader.String())
+}
@@ -0,0 +1,231 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Delay after which the discovery from a seed address still unanswered is
+// raced by a discovery from the next one.
+const seedHedgeDelay = 250 * time.Millisecond
+
+// An address of a seed of the cluster.
+type seedAddr struct {
+	seed string // "host:port" of the seed
+	ip   net.IP
+	port int
+}
+
+// Returns the hostname of the seed.
+func (a seedAddr) host() string {
+	host, _, _ := net.SplitHostPort(a.seed)
+	return host
+}
+
+func (a seedAddr) String() string {
+	if host, _, _ := net.SplitHostPort(a.seed); host == a.ip.String() {
+		return a.seed
+	}
+	return fmt.Sprintf("%s (%s)", a.seed, a.ip)
+}
+
+// The result of a discovery from a seed address.
+type seedResult struct {
+	addr      seedAddr
+	endpoints []serviceEndpoint
+	err       error
+}
+
+// Pulls the endpoints of the cluster from the addresses of its seeds. The
+// hostnames of the seeds are resolved through the cache of the cluster: when
+// the discovery fails on every cached address, the hostnames are resolved
+// again and the discovery is retried at once on the new addresses, if any, so
+// that a discovery endpoint moved to other addresses does not fail the
+// refresh. Seeds of SRV records are resolved instead.
+func (c *cluster) pullEndpoints(ctx aws.Context) ([]serviceEndpoint, error) {
+	if c.srv {
+		return c.pullSRVEndpoints(ctx)
+	}
+	addrs, failures := c.seedAddrs(ctx)
+	endpoints, err := c.pullEndpointsFrom(ctx, addrs, failures)
+	if err == nil || ctx.Err() != nil {
+		return endpoints, err
+	}
+	for _, s := range c.seeds {
+		c.config.connConfig.hosts.failed(s.host)
+	}
+	fresh, failures := c.seedAddrs(ctx)
+	if sameSeedAddrs(addrs, fresh) {
+		return nil, err
+	}
+	if c.config.logger != nil && c.config.logLevel.AtLeast(aws.LogDebug) {
+		c.config.logger.Log(fmt.Sprintf("DEBUG: Seeds resolved to new addresses after failing discovery : %s", err))
+	}
+	return c.pullEndpointsFrom(ctx, fresh, failures)
+}
+
+// Pulls the endpoints of the cluster from addrs, in the order of
+// Config.HostPorts, the address of a seed which answered last first and its
+// other addresses in random order. A discovery is started from the next
+// address as soon as the previous one failed or is still unanswered after
+// seedHedgeDelay, so that seeds down or dropping the connections do not delay
+// the discovery. Returns the endpoints of the first address answering with
+// some, or an error listing failures, those of the seeds that did not resolve
+// and of every address.
+func (c *cluster) pullEndpointsFrom(ctx aws.Context, addrs []seedAddr, failures []seedResult) ([]serviceEndpoint, error) {
+	if len(addrs) == 0 {
+		return nil, seedsFailed(failures)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan seedResult, len(addrs))
+	next, pending := 0, 0
+	launch := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		client, err := c.clientBuilder.newClient("", addr.ip, addr.port, c.config.connConfig, c.config.Region, c.config.Credentials, c.config.MaxPendingConnectionsPerHost, c.config.DialContext)
+		if err != nil {
+			results <- seedResult{addr: addr, err: err}
+			return
+		}
+		go func() {
+			pctx, cfn := context.WithTimeout(ctx, 5*time.Second)
+			endpoints, err := client.endpoints(RequestOptions{MaxRetries: 2, Context: pctx})
+			cfn()
+			c.closeClient(client)
+			results <- seedResult{addr: addr, endpoints: endpoints, err: err}
+		}()
+	}
+
+	clk := clockOrSystem(c.config.clock)
+	var found []serviceEndpoint
+	launch()
+	for pending > 0 {
+		var hedge timer
+		var hedged <-chan time.Time
+		if found == nil && next < len(addrs) {
+			hedge = clk.NewTimer(seedHedgeDelay)
+			hedged = hedge.C()
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				failures = append(failures, r)
+			} else {
+				if c.config.logger != nil && c.config.logLevel.AtLeast(aws.LogDebug) {
+					c.config.logger.Log(fmt.Sprintf("DEBUG: Pulled endpoints from %s : %v", r.addr.ip, r.endpoints))
+				}
+				if found == nil && len(r.endpoints) > 0 {
+					// the other discoveries are abandoned
+					found = r.endpoints
+					cancel()
+					c.config.connConfig.hosts.connected(r.addr.host(), r.addr.ip)
+				}
+			}
+			if found == nil && pending == 0 && next < len(addrs) {
+				launch()
+			}
+		case <-hedged:
+			launch()
+		}
+		if hedge != nil {
+			hedge.Stop()
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+	return nil, seedsFailed(failures)
+}
+
+// Resolves the addresses of the seeds, returning the failures of the seeds
+// that could not be resolved.
+func (c *cluster) seedAddrs(ctx aws.Context) ([]seedAddr, []seedResult) {
+	var addrs []seedAddr
+	var failures []seedResult
+	for _, s := range c.seeds {
+		seed := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+		ips, err := c.config.connConfig.hosts.lookup(ctx, s.host)
+		if err != nil {
+			failures = append(failures, seedResult{addr: seedAddr{seed: seed, port: s.port}, err: err})
+			continue
+		}
+		// the address which answered last stays first
+		rest := ips
+		if len(ips) > 0 && ips[0].Equal(c.config.connConfig.hosts.lastGood(s.host)) {
+			rest = ips[1:]
+		}
+		// randomize multiple addresses; in-place fischer-yates shuffle.
+		for j := len(rest) - 1; j > 0; j-- {
+			k := rand.Intn(j + 1)
+			rest[k], rest[j] = rest[j], rest[k]
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, seedAddr{seed: seed, ip: ip, port: s.port})
+		}
+	}
+	return addrs, failures
+}
+
+// Tells whether the seeds resolved to the same addresses, in any order.
+func sameSeedAddrs(a, b []seedAddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, addr := range a {
+		seen[addr.String()] = true
+	}
+	for _, addr := range b {
+		if !seen[addr.String()] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the error of a discovery failed on every seed address: the error of
+// the single address tried, or an error listing the error of every address.
+// Returns nil if the addresses answered without endpoints.
+func seedsFailed(failures []seedResult) error {
+	switch len(failures) {
+	case 0:
+		return nil
+	case 1:
+		return failures[0].err
+	}
+	msgs := make([]string, len(failures))
+	for i, f := range failures {
+		if f.addr.ip == nil {
+			msgs[i] = fmt.Sprintf("%s: %s", f.addr.seed, f.err)
+		} else {
+			msgs[i] = fmt.Sprintf("%s: %s", f.addr, f.err)
+		}
+	}
+	return WrapError(ErrCodeServiceUnavailable, fmt.Sprintf("discovery failed on every seed: %s", strings.Join(msgs, "; ")), failures[len(failures)-1].err)
+}
@@ -0,0 +1,184 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+var seedsTestHostPorts = []string{"127.0.0.1:8111", "127.0.0.2:8111", "127.0.0.3:8111"}
+
+// Builds clients answering the endpoints of the cluster, except the clients of
+// the seeds down, failing, and of the seeds hanging, answering only once the
+// request is canceled.
+type seedsClientBuilder struct {
+	mu      sync.Mutex
+	ep      []serviceEndpoint
+	down    map[string]bool
+	hanging map[string]bool
+	pulled  []string // addresses of the seeds which answered
+}
+
+func newSeedsClientBuilder() *seedsClientBuilder {
+	ep := []serviceEndpoint{{hostname: "node1", address: net.IPv4(10, 0, 0, 1).To4(), port: 8111}}
+	return &seedsClientBuilder{ep: ep, down: map[string]bool{}, hanging: map[string]bool{}}
+}
+
+func (b *seedsClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxConns int, dialContextFn dialContext) (DaxAPI, error) {
+	return &seedClient{testClient: &testClient{hp: hostPort{ip.String(), port}}, b: b}, nil
+}
+
+func (b *seedsClientBuilder) set(seed string, down, hanging bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down[seed] = down
+	b.hanging[seed] = hanging
+}
+
+func (b *seedsClientBuilder) pulledFrom() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.pulled...)
+}
+
+type seedClient struct {
+	*testClient
+	b *seedsClientBuilder
+}
+
+func (c *seedClient) endpoints(opt RequestOptions) ([]serviceEndpoint, error) {
+	addr := net.JoinHostPort(c.hp.host, strconv.Itoa(c.hp.port))
+	c.b.mu.Lock()
+	down, hanging := c.b.down[addr], c.b.hanging[addr]
+	c.b.mu.Unlock()
+	if hanging {
+		<-opt.Context.Done()
+		return nil, opt.Context.Err()
+	}
+	if down {
+		return nil, errors.New("connection refused by " + addr)
+	}
+	c.b.mu.Lock()
+	defer c.b.mu.Unlock()
+	c.b.pulled = append(c.b.pulled, addr)
+	return c.b.ep, nil
+}
+
+func (c *seedClient) Close() error {
+	return nil
+}
+
+func newSeedsTestCluster(t *testing.T) (*cluster, *seedsClientBuilder) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = seedsTestHostPorts
+	cfg.Region = "us-west-2"
+	cluster, err := newCluster(cfg)
+	require.NoError(t, err)
+	b := newSeedsClientBuilder()
+	cluster.clientBuilder = b
+	return cluster, b
+}
+
+func TestCluster_pullEndpointsOneSeedDown(t *testing.T) {
+	cluster, b := newSeedsTestCluster(t)
+	b.set(seedsTestHostPorts[0], true, false)
+
+	require.NoError(t, cluster.refreshNow())
+	require.Len(t, cluster.active, 1)
+	require.Equal(t, []string{seedsTestHostPorts[1]}, b.pulledFrom())
+}
+
+func TestCluster_pullEndpointsOneSeedHanging(t *testing.T) {
+	cluster, b := newSeedsTestCluster(t)
+	b.set(seedsTestHostPorts[0], false, true)
+
+	start := time.Now()
+	require.NoError(t, cluster.refreshNow())
+	require.True(t, time.Since(start) < 5*time.Second, "discovery waited for the hanging seed: %s", time.Since(start))
+	require.Len(t, cluster.active, 1)
+	require.Equal(t, []string{seedsTestHostPorts[1]}, b.pulledFrom())
+}
+
+func TestCluster_pullEndpointsAllSeedsDown(t *testing.T) {
+	cluster, b := newSeedsTestCluster(t)
+	for _, s := range seedsTestHostPorts {
+		b.set(s, true, false)
+	}
+
+	err := cluster.refreshNow()
+	require.Error(t, err)
+	e, ok := err.(awserr.Error)
+	require.True(t, ok, "%T", err)
+	require.Equal(t, ErrCodeServiceUnavailable, e.Code())
+	for _, s := range seedsTestHostPorts {
+		require.Contains(t, e.Message(), s+": connection refused by "+s)
+	}
+	require.Equal(t, 3, strings.Count(e.Message(), "connection refused"), e.Message())
+	require.Empty(t, cluster.active)
+}
+
+func TestCluster_pullEndpointsSeedRecovers(t *testing.T) {
+	cluster, b := newSeedsTestCluster(t)
+	b.set(seedsTestHostPorts[0], true, false)
+	b.set(seedsTestHostPorts[1], true, false)
+	b.set(seedsTestHostPorts[2], true, false)
+	require.Error(t, cluster.refreshNow())
+
+	b.set(seedsTestHostPorts[0], false, false)
+	require.NoError(t, cluster.refreshNow())
+	require.Len(t, cluster.active, 1)
+	require.Equal(t, []string{seedsTestHostPorts[0]}, b.pulledFrom())
+}
+
+func TestCluster_pullEndpointsSeedMoved(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"dax://discovery.example.internal:8111"}
+	cfg.Region = "us-west-2"
+	cluster, err := newCluster(cfg)
+	require.NoError(t, err)
+	b := newSeedsClientBuilder()
+	cluster.clientBuilder = b
+	r := newFakeResolver()
+	r.hosts["discovery.example.internal"] = []net.IP{net.IPv4(127, 0, 0, 1)}
+	cluster.config.connConfig.hosts = newHostCache(r, nil)
+
+	require.NoError(t, cluster.refreshNow())
+	require.Equal(t, []string{"127.0.0.1:8111"}, b.pulledFrom())
+
+	// the discovery endpoint moves, its old address is cached
+	b.set("127.0.0.1:8111", true, false)
+	r.mu.Lock()
+	r.hosts["discovery.example.internal"] = []net.IP{net.IPv4(127, 0, 0, 2)}
+	r.mu.Unlock()
+	require.NoError(t, cluster.refreshNow())
+	require.Equal(t, []string{"127.0.0.1:8111", "127.0.0.2:8111"}, b.pulledFrom())
+	require.Equal(t, 2, r.ipLookups)
+
+	// the new address is cached
+	require.NoError(t, cluster.refreshNow())
+	require.Equal(t, []string{"127.0.0.1:8111", "127.0.0.2:8111", "127.0.0.2:8111"}, b.pulledFrom())
+	require.Equal(t, 2, r.ipLookups)
+}
@@ -17,11 +17,19 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/cbor"
 	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-dax-go/dax/internal/parser"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client/metadata"
@@ -31,13 +39,14 @@ import (
 )
 
 const (
-	userAgent  = "DaxGoClient-1.0.0"
 	daxAddress = "https://dax.amazonaws.com"
 
 	authTtlSecs          = 5 * 60
 	tubeAuthWindowScalar = 0.75
 
 	emptyAttributeListId = 1
+
+	pingTimeout = time.Second
 )
 
 const (
@@ -63,18 +72,31 @@ var clientInfo = metadata.ClientInfo{ServiceName: serviceName}
 const (
 	keySchemaLruCacheSize     = 100
 	attributeListLruCacheSize = 1000
+
+	// bounds key schema lookups made without a context, e.g. background refreshes
+	keySchemaLoadTimeout = 30 * time.Second
 )
 
 type SingleDaxClient struct {
 	region             string
 	credentials        *credentials.Credentials
 	tubeAuthWindowSecs int64
+	clock              clock
 
 	handlers          *request.Handlers
 	pool              *tubePool
 	keySchema         *lru.Lru
 	attrNamesListToId *lru.Lru
 	attrListIdToNames *lru.Lru
+	expressions       *parser.ExpressionCache // nil if disabled
+	validate          bool                    // checks requests before they are sent
+	invalidateTable   func(table string)      // evicts a stale key schema, on every node of a cluster, nil for this client only
+
+	pipeLock    sync.Mutex
+	pipe        *pipeline     // protected by pipeLock
+	pipeDialing chan struct{} // closed once the pipeline being started is set, protected by pipeLock
+
+	requests int64 // sent, internal requests excluded, accessed atomically
 }
 
 func NewSingleClient(endpoint string, connConfigData connConfig, region string, credentials *credentials.Credentials) (*SingleDaxClient, error) {
@@ -94,18 +116,27 @@ func newSingleClientWithOptions(endpoint string, connConfigData connConfig, regi
 		credentials:        credentials,
 		tubeAuthWindowSecs: authTtlSecs * tubeAuthWindowScalar,
 		pool:               newTubePoolWithOptions(endpoint, po, connConfigData),
+		clock:              clockOrSystem(connConfigData.clock),
+		expressions:        parser.NewExpressionCache(connConfigData.expressionCacheSize),
+		validate:           !connConfigData.skipValidation,
 	}
 
 	client.handlers = client.buildHandlers()
 	client.keySchema = &lru.Lru{
 		MaxEntries: keySchemaLruCacheSize,
+		TTL:        connConfigData.keySchemaTTL,
+		Now:        client.clock.Now,
+		// schemas used during the last quarter of their TTL are refreshed in the background
+		RefreshAhead: connConfigData.keySchemaTTL / 4,
 		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
 			table, ok := key.(string)
 			if !ok {
 				return nil, awserr.New(request.ErrCodeSerialization, "unexpected type for table name", nil)
 			}
 			if ctx == nil {
-				ctx = aws.BackgroundContext()
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(aws.BackgroundContext(), keySchemaLoadTimeout)
+				defer cancel()
 			}
 			return client.defineKeySchema(ctx, table)
 		},
@@ -124,8 +155,9 @@ func newSingleClientWithOptions(endpoint string, connConfigData connConfig, regi
 			return client.defineAttributeListId(ctx, attrNames)
 		},
 		KeyMarshaller: func(key lru.Key) lru.Key {
-			var buf bytes.Buffer
-			w := cbor.NewWriter(&buf)
+			buf := getBuffer()
+			defer putBuffer(buf)
+			w := cbor.NewWriter(buf)
 			defer w.Close()
 			for _, v := range key.([]string) {
 				w.WriteString(v)
@@ -153,10 +185,20 @@ func newSingleClientWithOptions(endpoint string, connConfigData connConfig, regi
 }
 
 func (client *SingleDaxClient) Close() error {
+	client.pipeLock.Lock()
+	if client.pipe != nil {
+		client.pipe.Close()
+	}
+	client.pipeLock.Unlock()
+	var err error
 	if client.pool != nil {
-		return client.pool.Close()
+		err = client.pool.Close()
 	}
-	return nil
+	if client.keySchema != nil {
+		// background refreshes fail fast once the pool is closed
+		client.keySchema.Close()
+	}
+	return err
 }
 
 func (client *SingleDaxClient) endpoints(opt RequestOptions) ([]serviceEndpoint, error) {
@@ -233,8 +275,13 @@ func (client *SingleDaxClient) defineKeySchema(ctx aws.Context, table string) ([
 }
 
 func (client *SingleDaxClient) PutItemWithOptions(input *dynamodb.PutItemInput, output *dynamodb.PutItemOutput, opt RequestOptions) (*dynamodb.PutItemOutput, error) {
+	if client.validate {
+		if err := validatePutItemInput(input); err != nil {
+			return output, err
+		}
+	}
 	encoder := func(writer *cbor.Writer) error {
-		return encodePutItemInput(opt.Context, input, client.keySchema, client.attrNamesListToId, writer)
+		return encodePutItemInput(opt.Context, input, client.keySchema, client.attrNamesListToId, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -242,6 +289,7 @@ func (client *SingleDaxClient) PutItemWithOptions(input *dynamodb.PutItemInput,
 		return err
 	}
 	if err = client.executeWithRetries(OpPutItem, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, aws.StringValue(input.TableName))
 		return output, err
 	}
 	return output, nil
@@ -249,7 +297,7 @@ func (client *SingleDaxClient) PutItemWithOptions(input *dynamodb.PutItemInput,
 
 func (client *SingleDaxClient) DeleteItemWithOptions(input *dynamodb.DeleteItemInput, output *dynamodb.DeleteItemOutput, opt RequestOptions) (*dynamodb.DeleteItemOutput, error) {
 	encoder := func(writer *cbor.Writer) error {
-		return encodeDeleteItemInput(opt.Context, input, client.keySchema, writer)
+		return encodeDeleteItemInput(opt.Context, input, client.keySchema, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -257,14 +305,20 @@ func (client *SingleDaxClient) DeleteItemWithOptions(input *dynamodb.DeleteItemI
 		return err
 	}
 	if err = client.executeWithRetries(OpDeleteItem, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, aws.StringValue(input.TableName))
 		return output, err
 	}
 	return output, nil
 }
 
 func (client *SingleDaxClient) UpdateItemWithOptions(input *dynamodb.UpdateItemInput, output *dynamodb.UpdateItemOutput, opt RequestOptions) (*dynamodb.UpdateItemOutput, error) {
+	if client.validate {
+		if err := validateUpdateItemInput(input); err != nil {
+			return output, err
+		}
+	}
 	encoder := func(writer *cbor.Writer) error {
-		return encodeUpdateItemInput(opt.Context, input, client.keySchema, writer)
+		return encodeUpdateItemInput(opt.Context, input, client.keySchema, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -272,6 +326,7 @@ func (client *SingleDaxClient) UpdateItemWithOptions(input *dynamodb.UpdateItemI
 		return err
 	}
 	if err = client.executeWithRetries(OpUpdateItem, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, aws.StringValue(input.TableName))
 		return output, err
 	}
 	return output, nil
@@ -279,7 +334,7 @@ func (client *SingleDaxClient) UpdateItemWithOptions(input *dynamodb.UpdateItemI
 
 func (client *SingleDaxClient) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
 	encoder := func(writer *cbor.Writer) error {
-		return encodeGetItemInput(opt.Context, input, client.keySchema, writer)
+		return encodeGetItemInput(opt.Context, input, client.keySchema, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -287,6 +342,7 @@ func (client *SingleDaxClient) GetItemWithOptions(input *dynamodb.GetItemInput,
 		return err
 	}
 	if err = client.executeWithRetries(OpGetItem, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, aws.StringValue(input.TableName))
 		return output, err
 	}
 	return output, nil
@@ -294,7 +350,7 @@ func (client *SingleDaxClient) GetItemWithOptions(input *dynamodb.GetItemInput,
 
 func (client *SingleDaxClient) ScanWithOptions(input *dynamodb.ScanInput, output *dynamodb.ScanOutput, opt RequestOptions) (*dynamodb.ScanOutput, error) {
 	encoder := func(writer *cbor.Writer) error {
-		return encodeScanInput(opt.Context, input, client.keySchema, writer)
+		return encodeScanInput(opt.Context, input, client.keySchema, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -302,6 +358,7 @@ func (client *SingleDaxClient) ScanWithOptions(input *dynamodb.ScanInput, output
 		return err
 	}
 	if err = client.executeWithRetries(OpScan, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, aws.StringValue(input.TableName))
 		return output, err
 	}
 	return output, nil
@@ -309,7 +366,7 @@ func (client *SingleDaxClient) ScanWithOptions(input *dynamodb.ScanInput, output
 
 func (client *SingleDaxClient) QueryWithOptions(input *dynamodb.QueryInput, output *dynamodb.QueryOutput, opt RequestOptions) (*dynamodb.QueryOutput, error) {
 	encoder := func(writer *cbor.Writer) error {
-		return encodeQueryInput(opt.Context, input, client.keySchema, writer)
+		return encodeQueryInput(opt.Context, input, client.keySchema, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -317,12 +374,16 @@ func (client *SingleDaxClient) QueryWithOptions(input *dynamodb.QueryInput, outp
 		return err
 	}
 	if err = client.executeWithRetries(OpQuery, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, aws.StringValue(input.TableName))
 		return output, err
 	}
 	return output, nil
 }
 
 func (client *SingleDaxClient) BatchWriteItemWithOptions(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := client.validateBatchWriteItem(opt.Context, input); err != nil {
+		return output, err
+	}
 	encoder := func(writer *cbor.Writer) error {
 		return encodeBatchWriteItemInput(opt.Context, input, client.keySchema, client.attrNamesListToId, writer)
 	}
@@ -332,14 +393,22 @@ func (client *SingleDaxClient) BatchWriteItemWithOptions(input *dynamodb.BatchWr
 		return err
 	}
 	if err = client.executeWithRetries(OpBatchWriteItem, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, batchWriteTables(input)...)
 		return output, err
 	}
 	return output, nil
 }
 
+func (client *SingleDaxClient) validateBatchWriteItem(ctx aws.Context, input *dynamodb.BatchWriteItemInput) error {
+	if !client.validate {
+		return nil
+	}
+	return validateBatchWriteItemInput(ctx, input, client.keySchema)
+}
+
 func (client *SingleDaxClient) BatchGetItemWithOptions(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
 	encoder := func(writer *cbor.Writer) error {
-		return encodeBatchGetItemInput(opt.Context, input, client.keySchema, writer)
+		return encodeBatchGetItemInput(opt.Context, input, client.keySchema, client.expressions, writer)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
@@ -347,22 +416,29 @@ func (client *SingleDaxClient) BatchGetItemWithOptions(input *dynamodb.BatchGetI
 		return err
 	}
 	if err = client.executeWithRetries(OpBatchGetItem, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, batchGetTables(input)...)
 		return output, err
 	}
 	return output, nil
 }
 
 func (client *SingleDaxClient) TransactWriteItemsWithOptions(input *dynamodb.TransactWriteItemsInput, output *dynamodb.TransactWriteItemsOutput, opt RequestOptions) (*dynamodb.TransactWriteItemsOutput, error) {
+	if client.validate {
+		if err := validateTransactWriteItemsInput(opt.Context, input, client.keySchema); err != nil {
+			return output, err
+		}
+	}
 	extractedKeys := make([]map[string]*dynamodb.AttributeValue, len(input.TransactItems))
 	encoder := func(writer *cbor.Writer) error {
-		return encodeTransactWriteItemsInput(opt.Context, input, client.keySchema, client.attrNamesListToId, writer, extractedKeys)
+		return encodeTransactWriteItemsInput(opt.Context, input, client.keySchema, client.attrNamesListToId, client.expressions, writer, extractedKeys)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
 		output, err = decodeTransactWriteItemsOutput(opt.Context, reader, input, client.keySchema, client.attrListIdToNames, output)
 		return err
 	}
-	if err = client.executeWithRetries(OpBatchWriteItem, opt, encoder, decoder); err != nil {
+	if err = client.executeWithRetries(OpTransactWriteItems, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, transactWriteTables(input)...)
 		if failure, ok := err.(*daxTransactionCanceledFailure); ok {
 			var cancellationReasons []*dynamodb.CancellationReason
 			if cancellationReasons, err = decodeTransactionCancellationReasons(opt.Context, failure, extractedKeys, client.attrListIdToNames); err != nil {
@@ -377,16 +453,22 @@ func (client *SingleDaxClient) TransactWriteItemsWithOptions(input *dynamodb.Tra
 }
 
 func (client *SingleDaxClient) TransactGetItemsWithOptions(input *dynamodb.TransactGetItemsInput, output *dynamodb.TransactGetItemsOutput, opt RequestOptions) (*dynamodb.TransactGetItemsOutput, error) {
+	if client.validate {
+		if err := validateTransactGetItemsInput(input); err != nil {
+			return output, err
+		}
+	}
 	extractedKeys := make([]map[string]*dynamodb.AttributeValue, len(input.TransactItems))
 	encoder := func(writer *cbor.Writer) error {
-		return encodeTransactGetItemsInput(opt.Context, input, client.keySchema, writer, extractedKeys)
+		return encodeTransactGetItemsInput(opt.Context, input, client.keySchema, client.expressions, writer, extractedKeys)
 	}
 	var err error
 	decoder := func(reader *cbor.Reader) error {
 		output, err = decodeTransactGetItemsOutput(opt.Context, reader, input, client.keySchema, client.attrListIdToNames, output)
 		return err
 	}
-	if err = client.executeWithRetries(OpBatchWriteItem, opt, encoder, decoder); err != nil {
+	if err = client.executeWithRetries(OpTransactGetItems, opt, encoder, decoder); err != nil {
+		client.invalidateStaleKeySchemas(err, transactGetTables(input)...)
 		if failure, ok := err.(*daxTransactionCanceledFailure); ok {
 			var cancellationReasons []*dynamodb.CancellationReason
 			if cancellationReasons, err = decodeTransactionCancellationReasons(opt.Context, failure, extractedKeys, client.attrListIdToNames); err != nil {
@@ -424,7 +506,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *GetItemInput", nil)
 			return
 		}
-		if err := encodeGetItemInput(req.Context(), input, client.keySchema, w); err != nil {
+		if err := encodeGetItemInput(req.Context(), input, client.keySchema, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -434,7 +516,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *ScanInput", nil)
 			return
 		}
-		if err := encodeScanInput(req.Context(), input, client.keySchema, w); err != nil {
+		if err := encodeScanInput(req.Context(), input, client.keySchema, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -444,7 +526,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *QueryInput", nil)
 			return
 		}
-		if err := encodeQueryInput(req.Context(), input, client.keySchema, w); err != nil {
+		if err := encodeQueryInput(req.Context(), input, client.keySchema, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -454,7 +536,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *BatchGetItemInput", nil)
 			return
 		}
-		if err := encodeBatchGetItemInput(req.Context(), input, client.keySchema, w); err != nil {
+		if err := encodeBatchGetItemInput(req.Context(), input, client.keySchema, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -464,7 +546,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *PutItemInput", nil)
 			return
 		}
-		if err := encodePutItemInput(req.Context(), input, client.keySchema, client.attrNamesListToId, w); err != nil {
+		if err := encodePutItemInput(req.Context(), input, client.keySchema, client.attrNamesListToId, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -474,7 +556,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *DeleteItemInput", nil)
 			return
 		}
-		if err := encodeDeleteItemInput(req.Context(), input, client.keySchema, w); err != nil {
+		if err := encodeDeleteItemInput(req.Context(), input, client.keySchema, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -484,7 +566,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			req.Error = awserr.New(request.ErrCodeSerialization, "expected *UpdateItemInput", nil)
 			return
 		}
-		if err := encodeUpdateItemInput(req.Context(), input, client.keySchema, w); err != nil {
+		if err := encodeUpdateItemInput(req.Context(), input, client.keySchema, client.expressions, w); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -505,7 +587,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			return
 		}
 		extractedKeys := make([]map[string]*dynamodb.AttributeValue, len(input.TransactItems))
-		if err := encodeTransactGetItemsInput(req.Context(), input, client.keySchema, w, extractedKeys); err != nil {
+		if err := encodeTransactGetItemsInput(req.Context(), input, client.keySchema, client.expressions, w, extractedKeys); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -516,7 +598,7 @@ func (client *SingleDaxClient) build(req *request.Request) {
 			return
 		}
 		extractedKeys := make([]map[string]*dynamodb.AttributeValue, len(input.TransactItems))
-		if err := encodeTransactWriteItemsInput(req.Context(), input, client.keySchema, client.attrNamesListToId, w, extractedKeys); err != nil {
+		if err := encodeTransactWriteItemsInput(req.Context(), input, client.keySchema, client.attrNamesListToId, client.expressions, w, extractedKeys); err != nil {
 			req.Error = translateError(err)
 			return
 		}
@@ -675,7 +757,7 @@ func (client *SingleDaxClient) executeWithRetries(op string, o RequestOptions, e
 		retryDelay := o.RetryDelay
 		if o.SleepDelayFn == nil {
 			sleepFun = func() error {
-				return aws.SleepWithContext(ctx, retryDelay)
+				return client.clock.Sleep(ctx, retryDelay)
 			}
 		} else {
 			sleepFun = func() error {
@@ -696,12 +778,12 @@ func (client *SingleDaxClient) executeWithRetries(op string, o RequestOptions, e
 		if err = client.executeWithContext(ctx, op, encoder, decoder, o); err == nil {
 			return nil
 		} else if ctx != nil && err == ctx.Err() {
-			return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+			return WrapError(request.CanceledErrorCode, "request context canceled", err)
 		}
 
 		if i != attempts && sleepFun != nil {
 			if err := sleepFun(); err != nil {
-				return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+				return WrapError(request.CanceledErrorCode, "request context canceled", err)
 			}
 		}
 
@@ -714,50 +796,276 @@ func (client *SingleDaxClient) executeWithRetries(op string, o RequestOptions, e
 }
 
 func (client *SingleDaxClient) executeWithContext(ctx aws.Context, op string, encoder func(writer *cbor.Writer) error, decoder func(reader *cbor.Reader) error, opt RequestOptions) error {
-	t, err := client.pool.getWithContext(ctx, client.isHighPriority(op), opt)
+	if !client.isInternal(op) {
+		atomic.AddInt64(&client.requests, 1)
+	}
+	// requests issued while decoding, e.g. to load an attribute list, cannot wait behind the pipeline
+	if client.pool.connConfig.pipelineDepth > 0 && !client.isHighPriority(op) {
+		p, err := client.pipeline(ctx, op, opt)
+		if err != nil {
+			return err
+		}
+		return p.execute(ctx, op, encoder, decoder)
+	}
+
+	stale, err := client.executeOnTube(ctx, op, encoder, decoder, opt, false)
+	if stale {
+		// The server closed the connection while it was idle in the pool and the request never reached it.
+		// Retry once on a new connection without counting against the request retries.
+		if opt.Logger != nil && opt.LogLevel.AtLeast(aws.LogDebug) {
+			opt.Logger.Log(fmt.Sprintf("DEBUG: Idle connection to %s was closed, retrying %s on a new connection : %s", client.pool.address, op, err))
+		}
+		// The other idle tubes have likely been closed as well: dial a new one.
+		_, err = client.executeOnTube(ctx, op, encoder, decoder, opt, true)
+	}
+	return err
+}
+
+// Executes the request on a pooled tube, or on a new tube if fresh is true.
+// Returns true if the request failed because an idle tube was closed by the server before it received any response.
+func (client *SingleDaxClient) executeOnTube(ctx aws.Context, op string, encoder func(writer *cbor.Writer) error, decoder func(reader *cbor.Reader) error, opt RequestOptions, fresh bool) (bool, error) {
+	var t tube
+	var idle bool
+	var err error
+	if fresh {
+		t, err = client.pool.acquireNew(ctx, opt)
+	} else {
+		t, idle, err = client.acquire(ctx, op, opt)
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
 	if err = client.pool.setDeadline(ctx, t); err != nil {
 		client.pool.discard(t)
-		return err
+		return false, err
 	}
 
-	if err = client.auth(t); err != nil {
+	stopWatch := watchContext(ctx, t)
+	reuse, responded, err := client.executeWithTube(t, op, encoder, decoder)
+	if stopWatch() {
+		// I/O was interrupted by the context, the tube may be left in the middle of a request
+		client.pool.discard(t)
+		if err != nil {
+			return false, ctx.Err()
+		}
+		return false, nil
+	}
+	if reuse && client.pool.clearDeadline(ctx, t) == nil {
+		client.pool.put(t)
+	} else {
+		client.pool.discard(t)
+	}
+	return err != nil && idle && !responded && isConnectionClosedError(err), err
+}
+
+// Returns the pipeline of the client, starting a new one if there is none or the last one failed.
+func (client *SingleDaxClient) pipeline(ctx aws.Context, op string, opt RequestOptions) (*pipeline, error) {
+	for {
+		client.pipeLock.Lock()
+		p := client.pipe
+		if p != nil && !p.failed() {
+			client.pipeLock.Unlock()
+			return p, nil
+		}
+		if dialing := client.pipeDialing; dialing != nil {
+			// another request is starting the pipeline
+			client.pipeLock.Unlock()
+			select {
+			case <-dialing:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		client.pipe = nil
+		dialing := make(chan struct{})
+		client.pipeDialing = dialing
+		client.pipeLock.Unlock()
+
+		// the lock is not held while the failed pipeline is closed and a new tube dialed
+		if p != nil {
+			p.Close() // wait for its goroutines
+		}
+		t, _, err := client.acquire(ctx, op, opt)
+
+		client.pipeLock.Lock()
+		client.pipeDialing = nil
+		close(dialing)
+		if err != nil {
+			client.pipeLock.Unlock()
+			return nil, err
+		}
+		p = newPipeline(client, t, client.pool.connConfig.pipelineDepth)
+		client.pipe = p
+		client.pipeLock.Unlock()
+		return p, nil
+	}
+}
+
+// Gets a tube from the pool. Tubes idle for longer than PingAfterIdle are
+// pinged first and replaced if they do not respond.
+// Returns whether the tube was taken from the idle tubes without being pinged.
+func (client *SingleDaxClient) acquire(ctx aws.Context, op string, opt RequestOptions) (tube, bool, error) {
+	if timings := requestTimerFrom(ctx); timings != nil {
+		start := client.clock.Now()
+		defer func() { timings.addWait(client.clock.Now().Sub(start)) }()
+	}
+	for {
+		t, idle, err := client.pool.acquire(ctx, client.isHighPriority(op), opt)
+		if err != nil || !idle || !client.pool.needsPing(t) {
+			return t, idle, err
+		}
+		if err = client.ping(ctx, t); err == nil {
+			return t, false, nil
+		}
+		if opt.Logger != nil && opt.LogLevel.AtLeast(aws.LogDebug) {
+			opt.Logger.Log(fmt.Sprintf("DEBUG: Ping of idle connection to %s failed, replacing it : %s", client.pool.address, err))
+		}
 		client.pool.discard(t)
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// Checks the tube is alive by sending it an endpoints request, the cheapest request understood by the server.
+func (client *SingleDaxClient) ping(ctx aws.Context, t tube) error {
+	pctx, cfn := context.WithTimeout(ctx, pingTimeout)
+	defer cfn()
+	if err := client.pool.setDeadline(pctx, t); err != nil {
 		return err
 	}
+	reuse, _, err := client.executeWithTube(t, opEndpoints, encodeEndpointsInput, func(reader *cbor.Reader) error {
+		_, err := decodeEndpointsOutput(reader)
+		return err
+	})
+	if err == nil && !reuse {
+		err = awserr.New(request.ErrCodeSerialization, "unexpected ping response", nil)
+	}
+	return err
+}
+
+// Sends a single request over the tube and decodes its response.
+// Returns whether the tube is left in a clean state and can be reused
+// and whether any part of the response was received.
+func (client *SingleDaxClient) executeWithTube(t tube, op string, encoder func(writer *cbor.Writer) error, decoder func(reader *cbor.Reader) error) (bool, bool, error) {
+	if err := client.auth(t); err != nil {
+		return false, false, err
+	}
 
 	writer := t.CborWriter()
-	if err = encoder(writer); err != nil {
+	if err := client.captureRequest(op, encoder)(writer); err != nil {
 		// Validation errors will cause pool to be discarded as there is no guarantee
 		// that the validation was performed before any data was written into tube
-		client.pool.discard(t)
-		return err
+		return false, false, err
 	}
 	if err := writer.Flush(); err != nil {
-		client.pool.discard(t)
-		return err
+		return false, false, err
 	}
 
 	reader := t.CborReader()
+	defer client.captureResponse(op, t)
+	if _, err := reader.PeekHeader(); err != nil { // nothing received
+		return false, false, err
+	}
 	ex, err := decodeError(reader)
 	if err != nil { // decode or network error
-		client.pool.discard(t)
-		return err
+		return false, true, err
 	}
 	if ex != nil { // user or server error
-		client.recycleTube(t, ex)
-		return ex
+		return client.canRecycle(t, ex) && reader.Buffered() == 0, true, ex
 	}
 
-	err = decoder(reader)
-	if err != nil {
-		client.pool.discard(t)
-	} else {
-		client.pool.put(t)
+	if err = decoder(reader); err != nil {
+		return false, true, err
 	}
-	return err
+	// the server never sends unsolicited data, leftovers mean the response was not fully consumed
+	return reader.Buffered() == 0, true, nil
+}
+
+// Returns true if err indicates the peer closed the connection.
+func isConnectionClosedError(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+	if oe, ok := err.(*net.OpError); ok {
+		if se, ok := oe.Err.(*os.SyscallError); ok {
+			return se.Err == syscall.ECONNRESET || se.Err == syscall.EPIPE
+		}
+	}
+	return false
+}
+
+// A deadline in the past which makes pending and future I/O fail immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// Interrupts any blocked I/O on the tube once ctx is done by moving the deadline into the past.
+// The returned function stops watching and reports whether the tube was interrupted.
+// It must be called before the tube is released.
+func watchContext(ctx aws.Context, t tube) func() bool {
+	done := ctx.Done()
+	if done == nil {
+		return func() bool { return false }
+	}
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-done:
+			t.SetDeadline(aLongTimeAgo)
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+	return func() bool {
+		close(stop)
+		return <-interrupted
+	}
+}
+
+// InvalidateTableCache evicts the cached key schema of the table.
+// The next request for the table fetches it again.
+func (client *SingleDaxClient) InvalidateTableCache(table string) {
+	client.keySchema.Remove(table)
+}
+
+// Evicts the cached key schemas of the tables if err indicates they may be stale.
+func (client *SingleDaxClient) invalidateStaleKeySchemas(err error, tables ...string) {
+	if !isStaleKeySchemaError(err) {
+		return
+	}
+	invalidate := client.InvalidateTableCache
+	if client.invalidateTable != nil {
+		invalidate = client.invalidateTable
+	}
+	for _, table := range tables {
+		invalidate(table)
+	}
+}
+
+// Stats returns the counters of the client's connection pool.
+func (client *SingleDaxClient) Stats() Stats {
+	s := client.pool.stats()
+	s.ExpressionCacheHits, s.ExpressionCacheMisses = client.expressions.Stats()
+	s.Requests = atomic.LoadInt64(&client.requests)
+	return s
+}
+
+// Returns whether op is sent by the client itself, to discover the cluster
+// or define key schemas and attribute lists.
+func (client *SingleDaxClient) isInternal(op string) bool {
+	return op == opEndpoints || client.isHighPriority(op)
+}
+
+// Returns the key schema of table if it is cached, without loading it.
+func (client *SingleDaxClient) cachedKeySchema(table string) ([]dynamodb.AttributeDefinition, bool) {
+	v, ok := client.keySchema.Peek(table)
+	if !ok {
+		return nil, false
+	}
+	keys, ok := v.([]dynamodb.AttributeDefinition)
+	return keys, ok
 }
 
 func (client *SingleDaxClient) isHighPriority(op string) bool {
@@ -769,27 +1077,17 @@ func (client *SingleDaxClient) isHighPriority(op string) bool {
 	}
 }
 
-func (client *SingleDaxClient) recycleTube(t tube, err error) {
-	if t == nil {
-		return
-	}
-
-	var recycle bool
+// Returns whether the tube can be reused after the request failed with err.
+func (client *SingleDaxClient) canRecycle(t tube, err error) bool {
 	if err == nil {
-		recycle = true
-	} else {
-		// IO streams are guaranteed to be completely drained only on daxRequestException
-		d, ok := err.(*daxRequestFailure)
-		recycle = ok
-		if ok && d.authError() {
-			t.SetAuthExpiryUnix(time.Now().Unix())
-		}
+		return true
 	}
-	if recycle {
-		client.pool.put(t)
-	} else {
-		client.pool.discard(t)
+	// IO streams are guaranteed to be completely drained only on daxRequestException
+	d, ok := err.(*daxRequestFailure)
+	if ok && d.authError() {
+		t.SetAuthExpiryUnix(client.clock.Now().Unix())
 	}
+	return ok
 }
 func (client *SingleDaxClient) auth(t tube) error {
 	// TODO credentials.Get() cause a throughput drop of ~25 with 250 goroutines with DefaultCredentialChain (only instance profile credentials available)
@@ -797,11 +1095,11 @@ func (client *SingleDaxClient) auth(t tube) error {
 	if err != nil {
 		return err
 	}
-	now := time.Now().UTC()
+	now := client.clock.Now().UTC()
 	if t.CompareAndSwapAuthID(creds.AccessKeyID) || t.AuthExpiryUnix() <= now.Unix() {
 		stringToSign, signature := generateSigV4WithTime(creds, daxAddress, client.region, "", now)
 		writer := t.CborWriter()
-		if err := encodeAuthInput(creds.AccessKeyID, creds.SessionToken, stringToSign, signature, userAgent, writer); err != nil {
+		if err := encodeAuthInput(creds.AccessKeyID, creds.SessionToken, stringToSign, signature, client.pool.connConfig.agent(), writer); err != nil {
 			return err
 		}
 		if err := writer.Flush(); err != nil {
@@ -1,21 +1,28 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-dax-go/dax/internal/lru"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -137,6 +144,34 @@ func TestRetryPropogatesContextError(t *testing.T) {
 	}
 }
 
+func TestRetryWrapsErrors(t *testing.T) {
+	writer := func(writer *cbor.Writer) error { return nil }
+	reader := func(reader *cbor.Reader) error { return nil }
+
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	client, err := newSingleClientWithOptions(":9121", unEncryptedConnConfig, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 1, func(ctx context.Context, a, n string) (net.Conn, error) {
+		return nil, refused
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	err = client.executeWithRetries(OpGetItem, RequestOptions{MaxRetries: 1}, writer, reader)
+	var opErr *net.OpError
+	require.True(t, errors.As(err, &opErr), "expected a *net.OpError in %v", err)
+	require.Equal(t, refused, opErr)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = client.executeWithRetries(OpGetItem, RequestOptions{MaxRetries: 1, Context: canceled}, writer, reader)
+	require.True(t, errors.Is(err, context.Canceled), "expected context.Canceled in %v", err)
+	require.Equal(t, request.CanceledErrorCode, err.(awserr.Error).Code())
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	err = client.executeWithRetries(OpGetItem, RequestOptions{MaxRetries: 1, Context: expired}, writer, reader)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "expected context.DeadlineExceeded in %v", err)
+}
+
 func TestRetryPropogatesOtherErrors(t *testing.T) {
 	client, clientErr := newSingleClientWithOptions(":9121", unEncryptedConnConfig, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 1, func(ctx context.Context, a, n string) (net.Conn, error) {
 		return &mockConn{rd: []byte{cbor.Array + 0}}, nil
@@ -368,3 +403,1541 @@ func (m *mockConn) SetReadDeadline(t time.Time) error {
 func (m *mockConn) SetWriteDeadline(t time.Time) error {
 	return nil
 }
+
+func TestSingleClient_CancelInterruptsBlockedRead(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// never respond
+			go drainAndCloseConn(conn, make(chan net.Conn, 1))
+		}
+	}()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = cli.endpoints(RequestOptions{Context: ctx, MaxRetries: 2})
+	elapsed := time.Since(start)
+
+	require.Error(t, err)
+	aerr, ok := err.(awserr.Error)
+	require.True(t, ok, "expected awserr.Error, got %T", err)
+	require.Equal(t, request.CanceledErrorCode, aerr.Code())
+	require.Equal(t, context.Canceled, aerr.OrigErr())
+	require.True(t, elapsed < time.Second, "call returned after %v", elapsed)
+	require.Equal(t, 0, countTubes(cli.pool), "interrupted tube must not be returned to the pool")
+}
+
+func TestSingleClient_DeadlineDiscardsStalledConnection(t *testing.T) {
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		if conn == 0 {
+			return nil // first connection stalls
+		}
+		_, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0})
+		return err
+	})
+	defer listener.Close()
+
+	var dials int32
+	dialFn := func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	}
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, dialFn)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	dec := func(reader *cbor.Reader) error {
+		_, err := decodeEndpointsOutput(reader)
+		return err
+	}
+
+	ctx, cfn := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cfn()
+	err = cli.executeWithContext(ctx, opEndpoints, encodeEndpointsInput, dec, RequestOptions{})
+	require.Error(t, err)
+	require.Equal(t, request.ErrCodeResponseTimeout, translateError(err).Code())
+	require.Equal(t, 0, countTubes(cli.pool), "timed out tube must not be returned to the pool")
+
+	ctx, cfn = context.WithTimeout(context.Background(), time.Second)
+	defer cfn()
+	err = cli.executeWithContext(ctx, opEndpoints, encodeEndpointsInput, dec, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&dials), "expected a fresh connection for the next attempt")
+}
+
+func TestSingleClient_DiscardsConnectionAfterIncompleteResponse(t *testing.T) {
+	cases := []struct {
+		name  string
+		first []byte
+		err   bool
+	}{
+		{"truncated", []byte{cbor.Array + 0, cbor.Array + 1, cbor.Map + 2}, true},
+		{"trailing bytes", []byte{cbor.Array + 0, cbor.Array + 0, cbor.Array + 0}, false},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			served := make(chan int, 2)
+			listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+				served <- conn
+				resp := []byte{cbor.Array + 0, cbor.Array + 0}
+				if conn == 0 {
+					resp = c.first
+				}
+				_, err := w.Write(resp)
+				return err
+			})
+			defer listener.Close()
+
+			creds := credentials.NewStaticCredentials("id", "secret", "tok")
+			cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+			require.NoError(t, err)
+			defer cli.Close()
+
+			ctx, cfn := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cfn()
+			_, err = cli.endpoints(RequestOptions{Context: ctx})
+			if c.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, 0, <-served)
+			require.Equal(t, int64(1), cli.Stats().DiscardedConnections)
+
+			ctx, cfn = context.WithTimeout(context.Background(), time.Second)
+			defer cfn()
+			_, err = cli.endpoints(RequestOptions{Context: ctx})
+			require.NoError(t, err)
+			require.Equal(t, 1, <-served, "expected the request to be served on a fresh connection")
+			require.Equal(t, int64(1), cli.Stats().DiscardedConnections)
+		})
+	}
+}
+
+func TestSingleClient_StatsRequests(t *testing.T) {
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		_, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0})
+		return err
+	})
+	defer listener.Close()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	dec := func(reader *cbor.Reader) error {
+		_, err := decodeEndpointsOutput(reader)
+		return err
+	}
+	ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+	defer cfn()
+	require.NoError(t, cli.executeWithContext(ctx, opEndpoints, encodeEndpointsInput, dec, RequestOptions{}))
+	require.Zero(t, cli.Stats().Requests, "internal requests are not counted")
+	// the server answers any request as an endpoints request
+	require.NoError(t, cli.executeWithContext(ctx, OpGetItem, encodeEndpointsInput, dec, RequestOptions{}))
+	require.NoError(t, cli.executeWithContext(ctx, OpQuery, encodeEndpointsInput, dec, RequestOptions{}))
+	require.Equal(t, int64(2), cli.Stats().Requests)
+}
+
+// Starts a server speaking just enough of the DAX protocol to answer endpoints requests.
+// respond is called for every endpoints request with the index of the connection it was received on.
+func startEndpointsServer(t *testing.T, respond func(conn int, w io.Writer) error) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveEndpoints(conn, n, respond)
+		}
+	}()
+	return listener
+}
+
+func serveEndpoints(conn net.Conn, n int, respond func(conn int, w io.Writer) error) {
+	defer conn.Close()
+	r := cbor.NewReader(conn)
+	defer r.Close()
+	if err := skipHandshake(r); err != nil {
+		return
+	}
+	for {
+		if _, err := r.ReadInt(); err != nil { // service id
+			return
+		}
+		method, err := r.ReadInt()
+		if err != nil {
+			return
+		}
+		switch method {
+		case authorizeConnection_1489122155_1_Id:
+			if err := skipAuth(r); err != nil {
+				return
+			}
+		case endpoints_455855874_1_Id:
+			if err := respond(n, conn); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func skipHandshake(r *cbor.Reader) error {
+	if _, err := r.ReadString(); err != nil { // magic
+		return err
+	}
+	if _, err := r.ReadInt(); err != nil { // layering
+		return err
+	}
+	if _, err := r.ReadString(); err != nil { // session
+		return err
+	}
+	n, err := r.ReadMapLength() // header
+	if err != nil {
+		return err
+	}
+	for i := 0; i < 2*n; i++ {
+		if _, err := r.ReadString(); err != nil {
+			return err
+		}
+	}
+	_, err = r.ReadInt() // client mode
+	return err
+}
+
+// Skips a value of any type.
+func skipValue(r *cbor.Reader) error {
+	hdr, err := r.PeekHeader()
+	if err != nil {
+		return err
+	}
+	switch hdr & cbor.MajorTypeMask {
+	case cbor.PosInt, cbor.NegInt:
+		_, err = r.ReadInt64()
+	case cbor.Bytes:
+		_, err = r.ReadBytes()
+	case cbor.Utf:
+		_, err = r.ReadString()
+	case cbor.Tag:
+		if _, err = r.ReadTag(); err == nil {
+			err = skipValue(r)
+		}
+	case cbor.Array, cbor.Map:
+		var n int
+		if hdr&cbor.MajorTypeMask == cbor.Array {
+			n, err = r.ReadArrayLength()
+		} else {
+			n, err = r.ReadMapLength()
+			n *= 2
+		}
+		stream := hdr == cbor.ArrayStream || hdr == cbor.MapStream
+		for i := 0; err == nil && (stream || i < n); i++ {
+			if stream {
+				var end bool
+				if end, err = consumeBreak(r); end || err != nil {
+					break
+				}
+			}
+			err = skipValue(r)
+		}
+	default:
+		if hdr == cbor.Float16 || hdr == cbor.Float32 || hdr == cbor.Float64 {
+			_, err = r.ReadFloat64()
+		} else {
+			err = r.ReadNil() // simple values
+		}
+	}
+	return err
+}
+
+// Reads a stream of optional params, calling read for those it has a function
+// for and skipping the others.
+func readParams(r *cbor.Reader, read map[int]func(r *cbor.Reader) error) error {
+	if _, err := r.ReadMapLength(); err != nil { // params stream
+		return err
+	}
+	for {
+		if end, err := consumeBreak(r); end || err != nil {
+			return err
+		}
+		param, err := r.ReadInt()
+		if err != nil {
+			return err
+		}
+		fn := read[param]
+		if fn == nil {
+			fn = skipValue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+func skipAuth(r *cbor.Reader) error {
+	if _, err := r.ReadString(); err != nil { // access key
+		return err
+	}
+	if _, err := r.ReadString(); err != nil { // signature
+		return err
+	}
+	if _, err := r.ReadBytes(); err != nil { // string to sign
+		return err
+	}
+	for i := 0; i < 2; i++ { // session token, user agent
+		hdr, err := r.PeekHeader()
+		if err != nil {
+			return err
+		}
+		if hdr == cbor.Nil {
+			err = r.ReadNil()
+		} else {
+			_, err = r.ReadString()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSingleClient_RetriesIdleConnectionClosedByServer(t *testing.T) {
+	var requests int32
+	closed := make(chan struct{}, 1)
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		atomic.AddInt32(&requests, 1)
+		if _, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0}); err != nil {
+			return err
+		}
+		// close the connection once it becomes idle
+		err := w.(net.Conn).Close()
+		closed <- struct{}{}
+		return err
+	})
+	defer listener.Close()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	for i := 0; i < 5; i++ {
+		ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+		_, err := cli.endpoints(RequestOptions{Context: ctx, MaxRetries: 0})
+		cfn()
+		require.NoError(t, err)
+		<-closed
+	}
+	require.Equal(t, int32(5), atomic.LoadInt32(&requests))
+}
+
+func TestSingleClient_RetriesOnNewConnectionWhenAllIdleClosed(t *testing.T) {
+	const idle = 3
+	var requests, conns int32
+	var arrived, closed sync.WaitGroup
+	arrived.Add(idle)
+	closed.Add(idle)
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		atomic.AddInt32(&requests, 1)
+		first := int(atomic.AddInt32(&conns, 1)) <= idle
+		if first {
+			// hold the first requests until each has its own connection
+			arrived.Done()
+			arrived.Wait()
+		}
+		if _, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0}); err != nil {
+			return err
+		}
+		// close the connection once it becomes idle
+		err := w.(net.Conn).Close()
+		if first {
+			closed.Done()
+		}
+		return err
+	})
+	defer listener.Close()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < idle; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+			defer cfn()
+			_, err := cli.endpoints(RequestOptions{Context: ctx, MaxRetries: 0})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, idle, countTubes(cli.pool))
+	closed.Wait()
+
+	// the request is retried once, on a new connection rather than on another stale idle one
+	ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+	defer cfn()
+	_, err = cli.endpoints(RequestOptions{Context: ctx, MaxRetries: 0})
+	require.NoError(t, err)
+	require.Equal(t, int32(idle+1), atomic.LoadInt32(&requests))
+}
+
+func TestSingleClient_DoesNotRetryNewConnectionClosedByServer(t *testing.T) {
+	var requests int32
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		atomic.AddInt32(&requests, 1)
+		return errors.New("close") // close without responding
+	})
+	defer listener.Close()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "tok")
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", creds, 10, nil)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+	defer cfn()
+	_, err = cli.endpoints(RequestOptions{Context: ctx, MaxRetries: 0})
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestSingleClient_PingAfterIdle(t *testing.T) {
+	cases := []struct {
+		name          string
+		pingAfterIdle time.Duration
+		closeIdle     bool
+		expRequests   int32
+		expConn       int
+	}{
+		{"healthy idle connection is reused", 20 * time.Millisecond, false, 3, 0},
+		{"dead idle connection is replaced", 20 * time.Millisecond, true, 2, 1},
+		{"disabled", 0, false, 2, 0},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			var requests int32
+			served := make(chan int, 3)
+			listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+				atomic.AddInt32(&requests, 1)
+				served <- conn
+				if _, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0}); err != nil {
+					return err
+				}
+				if c.closeIdle {
+					return errors.New("close")
+				}
+				return nil
+			})
+			defer listener.Close()
+
+			clock := newFakeClock()
+			cc := connConfigData
+			cc.pingAfterIdle = c.pingAfterIdle
+			cc.clock = clock
+			creds := credentials.NewStaticCredentials("id", "secret", "tok")
+			cli, err := newSingleClientWithOptions(listener.Addr().String(), cc, "us-west-2", creds, 10, nil)
+			require.NoError(t, err)
+			defer cli.Close()
+
+			for i := 0; i < 2; i++ {
+				ctx, cfn := context.WithTimeout(context.Background(), time.Second)
+				_, err := cli.endpoints(RequestOptions{Context: ctx})
+				cfn()
+				require.NoError(t, err)
+				clock.Advance(40 * time.Millisecond)
+			}
+			require.Equal(t, c.expRequests, atomic.LoadInt32(&requests))
+			var last int
+			for len(served) > 0 {
+				last = <-served
+			}
+			require.Equal(t, c.expConn, last)
+		})
+	}
+}
+
+// A table served by startTableServer. Its key schema can be changed, or the table deleted, at any time.
+type testTable struct {
+	lock          sync.Mutex
+	keys          []dynamodb.AttributeDefinition // nil if the table does not exist
+	key           map[string]*dynamodb.AttributeValue
+	defineSchemas int
+	schemaFails   bool           // fails defineKeySchema with an internal error
+	schemaGate    chan struct{}  // if set, each defineKeySchema response waits for a value
+	writes        map[int][]byte // responses to write requests by method
+	attrLists     [][]string     // attribute names lists by id, after the reserved empty list
+	tokens        []string       // client request tokens of the transact writes received
+	queries       [][]byte       // responses to the next queries, with the error part left out
+	selects       []int          // select params of the queries received
+	startKeys     [][]byte       // exclusive start keys of the queries received, nil if absent
+	forwards      []int          // scan index forward params of the queries received, -1 if absent
+}
+
+// Returns the id of the attribute names list, defining it if needed.
+func (tt *testTable) attrListId(names []string) int64 {
+	if len(names) == 0 {
+		return emptyAttributeListId
+	}
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+	for i, l := range tt.attrLists {
+		if reflect.DeepEqual(l, names) {
+			return emptyAttributeListId + 1 + int64(i)
+		}
+	}
+	tt.attrLists = append(tt.attrLists, names)
+	return emptyAttributeListId + int64(len(tt.attrLists))
+}
+
+func (tt *testTable) attrList(id int64) []string {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+	i := id - emptyAttributeListId - 1
+	if i < 0 || i >= int64(len(tt.attrLists)) {
+		return nil
+	}
+	return tt.attrLists[i]
+}
+
+func (tt *testTable) recreate(key map[string]*dynamodb.AttributeValue, keys ...dynamodb.AttributeDefinition) {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+	tt.keys, tt.key = keys, key
+}
+
+func (tt *testTable) schemaRequests() int {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+	return tt.defineSchemas
+}
+
+// Starts a server answering defineKeySchema and GetItem requests for the table.
+// GetItem fails with ResourceNotFoundException if the table does not exist, with
+// ProvisionedThroughputExceededException for the string key "hot", and with
+// ValidationException if the requested key is not the table's key encoded with its schema.
+func startTableServer(t *testing.T, tt *testTable) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTable(conn, tt)
+		}
+	}()
+	return listener
+}
+
+func serveTable(conn net.Conn, tt *testTable) {
+	defer conn.Close()
+	r := cbor.NewReader(conn)
+	defer r.Close()
+	w := cbor.NewWriter(conn)
+	defer w.Close()
+	writeError := func(codes []int, msg string) error {
+		w.WriteArrayHeader(len(codes))
+		for _, c := range codes {
+			w.WriteInt(c)
+		}
+		w.WriteString(msg)
+		return w.WriteNull()
+	}
+	if err := skipHandshake(r); err != nil {
+		return
+	}
+	for {
+		if _, err := r.ReadInt(); err != nil { // service id
+			return
+		}
+		method, err := r.ReadInt()
+		if err != nil {
+			return
+		}
+		switch method {
+		case authorizeConnection_1489122155_1_Id:
+			if err := skipAuth(r); err != nil {
+				return
+			}
+		case defineKeySchema_N742646399_1_Id:
+			if _, err := r.ReadBytes(); err != nil {
+				return
+			}
+			tt.lock.Lock()
+			tt.defineSchemas++
+			keys, fails, gate := tt.keys, tt.schemaFails, tt.schemaGate
+			tt.lock.Unlock()
+			if gate != nil {
+				<-gate
+			}
+			if fails {
+				err = writeError([]int{4, 37, 38, 39, 47}, "Internal server error")
+			} else if keys == nil {
+				err = writeError([]int{4, 37, 38, 39, 41}, "Requested resource not found")
+			} else {
+				w.WriteArrayHeader(0)
+				w.WriteMapHeader(len(keys))
+				for _, k := range keys {
+					w.WriteString(*k.AttributeName)
+					err = w.WriteString(*k.AttributeType)
+				}
+			}
+		case defineAttributeListId_N1230579644_1_Id:
+			n, err := r.ReadArrayLength()
+			if err != nil {
+				return
+			}
+			names := make([]string, n)
+			for i := range names {
+				if names[i], err = r.ReadString(); err != nil {
+					return
+				}
+			}
+			w.WriteArrayHeader(0)
+			err = w.WriteInt64(tt.attrListId(names))
+		case defineAttributeList_670678385_1_Id:
+			id, err := r.ReadInt64()
+			if err != nil {
+				return
+			}
+			names := tt.attrList(id)
+			w.WriteArrayHeader(0)
+			w.WriteArrayHeader(len(names))
+			for _, n := range names {
+				err = w.WriteString(n)
+			}
+		case putItem_N2106490455_1_Id, deleteItem_1013539361_1_Id, updateItem_1425579023_1_Id, batchWriteItem_116217951_1_Id, transactWriteItems_N1160037738_1_Id:
+			// the values of the request: table, key, item and optional params of a put, the request items and
+			// optional params of a batch, or the arrays of each part of the actions of a transaction and its params
+			values := map[int]int{
+				putItem_N2106490455_1_Id:            4,
+				deleteItem_1013539361_1_Id:          3,
+				updateItem_1425579023_1_Id:          3,
+				batchWriteItem_116217951_1_Id:       2,
+				transactWriteItems_N1160037738_1_Id: 8,
+			}[method]
+			for i := 0; i < values; i++ {
+				if err := skipValue(r); err != nil {
+					return
+				}
+			}
+			if method == transactWriteItems_N1160037738_1_Id {
+				var token string
+				err := readParams(r, map[int]func(r *cbor.Reader) error{
+					requestParamRequestItemsClientRequestToken: func(r *cbor.Reader) (err error) {
+						token, err = r.ReadString()
+						return err
+					},
+				})
+				if err != nil {
+					return
+				}
+				tt.lock.Lock()
+				tt.tokens = append(tt.tokens, token)
+				tt.lock.Unlock()
+			}
+			tt.lock.Lock()
+			response := tt.writes[method]
+			tt.lock.Unlock()
+			err = w.Write(response)
+		case query_N931250863_1_Id:
+			if _, err := r.ReadBytes(); err != nil { // table
+				return
+			}
+			if _, err := r.ReadBytes(); err != nil { // key condition expression
+				return
+			}
+			selection := selectAllAttributes
+			forward := -1
+			var startKey []byte
+			err := readParams(r, map[int]func(r *cbor.Reader) error{
+				requestParamSelect: func(r *cbor.Reader) (err error) {
+					selection, err = r.ReadInt()
+					return err
+				},
+				requestParamScanIndexForward: func(r *cbor.Reader) (err error) {
+					forward, err = r.ReadInt()
+					return err
+				},
+				requestParamExclusiveStartKey: func(r *cbor.Reader) (err error) {
+					startKey, err = r.ReadBytes()
+					return err
+				},
+			})
+			if err != nil {
+				return
+			}
+			tt.lock.Lock()
+			tt.selects = append(tt.selects, selection)
+			tt.startKeys = append(tt.startKeys, startKey)
+			tt.forwards = append(tt.forwards, forward)
+			response := tt.queries[0]
+			tt.queries = tt.queries[1:]
+			tt.lock.Unlock()
+			w.WriteArrayHeader(0)
+			err = w.Write(response)
+		case getItem_263244906_1_Id:
+			if _, err := r.ReadBytes(); err != nil { // table
+				return
+			}
+			key, err := r.ReadBytes()
+			if err != nil {
+				return
+			}
+			if _, err := r.ReadMapLength(); err != nil { // optional params stream
+				return
+			}
+			if err := r.ReadBreak(); err != nil {
+				return
+			}
+			tt.lock.Lock()
+			keys, item := tt.keys, tt.key
+			tt.lock.Unlock()
+			if keys == nil {
+				err = writeError([]int{4, 37, 38, 39, 41}, "Requested resource not found")
+			} else if string(key) == "hot" {
+				err = writeError([]int{4, 37, 38, 39, 40}, "The level of configured provisioned throughput for the table was exceeded")
+			} else if expected, _ := cbor.GetEncodedItemKey(item, keys); !bytes.Equal(expected, key) {
+				err = writeError([]int{4, 37, 38, 39, 46}, "The provided key element does not match the schema")
+			} else {
+				w.WriteArrayHeader(0)
+				err = w.WriteNull()
+			}
+		default:
+			return
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestSingleClient_KeySchemaInvalidatedOnTableRecreate(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	hkN := dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)}
+	rk := dynamodb.AttributeDefinition{AttributeName: aws.String("rk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)}
+	hashKey := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}
+	compositeKey := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}, "rk": {N: aws.String("1")}}
+	numberKey := map[string]*dynamodb.AttributeValue{"id": {N: aws.String("1")}}
+
+	tt := &testTable{}
+	tt.recreate(hashKey, hk)
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	getItem := func(key map[string]*dynamodb.AttributeValue) error {
+		input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+		_, err := cli.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+		return err
+	}
+	requireCode := func(code string, err error) {
+		e, ok := convertDaxError(err.(daxError)).(awserr.Error)
+		require.True(t, ok, "unexpected error %v", err)
+		require.Equal(t, code, e.Code())
+	}
+
+	require.NoError(t, getItem(hashKey))
+	require.NoError(t, getItem(hashKey))
+	require.Equal(t, 1, tt.schemaRequests())
+
+	// recreated with a range key: the server rejects the key encoded with the cached schema
+	tt.recreate(compositeKey, hk, rk)
+	err = getItem(compositeKey)
+	requireCode(ErrCodeValidationException, err)
+	require.NoError(t, getItem(compositeKey))
+	require.Equal(t, 2, tt.schemaRequests())
+
+	// deleted, then recreated with a number hash key
+	tt.recreate(nil)
+	requireCode(dynamodb.ErrCodeResourceNotFoundException, getItem(compositeKey))
+	tt.recreate(numberKey, hkN)
+	require.NoError(t, getItem(numberKey))
+	require.Equal(t, 3, tt.schemaRequests())
+
+	// recreated with a string hash key: the key is rejected before being sent
+	tt.recreate(hashKey, hk)
+	require.Equal(t, cbor.ErrMissingKey, getItem(hashKey))
+	require.NoError(t, getItem(hashKey))
+	require.Equal(t, 4, tt.schemaRequests())
+
+	// other errors keep the cached schema
+	requireCode(dynamodb.ErrCodeProvisionedThroughputExceededException, getItem(map[string]*dynamodb.AttributeValue{"id": {S: aws.String("hot")}}))
+	require.NoError(t, getItem(hashKey))
+	require.Equal(t, 4, tt.schemaRequests())
+
+	cli.InvalidateTableCache("table")
+	require.NoError(t, getItem(hashKey))
+	require.Equal(t, 5, tt.schemaRequests())
+}
+
+// Builds single clients connecting to addr whatever the node address.
+type fixedAddrClientBuilder struct {
+	addr string
+}
+
+func (b *fixedAddrClientBuilder) newClient(host string, ip net.IP, port int, connConfigData connConfig, region string, credentials *credentials.Credentials, maxPendingConnects int, dialContextFn dialContext) (DaxAPI, error) {
+	return newSingleClientWithOptions(b.addr, connConfigData, region, credentials, maxPendingConnects, dialContextFn)
+}
+
+func TestCluster_StaleKeySchemaInvalidatedOnAllNodes(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	rk := dynamodb.AttributeDefinition{AttributeName: aws.String("rk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)}
+	hashKey := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}
+	compositeKey := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}, "rk": {N: aws.String("1")}}
+
+	tt := &testTable{}
+	tt.recreate(hashKey, hk)
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"localhost:8111"}
+	cfg.Region = "us-west-2"
+	cfg.Credentials = credentials.NewStaticCredentials("id", "secret", "tok")
+	cluster, _ := newTestClusterWithConfig(cfg)
+	cluster.clientBuilder = &fixedAddrClientBuilder{addr: listener.Addr().String()}
+	defer cluster.Close()
+	require.NoError(t, cluster.update([]serviceEndpoint{{address: []byte{127, 0, 0, 1}, port: 8111}, {address: []byte{127, 0, 0, 2}, port: 8111}}))
+	cluster.lock.RLock()
+	nodes := cluster.routes
+	cluster.lock.RUnlock()
+	require.Len(t, nodes, 2)
+
+	getItem := func(client DaxAPI, key map[string]*dynamodb.AttributeValue) error {
+		input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+		_, err := client.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+		return err
+	}
+	for _, n := range nodes {
+		require.NoError(t, getItem(n, hashKey))
+	}
+	require.Equal(t, 2, tt.schemaRequests())
+
+	// the failure on the first node evicts the stale schema of the second one too
+	tt.recreate(compositeKey, hk, rk)
+	require.Error(t, getItem(nodes[0], compositeKey))
+	require.NoError(t, getItem(nodes[1], compositeKey))
+	require.Equal(t, 3, tt.schemaRequests())
+}
+
+func TestSingleClient_KeySchemaLookupsShared(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}
+	gate := make(chan struct{})
+	tt := &testTable{schemaGate: gate}
+	tt.recreate(key, hk)
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	var started, wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+			if _, err := cli.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{}); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	// the first lookup is held until all requests started, those yet to look
+	// the schema up by the time it is answered find it cached
+	started.Wait()
+	close(gate)
+	wg.Wait()
+	require.Equal(t, 1, tt.schemaRequests())
+}
+
+func TestSingleClient_KeySchemaRefreshedInBackground(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}
+	tt := &testTable{}
+	tt.recreate(key, hk)
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	clock := newFakeClock()
+	cc := connConfigData
+	cc.keySchemaTTL = 1200 * time.Millisecond // refreshed during the last 300ms
+	cc.clock = clock
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), cc, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	refreshed := make(chan error)
+	cli.keySchema.OnRefresh = func(key lru.Key, err error) { refreshed <- err }
+	getItem := func() {
+		// bounded, so a request waiting for the gated refresh fails rather than hangs
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+		_, err := cli.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{Context: ctx})
+		require.NoError(t, err)
+	}
+	gate := make(chan struct{})
+	setSchemaFails := func(fails bool) {
+		tt.lock.Lock()
+		tt.schemaFails, tt.schemaGate = fails, gate
+		tt.lock.Unlock()
+	}
+
+	getItem()
+	require.Equal(t, 1, tt.schemaRequests())
+
+	// a failed background refresh keeps serving the cached schema,
+	// requests do not wait for the refresh held by the gate
+	setSchemaFails(true)
+	clock.Advance(920 * time.Millisecond)
+	getItem()
+	getItem()
+	gate <- struct{}{}
+	require.Error(t, <-refreshed)
+	require.Equal(t, 2, tt.schemaRequests())
+
+	// the next use refreshes it again, without blocking requests
+	setSchemaFails(false)
+	getItem()
+	gate <- struct{}{}
+	require.NoError(t, <-refreshed)
+	getItem()
+	require.Equal(t, 3, tt.schemaRequests(), "expected the refreshed schema to be cached")
+}
+
+func TestSingleClient_ItemCollectionMetrics(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	metrics := itemCollectionMetricsTestValue("a", 1, 2)
+	encode := func(write func(w *cbor.Writer) error) []byte {
+		var buf bytes.Buffer
+		w := cbor.NewWriter(&buf)
+		defer w.Close()
+		require.NoError(t, w.WriteArrayHeader(0)) // no error
+		require.NoError(t, write(w))
+		require.NoError(t, w.Flush())
+		return buf.Bytes()
+	}
+	itemResponse := encode(func(w *cbor.Writer) error {
+		w.WriteMapHeader(1)
+		w.WriteInt(responseParamItemCollectionMetrics)
+		return encodeItemCollectionMetrics(w, metrics)
+	})
+	tt := &testTable{writes: map[int][]byte{
+		putItem_N2106490455_1_Id:   itemResponse,
+		deleteItem_1013539361_1_Id: itemResponse,
+		updateItem_1425579023_1_Id: itemResponse,
+		batchWriteItem_116217951_1_Id: encode(func(w *cbor.Writer) error {
+			w.WriteMapHeader(0)
+			w.WriteArrayHeader(0)
+			return encodeItemCollectionMetricsByTable(w, map[string][]*dynamodb.ItemCollectionMetrics{"table": {metrics}})
+		}),
+	}}
+	tt.recreate(key, hk)
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	size := aws.String(dynamodb.ReturnItemCollectionMetricsSize)
+	put, err := cli.PutItemWithOptions(&dynamodb.PutItemInput{TableName: aws.String("table"), Item: key, ReturnItemCollectionMetrics: size}, &dynamodb.PutItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, metrics, put.ItemCollectionMetrics)
+	del, err := cli.DeleteItemWithOptions(&dynamodb.DeleteItemInput{TableName: aws.String("table"), Key: key, ReturnItemCollectionMetrics: size}, &dynamodb.DeleteItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, metrics, del.ItemCollectionMetrics)
+	update, err := cli.UpdateItemWithOptions(&dynamodb.UpdateItemInput{TableName: aws.String("table"), Key: key, ReturnItemCollectionMetrics: size}, &dynamodb.UpdateItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, metrics, update.ItemCollectionMetrics)
+	batch, err := cli.BatchWriteItemWithOptions(&dynamodb.BatchWriteItemInput{
+		RequestItems:                map[string][]*dynamodb.WriteRequest{"table": {{PutRequest: &dynamodb.PutRequest{Item: key}}}},
+		ReturnItemCollectionMetrics: size,
+	}, &dynamodb.BatchWriteItemOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]*dynamodb.ItemCollectionMetrics{"table": {metrics}}, batch.ItemCollectionMetrics)
+}
+
+func TestSingleClient_TransactWriteReturnValuesOnConditionCheckFailure(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := func(hk string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"hk": {S: aws.String(hk)}}
+	}
+	old := map[string]*dynamodb.AttributeValue{
+		"hk":    {S: aws.String("b")},
+		"count": {N: aws.String("1")},
+		"tags":  {SS: []*string{aws.String("x")}},
+	}
+	tt := &testTable{}
+	tt.recreate(key("a"), hk)
+	namesToId := &lru.Lru{
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			return tt.attrListId(key.([]string)), nil
+		},
+		KeyMarshaller: func(key lru.Key) lru.Key {
+			return fmt.Sprint(key.([]string))
+		},
+	}
+
+	// the second action fails its condition, the others are not at fault
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	codes := []int{4, 37, 38, 39, 58}
+	w.WriteArrayHeader(len(codes))
+	for _, c := range codes {
+		w.WriteInt(c)
+	}
+	w.WriteString("Transaction cancelled, please refer cancellation reasons for specific reasons [None, ConditionalCheckFailed, None]")
+	w.WriteArrayHeader(4)
+	w.WriteString("request-id")
+	w.WriteString(dynamodb.ErrCodeTransactionCanceledException)
+	w.WriteInt(400)
+	w.WriteArrayHeader(9)
+	for i := 0; i < 3; i++ {
+		if i != 1 {
+			w.WriteString("None")
+			w.WriteNull()
+			w.WriteNull()
+			continue
+		}
+		w.WriteString("ConditionalCheckFailed")
+		w.WriteString("The conditional request failed")
+		require.NoError(t, encodeNonKeyAttributes(context.Background(), old, []dynamodb.AttributeDefinition{hk}, namesToId, w))
+	}
+	require.NoError(t, w.Flush())
+	tt.writes = map[int][]byte{transactWriteItems_N1160037738_1_Id: buf.Bytes()}
+
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	allOld := aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld)
+	input := &dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+		{Put: &dynamodb.Put{TableName: aws.String("table"), Item: key("a"), ReturnValuesOnConditionCheckFailure: allOld}},
+		{Update: &dynamodb.Update{
+			TableName:                           aws.String("table"),
+			Key:                                 key("b"),
+			UpdateExpression:                    aws.String("SET #c = #c + :one"),
+			ConditionExpression:                 aws.String("#c > :one"),
+			ExpressionAttributeNames:            map[string]*string{"#c": aws.String("count")},
+			ExpressionAttributeValues:           map[string]*dynamodb.AttributeValue{":one": {N: aws.String("1")}},
+			ReturnValuesOnConditionCheckFailure: allOld,
+		}},
+		{ConditionCheck: &dynamodb.ConditionCheck{
+			TableName:           aws.String("table"),
+			Key:                 key("c"),
+			ConditionExpression: aws.String("attribute_not_exists(hk)"),
+		}},
+	}}
+	_, err = cli.TransactWriteItemsWithOptions(input, &dynamodb.TransactWriteItemsOutput{}, RequestOptions{})
+	require.Error(t, err)
+	d, ok := err.(daxError)
+	require.True(t, ok, "unexpected error %v", err)
+	canceled, ok := convertDaxError(d).(*dynamodb.TransactionCanceledException)
+	require.True(t, ok, "unexpected error %v", convertDaxError(d))
+	require.Equal(t, []*dynamodb.CancellationReason{
+		{Code: aws.String("None")},
+		{Code: aws.String("ConditionalCheckFailed"), Message: aws.String("The conditional request failed"), Item: old},
+		{Code: aws.String("None")},
+	}, canceled.CancellationReasons)
+}
+
+func TestSingleClient_TransactWriteClientRequestToken(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	tt := &testTable{}
+	tt.recreate(key, hk)
+
+	// every attempt fails with an internal error
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	codes := []int{1, 23, 31, 33}
+	w.WriteArrayHeader(len(codes))
+	for _, c := range codes {
+		w.WriteInt(c)
+	}
+	w.WriteString("internal error")
+	w.WriteNull()
+	require.NoError(t, w.Flush())
+	tt.writes = map[int][]byte{transactWriteItems_N1160037738_1_Id: buf.Bytes()}
+
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	sent := func() []string {
+		tt.lock.Lock()
+		defer tt.lock.Unlock()
+		tokens := tt.tokens
+		tt.tokens = nil
+		return tokens
+	}
+	input := func(token *string) *dynamodb.TransactWriteItemsInput {
+		return &dynamodb.TransactWriteItemsInput{
+			ClientRequestToken: token,
+			TransactItems:      []*dynamodb.TransactWriteItem{{Put: &dynamodb.Put{TableName: aws.String("table"), Item: key}}},
+		}
+	}
+
+	generated := input(nil)
+	_, err = cli.TransactWriteItemsWithOptions(generated, &dynamodb.TransactWriteItemsOutput{}, RequestOptions{MaxRetries: 2})
+	require.Error(t, err)
+	require.NotNil(t, generated.ClientRequestToken)
+	require.Len(t, *generated.ClientRequestToken, maxClientRequestTokenLength)
+	token := *generated.ClientRequestToken
+	require.Equal(t, []string{token, token, token}, sent())
+
+	_, err = cli.TransactWriteItemsWithOptions(input(nil), &dynamodb.TransactWriteItemsOutput{}, RequestOptions{})
+	require.Error(t, err)
+	other := sent()
+	require.Len(t, other, 1)
+	require.NotEqual(t, token, other[0], "each call gets its own token")
+
+	_, err = cli.TransactWriteItemsWithOptions(input(aws.String("caller-token")), &dynamodb.TransactWriteItemsOutput{}, RequestOptions{MaxRetries: 1})
+	require.Error(t, err)
+	require.Equal(t, []string{"caller-token", "caller-token"}, sent())
+
+	_, err = cli.TransactWriteItemsWithOptions(input(aws.String(strings.Repeat("t", maxClientRequestTokenLength+1))), &dynamodb.TransactWriteItemsOutput{}, RequestOptions{MaxRetries: 1})
+	require.Error(t, err)
+	aerr, ok := err.(awserr.Error)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, request.InvalidParameterErrCode, aerr.Code())
+	require.Contains(t, aerr.Error(), "ClientRequestToken")
+	require.Empty(t, sent(), "invalid tokens are not sent")
+}
+
+func TestSingleClient_TransactWriteValidation(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	tt := &testTable{}
+	tt.recreate(key, hk)
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	w.WriteArrayHeader(0) // no error
+	w.WriteArrayHeader(3)
+	w.WriteArrayHeader(0) // no return values
+	w.WriteArrayHeader(0) // no consumed capacity
+	w.WriteMapHeader(0)   // no item collection metrics
+	require.NoError(t, w.Flush())
+	tt.writes = map[int][]byte{transactWriteItems_N1160037738_1_Id: buf.Bytes()}
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+
+	duplicates := &dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+		{Put: &dynamodb.Put{TableName: aws.String("table"), Item: key}},
+		{Delete: &dynamodb.Delete{TableName: aws.String("table"), Key: key}},
+	}}
+	sent := func() int {
+		tt.lock.Lock()
+		defer tt.lock.Unlock()
+		return len(tt.tokens)
+	}
+
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+	_, err = cli.TransactWriteItemsWithOptions(duplicates, &dynamodb.TransactWriteItemsOutput{}, RequestOptions{MaxRetries: 2})
+	require.Error(t, err)
+	d, ok := err.(daxError)
+	require.True(t, ok, "unexpected error %v", err)
+	require.False(t, DaxRetryer{}.ShouldRetry(&request.Request{Error: err}))
+	converted, ok := convertDaxError(d).(awserr.RequestFailure)
+	require.True(t, ok, "unexpected error %v", convertDaxError(d))
+	require.Equal(t, ErrCodeValidationException, converted.Code())
+	require.Contains(t, converted.Message(), "TransactItems[0] and TransactItems[1]")
+	require.Equal(t, 0, sent())
+
+	skipping := connConfigData
+	skipping.skipValidation = true
+	cli, err = newSingleClientWithOptions(listener.Addr().String(), skipping, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+	tooMany := &dynamodb.TransactWriteItemsInput{}
+	for i := 0; i <= maxTransactItems; i++ {
+		key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String(strconv.Itoa(i))}}
+		tooMany.TransactItems = append(tooMany.TransactItems, &dynamodb.TransactWriteItem{Put: &dynamodb.Put{TableName: aws.String("table"), Item: key}})
+	}
+	_, err = cli.TransactWriteItemsWithOptions(tooMany, &dynamodb.TransactWriteItemsOutput{}, RequestOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, sent())
+}
+
+// Records the operations of the captured frames.
+type opRecorder struct {
+	lock      sync.Mutex
+	requests  []string
+	responses []string
+}
+
+func (r *opRecorder) CaptureFrame(f Frame) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if f.Direction == FrameRequest {
+		r.requests = append(r.requests, f.Op)
+	} else {
+		r.responses = append(r.responses, f.Op)
+	}
+}
+
+func TestSingleClient_TransactionsCapturedUnderTheirOwnOps(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	tt := &testTable{}
+	tt.recreate(key, hk)
+
+	var buf bytes.Buffer
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	codes := []int{1, 23, 31, 33}
+	w.WriteArrayHeader(len(codes))
+	for _, c := range codes {
+		w.WriteInt(c)
+	}
+	w.WriteString("internal error")
+	w.WriteNull()
+	require.NoError(t, w.Flush())
+	tt.writes = map[int][]byte{transactWriteItems_N1160037738_1_Id: buf.Bytes()}
+
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	rec := &opRecorder{}
+	cc := connConfigData
+	cc.frameCapture = rec
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), cc, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	// the replayer decodes captured frames by their op, transactions must not be reported as batches
+	write := &dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{{Put: &dynamodb.Put{TableName: aws.String("table"), Item: key}}}}
+	_, err = cli.TransactWriteItemsWithOptions(write, &dynamodb.TransactWriteItemsOutput{}, RequestOptions{})
+	require.Error(t, err)
+	// the server closes the connection on TransactGetItems, only its requests are captured: the
+	// one sent on the reused connection and its retry on a new one
+	get := &dynamodb.TransactGetItemsInput{TransactItems: []*dynamodb.TransactGetItem{{Get: &dynamodb.Get{TableName: aws.String("table"), Key: key}}}}
+	_, err = cli.TransactGetItemsWithOptions(get, &dynamodb.TransactGetItemsOutput{}, RequestOptions{})
+	require.Error(t, err)
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	require.Equal(t, []string{opDefineKeySchema, OpTransactWriteItems, OpTransactGetItems, OpTransactGetItems}, rec.requests)
+	require.Contains(t, rec.responses, OpTransactWriteItems)
+	require.NotContains(t, rec.responses, OpBatchWriteItem)
+}
+
+func TestSingleClient_QueryCount(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	key := func(hk string) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"hk": {S: aws.String(hk)}}
+	}
+	tt := &testTable{}
+	tt.recreate(key("a"), hk)
+
+	// the pages of counts, the last one with an empty list of items
+	page := func(count, scanned int, last map[string]*dynamodb.AttributeValue, items bool) []byte {
+		var buf bytes.Buffer
+		w := cbor.NewWriter(&buf)
+		defer w.Close()
+		w.WriteMapStreamHeader()
+		w.WriteInt(responseParamCount)
+		w.WriteInt(count)
+		w.WriteInt(responseParamScannedCount)
+		w.WriteInt(scanned)
+		if items {
+			w.WriteInt(responseParamItems)
+			w.WriteArrayHeader(0)
+		}
+		if last != nil {
+			w.WriteInt(responseParamLastEvaluatedKey)
+			require.NoError(t, cbor.EncodeItemKey(last, []dynamodb.AttributeDefinition{hk}, w))
+		}
+		w.WriteStreamBreak()
+		require.NoError(t, w.Flush())
+		return buf.Bytes()
+	}
+	tt.queries = [][]byte{page(3, 5, key("b"), false), page(0, 4, key("c"), false), page(2, 2, nil, true)}
+
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("table"),
+		KeyConditionExpression:    aws.String("hk = :hk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":hk": {S: aws.String("a")}},
+		Select:                    aws.String(dynamodb.SelectCount),
+	}
+	var count, scanned int64
+	var starts []map[string]*dynamodb.AttributeValue
+	for pages := 0; ; pages++ {
+		require.True(t, pages < 3, "too many pages")
+		out, err := cli.QueryWithOptions(input, &dynamodb.QueryOutput{}, RequestOptions{})
+		require.NoError(t, err)
+		require.Nil(t, out.Items)
+		count += aws.Int64Value(out.Count)
+		scanned += aws.Int64Value(out.ScannedCount)
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+		starts = append(starts, out.LastEvaluatedKey)
+	}
+	require.Equal(t, int64(5), count)
+	require.Equal(t, int64(11), scanned)
+	require.Equal(t, []map[string]*dynamodb.AttributeValue{key("b"), key("c")}, starts)
+	require.Equal(t, []int{selectCount, selectCount, selectCount}, tt.selects)
+}
+
+func TestSingleClient_QueryPagination(t *testing.T) {
+	hk := dynamodb.AttributeDefinition{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)}
+	attr := func(name, typ string) dynamodb.AttributeDefinition {
+		return dynamodb.AttributeDefinition{AttributeName: aws.String(name), AttributeType: aws.String(typ)}
+	}
+	cases := []struct {
+		name  string
+		keys  []dynamodb.AttributeDefinition
+		index *string
+		lasts []map[string]*dynamodb.AttributeValue
+	}{
+		{
+			name: "binary range key",
+			keys: []dynamodb.AttributeDefinition{hk, attr("rk", dynamodb.ScalarAttributeTypeB)},
+			lasts: []map[string]*dynamodb.AttributeValue{
+				{"hk": {S: aws.String("a")}, "rk": {B: []byte{0x00}}},
+				{"hk": {S: aws.String("a")}, "rk": {B: []byte{0x00, 0x00}}},
+				{"hk": {S: aws.String("a")}, "rk": {B: []byte{0xff, 0x01, 0x80}}},
+			},
+		},
+		{
+			name: "number range key",
+			keys: []dynamodb.AttributeDefinition{hk, attr("rk", dynamodb.ScalarAttributeTypeN)},
+			lasts: []map[string]*dynamodb.AttributeValue{
+				{"hk": {S: aws.String("a")}, "rk": {N: aws.String("-25E-1")}},
+				{"hk": {S: aws.String("a")}, "rk": {N: aws.String("1E62")}},
+				{"hk": {S: aws.String("a")}, "rk": {N: aws.String("123456789012345678901234567890")}},
+			},
+		},
+		{
+			name:  "global secondary index",
+			keys:  []dynamodb.AttributeDefinition{hk},
+			index: aws.String("gsi"),
+			lasts: []map[string]*dynamodb.AttributeValue{
+				{"hk": {S: aws.String("a")}, "ghk": {B: []byte{1}}, "grk": {N: aws.String("1E-100")}},
+				{"hk": {S: aws.String("b")}, "ghk": {B: []byte{1}}, "grk": {N: aws.String("-7")}},
+				{"hk": {S: aws.String("c")}, "ghk": {B: []byte{1, 0}}, "grk": {N: aws.String("0")}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tt := &testTable{}
+			tt.recreate(c.lasts[0], c.keys...)
+
+			// a page of no items, ending with the given key
+			page := func(last map[string]*dynamodb.AttributeValue) []byte {
+				var buf bytes.Buffer
+				w := cbor.NewWriter(&buf)
+				defer w.Close()
+				w.WriteMapStreamHeader()
+				w.WriteInt(responseParamItems)
+				w.WriteArrayHeader(0)
+				if last != nil {
+					w.WriteInt(responseParamLastEvaluatedKey)
+					if c.index == nil {
+						require.NoError(t, cbor.EncodeItemKey(last, c.keys, w))
+					} else {
+						require.NoError(t, encodeCompoundKey(last, w))
+					}
+				}
+				w.WriteStreamBreak()
+				require.NoError(t, w.Flush())
+				return buf.Bytes()
+			}
+			for _, last := range c.lasts {
+				tt.queries = append(tt.queries, page(last))
+			}
+			tt.queries = append(tt.queries, page(nil))
+
+			listener := startTableServer(t, tt)
+			defer listener.Close()
+			cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+			require.NoError(t, err)
+			defer cli.Close()
+
+			input := &dynamodb.QueryInput{
+				TableName:                 aws.String("table"),
+				IndexName:                 c.index,
+				KeyConditionExpression:    aws.String("hk = :hk"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":hk": {S: aws.String("a")}},
+			}
+			var lasts []map[string]*dynamodb.AttributeValue
+			for pages := 0; ; pages++ {
+				require.True(t, pages <= len(c.lasts), "too many pages")
+				out, err := cli.QueryWithOptions(input, &dynamodb.QueryOutput{}, RequestOptions{})
+				require.NoError(t, err)
+				if out.LastEvaluatedKey == nil {
+					break
+				}
+				lasts = append(lasts, out.LastEvaluatedKey)
+				input.ExclusiveStartKey = out.LastEvaluatedKey
+			}
+			require.Equal(t, c.lasts, lasts)
+
+			// each start key received is the previous last key
+			require.Len(t, tt.startKeys, len(c.lasts)+1)
+			require.Nil(t, tt.startKeys[0])
+			for _, f := range tt.forwards {
+				require.Equal(t, -1, f, "scan index forward sent without being set")
+			}
+			for i, last := range c.lasts {
+				received := tt.startKeys[i+1]
+				if c.index == nil {
+					expected, err := cbor.GetEncodedItemKey(last, c.keys)
+					require.NoError(t, err)
+					require.Equal(t, expected, received)
+				} else {
+					var buf bytes.Buffer
+					w := cbor.NewWriter(&buf)
+					require.NoError(t, w.WriteBytes(received))
+					require.NoError(t, w.Flush())
+					key, err := decodeCompoundKey(cbor.NewReader(&buf))
+					require.NoError(t, err)
+					require.Equal(t, last, key)
+				}
+			}
+		})
+	}
+}
+
+func TestSingleClient_QueryDescending(t *testing.T) {
+	keys := []dynamodb.AttributeDefinition{
+		{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+		{AttributeName: aws.String("rk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+	}
+	item := func(rk int) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{
+			"hk": {S: aws.String("events")},
+			"rk": {N: aws.String(strconv.Itoa(rk))},
+			"v":  {S: aws.String("v" + strconv.Itoa(rk))},
+		}
+	}
+	key := func(rk int) map[string]*dynamodb.AttributeValue {
+		k := item(rk)
+		delete(k, "v")
+		return k
+	}
+	// pages of 2 items, latest first, as the server sends them
+	pages := [][]int{{9, 8}, {7, 5}, {3}}
+
+	tt := &testTable{}
+	tt.recreate(key(0), keys...)
+	attrs := tt.attrListId([]string{"v"})
+	for i, rks := range pages {
+		var buf bytes.Buffer
+		w := cbor.NewWriter(&buf)
+		w.WriteMapStreamHeader()
+		w.WriteInt(responseParamItems)
+		w.WriteArrayHeader(len(rks))
+		for _, rk := range rks {
+			w.WriteArrayHeader(2)
+			kb, err := cbor.GetEncodedItemKey(key(rk), keys)
+			require.NoError(t, err)
+			w.WriteBytes(kb)
+			var ab bytes.Buffer
+			aw := cbor.NewWriter(&ab)
+			aw.WriteInt64(attrs)
+			require.NoError(t, cbor.EncodeAttributeValue(item(rk)["v"], aw))
+			require.NoError(t, aw.Flush())
+			w.WriteBytes(ab.Bytes())
+		}
+		if i < len(pages)-1 {
+			w.WriteInt(responseParamLastEvaluatedKey)
+			require.NoError(t, cbor.EncodeItemKey(key(rks[len(rks)-1]), keys, w))
+		}
+		w.WriteStreamBreak()
+		require.NoError(t, w.Flush())
+		tt.queries = append(tt.queries, buf.Bytes())
+	}
+
+	listener := startTableServer(t, tt)
+	defer listener.Close()
+	cli, err := newSingleClientWithOptions(listener.Addr().String(), connConfigData, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 10, defaultDialer.DialContext)
+	require.NoError(t, err)
+	defer cli.Close()
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("table"),
+		KeyConditionExpression:    aws.String("hk = :hk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":hk": {S: aws.String("events")}},
+		ScanIndexForward:          aws.Bool(false),
+		Limit:                     aws.Int64(2),
+	}
+	for i, rks := range pages {
+		out, err := cli.QueryWithOptions(input, &dynamodb.QueryOutput{}, RequestOptions{})
+		require.NoError(t, err)
+		expected := make([]map[string]*dynamodb.AttributeValue, len(rks))
+		for j, rk := range rks {
+			expected[j] = item(rk)
+		}
+		require.Equal(t, expected, out.Items, "page %d", i)
+		if i == len(pages)-1 {
+			require.Nil(t, out.LastEvaluatedKey)
+			break
+		}
+		require.Equal(t, key(rks[len(rks)-1]), out.LastEvaluatedKey, "page %d", i)
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+
+	// every page was asked backward, from the end of the previous one
+	require.Equal(t, []int{0, 0, 0}, tt.forwards)
+	require.Nil(t, tt.startKeys[0])
+	for i, rks := range pages[:len(pages)-1] {
+		expected, err := cbor.GetEncodedItemKey(key(rks[len(rks)-1]), keys)
+		require.NoError(t, err)
+		require.Equal(t, expected, tt.startKeys[i+1])
+	}
+}
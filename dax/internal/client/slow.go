@@ -0,0 +1,99 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Tracks where the time of a request is spent, for the logs of slow requests.
+// A nil timer tracks nothing.
+type requestTimer struct {
+	lock     sync.Mutex
+	wait     time.Duration // waiting for a pooled connection, protected by lock
+	attempts time.Duration // spent in attempts, wait included, protected by lock
+	nodes    []string      // nodes of the attempts, without repeats, protected by lock
+}
+
+type requestTimerKey struct{}
+
+// Returns a copy of ctx carrying t to the clients of the nodes.
+func withRequestTimer(ctx aws.Context, t *requestTimer) aws.Context {
+	return context.WithValue(ctx, requestTimerKey{}, t)
+}
+
+// Returns the requestTimer of ctx, or nil if it carries none.
+func requestTimerFrom(ctx aws.Context) *requestTimer {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(requestTimerKey{}).(*requestTimer)
+	return t
+}
+
+func (t *requestTimer) addWait(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	t.wait += d
+	t.lock.Unlock()
+}
+
+func (t *requestTimer) addAttempt(node string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	t.attempts += d
+	if !t.hasNode(node) {
+		t.nodes = append(t.nodes, node)
+	}
+	t.lock.Unlock()
+}
+
+// Returns whether node is one of the nodes of t. The lock of t must be held.
+func (t *requestTimer) hasNode(node string) bool {
+	for _, n := range t.nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Logs the request of op at warn level if it took longer than
+// Config.SlowRequestThreshold. correlationID is only called if it is.
+func (cc *ClusterDaxClient) logSlowRequest(op string, opt RequestOptions, md ResponseMetadata, elapsed time.Duration, t *requestTimer, correlationID func() string) {
+	logger := opt.Logger // carries the fields of the context of the request
+	if logger == nil {
+		logger = cc.config.logger
+	}
+	if t == nil || elapsed <= cc.config.SlowRequestThreshold || logger == nil {
+		return
+	}
+	t.lock.Lock()
+	wait, wire, nodes := t.wait, t.attempts-t.wait, strings.Join(t.nodes, ",")
+	t.lock.Unlock()
+	logger.Log(fmt.Sprintf("WARN: Slow request %s/%s (correlationID=%s table=%s elapsed=%s attempts=%d nodes=%s connectionWait=%s wire=%s)",
+		service, op, correlationID(), opt.table, elapsed, md.Attempts, nodes, wait, wire))
+}
@@ -0,0 +1,109 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterDaxClient_SlowRequestLog(t *testing.T) {
+	cluster, _ := newTestCluster([]string{"127.0.0.1:8111"})
+	cluster.update([]serviceEndpoint{{address: net.IPv4(127, 0, 0, 1).To4(), port: 8121}})
+	clk := newFakeClock()
+	var logs []string
+	cfg := DefaultConfig()
+	cfg.SlowRequestThreshold = time.Second
+	cfg.clock = clk
+	cfg.SetLogger(aws.LoggerFunc(func(args ...interface{}) { logs = append(logs, fmt.Sprint(args...)) }), aws.LogOff)
+	cc := ClusterDaxClient{config: cfg, cluster: cluster}
+
+	// the stubs wait for a connection from the pool, then for the response
+	stub := func(wait, wire time.Duration, err error) func(client DaxAPI, o RequestOptions) error {
+		return func(client DaxAPI, o RequestOptions) error {
+			clk.Advance(wait)
+			requestTimerFrom(o.Context).addWait(wait)
+			clk.Advance(wire)
+			return err
+		}
+	}
+	opt := RequestOptions{MaxRetries: 2, RetryDelay: time.Millisecond, SleepDelayFn: func(time.Duration) {}, table: "orders"}
+
+	require.NoError(t, cc.retry(OpGetItem, stub(100*time.Millisecond, 200*time.Millisecond, nil), opt))
+	require.Empty(t, logs, "a fast request must not be logged")
+
+	var md ResponseMetadata
+	opt.Context = WithResponseMetadata(context.Background(), &md)
+	slowErr := errors.New("slow failure")
+	calls := 0
+	action := func(client DaxAPI, o RequestOptions) error {
+		calls++
+		if calls == 1 {
+			return stub(400*time.Millisecond, 300*time.Millisecond, slowErr)(client, o)
+		}
+		return stub(0, 500*time.Millisecond, nil)(client, o)
+	}
+	require.NoError(t, cc.retry(OpGetItem, action, opt))
+	require.Len(t, logs, 1)
+	require.Equal(t, fmt.Sprintf("WARN: Slow request dax/GetItem (correlationID=%s table=orders elapsed=1.2s attempts=2 nodes=127.0.0.1:8121 connectionWait=400ms wire=800ms)", md.CorrelationID), logs[0])
+
+	// the threshold is exclusive, and zero disables the log
+	logs = nil
+	require.NoError(t, cc.retry(OpGetItem, stub(0, time.Second, nil), opt))
+	cc.config.SlowRequestThreshold = 0
+	require.NoError(t, cc.retry(OpGetItem, stub(0, time.Hour, nil), opt))
+	require.Empty(t, logs)
+}
+
+func TestSingleClient_acquireWait(t *testing.T) {
+	clk := newFakeClock()
+	cfg := unEncryptedConnConfig
+	cfg.clock = clk
+	dialErr := errors.New("connection refused")
+	cli, err := newSingleClientWithOptions(":9121", cfg, "us-west-2", credentials.NewStaticCredentials("id", "secret", "tok"), 1, func(ctx context.Context, a, n string) (net.Conn, error) {
+		clk.Advance(250 * time.Millisecond)
+		return nil, dialErr
+	})
+	require.NoError(t, err)
+	defer cli.Close()
+
+	timings := &requestTimer{}
+	ctx := withRequestTimer(context.Background(), timings)
+	err = cli.executeWithContext(ctx, OpGetItem, func(*cbor.Writer) error { return nil }, func(*cbor.Reader) error { return nil }, RequestOptions{})
+	require.Error(t, err)
+	require.Equal(t, 250*time.Millisecond, timings.wait)
+}
+
+func TestRequestTimer_nodes(t *testing.T) {
+	timings := &requestTimer{}
+	for _, node := range []string{"a:8111", "b:8111", "b:8111", "a:8111", "c:8111"} {
+		timings.addAttempt(node, time.Millisecond)
+	}
+	require.Equal(t, []string{"a:8111", "b:8111", "c:8111"}, timings.nodes)
+	require.Equal(t, 5*time.Millisecond, timings.attempts)
+
+	var nilTimer *requestTimer
+	nilTimer.addAttempt("a:8111", time.Millisecond)
+}
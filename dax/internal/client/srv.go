@@ -0,0 +1,98 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Resolves the names of the seeds, net.DefaultResolver but in tests.
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Returns the endpoints of the cluster from the SRV records of the first seed
+// whose records resolve to some, ordered by priority and then by weight, or an
+// error listing the failure of every seed.
+func (c *cluster) pullSRVEndpoints(ctx aws.Context) ([]serviceEndpoint, error) {
+	var failures []seedResult
+	for _, s := range c.seeds {
+		addr := seedAddr{seed: "srv://" + s.host}
+		endpoints, err := c.resolveSRV(ctx, s.host)
+		if err != nil {
+			failures = append(failures, seedResult{addr: addr, err: err})
+			continue
+		}
+		if c.config.logger != nil && c.config.logLevel.AtLeast(aws.LogDebug) {
+			c.config.logger.Log(fmt.Sprintf("DEBUG: Resolved endpoints from %s : %v", addr.seed, endpoints))
+		}
+		if len(endpoints) > 0 {
+			return endpoints, nil
+		}
+	}
+	return nil, seedsFailed(failures)
+}
+
+// Returns the endpoints of the targets of the SRV records of name. Targets
+// which do not resolve are skipped, unless no target resolves. A node is
+// identified by the first address of its target, but its client dials the
+// target, through the host cache, so that all of its addresses are tried.
+func (c *cluster) resolveSRV(ctx aws.Context, name string) ([]serviceEndpoint, error) {
+	_, records, err := c.resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]serviceEndpoint, 0, len(records))
+	seen := make(map[hostPort]bool, len(records))
+	var lastErr error
+	for _, r := range records {
+		target := strings.TrimSuffix(r.Target, ".")
+		ips, err := c.resolver.LookupIPAddr(ctx, target)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(ips) == 0 {
+			continue
+		}
+		ep := serviceEndpoint{hostname: target, address: ips[0].IP, port: int(r.Port), priority: int(r.Priority), weight: int(r.Weight)}
+		if ip4 := ips[0].IP.To4(); ip4 != nil {
+			ep.address = ip4
+		}
+		if seen[ep.hostPort()] {
+			continue
+		}
+		seen[ep.hostPort()] = true
+		endpoints = append(endpoints, ep)
+	}
+	if len(endpoints) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if endpoints[i].priority != endpoints[j].priority {
+			return endpoints[i].priority < endpoints[j].priority
+		}
+		return endpoints[i].weight > endpoints[j].weight
+	})
+	return endpoints, nil
+}
@@ -0,0 +1,308 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/require"
+)
+
+// Resolves the SRV records and the addresses of the hosts it is set.
+type fakeResolver struct {
+	mu                 sync.Mutex
+	records            map[string][]*net.SRV
+	hosts              map[string][]net.IP
+	lookups, ipLookups int
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{records: map[string][]*net.SRV{}, hosts: map[string][]net.IP{}}
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ipLookups++
+	ips, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: ip}
+	}
+	return addrs, nil
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	records, ok := r.records[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, records, nil
+}
+
+func (r *fakeResolver) setHost(host string, ips ...net.IP) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[host] = ips
+}
+
+func (r *fakeResolver) deleteHost(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.hosts, host)
+}
+
+func (r *fakeResolver) numLookups() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+func (r *fakeResolver) set(name string, records ...*net.SRV) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[name] = records
+	for i, rec := range records {
+		r.hosts[strings.TrimSuffix(rec.Target, ".")] = []net.IP{net.IPv4(10, 0, 0, byte(i+1))}
+	}
+}
+
+const srvTestName = "_dax._tcp.example.internal"
+
+func newSRVTestCluster(t *testing.T) (*cluster, *testClientBuilder, *fakeResolver) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"srv://" + srvTestName}
+	cfg.Region = "us-west-2"
+	cluster, b := newTestClusterWithConfig(cfg)
+	r := newFakeResolver()
+	cluster.resolver = r
+	return cluster, b, r
+}
+
+func activeAddrs(c *cluster) []string {
+	var addrs []string
+	for _, n := range c.nodeInfos() {
+		addrs = append(addrs, n.Addr)
+	}
+	return addrs
+}
+
+func TestCluster_SRVDiscovery(t *testing.T) {
+	cluster, b, r := newSRVTestCluster(t)
+	defer cluster.Close()
+	r.set(srvTestName,
+		&net.SRV{Target: "node-a.example.internal.", Port: 8111, Priority: 10, Weight: 10},
+		&net.SRV{Target: "node-b.example.internal.", Port: 8112, Priority: 0, Weight: 5},
+		&net.SRV{Target: "node-c.example.internal.", Port: 8113, Priority: 0, Weight: 50},
+	)
+
+	require.NoError(t, cluster.refreshNow())
+	require.Equal(t, []string{"10.0.0.3:8113", "10.0.0.2:8112", "10.0.0.1:8111"}, activeAddrs(cluster))
+	nodes := cluster.nodeInfos()
+	require.Equal(t, 0, nodes[0].Priority)
+	require.Equal(t, 50, nodes[0].Weight)
+	require.Equal(t, 10, nodes[2].Priority)
+	require.IsType(t, weightedRouting{}, cluster.policy)
+	for _, c := range b.clients {
+		require.Equal(t, 0, c.endpointsCalls, "the DAX discovery protocol is not used")
+	}
+
+	// re-resolved by the refreshes
+	r.set(srvTestName,
+		&net.SRV{Target: "node-a.example.internal.", Port: 8111, Priority: 0, Weight: 10},
+		&net.SRV{Target: "node-d.example.internal.", Port: 8114, Priority: 1, Weight: 10},
+	)
+	r.setHost("node-d.example.internal", net.IPv4(10, 0, 0, 4))
+	require.NoError(t, cluster.refreshNow())
+	require.Equal(t, []string{"10.0.0.1:8111", "10.0.0.4:8114"}, activeAddrs(cluster))
+	require.Equal(t, 0, cluster.nodeInfos()[0].Priority)
+	require.Equal(t, 2, r.numLookups())
+}
+
+func TestCluster_SRVDiscoveryEveryUpdateInterval(t *testing.T) {
+	clk := newFakeClock()
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"srv://" + srvTestName}
+	cfg.Region = "us-west-2"
+	cfg.clock = clk
+	cluster, _ := newTestClusterWithConfig(cfg)
+	r := newFakeResolver()
+	cluster.resolver = r
+	defer cluster.Close()
+	r.set(srvTestName, &net.SRV{Target: "node-a.example.internal.", Port: 8111})
+
+	require.NoError(t, cluster.start())
+	require.Equal(t, []string{"10.0.0.1:8111"}, activeAddrs(cluster))
+	require.Equal(t, 1, r.numLookups())
+
+	for i, target := range []string{"node-b.example.internal", "node-c.example.internal"} {
+		r.set(srvTestName, &net.SRV{Target: target + ".", Port: 8111})
+		r.setHost(target, net.IPv4(10, 0, 0, byte(i+2)))
+		addr := net.JoinHostPort(net.IPv4(10, 0, 0, byte(i+2)).String(), "8111")
+		clk.waitForTimers(t, 2) // the refresh and the idle connection reaper
+		clk.Advance(cfg.ClusterUpdateInterval - time.Millisecond)
+		require.Equal(t, i+1, r.numLookups(), "expect no lookup before the interval elapsed")
+
+		clk.Advance(time.Millisecond)
+		require.Eventually(t, func() bool { return r.numLookups() == i+2 }, 5*time.Second, time.Millisecond)
+		require.Eventually(t, func() bool {
+			addrs := activeAddrs(cluster)
+			return len(addrs) == 1 && addrs[0] == addr
+		}, 5*time.Second, time.Millisecond)
+	}
+}
+
+func TestCluster_SRVDiscoveryFails(t *testing.T) {
+	cluster, _, r := newSRVTestCluster(t)
+	defer cluster.Close()
+
+	err := cluster.refreshNow()
+	require.Error(t, err)
+	var dnsErr *net.DNSError
+	require.True(t, errors.As(err, &dnsErr), "%T: %v", err, err)
+
+	// targets which do not resolve are skipped
+	r.set(srvTestName,
+		&net.SRV{Target: "node-a.example.internal.", Port: 8111},
+		&net.SRV{Target: "node-b.example.internal.", Port: 8111},
+	)
+	r.deleteHost("node-a.example.internal")
+	require.NoError(t, cluster.refreshNow())
+	require.Equal(t, []string{"10.0.0.2:8111"}, activeAddrs(cluster))
+}
+
+func TestCluster_NodesDialAllAddresses(t *testing.T) {
+	listener := startEndpointsServer(t, func(conn int, w io.Writer) error {
+		_, err := w.Write([]byte{cbor.Array + 0, cbor.Array + 0})
+		return err
+	})
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"srv://" + srvTestName}
+	cfg.Region = "us-west-2"
+	cfg.Credentials = credentials.NewStaticCredentials("id", "secret", "tok")
+	cluster, err := newCluster(cfg)
+	require.NoError(t, err)
+	defer cluster.Close()
+	r := newFakeResolver()
+	cluster.resolver = r
+	hosts := newHostCache(r, nil)
+	cluster.config.connConfig.hosts = hosts
+
+	// the first address of each node refuses the connections, nothing
+	// listens on it
+	dial := func(host string, ip net.IP) {
+		node := cluster.nodeInfos()[0]
+		require.Equal(t, net.JoinHostPort(ip.String(), strconv.Itoa(port)), node.Addr)
+		_, err := cluster.clientOf(node).endpoints(RequestOptions{MaxRetries: 0, Context: context.Background()})
+		require.NoError(t, err)
+		require.Equal(t, net.IPv4(127, 0, 0, 1), hosts.lastGood(host))
+	}
+
+	// the target of a SRV record
+	r.set(srvTestName, &net.SRV{Target: "node-a.example.internal.", Port: uint16(port)})
+	r.setHost("node-a.example.internal", net.IPv4(127, 0, 0, 2), net.IPv4(127, 0, 0, 1))
+	require.NoError(t, cluster.refreshNow())
+	dial("node-a.example.internal", net.IPv4(127, 0, 0, 2))
+
+	// the hostname of an endpoint of the DAX discovery protocol
+	r.setHost("node-b.example.internal", net.IPv4(127, 0, 0, 3), net.IPv4(127, 0, 0, 1))
+	require.NoError(t, cluster.update([]serviceEndpoint{{hostname: "node-b.example.internal", address: []byte{127, 0, 0, 3}, port: port}}))
+	dial("node-b.example.internal", net.IPv4(127, 0, 0, 3))
+}
+
+func TestCluster_SRVHostPorts(t *testing.T) {
+	host, port, scheme, err := parseHostPort("srv://" + srvTestName)
+	require.NoError(t, err)
+	require.Equal(t, srvTestName, host)
+	require.Equal(t, 0, port)
+	require.Equal(t, "srv", scheme)
+
+	_, _, _, err = parseHostPort("srv://" + srvTestName + ":8111")
+	require.Error(t, err)
+
+	_, _, _, err = getHostPorts([]string{"srv://" + srvTestName, "dax://node.example.internal:8111"})
+	require.Equal(t, request.ErrCodeRequestError, err.(awserr.Error).Code())
+}
+
+func TestWeightedRouting_Pick(t *testing.T) {
+	p := NewWeightedRouting()
+	nodes := []NodeInfo{
+		{Addr: "a", Priority: 0, Weight: 90, Healthy: true},
+		{Addr: "b", Priority: 0, Weight: 10, Healthy: true},
+		{Addr: "c", Priority: 1, Weight: 100, Healthy: true},
+	}
+
+	picked := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		node, err := p.Pick(OperationInfo{Name: OpGetItem}, nodes)
+		require.NoError(t, err)
+		picked[node.Addr]++
+	}
+	require.Zero(t, picked["c"], "nodes of a higher priority are not picked")
+	require.True(t, picked["a"] > 3*picked["b"], "picks follow the weights: %v", picked)
+	require.NotZero(t, picked["b"])
+
+	// the node of the previous attempt is skipped
+	node, err := p.Pick(OperationInfo{Name: OpGetItem, Attempt: 1, Previous: "a"}, nodes)
+	require.NoError(t, err)
+	require.Equal(t, "b", node.Addr)
+
+	// unhealthy nodes fall back to the next priority
+	nodes[0].Healthy, nodes[1].Healthy = false, false
+	node, err = p.Pick(OperationInfo{Name: OpGetItem}, nodes)
+	require.NoError(t, err)
+	require.Equal(t, "c", node.Addr)
+
+	// all unhealthy: the lowest priority
+	nodes[2].Healthy = false
+	node, err = p.Pick(OperationInfo{Name: OpGetItem, Attempt: 1, Previous: "a"}, nodes)
+	require.NoError(t, err)
+	require.Equal(t, "b", node.Addr)
+
+	// zero weights: uniform
+	zero := []NodeInfo{{Addr: "x", Healthy: true}, {Addr: "y", Healthy: true}, {Addr: "z", Healthy: true}}
+	picked = map[string]int{}
+	for i := 0; i < 3000; i++ {
+		node, err := p.Pick(OperationInfo{Name: OpGetItem}, zero)
+		require.NoError(t, err)
+		picked[node.Addr]++
+	}
+	require.Len(t, picked, 3)
+	for addr, n := range picked {
+		require.True(t, n > 3000/5 && n < 3000/2, "uneven share of %s: %v", addr, picked)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import "sync/atomic"
+
+// Stats holds counters describing the connections and requests of a client.
+type Stats struct {
+	// Number of connections closed instead of being returned to the pool because a
+	// request left them in an unknown state, e.g. after a decode error, a partially
+	// read response or a timeout.
+	DiscardedConnections int64
+
+	// Number of failed attempts to connect to a node. Unlike their logs, every
+	// failure is counted.
+	ConnectionErrors int64
+
+	// Number of requests currently holding one of the MaxConcurrentRequests permits.
+	InFlightRequests int64
+
+	// Number of requests failed with ErrOverloaded as no MaxConcurrentRequests
+	// permit was available, see SlotTimeouts for the attempts waiting for a
+	// node.
+	RejectedRequests int64
+
+	// Number of expressions found in, and parsed and added to, the expression cache.
+	ExpressionCacheHits   int64
+	ExpressionCacheMisses int64
+
+	// Number of GetItem calls served by an identical call in flight, see Config.CoalesceGetItems.
+	CoalescedGetItems int64
+
+	// Number of GetItem calls served by a BatchGetItem request, see Config.GetItemBatchWindow.
+	BatchedGetItems int64
+
+	// 1 while the health checks find the cluster unreachable, 0 otherwise, and
+	// the number of times the cluster became unreachable or reachable again.
+	// See Config.HealthCheckInterval.
+	ClusterUnreachable  int64
+	ReachabilityChanges int64
+
+	// Number of requests sent to the Fallback client of Dax instead of the
+	// cluster while it was unreachable, see dax.Config.EnableDegradedMode.
+	DegradedRequests int64
+
+	// Number of times requests were sent to the secondary cluster because the
+	// primary cluster was unreachable, see dax.Config.Secondary.
+	Failovers int64
+
+	// Number of attempts failed with a throttling error, in total and within
+	// the last minute, see Config.OnThrottle.
+	ThrottledAttempts       int64
+	RecentThrottledAttempts int64
+
+	// Number of failed discoveries of the nodes of the cluster, in total and
+	// since the last successful one, see Config.OnDiscoveryFailure.
+	DiscoveryFailures            int64
+	ConsecutiveDiscoveryFailures int64
+
+	// Number of requests sent to the nodes, each attempt counted. See
+	// NodeStats for their distribution among the nodes.
+	Requests int64
+
+	// Number of GetItem and Query requests routed to the node preferred for
+	// their partition key, see Config.KeyAffinityRouting.
+	AffinityRoutedRequests int64
+
+	// Number of reads routed by NewLeastOutstandingRouting, and of those sent
+	// to the node with fewer requests in flight of the two nodes compared, see
+	// Config.RoutingPolicy.
+	LoadBalancedRequests int64
+	LoadShiftedRequests  int64
+
+	// Number of reads sent to another node as their node had
+	// Config.MaxInFlightPerNode attempts in flight, of the requests that
+	// waited for a free slot, and of those failed with ErrOverloaded as none
+	// was freed within AcquireTimeout.
+	SpilledRequests int64
+	QueuedRequests  int64
+	SlotTimeouts    int64
+
+	// Number of connections not established within Config.ConnectTimeout,
+	// also counted in ConnectionErrors.
+	ConnectTimeouts int64
+}
+
+type statsProvider interface {
+	Stats() Stats
+}
+
+// Atomically adds the counters of o to s.
+func (s *Stats) add(o Stats) {
+	atomic.AddInt64(&s.DiscardedConnections, o.DiscardedConnections)
+	atomic.AddInt64(&s.ConnectionErrors, o.ConnectionErrors)
+	atomic.AddInt64(&s.InFlightRequests, o.InFlightRequests)
+	atomic.AddInt64(&s.RejectedRequests, o.RejectedRequests)
+	atomic.AddInt64(&s.ExpressionCacheHits, o.ExpressionCacheHits)
+	atomic.AddInt64(&s.ExpressionCacheMisses, o.ExpressionCacheMisses)
+	atomic.AddInt64(&s.CoalescedGetItems, o.CoalescedGetItems)
+	atomic.AddInt64(&s.BatchedGetItems, o.BatchedGetItems)
+	atomic.AddInt64(&s.ClusterUnreachable, o.ClusterUnreachable)
+	atomic.AddInt64(&s.ReachabilityChanges, o.ReachabilityChanges)
+	atomic.AddInt64(&s.DegradedRequests, o.DegradedRequests)
+	atomic.AddInt64(&s.Failovers, o.Failovers)
+	atomic.AddInt64(&s.ThrottledAttempts, o.ThrottledAttempts)
+	atomic.AddInt64(&s.RecentThrottledAttempts, o.RecentThrottledAttempts)
+	atomic.AddInt64(&s.DiscoveryFailures, o.DiscoveryFailures)
+	atomic.AddInt64(&s.ConsecutiveDiscoveryFailures, o.ConsecutiveDiscoveryFailures)
+	atomic.AddInt64(&s.Requests, o.Requests)
+	atomic.AddInt64(&s.AffinityRoutedRequests, o.AffinityRoutedRequests)
+	atomic.AddInt64(&s.LoadBalancedRequests, o.LoadBalancedRequests)
+	atomic.AddInt64(&s.LoadShiftedRequests, o.LoadShiftedRequests)
+	atomic.AddInt64(&s.SpilledRequests, o.SpilledRequests)
+	atomic.AddInt64(&s.QueuedRequests, o.QueuedRequests)
+	atomic.AddInt64(&s.SlotTimeouts, o.SlotTimeouts)
+	atomic.AddInt64(&s.ConnectTimeouts, o.ConnectTimeouts)
+}
+
+// Atomically loads the counters of s.
+func (s *Stats) load() Stats {
+	return Stats{
+		DiscardedConnections:         atomic.LoadInt64(&s.DiscardedConnections),
+		ConnectionErrors:             atomic.LoadInt64(&s.ConnectionErrors),
+		InFlightRequests:             atomic.LoadInt64(&s.InFlightRequests),
+		RejectedRequests:             atomic.LoadInt64(&s.RejectedRequests),
+		ExpressionCacheHits:          atomic.LoadInt64(&s.ExpressionCacheHits),
+		ExpressionCacheMisses:        atomic.LoadInt64(&s.ExpressionCacheMisses),
+		CoalescedGetItems:            atomic.LoadInt64(&s.CoalescedGetItems),
+		BatchedGetItems:              atomic.LoadInt64(&s.BatchedGetItems),
+		ClusterUnreachable:           atomic.LoadInt64(&s.ClusterUnreachable),
+		ReachabilityChanges:          atomic.LoadInt64(&s.ReachabilityChanges),
+		DegradedRequests:             atomic.LoadInt64(&s.DegradedRequests),
+		Failovers:                    atomic.LoadInt64(&s.Failovers),
+		ThrottledAttempts:            atomic.LoadInt64(&s.ThrottledAttempts),
+		RecentThrottledAttempts:      atomic.LoadInt64(&s.RecentThrottledAttempts),
+		DiscoveryFailures:            atomic.LoadInt64(&s.DiscoveryFailures),
+		ConsecutiveDiscoveryFailures: atomic.LoadInt64(&s.ConsecutiveDiscoveryFailures),
+		Requests:                     atomic.LoadInt64(&s.Requests),
+		AffinityRoutedRequests:       atomic.LoadInt64(&s.AffinityRoutedRequests),
+		LoadBalancedRequests:         atomic.LoadInt64(&s.LoadBalancedRequests),
+		LoadShiftedRequests:          atomic.LoadInt64(&s.LoadShiftedRequests),
+		SpilledRequests:              atomic.LoadInt64(&s.SpilledRequests),
+		QueuedRequests:               atomic.LoadInt64(&s.QueuedRequests),
+		SlotTimeouts:                 atomic.LoadInt64(&s.SlotTimeouts),
+		ConnectTimeouts:              atomic.LoadInt64(&s.ConnectTimeouts),
+	}
+}
@@ -1,85 +1,260 @@
 /*
 A stub implementation of the DaxAPI interface that can be configured to
-return a series of responses to BatchGetItem, Query, and Scan requests. It
-is used to test pagination logic.
+return a series of responses and errors to each operation, and records the
+requests it receives. It is used to test pagination and retry logic.
 */
 package client
 
 import (
+	"sync"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
+// StubResponder answers the call-th request to an operation, counting from 0,
+// with an output of the operation output type, such as *dynamodb.GetItemOutput.
+type StubResponder func(input interface{}, call int, opt RequestOptions) (interface{}, error)
+
+// ClientStub is safe to use concurrently.
 type ClientStub struct {
-	batchGetItemRequests  []*dynamodb.BatchGetItemInput
-	batchGetItemResponses []*dynamodb.BatchGetItemOutput
-	queryRequests         []*dynamodb.QueryInput
-	queryResponses        []*dynamodb.QueryOutput
-	scanRequests          []*dynamodb.ScanInput
-	scanResponses         []*dynamodb.ScanOutput
+	mu             sync.Mutex
+	requests       map[string][]interface{}
+	responses      map[string][]interface{}
+	errors         map[string][]error
+	responders     map[string]StubResponder
+	requestOptions []RequestOptions
+	nodes          []string
 }
 
 // Constructor
 func NewClientStub(batchGetItemResponses []*dynamodb.BatchGetItemOutput, queryResponses []*dynamodb.QueryOutput, scanResponses []*dynamodb.ScanOutput) *ClientStub {
-	return &ClientStub{batchGetItemResponses: batchGetItemResponses, queryResponses: queryResponses, scanResponses: scanResponses}
+	stub := &ClientStub{
+		requests:   make(map[string][]interface{}),
+		responses:  make(map[string][]interface{}),
+		errors:     make(map[string][]error),
+		responders: make(map[string]StubResponder),
+	}
+	for _, r := range batchGetItemResponses {
+		stub.responses[OpBatchGetItem] = append(stub.responses[OpBatchGetItem], r)
+	}
+	for _, r := range queryResponses {
+		stub.responses[OpQuery] = append(stub.responses[OpQuery], r)
+	}
+	for _, r := range scanResponses {
+		stub.responses[OpScan] = append(stub.responses[OpScan], r)
+	}
+	return stub
 }
 
 // Stub methods
+
+// AddResponses queues outputs as the responses to the next requests to op.
+// The outputs must be of the op output type, such as *dynamodb.GetItemOutput.
+func (stub *ClientStub) AddResponses(op string, outputs ...interface{}) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	stub.responses[op] = append(stub.responses[op], outputs...)
+}
+
+// SetErrors makes the i-th next request to op fail with errs[i] when not nil,
+// instead of consuming a response.
+func (stub *ClientStub) SetErrors(op string, errs ...error) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	stub.errors[op] = errs
+}
+
+// SetResponder makes fn answer the requests to op not failed by SetErrors,
+// instead of the queued responses.
+func (stub *ClientStub) SetResponder(op string, fn StubResponder) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	stub.responders[op] = fn
+}
+
+// SetNodes sets the "host:port" addresses returned by Nodes, as a refresh of
+// the cluster would.
+func (stub *ClientStub) SetNodes(nodes ...string) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	stub.nodes = nodes
+}
+
+// Nodes returns the addresses set by SetNodes.
+func (stub *ClientStub) Nodes() []string {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	return append([]string(nil), stub.nodes...)
+}
+
+// Requests returns the inputs of the requests to op, in order.
+func (stub *ClientStub) Requests(op string) []interface{} {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	return append([]interface{}(nil), stub.requests[op]...)
+}
+
 func (stub *ClientStub) GetBatchGetItemRequests() []*dynamodb.BatchGetItemInput {
-	return stub.batchGetItemRequests
+	var inputs []*dynamodb.BatchGetItemInput
+	for _, input := range stub.Requests(OpBatchGetItem) {
+		inputs = append(inputs, input.(*dynamodb.BatchGetItemInput))
+	}
+	return inputs
 }
 
 func (stub *ClientStub) GetQueryRequests() []*dynamodb.QueryInput {
-	return stub.queryRequests
+	var inputs []*dynamodb.QueryInput
+	for _, input := range stub.Requests(OpQuery) {
+		inputs = append(inputs, input.(*dynamodb.QueryInput))
+	}
+	return inputs
 }
 
 func (stub *ClientStub) GetScanRequests() []*dynamodb.ScanInput {
-	return stub.scanRequests
+	var inputs []*dynamodb.ScanInput
+	for _, input := range stub.Requests(OpScan) {
+		inputs = append(inputs, input.(*dynamodb.ScanInput))
+	}
+	return inputs
+}
+
+// SetQueryErrors makes the i-th Query request fail with errs[i] when not nil,
+// instead of consuming a response.
+func (stub *ClientStub) SetQueryErrors(errs ...error) {
+	stub.SetErrors(OpQuery, errs...)
+}
+
+// SetScanErrors makes the i-th Scan request fail with errs[i] when not nil,
+// instead of consuming a response.
+func (stub *ClientStub) SetScanErrors(errs ...error) {
+	stub.SetErrors(OpScan, errs...)
+}
+
+// Removes and returns the error of the next request from errs.
+func popError(errs *[]error) error {
+	if len(*errs) == 0 {
+		return nil
+	}
+	err := (*errs)[0]
+	*errs = (*errs)[1:]
+	return err
+}
+
+// GetRequestOptions returns the options of every request received by the stub, in order.
+func (stub *ClientStub) GetRequestOptions() []RequestOptions {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	return append([]RequestOptions(nil), stub.requestOptions...)
+}
+
+// Records the request to op and returns its response: the next error, the
+// responder, the next queued response, or a nil output if none is queued.
+func (stub *ClientStub) call(op string, input interface{}, opt RequestOptions) (interface{}, error) {
+	stub.mu.Lock()
+	call := len(stub.requests[op])
+	stub.requests[op] = append(stub.requests[op], input)
+	stub.requestOptions = append(stub.requestOptions, opt)
+	errs := stub.errors[op]
+	err := popError(&errs)
+	stub.errors[op] = errs
+	responder := stub.responders[op]
+	if err != nil || responder != nil {
+		stub.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return responder(input, call, opt)
+	}
+	defer stub.mu.Unlock()
+	queue := stub.responses[op]
+	if len(queue) == 0 {
+		return nil, nil
+	}
+	stub.responses[op] = queue[1:]
+	return queue[0], nil
 }
 
 // DaxAPI methods
 func (stub *ClientStub) PutItemWithOptions(input *dynamodb.PutItemInput, output *dynamodb.PutItemOutput, opt RequestOptions) (*dynamodb.PutItemOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpPutItem, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.PutItemOutput), err
 }
 
 func (stub *ClientStub) DeleteItemWithOptions(input *dynamodb.DeleteItemInput, output *dynamodb.DeleteItemOutput, opt RequestOptions) (*dynamodb.DeleteItemOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpDeleteItem, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.DeleteItemOutput), err
 }
 
 func (stub *ClientStub) UpdateItemWithOptions(input *dynamodb.UpdateItemInput, output *dynamodb.UpdateItemOutput, opt RequestOptions) (*dynamodb.UpdateItemOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpUpdateItem, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.UpdateItemOutput), err
 }
 
 func (stub *ClientStub) GetItemWithOptions(input *dynamodb.GetItemInput, output *dynamodb.GetItemOutput, opt RequestOptions) (*dynamodb.GetItemOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpGetItem, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.GetItemOutput), err
 }
 
 func (stub *ClientStub) ScanWithOptions(input *dynamodb.ScanInput, output *dynamodb.ScanOutput, opt RequestOptions) (*dynamodb.ScanOutput, error) {
-	output, stub.scanResponses = stub.scanResponses[0], stub.scanResponses[1:]
-	return output, nil
+	out, err := stub.call(OpScan, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.ScanOutput), err
 }
 
 func (stub *ClientStub) QueryWithOptions(input *dynamodb.QueryInput, output *dynamodb.QueryOutput, opt RequestOptions) (*dynamodb.QueryOutput, error) {
-	output, stub.queryResponses = stub.queryResponses[0], stub.queryResponses[1:]
-	return output, nil
+	out, err := stub.call(OpQuery, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.QueryOutput), err
 }
 
 func (stub *ClientStub) BatchWriteItemWithOptions(input *dynamodb.BatchWriteItemInput, output *dynamodb.BatchWriteItemOutput, opt RequestOptions) (*dynamodb.BatchWriteItemOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpBatchWriteItem, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.BatchWriteItemOutput), err
 }
 
 func (stub *ClientStub) BatchGetItemWithOptions(input *dynamodb.BatchGetItemInput, output *dynamodb.BatchGetItemOutput, opt RequestOptions) (*dynamodb.BatchGetItemOutput, error) {
-	output, stub.batchGetItemResponses = stub.batchGetItemResponses[0], stub.batchGetItemResponses[1:]
-	return output, nil
+	out, err := stub.call(OpBatchGetItem, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.BatchGetItemOutput), err
 }
 
 func (stub *ClientStub) TransactWriteItemsWithOptions(input *dynamodb.TransactWriteItemsInput, output *dynamodb.TransactWriteItemsOutput, opt RequestOptions) (*dynamodb.TransactWriteItemsOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpTransactWriteItems, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.TransactWriteItemsOutput), err
 }
 
 func (stub *ClientStub) TransactGetItemsWithOptions(input *dynamodb.TransactGetItemsInput, output *dynamodb.TransactGetItemsOutput, opt RequestOptions) (*dynamodb.TransactGetItemsOutput, error) {
-	return nil, nil
+	out, err := stub.call(OpTransactGetItems, input, opt)
+	if out == nil {
+		return nil, err
+	}
+	return out.(*dynamodb.TransactGetItemsOutput), err
 }
 
 func (stub *ClientStub) NewDaxRequest(op *request.Operation, input, output interface{}, opt RequestOptions) *request.Request {
@@ -96,23 +271,48 @@ func (stub *ClientStub) build(req *request.Request) {
 }
 
 func (stub *ClientStub) send(req *request.Request) {
-	opt := RequestOptions{}
+	opt := RequestOptions{Context: req.Context()}
 	switch req.Operation.Name {
-	case OpBatchGetItem:
-		input, _ := req.Params.(*dynamodb.BatchGetItemInput)
-		stub.batchGetItemRequests = append(stub.batchGetItemRequests, input)
-		output, _ := req.Data.(*dynamodb.BatchGetItemOutput)
-		req.Data, req.Error = stub.BatchGetItemWithOptions(input, output, opt)
-	case OpQuery:
-		input, _ := req.Params.(*dynamodb.QueryInput)
-		stub.queryRequests = append(stub.queryRequests, input)
-		output, _ := req.Data.(*dynamodb.QueryOutput)
-		req.Data, req.Error = stub.QueryWithOptions(input, output, opt)
+	case OpPutItem:
+		input, _ := req.Params.(*dynamodb.PutItemInput)
+		output, _ := req.Data.(*dynamodb.PutItemOutput)
+		req.Data, req.Error = stub.PutItemWithOptions(input, output, opt)
+	case OpDeleteItem:
+		input, _ := req.Params.(*dynamodb.DeleteItemInput)
+		output, _ := req.Data.(*dynamodb.DeleteItemOutput)
+		req.Data, req.Error = stub.DeleteItemWithOptions(input, output, opt)
+	case OpUpdateItem:
+		input, _ := req.Params.(*dynamodb.UpdateItemInput)
+		output, _ := req.Data.(*dynamodb.UpdateItemOutput)
+		req.Data, req.Error = stub.UpdateItemWithOptions(input, output, opt)
+	case OpGetItem:
+		input, _ := req.Params.(*dynamodb.GetItemInput)
+		output, _ := req.Data.(*dynamodb.GetItemOutput)
+		req.Data, req.Error = stub.GetItemWithOptions(input, output, opt)
 	case OpScan:
 		input, _ := req.Params.(*dynamodb.ScanInput)
-		stub.scanRequests = append(stub.scanRequests, input)
 		output, _ := req.Data.(*dynamodb.ScanOutput)
 		req.Data, req.Error = stub.ScanWithOptions(input, output, opt)
+	case OpQuery:
+		input, _ := req.Params.(*dynamodb.QueryInput)
+		output, _ := req.Data.(*dynamodb.QueryOutput)
+		req.Data, req.Error = stub.QueryWithOptions(input, output, opt)
+	case OpBatchWriteItem:
+		input, _ := req.Params.(*dynamodb.BatchWriteItemInput)
+		output, _ := req.Data.(*dynamodb.BatchWriteItemOutput)
+		req.Data, req.Error = stub.BatchWriteItemWithOptions(input, output, opt)
+	case OpBatchGetItem:
+		input, _ := req.Params.(*dynamodb.BatchGetItemInput)
+		output, _ := req.Data.(*dynamodb.BatchGetItemOutput)
+		req.Data, req.Error = stub.BatchGetItemWithOptions(input, output, opt)
+	case OpTransactWriteItems:
+		input, _ := req.Params.(*dynamodb.TransactWriteItemsInput)
+		output, _ := req.Data.(*dynamodb.TransactWriteItemsOutput)
+		req.Data, req.Error = stub.TransactWriteItemsWithOptions(input, output, opt)
+	case OpTransactGetItems:
+		input, _ := req.Params.(*dynamodb.TransactGetItemsInput)
+		output, _ := req.Data.(*dynamodb.TransactGetItemsOutput)
+		req.Data, req.Error = stub.TransactGetItemsWithOptions(input, output, opt)
 	}
 }
 
@@ -0,0 +1,98 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestClientStub_ErrorOnThirdCall(t *testing.T) {
+	stub := NewClientStub(nil, nil, nil)
+	failure := errors.New("failure")
+	for i := 0; i < 3; i++ {
+		stub.AddResponses(OpPutItem, &dynamodb.PutItemOutput{Attributes: map[string]*dynamodb.AttributeValue{"n": {N: aws.String(string(rune('0' + i)))}}})
+	}
+	stub.SetErrors(OpPutItem, nil, nil, failure)
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		out, err := stub.PutItemWithOptions(&dynamodb.PutItemInput{TableName: aws.String("table")}, &dynamodb.PutItemOutput{}, RequestOptions{})
+		switch {
+		case err != nil:
+			got = append(got, err.Error())
+		default:
+			got = append(got, aws.StringValue(out.Attributes["n"].N))
+		}
+	}
+	if e, a := []string{"0", "1", "failure", "2"}, got; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 4, len(stub.Requests(OpPutItem)); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+	out, err := stub.PutItemWithOptions(&dynamodb.PutItemInput{}, &dynamodb.PutItemOutput{}, RequestOptions{})
+	if out != nil || err != nil {
+		t.Errorf("expect no response once the queue is empty, got %v, %v", out, err)
+	}
+}
+
+func TestClientStub_Responder(t *testing.T) {
+	stub := NewClientStub(nil, nil, nil)
+	failure := errors.New("failure")
+	stub.SetErrors(OpGetItem, failure)
+	stub.SetResponder(OpGetItem, func(input interface{}, call int, opt RequestOptions) (interface{}, error) {
+		return &dynamodb.GetItemOutput{Item: input.(*dynamodb.GetItemInput).Key}, nil
+	})
+
+	key := map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+	if _, err := stub.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{}); err != failure {
+		t.Errorf("expect %v, got %v", failure, err)
+	}
+	out, err := stub.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{})
+	if err != nil || !reflect.DeepEqual(key, out.Item) {
+		t.Errorf("expect %v, got %v, %v", key, out, err)
+	}
+}
+
+func TestClientStub_Concurrent(t *testing.T) {
+	stub := NewClientStub(nil, nil, nil)
+	const n = 50
+	stub.SetResponder(OpTransactWriteItems, func(input interface{}, call int, opt RequestOptions) (interface{}, error) {
+		return &dynamodb.TransactWriteItemsOutput{}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := stub.TransactWriteItemsWithOptions(&dynamodb.TransactWriteItemsInput{}, &dynamodb.TransactWriteItemsOutput{}, RequestOptions{}); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			stub.GetRequestOptions()
+		}()
+	}
+	wg.Wait()
+	if e, a := n, len(stub.Requests(OpTransactWriteItems)); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
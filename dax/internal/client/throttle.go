@@ -0,0 +1,109 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// throttleWindow is the sliding window of Stats.RecentThrottledAttempts,
+// counted in one bucket per second.
+const throttleWindow = 60
+
+// Counts the attempts failed with a throttling error, in total and within the
+// last throttleWindow seconds. A nil counter counts nothing.
+type throttleCounter struct {
+	total int64 // accessed atomically
+	clock clock
+
+	lock    sync.Mutex
+	seconds [throttleWindow]int64 // unix second of each bucket, protected by lock
+	counts  [throttleWindow]int64 // protected by lock
+}
+
+func newThrottleCounter(clk clock) *throttleCounter {
+	return &throttleCounter{clock: clockOrSystem(clk)}
+}
+
+func (t *throttleCounter) record() {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.total, 1)
+	now := t.clock.Now().Unix()
+	i := now % throttleWindow
+	t.lock.Lock()
+	if t.seconds[i] != now {
+		t.seconds[i], t.counts[i] = now, 0
+	}
+	t.counts[i]++
+	t.lock.Unlock()
+}
+
+// Returns the number of attempts throttled within the last throttleWindow seconds.
+func (t *throttleCounter) recent() int64 {
+	now := t.clock.Now().Unix()
+	var n int64
+	t.lock.Lock()
+	for i, s := range t.seconds {
+		if s > now-throttleWindow {
+			n += t.counts[i]
+		}
+	}
+	t.lock.Unlock()
+	return n
+}
+
+func (t *throttleCounter) stats(s *Stats) {
+	if t == nil {
+		return
+	}
+	s.ThrottledAttempts += atomic.LoadInt64(&t.total)
+	s.RecentThrottledAttempts += t.recent()
+}
+
+// Counts the attempt of op on client failed with err, and reports it to
+// Config.OnThrottle, if err is a throttling error.
+func (cc *ClusterDaxClient) observeThrottle(op string, opt RequestOptions, client DaxAPI, err error) {
+	if daxErr, ok := err.(daxError); ok {
+		err = convertDaxError(daxErr)
+	}
+	if !request.IsErrorThrottle(err) {
+		return
+	}
+	cc.throttles.record()
+	if cc.config.OnThrottle != nil {
+		cc.config.OnThrottle(op, opt.table, cc.cluster.nodeOf(client), err)
+	}
+}
+
+// Returns the table of the request of input, or the empty string if the
+// request is not for a single table.
+func inputTable(input interface{}) string {
+	tables := InputTables(input)
+	if len(tables) == 0 {
+		return ""
+	}
+	for _, table := range tables[1:] {
+		if table != tables[0] {
+			return ""
+		}
+	}
+	return tables[0]
+}
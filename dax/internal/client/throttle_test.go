@@ -0,0 +1,191 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterDaxClient_OnThrottle(t *testing.T) {
+	throttled := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	var calls int
+	cc := newBatchTestClient(t, &testClientBuilder{getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		calls++
+		if calls <= 2 {
+			return nil, throttled
+		}
+		return &dynamodb.GetItemOutput{}, nil
+	}})
+	clk := newFakeClock()
+	cc.throttles = newThrottleCounter(clk)
+
+	type event struct {
+		op, table, node string
+		err             error
+	}
+	var lock sync.Mutex
+	var events []event
+	cc.config.OnThrottle = func(op, table, node string, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, event{op, table, node, err})
+	}
+
+	input := &dynamodb.GetItemInput{TableName: aws.String("orders"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}}
+	_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: 2, SleepDelayFn: func(time.Duration) {}})
+	require.NoError(t, err)
+
+	require.Len(t, events, 2)
+	for _, e := range events {
+		require.Equal(t, OpGetItem, e.op)
+		require.Equal(t, "orders", e.table)
+		require.NotEmpty(t, e.node)
+		require.Equal(t, throttled, e.err)
+	}
+	stats := cc.Stats()
+	require.Equal(t, int64(2), stats.ThrottledAttempts)
+	require.Equal(t, int64(2), stats.RecentThrottledAttempts)
+
+	// failures of other kinds are not reported
+	_, err = cc.GetItemWithOptions(&dynamodb.GetItemInput{TableName: aws.String("orders")}, &dynamodb.GetItemOutput{}, RequestOptions{})
+	require.Error(t, err)
+	require.Len(t, events, 2)
+
+	clk.Advance(throttleWindow * time.Second)
+	stats = cc.Stats()
+	require.Equal(t, int64(2), stats.ThrottledAttempts)
+	require.Equal(t, int64(0), stats.RecentThrottledAttempts)
+}
+
+func TestClusterDaxClient_OnThrottleBurst(t *testing.T) {
+	const requests, throttlesPerRequest = 20, 3
+	throttled := awserr.New(dynamodb.ErrCodeRequestLimitExceeded, "slow down", nil)
+	var lock sync.Mutex
+	attempts := make(map[string]int)
+	cc := newBatchTestClient(t, &testClientBuilder{getItem: func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		pk := aws.StringValue(input.Key["pk"].S)
+		attempts[pk]++
+		if attempts[pk] <= throttlesPerRequest {
+			return nil, throttled
+		}
+		return &dynamodb.GetItemOutput{}, nil
+	}})
+	clk := newFakeClock()
+	cc.throttles = newThrottleCounter(clk)
+	var reported int64
+	cc.config.OnThrottle = func(op, table, node string, err error) {
+		atomic.AddInt64(&reported, 1)
+	}
+
+	burst := func(prefix string) {
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				input := &dynamodb.GetItemInput{TableName: aws.String("orders"), Key: map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(prefix + strconv.Itoa(i))}}}
+				_, err := cc.GetItemWithOptions(input, &dynamodb.GetItemOutput{}, RequestOptions{MaxRetries: throttlesPerRequest, SleepDelayFn: func(time.Duration) {}})
+				assert.NoError(t, err)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	burst("a")
+	require.Equal(t, int64(requests*throttlesPerRequest), atomic.LoadInt64(&reported))
+	stats := cc.Stats()
+	require.Equal(t, int64(requests*throttlesPerRequest), stats.ThrottledAttempts)
+	require.Equal(t, int64(requests*throttlesPerRequest), stats.RecentThrottledAttempts)
+
+	// a second burst half a window later is counted along with the first,
+	// until the first slides out of the window
+	clk.Advance(throttleWindow / 2 * time.Second)
+	burst("b")
+	stats = cc.Stats()
+	require.Equal(t, int64(2*requests*throttlesPerRequest), stats.ThrottledAttempts)
+	require.Equal(t, int64(2*requests*throttlesPerRequest), stats.RecentThrottledAttempts)
+
+	clk.Advance(throttleWindow / 2 * time.Second)
+	stats = cc.Stats()
+	require.Equal(t, int64(2*requests*throttlesPerRequest), stats.ThrottledAttempts)
+	require.Equal(t, int64(requests*throttlesPerRequest), stats.RecentThrottledAttempts)
+	require.Equal(t, int64(2*requests*throttlesPerRequest), atomic.LoadInt64(&reported))
+}
+
+func TestThrottleCounter_window(t *testing.T) {
+	clk := newFakeClock()
+	c := newThrottleCounter(clk)
+	c.record()
+	clk.Advance(30 * time.Second)
+	c.record()
+	c.record()
+
+	var s Stats
+	c.stats(&s)
+	require.Equal(t, Stats{ThrottledAttempts: 3, RecentThrottledAttempts: 3}, s)
+
+	clk.Advance(30 * time.Second)
+	s = Stats{}
+	c.stats(&s)
+	require.Equal(t, Stats{ThrottledAttempts: 3, RecentThrottledAttempts: 2}, s)
+
+	var nilCounter *throttleCounter
+	nilCounter.record()
+	s = Stats{}
+	nilCounter.stats(&s)
+	require.Equal(t, Stats{}, s)
+}
+
+func TestInputTable(t *testing.T) {
+	key := map[string]*dynamodb.AttributeValue{"pk": {S: aws.String("a")}}
+	cases := []struct {
+		input interface{}
+		table string
+	}{
+		{&dynamodb.PutItemInput{TableName: aws.String("a")}, "a"},
+		{&dynamodb.QueryInput{TableName: aws.String("b")}, "b"},
+		{(*dynamodb.ScanInput)(nil), ""},
+		{nil, ""},
+		{&dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"a": {Keys: []map[string]*dynamodb.AttributeValue{key}}}}, "a"},
+		{&dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			"a": {Keys: []map[string]*dynamodb.AttributeValue{key}},
+			"b": {Keys: []map[string]*dynamodb.AttributeValue{key}},
+		}}, ""},
+		{&dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{TableName: aws.String("a")}},
+			{Delete: &dynamodb.Delete{TableName: aws.String("a")}},
+		}}, "a"},
+		{&dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{TableName: aws.String("a")}},
+			{Delete: &dynamodb.Delete{TableName: aws.String("b")}},
+		}}, ""},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.table, inputTable(c.input), "%#v", c.input)
+	}
+}
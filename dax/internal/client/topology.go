@@ -0,0 +1,90 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import "sync"
+
+// Calls Config.OnTopologyChange on a goroutine of its own, one call at a
+// time, so that a slow callback does not block the refreshes. Changes made
+// while the callback runs are coalesced into a single call with the latest
+// nodes.
+type topologyNotifier struct {
+	fn      func(old, new []NodeInfo)
+	running sync.WaitGroup // the goroutine calling fn
+
+	lock    sync.Mutex
+	last    []NodeInfo // the nodes of the last call, protected by lock
+	latest  []NodeInfo // the nodes not notified yet, protected by lock
+	pending bool       // protected by lock
+	started bool       // the goroutine calling fn runs, protected by lock
+	closed  bool       // protected by lock
+}
+
+// Returns a notifier calling fn, nil if fn is nil.
+func newTopologyNotifier(fn func(old, new []NodeInfo)) *topologyNotifier {
+	if fn == nil {
+		return nil
+	}
+	return &topologyNotifier{fn: fn}
+}
+
+// Notifies the new nodes of the cluster. Never blocks.
+func (n *topologyNotifier) changed(nodes []NodeInfo) {
+	if n == nil {
+		return
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.closed {
+		return
+	}
+	n.latest, n.pending = nodes, true
+	if !n.started {
+		n.started = true
+		n.running.Add(1)
+		go n.run()
+	}
+}
+
+// Drops the changes not notified yet and waits for the running call, if any,
+// to return. No change is notified afterwards.
+func (n *topologyNotifier) close() {
+	if n == nil {
+		return
+	}
+	n.lock.Lock()
+	n.closed = true
+	n.latest, n.pending = nil, false
+	n.lock.Unlock()
+	n.running.Wait()
+}
+
+func (n *topologyNotifier) run() {
+	defer n.running.Done()
+	for {
+		n.lock.Lock()
+		if !n.pending {
+			n.started = false
+			n.lock.Unlock()
+			return
+		}
+		old, nodes := n.last, n.latest
+		n.last, n.latest, n.pending = nodes, nil, false
+		n.lock.Unlock()
+
+		n.fn(old, nodes)
+	}
+}
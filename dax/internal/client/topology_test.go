@@ -0,0 +1,167 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type topologyChange struct {
+	old, new []string
+}
+
+// Returns the "addr/role" of the nodes.
+func nodeRoles(nodes []NodeInfo) []string {
+	var roles []string
+	for _, n := range nodes {
+		roles = append(roles, fmt.Sprintf("%s/%s", n.Addr, n.Role))
+	}
+	return roles
+}
+
+func topologyEndpoint(n byte, role int) serviceEndpoint {
+	return serviceEndpoint{address: net.IPv4(10, 0, 0, n).To4(), port: 8111, role: role}
+}
+
+func nextTopologyChange(t *testing.T, changes chan topologyChange) topologyChange {
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "OnTopologyChange not called")
+		return topologyChange{}
+	}
+}
+
+func TestCluster_OnTopologyChange(t *testing.T) {
+	changes := make(chan topologyChange, 10)
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.OnTopologyChange = func(old, new []NodeInfo) {
+		changes <- topologyChange{nodeRoles(old), nodeRoles(new)}
+	}
+	cluster, _ := newTestClusterWithConfig(cfg)
+	defer cluster.Close()
+
+	steps := []struct {
+		endpoints []serviceEndpoint
+		nodes     []string
+	}{
+		{[]serviceEndpoint{topologyEndpoint(1, roleLeader), topologyEndpoint(2, roleReplica)}, []string{"10.0.0.1:8111/leader", "10.0.0.2:8111/replica"}},
+		// added
+		{[]serviceEndpoint{topologyEndpoint(1, roleLeader), topologyEndpoint(2, roleReplica), topologyEndpoint(3, roleReplica)}, []string{"10.0.0.1:8111/leader", "10.0.0.2:8111/replica", "10.0.0.3:8111/replica"}},
+		// removed
+		{[]serviceEndpoint{topologyEndpoint(1, roleLeader), topologyEndpoint(3, roleReplica)}, []string{"10.0.0.1:8111/leader", "10.0.0.3:8111/replica"}},
+		// leader changed
+		{[]serviceEndpoint{topologyEndpoint(1, roleReplica), topologyEndpoint(3, roleLeader)}, []string{"10.0.0.1:8111/replica", "10.0.0.3:8111/leader"}},
+	}
+	var old []string
+	for i, step := range steps {
+		setExpectation(cluster, step.endpoints)
+		require.NoError(t, cluster.refreshNow())
+		change := nextTopologyChange(t, changes)
+		require.Equal(t, old, change.old, "step %d", i)
+		require.Equal(t, step.nodes, change.new, "step %d", i)
+		old = step.nodes
+
+		// an unchanged discovery is not notified
+		require.NoError(t, cluster.refreshNow())
+	}
+	select {
+	case c := <-changes:
+		require.Fail(t, "unexpected OnTopologyChange", "%v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCluster_OnTopologyChangeCoalesced(t *testing.T) {
+	changes := make(chan topologyChange, 10)
+	unblock := make(chan struct{})
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.OnTopologyChange = func(old, new []NodeInfo) {
+		changes <- topologyChange{nodeRoles(old), nodeRoles(new)}
+		<-unblock
+	}
+	cluster, _ := newTestClusterWithConfig(cfg)
+	defer cluster.Close()
+
+	setExpectation(cluster, []serviceEndpoint{topologyEndpoint(1, roleLeader)})
+	require.NoError(t, cluster.refreshNow())
+	first := nextTopologyChange(t, changes)
+	require.Equal(t, []string{"10.0.0.1:8111/leader"}, first.new)
+
+	// the refreshes do not wait for the blocked callback
+	setExpectation(cluster, []serviceEndpoint{topologyEndpoint(1, roleLeader), topologyEndpoint(2, roleReplica)})
+	require.NoError(t, cluster.refreshNow())
+	setExpectation(cluster, []serviceEndpoint{topologyEndpoint(2, roleLeader)})
+	require.NoError(t, cluster.refreshNow())
+	close(unblock)
+
+	change := nextTopologyChange(t, changes)
+	require.Equal(t, []string{"10.0.0.1:8111/leader"}, change.old)
+	require.Equal(t, []string{"10.0.0.2:8111/leader"}, change.new)
+	select {
+	case c := <-changes:
+		require.Fail(t, "unexpected OnTopologyChange", "%v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCluster_CloseStopsOnTopologyChange(t *testing.T) {
+	changes := make(chan topologyChange, 10)
+	unblock := make(chan struct{})
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.OnTopologyChange = func(old, new []NodeInfo) {
+		changes <- topologyChange{nodeRoles(old), nodeRoles(new)}
+		<-unblock
+	}
+	cluster, _ := newTestClusterWithConfig(cfg)
+
+	setExpectation(cluster, []serviceEndpoint{topologyEndpoint(1, roleLeader)})
+	require.NoError(t, cluster.refreshNow())
+	nextTopologyChange(t, changes)
+	setExpectation(cluster, []serviceEndpoint{topologyEndpoint(2, roleLeader)})
+	require.NoError(t, cluster.refreshNow())
+
+	// Close waits for the running call
+	var closed int32
+	go func() {
+		cluster.Close()
+		atomic.StoreInt32(&closed, 1)
+	}()
+	require.Never(t, func() bool { return atomic.LoadInt32(&closed) == 1 }, 50*time.Millisecond, time.Millisecond)
+	close(unblock)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&closed) == 1 }, 5*time.Second, time.Millisecond)
+
+	// and the pending change is dropped
+	cluster.topology.changed(nil)
+	select {
+	case c := <-changes:
+		require.Fail(t, "unexpected OnTopologyChange", "%v", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
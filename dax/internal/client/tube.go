@@ -17,7 +17,9 @@ package client
 
 import (
 	"bufio"
+	"fmt"
 	"net"
+	"runtime"
 	"strconv"
 	"time"
 
@@ -27,7 +29,20 @@ import (
 const magic = "J7yne5G"
 const agent = "DaxGoClient-1.2.10"
 
-var optional = map[string]string{"UserAgent": agent}
+// defaultUserAgent is the user agent of the clients without
+// Config.UserAgentExtra.
+var defaultUserAgent = userAgentString("")
+
+// Returns the user agent sent by the client to the nodes in the handshake of
+// its connections and in its authentication requests: the version of the
+// client, of Go and the OS and architecture, followed by extra if not empty.
+func userAgentString(extra string) string {
+	ua := fmt.Sprintf("%s (%s; %s/%s)", agent, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if extra != "" {
+		ua += " " + extra
+	}
+	return ua
+}
 
 type session = int64
 
@@ -36,6 +51,8 @@ type tube interface {
 	AuthExpiryUnix() int64
 	SetAuthExpiryUnix(int64)
 	CompareAndSwapAuthID(string) bool
+	IdleSince() time.Time
+	SetIdleSince(time.Time)
 	SetDeadline(time.Time) error
 	Session() session
 	Next() tube
@@ -56,11 +73,12 @@ type netConnTube struct {
 
 	authExpiryUnix int64
 	authID         string
+	idleSince      time.Time
 }
 
 // Creates and initializes a new tube belonging to the given session
 // and using the provided connection.
-func newTube(c net.Conn, s session) (tube, error) {
+func newTube(c net.Conn, s session, userAgent string) (tube, error) {
 	w := cbor.NewWriter(bufio.NewWriter(c))
 	closeResources := func() {
 		w.Close()
@@ -78,7 +96,7 @@ func newTube(c net.Conn, s session) (tube, error) {
 		closeResources()
 		return nil, err
 	}
-	if err := writeHeader(w); err != nil {
+	if err := writeHeader(w, userAgent); err != nil {
 		closeResources()
 		return nil, err
 	}
@@ -119,6 +137,15 @@ func (t *netConnTube) CompareAndSwapAuthID(id string) bool {
 	return false
 }
 
+// Returns the time the tube was last returned to the pool.
+func (t *netConnTube) IdleSince() time.Time {
+	return t.idleSince
+}
+
+func (t *netConnTube) SetIdleSince(since time.Time) {
+	t.idleSince = since
+}
+
 // Sets the deadline on the underlying net.Conn object
 func (t *netConnTube) SetDeadline(time time.Time) error {
 	return t.conn.SetDeadline(time)
@@ -164,19 +191,14 @@ func writeLayering(w *cbor.Writer) error {
 	return w.WriteInt(0)
 }
 
-func writeHeader(w *cbor.Writer) error {
-	if err := w.WriteMapHeader(len(optional)); err != nil {
+func writeHeader(w *cbor.Writer, userAgent string) error {
+	if err := w.WriteMapHeader(1); err != nil {
 		return err
 	}
-	for k, v := range optional {
-		if err := w.WriteString(k); err != nil {
-			return err
-		}
-		if err := w.WriteString(v); err != nil {
-			return err
-		}
+	if err := w.WriteString("UserAgent"); err != nil {
+		return err
 	}
-	return nil
+	return w.WriteString(userAgent)
 }
 
 func writeClientMode(w *cbor.Writer) error {
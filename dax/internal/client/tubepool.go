@@ -22,6 +22,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/proxy"
@@ -35,6 +36,10 @@ type dialContext func(ctx context.Context, network string, address string) (net.
 // Acts as the gate to create new tubes
 // and keeps track of tubes which are currently not in use.
 type tubePool struct {
+	discarded  int64 // accessed atomically, must stay 64-bit aligned
+	connErrors int64 // accessed atomically, must stay 64-bit aligned
+	timeouts   int64 // connections timing out, accessed atomically, must stay 64-bit aligned
+
 	address              string
 	gate                 gate
 	errCh                chan error
@@ -49,7 +54,14 @@ type tubePool struct {
 	session    session // protected by mutex
 	waiters    chan tube
 
+	dialCtx    context.Context // cancelled on Close to abort pending connection attempts
+	dialCancel context.CancelFunc
+	background sync.WaitGroup // tracks connection attempts and tube closes running in the background
+
 	connConfig connConfig
+	clock      clock
+	errLog     *repeatedLog // suppresses the repeated connection errors
+	hosts      *hostCache   // resolves the hostname of address, nil with a custom dialer
 }
 
 type tubePoolOptions struct {
@@ -62,6 +74,9 @@ var defaultDialer = &net.Dialer{}
 
 var defaultTubePoolOptions = tubePoolOptions{maxConcurrentConnAttempts: 10, timeout: time.Second * 5}
 
+// Time by which connection deadlines precede the request context deadline.
+const deadlineMargin = 10 * time.Millisecond
+
 // Creates a new pool using defaultTubePoolOptions and associated with given address.
 func newTubePool(address string, connConfigData connConfig) *tubePool {
 	return newTubePoolWithOptions(address, defaultTubePoolOptions, connConfigData)
@@ -73,7 +88,12 @@ func newTubePoolWithOptions(address string, options tubePoolOptions, connConfigD
 		options.maxConcurrentConnAttempts = defaultTubePoolOptions.maxConcurrentConnAttempts
 	}
 
+	var hosts *hostCache
 	if options.dialContext == nil {
+		hosts = connConfigData.hosts
+		if hosts == nil {
+			hosts = newHostCache(net.DefaultResolver, connConfigData.clock)
+		}
 		if connConfigData.isEncrypted {
 			dialer := &proxy.Dialer{}
 			var cfg tls.Config
@@ -90,6 +110,7 @@ func newTubePoolWithOptions(address string, options tubePoolOptions, connConfigD
 		}
 	}
 
+	dialCtx, dialCancel := context.WithCancel(context.Background())
 	return &tubePool{
 		address:     address,
 		gate:        make(gate, options.maxConcurrentConnAttempts),
@@ -97,8 +118,13 @@ func newTubePoolWithOptions(address string, options tubePoolOptions, connConfigD
 		waiters:     make(chan tube),
 		timeout:     options.timeout,
 		dialContext: options.dialContext,
+		dialCtx:     dialCtx,
+		dialCancel:  dialCancel,
 
 		connConfig: connConfigData,
+		clock:      clockOrSystem(connConfigData.clock),
+		errLog:     newRepeatedLog(connConfigData.clock),
+		hosts:      hosts,
 	}
 }
 
@@ -116,11 +142,17 @@ func (p *tubePool) get() (tube, error) {
 // Gets a new or reuses existing tube with provided context.
 // Create a new tube even if pool reached maxConcurrentConnAttempts if highPriority is true.
 func (p *tubePool) getWithContext(ctx context.Context, highPriority bool, opt RequestOptions) (tube, error) {
+	t, _, err := p.acquire(ctx, highPriority, opt)
+	return t, err
+}
+
+// Same as getWithContext, but also reports whether the tube was taken from the idle tubes stack.
+func (p *tubePool) acquire(ctx context.Context, highPriority bool, opt RequestOptions) (tube, bool, error) {
 	for {
 		p.mutex.Lock()
 		if p.closed {
 			p.mutex.Unlock()
-			return nil, os.ErrClosed
+			return nil, false, os.ErrClosed
 		}
 
 		// look for idle tubes in stack
@@ -132,7 +164,7 @@ func (p *tubePool) getWithContext(ctx context.Context, highPriority bool, opt Re
 			}
 			t.SetNext(nil)
 			p.mutex.Unlock()
-			return t, nil
+			return t, true, nil
 		}
 
 		// no tubes in stack, create wait channel
@@ -144,37 +176,92 @@ func (p *tubePool) getWithContext(ctx context.Context, highPriority bool, opt Re
 		p.mutex.Unlock()
 
 		var done chan tube
+		if highPriority {
+			// the new tube is handed to this request, requests it was issued for may be
+			// waiting for it while holding the other tubes
+			done = make(chan tube)
+		}
 		if p.gate.tryEnter() {
-			go p.allocAndReleaseGate(session, done, true, opt)
+			if !p.spawn(func() { p.allocAndReleaseGate(session, done, true, opt) }) {
+				p.gate.exit()
+				continue // pool was closed
+			}
 		} else if highPriority {
-			done = make(chan tube)
-			go p.allocAndReleaseGate(session, done, false, opt)
+			if !p.spawn(func() { p.allocAndReleaseGate(session, done, false, opt) }) {
+				continue // pool was closed
+			}
 		}
 
 		select {
 		case tube := <-waitCh:
 			if tube != nil {
-				return tube, nil
+				return tube, false, nil
 			}
 			// if channel is closed, continue to look for idle tubes in stack
 		case tube := <-done:
 			if tube != nil {
-				return tube, nil
+				return tube, false, nil
 			}
 		case err := <-p.errCh:
 			// if channel was closed, the error will be nil
 			if err != nil {
 				p.logDebug(opt, fmt.Sprintf("DEBUG: TubePool for %s returned error : %s", p.address, err))
-				return nil, err
+				return nil, false, err
 			}
-			return nil, os.ErrClosed
+			return nil, false, os.ErrClosed
 		case <-ctx.Done():
 			p.logDebug(opt, fmt.Sprintf("DEBUG: Context.Done is closed in Pool %s. Error : %s", p.address, ctx.Err()))
-			return nil, ctx.Err()
+			return nil, false, ctx.Err()
 		}
 	}
 }
 
+// Gets a new tube, establishing a new connection rather than taking an idle
+// tube from the stack or a tube released by another request.
+func (p *tubePool) acquireNew(ctx context.Context, opt RequestOptions) (tube, error) {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, os.ErrClosed
+	}
+	session := p.session
+	p.mutex.Unlock()
+
+	type allocated struct {
+		t   tube
+		err error
+	}
+	var lock sync.Mutex
+	abandoned := false                // protected by lock
+	result := make(chan allocated, 1) // sent to while holding lock
+	if !p.spawn(func() {
+		t, err := p.alloc(session, opt)
+		lock.Lock()
+		defer lock.Unlock()
+		if abandoned {
+			p.put(t) // left to the other requests
+			return
+		}
+		result <- allocated{t, err}
+	}) {
+		return nil, os.ErrClosed
+	}
+	select {
+	case r := <-result:
+		return r.t, r.err
+	case <-ctx.Done():
+		lock.Lock()
+		abandoned = true
+		lock.Unlock()
+		select {
+		case r := <-result:
+			p.put(r.t)
+		default:
+		}
+		return nil, ctx.Err()
+	}
+}
+
 // Allocates a new tube and optionally releases the gate.
 // If done channel isn't nil the new tube will be send there as opposed to idle tubes stack.
 func (p *tubePool) allocAndReleaseGate(session int64, done chan tube, releaseGate bool, opt RequestOptions) {
@@ -232,22 +319,27 @@ func (p *tubePool) put(t tube) {
 		}
 	}
 
+	if p.connConfig.pingAfterIdle > 0 {
+		t.SetIdleSince(p.clock.Now())
+	}
 	t.SetNext(p.top)
 	p.top = t
 }
 
+// Returns true if the idle tube must be checked with a ping before being used.
+func (p *tubePool) needsPing(t tube) bool {
+	return p.connConfig.pingAfterIdle > 0 && p.clock.Now().Sub(t.IdleSince()) >= p.connConfig.pingAfterIdle
+}
+
 // Closes the specified tube, and if the tube is using the same version as the current session,
 // then also closes all other idle tubes and performs a version bump.
 func (p *tubePool) discard(t tube) {
 	if t == nil {
 		return
 	}
-	if p.closeTubeImmediately {
+	atomic.AddInt64(&p.discarded, 1)
+	if p.closeTubeImmediately || !p.spawn(func() { t.Close() }) {
 		t.Close()
-	} else {
-		go func() {
-			t.Close()
-		}()
 	}
 
 	p.mutex.Lock()
@@ -275,7 +367,14 @@ func (p *tubePool) discard(t tube) {
 	p.closeAll(head)
 }
 
-// Sets the deadline on the underlying net.Conn object
+// Returns the pool counters.
+func (p *tubePool) stats() Stats {
+	return Stats{DiscardedConnections: atomic.LoadInt64(&p.discarded), ConnectionErrors: atomic.LoadInt64(&p.connErrors), ConnectTimeouts: atomic.LoadInt64(&p.timeouts)}
+}
+
+// Sets the deadline on the underlying net.Conn object.
+// The deadline is set slightly ahead of the context deadline, so a stalled connection
+// fails with a timeout error before the context expires.
 func (p *tubePool) setDeadline(ctx context.Context, tube tube) error {
 	select {
 	case <-ctx.Done():
@@ -285,11 +384,23 @@ func (p *tubePool) setDeadline(ctx context.Context, tube tube) error {
 	var deadline time.Time
 	if d, ok := ctx.Deadline(); ok {
 		deadline = d
+		if early := d.Add(-deadlineMargin); time.Until(early) > 0 {
+			deadline = early
+		}
 	}
 	return tube.SetDeadline(deadline)
 }
 
+// Clears the deadline set by setDeadline, if any, before the tube is returned to the pool.
+func (p *tubePool) clearDeadline(ctx context.Context, tube tube) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil
+	}
+	return tube.SetDeadline(time.Time{})
+}
+
 // Closes the pool and all idle tubes in it.
+// Blocks until all connection attempts and tube closes running in the background have finished.
 func (p *tubePool) Close() error {
 	p.mutex.Lock()
 
@@ -307,9 +418,30 @@ func (p *tubePool) Close() error {
 	}
 	p.mutex.Unlock()
 	p.closeAll(head)
+	if p.dialCancel != nil {
+		p.dialCancel()
+	}
+	p.background.Wait()
 	return nil
 }
 
+// Runs fn in a new goroutine tracked by the pool unless the pool is closed.
+// Returns false without running fn if the pool is closed.
+func (p *tubePool) spawn(fn func()) bool {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return false
+	}
+	p.background.Add(1)
+	p.mutex.Unlock()
+	go func() {
+		defer p.background.Done()
+		fn()
+	}()
+	return true
+}
+
 // Resets the idle tube stack by detaching existing tubes from it.
 // p.mutex must be held when calling this method
 func (p *tubePool) clearIdleConnections() tube {
@@ -338,20 +470,57 @@ func (p *tubePool) reapIdleConnections() {
 
 // Allocates a new tube by establishing a new connection and performing initialization.
 func (p *tubePool) alloc(session int64, opt RequestOptions) (tube, error) {
-	conn, err := p.dialContext(context.TODO(), network, p.address)
+	ctx := p.dialCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.connConfig.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.connConfig.connectTimeout)
+		defer cancel()
+	}
+	conn, err := p.dial(ctx)
 	if err != nil {
-		p.logDebug(opt, fmt.Sprintf("DEBUG: Error in establishing connection to address %s : %s", p.address, err))
+		atomic.AddInt64(&p.connErrors, 1)
+		if ctx.Err() == context.DeadlineExceeded {
+			err = p.connectTimedOut(err)
+		}
+		if line := p.errLog.filter(fmt.Sprintf("DEBUG: Error in establishing connection to address %s : %s", p.address, err)); line != "" {
+			p.logDebug(opt, line)
+		}
 		return nil, err
 	}
+	p.errLog.reset()
 
-	t, err := newTube(conn, session)
+	if p.connConfig.frameCapture != nil {
+		conn = &recordingConn{Conn: conn}
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		conn.SetDeadline(deadline)
+	}
+	t, err := newTube(conn, session, p.connConfig.agent())
 	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() && p.connConfig.connectTimeout > 0 {
+			atomic.AddInt64(&p.connErrors, 1)
+			err = p.connectTimedOut(err)
+		}
 		p.logDebug(opt, fmt.Sprintf("DEBUG: Error in allocating new tube for %s : %s", conn.RemoteAddr(), err))
 		return nil, err
 	}
+	if hasDeadline {
+		conn.SetDeadline(time.Time{})
+	}
 	return t, nil
 }
 
+// Returns the error of a connection not established within the connect
+// timeout, err being the error of the dial or the handshake.
+func (p *tubePool) connectTimedOut(err error) error {
+	atomic.AddInt64(&p.timeouts, 1)
+	return WrapError(ErrCodeConnectTimeout, fmt.Sprintf("connecting to %s timed out after %s", p.address, p.connConfig.connectTimeout), err)
+}
+
 // Traverses the passed stack and closes all tubes in it.
 func (p *tubePool) closeAll(head tube) {
 	var next tube
@@ -403,3 +572,7 @@ func (g gate) exit() {
 type connectionReaper interface {
 	reapIdleConnections()
 }
+
+type tableCacheInvalidator interface {
+	InvalidateTableCache(table string)
+}
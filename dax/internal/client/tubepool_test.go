@@ -22,6 +22,7 @@ import (
 	"log"
 	"net"
 	"os"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -29,8 +30,10 @@ import (
 	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
 )
 
 var connConfigData = connConfig{isEncrypted: false}
@@ -54,6 +57,13 @@ func (m *mockTube) CompareAndSwapAuthID(auth string) bool {
 	args := m.Called(auth)
 	return args.Bool(0)
 }
+func (m *mockTube) IdleSince() time.Time {
+	args := m.Called()
+	return args.Get(0).(time.Time)
+}
+func (m *mockTube) SetIdleSince(since time.Time) {
+	m.Called(since)
+}
 func (m *mockTube) SetDeadline(time time.Time) error {
 	args := m.Called(time)
 	return args.Error(0)
@@ -327,6 +337,53 @@ func TestTubePoolErrorWithCustomDialContext(t *testing.T) {
 	}
 }
 
+// Dials nothing until ctx is done, as for an address dropping the SYNs.
+func blackholeDial(ctx context.Context, network, address string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+}
+
+func TestTubePool_ConnectTimeout(t *testing.T) {
+	cfg := connConfigData
+	cfg.connectTimeout = 50 * time.Millisecond
+	// the request waits longer than the connect timeout
+	pool := newTubePoolWithOptions("10.255.255.1:8111", tubePoolOptions{1, 5 * time.Second, blackholeDial}, cfg)
+	defer pool.Close()
+
+	start := time.Now()
+	_, err := pool.get()
+	elapsed := time.Since(start)
+	require.Error(t, err)
+	require.Equal(t, ErrCodeConnectTimeout, err.(awserr.Error).Code())
+	require.True(t, elapsed >= cfg.connectTimeout && elapsed < time.Second, "dial abandoned after %s", elapsed)
+	s := pool.stats()
+	require.Equal(t, int64(1), s.ConnectTimeouts)
+	require.Equal(t, int64(1), s.ConnectionErrors)
+}
+
+func TestTubePool_ConnectTimeoutHandshake(t *testing.T) {
+	cfg := connConfigData
+	cfg.connectTimeout = 50 * time.Millisecond
+	var peers []net.Conn
+	defer func() {
+		for _, c := range peers {
+			c.Close()
+		}
+	}()
+	// the peer never reads the handshake
+	pool := newTubePoolWithOptions(":8111", tubePoolOptions{1, 5 * time.Second, func(ctx context.Context, network, address string) (net.Conn, error) {
+		ours, theirs := net.Pipe()
+		peers = append(peers, theirs)
+		return ours, nil
+	}}, cfg)
+	defer pool.Close()
+
+	_, err := pool.get()
+	require.Error(t, err)
+	require.Equal(t, ErrCodeConnectTimeout, err.(awserr.Error).Code())
+	require.Equal(t, int64(1), pool.stats().ConnectTimeouts)
+}
+
 func TestConnectionPriority(t *testing.T) {
 	endpoint := ":8186"
 	listener, err := startServer(endpoint, nil, nil, drainAndCloseConn)
@@ -383,6 +440,53 @@ func TestConnectionPriority(t *testing.T) {
 	wg.Wait()
 }
 
+func TestTubePool_HighPriorityGetsItsTube(t *testing.T) {
+	p := newTubePoolWithOptions(":1234", tubePoolOptions{2, 5 * time.Second, defaultDialer.DialContext}, connConfigData)
+	dials := make(chan chan struct{}, 2)
+	p.dialContext = func(ctx context.Context, a, n string) (net.Conn, error) {
+		release := make(chan struct{})
+		select {
+		case dials <- release:
+		default: // not released by the test
+		}
+		select {
+		case <-release:
+			return &mockConn{}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	defer p.Close()
+
+	low := make(chan error, 1)
+	go func() {
+		_, err := p.getWithContext(context.Background(), false, RequestOptions{})
+		low <- err
+	}()
+	lowDial := <-dials
+
+	high := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := p.getWithContext(ctx, true, RequestOptions{})
+		high <- err
+	}()
+	highDial := <-dials
+
+	// the tube dialed for the high priority request is not handed to the waiting one,
+	// which may be holding the other tubes while waiting for it
+	close(highDial)
+	require.NoError(t, <-high)
+	select {
+	case err := <-low:
+		t.Fatalf("expected the low priority request to wait for its own tube, got %v", err)
+	default:
+	}
+	close(lowDial)
+	require.NoError(t, <-low)
+}
+
 func TestGetWithClosedErrorChannel(t *testing.T) {
 	endpoint := ":8185"
 	listener, err := startServer(endpoint, nil, nil, drainAndCloseConn)
@@ -396,10 +500,9 @@ func TestGetWithClosedErrorChannel(t *testing.T) {
 	pool := newTubePoolWithOptions(endpoint, tubePoolOptions{1, 10 * time.Second, defaultDialer.DialContext}, connConfigData)
 	pool.dialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
 		wg.Done()
-		// Block indefinetely to mimic a long connection
-		for {
-
-		}
+		// Block until the pool is closed to mimic a long connection
+		<-ctx.Done()
+		return nil, ctx.Err()
 	}
 
 	go func() {
@@ -547,8 +650,9 @@ func TestTubePool_DiscardWakesUpWaiters(t *testing.T) {
 		}{t, err}
 	}()
 	startedWg.Wait()
-	// wait some extra time to make sure the caller has entered waiters queue
-	time.Sleep(2 * time.Second)
+	// the caller need not have entered the waiters queue yet: discard wakes it up if it
+	// waits, closes the channel it is about to wait on otherwise, and a caller yet to
+	// take the channel finds the gate released
 
 	// release the gate to allow woken waiters to establish a new connection
 	p.gate.exit()
@@ -587,3 +691,75 @@ func TestTubePool_PutClosesTubesFromDifferentSession(t *testing.T) {
 
 	tt.AssertExpectations(t)
 }
+
+func TestTubePool_CloseAbortsPendingDials(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	pool := newTubePoolWithOptions(":1234", tubePoolOptions{1, 5 * time.Second, defaultDialer.DialContext}, connConfigData)
+	pool.dialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cfn := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cfn()
+	_, err := pool.getWithContext(ctx, true, RequestOptions{})
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, pool.Close())
+}
+
+func TestUserAgentString(t *testing.T) {
+	ua := userAgentString("")
+	require.Equal(t, fmt.Sprintf("DaxGoClient-1.2.10 (%s; %s/%s)", runtime.Version(), runtime.GOOS, runtime.GOARCH), ua)
+	require.Equal(t, ua, defaultUserAgent)
+	require.Equal(t, ua+" orders-service/3.1", userAgentString("orders-service/3.1"))
+
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.UserAgentExtra = "orders-service/3.1"
+	cluster, _ := newTestClusterWithConfig(cfg)
+	require.Equal(t, ua+" orders-service/3.1", cluster.config.connConfig.agent())
+	require.Equal(t, ua, connConfig{}.agent())
+}
+
+func TestTubePool_sendsUserAgent(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	headers := make(chan map[string]string, 1)
+	go func() {
+		r := cbor.NewReader(server)
+		if _, err := r.ReadString(); err != nil { // magic
+			return
+		}
+		if _, err := r.ReadInt(); err != nil { // layering
+			return
+		}
+		if _, err := r.ReadString(); err != nil { // session
+			return
+		}
+		n, err := r.ReadMapLength()
+		if err != nil {
+			return
+		}
+		header := map[string]string{}
+		for i := 0; i < n; i++ {
+			k, _ := r.ReadString()
+			v, _ := r.ReadString()
+			header[k] = v
+		}
+		r.ReadInt() // client mode
+		headers <- header
+	}()
+
+	ua := userAgentString("orders-service/3.1")
+	pool := newTubePoolWithOptions(":9121", tubePoolOptions{1, time.Second, func(ctx context.Context, network, address string) (net.Conn, error) {
+		return client, nil
+	}}, connConfig{userAgent: ua})
+	defer pool.Close()
+	tube, err := pool.alloc(0, RequestOptions{})
+	require.NoError(t, err)
+	defer tube.Close()
+	require.Equal(t, map[string]string{"UserAgent": ua}, <-headers)
+}
@@ -0,0 +1,464 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	maxTransactItems   = 100
+	maxTransactionSize = 4 * 1024 * 1024
+	maxItemSize        = 400 * 1024
+)
+
+// NumberError is returned, before the request is sent, when a request holds a
+// number DynamoDB cannot store: NaN, Infinity, more than 38 significant digits
+// or a magnitude outside 1E-130 to 9.9999999999999999999999999999999999999E+125.
+type NumberError = cbor.NumberError
+
+// ItemTooLargeError is returned, before the request is sent, when an item
+// written by a request is larger than the 400 KB DynamoDB allows. The size of
+// the item is computed the way DynamoDB does, from the names and values of its
+// attributes.
+//
+// ItemTooLargeError implements awserr.Error with the ValidationException code
+// the server would have returned.
+type ItemTooLargeError struct {
+	// Table is the table of the item.
+	Table string
+	// Path is the parameter of the request holding the item, such as Item or
+	// RequestItems[table][2].PutRequest.Item.
+	Path string
+	// Size is the size of the item in bytes.
+	Size int
+	// Limit is the maximum size of an item in bytes.
+	Limit int
+}
+
+func (e *ItemTooLargeError) Error() string {
+	return awserr.SprintError(e.Code(), e.Message(), "", nil)
+}
+
+func (e *ItemTooLargeError) Code() string {
+	return ErrCodeValidationException
+}
+
+func (e *ItemTooLargeError) Message() string {
+	return fmt.Sprintf("Item size has exceeded the maximum allowed size: %s of table %s is %d bytes, more than the limit of %d bytes", e.Path, e.Table, e.Size, e.Limit)
+}
+
+func (e *ItemTooLargeError) OrigErr() error {
+	return nil
+}
+
+// Returns an *ItemTooLargeError if the item at path is over the limit.
+func validateItemSize(table *string, path string, item map[string]*dynamodb.AttributeValue) error {
+	if size := itemSize(item); size > maxItemSize {
+		return &ItemTooLargeError{Table: aws.StringValue(table), Path: path, Size: size, Limit: maxItemSize}
+	}
+	return nil
+}
+
+func validatePutItemInput(input *dynamodb.PutItemInput) error {
+	if input == nil {
+		return nil // the encoder reports missing input
+	}
+	return validateItemSize(input.TableName, "Item", input.Item)
+}
+
+// Checks the size of the item when the update determines it, that is the key
+// and the values put by the legacy AttributeUpdates. The size of the items
+// updated with an expression depends on the attributes they already have.
+func validateUpdateItemInput(input *dynamodb.UpdateItemInput) error {
+	if input == nil || len(input.AttributeUpdates) == 0 {
+		return nil
+	}
+	item := make(map[string]*dynamodb.AttributeValue, len(input.Key)+len(input.AttributeUpdates))
+	for n, v := range input.Key {
+		item[n] = v
+	}
+	for n, u := range input.AttributeUpdates {
+		if u != nil && u.Value != nil && (u.Action == nil || *u.Action == dynamodb.AttributeActionPut) {
+			item[n] = u.Value
+		}
+	}
+	return validateItemSize(input.TableName, "Key and AttributeUpdates", item)
+}
+
+// Checks a transaction against the limits of DynamoDB, so that requests the server
+// would reject fail before being sent, with an error naming the offending action.
+func validateTransactWriteItemsInput(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, keySchema *lru.Lru) error {
+	if input == nil {
+		return nil // the encoder reports missing input
+	}
+	if len(input.TransactItems) > maxTransactItems {
+		return newValidationFailure(fmt.Sprintf("Transaction request has %d actions, more than the limit of %d", len(input.TransactItems), maxTransactItems))
+	}
+
+	actions := make(map[string]int, len(input.TransactItems))
+	size := 0
+	for i, twi := range input.TransactItems {
+		table, key := transactWriteItemKey(twi)
+		if table == nil || key == nil {
+			continue // the encoder reports invalid actions
+		}
+		if put := twi.Put; put != nil {
+			if err := validateItemSize(table, fmt.Sprintf("TransactItems[%d].Put.Item", i), put.Item); err != nil {
+				return err
+			}
+			size += itemSize(put.Item)
+		} else {
+			size += itemSize(key)
+		}
+		if size > maxTransactionSize {
+			return newValidationFailure(fmt.Sprintf("Transaction request exceeds the limit of %d bytes at TransactItems[%d]", maxTransactionSize, i))
+		}
+
+		keydef, err := getKeySchema(ctx, keySchema, *table)
+		if err != nil {
+			return err
+		}
+		keyBytes, err := cbor.GetEncodedItemKey(key, keydef)
+		if err != nil {
+			continue // the encoder reports incomplete keys
+		}
+		tableKey := *table + "\x00" + string(keyBytes)
+		if j, ok := actions[tableKey]; ok {
+			return newValidationFailure(fmt.Sprintf("Transaction request cannot include multiple operations on one item: "+
+				"TransactItems[%d] and TransactItems[%d] operate on the same item of table %s", j, i, *table))
+		}
+		actions[tableKey] = i
+	}
+	return nil
+}
+
+// Returns the table of the action and the attributes holding the key of its item,
+// nil if the action is invalid.
+func transactWriteItemKey(twi *dynamodb.TransactWriteItem) (*string, map[string]*dynamodb.AttributeValue) {
+	if twi == nil {
+		return nil, nil
+	}
+	switch {
+	case twi.ConditionCheck != nil:
+		return twi.ConditionCheck.TableName, twi.ConditionCheck.Key
+	case twi.Delete != nil:
+		return twi.Delete.TableName, twi.Delete.Key
+	case twi.Put != nil:
+		return twi.Put.TableName, twi.Put.Item
+	case twi.Update != nil:
+		return twi.Update.TableName, twi.Update.Key
+	}
+	return nil, nil
+}
+
+// Checks the size of the items of a batch and that no two writes operate on the
+// same item, as the server rejects such batches without telling which writes
+// conflict.
+func validateBatchWriteItemInput(ctx aws.Context, input *dynamodb.BatchWriteItemInput, keySchema *lru.Lru) error {
+	if input == nil {
+		return nil // the encoder reports missing input
+	}
+	tables := make([]string, 0, len(input.RequestItems))
+	for table := range input.RequestItems {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		wrs := input.RequestItems[table]
+		for i, wr := range wrs {
+			if wr != nil && wr.PutRequest != nil {
+				path := fmt.Sprintf("RequestItems[%s][%d].PutRequest.Item", table, i)
+				if err := validateItemSize(aws.String(table), path, wr.PutRequest.Item); err != nil {
+					return err
+				}
+			}
+		}
+		if len(wrs) <= 1 {
+			continue
+		}
+		keydef, err := getKeySchema(ctx, keySchema, table)
+		if err != nil {
+			return err
+		}
+		writes := make(map[string]int, len(wrs))
+		for i, wr := range wrs {
+			var key map[string]*dynamodb.AttributeValue
+			if wr != nil && wr.PutRequest != nil {
+				key = wr.PutRequest.Item
+			} else if wr != nil && wr.DeleteRequest != nil {
+				key = wr.DeleteRequest.Key
+			}
+			if key == nil {
+				continue // the encoder reports invalid writes
+			}
+			keyBytes, err := cbor.GetEncodedItemKey(key, keydef)
+			if err != nil {
+				continue // the encoder reports incomplete keys
+			}
+			if j, ok := writes[string(keyBytes)]; ok {
+				return newValidationFailure(fmt.Sprintf("Provided list of item keys contains duplicates: "+
+					"RequestItems[%s][%d] and RequestItems[%s][%d] both write the item with key %s", table, j, table, i, formatKey(key, keydef)))
+			}
+			writes[string(keyBytes)] = i
+		}
+	}
+	return nil
+}
+
+// Formats the key attributes of the item, such as {hk: "a", rk: 1}.
+func formatKey(item map[string]*dynamodb.AttributeValue, keydef []dynamodb.AttributeDefinition) string {
+	parts := make([]string, 0, len(keydef))
+	for _, k := range keydef {
+		name := aws.StringValue(k.AttributeName)
+		v := item[name]
+		var value string
+		switch {
+		case v == nil:
+			value = "<missing>"
+		case v.S != nil:
+			value = strconv.Quote(*v.S)
+		case v.N != nil:
+			value = *v.N
+		case v.B != nil:
+			value = "0x" + hex.EncodeToString(v.B)
+		default:
+			value = "<invalid>"
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func validateTransactGetItemsInput(input *dynamodb.TransactGetItemsInput) error {
+	if input == nil {
+		return nil // the encoder reports missing input
+	}
+	if len(input.TransactItems) > maxTransactItems {
+		return newValidationFailure(fmt.Sprintf("Transaction request has %d actions, more than the limit of %d", len(input.TransactItems), maxTransactItems))
+	}
+	return nil
+}
+
+// Returns the size of the item as DynamoDB accounts for it: the length of the
+// names of its attributes plus the size of their values.
+func itemSize(item map[string]*dynamodb.AttributeValue) int {
+	size := 0
+	for n, v := range item {
+		size += len(n) + attributeValueSize(v)
+	}
+	return size
+}
+
+func attributeValueSize(v *dynamodb.AttributeValue) int {
+	if v == nil {
+		return 0
+	}
+	size := 0
+	switch {
+	case v.S != nil:
+		size = len(*v.S)
+	case v.N != nil:
+		size = numberSize(*v.N)
+	case v.B != nil:
+		size = len(v.B)
+	case v.BOOL != nil, v.NULL != nil:
+		size = 1
+	case v.SS != nil:
+		for _, s := range v.SS {
+			size += len(aws.StringValue(s))
+		}
+	case v.NS != nil:
+		for _, n := range v.NS {
+			size += numberSize(aws.StringValue(n))
+		}
+	case v.BS != nil:
+		for _, b := range v.BS {
+			size += len(b)
+		}
+	case v.L != nil:
+		size = 3
+		for _, e := range v.L {
+			size += 1 + attributeValueSize(e)
+		}
+	case v.M != nil:
+		size = 3
+		for n, e := range v.M {
+			size += 1 + len(n) + attributeValueSize(e)
+		}
+	}
+	return size
+}
+
+// Numbers take a byte per two significant digits plus one.
+func numberSize(n string) int {
+	if e := strings.IndexAny(n, "eE"); e >= 0 {
+		n = n[:e]
+	}
+	digits := strings.Trim(strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, n), "0")
+	return (len(digits)+1)/2 + 1
+}
+
+// Checks the parameters of a request the way the SDK does before sending it to
+// DynamoDB, adding the checks of the parameters without which the request would
+// fail later on, such as empty keys or queries without key conditions. All the
+// invalid parameters are reported together, in a request.ErrInvalidParams.
+func validateParams(input interface{}) error {
+	var invalid request.ErrInvalidParams
+	nilInput := false
+	switch in := input.(type) {
+	case *dynamodb.GetItemInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("GetItemInput", in.Validate())
+			checkNotEmpty(&invalid, "Key", in.Key)
+		}
+	case *dynamodb.PutItemInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("PutItemInput", in.Validate())
+			checkNotEmpty(&invalid, "Item", in.Item)
+		}
+	case *dynamodb.DeleteItemInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("DeleteItemInput", in.Validate())
+			checkNotEmpty(&invalid, "Key", in.Key)
+		}
+	case *dynamodb.UpdateItemInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("UpdateItemInput", in.Validate())
+			checkNotEmpty(&invalid, "Key", in.Key)
+		}
+	case *dynamodb.QueryInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("QueryInput", in.Validate())
+			if in.KeyConditionExpression == nil && in.KeyConditions == nil {
+				invalid.Add(request.NewErrParamRequired("KeyConditionExpression"))
+			}
+			checkSelect(&invalid, in.Select, in.ProjectionExpression, in.AttributesToGet)
+		}
+	case *dynamodb.ScanInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("ScanInput", in.Validate())
+			checkSelect(&invalid, in.Select, in.ProjectionExpression, in.AttributesToGet)
+		}
+	case *dynamodb.BatchGetItemInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("BatchGetItemInput", in.Validate())
+			for _, table := range sortedTables(in.RequestItems) {
+				if kaas := in.RequestItems[table]; kaas != nil {
+					for i, key := range kaas.Keys {
+						checkNotEmpty(&invalid, fmt.Sprintf("RequestItems[%s].Keys[%d]", table, i), key)
+					}
+				}
+			}
+		}
+	case *dynamodb.BatchWriteItemInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("BatchWriteItemInput", in.Validate())
+			tables := make([]string, 0, len(in.RequestItems))
+			for table := range in.RequestItems {
+				tables = append(tables, table)
+			}
+			sort.Strings(tables)
+			for _, table := range tables {
+				for i, wr := range in.RequestItems[table] {
+					switch {
+					case wr == nil || (wr.PutRequest == nil && wr.DeleteRequest == nil):
+						invalid.Add(request.NewErrParamRequired(fmt.Sprintf("RequestItems[%s][%d].PutRequest", table, i)))
+					case wr.PutRequest != nil:
+						checkNotEmpty(&invalid, fmt.Sprintf("RequestItems[%s][%d].PutRequest.Item", table, i), wr.PutRequest.Item)
+					default:
+						checkNotEmpty(&invalid, fmt.Sprintf("RequestItems[%s][%d].DeleteRequest.Key", table, i), wr.DeleteRequest.Key)
+					}
+				}
+			}
+		}
+	case *dynamodb.TransactGetItemsInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("TransactGetItemsInput", in.Validate())
+			for i, tgi := range in.TransactItems {
+				if tgi != nil && tgi.Get != nil {
+					checkNotEmpty(&invalid, fmt.Sprintf("TransactItems[%d].Get.Key", i), tgi.Get.Key)
+				}
+			}
+		}
+	case *dynamodb.TransactWriteItemsInput:
+		if nilInput = in == nil; !nilInput {
+			invalid = sdkInvalidParams("TransactWriteItemsInput", in.Validate())
+			for i, twi := range in.TransactItems {
+				switch {
+				case twi == nil:
+					invalid.Add(request.NewErrParamRequired(fmt.Sprintf("TransactItems[%d]", i)))
+				case twi.ConditionCheck != nil:
+					checkNotEmpty(&invalid, fmt.Sprintf("TransactItems[%d].ConditionCheck.Key", i), twi.ConditionCheck.Key)
+				case twi.Delete != nil:
+					checkNotEmpty(&invalid, fmt.Sprintf("TransactItems[%d].Delete.Key", i), twi.Delete.Key)
+				case twi.Put != nil:
+					checkNotEmpty(&invalid, fmt.Sprintf("TransactItems[%d].Put.Item", i), twi.Put.Item)
+				case twi.Update != nil:
+					checkNotEmpty(&invalid, fmt.Sprintf("TransactItems[%d].Update.Key", i), twi.Update.Key)
+				}
+			}
+		}
+	}
+	if nilInput {
+		return awserr.New(request.ParamRequiredErrCode, "input cannot be nil", nil)
+	}
+	if invalid.Len() > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// Returns the invalid parameters found by the SDK, err being the result of the
+// Validate method of the input named context.
+func sdkInvalidParams(context string, err error) request.ErrInvalidParams {
+	if invalid, ok := err.(request.ErrInvalidParams); ok {
+		return invalid
+	}
+	return request.ErrInvalidParams{Context: context}
+}
+
+// Reports the attributes of field as invalid if present but empty, the SDK only
+// checking they are present.
+func checkNotEmpty(invalid *request.ErrInvalidParams, field string, attrs map[string]*dynamodb.AttributeValue) {
+	if attrs != nil && len(attrs) == 0 {
+		invalid.Add(request.NewErrParamMinLen(field, 1))
+	}
+}
+
+// Reports a missing ProjectionExpression when selecting specific attributes
+// without telling which ones.
+func checkSelect(invalid *request.ErrInvalidParams, selection, projection *string, attributesToGet []*string) {
+	if aws.StringValue(selection) == dynamodb.SelectSpecificAttributes && projection == nil && attributesToGet == nil {
+		invalid.Add(request.NewErrParamRequired("ProjectionExpression"))
+	}
+}
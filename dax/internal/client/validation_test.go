@@ -0,0 +1,376 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package client
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTransactWriteItemsInput(t *testing.T) {
+	key := func(hk string, rk int) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"hk": {S: aws.String(hk)}, "rk": {N: aws.String(strconv.Itoa(rk))}}
+	}
+	item := func(hk string, rk int, data string) map[string]*dynamodb.AttributeValue {
+		item := key(hk, rk)
+		item["data"] = &dynamodb.AttributeValue{S: aws.String(data)}
+		return item
+	}
+	puts := func(n int, data string) []*dynamodb.TransactWriteItem {
+		actions := make([]*dynamodb.TransactWriteItem, n)
+		for i := range actions {
+			actions[i] = &dynamodb.TransactWriteItem{Put: &dynamodb.Put{TableName: aws.String("table"), Item: item("a", i, data)}}
+		}
+		return actions
+	}
+	large := strings.Repeat("x", 400*1024-100)
+
+	cases := []struct {
+		name    string
+		actions []*dynamodb.TransactWriteItem
+		err     string
+	}{
+		{name: "limit of actions", actions: puts(maxTransactItems, "")},
+		{name: "too many actions", actions: puts(maxTransactItems+1, ""), err: "has 101 actions, more than the limit of 100"},
+		{name: "limit of size", actions: puts(10, large)},
+		{name: "too large", actions: puts(11, large), err: "exceeds the limit of 4194304 bytes at TransactItems[10]"},
+		{
+			name: "same key in different tables",
+			actions: []*dynamodb.TransactWriteItem{
+				{Put: &dynamodb.Put{TableName: aws.String("table"), Item: item("a", 1, "")}},
+				{Delete: &dynamodb.Delete{TableName: aws.String("other"), Key: key("a", 1)}},
+			},
+		},
+		{
+			name: "duplicate put and update",
+			actions: []*dynamodb.TransactWriteItem{
+				{Put: &dynamodb.Put{TableName: aws.String("table"), Item: item("a", 1, "")}},
+				{Delete: &dynamodb.Delete{TableName: aws.String("table"), Key: key("a", 2)}},
+				{Update: &dynamodb.Update{TableName: aws.String("table"), Key: key("a", 1), UpdateExpression: aws.String("REMOVE #d")}},
+			},
+			err: "TransactItems[0] and TransactItems[2] operate on the same item of table table",
+		},
+		{
+			name: "duplicate condition check",
+			actions: []*dynamodb.TransactWriteItem{
+				{Delete: &dynamodb.Delete{TableName: aws.String("table"), Key: key("a", 1)}},
+				{ConditionCheck: &dynamodb.ConditionCheck{TableName: aws.String("table"), Key: key("a", 1), ConditionExpression: aws.String("attribute_exists(hk)")}},
+			},
+			err: "TransactItems[0] and TransactItems[1] operate on the same item of table table",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateTransactWriteItemsInput(nil, &dynamodb.TransactWriteItemsInput{TransactItems: c.actions}, scanTestKeySchema())
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			failure, ok := err.(*daxRequestFailure)
+			require.True(t, ok, "unexpected error %v", err)
+			require.Equal(t, ErrCodeValidationException, failure.Code())
+			require.Equal(t, 400, failure.StatusCode())
+			require.Contains(t, failure.Message(), c.err)
+		})
+	}
+}
+
+func TestValidateBatchWriteItemInput(t *testing.T) {
+	key := func(hk string, rk int) map[string]*dynamodb.AttributeValue {
+		return map[string]*dynamodb.AttributeValue{"hk": {S: aws.String(hk)}, "rk": {N: aws.String(strconv.Itoa(rk))}}
+	}
+	put := func(hk string, rk int) *dynamodb.WriteRequest {
+		item := key(hk, rk)
+		item["data"] = &dynamodb.AttributeValue{S: aws.String("data")}
+		return &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}}
+	}
+	del := func(hk string, rk int) *dynamodb.WriteRequest {
+		return &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{Key: key(hk, rk)}}
+	}
+
+	cases := []struct {
+		name   string
+		writes map[string][]*dynamodb.WriteRequest
+		err    string
+	}{
+		{
+			name:   "no duplicates",
+			writes: map[string][]*dynamodb.WriteRequest{"table": {put("a", 1), put("a", 2), del("b", 1)}},
+		},
+		{
+			name:   "same key in different tables",
+			writes: map[string][]*dynamodb.WriteRequest{"table": {put("a", 1)}, "other": {del("a", 1)}},
+		},
+		{
+			name:   "duplicate puts",
+			writes: map[string][]*dynamodb.WriteRequest{"table": {put("a", 1), put("b", 1), put("a", 1)}},
+			err:    `RequestItems[table][0] and RequestItems[table][2] both write the item with key {hk: "a", rk: 1}`,
+		},
+		{
+			name:   "put and delete",
+			writes: map[string][]*dynamodb.WriteRequest{"other": {put("a", 1)}, "table": {del("a", 2), put("a", 2)}},
+			err:    `RequestItems[table][0] and RequestItems[table][1] both write the item with key {hk: "a", rk: 2}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateBatchWriteItemInput(nil, &dynamodb.BatchWriteItemInput{RequestItems: c.writes}, scanTestKeySchema())
+			if c.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			failure, ok := err.(*daxRequestFailure)
+			require.True(t, ok, "unexpected error %v", err)
+			require.Equal(t, ErrCodeValidationException, failure.Code())
+			require.Equal(t, "Provided list of item keys contains duplicates: "+c.err, failure.Message())
+		})
+	}
+}
+
+func TestFormatKey(t *testing.T) {
+	keydef := []dynamodb.AttributeDefinition{
+		{AttributeName: aws.String("hk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeB)},
+		{AttributeName: aws.String("rk"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+	}
+	item := map[string]*dynamodb.AttributeValue{"hk": {B: []byte{0xca, 0xfe}}, "rk": {S: aws.String(`a"b`)}}
+	require.Equal(t, `{hk: 0xcafe, rk: "a\"b"}`, formatKey(item, keydef))
+	require.Equal(t, `{hk: 0xcafe, rk: <missing>}`, formatKey(map[string]*dynamodb.AttributeValue{"hk": item["hk"]}, keydef))
+}
+
+func TestValidateTransactGetItemsInput(t *testing.T) {
+	gets := func(n int) *dynamodb.TransactGetItemsInput {
+		input := &dynamodb.TransactGetItemsInput{}
+		for i := 0; i < n; i++ {
+			key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}, "rk": {N: aws.String(strconv.Itoa(i))}}
+			input.TransactItems = append(input.TransactItems, &dynamodb.TransactGetItem{Get: &dynamodb.Get{TableName: aws.String("table"), Key: key}})
+		}
+		return input
+	}
+	require.NoError(t, validateTransactGetItemsInput(gets(maxTransactItems)))
+	err := validateTransactGetItemsInput(gets(maxTransactItems + 1))
+	require.Error(t, err)
+	require.Equal(t, ErrCodeValidationException, err.(*daxRequestFailure).Code())
+	require.Contains(t, err.(*daxRequestFailure).Message(), "has 101 actions, more than the limit of 100")
+}
+
+func TestValidateItemSize(t *testing.T) {
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}, "rk": {N: aws.String("1")}}
+	// an item of the given size, made of the key and of binary and nested attributes
+	item := func(size int) map[string]*dynamodb.AttributeValue {
+		nested := &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{
+			"l": {L: []*dynamodb.AttributeValue{{B: make([]byte, 1000)}, {NULL: aws.Bool(true)}}},
+		}}
+		item := map[string]*dynamodb.AttributeValue{"hk": key["hk"], "rk": key["rk"], "nested": nested}
+		item["data"] = &dynamodb.AttributeValue{B: make([]byte, size-itemSize(item)-len("data"))}
+		require.Equal(t, size, itemSize(item))
+		return item
+	}
+	under, over := item(maxItemSize), item(maxItemSize+1)
+
+	validations := []struct {
+		name  string
+		path  string
+		input func(item map[string]*dynamodb.AttributeValue) error
+	}{
+		{
+			name: "PutItem",
+			path: "Item",
+			input: func(item map[string]*dynamodb.AttributeValue) error {
+				return validatePutItemInput(&dynamodb.PutItemInput{TableName: aws.String("table"), Item: item})
+			},
+		},
+		{
+			name: "UpdateItem",
+			path: "Key and AttributeUpdates",
+			input: func(item map[string]*dynamodb.AttributeValue) error {
+				updates := map[string]*dynamodb.AttributeValueUpdate{
+					"gone": {Action: aws.String(dynamodb.AttributeActionDelete)},
+				}
+				for n, v := range item {
+					if key[n] == nil {
+						updates[n] = &dynamodb.AttributeValueUpdate{Value: v}
+					}
+				}
+				return validateUpdateItemInput(&dynamodb.UpdateItemInput{TableName: aws.String("table"), Key: key, AttributeUpdates: updates})
+			},
+		},
+		{
+			name: "BatchWriteItem",
+			path: "RequestItems[table][1].PutRequest.Item",
+			input: func(item map[string]*dynamodb.AttributeValue) error {
+				other := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("b")}, "rk": {N: aws.String("1")}}
+				writes := []*dynamodb.WriteRequest{{DeleteRequest: &dynamodb.DeleteRequest{Key: other}}, {PutRequest: &dynamodb.PutRequest{Item: item}}}
+				return validateBatchWriteItemInput(nil, &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"table": writes}}, scanTestKeySchema())
+			},
+		},
+		{
+			name: "TransactWriteItems",
+			path: "TransactItems[1].Put.Item",
+			input: func(item map[string]*dynamodb.AttributeValue) error {
+				other := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("b")}, "rk": {N: aws.String("1")}}
+				actions := []*dynamodb.TransactWriteItem{
+					{Delete: &dynamodb.Delete{TableName: aws.String("table"), Key: other}},
+					{Put: &dynamodb.Put{TableName: aws.String("table"), Item: item}},
+				}
+				return validateTransactWriteItemsInput(nil, &dynamodb.TransactWriteItemsInput{TransactItems: actions}, scanTestKeySchema())
+			},
+		},
+	}
+	for _, v := range validations {
+		t.Run(v.name, func(t *testing.T) {
+			require.NoError(t, v.input(under))
+			err := v.input(over)
+			require.Error(t, err)
+			tooLarge, ok := err.(*ItemTooLargeError)
+			require.True(t, ok, "unexpected error %v", err)
+			require.Equal(t, &ItemTooLargeError{Table: "table", Path: v.path, Size: maxItemSize + 1, Limit: maxItemSize}, tooLarge)
+			require.Equal(t, ErrCodeValidationException, tooLarge.Code())
+			require.Contains(t, tooLarge.Message(), "409601 bytes, more than the limit of 409600 bytes")
+		})
+	}
+}
+
+func TestItemSize(t *testing.T) {
+	cases := []struct {
+		v    *dynamodb.AttributeValue
+		size int
+	}{
+		{v: &dynamodb.AttributeValue{S: aws.String("abc")}, size: 3},
+		{v: &dynamodb.AttributeValue{N: aws.String("123")}, size: 3},
+		{v: &dynamodb.AttributeValue{N: aws.String("-0.001200")}, size: 2},
+		{v: &dynamodb.AttributeValue{N: aws.String("12E100")}, size: 2},
+		{v: &dynamodb.AttributeValue{B: []byte{1, 2}}, size: 2},
+		{v: &dynamodb.AttributeValue{BOOL: aws.Bool(true)}, size: 1},
+		{v: &dynamodb.AttributeValue{NULL: aws.Bool(true)}, size: 1},
+		{v: &dynamodb.AttributeValue{SS: aws.StringSlice([]string{"a", "bc"})}, size: 3},
+		{v: &dynamodb.AttributeValue{NS: aws.StringSlice([]string{"1", "22"})}, size: 4},
+		{v: &dynamodb.AttributeValue{BS: [][]byte{{1}, {2, 3}}}, size: 3},
+		{v: &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{{S: aws.String("ab")}, {BOOL: aws.Bool(false)}}}, size: 3 + 3 + 2},
+		{v: &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"k": {S: aws.String("ab")}}}, size: 3 + 1 + 1 + 2},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.size, attributeValueSize(c.v), "%v", c.v)
+		require.Equal(t, len("name")+c.size, itemSize(map[string]*dynamodb.AttributeValue{"name": c.v}), "%v", c.v)
+	}
+}
+
+func TestValidateParams(t *testing.T) {
+	key := map[string]*dynamodb.AttributeValue{"hk": {S: aws.String("a")}}
+	empty := map[string]*dynamodb.AttributeValue{}
+	table := aws.String("table")
+
+	cases := []struct {
+		name    string
+		input   interface{}
+		invalid []string
+	}{
+		{name: "GetItem", input: &dynamodb.GetItemInput{TableName: table, Key: key}},
+		{name: "GetItem without table", input: &dynamodb.GetItemInput{Key: key}, invalid: []string{"missing required field, GetItemInput.TableName."}},
+		{name: "GetItem without key", input: &dynamodb.GetItemInput{TableName: table}, invalid: []string{"missing required field, GetItemInput.Key."}},
+		{name: "GetItem with empty key", input: &dynamodb.GetItemInput{TableName: table, Key: empty}, invalid: []string{"minimum field size of 1, GetItemInput.Key."}},
+		{name: "PutItem", input: &dynamodb.PutItemInput{TableName: table, Item: key}},
+		{name: "PutItem with empty item", input: &dynamodb.PutItemInput{TableName: table, Item: empty}, invalid: []string{"minimum field size of 1, PutItemInput.Item."}},
+		{name: "DeleteItem without key", input: &dynamodb.DeleteItemInput{TableName: table}, invalid: []string{"missing required field, DeleteItemInput.Key."}},
+		{name: "UpdateItem with empty key", input: &dynamodb.UpdateItemInput{TableName: table, Key: empty}, invalid: []string{"minimum field size of 1, UpdateItemInput.Key."}},
+		{name: "Query", input: &dynamodb.QueryInput{TableName: table, KeyConditionExpression: aws.String("hk = :a")}},
+		{name: "Query with legacy conditions", input: &dynamodb.QueryInput{TableName: table, KeyConditions: map[string]*dynamodb.Condition{}}},
+		{name: "Query without key conditions", input: &dynamodb.QueryInput{TableName: table}, invalid: []string{"missing required field, QueryInput.KeyConditionExpression."}},
+		{name: "Scan without table", input: &dynamodb.ScanInput{}, invalid: []string{"missing required field, ScanInput.TableName."}},
+		{name: "Scan of specific attributes", input: &dynamodb.ScanInput{TableName: table, Select: aws.String(dynamodb.SelectSpecificAttributes), ProjectionExpression: aws.String("hk")}},
+		{name: "Scan of legacy specific attributes", input: &dynamodb.ScanInput{TableName: table, Select: aws.String(dynamodb.SelectSpecificAttributes), AttributesToGet: aws.StringSlice([]string{"hk"})}},
+		{
+			name:    "Scan of unknown specific attributes",
+			input:   &dynamodb.ScanInput{TableName: table, Select: aws.String(dynamodb.SelectSpecificAttributes)},
+			invalid: []string{"missing required field, ScanInput.ProjectionExpression."},
+		},
+		{
+			name:    "Query of unknown specific attributes",
+			input:   &dynamodb.QueryInput{TableName: table, KeyConditionExpression: aws.String("hk = :a"), Select: aws.String(dynamodb.SelectSpecificAttributes)},
+			invalid: []string{"missing required field, QueryInput.ProjectionExpression."},
+		},
+		{
+			name:    "BatchGetItem with empty key",
+			input:   &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: []map[string]*dynamodb.AttributeValue{key, empty}}}},
+			invalid: []string{"minimum field size of 1, BatchGetItemInput.RequestItems[table].Keys[1]."},
+		},
+		{
+			name: "BatchWriteItem without requests",
+			input: &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"table": {
+				{PutRequest: &dynamodb.PutRequest{Item: empty}},
+				{},
+				{DeleteRequest: &dynamodb.DeleteRequest{Key: key}},
+			}}},
+			invalid: []string{
+				"minimum field size of 1, BatchWriteItemInput.RequestItems[table][0].PutRequest.Item.",
+				"missing required field, BatchWriteItemInput.RequestItems[table][1].PutRequest.",
+			},
+		},
+		{
+			name:    "TransactGetItems with empty key",
+			input:   &dynamodb.TransactGetItemsInput{TransactItems: []*dynamodb.TransactGetItem{{Get: &dynamodb.Get{TableName: table, Key: empty}}}},
+			invalid: []string{"minimum field size of 1, TransactGetItemsInput.TransactItems[0].Get.Key."},
+		},
+		{
+			name: "TransactWriteItems with empty item",
+			input: &dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+				{Delete: &dynamodb.Delete{TableName: table, Key: key}},
+				{Put: &dynamodb.Put{TableName: table, Item: empty}},
+			}},
+			invalid: []string{"minimum field size of 1, TransactWriteItemsInput.TransactItems[1].Put.Item."},
+		},
+		{
+			name:  "every problem",
+			input: &dynamodb.UpdateItemInput{Key: empty, ConditionExpression: aws.String("attribute_exists(hk)"), ReturnValues: aws.String(dynamodb.ReturnValueAllNew)},
+			invalid: []string{
+				"missing required field, UpdateItemInput.TableName.",
+				"minimum field size of 1, UpdateItemInput.Key.",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateParams(c.input)
+			if len(c.invalid) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			invalid, ok := err.(request.ErrInvalidParams)
+			require.True(t, ok, "unexpected error %v", err)
+			require.Equal(t, request.InvalidParameterErrCode, invalid.Code())
+			var actual []string
+			for _, e := range invalid.OrigErrs() {
+				actual = append(actual, e.(request.ErrInvalidParam).Message())
+			}
+			require.Equal(t, c.invalid, actual)
+		})
+	}
+}
+
+func TestValidateParamsNilInput(t *testing.T) {
+	err := validateParams((*dynamodb.QueryInput)(nil))
+	require.Error(t, err)
+	require.Equal(t, request.ParamRequiredErrCode, err.(awserr.Error).Code())
+}
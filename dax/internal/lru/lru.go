@@ -16,8 +16,11 @@
 package lru
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
 )
 
 // Lru is a cache which is safe for concurrent access.
@@ -35,9 +38,30 @@ type Lru struct {
 	// Key type which is not comparable. eg. slice
 	KeyMarshaller func(key Key) Key
 
+	// TTL is how long an entry is used before it is loaded again.
+	// Zero means entries do not expire.
+	TTL time.Duration
+
+	// RefreshAhead enables background refreshes of entries about to expire.
+	// An entry used within RefreshAhead of its expiry is returned, and loaded
+	// again in the background. If that load fails the entry is kept until it
+	// expires. Only used with a TTL.
+	RefreshAhead time.Duration
+
+	// OnRefresh, if set, is called with the result of each background refresh
+	// once the cache was updated.
+	OnRefresh func(key Key, err error)
+
+	// Now returns the current time, against which TTLs are checked.
+	// Nil means time.Now.
+	Now func() time.Time
+
 	mu         sync.RWMutex
 	cache      map[Key]*entry
 	head, tail *entry
+	removals   uint64 // incremented by Remove, protected by mu
+	closed     bool   // protected by mu
+	refreshes  sync.WaitGroup
 }
 
 type Key interface{}
@@ -45,9 +69,26 @@ type Key interface{}
 type entry struct {
 	key        Key
 	value      interface{}
+	expires    time.Time // zero if the entry does not expire
+	refreshing int32     // 1 while a background refresh is in flight, accessed atomically
 	prev, next *entry
 }
 
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+func (e *entry) expiresWithin(now time.Time, d time.Duration) bool {
+	return !e.expires.IsZero() && e.expires.Sub(now) < d
+}
+
+func (c *Lru) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
 func (c *Lru) contains(key Key) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -59,6 +100,9 @@ func (c *Lru) lookup(key Key) (*entry, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	v, ok := c.cache[key]
+	if ok && v.expired(c.now()) {
+		return nil, false
+	}
 	return v, ok
 }
 
@@ -69,51 +113,139 @@ func (c *Lru) GetWithContext(ctx aws.Context, okey Key) (interface{}, error) {
 	}
 
 	if en, ok := c.lookup(ikey); ok {
+		if c.RefreshAhead > 0 && en.expiresWithin(c.now(), c.RefreshAhead) && atomic.CompareAndSwapInt32(&en.refreshing, 0, 1) {
+			c.refresh(en, okey)
+		}
 		return en.value, nil
 	}
 
-	v, err := c.loadGroup.do(ikey, func() (interface{}, error) {
+	return c.loadGroup.do(ikey, func() (interface{}, error) {
 		if en, ok := c.lookup(ikey); ok {
 			return en.value, nil
 		}
+		return c.load(ctx, ikey, okey)
+	})
+}
+
+// Peek returns the value cached for okey, if any and not expired, without
+// loading it.
+func (c *Lru) Peek(okey Key) (interface{}, bool) {
+	ikey := okey
+	if c.KeyMarshaller != nil {
+		ikey = c.KeyMarshaller(okey)
+	}
+	if en, ok := c.lookup(ikey); ok {
+		return en.value, true
+	}
+	return nil, false
+}
 
-		val, err := c.LoadFunc(ctx, okey)
+// Loads the entry again in the background. Concurrent loads of the key are shared.
+func (c *Lru) refresh(en *entry, okey Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.refreshes.Add(1)
+	go func() {
+		defer c.refreshes.Done()
+		_, err := c.loadGroup.do(en.key, func() (interface{}, error) {
+			return c.load(nil, en.key, okey)
+		})
 		if err != nil {
-			return nil, err
+			// keep using the entry, the next use refreshes it again
+			atomic.StoreInt32(&en.refreshing, 0)
 		}
-
-		c.mu.Lock()
-		defer c.mu.Unlock()
-		en := &entry{key: ikey, value: val}
-		if c.tail == nil {
-			c.head = en
-			c.tail = en
-		} else {
-			en.prev = c.tail
-			c.tail.next = en
-			c.tail = en
+		if c.OnRefresh != nil {
+			c.OnRefresh(okey, err)
 		}
+	}()
+}
 
-		if c.cache == nil {
-			c.cache = make(map[Key]*entry)
-		}
-		c.cache[ikey] = en
-
-		// Evict oldest entry if over the max.
-		if c.MaxEntries > 0 && len(c.cache) > c.MaxEntries {
-			evict := c.head
-			if evict != nil {
-				delete(c.cache, evict.key)
-				c.head = evict.next
-				if c.head != nil {
-					c.head.prev = nil
-				}
-				evict.next = nil
-			}
-		}
+func (c *Lru) load(ctx aws.Context, ikey, okey Key) (interface{}, error) {
+	c.mu.RLock()
+	removals := c.removals
+	c.mu.RUnlock()
+
+	val, err := c.LoadFunc(ctx, okey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if removals != c.removals {
+		// the value may have been loaded before the key was removed, do not cache it
 		return val, nil
-	})
-	return v, err
+	}
+	if old, ok := c.cache[ikey]; ok {
+		c.unlink(old)
+	}
+	en := &entry{key: ikey, value: val}
+	if c.TTL > 0 {
+		en.expires = c.now().Add(c.TTL)
+	}
+	if c.tail == nil {
+		c.head = en
+		c.tail = en
+	} else {
+		en.prev = c.tail
+		c.tail.next = en
+		c.tail = en
+	}
+
+	if c.cache == nil {
+		c.cache = make(map[Key]*entry)
+	}
+	c.cache[ikey] = en
+
+	// Evict oldest entry if over the max.
+	if c.MaxEntries > 0 && len(c.cache) > c.MaxEntries {
+		if evict := c.head; evict != nil {
+			c.unlink(evict)
+		}
+	}
+	return val, nil
+}
+
+// Close stops background refreshes and waits for those in flight to complete.
+// The cache can still be used, without background refreshes.
+func (c *Lru) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.refreshes.Wait()
+}
+
+// Remove evicts the entry of key, if any. The next Get loads it again.
+func (c *Lru) Remove(okey Key) {
+	ikey := okey
+	if c.KeyMarshaller != nil {
+		ikey = c.KeyMarshaller(okey)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removals++
+	if en, ok := c.cache[ikey]; ok {
+		c.unlink(en)
+	}
+}
+
+// Removes the entry from the cache and the eviction list. Must be called with mu held.
+func (c *Lru) unlink(en *entry) {
+	delete(c.cache, en.key)
+	if en.prev != nil {
+		en.prev.next = en.next
+	} else {
+		c.head = en.next
+	}
+	if en.next != nil {
+		en.next.prev = en.prev
+	} else {
+		c.tail = en.prev
+	}
+	en.prev, en.next = nil, nil
 }
 
 type loader struct {
@@ -120,6 +120,273 @@ func TestLruEvict(t *testing.T) {
 	}
 }
 
+func TestLruRemove(t *testing.T) {
+	loads := 0
+	c := &Lru{
+		MaxEntries: 3,
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			loads++
+			return fmt.Sprintf("%v-%d", key, loads), nil
+		},
+	}
+	for i := 0; i < 3; i++ {
+		c.GetWithContext(nil, i)
+	}
+
+	// remove the middle, the head and the tail of the eviction list
+	for _, k := range []int{1, 0, 2} {
+		c.Remove(k)
+		if c.contains(k) {
+			t.Fatalf("Lru.contains(%v) want false", k)
+		}
+	}
+	c.Remove(42) // absent key
+
+	for i := 0; i < 3; i++ {
+		v, err := c.GetWithContext(nil, i)
+		if err != nil {
+			t.Fatalf("Lru.Get(%v) got error %v", i, err)
+		}
+		if want := fmt.Sprintf("%v-%d", i, i+4); v != want {
+			t.Fatalf("Lru.Get(%v) got %v want %v", i, v, want)
+		}
+	}
+	// eviction still drops the oldest entry
+	c.GetWithContext(nil, 3)
+	if c.contains(0) || !c.contains(1) || !c.contains(2) || !c.contains(3) {
+		t.Fatalf("unexpected entries after eviction")
+	}
+}
+
+func TestLruRemoveDuringLoad(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	var loads int32
+	c := &Lru{
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			if atomic.AddInt32(&loads, 1) == 1 {
+				close(loading)
+				<-release
+				return "stale", nil
+			}
+			return "fresh", nil
+		},
+	}
+
+	done := make(chan interface{})
+	go func() {
+		v, _ := c.GetWithContext(nil, "k")
+		done <- v
+	}()
+	<-loading
+	c.Remove("k")
+	close(release)
+	if v := <-done; v != "stale" {
+		t.Fatalf("Lru.Get got %v want stale", v)
+	}
+
+	// the value loaded before Remove is not cached
+	if v, _ := c.GetWithContext(nil, "k"); v != "fresh" {
+		t.Fatalf("Lru.Get got %v want fresh", v)
+	}
+}
+
+// A manually advanced time, for Lru.Now.
+type fakeTime struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeTime() *fakeTime {
+	return &fakeTime{now: time.Unix(1000000000, 0)}
+}
+
+func (f *fakeTime) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeTime) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+func TestLruTTL(t *testing.T) {
+	loads := 0
+	clock := newFakeTime()
+	c := &Lru{
+		TTL: 20 * time.Millisecond,
+		Now: clock.Now,
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			loads++
+			return loads, nil
+		},
+	}
+
+	if v, _ := c.GetWithContext(nil, "k"); v != 1 {
+		t.Fatalf("Lru.Get got %v want 1", v)
+	}
+	if v, _ := c.GetWithContext(nil, "k"); v != 1 {
+		t.Fatalf("Lru.Get got %v want 1 before expiry", v)
+	}
+	clock.Advance(19 * time.Millisecond)
+	if v, _ := c.GetWithContext(nil, "k"); v != 1 {
+		t.Fatalf("Lru.Get got %v want 1 right before expiry", v)
+	}
+	clock.Advance(time.Millisecond)
+	if v, _ := c.GetWithContext(nil, "k"); v != 2 {
+		t.Fatalf("Lru.Get got %v want 2 after expiry", v)
+	}
+	if len(c.cache) != 1 || c.head != c.tail {
+		t.Fatalf("expected the expired entry to be replaced")
+	}
+}
+
+func TestLruPeek(t *testing.T) {
+	loads := 0
+	clock := newFakeTime()
+	c := &Lru{
+		TTL: 20 * time.Millisecond,
+		Now: clock.Now,
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			loads++
+			return loads, nil
+		},
+	}
+
+	if v, ok := c.Peek("k"); ok {
+		t.Fatalf("Lru.Peek got %v before the entry was loaded", v)
+	}
+	if loads != 0 {
+		t.Fatalf("Lru.Peek loaded the entry")
+	}
+	c.GetWithContext(nil, "k")
+	if v, ok := c.Peek("k"); !ok || v != 1 {
+		t.Fatalf("Lru.Peek got %v, %v want 1, true", v, ok)
+	}
+	clock.Advance(20 * time.Millisecond)
+	if v, ok := c.Peek("k"); ok {
+		t.Fatalf("Lru.Peek got %v after expiry", v)
+	}
+	if loads != 1 {
+		t.Fatalf("Lru.Peek loaded the entry again")
+	}
+}
+
+func TestLruRefreshAhead(t *testing.T) {
+	var loads int32
+	release := make(chan struct{}, 1)
+	clock := newFakeTime()
+	c := &Lru{
+		TTL:          100 * time.Millisecond,
+		RefreshAhead: 80 * time.Millisecond,
+		Now:          clock.Now,
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			n := atomic.AddInt32(&loads, 1)
+			if n > 1 {
+				<-release
+			}
+			return n, nil
+		},
+	}
+	defer c.Close()
+
+	if v, _ := c.GetWithContext(nil, "k"); v != int32(1) {
+		t.Fatalf("Lru.Get got %v want 1", v)
+	}
+	c.GetWithContext(nil, "k")
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("load calls got %v want 1 before RefreshAhead", n)
+	}
+	clock.Advance(30 * time.Millisecond)
+
+	// within RefreshAhead of expiry: served from cache while a single refresh is in flight
+	for i := 0; i < 10; i++ {
+		if v, _ := c.GetWithContext(nil, "k"); v != int32(1) {
+			t.Fatalf("Lru.Get got %v want 1 during refresh", v)
+		}
+	}
+	release <- struct{}{}
+	for deadline := time.Now().Add(time.Second); ; {
+		if v, _ := c.GetWithContext(nil, "k"); v == int32(2) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("entry was not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("load calls got %v want 2", n)
+	}
+}
+
+func TestLruRefreshAheadFailure(t *testing.T) {
+	var loads int32
+	clock := newFakeTime()
+	c := &Lru{
+		TTL:          200 * time.Millisecond,
+		RefreshAhead: 190 * time.Millisecond,
+		Now:          clock.Now,
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			if atomic.AddInt32(&loads, 1) > 1 {
+				return nil, fmt.Errorf("unavailable")
+			}
+			return "valid", nil
+		},
+	}
+	defer c.Close()
+
+	c.GetWithContext(nil, "k")
+	clock.Advance(20 * time.Millisecond)
+	// failed refreshes are retried by the next uses
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&loads) < 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected failed refreshes to be retried, got %d loads", atomic.LoadInt32(&loads))
+		}
+		v, err := c.GetWithContext(nil, "k")
+		if err != nil || v != "valid" {
+			t.Fatalf("Lru.Get got %v, %v want the cached entry", v, err)
+		}
+	}
+
+	// once expired, the error is returned
+	clock.Advance(180 * time.Millisecond)
+	if _, err := c.GetWithContext(nil, "k"); err == nil {
+		t.Fatalf("expected error after expiry")
+	}
+}
+
+func TestLruCloseWaitsForRefreshes(t *testing.T) {
+	var loads int32
+	var refreshing int32
+	c := &Lru{
+		TTL:          time.Hour,
+		RefreshAhead: 2 * time.Hour,
+		LoadFunc: func(ctx aws.Context, key Key) (interface{}, error) {
+			if atomic.AddInt32(&loads, 1) > 1 {
+				time.Sleep(20 * time.Millisecond)
+				atomic.StoreInt32(&refreshing, 1)
+			}
+			return key, nil
+		},
+	}
+	c.GetWithContext(nil, "k")
+	c.GetWithContext(nil, "k") // starts a refresh
+	c.Close()
+	if atomic.LoadInt32(&refreshing) != 1 {
+		t.Fatalf("Close returned before the refresh completed")
+	}
+
+	// no refresh once closed
+	c.GetWithContext(nil, "k")
+	if n := atomic.LoadInt32(&loads); n != 2 {
+		t.Fatalf("load calls got %v want 2", n)
+	}
+}
+
 func TestLruTimeout(t *testing.T) {
 	loadFn := func(ctx aws.Context, key Key) (interface{}, error) {
 		select {
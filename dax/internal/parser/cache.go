@@ -0,0 +1,86 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package parser
+
+import (
+	"sync/atomic"
+
+	"github.com/antlr/antlr4/runtime/Go/antlr"
+	"github.com/aws/aws-dax-go/dax/internal/lru"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ExpressionCache keeps the parse trees of recently used expressions, so that
+// repeated expressions are parsed once. Trees only depend on the expression
+// string: ExpressionAttributeNames and ExpressionAttributeValues are applied
+// every time an expression is encoded, and are never cached.
+// A nil *ExpressionCache parses every expression. It is safe for concurrent use.
+type ExpressionCache struct {
+	lookups, misses int64 // accessed atomically
+
+	trees *lru.Lru
+}
+
+type expressionKey struct {
+	typ        int
+	expression string
+}
+
+// NewExpressionCache returns a cache of up to size expressions, or nil if size is not positive.
+func NewExpressionCache(size int) *ExpressionCache {
+	if size <= 0 {
+		return nil
+	}
+	c := &ExpressionCache{}
+	c.trees = &lru.Lru{
+		MaxEntries: size,
+		LoadFunc: func(ctx aws.Context, key lru.Key) (interface{}, error) {
+			atomic.AddInt64(&c.misses, 1)
+			k := key.(expressionKey)
+			return parseDynamoDbTree(k.typ, k.expression)
+		},
+	}
+	return c
+}
+
+// NewEncoder returns an ExpressionEncoder parsing expressions through the cache.
+func (c *ExpressionCache) NewEncoder(expr map[int]string, subs map[string]*string, vars map[string]*dynamodb.AttributeValue) *ExpressionEncoder {
+	e := NewExpressionEncoder(expr, subs, vars)
+	e.cache = c
+	return e
+}
+
+// Stats returns the number of expressions found in the cache and the number parsed.
+func (c *ExpressionCache) Stats() (hits, misses int64) {
+	if c == nil {
+		return 0, 0
+	}
+	misses = atomic.LoadInt64(&c.misses)
+	return atomic.LoadInt64(&c.lookups) - misses, misses
+}
+
+func (c *ExpressionCache) parse(typ int, expression string) (antlr.Tree, error) {
+	if c == nil {
+		return parseDynamoDbTree(typ, expression)
+	}
+	atomic.AddInt64(&c.lookups, 1)
+	tree, err := c.trees.GetWithContext(nil, expressionKey{typ: typ, expression: expression})
+	if err != nil {
+		return nil, err
+	}
+	return tree.(antlr.Tree), nil
+}
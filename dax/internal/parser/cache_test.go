@@ -0,0 +1,198 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func encodeWith(cache *ExpressionCache, expr map[int]string, subs map[string]*string, vars map[string]*dynamodb.AttributeValue) (map[int][]byte, error) {
+	return cache.NewEncoder(expr, subs, vars).Parse()
+}
+
+func TestExpressionCache_Stats(t *testing.T) {
+	cache := NewExpressionCache(10)
+	expr := map[int]string{
+		KeyConditionExpr: "pk = :v1 and hk < :v2",
+		FilterExpr:       "#a > :v1",
+	}
+	subs := map[string]*string{"#a": aws.String("a")}
+	vars := map[string]*dynamodb.AttributeValue{
+		":v1": {S: aws.String("pkval")},
+		":v2": {N: aws.String("5")},
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := encodeWith(cache, expr, subs, vars); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	hits, misses := cache.Stats()
+	if hits != 4 || misses != 2 {
+		t.Errorf("expected 4 hits and 2 misses, got %d and %d", hits, misses)
+	}
+
+	// the same string is a different expression for each type
+	vars = map[string]*dynamodb.AttributeValue{":v1": {S: aws.String("pkval")}}
+	if _, err := encodeWith(cache, map[int]string{ConditionExpr: "#a > :v1"}, subs, vars); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, misses := cache.Stats(); misses != 3 {
+		t.Errorf("expected 3 misses, got %d", misses)
+	}
+}
+
+func TestExpressionCache_Disabled(t *testing.T) {
+	if c := NewExpressionCache(0); c != nil {
+		t.Errorf("expected nil cache, got %v", c)
+	}
+	var c *ExpressionCache
+	if _, err := encodeWith(c, map[int]string{ProjectionExpr: "a,b"}, nil, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if hits, misses := c.Stats(); hits != 0 || misses != 0 {
+		t.Errorf("expected no stats, got %d hits and %d misses", hits, misses)
+	}
+}
+
+func TestExpressionCache_ValuesNotCached(t *testing.T) {
+	cache := NewExpressionCache(10)
+	expr := map[int]string{
+		KeyConditionExpr: "pk = :v1 and hk < :v2",
+		FilterExpr:       "#a IN (:v1, :v2)",
+	}
+	subs := map[string]*string{"#a": aws.String("a")}
+	var previous map[int][]byte
+	for i := 0; i < 5; i++ {
+		vars := map[string]*dynamodb.AttributeValue{
+			":v1": {S: aws.String("pk" + strconv.Itoa(i))},
+			":v2": {N: aws.String(strconv.Itoa(i))},
+		}
+		expected, err := NewExpressionEncoder(expr, subs, vars).Parse()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		actual, err := encodeWith(cache, expr, subs, vars)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected %v, got %v", expected, actual)
+		}
+		if reflect.DeepEqual(previous, actual) {
+			t.Errorf("expected a different encoding for different values, got %v", actual)
+		}
+		previous = actual
+	}
+
+	// names and values are still validated on every use
+	_, err := encodeWith(cache, expr, subs, map[string]*dynamodb.AttributeValue{":v1": {S: aws.String("pk")}})
+	if err == nil {
+		t.Errorf("expected error for missing value")
+	}
+	_, err = encodeWith(cache, expr, nil, map[string]*dynamodb.AttributeValue{":v1": {S: aws.String("pk")}, ":v2": {N: aws.String("1")}})
+	if err == nil {
+		t.Errorf("expected error for missing name")
+	}
+}
+
+func TestExpressionCache_ErrorsNotCached(t *testing.T) {
+	cache := NewExpressionCache(10)
+	expr := map[int]string{FilterExpr: "a >"}
+	for i := 0; i < 2; i++ {
+		_, err := encodeWith(cache, expr, nil, nil)
+		expected, _ := NewExpressionEncoder(expr, nil, nil).Parse()
+		if err == nil || expected != nil {
+			t.Fatalf("expected error")
+		}
+	}
+	if _, misses := cache.Stats(); misses != 2 {
+		t.Errorf("expected invalid expression to be parsed every time, got %d misses", misses)
+	}
+}
+
+func TestExpressionCache_Concurrent(t *testing.T) {
+	cache := NewExpressionCache(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				expr := map[int]string{
+					KeyConditionExpr: fmt.Sprintf("pk = :v and hk%d < :v", i%6),
+				}
+				vars := map[string]*dynamodb.AttributeValue{":v": {N: aws.String(strconv.Itoa(g*1000 + i))}}
+				expected, err := NewExpressionEncoder(expr, nil, vars).Parse()
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+					return
+				}
+				actual, err := encodeWith(cache, expr, nil, vars)
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+					return
+				}
+				if !bytes.Equal(expected[KeyConditionExpr], actual[KeyConditionExpr]) {
+					t.Errorf("expected %v, got %v", expected, actual)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func benchmarkRepeatedQuery(b *testing.B, cache *ExpressionCache) {
+	expr := map[int]string{
+		KeyConditionExpr: "pk = :pk and begins_with(sk, :prefix)",
+		FilterExpr:       "#status IN (:s1, :s2) and attribute_exists(#owner.#name)",
+		ProjectionExpr:   "pk, sk, #status, #owner.#name, tags[0]",
+	}
+	subs := map[string]*string{
+		"#status": aws.String("status"),
+		"#owner":  aws.String("owner"),
+		"#name":   aws.String("name"),
+	}
+	vars := map[string]*dynamodb.AttributeValue{
+		":pk":     {S: aws.String("customer#1")},
+		":prefix": {S: aws.String("order#")},
+		":s1":     {S: aws.String("OPEN")},
+		":s2":     {S: aws.String("PENDING")},
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeWith(cache, expr, subs, vars); err != nil {
+			b.Fatalf("unexpected error %v", err)
+		}
+	}
+}
+
+func BenchmarkRepeatedQuery_Uncached(b *testing.B) {
+	benchmarkRepeatedQuery(b, nil)
+}
+
+func BenchmarkRepeatedQuery_Cached(b *testing.B) {
+	benchmarkRepeatedQuery(b, NewExpressionCache(100))
+}
@@ -49,6 +49,7 @@ type ExpressionEncoder struct {
 	// output
 	encoded        map[int][]byte
 	variableValues []dynamodb.AttributeValue
+	variableNames  []string // names of variableValues, eg: ":v1"
 
 	// book keeping
 	stack             []sexpr
@@ -62,6 +63,8 @@ type ExpressionEncoder struct {
 	// temporary buffer/writer
 	cborWriter *cbor.Writer
 	buf        *bytes.Buffer
+
+	cache *ExpressionCache
 }
 
 func NewExpressionEncoder(expr map[int]string, subs map[string]*string, vars map[string]*dynamodb.AttributeValue) *ExpressionEncoder {
@@ -93,7 +96,7 @@ func (e *ExpressionEncoder) Parse() (map[int][]byte, error) {
 	var err error
 	for k, v := range e.expressions {
 		e.reset(k)
-		if err = walkDynamoDbExpr(k, v, e); err != nil {
+		if err = walkDynamoDbExpr(k, v, e, e.cache); err != nil {
 			return nil, err
 		}
 		if err = e.validate(false); err != nil {
@@ -124,6 +127,7 @@ func (e *ExpressionEncoder) reset(typ int) {
 	e.nestingLevel = 0
 	e.variableIdByName = make(map[string]int)
 	e.variableValues = make([]dynamodb.AttributeValue, 0, len(e.variables))
+	e.variableNames = e.variableNames[:0]
 	e.err = nil
 }
 
@@ -178,8 +182,8 @@ func (e *ExpressionEncoder) fullExpr(typ int, expr []byte) ([]byte, error) {
 
 	if typ != ProjectionExpr {
 		e.cborWriter.WriteArrayHeader(len(e.variableValues))
-		for _, v := range e.variableValues {
-			if err := cbor.EncodeAttributeValue(&v, e.cborWriter); err != nil {
+		for i, v := range e.variableValues {
+			if err := cbor.EncodeAttribute(e.variableNames[i], &v, e.cborWriter); err != nil {
 				return nil, err
 			}
 		}
@@ -551,6 +555,7 @@ func (e *ExpressionEncoder) encodeVariable(l string) sexpr {
 		id = len(e.variableValues)
 		e.variableIdByName[n] = id
 		e.variableValues = append(e.variableValues, *v)
+		e.variableNames = append(e.variableNames, n)
 	}
 	return e.encodeFunction(opVariable, []sexpr{e.encodeId(id)})
 }
@@ -23,6 +23,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
@@ -61,6 +62,12 @@ func TestExpressionEncoder(t *testing.T) {
 			subs: map[string]*string{"#s1": aws.String("k2")},
 			out:  fromHex("0x82018282126261318312626133626B32"),
 		},
+		{
+			typ:  ProjectionExpr,
+			in:   "a.#b[0][12].c",
+			subs: map[string]*string{"#b": aws.String("b")},
+			out:  fromHex("0x820181861261616162D90CFC00D90CFC0C6163"),
+		},
 		{
 			typ: FilterExpr,
 			in:  "a1 = a2",
@@ -264,6 +271,15 @@ func TestExpressionEncoderErrors(t *testing.T) {
 			in:  "a < :v",
 			err: newInvalidParameterError("Invalid FilterExpression: An expression attribute value used in expression is not defined: attribute value :v"),
 		},
+		{
+			typ: ConditionExpr,
+			in:  "a < :v and b = :w",
+			vars: map[string]*dynamodb.AttributeValue{
+				":v": &dynamodb.AttributeValue{N: aws.String("10")},
+				":w": &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{{N: aws.String("1E126")}}},
+			},
+			err: &cbor.NumberError{Path: ":w[0]", Value: "1E126", Reason: "magnitude larger than 9.9999999999999999999999999999999999999E+125"},
+		},
 		{
 			typ: KeyConditionExpr,
 			in:  "a < b[-25]",
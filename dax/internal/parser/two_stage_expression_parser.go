@@ -46,11 +46,16 @@ var errUnexpected = newInvalidParameterError("unexpected error when parsing expr
 // Input that fails the second step is truly syntactically invalid.
 //
 // Antlr use panic/recover as error handling mechanism. Converting it into Go style error.
-func walkDynamoDbExpr(typ int, expression string, listener generated.DynamoDbGrammarListener) (err error) {
+func walkDynamoDbExpr(typ int, expression string, listener generated.DynamoDbGrammarListener, cache *ExpressionCache) (err error) {
 	if expression == "" {
 		return newInvalidParameterError("expression cannot be empty")
 	}
 
+	tree, err := cache.parse(typ, expression)
+	if err != nil {
+		return err
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			var ok bool
@@ -59,16 +64,26 @@ func walkDynamoDbExpr(typ int, expression string, listener generated.DynamoDbGra
 			}
 		}
 	}()
-
-	errList := newErrorListener(typ)
-	tree, err := newDynamoDbParseTree(typ, expression, errList)
-	if err != nil {
-		return err
-	}
 	antlr.ParseTreeWalkerDefault.Walk(listener, tree)
 	return nil
 }
 
+// Parses the expression into a tree which can be walked any number of times, concurrently.
+func parseDynamoDbTree(typ int, expression string) (tree antlr.Tree, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var ok bool
+			tree = nil
+			if err, ok = r.(error); !ok {
+				err = errUnexpected
+			}
+		}
+	}()
+
+	errList := newErrorListener(typ)
+	return newDynamoDbParseTree(typ, expression, errList)
+}
+
 func newDynamoDbParseTree(typ int, expression string, listener antlr.ErrorListener) (tree antlr.Tree, err error) {
 	is := antlr.NewInputStream(expression)
 	lexer := generated.NewDynamoDbGrammarLexer(is)
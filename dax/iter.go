@@ -0,0 +1,71 @@
+//go:build go1.23
+// +build go1.23
+
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"iter"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// QueryItems returns an iterator over the items of every page of the query.
+// Pages are fetched as QueryPagesWithContext does, one at a time as the items
+// of the previous page are consumed, and no more pages are fetched once the
+// iteration stops. An error ends the iteration, after being yielded with a nil item.
+func (d *Dax) QueryItems(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) iter.Seq2[map[string]*dynamodb.AttributeValue, error] {
+	return func(yield func(map[string]*dynamodb.AttributeValue, error) bool) {
+		more := true
+		err := d.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			more = yieldItems(yield, page.Items)
+			return more
+		}, opts...)
+		if err != nil && more {
+			yield(nil, err)
+		}
+	}
+}
+
+// ScanItems returns an iterator over the items of every page of the scan.
+// Pages are fetched as ScanPagesWithContext does, one at a time as the items
+// of the previous page are consumed, and no more pages are fetched once the
+// iteration stops. An error ends the iteration, after being yielded with a nil item.
+func (d *Dax) ScanItems(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) iter.Seq2[map[string]*dynamodb.AttributeValue, error] {
+	return func(yield func(map[string]*dynamodb.AttributeValue, error) bool) {
+		more := true
+		err := d.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+			more = yieldItems(yield, page.Items)
+			return more
+		}, opts...)
+		if err != nil && more {
+			yield(nil, err)
+		}
+	}
+}
+
+// Yields items, returns false if the iteration stopped.
+func yieldItems(yield func(map[string]*dynamodb.AttributeValue, error) bool, items []map[string]*dynamodb.AttributeValue) bool {
+	for _, item := range items {
+		if !yield(item, nil) {
+			return false
+		}
+	}
+	return true
+}
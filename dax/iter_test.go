@@ -0,0 +1,147 @@
+//go:build go1.23
+// +build go1.23
+
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestQueryItems(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+
+	var items []map[string]*dynamodb.AttributeValue
+	for item, err := range db.QueryItems(context.Background(), &dynamodb.QueryInput{TableName: aws.String("tablename")}) {
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		items = append(items, item)
+	}
+	if e, a := allTestItems(0, 5), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 3, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
+
+func TestQueryItems_Break(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+
+	var items []map[string]*dynamodb.AttributeValue
+	for item, err := range db.QueryItems(context.Background(), &dynamodb.QueryInput{TableName: aws.String("tablename")}) {
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		items = append(items, item)
+		if len(items) == 3 {
+			break
+		}
+	}
+	if e, a := allTestItems(0, 3), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 2, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect no page fetched after the break, got %v requests", a)
+	}
+
+	// breaking on the last item of a page does not fetch the next page either
+	stub = client.NewClientStub(nil, queryPages(5, 2), nil)
+	db = NewWithInternalClient(stub)
+	n := 0
+	for _, err := range db.QueryItems(context.Background(), &dynamodb.QueryInput{TableName: aws.String("tablename")}) {
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if n++; n == 2 {
+			break
+		}
+	}
+	if e, a := 1, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
+
+func TestScanItems_Empty(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, []*dynamodb.ScanOutput{{Count: aws.Int64(0)}})
+	db := NewWithInternalClient(stub)
+	for item, err := range db.ScanItems(context.Background(), &dynamodb.ScanInput{TableName: aws.String("tablename")}) {
+		t.Errorf("expect no item, got %v, %v", item, err)
+	}
+	if e, a := 1, len(stub.GetScanRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
+
+func TestScanItems_Error(t *testing.T) {
+	failure := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	resps := []*dynamodb.ScanOutput{
+		{Items: allTestItems(0, 2), LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key1")}}},
+		{Items: allTestItems(2, 4)},
+	}
+	stub := client.NewClientStub(nil, nil, resps)
+	stub.SetScanErrors(nil, failure)
+	db := NewWithInternalClient(stub)
+
+	var items []map[string]*dynamodb.AttributeValue
+	var errs []error
+	for item, err := range db.ScanItems(context.Background(), &dynamodb.ScanInput{TableName: aws.String("tablename")}) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		items = append(items, item)
+	}
+	if e, a := allTestItems(0, 2), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := []error{failure}, errs; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect the error once, got %v", a)
+	}
+}
+
+func ExampleDax_QueryItems() {
+	db, err := New(DefaultConfig())
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("orders"),
+		KeyConditionExpression:    aws.String("customer = :c"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":c": {S: aws.String("customer#1")}},
+	}
+	for item, err := range db.QueryItems(context.Background(), input) {
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Println(aws.StringValue(item["order"].S))
+	}
+}
@@ -0,0 +1,55 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ResponseMetadata describes how a request was served by the cluster: its
+// operation, the correlation ID generated by the client for the request, also
+// written to its debug logs, the node of its last attempt and its availability
+// zone, the number of attempts made, the time elapsed, and the request ID
+// returned by the cluster with an error, if any.
+type ResponseMetadata = client.ResponseMetadata
+
+// WithResponseMetadata returns a request.Option filling md once the request
+// sent to the cluster completes, successfully or not. md is left unchanged by
+// requests sent to Config.Fallback, failing before they are sent, or served by
+// a concurrent GetItem they were coalesced with.
+func WithResponseMetadata(md *ResponseMetadata) request.Option {
+	return func(r *request.Request) {
+		r.SetContext(client.WithResponseMetadata(r.Context(), md))
+	}
+}
+
+// ResponseMetadataFrom returns the metadata of the request failing with err,
+// if err, or an error it wraps, is a RequestError, see Config.DetailedErrors.
+func ResponseMetadataFrom(err error) (ResponseMetadata, bool) {
+	for err != nil {
+		if rerr, ok := err.(*RequestError); ok {
+			return ResponseMetadata{Op: rerr.Op, CorrelationID: rerr.CorrelationID, Node: rerr.Node, Attempts: rerr.Attempts, Elapsed: rerr.Elapsed, RequestID: rerr.RequestID()}, true
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			break
+		}
+		err = aerr.OrigErr()
+	}
+	return ResponseMetadata{}, false
+}
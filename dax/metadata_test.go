@@ -0,0 +1,45 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestResponseMetadataFrom(t *testing.T) {
+	rerr := &RequestError{
+		Op:            "GetItem",
+		CorrelationID: "id",
+		Node:          "127.0.0.1:8111",
+		Attempts:      3,
+		Err:           awserr.NewRequestFailure(awserr.New("ec", "msg", nil), 400, "rid"),
+	}
+	expect := ResponseMetadata{Op: "GetItem", CorrelationID: "id", Node: "127.0.0.1:8111", Attempts: 3, RequestID: "rid"}
+	for _, err := range []error{rerr, &BatchWriteError{Err: rerr}} {
+		md, ok := ResponseMetadataFrom(err)
+		if !ok || md != expect {
+			t.Errorf("expect %v, got %v, %v", expect, md, ok)
+		}
+	}
+	for _, err := range []error{nil, errors.New("failed"), ErrClientClosed} {
+		if md, ok := ResponseMetadataFrom(err); ok {
+			t.Errorf("expect no metadata from %v, got %v", err, md)
+		}
+	}
+}
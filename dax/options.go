@@ -0,0 +1,156 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// Options are the settings of a client created by NewFromConfig. They are
+// initialized from DefaultConfig merged with the aws.Config, then modified
+// by the option functions.
+type Options struct {
+	// Endpoints are the "host:port" or "dax://host:port" addresses of the
+	// cluster, see Config.HostPorts.
+	Endpoints   []string
+	Region      string
+	Credentials *credentials.Credentials
+
+	// Default request options, see Config.
+	RequestTimeout time.Duration
+	WriteRetries   int
+	ReadRetries    int
+
+	Logger   aws.Logger
+	LogLevel aws.LogLevelType
+
+	// TLS of the connections to an encrypted cluster, see Config.
+	SkipHostnameVerification bool
+	DialContext              func(ctx context.Context, network string, address string) (net.Conn, error)
+}
+
+// NewFromConfig creates a new instance of the DAX client from an aws.Config,
+// modified by optFns. Only configurations relevant to DAX are used, others are
+// ignored, as for NewWithSession.
+// The returned client must be closed with Close when no longer used.
+//
+// Example:
+//
+//	svc, err := dax.NewFromConfig(aws.Config{Region: aws.String("us-east-1")}, func(o *dax.Options) {
+//		o.Endpoints = []string{"dax://mycluster.frfx8h.clustercfg.dax.usw2.amazonaws.com:8111"}
+//		o.RequestTimeout = 5 * time.Second
+//	})
+func NewFromConfig(cfg aws.Config, optFns ...func(*Options)) (*Dax, error) {
+	return New(configFromOptions(cfg, optFns...))
+}
+
+// Returns the Config of NewFromConfig.
+func configFromOptions(cfg aws.Config, optFns ...func(*Options)) Config {
+	dc := DefaultConfig()
+	dc.mergeFrom(cfg)
+	o := Options{
+		Endpoints:                dc.HostPorts,
+		Region:                   dc.Region,
+		Credentials:              dc.Credentials,
+		RequestTimeout:           dc.RequestTimeout,
+		WriteRetries:             dc.WriteRetries,
+		ReadRetries:              dc.ReadRetries,
+		Logger:                   dc.Logger,
+		LogLevel:                 dc.LogLevel,
+		SkipHostnameVerification: dc.SkipHostnameVerification,
+		DialContext:              dc.DialContext,
+	}
+	for _, fn := range optFns {
+		fn(&o)
+	}
+	dc.HostPorts = o.Endpoints
+	dc.Region = o.Region
+	dc.Credentials = o.Credentials
+	dc.RequestTimeout = o.RequestTimeout
+	dc.WriteRetries = o.WriteRetries
+	dc.ReadRetries = o.ReadRetries
+	dc.Logger = o.Logger
+	dc.LogLevel = o.LogLevel
+	dc.SkipHostnameVerification = o.SkipHostnameVerification
+	dc.DialContext = o.DialContext
+	return dc
+}
+
+// EffectiveConfig describes the configuration of a client in use, e.g. to log
+// it at startup. Credentials are redacted.
+type EffectiveConfig struct {
+	// Endpoints are the configured addresses of the cluster, and Nodes the
+	// "host:port" addresses of its nodes in use, of the secondary cluster after
+	// a failover.
+	Endpoints []string
+	Nodes     []string
+	Region    string
+	// Credentials is "REDACTED" if credentials are configured, and empty
+	// otherwise.
+	Credentials string
+
+	// Encrypted is whether connections use TLS.
+	Encrypted                bool
+	SkipHostnameVerification bool
+
+	RequestTimeout time.Duration
+	WriteRetries   int
+	ReadRetries    int
+
+	MaxPendingConnectionsPerHost int
+	MaxConcurrentRequests        int
+	AcquireTimeout               time.Duration
+	PipelineDepth                int
+	ClusterUpdateInterval        time.Duration
+	HealthCheckInterval          time.Duration
+
+	LogLevel aws.LogLevelType
+}
+
+// EffectiveConfig returns the configuration of the client. The returned value
+// is a copy: modifying it has no effect on the client.
+func (d *Dax) EffectiveConfig() EffectiveConfig {
+	c := EffectiveConfig{
+		Endpoints:                    append([]string(nil), d.config.HostPorts...),
+		Region:                       d.config.Region,
+		SkipHostnameVerification:     d.config.SkipHostnameVerification,
+		RequestTimeout:               d.config.RequestTimeout,
+		WriteRetries:                 d.config.WriteRetries,
+		ReadRetries:                  d.config.ReadRetries,
+		MaxPendingConnectionsPerHost: d.config.MaxPendingConnectionsPerHost,
+		MaxConcurrentRequests:        d.config.MaxConcurrentRequests,
+		AcquireTimeout:               d.config.AcquireTimeout,
+		PipelineDepth:                d.config.PipelineDepth,
+		ClusterUpdateInterval:        d.config.ClusterUpdateInterval,
+		HealthCheckInterval:          d.config.HealthCheckInterval,
+		LogLevel:                     d.config.LogLevel,
+	}
+	if d.config.Credentials != nil {
+		c.Credentials = "REDACTED"
+	}
+	if n, ok := d.client.(interface{ Nodes() []string }); ok {
+		c.Nodes = n.Nodes()
+	}
+	if e, ok := d.client.(interface{ Encrypted() bool }); ok {
+		c.Encrypted = e.Encrypted()
+	}
+	return c
+}
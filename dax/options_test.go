@@ -0,0 +1,130 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	creds := credentials.NewStaticCredentials("id", "secret", "")
+	cfg := aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String("127.0.0.1:8111"),
+		Credentials: creds,
+		MaxRetries:  aws.Int(5),
+	}
+
+	d, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer d.Close()
+	if !reflect.DeepEqual([]string{"127.0.0.1:8111"}, d.config.HostPorts) || d.config.Region != "us-west-2" || d.config.Credentials != creds {
+		t.Errorf("expect the cluster of the aws.Config, got %v %v", d.config.HostPorts, d.config.Region)
+	}
+	if d.config.ReadRetries != 5 || d.config.WriteRetries != 5 {
+		t.Errorf("expect 5 retries, got %d and %d", d.config.ReadRetries, d.config.WriteRetries)
+	}
+	if d.config.RequestTimeout != DefaultConfig().RequestTimeout {
+		t.Errorf("expect the default request timeout, got %v", d.config.RequestTimeout)
+	}
+
+	// the option functions apply in order, over the aws.Config
+	dial := func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return nil, errors.New("unreachable")
+	}
+	d2, err := NewFromConfig(cfg, func(o *Options) {
+		if o.ReadRetries != 5 || o.Region != "us-west-2" {
+			t.Errorf("expect options merged from the aws.Config, got %+v", o)
+		}
+		o.Endpoints = []string{"127.0.0.1:8112"}
+		o.ReadRetries = 1
+		o.RequestTimeout = time.Second
+	}, func(o *Options) {
+		o.RequestTimeout = 3 * time.Second
+		o.LogLevel = aws.LogDebug
+		o.SkipHostnameVerification = true
+		o.DialContext = dial
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer d2.Close()
+	if !reflect.DeepEqual([]string{"127.0.0.1:8112"}, d2.config.HostPorts) {
+		t.Errorf("expect the endpoints of the options, got %v", d2.config.HostPorts)
+	}
+	if d2.config.ReadRetries != 1 || d2.config.WriteRetries != 5 {
+		t.Errorf("expect 1 read and 5 write retries, got %d and %d", d2.config.ReadRetries, d2.config.WriteRetries)
+	}
+	if d2.config.RequestTimeout != 3*time.Second || d2.config.LogLevel != aws.LogDebug || !d2.config.SkipHostnameVerification || d2.config.DialContext == nil {
+		t.Errorf("expect the last options to apply, got %+v", d2.config)
+	}
+
+	// the configuration is validated as by New
+	if _, err := NewFromConfig(aws.Config{Endpoint: aws.String("127.0.0.1:8111")}); err == nil {
+		t.Errorf("expect an error without a region")
+	}
+}
+
+func TestDax_EffectiveConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.Credentials = credentials.NewStaticCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI", "token")
+	cfg.MaxConcurrentRequests = 50
+	cfg.ReadRetries = 4
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer d.Close()
+
+	ec := d.EffectiveConfig()
+	if ec.Credentials != "REDACTED" {
+		t.Errorf("expect redacted credentials, got %q", ec.Credentials)
+	}
+	for _, secret := range []string{"AKIDEXAMPLE", "wJalrXUtnFEMI", "token"} {
+		if s := fmt.Sprintf("%+v", ec); strings.Contains(s, secret) {
+			t.Errorf("expect no %s in %s", secret, s)
+		}
+	}
+	if !reflect.DeepEqual([]string{"127.0.0.1:8111"}, ec.Endpoints) || ec.Region != "us-west-2" || ec.Encrypted {
+		t.Errorf("unexpected cluster %+v", ec)
+	}
+	if ec.MaxConcurrentRequests != 50 || ec.ReadRetries != 4 || ec.WriteRetries != 2 || ec.RequestTimeout != time.Minute {
+		t.Errorf("unexpected settings %+v", ec)
+	}
+
+	ec.Endpoints[0] = "127.0.0.1:9999"
+	ec.ReadRetries = 0
+	if again := d.EffectiveConfig(); again.Endpoints[0] != "127.0.0.1:8111" || again.ReadRetries != 4 {
+		t.Errorf("expect the client unaffected by changes of the copy, got %+v", again)
+	}
+	if d.config.HostPorts[0] != "127.0.0.1:8111" {
+		t.Errorf("expect the client unaffected by changes of the copy, got %v", d.config.HostPorts)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// QueryPagesWithMaxItems is like QueryPagesWithContext, but delivers at most
+// maxItems items over all the pages. Zero or less means no limit.
+//
+// The Limit of each request is lowered to the number of items still to be
+// delivered, so that no more items than needed are read. A Limit set on input
+// still bounds each page, and as with any Limit, a page filtered by a
+// FilterExpression may hold less items than requested. Once maxItems items
+// were delivered, the page delivering the last of them is passed to fn with
+// lastPage set and no further page is requested. That page is truncated if it
+// holds more items than needed, in which case its LastEvaluatedKey does not
+// follow the last item delivered.
+func (d *Dax) QueryPagesWithMaxItems(ctx aws.Context, input *dynamodb.QueryInput, maxItems int, fn func(*dynamodb.QueryOutput, bool) bool, opts ...request.Option) error {
+	if maxItems <= 0 {
+		return d.QueryPagesWithContext(ctx, input, fn, opts...)
+	}
+	if d.isClosed() {
+		return ErrClientClosed
+	}
+	p := NewQueryPaginator(d, input, opts...)
+	limit := p.input.Limit
+	remaining := int64(maxItems)
+	for p.HasMorePages() {
+		p.input.Limit = pageLimit(limit, remaining)
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if int64(len(page.Items)) > remaining {
+			truncated := *page
+			truncated.Items = page.Items[:remaining]
+			truncated.Count = aws.Int64(remaining)
+			page = &truncated
+		}
+		remaining -= int64(len(page.Items))
+		if !fn(page, !p.HasMorePages() || remaining == 0) || remaining == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// ScanPagesWithMaxItems is like ScanPagesWithContext, but delivers at most
+// maxItems items over all the pages. Zero or less means no limit.
+//
+// The Limit of each request is lowered to the number of items still to be
+// delivered, so that no more items than needed are read. A Limit set on input
+// still bounds each page, and as with any Limit, a page filtered by a
+// FilterExpression may hold less items than requested. Once maxItems items
+// were delivered, the page delivering the last of them is passed to fn with
+// lastPage set and no further page is requested. That page is truncated if it
+// holds more items than needed, in which case its LastEvaluatedKey does not
+// follow the last item delivered.
+func (d *Dax) ScanPagesWithMaxItems(ctx aws.Context, input *dynamodb.ScanInput, maxItems int, fn func(*dynamodb.ScanOutput, bool) bool, opts ...request.Option) error {
+	if maxItems <= 0 {
+		return d.ScanPagesWithContext(ctx, input, fn, opts...)
+	}
+	if d.isClosed() {
+		return ErrClientClosed
+	}
+	p := NewScanPaginator(d, input, opts...)
+	limit := p.input.Limit
+	remaining := int64(maxItems)
+	for p.HasMorePages() {
+		p.input.Limit = pageLimit(limit, remaining)
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if int64(len(page.Items)) > remaining {
+			truncated := *page
+			truncated.Items = page.Items[:remaining]
+			truncated.Count = aws.Int64(remaining)
+			page = &truncated
+		}
+		remaining -= int64(len(page.Items))
+		if !fn(page, !p.HasMorePages() || remaining == 0) || remaining == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// Returns the Limit of the next page, the smaller of limit and remaining.
+func pageLimit(limit *int64, remaining int64) *int64 {
+	if limit != nil && *limit > 0 && *limit < remaining {
+		return limit
+	}
+	return aws.Int64(remaining)
+}
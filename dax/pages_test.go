@@ -0,0 +1,142 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestQueryPagesWithMaxItems(t *testing.T) {
+	cases := []struct {
+		name     string
+		limit    *int64
+		maxItems int
+		pages    []*dynamodb.QueryOutput
+		items    int
+		limits   []int64
+		lasts    []bool
+	}{
+		{
+			name:     "within a page",
+			maxItems: 3,
+			pages:    queryPages(10, 3),
+			items:    3,
+			limits:   []int64{3},
+			lasts:    []bool{true},
+		},
+		{
+			name:     "per page limit",
+			limit:    aws.Int64(2),
+			maxItems: 5,
+			pages:    queryPages(10, 2),
+			items:    5,
+			limits:   []int64{2, 2, 1},
+			lasts:    []bool{false, false, true},
+		},
+		{
+			name:     "larger page truncated",
+			maxItems: 3,
+			pages:    queryPages(10, 5),
+			items:    3,
+			limits:   []int64{3},
+			lasts:    []bool{true},
+		},
+		{
+			name:     "less items than max",
+			maxItems: 10,
+			pages:    queryPages(5, 2),
+			items:    5,
+			limits:   []int64{10, 8, 6},
+			lasts:    []bool{false, false, true},
+		},
+		{
+			name:   "no max",
+			limit:  aws.Int64(2),
+			pages:  queryPages(5, 2),
+			items:  5,
+			limits: []int64{2, 2, 2},
+			lasts:  []bool{false, false, true},
+		},
+	}
+	for _, c := range cases {
+		stub := client.NewClientStub(nil, c.pages, nil)
+		db := NewWithInternalClient(stub)
+		input := &dynamodb.QueryInput{TableName: aws.String("tablename"), Limit: c.limit}
+
+		var items []map[string]*dynamodb.AttributeValue
+		var lasts []bool
+		err := db.QueryPagesWithMaxItems(nil, input, c.maxItems, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			if e, a := int64(len(page.Items)), aws.Int64Value(page.Count); e != a {
+				t.Errorf("%s: expect count %v, got %v", c.name, e, a)
+			}
+			items = append(items, page.Items...)
+			lasts = append(lasts, lastPage)
+			return true
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+			continue
+		}
+		if e, a := allTestItems(0, c.items), items; !reflect.DeepEqual(e, a) {
+			t.Errorf("%s: expect %v, got %v", c.name, e, a)
+		}
+		if e, a := c.lasts, lasts; !reflect.DeepEqual(e, a) {
+			t.Errorf("%s: expect lastPage %v, got %v", c.name, e, a)
+		}
+		var limits []int64
+		for _, r := range stub.GetQueryRequests() {
+			limits = append(limits, aws.Int64Value(r.Limit))
+		}
+		if e, a := c.limits, limits; !reflect.DeepEqual(e, a) {
+			t.Errorf("%s: expect request limits %v, got %v", c.name, e, a)
+		}
+		if e, a := c.limit, input.Limit; !reflect.DeepEqual(e, a) {
+			t.Errorf("%s: expect input limit unchanged, got %v", c.name, a)
+		}
+	}
+}
+
+func TestScanPagesWithMaxItems_Stop(t *testing.T) {
+	var pages []*dynamodb.ScanOutput
+	for _, p := range queryPages(10, 2) {
+		pages = append(pages, &dynamodb.ScanOutput{Items: p.Items, Count: p.Count, LastEvaluatedKey: p.LastEvaluatedKey})
+	}
+	stub := client.NewClientStub(nil, nil, pages)
+	db := NewWithInternalClient(stub)
+
+	var items []map[string]*dynamodb.AttributeValue
+	err := db.ScanPagesWithMaxItems(nil, &dynamodb.ScanInput{TableName: aws.String("tablename")}, 7, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		items = append(items, page.Items...)
+		return len(items) < 4
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := allTestItems(0, 4), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 2, len(stub.GetScanRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+	if e, a := int64(5), aws.Int64Value(stub.GetScanRequests()[1].Limit); e != a {
+		t.Errorf("expect limit %v, got %v", e, a)
+	}
+}
@@ -316,3 +316,68 @@ func TestPaginationScanPage(t *testing.T) {
 		}
 	}
 }
+
+func TestPaginationQueryPageEmptyLastPage(t *testing.T) {
+	resps := []*dynamodb.QueryOutput{
+		{
+			LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key1")}},
+			Count:            aws.Int64(1),
+			Items:            []map[string]*dynamodb.AttributeValue{{"key": {S: aws.String("key1")}}},
+		},
+		{
+			Count: aws.Int64(0),
+		},
+	}
+
+	stub := client.NewClientStub(nil, resps, nil)
+	db := NewWithInternalClient(stub)
+	var lasts []bool
+	err := db.QueryPages(&dynamodb.QueryInput{TableName: aws.String("tablename")}, func(p *dynamodb.QueryOutput, last bool) bool {
+		lasts = append(lasts, last)
+		return true
+	})
+	if err != nil {
+		t.Errorf("expect nil, %v", err)
+	}
+
+	// As in aws-sdk-go, a page with a LastEvaluatedKey is not the last page,
+	// even when the next page is empty
+	if e, a := []bool{false, true}, lasts; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestPaginationScanPageEmptyLastPage(t *testing.T) {
+	resps := []*dynamodb.ScanOutput{
+		{
+			LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key1")}},
+			Count:            aws.Int64(1),
+			Items:            []map[string]*dynamodb.AttributeValue{{"key": {S: aws.String("key1")}}},
+		},
+		{
+			LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"key": {S: aws.String("key2")}},
+			Count:            aws.Int64(0),
+		},
+		{
+			Count: aws.Int64(0),
+		},
+	}
+
+	stub := client.NewClientStub(nil, nil, resps)
+	db := NewWithInternalClient(stub)
+	var lasts []bool
+	err := db.ScanPages(&dynamodb.ScanInput{TableName: aws.String("tablename")}, func(p *dynamodb.ScanOutput, last bool) bool {
+		lasts = append(lasts, last)
+		return true
+	})
+	if err != nil {
+		t.Errorf("expect nil, %v", err)
+	}
+
+	if e, a := []bool{false, false, true}, lasts; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 3, len(stub.GetScanRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrCodeBatchGetItemStalled is the error code returned by
+// BatchGetItemPaginator.NextPage when the unprocessed keys stopped making progress.
+const ErrCodeBatchGetItemStalled = "BatchGetItemStalled"
+
+// DefaultMaxStalls is the default MaxStalls of a BatchGetItemPaginator.
+const DefaultMaxStalls = 3
+
+// BatchGetItemPaginator pages through the responses of a BatchGetItem request,
+// the next page being the response to the UnprocessedKeys of the previous one.
+//
+// NextPage does not wait between pages, callers throttled by DynamoDB should
+// back off between pages, or use BatchGetItemAll.
+type BatchGetItemPaginator struct {
+	// MaxStalls is the number of consecutive pages returning all the keys they
+	// requested as unprocessed after which NextPage fails with
+	// ErrCodeBatchGetItemStalled. Zero or less means DefaultMaxStalls.
+	MaxStalls int
+
+	d       *Dax
+	input   *dynamodb.BatchGetItemInput
+	opts    []request.Option
+	next    map[string]*dynamodb.KeysAndAttributes
+	started bool
+	stalls  int
+	done    bool
+}
+
+// NewBatchGetItemPaginator returns a paginator for the BatchGetItem request
+// input, executed with d and opts.
+func NewBatchGetItemPaginator(d *Dax, input *dynamodb.BatchGetItemInput, opts ...request.Option) *BatchGetItemPaginator {
+	if input == nil {
+		input = &dynamodb.BatchGetItemInput{}
+	}
+	return &BatchGetItemPaginator{d: d, input: input, opts: opts, next: input.RequestItems}
+}
+
+// HasMorePages returns whether NextPage has a page to fetch: either the first
+// page, or the UnprocessedKeys of the previous page.
+func (p *BatchGetItemPaginator) HasMorePages() bool {
+	return !p.started || (!p.done && len(p.next) > 0)
+}
+
+// NextPage requests the next page. Once it fails, HasMorePages returns false.
+//
+// If ctx is nil, RequestTimeout bounds the request.
+func (p *BatchGetItemPaginator) NextPage(ctx aws.Context) (*dynamodb.BatchGetItemOutput, error) {
+	if !p.HasMorePages() {
+		return nil, errors.New("no more pages")
+	}
+	p.started = true
+
+	in := *p.input
+	in.RequestItems = p.next
+	output, err := p.d.BatchGetItemWithContext(ctx, &in, p.opts...)
+	if err != nil {
+		p.done = true
+		return nil, err
+	}
+
+	next := make(map[string]*dynamodb.KeysAndAttributes)
+	for table, ka := range output.UnprocessedKeys {
+		if ka != nil && len(ka.Keys) > 0 {
+			next[table] = ka
+		}
+	}
+	if len(next) > 0 && sameKeys(p.next, next) {
+		p.stalls++
+		max := p.MaxStalls
+		if max <= 0 {
+			max = DefaultMaxStalls
+		}
+		if p.stalls >= max {
+			p.done = true
+			return output, awserr.New(ErrCodeBatchGetItemStalled, fmt.Sprintf("no key processed in %d consecutive pages", p.stalls), nil)
+		}
+	} else {
+		p.stalls = 0
+	}
+	p.next = next
+	return output, nil
+}
+
+// Returns whether the tables of a and b have the same keys.
+func sameKeys(a, b map[string]*dynamodb.KeysAndAttributes) bool {
+	n := 0
+	for table, ka := range a {
+		if ka == nil || len(ka.Keys) == 0 {
+			continue
+		}
+		n++
+		kb, ok := b[table]
+		if !ok || !reflect.DeepEqual(ka.Keys, kb.Keys) {
+			return false
+		}
+	}
+	return n == len(b)
+}
+
+// QueryPaginator pages through the results of a Query, the next page starting
+// after the LastEvaluatedKey of the previous one.
+//
+// A failed NextPage can be called again to retry the same page.
+type QueryPaginator struct {
+	d       *Dax
+	input   dynamodb.QueryInput
+	opts    []request.Option
+	next    map[string]*dynamodb.AttributeValue
+	started bool
+}
+
+// NewQueryPaginator returns a paginator for the Query input, executed with d
+// and opts. The first page starts after the ExclusiveStartKey of input, if any.
+func NewQueryPaginator(d *Dax, input *dynamodb.QueryInput, opts ...request.Option) *QueryPaginator {
+	p := &QueryPaginator{d: d, opts: opts}
+	if input != nil {
+		p.input = *input
+	}
+	p.next = p.input.ExclusiveStartKey
+	return p
+}
+
+// HasMorePages returns whether NextPage has a page to fetch: either the first
+// page, or the page following a LastEvaluatedKey.
+func (p *QueryPaginator) HasMorePages() bool {
+	return !p.started || len(p.next) > 0
+}
+
+// NextPage requests the next page, with the options of the paginator followed
+// by opts.
+//
+// If ctx is nil, RequestTimeout bounds the request.
+func (p *QueryPaginator) NextPage(ctx aws.Context, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	if !p.HasMorePages() {
+		return nil, errors.New("no more pages")
+	}
+	opts = pageOptions(p.opts, opts)
+	in := p.input
+	in.ExclusiveStartKey = p.next
+	output, err := p.d.QueryWithContext(ctx, &in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.started = true
+	p.next = output.LastEvaluatedKey
+	return output, nil
+}
+
+// ScanPaginator pages through the results of a Scan, the next page starting
+// after the LastEvaluatedKey of the previous one.
+//
+// A failed NextPage can be called again to retry the same page.
+type ScanPaginator struct {
+	d       *Dax
+	input   dynamodb.ScanInput
+	opts    []request.Option
+	next    map[string]*dynamodb.AttributeValue
+	started bool
+}
+
+// NewScanPaginator returns a paginator for the Scan input, executed with d
+// and opts. The first page starts after the ExclusiveStartKey of input, if any.
+func NewScanPaginator(d *Dax, input *dynamodb.ScanInput, opts ...request.Option) *ScanPaginator {
+	p := &ScanPaginator{d: d, opts: opts}
+	if input != nil {
+		p.input = *input
+	}
+	p.next = p.input.ExclusiveStartKey
+	return p
+}
+
+// HasMorePages returns whether NextPage has a page to fetch: either the first
+// page, or the page following a LastEvaluatedKey.
+func (p *ScanPaginator) HasMorePages() bool {
+	return !p.started || len(p.next) > 0
+}
+
+// NextPage requests the next page, with the options of the paginator followed
+// by opts.
+//
+// If ctx is nil, RequestTimeout bounds the request.
+func (p *ScanPaginator) NextPage(ctx aws.Context, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	if !p.HasMorePages() {
+		return nil, errors.New("no more pages")
+	}
+	opts = pageOptions(p.opts, opts)
+	in := p.input
+	in.ExclusiveStartKey = p.next
+	output, err := p.d.ScanWithContext(ctx, &in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.started = true
+	p.next = output.LastEvaluatedKey
+	return output, nil
+}
+
+// Returns the options of the paginator followed by those of the page.
+func pageOptions(opts, page []request.Option) []request.Option {
+	if len(page) == 0 {
+		return opts
+	}
+	return append(append([]request.Option{}, opts...), page...)
+}
@@ -0,0 +1,239 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestBatchGetItemPaginator(t *testing.T) {
+	stub := &batchStub{
+		ClientStub: client.NewClientStub(nil, nil, nil),
+		getOutputs: []*dynamodb.BatchGetItemOutput{
+			batchGetOutput([]string{"a", "b"}, []string{"c", "d", "e"}),
+			batchGetOutput([]string{"c", "d"}, []string{"e"}),
+			batchGetOutput([]string{"e"}, nil),
+		},
+	}
+	db := NewWithInternalClient(stub)
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems:           map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a", "b", "c", "d", "e")}},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+
+	p := NewBatchGetItemPaginator(db, input)
+	var items []map[string]*dynamodb.AttributeValue
+	pages := 0
+	for p.HasMorePages() {
+		out, err := p.NextPage(nil)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		pages++
+		items = append(items, out.Responses["table"]...)
+	}
+	if e, a := 3, pages; e != a {
+		t.Errorf("expect %v pages, got %v", e, a)
+	}
+	if e, a := batchKeys("a", "b", "c", "d", "e"), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	if e, a := 3, len(stub.getInputs); e != a {
+		t.Fatalf("expect %v requests, got %v", e, a)
+	}
+	for i, keys := range [][]map[string]*dynamodb.AttributeValue{batchKeys("a", "b", "c", "d", "e"), batchKeys("c", "d", "e"), batchKeys("e")} {
+		in := stub.getInputs[i]
+		if e, a := keys, in.RequestItems["table"].Keys; !reflect.DeepEqual(e, a) {
+			t.Errorf("expect request %d for %v, got %v", i, e, a)
+		}
+		if e, a := dynamodb.ReturnConsumedCapacityTotal, aws.StringValue(in.ReturnConsumedCapacity); e != a {
+			t.Errorf("expect request %d to return %v capacity, got %v", i, e, a)
+		}
+	}
+	if _, err := p.NextPage(nil); err == nil {
+		t.Errorf("expect an error once there are no more pages")
+	}
+}
+
+func TestBatchGetItemPaginator_Stalled(t *testing.T) {
+	stub := &batchStub{
+		ClientStub: client.NewClientStub(nil, nil, nil),
+		getOutputs: []*dynamodb.BatchGetItemOutput{
+			batchGetOutput([]string{"a"}, []string{"b", "c"}),
+			batchGetOutput(nil, []string{"b", "c"}),
+			batchGetOutput([]string{"b"}, []string{"c"}),
+			batchGetOutput(nil, []string{"c"}),
+			batchGetOutput(nil, []string{"c"}),
+			batchGetOutput(nil, []string{"c"}),
+		},
+	}
+	db := NewWithInternalClient(stub)
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a", "b", "c")}},
+	}
+
+	p := NewBatchGetItemPaginator(db, input)
+	p.MaxStalls = 2
+	var err error
+	pages := 0
+	for p.HasMorePages() {
+		if _, err = p.NextPage(nil); err != nil {
+			break
+		}
+		pages++
+	}
+	aerr, ok := err.(awserr.Error)
+	if !ok || aerr.Code() != ErrCodeBatchGetItemStalled {
+		t.Fatalf("expect %v, got %v", ErrCodeBatchGetItemStalled, err)
+	}
+	// the page making progress resets the stall count
+	if e, a := 4, pages; e != a {
+		t.Errorf("expect %v pages before the error, got %v", e, a)
+	}
+	if p.HasMorePages() {
+		t.Errorf("expect no more pages after a stall")
+	}
+	if e, a := 5, len(stub.getInputs); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
+
+func TestBatchGetItemPaginator_Error(t *testing.T) {
+	stub := &batchStub{
+		ClientStub: client.NewClientStub(nil, nil, nil),
+		getErr:     awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil),
+	}
+	db := NewWithInternalClient(stub)
+
+	p := NewBatchGetItemPaginator(db, &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: batchKeys("a")}},
+	})
+	if _, err := p.NextPage(nil); err != stub.getErr {
+		t.Errorf("expect %v, got %v", stub.getErr, err)
+	}
+	if p.HasMorePages() {
+		t.Errorf("expect no more pages after an error")
+	}
+}
+
+func TestQueryPaginator(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+	startKey := map[string]*dynamodb.AttributeValue{"key": {S: aws.String("start")}}
+	input := &dynamodb.QueryInput{TableName: aws.String("tablename"), ExclusiveStartKey: startKey}
+
+	p := NewQueryPaginator(db, input)
+	var items []map[string]*dynamodb.AttributeValue
+	for p.HasMorePages() {
+		page, err := p.NextPage(nil)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		items = append(items, page.Items...)
+	}
+	if e, a := allTestItems(0, 5), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+
+	reqs := stub.GetQueryRequests()
+	if e, a := 3, len(reqs); e != a {
+		t.Fatalf("expect %v requests, got %v", e, a)
+	}
+	for i, e := range []map[string]*dynamodb.AttributeValue{startKey, queryPages(5, 2)[0].LastEvaluatedKey, queryPages(5, 2)[1].LastEvaluatedKey} {
+		if a := reqs[i].ExclusiveStartKey; !reflect.DeepEqual(e, a) {
+			t.Errorf("expect request %d to start after %v, got %v", i, e, a)
+		}
+	}
+	if e, a := startKey, input.ExclusiveStartKey; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect input unchanged, got %v", a)
+	}
+}
+
+func TestQueryPaginator_PageOptions(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+	retries := func(n int) request.Option {
+		return func(r *request.Request) { r.Config.MaxRetries = aws.Int(n) }
+	}
+
+	p := NewQueryPaginator(db, &dynamodb.QueryInput{TableName: aws.String("tablename")}, retries(5))
+	for _, opts := range [][]request.Option{nil, {retries(1)}, nil} {
+		if _, err := p.NextPage(nil, opts...); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	var a []int
+	for _, o := range stub.GetRequestOptions() {
+		a = append(a, o.MaxRetries)
+	}
+	if e := []int{5, 1, 5}; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect retries %v, got %v", e, a)
+	}
+
+	// without options, pages are read with the ReadRetries of the client
+	stub = client.NewClientStub(nil, queryPages(1, 1), nil)
+	db = NewWithInternalClient(stub)
+	if _, err := NewQueryPaginator(db, &dynamodb.QueryInput{TableName: aws.String("tablename")}).NextPage(nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := db.config.ReadRetries, stub.GetRequestOptions()[0].MaxRetries; e != a {
+		t.Errorf("expect %v retries, got %v", e, a)
+	}
+}
+
+func TestScanPaginator_Retry(t *testing.T) {
+	var pages []*dynamodb.ScanOutput
+	for _, p := range queryPages(4, 2) {
+		pages = append(pages, &dynamodb.ScanOutput{Items: p.Items, Count: p.Count, LastEvaluatedKey: p.LastEvaluatedKey})
+	}
+	stub := client.NewClientStub(nil, nil, pages)
+	failure := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	stub.SetScanErrors(nil, failure)
+	db := NewWithInternalClient(stub)
+
+	p := NewScanPaginator(db, &dynamodb.ScanInput{TableName: aws.String("tablename")})
+	if _, err := p.NextPage(nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := p.NextPage(nil); err != failure {
+		t.Fatalf("expect %v, got %v", failure, err)
+	}
+	if !p.HasMorePages() {
+		t.Fatalf("expect the failed page to be retried")
+	}
+	page, err := p.NextPage(nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := allTestItems(2, 4), page.Items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if p.HasMorePages() {
+		t.Errorf("expect no more pages")
+	}
+	reqs := stub.GetScanRequests()
+	if e, a := reqs[1].ExclusiveStartKey, reqs[2].ExclusiveStartKey; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect the retry to start after %v, got %v", e, a)
+	}
+}
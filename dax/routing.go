@@ -0,0 +1,249 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// Where a request is sent, see Config.TableRouting and Config.EnableDegradedMode.
+type route int
+
+const (
+	routeDAX route = iota
+	routeFallback
+	routeSplit // the request is for tables of both
+)
+
+var errSplitTransaction = awserr.New(request.InvalidParameterErrCode, "a transaction cannot span tables routed to DAX and to the Fallback client", nil)
+
+var errSplitBatchRequest = awserr.New(request.InvalidParameterErrCode, "a batch request for tables routed to DAX and to the Fallback client must be sent with BatchGetItemWithContext or BatchWriteItemWithContext", nil)
+
+// WithDirectDynamoDB returns a request.Option sending the request to
+// Config.Fallback instead of the cluster, bypassing the caches of DAX, e.g. to
+// check the items of a table against the caches. Requests made with it fail
+// with ErrCodeNoFallback if Config.Fallback is not set.
+//
+// The option applies to the requests of the data plane made with their
+// WithContext methods, and to the pagination methods. It is ignored by the
+// requests built by the Request methods, such as GetItemRequest, which are
+// routed before any option is applied to them, and by the requests of a
+// dynamodb.DynamoDB client.
+func WithDirectDynamoDB() request.Option {
+	return func(r *request.Request) {
+		r.SetContext(context.WithValue(r.Context(), directDynamoDBKey{}, true))
+	}
+}
+
+type directDynamoDBKey struct{}
+
+// Returns whether the options hold WithDirectDynamoDB.
+func (o appliedOptions) direct() bool {
+	direct, _ := o.value(directDynamoDBKey{}).(bool)
+	return direct
+}
+
+// Returns where the request of input made with opts is sent: to
+// Config.Fallback if made WithDirectDynamoDB, if all its tables are routed
+// there, or if the cluster is unreachable in degraded mode, and to the cluster
+// otherwise. Requests sent to Config.Fallback in degraded mode are counted.
+func (d *Dax) route(write bool, input interface{}, opts appliedOptions) route {
+	if d.isClosed() {
+		return routeDAX
+	}
+	if opts.direct() {
+		return routeFallback
+	}
+	if d.config.TableRouting == nil {
+		if d.degraded(write) {
+			atomic.AddInt64(&d.degradedRequests, 1)
+			return routeFallback
+		}
+		return routeDAX
+	}
+	tables := client.InputTables(input)
+	direct := 0
+	for _, table := range tables {
+		if !d.config.TableRouting(table) {
+			direct++
+		}
+	}
+	if direct > 0 && direct == len(tables) {
+		return routeFallback
+	}
+	if d.degraded(write) {
+		atomic.AddInt64(&d.degradedRequests, 1)
+		return routeFallback
+	}
+	if direct > 0 {
+		return routeSplit
+	}
+	return routeDAX
+}
+
+// Returns whether the cluster is unreachable and requests are to be sent to
+// Config.Fallback instead. Writes are sent to Config.Fallback only if
+// Config.AllowDegradedWrites is set.
+func (d *Dax) degraded(write bool) bool {
+	if !d.config.EnableDegradedMode || write && !d.config.AllowDegradedWrites {
+		return false
+	}
+	r, ok := d.client.(interface{ Reachable() bool })
+	return ok && !r.Reachable()
+}
+
+// Sends the keys of the tables routed to DAX to the cluster and the others to
+// Config.Fallback at once, and merges both outputs. If either request fails,
+// its error is returned along with the output of the other, in which the keys
+// of the failed request are unprocessed.
+func (d *Dax) batchGetItemSplit(ctx aws.Context, input *dynamodb.BatchGetItemInput, opts []request.Option) (*dynamodb.BatchGetItemOutput, error) {
+	cached, direct := *input, *input
+	cached.RequestItems = make(map[string]*dynamodb.KeysAndAttributes)
+	direct.RequestItems = make(map[string]*dynamodb.KeysAndAttributes)
+	for table, keys := range input.RequestItems {
+		if d.config.TableRouting(table) {
+			cached.RequestItems[table] = keys
+		} else {
+			direct.RequestItems[table] = keys
+		}
+	}
+
+	var directOut *dynamodb.BatchGetItemOutput
+	var directErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		directErr = d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			directOut, err = fallback.BatchGetItemWithContext(ctx, &direct, opts...)
+			return err
+		})
+	}()
+	output, err := d.BatchGetItemWithContext(ctx, &cached, opts...)
+	wg.Wait()
+	if err != nil && directErr != nil {
+		return nil, err
+	}
+	if err != nil {
+		output = &dynamodb.BatchGetItemOutput{UnprocessedKeys: cached.RequestItems}
+	} else if output == nil {
+		output = &dynamodb.BatchGetItemOutput{}
+	}
+	if directErr != nil {
+		err = directErr
+		directOut = &dynamodb.BatchGetItemOutput{UnprocessedKeys: direct.RequestItems}
+	}
+	if directOut == nil {
+		return output, err
+	}
+
+	for table, items := range directOut.Responses {
+		if output.Responses == nil {
+			output.Responses = make(map[string][]map[string]*dynamodb.AttributeValue)
+		}
+		output.Responses[table] = items
+	}
+	for table, keys := range directOut.UnprocessedKeys {
+		if output.UnprocessedKeys == nil {
+			output.UnprocessedKeys = make(map[string]*dynamodb.KeysAndAttributes)
+		}
+		output.UnprocessedKeys[table] = keys
+	}
+	output.ConsumedCapacity = append(output.ConsumedCapacity, directOut.ConsumedCapacity...)
+	return output, err
+}
+
+// Sends the items of the tables routed to DAX to the cluster and the others
+// to Config.Fallback at once, and merges both outputs. If either request
+// fails, its error is returned along with the output of the other, in which
+// the items of the failed request are unprocessed, unless it is a
+// *BatchWriteError holding them.
+func (d *Dax) batchWriteItemSplit(ctx aws.Context, input *dynamodb.BatchWriteItemInput, opts []request.Option) (*dynamodb.BatchWriteItemOutput, error) {
+	cached, direct := *input, *input
+	cached.RequestItems = make(map[string][]*dynamodb.WriteRequest)
+	direct.RequestItems = make(map[string][]*dynamodb.WriteRequest)
+	for table, requests := range input.RequestItems {
+		if d.config.TableRouting(table) {
+			cached.RequestItems[table] = requests
+		} else {
+			direct.RequestItems[table] = requests
+		}
+	}
+
+	var directOut *dynamodb.BatchWriteItemOutput
+	var directErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		directErr = d.sendFallback(ctx, func(fallback dynamodbiface.DynamoDBAPI, ctx aws.Context) (err error) {
+			directOut, err = fallback.BatchWriteItemWithContext(ctx, &direct, opts...)
+			return err
+		})
+	}()
+	output, err := d.BatchWriteItemWithContext(ctx, &cached, opts...)
+	wg.Wait()
+	if err != nil && directErr != nil {
+		return nil, err
+	}
+	if _, partial := err.(*BatchWriteError); err != nil && (!partial || output == nil) {
+		output = &dynamodb.BatchWriteItemOutput{UnprocessedItems: cached.RequestItems}
+	} else if output == nil {
+		output = &dynamodb.BatchWriteItemOutput{}
+	}
+	if directErr != nil {
+		err = directErr
+		directOut = &dynamodb.BatchWriteItemOutput{UnprocessedItems: direct.RequestItems}
+	}
+	if directOut == nil {
+		return output, err
+	}
+
+	for table, requests := range directOut.UnprocessedItems {
+		if output.UnprocessedItems == nil {
+			output.UnprocessedItems = make(map[string][]*dynamodb.WriteRequest)
+		}
+		output.UnprocessedItems[table] = requests
+	}
+	for table, metrics := range directOut.ItemCollectionMetrics {
+		if output.ItemCollectionMetrics == nil {
+			output.ItemCollectionMetrics = make(map[string][]*dynamodb.ItemCollectionMetrics)
+		}
+		output.ItemCollectionMetrics[table] = metrics
+	}
+	output.ConsumedCapacity = append(output.ConsumedCapacity, directOut.ConsumedCapacity...)
+	return output, err
+}
+
+// Returns a request failing with err when sent.
+func newRequestWithError(err error) *request.Request {
+	h := request.Handlers{}
+	h.Build.PushBack(func(r *request.Request) {
+		r.Error = err
+	})
+	clientInfo := metadata.ClientInfo{ServiceName: ServiceName}
+	return request.New(aws.Config{}, clientInfo, h, nil, &request.Operation{Name: "Split"}, nil, nil)
+}
@@ -0,0 +1,319 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returns a client sending the requests for table "hot" to DAX and the others
+// to fallback.
+func newRoutingClient(fallback *fallbackStub) (*Dax, *client.ClientStub) {
+	db, stub := newFallbackClient(fallback, false)
+	db.config.TableRouting = func(table string) bool { return table == "hot" }
+	return db, stub
+}
+
+func routingKey(pk string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"pk": {S: aws.String(pk)}}
+}
+
+func TestTableRouting(t *testing.T) {
+	fallback := &fallbackStub{}
+	db, stub := newRoutingClient(fallback)
+
+	db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("hot"), Key: routingKey("a")})
+	db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("cold"), Key: routingKey("a")})
+	db.PutItem(&dynamodb.PutItemInput{TableName: aws.String("cold"), Item: routingKey("a")})
+	if e, a := 1, len(stub.Requests(client.OpGetItem)); e != a {
+		t.Errorf("expect %d GetItem sent to DAX, got %d", e, a)
+	}
+	if len(stub.Requests(client.OpPutItem)) != 0 {
+		t.Errorf("expect no PutItem sent to DAX")
+	}
+	if len(fallback.gets) != 1 || aws.StringValue(fallback.gets[0].TableName) != "cold" {
+		t.Errorf("expect the GetItem of cold sent to the fallback, got %v", fallback.gets)
+	}
+	if len(fallback.puts) != 1 {
+		t.Errorf("expect the PutItem of cold sent to the fallback, got %v", fallback.puts)
+	}
+	if e, a := int64(0), db.Stats().DegradedRequests; e != a {
+		t.Errorf("expect routed requests not counted as degraded, got %d", a)
+	}
+}
+
+func TestTableRouting_BatchGetItem(t *testing.T) {
+	fallback := &fallbackStub{getOut: &dynamodb.BatchGetItemOutput{
+		Responses:        map[string][]map[string]*dynamodb.AttributeValue{"cold": {routingKey("c")}},
+		UnprocessedKeys:  map[string]*dynamodb.KeysAndAttributes{"cold": {Keys: []map[string]*dynamodb.AttributeValue{routingKey("d")}}},
+		ConsumedCapacity: []*dynamodb.ConsumedCapacity{{TableName: aws.String("cold")}},
+	}}
+	db, stub := newRoutingClient(fallback)
+	stub.AddResponses(client.OpBatchGetItem, &dynamodb.BatchGetItemOutput{
+		Responses:        map[string][]map[string]*dynamodb.AttributeValue{"hot": {routingKey("a"), routingKey("b")}},
+		ConsumedCapacity: []*dynamodb.ConsumedCapacity{{TableName: aws.String("hot")}},
+	})
+
+	hot := &dynamodb.KeysAndAttributes{Keys: []map[string]*dynamodb.AttributeValue{routingKey("a"), routingKey("b")}}
+	cold := &dynamodb.KeysAndAttributes{Keys: []map[string]*dynamodb.AttributeValue{routingKey("c"), routingKey("d")}}
+	input := &dynamodb.BatchGetItemInput{
+		RequestItems:           map[string]*dynamodb.KeysAndAttributes{"hot": hot, "cold": cold},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+	out, err := db.BatchGetItem(input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	reqs := stub.Requests(client.OpBatchGetItem)
+	if len(reqs) != 1 {
+		t.Fatalf("expect 1 BatchGetItem sent to DAX, got %d", len(reqs))
+	}
+	if e, a := map[string]*dynamodb.KeysAndAttributes{"hot": hot}, reqs[0].(*dynamodb.BatchGetItemInput).RequestItems; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v sent to DAX, got %v", e, a)
+	}
+	if len(fallback.batchGets) != 1 {
+		t.Fatalf("expect 1 BatchGetItem sent to the fallback, got %d", len(fallback.batchGets))
+	}
+	direct := fallback.batchGets[0]
+	if e, a := map[string]*dynamodb.KeysAndAttributes{"cold": cold}, direct.RequestItems; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v sent to the fallback, got %v", e, a)
+	}
+	if e, a := dynamodb.ReturnConsumedCapacityTotal, aws.StringValue(direct.ReturnConsumedCapacity); e != a {
+		t.Errorf("expect ReturnConsumedCapacity %s, got %s", e, a)
+	}
+	if len(input.RequestItems) != 2 {
+		t.Errorf("expect the input unchanged, got %v", input.RequestItems)
+	}
+
+	expected := &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]*dynamodb.AttributeValue{
+			"hot":  {routingKey("a"), routingKey("b")},
+			"cold": {routingKey("c")},
+		},
+		UnprocessedKeys:  map[string]*dynamodb.KeysAndAttributes{"cold": {Keys: []map[string]*dynamodb.AttributeValue{routingKey("d")}}},
+		ConsumedCapacity: []*dynamodb.ConsumedCapacity{{TableName: aws.String("hot")}, {TableName: aws.String("cold")}},
+	}
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("expect %v, got %v", expected, out)
+	}
+
+	req, _ := db.BatchGetItemRequest(input)
+	if err := req.Send(); err == nil || err.(awserr.Error).Code() != request.InvalidParameterErrCode {
+		t.Errorf("expect an InvalidParameter error, got %v", err)
+	}
+}
+
+func TestTableRouting_BatchWriteItem(t *testing.T) {
+	put := func(pk string) *dynamodb.WriteRequest {
+		return &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: routingKey(pk)}}
+	}
+	fallback := &fallbackStub{writeOut: &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]*dynamodb.WriteRequest{"cold": {put("d")}},
+	}}
+	db, stub := newRoutingClient(fallback)
+	stub.AddResponses(client.OpBatchWriteItem, &dynamodb.BatchWriteItemOutput{})
+
+	input := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{
+		"hot":  {put("a"), put("b")},
+		"cold": {put("c"), put("d")},
+	}}
+	out, err := db.BatchWriteItem(input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	reqs := stub.Requests(client.OpBatchWriteItem)
+	if len(reqs) != 1 || len(reqs[0].(*dynamodb.BatchWriteItemInput).RequestItems["hot"]) != 2 || len(reqs[0].(*dynamodb.BatchWriteItemInput).RequestItems) != 1 {
+		t.Errorf("expect the items of hot sent to DAX, got %v", reqs)
+	}
+	if len(fallback.batchPuts) != 1 || len(fallback.batchPuts[0].RequestItems["cold"]) != 2 || len(fallback.batchPuts[0].RequestItems) != 1 {
+		t.Errorf("expect the items of cold sent to the fallback, got %v", fallback.batchPuts)
+	}
+	if e, a := fallback.writeOut.UnprocessedItems, out.UnprocessedItems; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect unprocessed items %v, got %v", e, a)
+	}
+}
+
+func TestTableRouting_BatchGetItemSplitFailure(t *testing.T) {
+	throttled := awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil)
+	fallback := &fallbackStub{getErr: throttled}
+	db, stub := newRoutingClient(fallback)
+	stub.AddResponses(client.OpBatchGetItem, &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]*dynamodb.AttributeValue{"hot": {routingKey("a")}},
+	})
+
+	cold := &dynamodb.KeysAndAttributes{Keys: []map[string]*dynamodb.AttributeValue{routingKey("c")}}
+	out, err := db.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{
+		"hot":  {Keys: []map[string]*dynamodb.AttributeValue{routingKey("a")}},
+		"cold": cold,
+	}})
+	if err != throttled {
+		t.Fatalf("expect %v, got %v", throttled, err)
+	}
+	expected := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{"hot": {routingKey("a")}},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{"cold": cold},
+	}
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("expect %v, got %v", expected, out)
+	}
+}
+
+func TestTableRouting_BatchWriteItemSplitFailure(t *testing.T) {
+	put := func(pk string) *dynamodb.WriteRequest {
+		return &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: routingKey(pk)}}
+	}
+	fallback := &fallbackStub{writeOut: &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]*dynamodb.WriteRequest{"cold": {put("d")}},
+	}}
+	db, stub := newRoutingClient(fallback)
+	unavailable := awserr.New(client.ErrCodeServiceUnavailable, "unavailable", nil)
+	stub.SetErrors(client.OpBatchWriteItem, unavailable)
+
+	hot := []*dynamodb.WriteRequest{put("a"), put("b")}
+	out, err := db.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{
+		"hot":  hot,
+		"cold": {put("c"), put("d")},
+	}})
+	if err != unavailable {
+		t.Fatalf("expect %v, got %v", unavailable, err)
+	}
+	expected := map[string][]*dynamodb.WriteRequest{"hot": hot, "cold": {put("d")}}
+	if out == nil || !reflect.DeepEqual(expected, out.UnprocessedItems) {
+		t.Errorf("expect unprocessed items %v, got %v", expected, out)
+	}
+}
+
+func TestTableRouting_Transactions(t *testing.T) {
+	fallback := &fallbackStub{}
+	db, stub := newRoutingClient(fallback)
+
+	mixed := &dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+		{Put: &dynamodb.Put{TableName: aws.String("hot"), Item: routingKey("a")}},
+		{ConditionCheck: &dynamodb.ConditionCheck{TableName: aws.String("cold"), Key: routingKey("b")}},
+	}}
+	if _, err := db.TransactWriteItems(mixed); err == nil || err.(awserr.Error).Code() != request.InvalidParameterErrCode {
+		t.Errorf("expect an InvalidParameter error, got %v", err)
+	}
+	req, _ := db.TransactWriteItemsRequest(mixed)
+	if err := req.Send(); err == nil || err.(awserr.Error).Code() != request.InvalidParameterErrCode {
+		t.Errorf("expect an InvalidParameter error, got %v", err)
+	}
+	mixedGet := &dynamodb.TransactGetItemsInput{TransactItems: []*dynamodb.TransactGetItem{
+		{Get: &dynamodb.Get{TableName: aws.String("cold"), Key: routingKey("a")}},
+		{Get: &dynamodb.Get{TableName: aws.String("hot"), Key: routingKey("b")}},
+	}}
+	if _, err := db.TransactGetItems(mixedGet); err == nil || err.(awserr.Error).Code() != request.InvalidParameterErrCode {
+		t.Errorf("expect an InvalidParameter error, got %v", err)
+	}
+	if len(stub.Requests(client.OpTransactWriteItems)) != 0 || len(stub.Requests(client.OpTransactGetItems)) != 0 {
+		t.Errorf("expect no transaction sent to DAX")
+	}
+
+	hot := &dynamodb.TransactWriteItemsInput{TransactItems: []*dynamodb.TransactWriteItem{
+		{Put: &dynamodb.Put{TableName: aws.String("hot"), Item: routingKey("a")}},
+		{Delete: &dynamodb.Delete{TableName: aws.String("hot"), Key: routingKey("b")}},
+	}}
+	db.TransactWriteItems(hot)
+	if e, a := 1, len(stub.Requests(client.OpTransactWriteItems)); e != a {
+		t.Errorf("expect %d transaction sent to DAX, got %d", e, a)
+	}
+}
+
+func TestTableRouting_Config(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.TableRouting = func(string) bool { return true }
+	if _, err := New(cfg); err == nil {
+		t.Errorf("expect an error routing tables without a Fallback client")
+	}
+}
+
+func TestWithDirectDynamoDB(t *testing.T) {
+	fallback := &fallbackStub{getOut: &dynamodb.BatchGetItemOutput{}, writeOut: &dynamodb.BatchWriteItemOutput{}}
+	db, stub := newFallbackClient(fallback, false)
+	retries := func(r *request.Request) { r.Config.MaxRetries = aws.Int(7) }
+	opts := []request.Option{retries, WithDirectDynamoDB(), WithConsistentRead()}
+	get := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: routingKey("a")}
+
+	if _, err := db.GetItemWithContext(nil, get, opts...); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := db.PutItemWithContext(nil, &dynamodb.PutItemInput{TableName: aws.String("table"), Item: routingKey("a")}, opts...); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	err := db.QueryPagesWithContext(nil, &dynamodb.QueryInput{TableName: aws.String("table")}, func(*dynamodb.QueryOutput, bool) bool { return true }, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	batchGet := &dynamodb.BatchGetItemInput{RequestItems: map[string]*dynamodb.KeysAndAttributes{"table": {Keys: []map[string]*dynamodb.AttributeValue{routingKey("a")}}}}
+	if _, err := db.BatchGetItemWithContext(nil, batchGet, opts...); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	batchWrite := &dynamodb.BatchWriteItemInput{RequestItems: map[string][]*dynamodb.WriteRequest{"table": {{DeleteRequest: &dynamodb.DeleteRequest{Key: routingKey("a")}}}}}
+	if _, err := db.BatchWriteItemWithContext(nil, batchWrite, opts...); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if reqs := len(stub.GetRequestOptions()); reqs != 0 {
+		t.Errorf("expect no request sent to DAX, got %d", reqs)
+	}
+	if len(fallback.gets) != 1 || len(fallback.puts) != 1 || len(fallback.queries) != 2 || len(fallback.batchGets) != 1 || len(fallback.batchPuts) != 1 {
+		t.Errorf("expect every request sent to the fallback, got %d GetItem, %d PutItem, %d Query, %d BatchGetItem, %d BatchWriteItem",
+			len(fallback.gets), len(fallback.puts), len(fallback.queries), len(fallback.batchGets), len(fallback.batchPuts))
+	}
+	for i, o := range fallback.opts {
+		r := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{}, get, nil)
+		r.ApplyOptions(o...)
+		if e, a := 7, aws.IntValue(r.Config.MaxRetries); e != a {
+			t.Errorf("expect the options of the caller passed to request %d, got %v retries", i, a)
+		}
+		if !aws.BoolValue(r.Params.(*dynamodb.GetItemInput).ConsistentRead) {
+			t.Errorf("expect WithConsistentRead passed to request %d", i)
+		}
+	}
+
+	// without the option, requests are sent to DAX
+	db.GetItem(get)
+	if e, a := 1, len(stub.Requests(client.OpGetItem)); e != a {
+		t.Errorf("expect %d GetItem sent to DAX, got %d", e, a)
+	}
+}
+
+func TestWithDirectDynamoDB_NoFallback(t *testing.T) {
+	db, stub := newFallbackClient(nil, false)
+	get := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: routingKey("a")}
+	_, err := db.GetItemWithContext(nil, get, WithDirectDynamoDB())
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNoFallback {
+		t.Errorf("expect %s, got %v", ErrCodeNoFallback, err)
+	}
+	_, err = db.QueryWithContext(nil, &dynamodb.QueryInput{TableName: aws.String("table")}, WithDirectDynamoDB())
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNoFallback {
+		t.Errorf("expect %s, got %v", ErrCodeNoFallback, err)
+	}
+	if reqs := len(stub.GetRequestOptions()); reqs != 0 {
+		t.Errorf("expect no request sent to DAX, got %d", reqs)
+	}
+}
@@ -18,30 +18,198 @@ package dax
 import (
 	"context"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"net"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-dax-go/dax/internal/client"
 	"github.com/aws/aws-dax-go/dax/internal/proxy"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client/metadata"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
 // Dax makes requests to the Amazon DAX API, which conforms to the DynamoDB API.
 //
 // Dax methods are safe to use concurrently
+//
+// A Dax client runs background goroutines to refresh the cluster topology and
+// manage connections. Close must be called once the client is no longer needed
+// to stop them.
 type Dax struct {
 	client client.DaxAPI
 	config Config
+	closed int32
+
+	degradedRequests int64 // accessed atomically
+
+	// backoff of BatchGetItemAll and BatchWriteItemAll, replaced by tests
+	sleep  func(ctx aws.Context, d time.Duration) error // nil means the clock of the client
+	jitter func(n int64) int64                          // nil means rand.Int63n
 }
 
 const ServiceName = "dax"
 
+// ErrCodeClientClosed is the error code of ErrClientClosed.
+const ErrCodeClientClosed = client.ErrCodeClientClosed
+
+// ErrClientClosed is returned by every operation invoked after Close,
+// without any attempt to reach the cluster.
+var ErrClientClosed = client.ErrClientClosed
+
+// ErrCodeOverloaded is the error code of ErrOverloaded.
+const ErrCodeOverloaded = client.ErrCodeOverloaded
+
+// ErrOverloaded is returned when Config.MaxConcurrentRequests requests are in
+// flight and none completed within Config.AcquireTimeout.
+var ErrOverloaded = client.ErrOverloaded
+
+// ErrCodeConnectionFailed is the error code returned to requests pipelined on a
+// connection that broke before their response was read. Such requests are retried.
+const ErrCodeConnectionFailed = client.ErrCodeConnectionFailed
+
+// ErrCodeConnectTimeout is the error code of the attempts failing to connect
+// to a node within Config.ConnectTimeout. Such attempts are retried on another
+// node.
+const ErrCodeConnectTimeout = client.ErrCodeConnectTimeout
+
+// BatchWriteError is returned by BatchWriteItem when some of the requests a
+// BatchWriteItem of more than 25 items was split into failed. It tells the items
+// that may have been written from those that were not attempted.
+type BatchWriteError = client.BatchWriteError
+
+// ItemTooLargeError is returned, before the request is sent, when an item
+// written by a request is larger than the 400 KB DynamoDB allows.
+type ItemTooLargeError = client.ItemTooLargeError
+
+// NumberError is returned, before the request is sent, when a request holds a
+// number DynamoDB cannot store. Its Path names the attribute holding the number.
+type NumberError = client.NumberError
+
+// RequestError is returned, with Config.DetailedErrors, by requests failing
+// once sent to the cluster. It tells the operation, the node of the last
+// attempt, the number of attempts and the time elapsed, and wraps the error of
+// the last attempt.
+type RequestError = client.RequestError
+
+// NodeError wraps, with Config.DetailedErrors, the error of an attempt
+// attributable to a node of the cluster, such as a dial failure, a timeout or
+// a server error. Its Addr and AZ identify the node. Validation errors carry no
+// NodeError.
+type NodeError = client.NodeError
+
+// NotImplementedError is returned by the operations DAX does not implement.
+// Its Operation names the operation that was invoked.
+type NotImplementedError = client.NotImplementedError
+
+// ErrCodeNotImplementedException is the code of a NotImplementedError.
+const ErrCodeNotImplementedException = client.ErrCodeNotImplementedException
+
+// IsNotImplemented reports whether err, or an error it wraps, tells that DAX
+// does not implement the operation: a NotImplementedError returned by the
+// client or a NotImplemented error returned by the server.
+func IsNotImplemented(err error) bool {
+	return hasCode(err, client.ErrCodeNotImplemented, ErrCodeNotImplementedException)
+}
+
+// Stats holds counters describing the connections and requests of a DAX client.
+type Stats = client.Stats
+
+// DiscoveryStatus describes the discoveries of the nodes of a cluster, see
+// Dax.DiscoveryStatus.
+type DiscoveryStatus = client.DiscoveryStatus
+
+// FaultInjector injects delays and errors into the attempts of requests, for
+// chaos testing. See Config.FaultInjector.
+type FaultInjector = client.FaultInjector
+
+// Fault is a fault injected into an attempt by a FaultInjector.
+type Fault = client.Fault
+
+// NewFaultError returns an error as returned by DAX with the code sequence
+// codes, such as [4 37 38 39 46] for a ValidationException, to be injected
+// with a Fault. Such errors are retried and converted to DynamoDB errors as
+// DAX errors are.
+func NewFaultError(codes []int, code, message string, statusCode int) error {
+	return client.NewFaultError(codes, code, message, statusCode)
+}
+
+// FrameCapture receives the raw bytes of the requests and responses exchanged
+// with the nodes of a cluster, for debugging. See Config.FrameCapture.
+type FrameCapture = client.FrameCapture
+
+// Frame is the raw bytes of a request or of a response captured by a
+// FrameCapture.
+type Frame = client.Frame
+
+// FrameDirection tells whether a Frame was sent to or received from a node.
+type FrameDirection = client.FrameDirection
+
+const (
+	FrameRequest  = client.FrameRequest
+	FrameResponse = client.FrameResponse
+)
+
+// RoutingPolicy chooses the node of each request, see Config.RoutingPolicy.
+type RoutingPolicy = client.RoutingPolicy
+
+// OperationInfo describes an attempt of a request to a RoutingPolicy.
+type OperationInfo = client.OperationInfo
+
+// NodeInfo describes a node of the cluster to a RoutingPolicy.
+type NodeInfo = client.NodeInfo
+
+// NodeRole is the role of a node in its cluster.
+type NodeRole = client.NodeRole
+
+const (
+	RoleUnknown = client.RoleUnknown
+	RoleLeader  = client.RoleLeader
+	RoleReplica = client.RoleReplica
+)
+
+// NewRandomRouting returns the default RoutingPolicy, sending each attempt to
+// a random node other than the node of the previous attempt.
+func NewRandomRouting() RoutingPolicy {
+	return client.NewRandomRouting()
+}
+
+// NewRoundRobinRouting returns a RoutingPolicy sending the attempts to the
+// nodes in turn.
+func NewRoundRobinRouting() RoutingPolicy {
+	return client.NewRoundRobinRouting()
+}
+
+// NewLeastOutstandingRouting returns a RoutingPolicy sending each read to the
+// node with the fewest attempts in flight of two random nodes. Writes are
+// sent to random nodes.
+func NewLeastOutstandingRouting() RoutingPolicy {
+	return client.NewLeastOutstandingRouting()
+}
+
+// NewWeightedRouting returns a RoutingPolicy sending each attempt to a healthy
+// node of the lowest priority, chosen in proportion to its weight, as for DNS
+// SRV records. It is the default with srv HostPorts.
+func NewWeightedRouting() RoutingPolicy {
+	return client.NewWeightedRouting()
+}
+
+// ClusterConfig is the configuration of the connections to a cluster, see
+// Config.Secondary.
+type ClusterConfig = client.Config
+
+// The names of the clusters returned by Dax.ActiveCluster.
+const (
+	PrimaryCluster   = client.PrimaryCluster
+	SecondaryCluster = client.SecondaryCluster
+)
+
 type Config struct {
 	client.Config
 
@@ -50,8 +218,68 @@ type Config struct {
 	WriteRetries   int
 	ReadRetries    int
 
+	// Retries of the unprocessed keys and items of BatchGetItemAll and
+	// BatchWriteItemAll: at most UnprocessedRetries retries are made, waiting
+	// between retries for a jittered delay starting at UnprocessedBaseDelay and
+	// doubling up to UnprocessedMaxDelay.
+	UnprocessedRetries   int
+	UnprocessedBaseDelay time.Duration
+	UnprocessedMaxDelay  time.Duration
+
 	LogLevel aws.LogLevelType
 	Logger   aws.Logger
+
+	// Fallback is a DynamoDB client, such as a *dynamodb.DynamoDB, that the
+	// requests DAX does not serve are sent to when enabled below. These
+	// requests bypass the caches of DAX.
+	Fallback dynamodbiface.DynamoDBAPI
+
+	// EnablePartiQLFallback sends the PartiQL requests, which DAX does not
+	// support, to Fallback. Their results are not cached, and they do not
+	// update the caches of DAX. When false, they fail with a not implemented
+	// error.
+	EnablePartiQLFallback bool
+
+	// EnableDegradedMode sends the reads to Fallback instead of the cluster
+	// while the health checks of the cluster find it unreachable, see
+	// HealthCheckInterval, which must be set. Reads sent to Fallback are
+	// neither served from nor added to the caches of DAX. Once the cluster is
+	// reachable again, requests are sent to it anew.
+	//
+	// Writes are sent to Fallback only if AllowDegradedWrites is also set, as
+	// items they write may be stale in the caches of DAX until evicted once the
+	// cluster is reachable again. Otherwise they are sent to the cluster.
+	EnableDegradedMode  bool
+	AllowDegradedWrites bool
+
+	// TableRouting, if not nil, tells the tables served by DAX: requests for
+	// the tables it returns false for are sent to Fallback instead, which must
+	// be set, bypassing the caches of DAX. A BatchGetItem or BatchWriteItem for
+	// tables of both is split into a request to the cluster and a request to
+	// Fallback, sent at once, whose outputs are merged. Transactions for tables
+	// of both, and batch requests for tables of both made with the Request
+	// methods, fail with an InvalidParameter error.
+	TableRouting func(table string) bool
+
+	// Secondary, if not nil, configures a secondary cluster, such as a cluster
+	// of another region, that requests are sent to once the health checks of
+	// the primary cluster, see HealthCheckInterval, find it unreachable. Its
+	// HostPorts, Region and Credentials must be set, as for the primary. If
+	// AutomaticFailback is set, requests are sent to the primary again once it
+	// is reachable again, otherwise once Dax.Failback is called.
+	Secondary         *ClusterConfig
+	AutomaticFailback bool
+
+	// ErrorOnItemNotFound makes GetItemTyped fail with an ItemNotFoundError
+	// when the item does not exist, instead of returning a nil item.
+	ErrorOnItemNotFound bool
+
+	// MarshalOptions and UnmarshalOptions configure the dynamodbattribute
+	// encoder and decoder of the typed helpers, such as PutItemTyped and
+	// GetItemTyped, e.g. to set their TagKey. The defaults of the
+	// dynamodbattribute package apply when nil.
+	MarshalOptions   []func(*dynamodbattribute.Encoder)
+	UnmarshalOptions []func(*dynamodbattribute.Decoder)
 }
 
 // DefaultConfig returns the default DAX configuration.
@@ -66,6 +294,10 @@ func DefaultConfig() Config {
 		ReadRetries:    2,
 		LogLevel:       aws.LogOff,
 		Logger:         aws.NewDefaultLogger(),
+
+		UnprocessedRetries:   10,
+		UnprocessedBaseDelay: 50 * time.Millisecond,
+		UnprocessedMaxDelay:  5 * time.Second,
 	}
 }
 
@@ -81,9 +313,37 @@ func NewConfigWithSession(session session.Session) Config {
 }
 
 // New creates a new instance of the DAX client with a DAX configuration.
+// The returned client must be closed with Close when no longer used.
+//
+// The client keeps a copy of cfg, including its HostPorts, Secondary and
+// option slices: changes made to cfg after New returns have no effect on it.
 func New(cfg Config) (*Dax, error) {
+	return NewWithContext(aws.BackgroundContext(), cfg)
+}
+
+// NewWithContext is New with ctx aborting the wait for the first discovery of
+// the cluster, see Config.BootstrapTimeout.
+func NewWithContext(ctx aws.Context, cfg Config) (*Dax, error) {
+	cfg = cfg.clone()
+	if cfg.EnablePartiQLFallback && cfg.Fallback == nil {
+		return nil, awserr.New(request.InvalidParameterErrCode, "EnablePartiQLFallback requires a Fallback client", nil)
+	}
+	if cfg.TableRouting != nil && cfg.Fallback == nil {
+		return nil, awserr.New(request.InvalidParameterErrCode, "TableRouting requires a Fallback client", nil)
+	}
+	if cfg.EnableDegradedMode && (cfg.Fallback == nil || cfg.HealthCheckInterval <= 0) {
+		return nil, awserr.New(request.InvalidParameterErrCode, "EnableDegradedMode requires a Fallback client and a HealthCheckInterval", nil)
+	}
 	cfg.Config.SetLogger(cfg.Logger, cfg.LogLevel)
-	c, err := client.New(cfg.Config)
+	var c client.DaxAPI
+	var err error
+	if cfg.Secondary != nil {
+		secondary := *cfg.Secondary
+		secondary.SetLogger(cfg.Logger, cfg.LogLevel)
+		c, err = client.NewFailoverWithContext(ctx, cfg.Config, secondary, cfg.AutomaticFailback)
+	} else {
+		c, err = client.NewWithContext(ctx, cfg.Config)
+	}
 	if err != nil {
 		if cfg.Logger != nil {
 			cfg.Logger.Log(fmt.Sprintf("ERROR: Exception in initialisation of DAX Client : %s", err))
@@ -131,8 +391,27 @@ func NewWithSession(session session.Session) (*Dax, error) {
 	return New(dc)
 }
 
+// Returns a copy of c sharing none of its slices and pointers, except for
+// those to values safe for concurrent use, such as the Credentials, the Logger
+// and the Fallback client.
+func (c Config) clone() Config {
+	c.HostPorts = append([]string(nil), c.HostPorts...)
+	c.MarshalOptions = append(([]func(*dynamodbattribute.Encoder))(nil), c.MarshalOptions...)
+	c.UnmarshalOptions = append(([]func(*dynamodbattribute.Decoder))(nil), c.UnmarshalOptions...)
+	if c.Secondary != nil {
+		secondary := *c.Secondary
+		secondary.HostPorts = append([]string(nil), secondary.HostPorts...)
+		c.Secondary = &secondary
+	}
+	return c
+}
+
 func (c *Config) mergeFrom(ac aws.Config) {
-	if r := ac.MaxRetries; r != nil && *r != aws.UseServiceDefaultRetries {
+	// as for the SDK clients, a Retryer takes precedence over MaxRetries
+	if r, ok := ac.Retryer.(request.Retryer); ok {
+		c.WriteRetries = r.MaxRetries()
+		c.ReadRetries = r.MaxRetries()
+	} else if r := ac.MaxRetries; r != nil && *r != aws.UseServiceDefaultRetries {
 		c.WriteRetries = *r
 		c.ReadRetries = *r
 	}
@@ -154,35 +433,102 @@ func (c *Config) mergeFrom(ac aws.Config) {
 	}
 }
 
-func (c *Config) requestOptions(read bool, ctx context.Context, opts ...request.Option) (client.RequestOptions, context.CancelFunc, error) {
+func (d *Dax) isClosed() bool {
+	return atomic.LoadInt32(&d.closed) != 0
+}
+
+func (d *Dax) requestOptions(read bool, ctx context.Context, opts appliedOptions) (client.RequestOptions, context.CancelFunc, error) {
+	if d.isClosed() {
+		return client.RequestOptions{}, nil, ErrClientClosed
+	}
+	return d.config.requestOptions(read, ctx, opts)
+}
+
+// setRequestContext sets the context of a paginated request, applying RequestTimeout
+// if ctx is nil. The timeout is released once the request completes.
+func (d *Dax) setRequestContext(req *request.Request, ctx context.Context) {
+	ctx, cfn := d.config.requestContext(ctx)
+	req.SetContext(ctx)
+	if cfn != nil {
+		req.Handlers.Complete.PushBack(func(*request.Request) { cfn() })
+	}
+}
+
+func (c *Config) requestOptions(read bool, ctx context.Context, opts appliedOptions) (client.RequestOptions, context.CancelFunc, error) {
 	r := c.WriteRetries
 	if read {
 		r = c.ReadRetries
 	}
-	var cfn context.CancelFunc
-	if ctx == nil && c.RequestTimeout > 0 {
-		ctx, cfn = context.WithTimeout(aws.BackgroundContext(), c.RequestTimeout)
-	}
+	ctx, cfn := c.requestContext(ctx)
 	opt := client.RequestOptions{
 		LogLevel:   c.LogLevel,
 		Logger:     c.Logger,
 		MaxRetries: r,
 	}
-	if err := opt.MergeFromRequestOptions(ctx, opts...); err != nil {
+	if err := opt.MergeFromAppliedOptions(ctx, opts.r); err != nil {
 		if c.Logger != nil && c.LogLevel.AtLeast(aws.LogDebug) {
 			c.Logger.Log(fmt.Sprintf("DEBUG: Error in merging from Request Options : %s", err))
 		}
+		if cfn != nil {
+			cfn()
+		}
 		return client.RequestOptions{}, nil, err
 	}
 	return opt, cfn, nil
 }
 
+// The request.Options of a request, applied once to a request standing in for
+// it, from which the client options, the changes to the input and the values
+// set by options such as WithDirectDynamoDB are read.
+type appliedOptions struct {
+	r *request.Request // nil if there are no options
+}
+
+// Applies opts to a request of input.
+func applyOptions(input interface{}, opts []request.Option) appliedOptions {
+	if len(opts) == 0 {
+		return appliedOptions{}
+	}
+	r := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{}, input, nil)
+	r.ApplyOptions(opts...)
+	return appliedOptions{r: r}
+}
+
+// Returns the value of key in the context set by the options, or nil.
+func (o appliedOptions) value(key interface{}) interface{} {
+	if o.r == nil {
+		return nil
+	}
+	return o.r.Context().Value(key)
+}
+
+// Returns input as changed by the options changing the input of the request
+// they are applied to, such as WithConsistentRead.
+func (o appliedOptions) input(input interface{}) interface{} {
+	if o.r == nil {
+		return input
+	}
+	return o.r.Params
+}
+
+// requestContext returns ctx unchanged, or if ctx is nil a background context
+// bounded by RequestTimeout. The returned cancel function is nil if no context was created.
+func (c *Config) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx != nil {
+		return ctx, nil
+	}
+	if c.RequestTimeout > 0 {
+		return context.WithTimeout(aws.BackgroundContext(), c.RequestTimeout)
+	}
+	return aws.BackgroundContext(), nil
+}
+
 func buildHandlersForUnimplementedOperations() *request.Handlers {
 	h := &request.Handlers{}
 	h.Build.PushFrontNamed(request.NamedHandler{
 		Name: "dax.BuildHandler",
 		Fn: func(r *request.Request) {
-			r.Error = errors.New(client.ErrCodeNotImplemented)
+			r.Error = &NotImplementedError{Operation: r.Operation.Name}
 			return
 		}})
 	return h
@@ -190,8 +536,8 @@ func buildHandlersForUnimplementedOperations() *request.Handlers {
 
 var handlersForUnimplementedOperations = buildHandlersForUnimplementedOperations()
 
-func newRequestForUnimplementedOperation() *request.Request {
-	op := &request.Operation{Name: "Unimplemented"}
+func newRequestForUnimplementedOperation(name string) *request.Request {
+	op := &request.Operation{Name: name}
 	clientInfo := metadata.ClientInfo{ServiceName: "dax"}
 	req := request.New(aws.Config{}, clientInfo, *handlersForUnimplementedOperations, nil, op, nil, nil)
 	return req
@@ -1,9 +1,16 @@
 package dax
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-dax-go/dax/internal/client"
 	"github.com/aws/aws-sdk-go/aws"
+	awsclient "github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
 func TestConfigMergeFrom(t *testing.T) {
@@ -35,6 +42,27 @@ func TestConfigMergeFrom(t *testing.T) {
 			expectedWriteRetries: 123,
 			expectedReadRetries:  123,
 		},
+		{
+			testName:             "DefaultConfig merging with an aws config that disables retries should result in no retries",
+			daxConfig:            DefaultConfig(),
+			awsConfig:            aws.Config{MaxRetries: aws.Int(0)},
+			expectedWriteRetries: 0,
+			expectedReadRetries:  0,
+		},
+		{
+			testName:             "DefaultConfig merging with an aws config that specifies a Retryer should result in using its MaxRetries",
+			daxConfig:            DefaultConfig(),
+			awsConfig:            *request.WithRetryer(aws.NewConfig(), awsclient.DefaultRetryer{NumMaxRetries: 5}),
+			expectedWriteRetries: 5,
+			expectedReadRetries:  5,
+		},
+		{
+			testName:             "DefaultConfig merging with an aws config that specifies both a Retryer and MaxRetries should result in using the Retryer",
+			daxConfig:            DefaultConfig(),
+			awsConfig:            *request.WithRetryer(aws.NewConfig().WithMaxRetries(123), awsclient.DefaultRetryer{NumMaxRetries: 1}),
+			expectedWriteRetries: 1,
+			expectedReadRetries:  1,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -52,3 +80,150 @@ func TestConfigMergeFrom(t *testing.T) {
 		})
 	}
 }
+
+func TestNilContextAppliesRequestTimeout(t *testing.T) {
+	calls := map[string]func(d *Dax) error{
+		"PutItem": func(d *Dax) error {
+			_, err := d.PutItemWithContext(nil, &dynamodb.PutItemInput{})
+			return err
+		},
+		"DeleteItem": func(d *Dax) error {
+			_, err := d.DeleteItemWithContext(nil, &dynamodb.DeleteItemInput{})
+			return err
+		},
+		"UpdateItem": func(d *Dax) error {
+			_, err := d.UpdateItemWithContext(nil, &dynamodb.UpdateItemInput{})
+			return err
+		},
+		"GetItem": func(d *Dax) error {
+			_, err := d.GetItemWithContext(nil, &dynamodb.GetItemInput{})
+			return err
+		},
+		"Scan": func(d *Dax) error {
+			_, err := d.ScanWithContext(nil, &dynamodb.ScanInput{})
+			return err
+		},
+		"Query": func(d *Dax) error {
+			_, err := d.QueryWithContext(nil, &dynamodb.QueryInput{})
+			return err
+		},
+		"BatchWriteItem": func(d *Dax) error {
+			_, err := d.BatchWriteItemWithContext(nil, &dynamodb.BatchWriteItemInput{})
+			return err
+		},
+		"BatchGetItem": func(d *Dax) error {
+			_, err := d.BatchGetItemWithContext(nil, &dynamodb.BatchGetItemInput{})
+			return err
+		},
+		"TransactWriteItems": func(d *Dax) error {
+			_, err := d.TransactWriteItemsWithContext(nil, &dynamodb.TransactWriteItemsInput{})
+			return err
+		},
+		"TransactGetItems": func(d *Dax) error {
+			_, err := d.TransactGetItemsWithContext(nil, &dynamodb.TransactGetItemsInput{})
+			return err
+		},
+		"BatchGetItemPages": func(d *Dax) error {
+			return d.BatchGetItemPagesWithContext(nil, &dynamodb.BatchGetItemInput{}, func(*dynamodb.BatchGetItemOutput, bool) bool { return true })
+		},
+		"QueryPages": func(d *Dax) error {
+			return d.QueryPagesWithContext(nil, &dynamodb.QueryInput{}, func(*dynamodb.QueryOutput, bool) bool { return true })
+		},
+		"ScanPages": func(d *Dax) error {
+			return d.ScanPagesWithContext(nil, &dynamodb.ScanInput{}, func(*dynamodb.ScanOutput, bool) bool { return true })
+		},
+	}
+
+	for _, timeout := range []time.Duration{time.Minute, 0} {
+		for name, call := range calls {
+			stub := client.NewClientStub(
+				[]*dynamodb.BatchGetItemOutput{{}},
+				[]*dynamodb.QueryOutput{{}},
+				[]*dynamodb.ScanOutput{{}},
+			)
+			db := NewWithInternalClient(stub)
+			db.config.RequestTimeout = timeout
+
+			if err := call(db); err != nil {
+				t.Errorf("%s (timeout %v): unexpected error %v", name, timeout, err)
+				continue
+			}
+			opts := stub.GetRequestOptions()
+			if len(opts) != 1 {
+				t.Errorf("%s (timeout %v): expected 1 request, got %d", name, timeout, len(opts))
+				continue
+			}
+			ctx := opts[0].Context
+			if ctx == nil {
+				t.Errorf("%s (timeout %v): expected non-nil context", name, timeout)
+				continue
+			}
+			deadline, ok := ctx.Deadline()
+			if timeout == 0 {
+				if ok {
+					t.Errorf("%s: expected no deadline, got %v", name, deadline)
+				}
+			} else if !ok || time.Until(deadline) > timeout {
+				t.Errorf("%s: expected deadline within %v, got %v (set %v)", name, timeout, time.Until(deadline), ok)
+			}
+		}
+	}
+}
+
+func TestNewCopiesConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HostPorts = []string{"127.0.0.1:8111"}
+	cfg.Region = "us-west-2"
+	cfg.HealthCheckInterval = time.Hour
+	cfg.UnmarshalOptions = []func(*dynamodbattribute.Decoder){func(d *dynamodbattribute.Decoder) { d.TagKey = "ddb" }}
+	secondary := client.DefaultConfig()
+	secondary.HostPorts = []string{"127.0.0.2:8111"}
+	secondary.Region = "us-east-1"
+	cfg.Secondary = &secondary
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer d.Close()
+	cluster := d.client
+	stub := client.NewClientStub(nil, nil, nil)
+	d.client = stub
+	defer func() { d.client = cluster }()
+
+	// the application changes its Config while requests are made, which the
+	// race detector reports if the client shares any of it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			cfg.HostPorts[0] = fmt.Sprintf("127.0.0.1:%d", 9000+i)
+			cfg.UnmarshalOptions[0] = func(d *dynamodbattribute.Decoder) { d.TagKey = "json" }
+			cfg.Secondary.HostPorts[0] = "127.0.0.3:8111"
+			cfg.RequestTimeout = time.Duration(i) * time.Second
+			cfg.ReadRetries = i
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := d.GetItemWithContext(nil, &dynamodb.GetItemInput{TableName: aws.String("t")}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		d.EffectiveConfig()
+		d.decoder()
+	}
+	<-done
+
+	if d.config.HostPorts[0] != "127.0.0.1:8111" || d.config.Secondary.HostPorts[0] != "127.0.0.2:8111" {
+		t.Errorf("expect the client's endpoints unchanged, got %v and %v", d.config.HostPorts, d.config.Secondary.HostPorts)
+	}
+	if d.config.RequestTimeout != time.Minute || d.config.ReadRetries != 2 {
+		t.Errorf("expect the client's request options unchanged, got %v and %d", d.config.RequestTimeout, d.config.ReadRetries)
+	}
+	if tag := d.decoder().TagKey; tag != "ddb" {
+		t.Errorf("expect the client's unmarshal options unchanged, got tag key %q", tag)
+	}
+	for _, opt := range stub.GetRequestOptions() {
+		if opt.MaxRetries != 2 {
+			t.Errorf("expect 2 retries, got %d", opt.MaxRetries)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+
+	"github.com/aws/aws-dax-go/dax/internal/cbor"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ErrCodeInvalidPageToken is the error code of PageTokenError.
+const ErrCodeInvalidPageToken = "InvalidPageToken"
+
+// Version of the page tokens returned by EncodePageToken.
+const pageTokenVersion = 1
+
+// Tag of the number key attributes of page tokens.
+const pageTokenNumberTag = 3321
+
+// PageTokenError is returned by DecodePageToken when the token was not
+// returned by EncodePageToken, or was truncated or altered since.
+type PageTokenError struct {
+	// Reason tells why the token was rejected.
+	Reason string
+	// Err is the decoding error, if any.
+	Err error
+}
+
+func (e *PageTokenError) Error() string {
+	return awserr.SprintError(e.Code(), e.Message(), "", e.Err)
+}
+
+func (e *PageTokenError) Code() string {
+	return ErrCodeInvalidPageToken
+}
+
+func (e *PageTokenError) Message() string {
+	return "invalid page token: " + e.Reason
+}
+
+func (e *PageTokenError) OrigErr() error {
+	return e.Err
+}
+
+// EncodePageToken returns key, usually the LastEvaluatedKey of a Query or Scan
+// page, as an opaque URL safe string to be decoded by DecodePageToken. The key
+// attributes must be strings, numbers or binaries. A nil or empty key, which
+// does not identify a page, is returned as the empty string.
+//
+// The token is checksummed to detect truncated or altered tokens, but it is
+// neither encrypted nor signed: it reveals the key to whoever holds it, and
+// callers must not trust a token to come from EncodePageToken.
+func EncodePageToken(key map[string]*dynamodb.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	names := make([]string, 0, len(key))
+	for name, av := range key {
+		if !isKeyAttributeValue(av) {
+			return "", awserr.New(request.InvalidParameterErrCode, fmt.Sprintf("invalid page token key attribute %s: not a string, number or binary", name), nil)
+		}
+		if av.N != nil {
+			if _, ok := new(cbor.Decimal).SetString(*av.N); !ok {
+				return "", awserr.New(request.InvalidParameterErrCode, fmt.Sprintf("invalid page token key attribute %s: invalid number %v", name, *av.N), nil)
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteByte(pageTokenVersion)
+	w := cbor.NewWriter(&buf)
+	defer w.Close()
+	if err := w.WriteMapHeader(len(names)); err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		if err := w.WriteString(name); err != nil {
+			return "", err
+		}
+		if err := writeKeyAttributeValue(w, key[name]); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	var sum [crc32.Size]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum[:])
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodePageToken returns the key encoded in token by EncodePageToken, to be
+// used as the ExclusiveStartKey of a Query or Scan. The empty string is
+// decoded as a nil key. Any other token that was not returned by
+// EncodePageToken is rejected with a *PageTokenError.
+func DecodePageToken(token string) (map[string]*dynamodb.AttributeValue, error) {
+	if token == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, &PageTokenError{Reason: "not base64url", Err: err}
+	}
+	if len(b) < 1+crc32.Size {
+		return nil, &PageTokenError{Reason: "too short"}
+	}
+	data, sum := b[:len(b)-crc32.Size], b[len(b)-crc32.Size:]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(sum) {
+		return nil, &PageTokenError{Reason: "checksum mismatch"}
+	}
+	if data[0] != pageTokenVersion {
+		return nil, &PageTokenError{Reason: fmt.Sprintf("unsupported version %d", data[0])}
+	}
+
+	br := bytes.NewReader(data[1:])
+	r := cbor.NewReader(br)
+	defer r.Close()
+	n, err := r.ReadMapLength()
+	if err != nil {
+		return nil, &PageTokenError{Reason: "malformed key", Err: err}
+	}
+	if n <= 0 || n > br.Len()+r.Buffered() {
+		return nil, &PageTokenError{Reason: fmt.Sprintf("invalid key length %d", n)}
+	}
+	key := make(map[string]*dynamodb.AttributeValue, n)
+	for i := 0; i < n; i++ {
+		name, err := r.ReadString()
+		if err != nil {
+			return nil, &PageTokenError{Reason: "malformed key", Err: err}
+		}
+		av, err := readKeyAttributeValue(r)
+		if err != nil {
+			return nil, &PageTokenError{Reason: "malformed key", Err: err}
+		}
+		if _, ok := key[name]; ok {
+			return nil, &PageTokenError{Reason: "duplicate key attribute " + name}
+		}
+		key[name] = av
+	}
+	if br.Len()+r.Buffered() > 0 {
+		return nil, &PageTokenError{Reason: "trailing data"}
+	}
+	return key, nil
+}
+
+// Returns whether av is a string, number or binary, the types of key attributes.
+func isKeyAttributeValue(av *dynamodb.AttributeValue) bool {
+	return av != nil && (av.S != nil || av.N != nil || av.B != nil)
+}
+
+// Numbers are written as tagged strings rather than as DAX numbers, so that
+// they are decoded as written and not in a normalized form.
+func writeKeyAttributeValue(w *cbor.Writer, av *dynamodb.AttributeValue) error {
+	switch {
+	case av.S != nil:
+		return w.WriteString(*av.S)
+	case av.N != nil:
+		if err := w.WriteTag(pageTokenNumberTag); err != nil {
+			return err
+		}
+		return w.WriteString(*av.N)
+	default:
+		return w.WriteBytes(av.B)
+	}
+}
+
+func readKeyAttributeValue(r *cbor.Reader) (*dynamodb.AttributeValue, error) {
+	hdr, err := r.PeekHeader()
+	if err != nil {
+		return nil, err
+	}
+	switch hdr & cbor.MajorTypeMask {
+	case cbor.Utf:
+		s, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{S: aws.String(s)}, nil
+	case cbor.Bytes:
+		b, err := r.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{B: b}, nil
+	case cbor.Tag:
+		tag, err := r.ReadTag()
+		if err != nil {
+			return nil, err
+		}
+		if tag != pageTokenNumberTag {
+			return nil, fmt.Errorf("unexpected tag %d", tag)
+		}
+		n, err := r.ReadString()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := new(cbor.Decimal).SetString(n); !ok {
+			return nil, fmt.Errorf("invalid number %q", n)
+		}
+		return &dynamodb.AttributeValue{N: aws.String(n)}, nil
+	}
+	return nil, fmt.Errorf("unexpected cbor header %#x", hdr)
+}
@@ -0,0 +1,150 @@
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestPageToken_RoundTrip(t *testing.T) {
+	keys := []map[string]*dynamodb.AttributeValue{
+		{"pk": {S: aws.String("customer#1")}},
+		{"pk": {S: aws.String("")}},
+		{"pk": {S: aws.String("ünïcödé/+=?&")}},
+		{"pk": {N: aws.String("42")}},
+		{"pk": {N: aws.String("-7")}},
+		{"pk": {N: aws.String("3.25")}},
+		{"pk": {N: aws.String("325E-2")}},
+		{"pk": {N: aws.String("123456789012345678901234567890")}},
+		{"pk": {B: []byte{0, 1, 2, 0xfe, 0xff}}},
+		{"pk": {B: []byte{}}},
+		{
+			"pk":    {S: aws.String("customer#1")},
+			"sk":    {N: aws.String("1700000000")},
+			"gsipk": {B: []byte("index")},
+		},
+	}
+	for _, key := range keys {
+		token, err := EncodePageToken(key)
+		if err != nil {
+			t.Errorf("unexpected error encoding %v: %v", key, err)
+			continue
+		}
+		if strings.ContainsAny(token, "+/=") {
+			t.Errorf("expect a URL safe token, got %v", token)
+		}
+		decoded, err := DecodePageToken(token)
+		if err != nil {
+			t.Errorf("unexpected error decoding %v: %v", key, err)
+			continue
+		}
+		if !reflect.DeepEqual(key, decoded) {
+			t.Errorf("expect %v, got %v", key, decoded)
+		}
+		again, _ := EncodePageToken(decoded)
+		if token != again {
+			t.Errorf("expect the same token for %v, got %v and %v", key, token, again)
+		}
+	}
+}
+
+func TestPageToken_Empty(t *testing.T) {
+	token, err := EncodePageToken(nil)
+	if err != nil || token != "" {
+		t.Errorf("expect empty token, got %q, %v", token, err)
+	}
+	key, err := DecodePageToken("")
+	if err != nil || key != nil {
+		t.Errorf("expect nil key, got %v, %v", key, err)
+	}
+}
+
+func TestPageToken_UnsupportedType(t *testing.T) {
+	for _, av := range []*dynamodb.AttributeValue{
+		nil,
+		{BOOL: aws.Bool(true)},
+		{SS: []*string{aws.String("a")}},
+		{M: map[string]*dynamodb.AttributeValue{"a": {S: aws.String("a")}}},
+		{N: aws.String("one")},
+	} {
+		_, err := EncodePageToken(map[string]*dynamodb.AttributeValue{"pk": av})
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.InvalidParameterErrCode {
+			t.Errorf("expect %v for %v, got %v", request.InvalidParameterErrCode, av, err)
+		}
+	}
+}
+
+func TestPageToken_Invalid(t *testing.T) {
+	token, err := EncodePageToken(map[string]*dynamodb.AttributeValue{
+		"pk": {S: aws.String("customer#1")},
+		"sk": {N: aws.String("17")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(token)
+	tampered := append([]byte{}, raw...)
+	tampered[len(tampered)/2] ^= 1
+	version := append([]byte{}, raw[:len(raw)-crc32.Size]...)
+	version[0] = 2
+
+	tokens := map[string]string{
+		"not base64":  "not a token!",
+		"padded":      token + "==",
+		"too short":   base64.RawURLEncoding.EncodeToString(raw[:3]),
+		"truncated":   token[:len(token)-2],
+		"cut":         base64.RawURLEncoding.EncodeToString(raw[:len(raw)-1]),
+		"tampered":    base64.RawURLEncoding.EncodeToString(tampered),
+		"version":     checksummedToken(version),
+		"trailing":    token + "AA",
+		"not a map":   checksummedToken([]byte{pageTokenVersion, 0x61, 'a'}),
+		"empty map":   checksummedToken([]byte{pageTokenVersion, 0xa0}),
+		"bad length":  checksummedToken([]byte{pageTokenVersion, 0xa5, 0x61, 'a', 0x61, 'b'}),
+		"bool value":  checksummedToken([]byte{pageTokenVersion, 0xa1, 0x61, 'a', 0xf5}),
+		"int value":   checksummedToken([]byte{pageTokenVersion, 0xa1, 0x61, 'a', 0x01}),
+		"other tag":   checksummedToken([]byte{pageTokenVersion, 0xa1, 0x61, 'a', 0xc4, 0x61, '1'}),
+		"bad number":  checksummedToken([]byte{pageTokenVersion, 0xa1, 0x61, 'a', 0xd9, 0x0c, 0xf9, 0x61, 'x'}),
+		"duplicated":  checksummedToken([]byte{pageTokenVersion, 0xa2, 0x61, 'a', 0x61, 'x', 0x61, 'a', 0x61, 'y'}),
+		"extra bytes": checksummedToken([]byte{pageTokenVersion, 0xa1, 0x61, 'a', 0x61, 'x', 0x00}),
+	}
+	for name, tok := range tokens {
+		key, err := DecodePageToken(tok)
+		if _, ok := err.(*PageTokenError); !ok {
+			t.Errorf("%s: expect a PageTokenError, got %v, %v", name, key, err)
+			continue
+		}
+		if e, a := ErrCodeInvalidPageToken, err.(awserr.Error).Code(); e != a {
+			t.Errorf("%s: expect %v, got %v", name, e, a)
+		}
+	}
+}
+
+// Returns a token holding data with a valid checksum.
+func checksummedToken(data []byte) string {
+	var sum [crc32.Size]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	return base64.RawURLEncoding.EncodeToString(append(data, sum[:]...))
+}
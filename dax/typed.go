@@ -0,0 +1,362 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// ErrCodeItemNotFound is the code of an ItemNotFoundError.
+const ErrCodeItemNotFound = "ItemNotFound"
+
+// ItemNotFoundError is returned by GetItemTyped when the item does not exist
+// and Config.ErrorOnItemNotFound is set.
+type ItemNotFoundError struct {
+	// Table is the table of the item.
+	Table string
+	// Key is the key of the item.
+	Key map[string]*dynamodb.AttributeValue
+}
+
+func (e *ItemNotFoundError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code(), e.Message())
+}
+
+func (e *ItemNotFoundError) Code() string {
+	return ErrCodeItemNotFound
+}
+
+func (e *ItemNotFoundError) Message() string {
+	return fmt.Sprintf("no item of table %s has the key %v", e.Table, e.Key)
+}
+
+func (e *ItemNotFoundError) OrigErr() error {
+	return nil
+}
+
+// UnmarshalError is returned by the typed helpers, such as GetItemTyped, when
+// an item cannot be unmarshaled into the requested type. Path names the
+// attribute of the item that failed to unmarshal, if known.
+type UnmarshalError struct {
+	// Path is the name of the attribute that failed to unmarshal.
+	Path string
+	// Page and Index, counted from 0, locate the item among the pages of
+	// QueryTyped and ScanTyped. They are -1 for the other helpers.
+	Page  int
+	Index int
+	// Err is the error returned by the dynamodbattribute decoder.
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code(), e.Message())
+}
+
+func (e *UnmarshalError) Code() string {
+	return request.ErrCodeSerialization
+}
+
+func (e *UnmarshalError) Message() string {
+	item := "item"
+	if e.Page >= 0 {
+		item = fmt.Sprintf("item %d of page %d", e.Index, e.Page)
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("failed to unmarshal %s: %v", item, e.Err)
+	}
+	return fmt.Sprintf("failed to unmarshal attribute %s of %s: %v", e.Path, item, e.Err)
+}
+
+func (e *UnmarshalError) OrigErr() error {
+	return e.Err
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalError is returned by the typed helpers, such as PutItemTyped, when a
+// value cannot be marshaled into an item. Path names the field of the value
+// that failed to marshal, if known.
+type MarshalError struct {
+	// Path is the name of the field that failed to marshal.
+	Path string
+	// Err is the error returned by the dynamodbattribute encoder.
+	Err error
+}
+
+func (e *MarshalError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code(), e.Message())
+}
+
+func (e *MarshalError) Code() string {
+	return request.ErrCodeSerialization
+}
+
+func (e *MarshalError) Message() string {
+	if e.Path == "" {
+		return fmt.Sprintf("failed to marshal item: %v", e.Err)
+	}
+	return fmt.Sprintf("failed to marshal field %s: %v", e.Path, e.Err)
+}
+
+func (e *MarshalError) OrigErr() error {
+	return e.Err
+}
+
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+// GetItemTyped gets an item with GetItemWithContext and unmarshals it into a
+// T with the dynamodbattribute decoder, which honors the dynamodbav struct
+// tags of T. When the item does not exist, it returns a nil item, or an
+// ItemNotFoundError if Config.ErrorOnItemNotFound is set.
+func GetItemTyped[T any](ctx aws.Context, d *Dax, input *dynamodb.GetItemInput, opts ...request.Option) (*T, error) {
+	output, err := d.GetItemWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if output == nil || len(output.Item) == 0 {
+		if d.config.ErrorOnItemNotFound {
+			return nil, &ItemNotFoundError{Table: aws.StringValue(input.TableName), Key: input.Key}
+		}
+		return nil, nil
+	}
+	v := new(T)
+	if err := d.unmarshalItem(output.Item, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// PutItemTyped marshals value into an item with the dynamodbattribute encoder,
+// which honors the dynamodbav struct tags of T, such as omitempty, and puts it
+// into the table with PutItemWithContext.
+func PutItemTyped[T any](ctx aws.Context, d *Dax, table string, value T, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	return d.putItemTyped(ctx, table, value, nil, opts)
+}
+
+// PutItemTypedWithCondition is PutItemTyped putting the item only if the
+// condition of cond, built with expression.NewBuilder().WithCondition, holds.
+// Otherwise it returns a *dynamodb.ConditionalCheckFailedException.
+func PutItemTypedWithCondition[T any](ctx aws.Context, d *Dax, table string, value T, cond expression.Expression, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	return d.putItemTyped(ctx, table, value, &cond, opts)
+}
+
+// UpdateItemTyped updates the item of the table with the key, marshaled like
+// the items of PutItemTyped, with UpdateItemWithContext and returns the
+// updated item unmarshaled into a T like GetItemTyped does.
+func UpdateItemTyped[T any](ctx aws.Context, d *Dax, table string, key interface{}, update expression.UpdateBuilder, opts ...request.Option) (*T, error) {
+	k, err := d.marshalItem(key)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(table),
+		Key:                       k,
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+	}
+	output, err := d.UpdateItemWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	v := new(T)
+	if output != nil && len(output.Attributes) > 0 {
+		if err := d.unmarshalItem(output.Attributes, v); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// QueryTyped queries all the pages of the query with QueryPagesWithContext and
+// returns their items unmarshaled into Ts like GetItemTyped does. If opts hold
+// WithMaxItems, no more items are returned, and no more pages queried, than
+// its bound. The items of the pages queried before an error are returned with
+// the error.
+func QueryTyped[T any](ctx aws.Context, d *Dax, input *dynamodb.QueryInput, opts ...request.Option) ([]T, error) {
+	var items []T
+	var uerr error
+	max, page := maxItems(opts), 0
+	err := d.QueryPagesWithContext(ctx, input, func(output *dynamodb.QueryOutput, lastPage bool) bool {
+		items, uerr = appendTyped(d, items, output.Items, page, max)
+		page++
+		return uerr == nil && (max <= 0 || len(items) < max)
+	}, opts...)
+	if err == nil {
+		err = uerr
+	}
+	return items, err
+}
+
+// ScanTyped is QueryTyped scanning all the pages of the scan with
+// ScanPagesWithContext.
+func ScanTyped[T any](ctx aws.Context, d *Dax, input *dynamodb.ScanInput, opts ...request.Option) ([]T, error) {
+	var items []T
+	var uerr error
+	max, page := maxItems(opts), 0
+	err := d.ScanPagesWithContext(ctx, input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		items, uerr = appendTyped(d, items, output.Items, page, max)
+		page++
+		return uerr == nil && (max <= 0 || len(items) < max)
+	}, opts...)
+	if err == nil {
+		err = uerr
+	}
+	return items, err
+}
+
+// WithMaxItems returns a request.Option bounding the number of items returned
+// by QueryTyped and ScanTyped to max, so that a large query or scan does not
+// hold all its items in memory. It is ignored by the other requests.
+func WithMaxItems(max int) request.Option {
+	return func(r *request.Request) {
+		r.SetContext(context.WithValue(r.Context(), maxItemsKey{}, max))
+	}
+}
+
+type maxItemsKey struct{}
+
+// Returns the bound of WithMaxItems held by opts, or 0.
+func maxItems(opts []request.Option) int {
+	max, _ := applyOptions(nil, opts).value(maxItemsKey{}).(int)
+	return max
+}
+
+// Appends the items of the page numbered n, unmarshaled into Ts, to items
+// until it holds max items, if max is positive.
+func appendTyped[T any](d *Dax, items []T, page []map[string]*dynamodb.AttributeValue, n, max int) ([]T, error) {
+	for i, item := range page {
+		if max > 0 && len(items) >= max {
+			break
+		}
+		var v T
+		if err := d.unmarshalItem(item, &v); err != nil {
+			uerr := err.(*UnmarshalError)
+			uerr.Page, uerr.Index = n, i
+			return items, uerr
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func (d *Dax) putItemTyped(ctx aws.Context, table string, value interface{}, cond *expression.Expression, opts []request.Option) (*dynamodb.PutItemOutput, error) {
+	item, err := d.marshalItem(value)
+	if err != nil {
+		return nil, err
+	}
+	input := &dynamodb.PutItemInput{TableName: aws.String(table), Item: item}
+	if cond != nil {
+		input.ConditionExpression = cond.Condition()
+		input.ExpressionAttributeNames = cond.Names()
+		input.ExpressionAttributeValues = cond.Values()
+	}
+	return d.PutItemWithContext(ctx, input, opts...)
+}
+
+func (d *Dax) encoder() *dynamodbattribute.Encoder {
+	return dynamodbattribute.NewEncoder(d.config.MarshalOptions...)
+}
+
+// Marshals value into an item or returns a MarshalError naming the field that
+// failed to marshal.
+func (d *Dax) marshalItem(value interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	enc := d.encoder()
+	av, err := enc.Encode(value)
+	if err != nil {
+		return nil, &MarshalError{Path: failedField(enc, reflect.ValueOf(value)), Err: err}
+	}
+	if av == nil || av.M == nil {
+		return nil, &MarshalError{Err: fmt.Errorf("%T is not marshaled to an item", value)}
+	}
+	return av.M, nil
+}
+
+// Returns the name of the first exported field of v, a struct or a pointer to
+// a struct, which fails to marshal alone.
+func failedField(enc *dynamodbattribute.Encoder, v reflect.Value) string {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			continue
+		}
+		// a struct of the field alone, keeping its tag
+		one := reflect.New(reflect.StructOf([]reflect.StructField{f})).Elem()
+		one.Field(0).Set(v.Field(i))
+		if _, err := enc.Encode(one.Interface()); err != nil {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+func (d *Dax) decoder() *dynamodbattribute.Decoder {
+	return dynamodbattribute.NewDecoder(d.config.UnmarshalOptions...)
+}
+
+// Unmarshals item into out, a pointer, or returns an UnmarshalError naming the
+// attribute that failed to unmarshal.
+func (d *Dax) unmarshalItem(item map[string]*dynamodb.AttributeValue, out interface{}) error {
+	dec := d.decoder()
+	if err := dec.Decode(&dynamodb.AttributeValue{M: item}, out); err != nil {
+		return &UnmarshalError{Path: failedAttribute(dec, item, reflect.TypeOf(out).Elem()), Page: -1, Index: -1, Err: err}
+	}
+	return nil
+}
+
+// Returns the name of the first attribute of item, in sorted order, which
+// fails to unmarshal alone into a value of type typ.
+func failedAttribute(dec *dynamodbattribute.Decoder, item map[string]*dynamodb.AttributeValue, typ reflect.Type) string {
+	names := make([]string, 0, len(item))
+	for name := range item {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		av := &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{name: item[name]}}
+		if err := dec.Decode(av, reflect.New(typ).Interface()); err != nil {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,351 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+  Copyright 2018 Amazon.com, Inc. or its affiliates. All Rights Reserved.
+
+  Licensed under the Apache License, Version 2.0 (the "License").
+  You may not use this file except in compliance with the License.
+  A copy of the License is located at
+
+      http://www.apache.org/licenses/LICENSE-2.0
+
+  or in the "license" file accompanying this file. This file is distributed
+  on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+  express or implied. See the License for the specific language governing
+  permissions and limitations under the License.
+*/
+
+package dax
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-dax-go/dax/internal/client"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+type typedItem struct {
+	ID    string   `dynamodbav:"id"`
+	Count int      `dynamodbav:"n"`
+	Tags  []string `dynamodbav:"tags,stringset"`
+	Skip  string   `dynamodbav:"-"`
+}
+
+func TestGetItemTyped(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.AddResponses(client.OpGetItem, &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		"id":   {S: aws.String("a")},
+		"n":    {N: aws.String("3")},
+		"tags": {SS: aws.StringSlice([]string{"x", "y"})},
+		"Skip": {S: aws.String("skipped")},
+	}})
+	db := NewWithInternalClient(stub)
+
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}}
+	item, err := GetItemTyped[typedItem](context.Background(), db, input)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := (&typedItem{ID: "a", Count: 3, Tags: []string{"x", "y"}}), item; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if in := stub.Requests(client.OpGetItem)[0].(*dynamodb.GetItemInput); in != input {
+		t.Errorf("expect the input to be sent, got %v", in)
+	}
+}
+
+func TestGetItemTyped_NotFound(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.AddResponses(client.OpGetItem, &dynamodb.GetItemOutput{}, &dynamodb.GetItemOutput{})
+	db := NewWithInternalClient(stub)
+	key := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}
+	input := &dynamodb.GetItemInput{TableName: aws.String("table"), Key: key}
+
+	item, err := GetItemTyped[typedItem](context.Background(), db, input)
+	if item != nil || err != nil {
+		t.Errorf("expect a nil item and error, got %v, %v", item, err)
+	}
+
+	db.config.ErrorOnItemNotFound = true
+	item, err = GetItemTyped[typedItem](context.Background(), db, input)
+	var nerr *ItemNotFoundError
+	if item != nil || !errors.As(err, &nerr) {
+		t.Fatalf("expect an ItemNotFoundError, got %v, %v", item, err)
+	}
+	if nerr.Table != "table" || !reflect.DeepEqual(key, nerr.Key) || nerr.Code() != ErrCodeItemNotFound {
+		t.Errorf("expect the table and key of the item, got %v", nerr)
+	}
+}
+
+func TestGetItemTyped_UnmarshalError(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.AddResponses(client.OpGetItem, &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String("a")},
+		"n":  {S: aws.String("three")},
+	}})
+	stub.SetErrors(client.OpGetItem, nil, errors.New("failed"))
+	db := NewWithInternalClient(stub)
+	input := &dynamodb.GetItemInput{TableName: aws.String("table")}
+
+	item, err := GetItemTyped[typedItem](context.Background(), db, input)
+	var uerr *UnmarshalError
+	if item != nil || !errors.As(err, &uerr) {
+		t.Fatalf("expect an UnmarshalError, got %v, %v", item, err)
+	}
+	if e, a := "n", uerr.Path; e != a {
+		t.Errorf("expect path %s, got %s", e, a)
+	}
+	var terr *dynamodbattribute.UnmarshalTypeError
+	if !errors.As(err, &terr) {
+		t.Errorf("expect the decoder error to be wrapped, got %v", uerr.Err)
+	}
+
+	if _, err := GetItemTyped[typedItem](context.Background(), db, input); err == nil || err.Error() != "failed" {
+		t.Errorf("expect the request error, got %v", err)
+	}
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalDynamoDBAttributeValue(*dynamodb.AttributeValue) error {
+	return errors.New("cannot marshal")
+}
+
+func TestPutItemTyped(t *testing.T) {
+	type item struct {
+		ID      string `dynamodbav:"id"`
+		Count   int    `dynamodbav:"n"`
+		Note    string `dynamodbav:"note,omitempty"`
+		Missing int    `dynamodbav:"missing,omitempty"`
+		Empty   string
+	}
+	stub := client.NewClientStub(nil, nil, nil)
+	db := NewWithInternalClient(stub)
+
+	if _, err := PutItemTyped(context.Background(), db, "table", item{ID: "a"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expect := &dynamodb.PutItemInput{
+		TableName: aws.String("table"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"id":    {S: aws.String("a")},
+			"n":     {N: aws.String("0")},
+			"Empty": {NULL: aws.Bool(true)},
+		},
+	}
+	if in := stub.Requests(client.OpPutItem)[0].(*dynamodb.PutItemInput); !reflect.DeepEqual(expect, in) {
+		t.Errorf("expect %v, got %v", expect, in)
+	}
+}
+
+func TestPutItemTypedWithCondition(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.SetErrors(client.OpPutItem, &dynamodb.ConditionalCheckFailedException{Message_: aws.String("The conditional request failed")})
+	db := NewWithInternalClient(stub)
+
+	cond, err := expression.NewBuilder().WithCondition(expression.AttributeNotExists(expression.Name("id"))).Build()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_, err = PutItemTypedWithCondition(context.Background(), db, "table", typedItem{ID: "a"}, cond)
+	var cerr *dynamodb.ConditionalCheckFailedException
+	if !errors.As(err, &cerr) {
+		t.Errorf("expect a ConditionalCheckFailedException, got %v", err)
+	}
+	in := stub.Requests(client.OpPutItem)[0].(*dynamodb.PutItemInput)
+	if e, a := "attribute_not_exists (#0)", aws.StringValue(in.ConditionExpression); e != a {
+		t.Errorf("expect condition %s, got %s", e, a)
+	}
+	if e, a := map[string]*string{"#0": aws.String("id")}, in.ExpressionAttributeNames; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect names %v, got %v", e, a)
+	}
+}
+
+func TestPutItemTyped_MarshalError(t *testing.T) {
+	type item struct {
+		ID  string           `dynamodbav:"id"`
+		Bad failingMarshaler `dynamodbav:"bad"`
+	}
+	stub := client.NewClientStub(nil, nil, nil)
+	db := NewWithInternalClient(stub)
+
+	_, err := PutItemTyped(context.Background(), db, "table", &item{ID: "a"})
+	var merr *MarshalError
+	if !errors.As(err, &merr) {
+		t.Fatalf("expect a MarshalError, got %v", err)
+	}
+	if e, a := "Bad", merr.Path; e != a {
+		t.Errorf("expect path %s, got %s", e, a)
+	}
+	if _, err := PutItemTyped(context.Background(), db, "table", "not an item"); !errors.As(err, &merr) {
+		t.Errorf("expect a MarshalError, got %v", err)
+	}
+	if n := len(stub.Requests(client.OpPutItem)); n != 0 {
+		t.Errorf("expect no request sent, got %d", n)
+	}
+}
+
+func TestUpdateItemTyped(t *testing.T) {
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.AddResponses(client.OpUpdateItem, &dynamodb.UpdateItemOutput{Attributes: map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String("a")},
+		"n":  {N: aws.String("4")},
+	}})
+	db := NewWithInternalClient(stub)
+
+	key := struct {
+		ID string `dynamodbav:"id"`
+	}{"a"}
+	update := expression.Add(expression.Name("n"), expression.Value(1))
+	item, err := UpdateItemTyped[typedItem](context.Background(), db, "table", key, update)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := (&typedItem{ID: "a", Count: 4}), item; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	in := stub.Requests(client.OpUpdateItem)[0].(*dynamodb.UpdateItemInput)
+	if e, a := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("a")}}, in.Key; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect key %v, got %v", e, a)
+	}
+	if e, a := "ADD #0 :0\n", aws.StringValue(in.UpdateExpression); e != a {
+		t.Errorf("expect update %q, got %q", e, a)
+	}
+	if e, a := dynamodb.ReturnValueAllNew, aws.StringValue(in.ReturnValues); e != a {
+		t.Errorf("expect return values %s, got %s", e, a)
+	}
+}
+
+type keyItem struct {
+	Key string `dynamodbav:"key"`
+}
+
+func keyItems(from, to int) []keyItem {
+	var items []keyItem
+	for i := from; i < to; i++ {
+		items = append(items, keyItem{Key: "key" + strconv.Itoa(i)})
+	}
+	return items
+}
+
+func TestQueryTyped(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+
+	items, err := QueryTyped[keyItem](context.Background(), db, &dynamodb.QueryInput{TableName: aws.String("tablename")})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := keyItems(0, 5), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 3, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect %v requests, got %v", e, a)
+	}
+}
+
+func TestScanTyped(t *testing.T) {
+	var pages []*dynamodb.ScanOutput
+	for _, p := range queryPages(5, 2) {
+		pages = append(pages, &dynamodb.ScanOutput{Items: p.Items, LastEvaluatedKey: p.LastEvaluatedKey})
+	}
+	stub := client.NewClientStub(nil, nil, pages)
+	db := NewWithInternalClient(stub)
+
+	items, err := ScanTyped[keyItem](context.Background(), db, &dynamodb.ScanInput{TableName: aws.String("tablename")})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := keyItems(0, 5), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
+
+func TestQueryTyped_UnmarshalError(t *testing.T) {
+	pages := queryPages(5, 2)
+	pages[1].Items[1]["key"] = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+	stub := client.NewClientStub(nil, pages, nil)
+	db := NewWithInternalClient(stub)
+
+	items, err := QueryTyped[keyItem](context.Background(), db, &dynamodb.QueryInput{TableName: aws.String("tablename")})
+	var uerr *UnmarshalError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("expect an UnmarshalError, got %v", err)
+	}
+	if uerr.Page != 1 || uerr.Index != 1 || uerr.Path != "key" {
+		t.Errorf("expect attribute key of item 1 of page 1, got %v", uerr)
+	}
+	if e, a := keyItems(0, 3), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect the items before the error %v, got %v", e, a)
+	}
+	if e, a := 2, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect no page queried after the error, got %v requests", a)
+	}
+}
+
+func TestQueryTyped_MaxItems(t *testing.T) {
+	stub := client.NewClientStub(nil, queryPages(5, 2), nil)
+	db := NewWithInternalClient(stub)
+
+	items, err := QueryTyped[keyItem](context.Background(), db, &dynamodb.QueryInput{TableName: aws.String("tablename")}, WithMaxItems(3))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := keyItems(0, 3), items; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+	if e, a := 2, len(stub.GetQueryRequests()); e != a {
+		t.Errorf("expect no page queried after the bound, got %v requests", a)
+	}
+}
+
+func TestTypedOptions(t *testing.T) {
+	type item struct {
+		ID    string `db:"id"`
+		Count int    `db:"n"`
+		Empty []string
+	}
+	stub := client.NewClientStub(nil, nil, nil)
+	stub.AddResponses(client.OpGetItem, &dynamodb.GetItemOutput{Item: map[string]*dynamodb.AttributeValue{
+		"id":    {S: aws.String("a")},
+		"n":     {N: aws.String("3")},
+		"Empty": {L: []*dynamodb.AttributeValue{}},
+	}})
+	db := NewWithInternalClient(stub)
+	db.config.MarshalOptions = []func(*dynamodbattribute.Encoder){func(e *dynamodbattribute.Encoder) {
+		e.TagKey = "db"
+		e.EnableEmptyCollections = true
+	}}
+	db.config.UnmarshalOptions = []func(*dynamodbattribute.Decoder){func(d *dynamodbattribute.Decoder) {
+		d.TagKey = "db"
+		d.EnableEmptyCollections = true
+	}}
+
+	if _, err := PutItemTyped(context.Background(), db, "table", item{ID: "a", Count: 3, Empty: []string{}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expect := map[string]*dynamodb.AttributeValue{
+		"id":    {S: aws.String("a")},
+		"n":     {N: aws.String("3")},
+		"Empty": {L: []*dynamodb.AttributeValue{}},
+	}
+	if in := stub.Requests(client.OpPutItem)[0].(*dynamodb.PutItemInput); !reflect.DeepEqual(expect, in.Item) {
+		t.Errorf("expect %v, got %v", expect, in.Item)
+	}
+
+	got, err := GetItemTyped[item](context.Background(), db, &dynamodb.GetItemInput{TableName: aws.String("table")})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, a := (&item{ID: "a", Count: 3, Empty: []string{}}), got; !reflect.DeepEqual(e, a) {
+		t.Errorf("expect %v, got %v", e, a)
+	}
+}
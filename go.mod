@@ -6,5 +6,6 @@ require (
 	github.com/antlr/antlr4 v0.0.0-20181218183524-be58ebffde8e
 	github.com/aws/aws-sdk-go v1.36.22
 	github.com/gofrs/uuid v3.3.0+incompatible
-	github.com/stretchr/testify v1.5.1
+	github.com/stretchr/testify v1.7.0
+	go.uber.org/goleak v1.1.11
 )